@@ -12,6 +12,8 @@ import (
 	
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -21,11 +23,15 @@ import (
 	
 	"shop/backend/inventory/api/proto"
 	"shop/backend/inventory/configs"
+	"shop/backend/inventory/internal/alert"
+	"shop/backend/inventory/internal/broker"
 	"shop/backend/inventory/internal/domain/entity"
 	"shop/backend/inventory/internal/repository"
 	"shop/backend/inventory/internal/repository/cache"
 	"shop/backend/inventory/internal/service"
+	"shop/backend/inventory/internal/watch"
 	grpcServer "shop/backend/inventory/internal/web/grpc"
+	"shop/backend/inventory/internal/worker"
 	"shop/backend/pkg/logger/zaplogger"
 )
 
@@ -62,11 +68,90 @@ func main() {
 	// 初始化仓储层
 	inventoryRepo := repository.NewInventoryRepository(db, inventoryCache, log)
 	warehouseRepo := repository.NewWarehouseRepository(db, log)
+	transferRepo := repository.NewTransferRepository(db, inventoryCache, log)
+	inboundRepo := repository.NewInboundRepository(db, log)
+	stocktakeRepo := repository.NewStocktakeRepository(db, inventoryCache, log)
+	outboxRepo := repository.NewOutboxRepository(db, log)
+	
+	// 启用库存变更订阅时，库存或锁定数量变化后推送给WatchInventory的订阅者。
+	// 位于快速锁定之下，Redis中的锁定写入MySQL后才推送
+	watchHub := watch.NewHub(config.Inventory.Watch.BufferSize, log)
+	var changeNotifier *repository.ChangeNotifier
+	if config.Inventory.Watch.Enabled {
+		changeNotifier = repository.NewChangeNotifier(
+			inventoryRepo,
+			watchHub,
+			time.Duration(config.Inventory.Watch.FlushInterval)*time.Millisecond,
+			log,
+		)
+		inventoryRepo = repository.NewWatchingRepository(inventoryRepo, changeNotifier)
+		transferRepo = repository.NewWatchingTransferRepository(transferRepo, changeNotifier)
+		stocktakeRepo = repository.NewWatchingStocktakeRepository(stocktakeRepo, changeNotifier)
+	} else {
+		watchHub.Close()
+	}
+	
+	// 启用Redis快速锁定时，锁定在Redis中完成并异步写入MySQL。
+	// 调拨和盘点直接修改MySQL中的库存，完成后同样需要使Redis可用库存失效；删除仓库前先写入只在Redis中的锁定
+	var lockSyncer *worker.LockSyncer
+	if config.Inventory.FastLock.Enabled {
+		fastLockRepo := repository.NewRedisLockRepository(inventoryRepo, outboxRepo, redisClient, log)
+		transferRepo = repository.NewRedisLockTransferRepository(transferRepo, fastLockRepo)
+		stocktakeRepo = repository.NewRedisLockStocktakeRepository(stocktakeRepo, fastLockRepo)
+		warehouseRepo = repository.NewRedisLockWarehouseRepository(warehouseRepo, fastLockRepo)
+		lockSyncer = setupLockSyncer(config, redisClient, fastLockRepo, log)
+		if err := lockSyncer.Warm(context.Background()); err != nil {
+			log.Fatal("Failed to warm available stock", zap.Error(err))
+		}
+		inventoryRepo = fastLockRepo
+	}
+	
+	// 启用审计日志时，每一次库存操作的尝试都异步写入MongoDB，包括调拨和盘点
+	var auditRepo repository.AuditRepository
+	var auditWriter *worker.AuditWriter
+	if config.Inventory.Audit.Enabled {
+		mongoClient := setupMongo(config.MongoDB, log)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			mongoClient.Disconnect(ctx)
+		}()
+		
+		auditRepo, auditWriter = setupAudit(config, mongoClient, log)
+		transferRepo = repository.NewAuditingTransferRepository(transferRepo, inventoryRepo, auditWriter, log)
+		stocktakeRepo = repository.NewAuditingStocktakeRepository(stocktakeRepo, inventoryRepo, auditWriter, log)
+		inventoryRepo = repository.NewAuditingRepository(inventoryRepo, auditWriter, log)
+	}
+	
+	// 启用低库存预警时，减少库存的操作完成后评估是否低于预警阈值
+	var alertEvaluator *alert.Evaluator
+	if config.Inventory.LowStockAlert.Enabled {
+		alertEvaluator = setupAlertEvaluator(config, redisClient, log)
+		inventoryRepo = repository.NewAlertingRepository(inventoryRepo, alertEvaluator, log)
+	}
 	
 	// 初始化服务层
 	inventoryService := service.NewInventoryService(inventoryRepo, log)
-	inventoryLockService := service.NewInventoryLockService(inventoryRepo, log)
+	stockAllocator := service.NewStockAllocator(
+		inventoryRepo,
+		warehouseRepo,
+		config.Inventory.DefaultWarehouseID,
+		config.Inventory.AllocationStrategy,
+		log,
+	)
+	inventoryLockService := service.NewInventoryLockService(inventoryRepo, stockAllocator, config.Inventory.LockTimeout, log)
 	warehouseService := service.NewWarehouseService(warehouseRepo, log)
+	transferService := service.NewTransferService(transferRepo, warehouseRepo, log)
+	inboundService := service.NewInboundService(inboundRepo, inventoryRepo, warehouseRepo, log)
+	lotService := service.NewLotService(inventoryRepo, log)
+	ledgerService := service.NewLedgerService(inventoryRepo, log)
+	watchService := service.NewInventoryWatchService(inventoryRepo, warehouseRepo, watchHub, log)
+	bulkService := service.NewInventoryBulkService(inventoryRepo, warehouseRepo, log)
+	channelService := service.NewChannelAllocationService(inventoryRepo, log)
+	backorderService := service.NewBackorderService(inventoryRepo, log)
+	bundleService := service.NewBundleService(inventoryRepo, warehouseRepo, log)
+	stocktakeService := service.NewStocktakeService(stocktakeRepo, inventoryRepo, warehouseRepo, alertEvaluator, log)
+	auditService := service.NewAuditService(auditRepo, log)
 	
 	// 启动HTTP服务
 	httpServer := setupHTTPServer(config.Server, log)
@@ -78,8 +163,76 @@ func main() {
 		inventoryService, 
 		inventoryLockService, 
 		warehouseService,
+		transferService,
+		inboundService,
+		lotService,
+		stocktakeService,
+		auditService,
+		watchService,
+		bulkService,
+		channelService,
+		backorderService,
+		bundleService,
 	)
 	
+	// 审计记录在gRPC服务停止后再写完，避免丢失退出过程中的操作
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	defer stopAudit()
+	auditDone := make(chan struct{})
+	if auditWriter != nil {
+		go func() {
+			auditWriter.Run(auditCtx)
+			close(auditDone)
+		}()
+	} else {
+		close(auditDone)
+	}
+	
+	// 启动后台任务
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	
+	if config.Inventory.LockReaper.Enabled {
+		lockReaper := setupLockReaper(config, redisClient, inventoryLockService, log)
+		go lockReaper.Run(workerCtx)
+	}
+	
+	if lockSyncer != nil {
+		go lockSyncer.Run(workerCtx)
+	}
+	
+	if changeNotifier != nil {
+		go changeNotifier.Run(workerCtx)
+	}
+	
+	if config.Inventory.LotExpiry.Enabled {
+		lotExpirer := setupLotExpirer(config, redisClient, lotService, log)
+		go lotExpirer.Run(workerCtx)
+	}
+	
+	if config.Inventory.BackorderFulfill.Enabled {
+		backorderFulfiller := setupBackorderFulfiller(config, redisClient, backorderService, log)
+		go backorderFulfiller.Run(workerCtx)
+	}
+	
+	if config.Inventory.LedgerReconcile.Enabled {
+		ledgerReconciler := setupLedgerReconciler(config, redisClient, ledgerService, log)
+		go ledgerReconciler.Run(workerCtx)
+	}
+	
+	if alertEvaluator != nil {
+		go alertEvaluator.Run(workerCtx)
+	}
+	
+	// 领域事件发布到进程内消息代理，其他服务接入时替换为实际的消息队列实现
+	eventBroker := broker.NewInProcessBroker(log)
+	defer eventBroker.Close()
+	
+	if config.Inventory.Outbox.Enabled {
+		outboxRelay := setupOutboxRelay(config, redisClient, outboxRepo, eventBroker, log)
+		go outboxRelay.Run(workerCtx)
+	}
+	
 	// 启动服务
 	go func() {
 		log.Info("Starting gRPC server", zap.Int("port", config.Server.GRPC.Port))
@@ -102,6 +255,9 @@ func main() {
 	
 	log.Info("Shutting down server...")
 	
+	// 停止后台任务
+	stopWorkers()
+	
 	// 关闭HTTP服务
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -110,9 +266,14 @@ func main() {
 		log.Error("HTTP server forced to shutdown", zap.Error(err))
 	}
 	
-	// 关闭gRPC服务
+	// 关闭gRPC服务，先终止库存变更订阅，否则流式请求会一直阻塞优雅退出
+	watchHub.Close()
 	grpcServer.GracefulStop()
 	
+	// 写入剩余的审计记录
+	stopAudit()
+	<-auditDone
+	
 	log.Info("Server exited")
 }
 
@@ -175,6 +336,16 @@ func autoMigrateTables(db *gorm.DB, log *zap.Logger) {
 		&entity.StockSellDetail{},
 		&entity.Warehouse{},
 		&entity.InventoryHistory{},
+		&entity.InventoryLot{},
+		&entity.InventoryChannelAllocation{},
+		&entity.InventoryBackorder{},
+		&entity.InventoryBundle{},
+		&entity.TransferOrder{},
+		&entity.InboundOrder{},
+		&entity.InboundReceipt{},
+		&entity.StocktakeSession{},
+		&entity.StocktakeItem{},
+		&entity.OutboxEvent{},
 	)
 	if err != nil {
 		log.Fatal("Failed to auto-migrate tables", zap.Error(err))
@@ -201,6 +372,233 @@ func setupRedis(config configs.RedisConfig, log *zap.Logger) *redis.Client {
 	return client
 }
 
+// 设置MongoDB连接
+func setupMongo(config configs.MongoDBConfig, log *zap.Logger) *mongo.Client {
+	timeout := time.Duration(config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.URI).SetConnectTimeout(timeout))
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB", zap.Error(err))
+	}
+	
+	// 测试连接
+	if err := client.Ping(ctx, nil); err != nil {
+		log.Fatal("Failed to ping MongoDB", zap.Error(err))
+	}
+	
+	return client
+}
+
+// 设置库存审计日志
+func setupAudit(config *configs.Config, mongoClient *mongo.Client, log *zap.Logger) (repository.AuditRepository, *worker.AuditWriter) {
+	auditConfig := config.Inventory.Audit
+	
+	collection := auditConfig.Collection
+	if collection == "" {
+		collection = "inventory_change_records"
+	}
+	
+	auditRepo := repository.NewMongoAuditRepository(mongoClient, config.MongoDB.Database, collection, log)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	
+	if err := auditRepo.EnsureIndexes(ctx, time.Duration(auditConfig.Retention)*24*time.Hour); err != nil {
+		log.Fatal("Failed to create audit indexes", zap.Error(err))
+	}
+	
+	auditWriter := worker.NewAuditWriter(
+		auditRepo,
+		auditConfig.BufferSize,
+		auditConfig.BatchSize,
+		time.Duration(auditConfig.FlushInterval)*time.Millisecond,
+		log,
+	)
+	
+	return auditRepo, auditWriter
+}
+
+// 设置过期锁定释放任务
+func setupLockReaper(
+	config *configs.Config,
+	redisClient *redis.Client,
+	inventoryLockService service.InventoryLockService,
+	log *zap.Logger,
+) *worker.LockReaper {
+	reaperConfig := config.Inventory.LockReaper
+	
+	elector := newLeaderElector(config, redisClient, "lock-reaper", reaperConfig.LeaderTTL, time.Minute)
+	
+	return worker.NewLockReaper(
+		inventoryLockService,
+		elector,
+		time.Duration(reaperConfig.Interval)*time.Second,
+		reaperConfig.BatchSize,
+		log,
+	)
+}
+
+// newLeaderElector 创建后台任务的主节点选举，name区分不同的任务，
+// leaderTTL为配置的租约秒数，未配置时使用defaultTTL
+func newLeaderElector(
+	config *configs.Config,
+	redisClient *redis.Client,
+	name string,
+	leaderTTL int,
+	defaultTTL time.Duration,
+) worker.LeaderElector {
+	// 使用主机名和进程号区分副本
+	hostname, _ := os.Hostname()
+	instanceID := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	
+	ttl := time.Duration(leaderTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	
+	return worker.NewRedisLeaderElector(
+		redisClient,
+		fmt.Sprintf("%s:%s:leader", config.Server.Name, name),
+		instanceID,
+		ttl,
+	)
+}
+
+// 设置批次过期后台任务
+func setupLotExpirer(
+	config *configs.Config,
+	redisClient *redis.Client,
+	lotService service.LotService,
+	log *zap.Logger,
+) *worker.LotExpirer {
+	expiryConfig := config.Inventory.LotExpiry
+	
+	elector := newLeaderElector(config, redisClient, "lot-expirer", expiryConfig.LeaderTTL, 10*time.Minute)
+	
+	return worker.NewLotExpirer(
+		lotService,
+		elector,
+		time.Duration(expiryConfig.Interval)*time.Second,
+		expiryConfig.BatchSize,
+		log,
+	)
+}
+
+// 设置缺货预订分配后台任务
+func setupBackorderFulfiller(
+	config *configs.Config,
+	redisClient *redis.Client,
+	backorderService service.BackorderService,
+	log *zap.Logger,
+) *worker.BackorderFulfiller {
+	fulfillConfig := config.Inventory.BackorderFulfill
+	
+	elector := newLeaderElector(config, redisClient, "backorder-fulfiller", fulfillConfig.LeaderTTL, 5*time.Minute)
+	
+	return worker.NewBackorderFulfiller(
+		backorderService,
+		elector,
+		time.Duration(fulfillConfig.Interval)*time.Second,
+		fulfillConfig.BatchSize,
+		log,
+	)
+}
+
+// 设置库存流水核对后台任务
+func setupLedgerReconciler(
+	config *configs.Config,
+	redisClient *redis.Client,
+	ledgerService service.LedgerService,
+	log *zap.Logger,
+) *worker.LedgerReconciler {
+	reconcileConfig := config.Inventory.LedgerReconcile
+	
+	elector := newLeaderElector(config, redisClient, "ledger-reconciler", reconcileConfig.LeaderTTL, time.Hour)
+	
+	return worker.NewLedgerReconciler(
+		ledgerService,
+		elector,
+		time.Duration(reconcileConfig.Interval)*time.Second,
+		reconcileConfig.BatchSize,
+		reconcileConfig.Repair,
+		log,
+	)
+}
+
+// 设置Redis快速锁定后台任务
+func setupLockSyncer(
+	config *configs.Config,
+	redisClient *redis.Client,
+	fastLockRepo *repository.RedisLockRepository,
+	log *zap.Logger,
+) *worker.LockSyncer {
+	fastLockConfig := config.Inventory.FastLock
+	
+	elector := newLeaderElector(config, redisClient, "lock-reconcile", fastLockConfig.LeaderTTL, 10*time.Minute)
+	
+	return worker.NewLockSyncer(
+		fastLockRepo,
+		elector,
+		fastLockConfig.SyncWorkers,
+		time.Duration(fastLockConfig.ReconcileInterval)*time.Second,
+		fastLockConfig.WarmBatchSize,
+		log,
+	)
+}
+
+// 设置低库存预警
+func setupAlertEvaluator(config *configs.Config, redisClient *redis.Client, log *zap.Logger) *alert.Evaluator {
+	alertConfig := config.Inventory.LowStockAlert
+	
+	var notifier alert.Notifier
+	switch alertConfig.Notifier {
+	case alert.NotifierWebhook:
+		if alertConfig.WebhookURL == "" {
+			log.Fatal("Webhook url is required for low stock alert")
+		}
+		notifier = alert.NewWebhookNotifier(alertConfig.WebhookURL, time.Duration(alertConfig.WebhookTimeout)*time.Second)
+	default:
+		notifier = alert.NewLogNotifier(log)
+	}
+	
+	return alert.NewEvaluator(
+		alert.NewRedisDeduplicator(redisClient, fmt.Sprintf("%s:low-stock-alert:", config.Server.Name)),
+		notifier,
+		time.Duration(alertConfig.Cooldown)*time.Second,
+		log,
+	)
+}
+
+// 设置领域事件发布任务
+func setupOutboxRelay(
+	config *configs.Config,
+	redisClient *redis.Client,
+	outboxRepo repository.OutboxRepository,
+	eventBroker broker.Broker,
+	log *zap.Logger,
+) *worker.OutboxRelay {
+	outboxConfig := config.Inventory.Outbox
+	
+	elector := newLeaderElector(config, redisClient, "outbox-relay", outboxConfig.LeaderTTL, 30*time.Second)
+	
+	return worker.NewOutboxRelay(
+		outboxRepo,
+		eventBroker,
+		elector,
+		time.Duration(outboxConfig.Interval)*time.Millisecond,
+		outboxConfig.BatchSize,
+		outboxConfig.MaxAttempts,
+		time.Duration(outboxConfig.Retention)*time.Hour,
+		log,
+	)
+}
+
 // 设置HTTP服务器
 func setupHTTPServer(config configs.ServerConfig, log *zap.Logger) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
@@ -233,9 +631,22 @@ func setupGRPCServer(
 	inventoryService service.InventoryService,
 	inventoryLockService service.InventoryLockService,
 	warehouseService service.WarehouseService,
+	transferService service.TransferService,
+	inboundService service.InboundService,
+	lotService service.LotService,
+	stocktakeService service.StocktakeService,
+	auditService service.AuditService,
+	watchService service.InventoryWatchService,
+	bulkService service.InventoryBulkService,
+	channelService service.ChannelAllocationService,
+	backorderService service.BackorderService,
+	bundleService service.BundleService,
 ) (net.Listener, *grpc.Server) {
-	// 创建gRPC服务器
-	server := grpc.NewServer()
+	// 创建gRPC服务器，拦截器读取网关透传的操作人供审计日志使用
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcServer.OperatorInterceptor()),
+		grpc.StreamInterceptor(grpcServer.OperatorStreamInterceptor()),
+	)
 	
 	// 注册服务
 	proto.RegisterInventoryServiceServer(
@@ -244,6 +655,16 @@ func setupGRPCServer(
 			inventoryService,
 			inventoryLockService,
 			warehouseService,
+			transferService,
+			inboundService,
+			lotService,
+			stocktakeService,
+			auditService,
+			watchService,
+			bulkService,
+			channelService,
+			backorderService,
+			bundleService,
 			log,
 		),
 	)
@@ -0,0 +1,89 @@
+// reconcile 核对库存记录与库存变更历史、未完结锁定记录是否一致，可选择修复差异。
+//
+// 使用方式：
+//
+//	go run ./cmd/reconcile -config configs/config.yaml
+//	go run ./cmd/reconcile -config configs/config.yaml -repair -operator admin
+//
+// 库存数量以变更历史的累计为准核对，修复时库存数量不变，补记一条调整历史；
+// 锁定数量以未完结的订单锁定和调拨预留为准，修复时直接改为实际锁定数量。
+// 只报告不修复时，发现差异以退出码2结束，便于定时任务告警。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"shop/backend/inventory/configs"
+	"shop/backend/inventory/internal/repository"
+	"shop/backend/inventory/internal/repository/cache"
+	"shop/backend/inventory/internal/service"
+)
+
+func main() {
+	configFile := flag.String("config", "configs/config.yaml", "配置文件路径")
+	repair := flag.Bool("repair", false, "是否修复差异")
+	operator := flag.String("operator", "ledger-reconcile", "修复时记录在库存历史中的操作人")
+	batchSize := flag.Int("batch", 500, "每批核对的库存记录数量")
+	flag.Parse()
+
+	config, err := configs.LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
+		config.Database.User, config.Database.Password, config.Database.Host,
+		config.Database.Port, config.Database.DBName, config.Database.Charset)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", config.Redis.Host, config.Redis.Port),
+		Password: config.Redis.Password,
+		DB:       config.Redis.DB,
+	})
+	defer redisClient.Close()
+
+	log := zap.NewNop()
+	inventoryCache := cache.NewRedisInventoryCache(redisClient, log, config.Inventory.CacheTTL)
+	inventoryRepo := repository.NewInventoryRepository(db, inventoryCache, log)
+	// 启用快速锁定时，修复锁定数量后需要使Redis中的可用库存失效
+	if config.Inventory.FastLock.Enabled {
+		inventoryRepo = repository.NewRedisLockRepository(inventoryRepo, repository.NewOutboxRepository(db, log), redisClient, log)
+	}
+
+	ledgerService := service.NewLedgerService(inventoryRepo, log)
+	report, err := ledgerService.Reconcile(context.Background(), *repair, *operator, *batchSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reconcile: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, d := range report.Drifts {
+		fmt.Printf("goods=%d sku=%d warehouse=%d stocks=%d ledger=%d (%+d) lock_stocks=%d open_locks=%d (%+d) repaired=%t\n",
+			d.ProductID, d.SkuID, d.WarehouseID,
+			d.Stock, d.LedgerStock, d.StockDrift(),
+			d.LockStock, d.OpenLockStock, d.LockDrift(),
+			d.Repaired)
+	}
+	fmt.Printf("checked=%d drifted=%d repair=%t\n", report.Checked, len(report.Drifts), *repair)
+
+	if len(report.Drifts) > 0 && !*repair {
+		os.Exit(2)
+	}
+}
@@ -14,6 +14,7 @@ type Config struct {
 	Server    ServerConfig    `yaml:"server"`
 	Database  DatabaseConfig  `yaml:"database"`
 	Redis     RedisConfig     `yaml:"redis"`
+	MongoDB   MongoDBConfig   `yaml:"mongodb"`
 	Logger    LoggerConfig    `yaml:"logger"`
 	Registry  RegistryConfig  `yaml:"registry"`
 	Inventory InventoryConfig `yaml:"inventory"`
@@ -53,6 +54,13 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// MongoDBConfig MongoDB配置
+type MongoDBConfig struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
+	Timeout  int    `yaml:"timeout"` // 连接超时时间（秒）
+}
+
 // LoggerConfig 日志配置
 type LoggerConfig struct {
 	Level      string `yaml:"level"`
@@ -90,8 +98,96 @@ type NacosConfig struct {
 type InventoryConfig struct {
 	LockTimeout        int  `yaml:"lock_timeout"`        // 库存锁定超时时间（秒）
 	DefaultWarehouseID int  `yaml:"default_warehouse_id"` // 默认仓库ID
+	AllocationStrategy string `yaml:"allocation_strategy"` // 默认仓库分配策略：default, nearest, most_stock, split
 	EnableCache        bool `yaml:"enable_cache"`        // 是否启用缓存
 	CacheTTL           int  `yaml:"cache_ttl"`          // 缓存过期时间（秒）
+	LockReaper         LockReaperConfig `yaml:"lock_reaper"` // 过期锁定释放任务配置
+	FastLock           FastLockConfig   `yaml:"fast_lock"`   // Redis快速锁定配置
+	LowStockAlert      LowStockAlertConfig `yaml:"low_stock_alert"` // 低库存预警配置
+	Outbox             OutboxConfig     `yaml:"outbox"`      // 领域事件发件箱配置
+	Audit              AuditConfig      `yaml:"audit"`       // 库存审计日志配置
+	LotExpiry          LotExpiryConfig  `yaml:"lot_expiry"`  // 批次过期任务配置
+	BackorderFulfill   BackorderFulfillConfig `yaml:"backorder_fulfill"` // 缺货预订分配任务配置
+	LedgerReconcile    LedgerReconcileConfig `yaml:"ledger_reconcile"` // 库存流水核对任务配置
+	Watch              WatchConfig      `yaml:"watch"`       // 库存变更订阅配置
+}
+
+// LockReaperConfig 过期库存锁定释放任务配置
+type LockReaperConfig struct {
+	Enabled   bool `yaml:"enabled"`    // 是否启用
+	Interval  int  `yaml:"interval"`   // 扫描间隔（秒）
+	BatchSize int  `yaml:"batch_size"` // 每批处理的订单数量
+	LeaderTTL int  `yaml:"leader_ttl"` // 主节点租约时长（秒）
+}
+
+// LotExpiryConfig 批次过期任务配置，定期将到期批次的未锁定数量从可用库存中扣除
+type LotExpiryConfig struct {
+	Enabled   bool `yaml:"enabled"`    // 是否启用
+	Interval  int  `yaml:"interval"`   // 扫描间隔（秒）
+	BatchSize int  `yaml:"batch_size"` // 每批处理的批次数量
+	LeaderTTL int  `yaml:"leader_ttl"` // 主节点租约时长（秒）
+}
+
+// BackorderFulfillConfig 缺货预订分配任务配置，定期将为排队预订保留的可用库存按排队顺序转为锁定
+type BackorderFulfillConfig struct {
+	Enabled   bool `yaml:"enabled"`    // 是否启用
+	Interval  int  `yaml:"interval"`   // 分配间隔（秒）
+	BatchSize int  `yaml:"batch_size"` // 每批处理的库存记录数量
+	LeaderTTL int  `yaml:"leader_ttl"` // 主节点租约时长（秒）
+}
+
+// LedgerReconcileConfig 库存流水核对任务配置，核对库存数量与变更历史、锁定数量与未完结锁定是否一致
+type LedgerReconcileConfig struct {
+	Enabled   bool `yaml:"enabled"`    // 是否启用
+	Interval  int  `yaml:"interval"`   // 核对间隔（秒）
+	BatchSize int  `yaml:"batch_size"` // 每批核对的库存记录数量
+	Repair    bool `yaml:"repair"`     // 是否自动修复差异，为false时只报告
+	LeaderTTL int  `yaml:"leader_ttl"` // 主节点租约时长（秒），应大于一轮核对的耗时
+}
+
+// WatchConfig 库存变更订阅配置，库存或锁定数量变化后通过WatchInventory推送给订阅者
+type WatchConfig struct {
+	Enabled       bool `yaml:"enabled"`        // 是否启用
+	BufferSize    int  `yaml:"buffer_size"`    // 每个订阅缓冲的变更数量，写满时终止订阅
+	FlushInterval int  `yaml:"flush_interval"` // 合并推送的间隔（毫秒）
+}
+
+// FastLockConfig Redis快速锁定配置。启用后锁定在Redis中通过Lua脚本完成，再异步写入MySQL
+type FastLockConfig struct {
+	Enabled           bool `yaml:"enabled"`            // 是否启用
+	SyncWorkers       int  `yaml:"sync_workers"`       // 写入MySQL的并发数
+	WarmBatchSize     int  `yaml:"warm_batch_size"`    // 预热与对账的批大小
+	ReconcileInterval int  `yaml:"reconcile_interval"` // 对账间隔（秒）
+	LeaderTTL         int  `yaml:"leader_ttl"`         // 对账主节点租约时长（秒）
+}
+
+// LowStockAlertConfig 低库存预警配置
+type LowStockAlertConfig struct {
+	Enabled        bool   `yaml:"enabled"`         // 是否启用
+	Notifier       string `yaml:"notifier"`        // 通知方式：log, webhook
+	WebhookURL     string `yaml:"webhook_url"`     // Webhook地址
+	WebhookTimeout int    `yaml:"webhook_timeout"` // Webhook超时时间（秒）
+	Cooldown       int    `yaml:"cooldown"`        // 持续低库存时的重复提醒间隔（秒）
+}
+
+// OutboxConfig 领域事件发件箱配置。事件总是随库存变更写入发件箱，该配置控制发布任务
+type OutboxConfig struct {
+	Enabled     bool `yaml:"enabled"`      // 是否启用发布任务
+	Interval    int  `yaml:"interval"`     // 轮询间隔（毫秒）
+	BatchSize   int  `yaml:"batch_size"`   // 每批发布的事件数量
+	MaxAttempts int  `yaml:"max_attempts"` // 最大发布次数，超过后标记为失败
+	Retention   int  `yaml:"retention"`    // 已发布事件保留时长（小时）
+	LeaderTTL   int  `yaml:"leader_ttl"`   // 主节点租约时长（秒）
+}
+
+// AuditConfig 库存审计日志配置，审计记录写入MongoDB
+type AuditConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // 是否启用
+	Collection    string `yaml:"collection"`     // 审计记录集合名称
+	BufferSize    int    `yaml:"buffer_size"`    // 待写入记录的缓冲区大小，满时丢弃新记录
+	BatchSize     int    `yaml:"batch_size"`     // 每批写入的记录数量
+	FlushInterval int    `yaml:"flush_interval"` // 写入间隔（毫秒）
+	Retention     int    `yaml:"retention"`      // 审计记录保留天数，为0时永久保留
 }
 
 // LoadConfig 加载配置
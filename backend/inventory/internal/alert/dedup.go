@@ -0,0 +1,74 @@
+package alert
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Deduplicator 预警去重。同一商品仓库在恢复到阈值以上之前只预警一次，
+// ttl到期后若仍处于低库存，下次库存变动时会再次提醒
+type Deduplicator interface {
+	// Acquire 标记已预警，返回false表示已预警过
+	Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Clear 清除预警标记，库存恢复后调用
+	Clear(ctx context.Context, key string) error
+}
+
+// RedisDeduplicator 基于Redis的预警去重，多副本共享
+type RedisDeduplicator struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisDeduplicator 创建Redis预警去重
+func NewRedisDeduplicator(client *redis.Client, prefix string) *RedisDeduplicator {
+	return &RedisDeduplicator{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Acquire 标记已预警
+func (d *RedisDeduplicator) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return d.client.SetNX(ctx, d.prefix+key, time.Now().Unix(), ttl).Result()
+}
+
+// Clear 清除预警标记
+func (d *RedisDeduplicator) Clear(ctx context.Context, key string) error {
+	return d.client.Del(ctx, d.prefix+key).Err()
+}
+
+// MemoryDeduplicator 基于内存的预警去重，用于测试和单实例部署
+type MemoryDeduplicator struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// NewMemoryDeduplicator 创建内存预警去重
+func NewMemoryDeduplicator() *MemoryDeduplicator {
+	return &MemoryDeduplicator{expires: make(map[string]time.Time)}
+}
+
+// Acquire 标记已预警
+func (d *MemoryDeduplicator) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if expire, ok := d.expires[key]; ok && now.Before(expire) {
+		return false, nil
+	}
+	d.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+// Clear 清除预警标记
+func (d *MemoryDeduplicator) Clear(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.expires, key)
+	return nil
+}
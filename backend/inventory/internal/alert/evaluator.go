@@ -0,0 +1,141 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+const (
+	// 默认重复提醒间隔
+	defaultCooldown = 24 * time.Hour
+	// 待发送预警队列长度
+	alertQueueSize = 1024
+	// 单次通知超时时间
+	notifyTimeout = 10 * time.Second
+)
+
+// Evaluator 低库存预警评估器。库存变动后检查是否低于预警阈值，
+// 去重后交给后台协程发送，避免通知耗时影响库存操作
+type Evaluator struct {
+	dedup    Deduplicator
+	notifier Notifier
+	cooldown time.Duration
+	queue    chan *LowStockAlert
+	logger   *zap.Logger
+}
+
+// NewEvaluator 创建低库存预警评估器
+func NewEvaluator(dedup Deduplicator, notifier Notifier, cooldown time.Duration, logger *zap.Logger) *Evaluator {
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+
+	return &Evaluator{
+		dedup:    dedup,
+		notifier: notifier,
+		cooldown: cooldown,
+		queue:    make(chan *LowStockAlert, alertQueueSize),
+		logger:   logger,
+	}
+}
+
+// Evaluate 评估库存是否需要预警。评估器为nil时不做任何处理，便于按配置关闭预警
+func (e *Evaluator) Evaluate(ctx context.Context, inv *entity.Inventory, operation string) {
+	if e == nil || inv == nil {
+		return
+	}
+
+	key := dedupKey(inv.ProductID, inv.SkuID, inv.WarehouseID)
+	if !inv.NeedsAlert() {
+		// 库存已恢复，下次跌破阈值时重新预警
+		if err := e.dedup.Clear(ctx, key); err != nil {
+			e.logger.Warn("Failed to clear low stock alert state",
+				zap.String("key", key),
+				zap.Error(err))
+		}
+		return
+	}
+
+	acquired, err := e.dedup.Acquire(ctx, key, e.cooldown)
+	if err != nil {
+		e.logger.Warn("Failed to check low stock alert state",
+			zap.String("key", key),
+			zap.Error(err))
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	alert := &LowStockAlert{
+		ProductID:      inv.ProductID,
+		SkuID:          inv.SkuID,
+		WarehouseID:    inv.WarehouseID,
+		Stock:          inv.Stock,
+		LockStock:      inv.LockStock,
+		AlertThreshold: inv.AlertThreshold,
+		Operation:      operation,
+		OccurredAt:     time.Now(),
+	}
+
+	select {
+	case e.queue <- alert:
+	default:
+		// 队列已满时放弃本次预警，并清除标记以便下次库存变动时重试
+		e.logger.Warn("Low stock alert queue is full, dropping alert",
+			zap.Int64("product_id", inv.ProductID),
+			zap.Int64("sku_id", inv.SkuID),
+			zap.Int("warehouse_id", inv.WarehouseID))
+		e.clear(key)
+	}
+}
+
+// Run 发送预警，直到ctx被取消
+func (e *Evaluator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-e.queue:
+			e.deliver(alert)
+		}
+	}
+}
+
+// deliver 发送单条预警，失败时清除标记以便下次库存变动时重试
+func (e *Evaluator) deliver(alert *LowStockAlert) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if err := e.notifier.Notify(ctx, alert); err != nil {
+		e.logger.Error("Failed to send low stock alert",
+			zap.Int64("product_id", alert.ProductID),
+			zap.Int("warehouse_id", alert.WarehouseID),
+			zap.Error(err))
+		e.clear(dedupKey(alert.ProductID, alert.SkuID, alert.WarehouseID))
+	}
+}
+
+// clear 清除预警标记
+func (e *Evaluator) clear(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := e.dedup.Clear(ctx, key); err != nil {
+		e.logger.Warn("Failed to clear low stock alert state",
+			zap.String("key", key),
+			zap.Error(err))
+	}
+}
+
+// dedupKey 构建去重键，商品级库存沿用不含SKU的键
+func dedupKey(productID int64, skuID int64, warehouseID int) string {
+	if skuID == 0 {
+		return fmt.Sprintf("%d:%d", productID, warehouseID)
+	}
+	return fmt.Sprintf("%d:%d:%d", productID, warehouseID, skuID)
+}
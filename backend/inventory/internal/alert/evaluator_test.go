@@ -0,0 +1,80 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// fakeNotifier 记录收到的预警，err不为空时发送失败
+type fakeNotifier struct {
+	alerts []*LowStockAlert
+	err    error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, alert *LowStockAlert) error {
+	n.alerts = append(n.alerts, alert)
+	return n.err
+}
+
+// drain 同步发送队列中的预警
+func drain(e *Evaluator) {
+	for {
+		select {
+		case alert := <-e.queue:
+			e.deliver(alert)
+		default:
+			return
+		}
+	}
+}
+
+func TestEvaluatorAlertsOnceUntilRecovered(t *testing.T) {
+	notifier := &fakeNotifier{}
+	evaluator := NewEvaluator(NewMemoryDeduplicator(), notifier, 0, zap.NewNop())
+	ctx := context.Background()
+	low := &entity.Inventory{ProductID: 100, WarehouseID: 1, Stock: 3, AlertThreshold: 5}
+	recovered := &entity.Inventory{ProductID: 100, WarehouseID: 1, Stock: 8, AlertThreshold: 5}
+
+	evaluator.Evaluate(ctx, low, "sell")
+	evaluator.Evaluate(ctx, low, "sell")
+	drain(evaluator)
+	if len(notifier.alerts) != 1 || notifier.alerts[0].Operation != "sell" {
+		t.Fatalf("alerts = %+v, want one sell alert", notifier.alerts)
+	}
+
+	// 库存恢复后再次跌破阈值重新预警
+	evaluator.Evaluate(ctx, recovered, "increase")
+	evaluator.Evaluate(ctx, low, "sell")
+	drain(evaluator)
+	if len(notifier.alerts) != 2 {
+		t.Errorf("got %d alerts, want 2 after recovery", len(notifier.alerts))
+	}
+}
+
+func TestEvaluatorRetriesFailedNotification(t *testing.T) {
+	notifier := &fakeNotifier{err: errors.New("webhook unavailable")}
+	evaluator := NewEvaluator(NewMemoryDeduplicator(), notifier, 0, zap.NewNop())
+	ctx := context.Background()
+	low := &entity.Inventory{ProductID: 100, WarehouseID: 1, Stock: 3, AlertThreshold: 5}
+
+	evaluator.Evaluate(ctx, low, "sell")
+	drain(evaluator)
+
+	// 发送失败后清除标记，下次库存变动时重试
+	notifier.err = nil
+	evaluator.Evaluate(ctx, low, "sell")
+	drain(evaluator)
+	if len(notifier.alerts) != 2 {
+		t.Errorf("got %d notify attempts, want 2", len(notifier.alerts))
+	}
+}
+
+func TestNilEvaluatorIsNoop(t *testing.T) {
+	var evaluator *Evaluator
+	evaluator.Evaluate(context.Background(), &entity.Inventory{Stock: 0, AlertThreshold: 5}, "sell")
+}
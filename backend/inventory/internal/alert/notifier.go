@@ -0,0 +1,134 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 通知方式
+const (
+	NotifierLog     = "log"
+	NotifierWebhook = "webhook"
+)
+
+// LowStockAlert 低库存预警
+type LowStockAlert struct {
+	ProductID      int64     `json:"goods_id"`
+	SkuID          int64     `json:"sku_id,omitempty"`
+	WarehouseID    int       `json:"warehouse_id"`
+	Stock          int       `json:"stock"`
+	LockStock      int       `json:"lock_stock"`
+	AlertThreshold int       `json:"alert_threshold"`
+	Operation      string    `json:"operation"` // 触发预警的库存操作
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// Notifier 预警通知接口
+type Notifier interface {
+	Notify(ctx context.Context, alert *LowStockAlert) error
+}
+
+// LogNotifier 将预警写入日志
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier 创建日志通知
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify 输出预警日志
+func (n *LogNotifier) Notify(ctx context.Context, alert *LowStockAlert) error {
+	n.logger.Warn("Low stock alert",
+		zap.Int64("product_id", alert.ProductID),
+		zap.Int64("sku_id", alert.SkuID),
+		zap.Int("warehouse_id", alert.WarehouseID),
+		zap.Int("stock", alert.Stock),
+		zap.Int("lock_stock", alert.LockStock),
+		zap.Int("alert_threshold", alert.AlertThreshold),
+		zap.String("operation", alert.Operation))
+	return nil
+}
+
+// WebhookNotifier 以JSON格式将预警POST到指定地址
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier 创建Webhook通知
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify 发送预警请求，非2xx响应视为失败
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *LowStockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MemoryNotifier 将预警保存在内存中，用于测试
+type MemoryNotifier struct {
+	mu     sync.Mutex
+	alerts []*LowStockAlert
+}
+
+// NewMemoryNotifier 创建内存通知
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+// Notify 保存预警
+func (n *MemoryNotifier) Notify(ctx context.Context, alert *LowStockAlert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+// Alerts 返回已收到的预警
+func (n *MemoryNotifier) Alerts() []*LowStockAlert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*LowStockAlert(nil), n.alerts...)
+}
+
+// Reset 清空已收到的预警
+func (n *MemoryNotifier) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = nil
+}
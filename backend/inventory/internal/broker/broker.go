@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message 发布到消息代理的领域事件
+type Message struct {
+	ID          int64     // 事件ID，与发件箱记录ID一致，订阅方可据此去重
+	Type        string    // 事件类型
+	AggregateID string    // 聚合ID，相同聚合的事件按顺序发布
+	Payload     []byte    // 事件内容，JSON格式
+	OccurredAt  time.Time // 事件发生时间
+}
+
+// Handler 事件处理函数
+type Handler func(ctx context.Context, msg *Message) error
+
+// Broker 消息代理接口，可替换为Kafka、RocketMQ等实现
+type Broker interface {
+	Publish(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+// ErrBrokerClosed 消息代理已关闭
+var ErrBrokerClosed = errors.New("broker closed")
+
+// InProcessBroker 进程内消息代理，用于本地运行和测试。
+// 发布时同步调用订阅者，任一订阅者失败则发布失败，由发件箱稍后重试
+type InProcessBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	closed   bool
+	logger   *zap.Logger
+}
+
+// NewInProcessBroker 创建进程内消息代理
+func NewInProcessBroker(logger *zap.Logger) *InProcessBroker {
+	return &InProcessBroker{
+		handlers: make(map[string][]Handler),
+		logger:   logger,
+	}
+}
+
+// Subscribe 订阅指定类型的事件，eventType为空时订阅所有事件
+func (b *InProcessBroker) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish 将事件分发给订阅者
+func (b *InProcessBroker) Publish(ctx context.Context, msg *Message) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrBrokerClosed
+	}
+	handlers := append(append([]Handler(nil), b.handlers[msg.Type]...), b.handlers[""]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	b.logger.Debug("Event published",
+		zap.Int64("event_id", msg.ID),
+		zap.String("event_type", msg.Type),
+		zap.String("aggregate_id", msg.AggregateID),
+		zap.Int("subscribers", len(handlers)))
+	return nil
+}
+
+// Close 关闭消息代理
+func (b *InProcessBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,171 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InboundStatus 入库单状态
+type InboundStatus int
+
+const (
+	InboundCreated  InboundStatus = 1 // 已创建，等待到货
+	InboundPartial  InboundStatus = 2 // 部分收货
+	InboundReceived InboundStatus = 3 // 已收齐
+	InboundClosed   InboundStatus = 4 // 已关闭，未收齐的数量不再收货
+)
+
+// InboundOrder 采购入库单，记录供应商预计送达某个仓库的商品和数量
+type InboundOrder struct {
+	ID            int64         `gorm:"primaryKey"`
+	InboundSN     string        `gorm:"column:inbound_sn;type:varchar(50);uniqueIndex;not null;comment:'入库单号'"`
+	WarehouseID   int           `gorm:"not null;index;comment:'收货仓库ID'"`
+	SupplierName  string        `gorm:"type:varchar(100);comment:'供应商名称'"`
+	SupplierDocNo string        `gorm:"type:varchar(50);index;comment:'供应商单据号，如采购订单号、送货单号'"`
+	Status        InboundStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:已创建，2:部分收货，3:已收齐，4:已关闭'"`
+	Detail        string        `gorm:"type:json;comment:'入库明细，结构为[{goods_id:1, sku_id:0, expected:10, received:0}]'"`
+	Operator      string        `gorm:"type:varchar(50);comment:'创建人'"`
+	Remark        string        `gorm:"type:varchar(255);comment:'备注'"`
+	CloseTime     *time.Time    `gorm:"type:datetime(3);comment:'关闭时间'"`
+	CreatedAt     time.Time     `gorm:"type:datetime(3)"`
+	UpdatedAt     time.Time     `gorm:"type:datetime(3)"`
+
+	// 非数据库字段，用于Detail的JSON转换
+	Items []*InboundItem `gorm:"-"`
+}
+
+// InboundItem 入库明细项
+type InboundItem struct {
+	ProductID int64 `json:"goods_id"`
+	SkuID     int64 `json:"sku_id,omitempty"`
+	Expected  int   `json:"expected"`
+	Received  int   `json:"received"`
+}
+
+// Shortage 未收数量，超收时为0
+func (i *InboundItem) Shortage() int {
+	if i.Received >= i.Expected {
+		return 0
+	}
+	return i.Expected - i.Received
+}
+
+// OverReceived 超收数量
+func (i *InboundItem) OverReceived() int {
+	if i.Received <= i.Expected {
+		return 0
+	}
+	return i.Received - i.Expected
+}
+
+// TableName 指定表名
+func (InboundOrder) TableName() string {
+	return "inbound_order"
+}
+
+// CanReceive 判断入库单是否可以收货
+func (o *InboundOrder) CanReceive() bool {
+	return o.Status == InboundCreated || o.Status == InboundPartial
+}
+
+// CanClose 判断入库单是否可以关闭，已收齐的入库单无需关闭
+func (o *InboundOrder) CanClose() bool {
+	return o.Status == InboundCreated || o.Status == InboundPartial
+}
+
+// FindItem 查找商品对应的入库明细
+func (o *InboundOrder) FindItem(productID int64, skuID int64) *InboundItem {
+	for _, item := range o.Items {
+		if item.ProductID == productID && item.SkuID == skuID {
+			return item
+		}
+	}
+	return nil
+}
+
+// IsFullyReceived 判断所有明细是否都已收齐
+func (o *InboundOrder) IsFullyReceived() bool {
+	for _, item := range o.Items {
+		if item.Shortage() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BeforeSave 保存前的钩子函数，将Items转换为JSON字符串
+func (o *InboundOrder) BeforeSave(tx *gorm.DB) error {
+	if len(o.Items) > 0 {
+		data, err := json.Marshal(o.Items)
+		if err != nil {
+			return err
+		}
+		o.Detail = string(data)
+	}
+	return nil
+}
+
+// AfterFind 查询后的钩子函数，将JSON字符串解析为Items
+func (o *InboundOrder) AfterFind(tx *gorm.DB) error {
+	if o.Detail != "" {
+		return json.Unmarshal([]byte(o.Detail), &o.Items)
+	}
+	return nil
+}
+
+// InboundReceipt 收货单，一张入库单可以分多次收货。
+// 收货数量逐行通过增加库存入账，库存历史的单号为收货单号；
+// 入账中断时使用同一收货单号重试，只会补入尚未入账的明细
+type InboundReceipt struct {
+	ID          int64      `gorm:"primaryKey"`
+	ReceiptSN   string     `gorm:"column:receipt_sn;type:varchar(50);uniqueIndex;not null;comment:'收货单号'"`
+	InboundSN   string     `gorm:"column:inbound_sn;type:varchar(50);index;not null;comment:'入库单号'"`
+	WarehouseID int        `gorm:"not null;comment:'收货仓库ID'"`
+	Detail      string     `gorm:"type:json;comment:'收货明细，结构为[{goods_id:1, sku_id:0, num:2, lot_no:L001, posted:false}]'"`
+	Posted      bool       `gorm:"not null;default:false;comment:'是否已全部入账'"`
+	Operator    string     `gorm:"type:varchar(50);comment:'收货人'"`
+	Remark      string     `gorm:"type:varchar(255);comment:'备注'"`
+	PostTime    *time.Time `gorm:"type:datetime(3);comment:'入账完成时间'"`
+	CreatedAt   time.Time  `gorm:"type:datetime(3)"`
+	UpdatedAt   time.Time  `gorm:"type:datetime(3)"`
+
+	// 非数据库字段，用于Detail的JSON转换
+	Items []*ReceiptItem `gorm:"-"`
+}
+
+// ReceiptItem 收货明细项，LotNo不为空时入库到对应批次
+type ReceiptItem struct {
+	ProductID  int64      `json:"goods_id"`
+	SkuID      int64      `json:"sku_id,omitempty"`
+	Quantity   int        `json:"num"`
+	LotNo      string     `json:"lot_no,omitempty"`
+	ExpiryDate *time.Time `json:"expiry_date,omitempty"`
+	Posted     bool       `json:"posted"`
+}
+
+// TableName 指定表名
+func (InboundReceipt) TableName() string {
+	return "inbound_receipt"
+}
+
+// BeforeSave 保存前的钩子函数，将Items转换为JSON字符串
+func (r *InboundReceipt) BeforeSave(tx *gorm.DB) error {
+	if len(r.Items) > 0 {
+		data, err := json.Marshal(r.Items)
+		if err != nil {
+			return err
+		}
+		r.Detail = string(data)
+	}
+	return nil
+}
+
+// AfterFind 查询后的钩子函数，将JSON字符串解析为Items
+func (r *InboundReceipt) AfterFind(tx *gorm.DB) error {
+	if r.Detail != "" {
+		return json.Unmarshal([]byte(r.Detail), &r.Items)
+	}
+	return nil
+}
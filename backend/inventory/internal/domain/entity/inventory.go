@@ -7,15 +7,24 @@ import (
 // Inventory 库存实体
 type Inventory struct {
 	ID              int64     `gorm:"primaryKey"`
-	ProductID       int64     `gorm:"column:goods;index:idx_goods_warehouse,unique;not null;comment:'商品ID'"`
+	ProductID       int64     `gorm:"column:goods;index:idx_goods_sku_warehouse,unique;not null;comment:'商品ID'"`
+	SkuID           int64     `gorm:"column:sku_id;index:idx_goods_sku_warehouse,unique;not null;default:0;comment:'SKU ID，为0表示商品级库存'"`
 	Stock           int       `gorm:"column:stocks;not null;default:0;comment:'库存数量'"`
 	Version         int       `gorm:"not null;default:0;comment:'乐观锁版本号'"`
-	WarehouseID     int       `gorm:"not null;default:1;index:idx_goods_warehouse,unique;comment:'仓库ID'"`
+	WarehouseID     int       `gorm:"not null;default:1;index:idx_goods_sku_warehouse,unique;comment:'仓库ID'"`
 	LockStock       int       `gorm:"column:lock_stocks;not null;default:0;comment:'锁定库存数量'"`
+	ExpiredStock    int       `gorm:"column:expired_stocks;not null;default:0;comment:'已过期批次中未锁定的数量，不可售'"`
+	SafetyStock     int       `gorm:"column:safety_stocks;not null;default:0;comment:'安全库存，所有渠道都不可售'"`
+	ReservedStock   int       `gorm:"column:reserved_stocks;not null;default:0;comment:'渠道分配中尚未锁定的数量之和，只有对应渠道可售'"`
+	BackorderLimit  int       `gorm:"not null;default:0;comment:'预售上限，可用库存不足时最多排队预订的数量，为0表示不允许预订'"`
+	BackorderStock  int       `gorm:"column:backorder_stocks;not null;default:0;comment:'排队中尚未到货的预订数量'"`
 	AlertThreshold  int       `gorm:"default:10;comment:'预警阈值'"`
 	CreatedAt       time.Time `gorm:"type:datetime(3)"`
 	UpdatedAt       time.Time `gorm:"type:datetime(3)"`
 	DeletedAt       *time.Time `gorm:"type:datetime(3)"`
+	
+	// 非数据库字段，为true时表示套装按组件计算的库存，Stock为可售套数
+	Bundle          bool      `gorm:"-"`
 }
 
 // TableName 指定表名
@@ -23,15 +32,47 @@ func (Inventory) TableName() string {
 	return "inventory"
 }
 
-// AvailableStock 获取可用库存数量
+// IsSkuLevel 判断是否为SKU级库存，为false时表示不区分规格的商品级库存
+func (i *Inventory) IsSkuLevel() bool {
+	return i.SkuID > 0
+}
+
+// AvailableStock 获取共享可用库存数量，即未分配给任何渠道的可售数量。
+// 已过期批次的库存、安全库存、渠道分配中未锁定的数量和为排队中的预订保留的数量都不计入
 func (i *Inventory) AvailableStock() int {
-	available := i.Stock - i.LockStock
+	available := i.Stock - i.LockStock - i.ExpiredStock - i.SafetyStock - i.ReservedStock - i.BackorderStock
 	if available < 0 {
 		return 0
 	}
 	return available
 }
 
+// SellableStock 扣除锁定、过期、安全库存和排队预订后的可售数量，包含渠道分配中未锁定的数量
+func (i *Inventory) SellableStock() int {
+	sellable := i.Stock - i.LockStock - i.ExpiredStock - i.SafetyStock - i.BackorderStock
+	if sellable < 0 {
+		return 0
+	}
+	return sellable
+}
+
+// ChannelAvailableStock 获取渠道可用库存数量：共享可用库存加上渠道分配中未锁定的数量。
+// allocation为nil表示渠道没有分配，只能使用共享可用库存；库存减少后分配可能超出实际可售数量，结果不超过可售数量
+func (i *Inventory) ChannelAvailableStock(allocation *InventoryChannelAllocation) int {
+	if allocation == nil {
+		return i.AvailableStock()
+	}
+	return min(i.AvailableStock()+allocation.Remaining(), i.SellableStock())
+}
+
+// BackorderAvailable 获取还可以排队预订的数量，未开启预售时为0
+func (i *Inventory) BackorderAvailable() int {
+	if i.BackorderStock >= i.BackorderLimit {
+		return 0
+	}
+	return i.BackorderLimit - i.BackorderStock
+}
+
 // IsAvailable 判断库存是否充足
 func (i *Inventory) IsAvailable(quantity int) bool {
 	return i.AvailableStock() >= quantity
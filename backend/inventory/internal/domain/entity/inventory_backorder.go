@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+// BackorderStatus 缺货预订状态
+type BackorderStatus int
+
+const (
+	BackorderQueued    BackorderStatus = 1 // 排队中，等待到货
+	BackorderFulfilled BackorderStatus = 2 // 已全部到货并转为锁定
+	BackorderCancelled BackorderStatus = 3 // 已取消，未到货的数量不再排队
+)
+
+// InventoryBackorder 缺货预订。锁定时可用库存不足且库存记录开启了预售，不足的数量按先后顺序排队，
+// 入库时依次转为订单的锁定明细；未到货的数量计入库存记录的backorder_stocks
+type InventoryBackorder struct {
+	ID          int64           `gorm:"primaryKey"`
+	OrderSN     string          `gorm:"column:order_sn;type:varchar(50);index;not null;comment:'订单号'"`
+	ProductID   int64           `gorm:"column:goods;not null;index:idx_backorder_queue;comment:'商品ID'"`
+	SkuID       int64           `gorm:"column:sku_id;not null;default:0;index:idx_backorder_queue;comment:'SKU ID，为0表示商品级库存'"`
+	WarehouseID int             `gorm:"not null;index:idx_backorder_queue;comment:'仓库ID'"`
+	Quantity    int             `gorm:"not null;comment:'预订数量'"`
+	Fulfilled   int             `gorm:"not null;default:0;comment:'已到货并转为锁定的数量'"`
+	Status      BackorderStatus `gorm:"type:int;not null;default:1;index:idx_backorder_queue;comment:'状态：1:排队中，2:已到货，3:已取消'"`
+	FulfilledAt *time.Time      `gorm:"type:datetime(3);comment:'全部到货时间'"`
+	CreatedAt   time.Time       `gorm:"type:datetime(3)"`
+	UpdatedAt   time.Time       `gorm:"type:datetime(3)"`
+}
+
+// TableName 指定表名
+func (InventoryBackorder) TableName() string {
+	return "inventory_backorder"
+}
+
+// Remaining 尚未到货的数量
+func (b *InventoryBackorder) Remaining() int {
+	if b.Quantity <= b.Fulfilled {
+		return 0
+	}
+	return b.Quantity - b.Fulfilled
+}
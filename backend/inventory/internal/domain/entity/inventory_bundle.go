@@ -0,0 +1,77 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InventoryBundle 套装定义。套装是由多个组件商品按固定数量组成的虚拟商品，本身没有库存记录，
+// 可售套数由组件的可用库存计算，锁定、扣减和归还套装时同时处理全部组件
+type InventoryBundle struct {
+	ID        int64     `gorm:"primaryKey"`
+	ProductID int64     `gorm:"column:goods;uniqueIndex;not null;comment:'套装商品ID'"`
+	Name      string    `gorm:"type:varchar(100);comment:'套装名称'"`
+	Detail    string    `gorm:"type:json;comment:'组件明细，结构为[{goods_id:1, sku_id:0, num:2}]'"`
+	Operator  string    `gorm:"type:varchar(50);comment:'最后修改人'"`
+	CreatedAt time.Time `gorm:"type:datetime(3)"`
+	UpdatedAt time.Time `gorm:"type:datetime(3)"`
+
+	// 非数据库字段，用于Detail的JSON转换
+	Components []*BundleComponent `gorm:"-"`
+}
+
+// BundleComponent 套装组件，Quantity为每套包含的数量
+type BundleComponent struct {
+	ProductID int64 `json:"goods_id"`
+	SkuID     int64 `json:"sku_id,omitempty"`
+	Quantity  int   `json:"num"`
+}
+
+// TableName 指定表名
+func (InventoryBundle) TableName() string {
+	return "inventory_bundle"
+}
+
+// AvailableUnits 根据同一仓库中组件的库存记录计算可售套数，任一组件没有库存记录时为0
+func (b *InventoryBundle) AvailableUnits(inventories []*Inventory) int {
+	if len(b.Components) == 0 {
+		return 0
+	}
+
+	units := -1
+	for _, component := range b.Components {
+		available := 0
+		for _, inv := range inventories {
+			if inv.ProductID == component.ProductID && inv.SkuID == component.SkuID {
+				available += inv.AvailableStock()
+			}
+		}
+		componentUnits := available / component.Quantity
+		if units < 0 || componentUnits < units {
+			units = componentUnits
+		}
+	}
+	return units
+}
+
+// BeforeSave 保存前的钩子函数，将Components转换为JSON字符串
+func (b *InventoryBundle) BeforeSave(tx *gorm.DB) error {
+	if len(b.Components) > 0 {
+		data, err := json.Marshal(b.Components)
+		if err != nil {
+			return err
+		}
+		b.Detail = string(data)
+	}
+	return nil
+}
+
+// AfterFind 查询后的钩子函数，将JSON字符串解析为Components
+func (b *InventoryBundle) AfterFind(tx *gorm.DB) error {
+	if b.Detail == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(b.Detail), &b.Components)
+}
@@ -0,0 +1,46 @@
+package entity
+
+import "testing"
+
+func TestBundleAvailableUnits(t *testing.T) {
+	bundle := &InventoryBundle{Components: []*BundleComponent{
+		{ProductID: 100, Quantity: 2},
+		{ProductID: 200, SkuID: 7, Quantity: 1},
+	}}
+
+	tests := []struct {
+		name        string
+		inventories []*Inventory
+		want        int
+	}{
+		{
+			name: "limited by scarcest component",
+			inventories: []*Inventory{
+				{ProductID: 100, Stock: 9, LockStock: 2},
+				{ProductID: 200, SkuID: 7, Stock: 5},
+			},
+			want: 3,
+		},
+		{
+			name:        "missing component",
+			inventories: []*Inventory{{ProductID: 100, Stock: 10}},
+			want:        0,
+		},
+		{
+			// 其他SKU的库存不计入组件
+			name: "other sku ignored",
+			inventories: []*Inventory{
+				{ProductID: 100, Stock: 10},
+				{ProductID: 200, SkuID: 8, Stock: 5},
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bundle.AvailableUnits(tt.inventories); got != tt.want {
+				t.Errorf("AvailableUnits() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// 常用销售渠道，渠道标识由调用方约定，不限于以下取值
+const (
+	ChannelApp         = "app"          // App
+	ChannelMiniProgram = "mini_program" // 小程序
+	ChannelWeb         = "web"          // 网页
+	ChannelB2B         = "b2b"          // 企业采购
+)
+
+// InventoryChannelAllocation 库存记录分配给销售渠道的数量，如某个渠道的活动配额。
+// 分配中未锁定的数量只有该渠道可以锁定，计入库存记录的reserved_stocks；
+// 渠道锁定时先使用分配，不足的部分再使用共享可用库存
+type InventoryChannelAllocation struct {
+	ID          int64     `gorm:"primaryKey"`
+	ProductID   int64     `gorm:"column:goods;not null;uniqueIndex:idx_channel_allocation;comment:'商品ID'"`
+	SkuID       int64     `gorm:"column:sku_id;not null;default:0;uniqueIndex:idx_channel_allocation;comment:'SKU ID，为0表示商品级库存'"`
+	WarehouseID int       `gorm:"not null;uniqueIndex:idx_channel_allocation;comment:'仓库ID'"`
+	Channel     string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_channel_allocation;comment:'销售渠道'"`
+	Allocated   int       `gorm:"not null;default:0;comment:'分配数量，含已锁定的部分，扣减后相应减少'"`
+	LockStock   int       `gorm:"column:lock_stocks;not null;default:0;comment:'从分配中锁定的数量'"`
+	CreatedAt   time.Time `gorm:"type:datetime(3)"`
+	UpdatedAt   time.Time `gorm:"type:datetime(3)"`
+}
+
+// TableName 指定表名
+func (InventoryChannelAllocation) TableName() string {
+	return "inventory_channel_allocation"
+}
+
+// Remaining 分配中尚未锁定的数量
+func (a *InventoryChannelAllocation) Remaining() int {
+	if a.Allocated <= a.LockStock {
+		return 0
+	}
+	return a.Allocated - a.LockStock
+}
@@ -8,22 +8,33 @@ import (
 type OperationType string
 
 const (
-	OperationLock     OperationType = "lock"     // 锁定库存
-	OperationUnlock   OperationType = "unlock"   // 解锁库存
-	OperationDecrease OperationType = "decrease" // 减少库存
-	OperationIncrease OperationType = "increase" // 增加库存
-	OperationAdjust   OperationType = "adjust"   // 调整库存（盘点）
+	OperationLock      OperationType = "lock"      // 锁定库存
+	OperationUnlock    OperationType = "unlock"    // 解锁库存
+	OperationDecrease  OperationType = "decrease"  // 减少库存
+	OperationIncrease  OperationType = "increase"  // 增加库存
+	OperationAdjust    OperationType = "adjust"    // 调整库存（盘点）
+	OperationExpire    OperationType = "expire"    // 批次过期，未锁定的数量不再可售
+	OperationWriteOff  OperationType = "write_off" // 过期批次报废，未锁定的数量从库存中核销
+	OperationReserve   OperationType = "reserve"   // 调整渠道分配或安全库存，只改变共享可售数量
+	OperationBackorder OperationType = "backorder" // 缺货预订排队或取消，正数为排队、负数为取消或到货转为锁定
+	
+	OperationTransferReserve OperationType = "transfer_reserve" // 调拨预留（源仓锁定）
+	OperationTransferCancel  OperationType = "transfer_cancel"  // 调拨取消（释放源仓预留）
+	OperationTransferOut     OperationType = "transfer_out"     // 调拨出库
+	OperationTransferIn      OperationType = "transfer_in"      // 调拨入库
 )
 
 // InventoryHistory 库存变更历史
 type InventoryHistory struct {
 	ID          int64        `gorm:"primaryKey"`
 	ProductID   int64        `gorm:"column:goods;index;not null;comment:'商品ID'"`
+	SkuID       int64        `gorm:"column:sku_id;not null;default:0;comment:'SKU ID，为0表示商品级库存'"`
 	WarehouseID int          `gorm:"not null;comment:'仓库ID'"`
 	Quantity    int          `gorm:"not null;comment:'变更数量（正数增加，负数减少）'"`
-	Operation   OperationType `gorm:"column:operation_type;type:varchar(20);not null;comment:'操作类型：lock, unlock, decrease, increase, adjust'"`
+	Operation   OperationType `gorm:"column:operation_type;type:varchar(20);not null;comment:'操作类型：lock, unlock, decrease, increase, adjust, expire, write_off, reserve, backorder, transfer_reserve, transfer_cancel, transfer_out, transfer_in'"`
 	Operator    string       `gorm:"type:varchar(50);comment:'操作人'"`
 	OrderSN     string       `gorm:"column:order_sn;type:varchar(50);index;comment:'相关订单号'"`
+	LotNo       string       `gorm:"column:lot_no;type:varchar(50);index;comment:'批次号，为空表示未区分批次'"`
 	Remark      string       `gorm:"type:varchar(255);comment:'备注'"`
 	CreatedAt   time.Time    `gorm:"type:datetime(3)"`
 }
@@ -33,14 +44,18 @@ func (InventoryHistory) TableName() string {
 	return "inventory_history"
 }
 
-// InventoryChangeRecord MongoDB版本的库存变更记录
+// InventoryChangeRecord MongoDB版本的库存变更记录，记录每一次库存操作的尝试，包括失败的操作
 type InventoryChangeRecord struct {
 	ProductID    int64        `bson:"product_id"`
+	SkuID        int64        `bson:"sku_id,omitempty"`
+	WarehouseID  int32        `bson:"warehouse_id"`
 	OrderSn      string       `bson:"order_sn"`
 	Operation    string       `bson:"operation"`
 	Quantity     int32        `bson:"quantity"`
 	BeforeStock  int32        `bson:"before_stock"`
 	AfterStock   int32        `bson:"after_stock"`
+	BeforeLocked int32        `bson:"before_locked"`
+	AfterLocked  int32        `bson:"after_locked"`
 	Operator     string       `bson:"operator"`
 	OperatorID   int64        `bson:"operator_id"`
 	Reason       string       `bson:"reason"`
@@ -49,11 +64,12 @@ type InventoryChangeRecord struct {
 	ErrorMessage string       `bson:"error_message,omitempty"`
 }
 
-// InventoryActivitySummary 库存操作统计摘要
+// InventoryActivitySummary 库存操作统计摘要，数量统计只包含成功的操作
 type InventoryActivitySummary struct {
 	ProductID     int64  `bson:"product_id"`
 	Operation     string `bson:"operation"`
 	Count         int    `bson:"count"`
+	FailedCount   int    `bson:"failed_count"`
 	TotalQuantity int    `bson:"total_quantity"`
 	MaxQuantity   int    `bson:"max_quantity"`
 	MinQuantity   int    `bson:"min_quantity"`
@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"sort"
+	"time"
+)
+
+// InventoryLot 库存批次，按批次号和到期日拆分同一库存记录的数量。
+// 库存记录的数量减去各批次数量之和为未区分批次的库存
+type InventoryLot struct {
+	ID          int64      `gorm:"primaryKey"`
+	ProductID   int64      `gorm:"column:goods;not null;uniqueIndex:idx_lot;comment:'商品ID'"`
+	SkuID       int64      `gorm:"column:sku_id;not null;default:0;uniqueIndex:idx_lot;comment:'SKU ID，为0表示商品级库存'"`
+	WarehouseID int        `gorm:"not null;uniqueIndex:idx_lot;comment:'仓库ID'"`
+	LotNo       string     `gorm:"column:lot_no;type:varchar(50);not null;uniqueIndex:idx_lot;comment:'批次号'"`
+	ExpiryDate  *time.Time `gorm:"type:datetime(3);index;comment:'到期时间，为空表示不过期'"`
+	Stock       int        `gorm:"column:stocks;not null;default:0;comment:'批次库存数量'"`
+	LockStock   int        `gorm:"column:lock_stocks;not null;default:0;comment:'批次锁定数量'"`
+	Expired     bool       `gorm:"not null;default:false;index;comment:'是否已过期，过期后未锁定的数量计入库存记录的过期数量'"`
+	CreatedAt   time.Time  `gorm:"type:datetime(3)"`
+	UpdatedAt   time.Time  `gorm:"type:datetime(3)"`
+}
+
+// TableName 指定表名
+func (InventoryLot) TableName() string {
+	return "inventory_lot"
+}
+
+// IsExpired 判断批次在指定时间是否已过期，到期时间已过但尚未标记的批次同样视为过期
+func (l *InventoryLot) IsExpired(now time.Time) bool {
+	return l.Expired || (l.ExpiryDate != nil && !l.ExpiryDate.After(now))
+}
+
+// AvailableStock 批次可用数量，过期批次不可用
+func (l *InventoryLot) AvailableStock(now time.Time) int {
+	if l.IsExpired(now) || l.Stock <= l.LockStock {
+		return 0
+	}
+	return l.Stock - l.LockStock
+}
+
+// SortLotsFEFO 按先到期先出排序，不过期的批次排在最后，到期时间相同时先入库的批次在前
+func SortLotsFEFO(lots []*InventoryLot) {
+	sort.SliceStable(lots, func(i, j int) bool {
+		a, b := lots[i].ExpiryDate, lots[j].ExpiryDate
+		switch {
+		case a == nil && b == nil:
+			return lots[i].ID < lots[j].ID
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		case !a.Equal(*b):
+			return a.Before(*b)
+		default:
+			return lots[i].ID < lots[j].ID
+		}
+	})
+}
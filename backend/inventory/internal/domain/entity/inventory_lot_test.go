@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortLotsFEFO(t *testing.T) {
+	day := func(d int) *time.Time {
+		v := time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC)
+		return &v
+	}
+	lots := []*InventoryLot{
+		{ID: 1, LotNo: "never-1"},
+		{ID: 2, LotNo: "jan-20", ExpiryDate: day(20)},
+		{ID: 3, LotNo: "jan-05-b", ExpiryDate: day(5)},
+		{ID: 4, LotNo: "never-0"},
+		{ID: 5, LotNo: "jan-10", ExpiryDate: day(10)},
+		{ID: 0, LotNo: "jan-05-a", ExpiryDate: day(5)},
+	}
+	// 不过期的批次按ID排序，ID为4的批次排在ID为1的批次之后
+	want := []string{"jan-05-a", "jan-05-b", "jan-10", "jan-20", "never-1", "never-0"}
+
+	SortLotsFEFO(lots)
+
+	for i, lot := range lots {
+		if lot.LotNo != want[i] {
+			got := make([]string, len(lots))
+			for j, l := range lots {
+				got[j] = l.LotNo
+			}
+			t.Fatalf("SortLotsFEFO order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestInventoryLotAvailableStock(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		lot  InventoryLot
+		want int
+	}{
+		{"no expiry", InventoryLot{Stock: 5, LockStock: 2}, 3},
+		{"not yet expired", InventoryLot{Stock: 5, LockStock: 2, ExpiryDate: &future}, 3},
+		{"expiry reached", InventoryLot{Stock: 5, LockStock: 2, ExpiryDate: &now}, 0},
+		{"expiry passed", InventoryLot{Stock: 5, ExpiryDate: &past}, 0},
+		{"marked expired", InventoryLot{Stock: 5, Expired: true}, 0},
+		{"fully locked", InventoryLot{Stock: 5, LockStock: 5}, 0},
+		{"over locked", InventoryLot{Stock: 5, LockStock: 6}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lot.AvailableStock(now); got != tt.want {
+				t.Errorf("AvailableStock() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 库存领域事件类型
+const (
+	EventStockLocked   = "StockLocked"   // 库存已锁定
+	EventStockReduced  = "StockReduced"  // 库存已扣减
+	EventStockReturned = "StockReturned" // 锁定库存已归还
+	EventStockAdjusted = "StockAdjusted" // 库存已调整（入库、出库、盘点）
+	// Redis中已锁定的订单无法写入MySQL，锁定已撤销，订单方需取消或重新锁定
+	EventStockLockFailed = "StockLockFailed"
+
+	EventBackorderQueued    = "BackorderQueued"    // 缺货数量已排队预订
+	EventBackorderFulfilled = "BackorderFulfilled" // 预订已到货并转为锁定
+	EventBackorderCancelled = "BackorderCancelled" // 排队中的预订已取消
+)
+
+// OutboxStatus 事件发布状态
+type OutboxStatus int
+
+const (
+	OutboxPending   OutboxStatus = 1 // 待发布
+	OutboxPublished OutboxStatus = 2 // 已发布
+	OutboxDead      OutboxStatus = 3 // 超过最大重试次数，需人工处理
+)
+
+// OutboxEvent 事务发件箱中的领域事件，与库存变更在同一事务内写入
+type OutboxEvent struct {
+	ID            int64        `gorm:"primaryKey"`
+	EventType     string       `gorm:"type:varchar(50);not null;comment:'事件类型'"`
+	AggregateID   string       `gorm:"type:varchar(64);index;not null;comment:'聚合ID，订单号或商品:仓库[:SKU]'"`
+	Payload       string       `gorm:"type:json;not null;comment:'事件内容'"`
+	Status        OutboxStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:待发布，2:已发布，3:发布失败'"`
+	Attempts      int          `gorm:"not null;default:0;comment:'发布次数'"`
+	LastError     string       `gorm:"type:varchar(500);comment:'最近一次发布错误'"`
+	NextAttemptAt time.Time    `gorm:"type:datetime(3);comment:'下次发布时间'"`
+	PublishedAt   *time.Time   `gorm:"type:datetime(3);comment:'发布时间'"`
+	CreatedAt     time.Time    `gorm:"type:datetime(3)"`
+}
+
+// TableName 指定表名
+func (OutboxEvent) TableName() string {
+	return "inventory_outbox"
+}
+
+// StockEventItem 事件涉及的商品库存变动
+type StockEventItem struct {
+	ProductID   int64  `json:"goods_id"`
+	SkuID       int64  `json:"sku_id,omitempty"`
+	WarehouseID int    `json:"warehouse_id"`
+	LotNo       string `json:"lot_no,omitempty"` // 批次号，按批次管理的库存填写
+	Quantity    int    `json:"quantity"`         // 变动数量，调整事件中正数增加、负数减少
+	Stock       *int   `json:"stock,omitempty"`  // 变动后的库存，调整事件中填写
+}
+
+// StockEvent 库存领域事件内容
+type StockEvent struct {
+	EventType  string            `json:"event_type"`
+	OrderSN    string            `json:"order_sn,omitempty"`
+	Items      []*StockEventItem `json:"items"`
+	Operator   string            `json:"operator,omitempty"`
+	Remark     string            `json:"remark,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// NewOutboxEvent 创建待发布的发件箱事件
+func NewOutboxEvent(aggregateID string, event *StockEvent) (*OutboxEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutboxEvent{
+		EventType:     event.EventType,
+		AggregateID:   aggregateID,
+		Payload:       string(payload),
+		Status:        OutboxPending,
+		NextAttemptAt: event.OccurredAt,
+		CreatedAt:     event.OccurredAt,
+	}, nil
+}
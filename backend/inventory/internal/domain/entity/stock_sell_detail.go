@@ -3,6 +3,8 @@ package entity
 import (
 	"encoding/json"
 	"time"
+	
+	"gorm.io/gorm"
 )
 
 // StockStatus 库存锁定状态
@@ -12,16 +14,19 @@ const (
 	StockLocked    StockStatus = 1 // 已锁定
 	StockReduced   StockStatus = 2 // 已扣减
 	StockReturned  StockStatus = 3 // 已归还
+	StockSettled   StockStatus = 4 // 已完结，部分扣减、部分归还
 )
 
 // StockSellDetail 库存扣减明细
 type StockSellDetail struct {
 	ID          int64      `gorm:"primaryKey"`
 	OrderSN     string     `gorm:"column:order_sn;type:varchar(50);uniqueIndex;not null;comment:'订单号'"`
-	Status      StockStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:锁定，2:已扣减，3:已归还'"`
-	Detail      string     `gorm:"type:json;comment:'库存扣减明细，结构为[{goods_id:1, num:2, warehouse_id:1}]'"`
+	Status      StockStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:锁定，2:已扣减，3:已归还，4:部分扣减部分归还'"`
+	Detail      string     `gorm:"type:json;comment:'库存扣减明细，结构为[{goods_id:1, sku_id:0, num:2, warehouse_id:1, lot_no:L001, reduced:0, returned:0, channel:app, channel_num:2, bundle_id:100, bundle_unit:1}]'"`
 	LockTime    *time.Time `gorm:"type:datetime(3);comment:'锁定时间'"`
+	ExpireTime  *time.Time `gorm:"type:datetime(3);index;comment:'锁定过期时间，为空表示不过期'"`
 	ConfirmTime *time.Time `gorm:"type:datetime(3);comment:'确认时间'"`
+	Backordered int        `gorm:"column:backorder_num;not null;default:0;comment:'排队中尚未到货的预订数量，到货后转为锁定明细'"`
 	CreatedAt   time.Time  `gorm:"type:datetime(3)"`
 	UpdatedAt   time.Time  `gorm:"type:datetime(3)"`
 	DeletedAt   *time.Time `gorm:"type:datetime(3)"`
@@ -30,11 +35,45 @@ type StockSellDetail struct {
 	DetailItems []*StockDetail `gorm:"-"`
 }
 
-// StockDetail 库存操作详情项
+// StockDetail 库存操作详情项，Reduced和Returned记录该行已扣减和已归还的数量。
+// 按批次管理的库存每个批次一行，LotNo为空表示未区分批次的库存
 type StockDetail struct {
-	ProductID   int64 `json:"goods_id"`
-	Quantity    int   `json:"num"`
-	WarehouseID int   `json:"warehouse_id"`
+	ProductID       int64      `json:"goods_id"`
+	SkuID           int64      `json:"sku_id,omitempty"`
+	Quantity        int        `json:"num"`
+	WarehouseID     int        `json:"warehouse_id"`
+	LotNo           string     `json:"lot_no,omitempty"`
+	ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+	Reduced         int        `json:"reduced,omitempty"`
+	Returned        int        `json:"returned,omitempty"`
+	Channel         string     `json:"channel,omitempty"`     // 锁定时的销售渠道
+	ChannelQuantity int        `json:"channel_num,omitempty"` // 本行使用渠道分配的数量，扣减和归还时先处理这部分
+	BundleID        int64      `json:"bundle_id,omitempty"`   // 作为套装组件锁定时的套装商品ID，按套装扣减和归还
+	BundleUnit      int        `json:"bundle_unit,omitempty"` // 每套包含该组件的数量
+}
+
+// Remaining 返回该行仍处于锁定的数量
+func (d *StockDetail) Remaining() int {
+	return d.Quantity - d.Reduced - d.Returned
+}
+
+// ChannelRemaining 返回该行仍处于锁定且使用渠道分配的数量
+func (d *StockDetail) ChannelRemaining() int {
+	return max(d.ChannelQuantity-d.Reduced-d.Returned, 0)
+}
+
+// LineStatus 返回该行的状态，仍有锁定数量时为已锁定
+func (d *StockDetail) LineStatus() StockStatus {
+	switch {
+	case d.Remaining() > 0:
+		return StockLocked
+	case d.Returned == 0:
+		return StockReduced
+	case d.Reduced == 0:
+		return StockReturned
+	default:
+		return StockSettled
+	}
 }
 
 // TableName 指定表名
@@ -43,8 +82,8 @@ func (StockSellDetail) TableName() string {
 }
 
 // BeforeSave 保存前的钩子函数，将DetailItems转换为JSON字符串
-func (s *StockSellDetail) BeforeSave() error {
-	if len(s.DetailItems) > 0 {
+func (s *StockSellDetail) BeforeSave(tx *gorm.DB) error {
+	if s.DetailItems != nil {
 		data, err := json.Marshal(s.DetailItems)
 		if err != nil {
 			return err
@@ -54,10 +93,58 @@ func (s *StockSellDetail) BeforeSave() error {
 	return nil
 }
 
+// IsExpired 判断锁定是否已过期
+func (s *StockSellDetail) IsExpired(now time.Time) bool {
+	return s.Status == StockLocked && s.ExpireTime != nil && !s.ExpireTime.After(now)
+}
+
+// RefreshStatus 根据每行的处理数量更新整单状态，任一行仍有锁定数量或仍有排队的预订时整单保持锁定
+func (s *StockSellDetail) RefreshStatus() {
+	if s.Backordered > 0 {
+		s.Status = StockLocked
+		return
+	}
+	
+	reduced, returned := false, false
+	for _, item := range s.DetailItems {
+		if item.Remaining() > 0 {
+			s.Status = StockLocked
+			return
+		}
+		reduced = reduced || item.Reduced > 0
+		returned = returned || item.Returned > 0
+	}
+
+	switch {
+	case reduced && returned:
+		s.Status = StockSettled
+	case returned:
+		s.Status = StockReturned
+	case reduced:
+		s.Status = StockReduced
+	}
+}
+
 // AfterFind 查询后的钩子函数，将JSON字符串解析为DetailItems
-func (s *StockSellDetail) AfterFind() error {
-	if s.Detail != "" {
-		return json.Unmarshal([]byte(s.Detail), &s.DetailItems)
+func (s *StockSellDetail) AfterFind(tx *gorm.DB) error {
+	if s.Detail == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(s.Detail), &s.DetailItems); err != nil {
+		return err
+	}
+
+	// 按行记录处理数量之前的记录只有整单状态，据此补全每行的数量
+	for _, item := range s.DetailItems {
+		if item.Reduced > 0 || item.Returned > 0 {
+			continue
+		}
+		switch s.Status {
+		case StockReduced:
+			item.Reduced = item.Quantity
+		case StockReturned:
+			item.Returned = item.Quantity
+		}
 	}
 	return nil
 }
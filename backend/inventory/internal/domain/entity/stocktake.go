@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"time"
+)
+
+// StocktakeStatus 盘点单状态
+type StocktakeStatus int
+
+const (
+	StocktakeOpen      StocktakeStatus = 1 // 盘点中
+	StocktakeCommitted StocktakeStatus = 2 // 已提交，差异已入账
+	StocktakeCancelled StocktakeStatus = 3 // 已取消
+)
+
+// StocktakeSession 仓库盘点单
+type StocktakeSession struct {
+	ID          int64           `gorm:"primaryKey"`
+	SessionSN   string          `gorm:"column:session_sn;type:varchar(50);uniqueIndex;not null;comment:'盘点单号'"`
+	WarehouseID int             `gorm:"not null;index;comment:'仓库ID'"`
+	Status      StocktakeStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:盘点中，2:已提交，3:已取消'"`
+	FullCount   bool            `gorm:"not null;default:false;comment:'是否全仓盘点，全仓盘点允许录入盘点范围外的商品'"`
+	Operator    string          `gorm:"type:varchar(50);comment:'创建人'"`
+	Remark      string          `gorm:"type:varchar(255);comment:'备注'"`
+	CommitTime  *time.Time      `gorm:"type:datetime(3);comment:'提交时间'"`
+	CancelTime  *time.Time      `gorm:"type:datetime(3);comment:'取消时间'"`
+	CreatedAt   time.Time       `gorm:"type:datetime(3)"`
+	UpdatedAt   time.Time       `gorm:"type:datetime(3)"`
+
+	// 非数据库字段，盘点明细
+	Items []*StocktakeItem `gorm:"-"`
+}
+
+// TableName 指定表名
+func (StocktakeSession) TableName() string {
+	return "stocktake_session"
+}
+
+// IsOpen 判断盘点单是否仍可录入和提交
+func (s *StocktakeSession) IsOpen() bool {
+	return s.Status == StocktakeOpen
+}
+
+// StocktakeItem 盘点明细。
+// BookStock为录入盘点数量时的账面库存，提交时按 CountedStock - BookStock 的差异调整当前库存，
+// 因此盘点期间发生的锁定、扣减不会被盘点结果覆盖
+type StocktakeItem struct {
+	ID           int64      `gorm:"primaryKey"`
+	SessionID    int64      `gorm:"not null;uniqueIndex:idx_session_goods_sku;comment:'盘点单ID'"`
+	ProductID    int64      `gorm:"column:goods;not null;uniqueIndex:idx_session_goods_sku;comment:'商品ID'"`
+	SkuID        int64      `gorm:"column:sku_id;not null;default:0;uniqueIndex:idx_session_goods_sku;comment:'SKU ID，为0表示商品级库存'"`
+	BookStock    int        `gorm:"not null;default:0;comment:'录入盘点时的账面库存'"`
+	CountedStock *int       `gorm:"comment:'实盘数量，为空表示未盘点'"`
+	CountTime    *time.Time `gorm:"type:datetime(3);comment:'录入时间'"`
+	Counter      string     `gorm:"type:varchar(50);comment:'盘点人'"`
+	CreatedAt    time.Time  `gorm:"type:datetime(3)"`
+	UpdatedAt    time.Time  `gorm:"type:datetime(3)"`
+}
+
+// TableName 指定表名
+func (StocktakeItem) TableName() string {
+	return "stocktake_item"
+}
+
+// IsCounted 判断是否已录入实盘数量
+func (i *StocktakeItem) IsCounted() bool {
+	return i.CountedStock != nil
+}
+
+// Variance 盘点差异，正数为盘盈，负数为盘亏；未盘点时为0
+func (i *StocktakeItem) Variance() int {
+	if i.CountedStock == nil {
+		return 0
+	}
+	return *i.CountedStock - i.BookStock
+}
@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TransferStatus 调拨单状态
+type TransferStatus int
+
+const (
+	TransferCreated   TransferStatus = 1 // 已创建，源仓库存已预留
+	TransferInTransit TransferStatus = 2 // 已发货，在途
+	TransferReceived  TransferStatus = 3 // 已收货
+	TransferCancelled TransferStatus = 4 // 已取消
+)
+
+// TransferOrder 仓库间调拨单
+type TransferOrder struct {
+	ID              int64          `gorm:"primaryKey"`
+	TransferSN      string         `gorm:"column:transfer_sn;type:varchar(50);uniqueIndex;not null;comment:'调拨单号'"`
+	FromWarehouseID int            `gorm:"not null;index;comment:'调出仓库ID'"`
+	ToWarehouseID   int            `gorm:"not null;index;comment:'调入仓库ID'"`
+	Status          TransferStatus `gorm:"type:int;default:1;index;not null;comment:'状态：1:已创建，2:在途，3:已收货，4:已取消'"`
+	Detail          string         `gorm:"type:json;comment:'调拨明细，结构为[{goods_id:1, sku_id:0, num:2}]'"`
+	Operator        string         `gorm:"type:varchar(50);comment:'创建人'"`
+	Remark          string         `gorm:"type:varchar(255);comment:'备注'"`
+	ShipTime        *time.Time     `gorm:"type:datetime(3);comment:'发货时间'"`
+	ReceiveTime     *time.Time     `gorm:"type:datetime(3);comment:'收货时间'"`
+	CancelTime      *time.Time     `gorm:"type:datetime(3);comment:'取消时间'"`
+	CreatedAt       time.Time      `gorm:"type:datetime(3)"`
+	UpdatedAt       time.Time      `gorm:"type:datetime(3)"`
+	DeletedAt       *time.Time     `gorm:"type:datetime(3)"`
+
+	// 非数据库字段，用于Detail的JSON转换
+	Items []*TransferItem `gorm:"-"`
+}
+
+// TransferItem 调拨明细项
+type TransferItem struct {
+	ProductID int64 `json:"goods_id"`
+	SkuID     int64 `json:"sku_id,omitempty"`
+	Quantity  int   `json:"num"`
+}
+
+// TableName 指定表名
+func (TransferOrder) TableName() string {
+	return "transfer_order"
+}
+
+// CanShip 判断调拨单是否可以发货
+func (t *TransferOrder) CanShip() bool {
+	return t.Status == TransferCreated
+}
+
+// CanReceive 判断调拨单是否可以收货
+func (t *TransferOrder) CanReceive() bool {
+	return t.Status == TransferInTransit
+}
+
+// CanCancel 判断调拨单是否可以取消，已收货的调拨单不能取消
+func (t *TransferOrder) CanCancel() bool {
+	return t.Status == TransferCreated || t.Status == TransferInTransit
+}
+
+// BeforeSave 保存前的钩子函数，将Items转换为JSON字符串
+func (t *TransferOrder) BeforeSave(tx *gorm.DB) error {
+	if len(t.Items) > 0 {
+		data, err := json.Marshal(t.Items)
+		if err != nil {
+			return err
+		}
+		t.Detail = string(data)
+	}
+	return nil
+}
+
+// AfterFind 查询后的钩子函数，将JSON字符串解析为Items
+func (t *TransferOrder) AfterFind(tx *gorm.DB) error {
+	if t.Detail != "" {
+		return json.Unmarshal([]byte(t.Detail), &t.Items)
+	}
+	return nil
+}
@@ -1,20 +1,40 @@
 package entity
 
 import (
+	"strings"
 	"time"
 )
 
+// WarehouseCapability 仓库作业能力，按位组合
+type WarehouseCapability int
+
+const (
+	CapabilityColdChain  WarehouseCapability = 1 << iota // 冷链
+	CapabilityHazmat                                     // 危险品
+	CapabilityBonded                                     // 保税
+	CapabilitySelfPickup                                 // 自提
+
+	// AllWarehouseCapabilities 所有已定义的作业能力
+	AllWarehouseCapabilities = CapabilityColdChain | CapabilityHazmat | CapabilityBonded | CapabilitySelfPickup
+)
+
 // Warehouse 仓库实体
 type Warehouse struct {
-	ID        int       `gorm:"primaryKey"`
-	Name      string    `gorm:"type:varchar(100);not null;comment:'仓库名称'"`
-	Address   string    `gorm:"type:varchar(255);not null;comment:'仓库地址'"`
-	Contact   string    `gorm:"type:varchar(50);comment:'联系人'"`
-	Phone     string    `gorm:"type:varchar(20);comment:'联系电话'"`
-	Status    int8      `gorm:"type:tinyint(1);default:1;index;comment:'状态：1-正常，0-禁用'"`
-	CreatedAt time.Time `gorm:"type:datetime(3)"`
-	UpdatedAt time.Time `gorm:"type:datetime(3)"`
-	DeletedAt *time.Time `gorm:"type:datetime(3)"`
+	ID            int                 `gorm:"primaryKey"`
+	Name          string              `gorm:"type:varchar(100);not null;comment:'仓库名称'"`
+	Address       string              `gorm:"type:varchar(255);not null;comment:'仓库地址'"`
+	Contact       string              `gorm:"type:varchar(50);comment:'联系人'"`
+	Phone         string              `gorm:"type:varchar(20);comment:'联系电话'"`
+	Status        int8                `gorm:"type:tinyint(1);default:1;index;comment:'状态：1-正常，0-禁用'"`
+	RegionCode    string              `gorm:"type:varchar(20);index;comment:'所在地区编码'"`
+	Latitude      float64             `gorm:"type:decimal(10,6);comment:'纬度'"`
+	Longitude     float64             `gorm:"type:decimal(10,6);comment:'经度'"`
+	ServedRegions string              `gorm:"type:varchar(1000);comment:'配送覆盖的地区编码，逗号分隔'"`
+	Capacity      int                 `gorm:"not null;default:0;comment:'库容，最多存放的库存数量，0表示不限'"`
+	Capabilities  WarehouseCapability `gorm:"not null;default:0;comment:'作业能力，按位组合：1-冷链，2-危险品，4-保税，8-自提'"`
+	CreatedAt     time.Time           `gorm:"type:datetime(3)"`
+	UpdatedAt     time.Time           `gorm:"type:datetime(3)"`
+	DeletedAt     *time.Time          `gorm:"type:datetime(3)"`
 }
 
 // TableName 指定表名
@@ -26,3 +46,48 @@ func (Warehouse) TableName() string {
 func (w *Warehouse) IsActive() bool {
 	return w.Status == 1
 }
+
+// HasLocation 判断仓库是否已设置经纬度
+func (w *Warehouse) HasLocation() bool {
+	return w.Latitude != 0 || w.Longitude != 0
+}
+
+// HasCapabilities 判断仓库是否同时具备指定的全部作业能力
+func (w *Warehouse) HasCapabilities(capabilities WarehouseCapability) bool {
+	return w.Capabilities&capabilities == capabilities
+}
+
+// ServedRegionList 返回配送覆盖的地区编码
+func (w *Warehouse) ServedRegionList() []string {
+	if w.ServedRegions == "" {
+		return nil
+	}
+	return strings.Split(w.ServedRegions, ",")
+}
+
+// SetServedRegions 设置配送覆盖的地区编码，忽略空编码
+func (w *Warehouse) SetServedRegions(regions []string) {
+	codes := make([]string, 0, len(regions))
+	for _, region := range regions {
+		if region = strings.TrimSpace(region); region != "" {
+			codes = append(codes, region)
+		}
+	}
+	w.ServedRegions = strings.Join(codes, ",")
+}
+
+// Serves 判断仓库是否位于或配送覆盖指定地区
+func (w *Warehouse) Serves(regionCode string) bool {
+	if regionCode == "" {
+		return false
+	}
+	if w.RegionCode == regionCode {
+		return true
+	}
+	for _, region := range w.ServedRegionList() {
+		if region == regionCode {
+			return true
+		}
+	}
+	return false
+}
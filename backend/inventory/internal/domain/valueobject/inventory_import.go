@@ -0,0 +1,32 @@
+package valueobject
+
+// InventoryImportError 导入文件中某一行的校验错误，Line为文件中的行号，表头为第1行
+type InventoryImportError struct {
+	Line    int
+	Message string
+}
+
+// InventoryDiff 导入前后的库存差异
+type InventoryDiff struct {
+	ProductID         int64
+	SkuID             int64
+	WarehouseID       int
+	OldStock          int
+	NewStock          int
+	OldAlertThreshold int
+	NewAlertThreshold int
+	Created           bool // 库存记录不存在，导入时新建
+}
+
+// InventoryImportReport 库存导入结果。存在校验错误时不写入任何记录，
+// 写入中断时Applied为已写入的记录数，使用同一文件重新导入即可补齐
+type InventoryImportReport struct {
+	TotalRows int
+	Created   int
+	Updated   int
+	Unchanged int
+	Applied   int
+	DryRun    bool
+	Errors    []*InventoryImportError
+	Diffs     []*InventoryDiff
+}
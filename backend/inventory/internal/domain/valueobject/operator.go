@@ -0,0 +1,22 @@
+package valueobject
+
+import "context"
+
+// Operator 发起库存操作的操作人
+type Operator struct {
+	ID   int64
+	Name string
+}
+
+type operatorKey struct{}
+
+// WithOperator 将操作人写入上下文
+func WithOperator(ctx context.Context, operator Operator) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+// OperatorFromContext 从上下文中读取操作人，未设置时返回零值
+func OperatorFromContext(ctx context.Context) Operator {
+	operator, _ := ctx.Value(operatorKey{}).(Operator)
+	return operator
+}
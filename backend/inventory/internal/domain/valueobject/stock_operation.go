@@ -1,26 +1,110 @@
 package valueobject
 
-// StockOperation 库存操作值对象
+import "time"
+
+// SkuKey 库存单元标识，SkuID为0表示不区分规格的商品级库存
+type SkuKey struct {
+	ProductID int64
+	SkuID     int64
+}
+
+// LotInfo 入库批次信息，ExpiryDate为空表示不过期
+type LotInfo struct {
+	LotNo      string
+	ExpiryDate *time.Time
+}
+
+// StockOperation 库存操作值对象。锁定套装时每个组件一项，BundleID为套装商品ID，BundleUnit为每套包含该组件的数量，
+// 同一套装同一仓库的组件项相邻排列，全部锁定成功或全部不锁定
 type StockOperation struct {
 	ProductID   int64
+	SkuID       int64
 	WarehouseID int
 	Quantity    int
 	OrderSN     string
 	Operator    string
 	Remark      string
+	BundleID    int64
+	BundleUnit  int
+}
+
+// LockOptions 库存锁定选项，零值为整单锁定
+type LockOptions struct {
+	AllowPartial         bool   // 允许部分锁定，库存不足的商品跳过，其余商品照常锁定
+	AllowPartialQuantity bool   // 部分锁定时，库存不足的商品按可用数量锁定
+	Channel              string // 销售渠道，先使用渠道分配再使用共享可用库存，为空时只使用共享可用库存
+	AllowBackorder       bool   // 可用库存不足时，开启预售的库存记录将不足的数量排队预订，到货后自动锁定
 }
 
 // LockResult 库存锁定结果
 type LockResult struct {
-	Success   bool
-	Message   string
-	FailItems []*LockFailItem
+	Success     bool
+	Partial     bool // 部分锁定成功，FailItems中为未锁定或未锁满的商品
+	Message     string
+	FailItems   []*LockFailItem
+	LockedItems []*StockOperation // 实际锁定的商品、仓库及数量
+	Backordered []*StockOperation // 排队预订的商品、仓库及数量，到货后转为锁定
 }
 
-// LockFailItem 锁定失败项
+// LockFailCode 锁定失败原因
+type LockFailCode string
+
+const (
+	LockFailInsufficientStock LockFailCode = "insufficient_stock"  // 可用库存不足
+	LockFailInventoryNotFound LockFailCode = "inventory_not_found" // 没有库存记录
+	LockFailBackorderLimit    LockFailCode = "backorder_limit"     // 可用库存不足，且超出预售上限
+	LockFailConcurrentUpdate  LockFailCode = "concurrent_update"   // 库存被并发修改，可重试
+)
+
+// LockFailItem 锁定失败项，Backorderable为库存记录还可以排队预订的数量
 type LockFailItem struct {
-	ProductID int64
-	Quantity  int
-	Available int
-	Reason    string
+	ProductID     int64
+	SkuID         int64
+	WarehouseID   int
+	Quantity      int
+	Available     int
+	Backorderable int
+	Code          LockFailCode
+	Reason        string
+}
+
+// StockKey 库存记录标识
+type StockKey struct {
+	ProductID   int64
+	SkuID       int64
+	WarehouseID int
+}
+
+// LedgerDrift 库存记录与流水的核对差异。库存数量以库存变更历史的累计为准，
+// 锁定数量以未完结的订单锁定和调拨预留为准
+type LedgerDrift struct {
+	ProductID     int64
+	SkuID         int64
+	WarehouseID   int
+	Stock         int  // 库存记录的库存数量
+	LedgerStock   int  // 库存变更历史累计的库存数量
+	LockStock     int  // 库存记录的锁定数量
+	OpenLockStock int  // 未完结的订单锁定和调拨预留数量之和
+	Repaired      bool // 差异是否已修复
+}
+
+// StockDrift 库存数量与流水的差异，正数表示库存记录多于流水
+func (d *LedgerDrift) StockDrift() int {
+	return d.Stock - d.LedgerStock
+}
+
+// LockDrift 锁定数量与未完结锁定的差异，正数表示锁定数量多于实际锁定
+func (d *LedgerDrift) LockDrift() int {
+	return d.LockStock - d.OpenLockStock
+}
+
+// HasDrift 判断是否存在差异
+func (d *LedgerDrift) HasDrift() bool {
+	return d.StockDrift() != 0 || d.LockDrift() != 0
+}
+
+// LedgerReport 一次流水核对的结果
+type LedgerReport struct {
+	Checked int            // 核对的库存记录数量
+	Drifts  []*LedgerDrift // 存在差异的库存记录
 }
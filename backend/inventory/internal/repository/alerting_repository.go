@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/alert"
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// AlertingRepository 在减少库存的操作完成后评估低库存预警，其余操作委托给底层仓储
+type AlertingRepository struct {
+	InventoryRepository
+	evaluator *alert.Evaluator
+	logger    *zap.Logger
+}
+
+// NewAlertingRepository 创建带低库存预警的库存仓储
+func NewAlertingRepository(base InventoryRepository, evaluator *alert.Evaluator, logger *zap.Logger) *AlertingRepository {
+	return &AlertingRepository{
+		InventoryRepository: base,
+		evaluator:           evaluator,
+		logger:              logger,
+	}
+}
+
+// ReduceStock 确认扣减库存后评估订单涉及的商品
+func (r *AlertingRepository) ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	detail, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+	if err != nil {
+		return err
+	}
+
+	if err := r.InventoryRepository.ReduceStock(ctx, orderSN, lines); err != nil {
+		return err
+	}
+
+	keys := make([]stockKey, 0, len(detail.DetailItems))
+	for _, item := range detail.DetailItems {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, item.WarehouseID})
+	}
+	r.evaluate(ctx, keys, string(entity.OperationDecrease))
+
+	return nil
+}
+
+// DecreaseStock 减少库存后评估预警
+func (r *AlertingRepository) DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error {
+	if err := r.InventoryRepository.DecreaseStock(ctx, productID, skuID, warehouseID, quantity, remark); err != nil {
+		return err
+	}
+	r.evaluate(ctx, []stockKey{{productID, skuID, warehouseID}}, string(entity.OperationDecrease))
+	return nil
+}
+
+// AdjustStock 调整库存后评估预警，盘盈使库存恢复时会清除预警标记
+func (r *AlertingRepository) AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error {
+	if err := r.InventoryRepository.AdjustStock(ctx, productID, skuID, warehouseID, newStock, operator, remark); err != nil {
+		return err
+	}
+	r.evaluate(ctx, []stockKey{{productID, skuID, warehouseID}}, string(entity.OperationAdjust))
+	return nil
+}
+
+// evaluate 读取最新库存并评估预警，读取失败不影响库存操作结果
+func (r *AlertingRepository) evaluate(ctx context.Context, keys []stockKey, operation string) {
+	productIDs := make([]int64, 0, len(keys))
+	warehouseIDs := make([]int, 0, len(keys))
+	for _, key := range keys {
+		productIDs = append(productIDs, key.productID)
+		warehouseIDs = append(warehouseIDs, key.warehouseID)
+	}
+
+	inventories, err := r.InventoryRepository.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		r.logger.Warn("Failed to load inventories for low stock alert",
+			zap.Int64s("product_ids", productIDs),
+			zap.Error(err))
+		return
+	}
+
+	// 按商品和仓库批量查询可能多查出其他SKU或组合，只评估实际变动的记录
+	changed := make(map[stockKey]bool, len(keys))
+	for _, key := range keys {
+		changed[key] = true
+	}
+	for _, inv := range inventories {
+		if changed[stockKey{inv.ProductID, inv.SkuID, inv.WarehouseID}] {
+			r.evaluator.Evaluate(ctx, inv, operation)
+		}
+	}
+}
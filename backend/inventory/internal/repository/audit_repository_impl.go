@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// MongoAuditRepository MongoDB实现的库存审计日志仓储
+type MongoAuditRepository struct {
+	client     *mongo.Client
+	database   string
+	collection string
+	logger     *zap.Logger
+}
+
+// NewMongoAuditRepository 创建库存审计日志仓储
+func NewMongoAuditRepository(client *mongo.Client, database, collection string, logger *zap.Logger) *MongoAuditRepository {
+	return &MongoAuditRepository{
+		client:     client,
+		database:   database,
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes 创建查询所需的索引，retention大于0时按记录时间自动过期
+func (r *MongoAuditRepository) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	timestampIndex := options.Index()
+	if retention > 0 {
+		timestampIndex.SetExpireAfterSeconds(int32(retention.Seconds()))
+	}
+
+	_, err := r.coll().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}, Options: timestampIndex},
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "order_sn", Value: 1}}},
+	})
+	return err
+}
+
+// RecordInventoryChanges 批量写入审计记录，单条失败不影响其他记录
+func (r *MongoAuditRepository) RecordInventoryChanges(ctx context.Context, records []*entity.InventoryChangeRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		docs = append(docs, record)
+	}
+
+	if _, err := r.coll().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil {
+		r.logger.Error("Failed to insert inventory change records",
+			zap.Int("count", len(records)),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ListInventoryChanges 按时间倒序分页查询审计记录
+func (r *MongoAuditRepository) ListInventoryChanges(ctx context.Context, filter *InventoryChangeFilter, page, pageSize int) ([]*entity.InventoryChangeRecord, int64, error) {
+	query := buildChangeQuery(filter)
+
+	total, err := r.coll().CountDocuments(ctx, query)
+	if err != nil {
+		r.logger.Error("Failed to count inventory change records", zap.Error(err))
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	cursor, err := r.coll().Find(ctx, query, opts)
+	if err != nil {
+		r.logger.Error("Failed to find inventory change records", zap.Error(err))
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []*entity.InventoryChangeRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		r.logger.Error("Failed to decode inventory change records", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// AggregateInventoryChanges 按商品和操作类型汇总审计记录，次数包含失败的操作，数量统计只计算成功的操作
+func (r *MongoAuditRepository) AggregateInventoryChanges(ctx context.Context, filter *InventoryChangeFilter) ([]*entity.InventoryActivitySummary, error) {
+	// 失败的操作数量记为null，$max、$min、$avg会忽略null
+	successQuantity := bson.M{"$cond": bson.A{"$success", "$quantity", nil}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: buildChangeQuery(filter)}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"product_id": "$product_id",
+				"operation":  "$operation",
+			},
+			"count":          bson.M{"$sum": 1},
+			"failed_count":   bson.M{"$sum": bson.M{"$cond": bson.A{"$success", 0, 1}}},
+			"total_quantity": bson.M{"$sum": successQuantity},
+			"max_quantity":   bson.M{"$max": successQuantity},
+			"min_quantity":   bson.M{"$min": successQuantity},
+			"avg_quantity":   bson.M{"$avg": successQuantity},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":            0,
+			"product_id":     "$_id.product_id",
+			"operation":      "$_id.operation",
+			"count":          1,
+			"failed_count":   1,
+			"total_quantity": 1,
+			"max_quantity":   bson.M{"$ifNull": bson.A{"$max_quantity", 0}},
+			"min_quantity":   bson.M{"$ifNull": bson.A{"$min_quantity", 0}},
+			"avg_quantity":   bson.M{"$ifNull": bson.A{"$avg_quantity", 0}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "product_id", Value: 1}, {Key: "operation", Value: 1}}}},
+	}
+
+	cursor, err := r.coll().Aggregate(ctx, pipeline)
+	if err != nil {
+		r.logger.Error("Failed to aggregate inventory change records", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var summaries []*entity.InventoryActivitySummary
+	if err := cursor.All(ctx, &summaries); err != nil {
+		r.logger.Error("Failed to decode inventory activity summaries", zap.Error(err))
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+func (r *MongoAuditRepository) coll() *mongo.Collection {
+	return r.client.Database(r.database).Collection(r.collection)
+}
+
+// buildChangeQuery 将查询条件转换为MongoDB过滤条件
+func buildChangeQuery(filter *InventoryChangeFilter) bson.M {
+	query := bson.M{}
+	if filter == nil {
+		return query
+	}
+
+	if filter.ProductID > 0 {
+		query["product_id"] = filter.ProductID
+	}
+	if filter.SkuID > 0 {
+		query["sku_id"] = filter.SkuID
+	}
+	if filter.WarehouseID > 0 {
+		query["warehouse_id"] = int32(filter.WarehouseID)
+	}
+	if filter.OrderSN != "" {
+		query["order_sn"] = filter.OrderSN
+	}
+	if filter.Operation != "" {
+		query["operation"] = filter.Operation
+	}
+	if filter.FailedOnly {
+		query["success"] = false
+	}
+
+	timeRange := bson.M{}
+	if !filter.StartTime.IsZero() {
+		timeRange["$gte"] = filter.StartTime
+	}
+	if !filter.EndTime.IsZero() {
+		timeRange["$lt"] = filter.EndTime
+	}
+	if len(timeRange) > 0 {
+		query["timestamp"] = timeRange
+	}
+
+	return query
+}
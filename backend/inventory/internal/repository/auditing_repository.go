@@ -0,0 +1,543 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+// AuditingRepository 为每一次库存操作的尝试记录审计日志，包括失败的操作，其余操作委托给底层仓储。
+// 操作前后的库存在事务外读取，并发修改时可能包含其他操作的影响，仅用于排查问题
+type AuditingRepository struct {
+	InventoryRepository
+	recorder AuditRecorder
+	logger   *zap.Logger
+}
+
+// NewAuditingRepository 创建带审计日志的库存仓储
+func NewAuditingRepository(base InventoryRepository, recorder AuditRecorder, logger *zap.Logger) *AuditingRepository {
+	return &AuditingRepository{
+		InventoryRepository: base,
+		recorder:            recorder,
+		logger:              logger,
+	}
+}
+
+// SetInventory 设置库存并记录审计日志
+func (r *AuditingRepository) SetInventory(ctx context.Context, inventory *entity.Inventory) error {
+	keys := []stockKey{{inventory.ProductID, inventory.SkuID, inventory.WarehouseID}}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.SetInventory(ctx, inventory)
+
+	quantity := inventory.Stock - stockOf(before, keys[0])
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationAdjust)
+		record.Quantity = int32(quantity)
+		record.Reason = "set inventory"
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// SetInventories 批量设置库存并记录每个商品的设置结果，整批在同一事务内完成，失败时所有记录均为失败
+func (r *AuditingRepository) SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error {
+	keys := make([]stockKey, 0, len(inventories))
+	stocks := make(map[stockKey]int, len(inventories))
+	for _, inventory := range inventories {
+		key := stockKey{inventory.ProductID, inventory.SkuID, inventory.WarehouseID}
+		keys = append(keys, key)
+		stocks[key] = inventory.Stock
+	}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.SetInventories(ctx, inventories, operator, remark)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationAdjust)
+		record.Quantity = int32(stocks[key] - stockOf(before, key))
+		record.Reason = remark
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// LockStock 锁定库存并记录每个商品的锁定结果，部分锁定时记录实际锁定的数量
+func (r *AuditingRepository) LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	keys := make([]stockKey, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, item.WarehouseID})
+	}
+	before := r.snapshot(ctx, keys)
+
+	result, err := r.InventoryRepository.LockStock(ctx, orderSN, items, expireTime, opts)
+
+	failReasons := make(map[stockKey]string)
+	locked := make(map[stockKey]int)
+	if result != nil {
+		for _, failItem := range result.FailItems {
+			failReasons[stockKey{failItem.ProductID, failItem.SkuID, failItem.WarehouseID}] = failItem.Reason
+		}
+		for _, lockedItem := range result.LockedItems {
+			locked[stockKey{lockedItem.ProductID, lockedItem.SkuID, lockedItem.WarehouseID}] += lockedItem.Quantity
+		}
+	}
+
+	after := r.snapshot(ctx, keys)
+	for i, item := range items {
+		r.record(ctx, keys[i:i+1], before, after, func(key stockKey, record *entity.InventoryChangeRecord) {
+			record.Operation = string(entity.OperationLock)
+			record.OrderSn = orderSN
+			record.Quantity = int32(item.Quantity)
+			record.Reason = item.Remark
+			if record.Operator == "" {
+				record.Operator = item.Operator
+			}
+
+			switch {
+			case err != nil:
+				setResult(record, err)
+			case result.Success && locked[key] > 0:
+				record.Success = true
+				if failReasons[key] != "" {
+					record.Quantity = int32(locked[key])
+					record.ErrorMessage = "partially locked: " + failReasons[key]
+				}
+			case failReasons[key] != "":
+				record.ErrorMessage = failReasons[key]
+			case !result.Success:
+				// 整单锁定，其他商品失败时该商品的锁定随事务回滚
+				record.ErrorMessage = "rolled back: " + result.Message
+			default:
+				record.Success = true
+			}
+		})
+	}
+
+	return result, err
+}
+
+// UnlockStock 归还锁定库存并记录审计日志
+func (r *AuditingRepository) UnlockStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	return r.auditOrder(ctx, orderSN, lines, entity.OperationUnlock, r.InventoryRepository.UnlockStock)
+}
+
+// ReduceStock 确认扣减库存并记录审计日志
+func (r *AuditingRepository) ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	return r.auditOrder(ctx, orderSN, lines, entity.OperationDecrease, r.InventoryRepository.ReduceStock)
+}
+
+// IncreaseStock 增加库存并记录审计日志
+func (r *AuditingRepository) IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error {
+	keys := []stockKey{{productID, skuID, warehouseID}}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.IncreaseStock(ctx, productID, skuID, warehouseID, quantity, orderSN, remark, lot)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.OrderSn = orderSN
+		record.Operation = string(entity.OperationIncrease)
+		record.Quantity = int32(quantity)
+		record.Reason = remark
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// DecreaseStock 减少库存并记录审计日志
+func (r *AuditingRepository) DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error {
+	keys := []stockKey{{productID, skuID, warehouseID}}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.DecreaseStock(ctx, productID, skuID, warehouseID, quantity, remark)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationDecrease)
+		record.Quantity = int32(quantity)
+		record.Reason = remark
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// AdjustStock 调整库存并记录审计日志，数量为调整前后的差异
+func (r *AuditingRepository) AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error {
+	keys := []stockKey{{productID, skuID, warehouseID}}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.AdjustStock(ctx, productID, skuID, warehouseID, newStock, operator, remark)
+
+	quantity := newStock - stockOf(before, keys[0])
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationAdjust)
+		record.Quantity = int32(quantity)
+		record.Reason = remark
+		if record.Operator == "" {
+			record.Operator = operator
+		}
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// SplitInventory 拆分商品级库存并记录审计日志，商品级和每个SKU各记录一条
+func (r *AuditingRepository) SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error {
+	keys := []stockKey{{productID, 0, warehouseID}}
+	for skuID := range skuStocks {
+		keys = append(keys, stockKey{productID, skuID, warehouseID})
+	}
+	before := r.snapshot(ctx, keys)
+
+	err := r.InventoryRepository.SplitInventory(ctx, productID, warehouseID, skuStocks, operator)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationAdjust)
+		record.Quantity = int32(skuStocks[key.skuID])
+		if key.skuID == 0 {
+			record.Quantity = -int32(stockOf(before, key))
+		}
+		record.Reason = "split inventory"
+		if record.Operator == "" {
+			record.Operator = operator
+		}
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// WriteOffExpiredLot 报废过期批次并记录审计日志，数量为核销的数量
+func (r *AuditingRepository) WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error) {
+	keys := []stockKey{{productID, skuID, warehouseID}}
+	before := r.snapshot(ctx, keys)
+
+	lot, quantity, err := r.InventoryRepository.WriteOffExpiredLot(ctx, productID, skuID, warehouseID, lotNo, operator, remark)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationWriteOff)
+		record.Quantity = int32(quantity)
+		record.Reason = remark
+		if record.Operator == "" {
+			record.Operator = operator
+		}
+		setResult(record, err)
+	})
+
+	return lot, quantity, err
+}
+
+// auditOrder 对按订单归还或扣减的操作记录本次涉及的每个商品的审计日志
+func (r *AuditingRepository) auditOrder(
+	ctx context.Context,
+	orderSN string,
+	lines []*entity.StockDetail,
+	operation entity.OperationType,
+	apply func(ctx context.Context, orderSN string, lines []*entity.StockDetail) error,
+) error {
+	detail, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+	if err != nil {
+		// 无法读取锁定记录时不能确定商品，只记录订单号
+		err = apply(ctx, orderSN, lines)
+		r.record(ctx, []stockKey{{}}, nil, nil, func(key stockKey, record *entity.InventoryChangeRecord) {
+			record.Operation = string(operation)
+			record.OrderSn = orderSN
+			setResult(record, err)
+		})
+		return err
+	}
+
+	// 按与底层仓储相同的规则分配本次处理的数量，分配失败时记录请求的商品
+	keys := make([]stockKey, 0, len(detail.DetailItems))
+	quantities := make(map[stockKey]int, len(detail.DetailItems))
+	settled, allocErr := allocateSettleLines(detail, lines)
+	if allocErr != nil {
+		for _, line := range lines {
+			key := stockKey{line.ProductID, line.SkuID, line.WarehouseID}
+			if _, ok := quantities[key]; !ok {
+				keys = append(keys, key)
+			}
+			quantities[key] += line.Quantity
+		}
+	} else {
+		for _, line := range settled {
+			key := stockKey{line.item.ProductID, line.item.SkuID, line.item.WarehouseID}
+			if _, ok := quantities[key]; !ok {
+				keys = append(keys, key)
+			}
+			quantities[key] += line.quantity
+		}
+	}
+	before := r.snapshot(ctx, keys)
+
+	err = apply(ctx, orderSN, lines)
+
+	r.record(ctx, keys, before, r.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(operation)
+		record.OrderSn = orderSN
+		record.Quantity = int32(quantities[key])
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// stockKey 商品SKU仓库维度的库存键，skuID为0表示商品级库存
+type stockKey struct {
+	productID   int64
+	skuID       int64
+	warehouseID int
+}
+
+// snapshot 读取指定商品SKU仓库的库存，读取失败时返回空结果，不影响库存操作
+func (r *AuditingRepository) snapshot(ctx context.Context, keys []stockKey) map[stockKey]*entity.Inventory {
+	productIDs := make([]int64, 0, len(keys))
+	warehouseIDs := make([]int, 0, len(keys))
+	for _, key := range keys {
+		productIDs = append(productIDs, key.productID)
+		warehouseIDs = append(warehouseIDs, key.warehouseID)
+	}
+
+	inventories, err := r.InventoryRepository.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		r.logger.Warn("Failed to load inventories for audit",
+			zap.Int64s("product_ids", productIDs),
+			zap.Error(err))
+		return nil
+	}
+
+	snapshot := make(map[stockKey]*entity.Inventory, len(inventories))
+	for _, inv := range inventories {
+		snapshot[stockKey{inv.ProductID, inv.SkuID, inv.WarehouseID}] = inv
+	}
+	return snapshot
+}
+
+// stockOf 返回快照中的库存数量，没有记录时为0
+func stockOf(snapshot map[stockKey]*entity.Inventory, key stockKey) int {
+	if inv := snapshot[key]; inv != nil {
+		return inv.Stock
+	}
+	return 0
+}
+
+// record 为每个库存键生成审计记录，fill填充操作相关的字段
+func (r *AuditingRepository) record(
+	ctx context.Context,
+	keys []stockKey,
+	before, after map[stockKey]*entity.Inventory,
+	fill func(key stockKey, record *entity.InventoryChangeRecord),
+) {
+	operator := valueobject.OperatorFromContext(ctx)
+	now := time.Now()
+
+	for _, key := range keys {
+		record := &entity.InventoryChangeRecord{
+			ProductID:   key.productID,
+			SkuID:       key.skuID,
+			WarehouseID: int32(key.warehouseID),
+			Operator:    operator.Name,
+			OperatorID:  operator.ID,
+			Timestamp:   now,
+		}
+		if inv := before[key]; inv != nil {
+			record.BeforeStock = int32(inv.Stock)
+			record.BeforeLocked = int32(inv.LockStock)
+		}
+		if inv := after[key]; inv != nil {
+			record.AfterStock = int32(inv.Stock)
+			record.AfterLocked = int32(inv.LockStock)
+		}
+
+		fill(key, record)
+		r.recorder.Record(record)
+	}
+}
+
+// setResult 根据操作结果设置审计记录的成功标记和错误信息
+func setResult(record *entity.InventoryChangeRecord, err error) {
+	record.Success = err == nil
+	if err != nil {
+		record.ErrorMessage = err.Error()
+	}
+}
+
+// AuditingTransferRepository 为调拨单每一步的库存变更记录审计日志，订单号为调拨单号
+type AuditingTransferRepository struct {
+	TransferRepository
+	audit *AuditingRepository
+}
+
+// NewAuditingTransferRepository 创建带审计日志的调拨单仓储，inventories用于读取操作前后的库存
+func NewAuditingTransferRepository(base TransferRepository, inventories InventoryRepository, recorder AuditRecorder, logger *zap.Logger) *AuditingTransferRepository {
+	return &AuditingTransferRepository{
+		TransferRepository: base,
+		audit:              NewAuditingRepository(inventories, recorder, logger),
+	}
+}
+
+// CreateTransfer 创建调拨单并记录源仓预留
+func (r *AuditingTransferRepository) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	return r.auditTransfer(ctx, order, order.FromWarehouseID, entity.OperationTransferReserve, order.Operator, order.Remark, func() error {
+		return r.TransferRepository.CreateTransfer(ctx, order)
+	})
+}
+
+// ShipTransfer 调拨发货并记录源仓出库
+func (r *AuditingTransferRepository) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	return r.auditStep(ctx, transferSN, entity.OperationTransferOut, operator, "", func(order *entity.TransferOrder) int {
+		return order.FromWarehouseID
+	}, func() error {
+		return r.TransferRepository.ShipTransfer(ctx, transferSN, operator)
+	})
+}
+
+// ReceiveTransfer 调拨收货并记录目标仓入库
+func (r *AuditingTransferRepository) ReceiveTransfer(ctx context.Context, transferSN string, operator string) error {
+	return r.auditStep(ctx, transferSN, entity.OperationTransferIn, operator, "", func(order *entity.TransferOrder) int {
+		return order.ToWarehouseID
+	}, func() error {
+		return r.TransferRepository.ReceiveTransfer(ctx, transferSN, operator)
+	})
+}
+
+// CancelTransfer 取消调拨单并记录源仓释放预留或退回在途货物
+func (r *AuditingTransferRepository) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error {
+	return r.auditStep(ctx, transferSN, entity.OperationTransferCancel, operator, reason, func(order *entity.TransferOrder) int {
+		return order.FromWarehouseID
+	}, func() error {
+		return r.TransferRepository.CancelTransfer(ctx, transferSN, operator, reason)
+	})
+}
+
+// auditStep 读取调拨单后记录指定仓库的审计日志，调拨单无法读取时只记录调拨单号
+func (r *AuditingTransferRepository) auditStep(
+	ctx context.Context,
+	transferSN string,
+	operation entity.OperationType,
+	operator string,
+	reason string,
+	warehouseOf func(order *entity.TransferOrder) int,
+	apply func() error,
+) error {
+	order, err := r.TransferRepository.GetTransfer(ctx, transferSN)
+	if err != nil {
+		err = apply()
+		r.audit.record(ctx, []stockKey{{}}, nil, nil, func(key stockKey, record *entity.InventoryChangeRecord) {
+			record.Operation = string(operation)
+			record.OrderSn = transferSN
+			record.Reason = reason
+			if record.Operator == "" {
+				record.Operator = operator
+			}
+			setResult(record, err)
+		})
+		return err
+	}
+
+	return r.auditTransfer(ctx, order, warehouseOf(order), operation, operator, reason, apply)
+}
+
+// auditTransfer 对调拨单内每个商品在指定仓库的库存变更记录审计日志
+func (r *AuditingTransferRepository) auditTransfer(
+	ctx context.Context,
+	order *entity.TransferOrder,
+	warehouseID int,
+	operation entity.OperationType,
+	operator string,
+	reason string,
+	apply func() error,
+) error {
+	keys := make([]stockKey, 0, len(order.Items))
+	quantities := make(map[stockKey]int, len(order.Items))
+	for _, item := range order.Items {
+		key := stockKey{item.ProductID, item.SkuID, warehouseID}
+		if _, ok := quantities[key]; !ok {
+			keys = append(keys, key)
+		}
+		quantities[key] += item.Quantity
+	}
+	before := r.audit.snapshot(ctx, keys)
+
+	err := apply()
+
+	r.audit.record(ctx, keys, before, r.audit.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(operation)
+		record.OrderSn = order.TransferSN
+		record.Quantity = int32(quantities[key])
+		record.Reason = reason
+		if record.Operator == "" {
+			record.Operator = operator
+		}
+		setResult(record, err)
+	})
+
+	return err
+}
+
+// AuditingStocktakeRepository 为盘点单提交的库存调整记录审计日志，订单号为盘点单号
+type AuditingStocktakeRepository struct {
+	StocktakeRepository
+	audit *AuditingRepository
+}
+
+// NewAuditingStocktakeRepository 创建带审计日志的盘点单仓储，inventories用于读取操作前后的库存
+func NewAuditingStocktakeRepository(base StocktakeRepository, inventories InventoryRepository, recorder AuditRecorder, logger *zap.Logger) *AuditingStocktakeRepository {
+	return &AuditingStocktakeRepository{
+		StocktakeRepository: base,
+		audit:               NewAuditingRepository(inventories, recorder, logger),
+	}
+}
+
+// CommitSession 提交盘点单并记录每个有差异商品的调整，数量为盘点差异
+func (r *AuditingStocktakeRepository) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	session, err := r.StocktakeRepository.GetSession(ctx, sessionSN)
+	if err != nil {
+		session, err = r.StocktakeRepository.CommitSession(ctx, sessionSN, operator)
+		r.audit.record(ctx, []stockKey{{}}, nil, nil, func(key stockKey, record *entity.InventoryChangeRecord) {
+			record.Operation = string(entity.OperationAdjust)
+			record.OrderSn = sessionSN
+			record.Reason = "stocktake"
+			if record.Operator == "" {
+				record.Operator = operator
+			}
+			setResult(record, err)
+		})
+		return session, err
+	}
+
+	keys := make([]stockKey, 0, len(session.Items))
+	variances := make(map[stockKey]int, len(session.Items))
+	for _, item := range session.Items {
+		if item.Variance() == 0 {
+			continue
+		}
+		key := stockKey{item.ProductID, item.SkuID, session.WarehouseID}
+		keys = append(keys, key)
+		variances[key] = item.Variance()
+	}
+	before := r.audit.snapshot(ctx, keys)
+
+	committed, err := r.StocktakeRepository.CommitSession(ctx, sessionSN, operator)
+
+	r.audit.record(ctx, keys, before, r.audit.snapshot(ctx, keys), func(key stockKey, record *entity.InventoryChangeRecord) {
+		record.Operation = string(entity.OperationAdjust)
+		record.OrderSn = sessionSN
+		record.Quantity = int32(variances[key])
+		record.Reason = "stocktake"
+		if record.Operator == "" {
+			record.Operator = operator
+		}
+		setResult(record, err)
+	})
+
+	return committed, err
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// fakeRecorder 记录收到的审计记录
+type fakeRecorder struct {
+	records []*entity.InventoryChangeRecord
+}
+
+func (r *fakeRecorder) Record(record *entity.InventoryChangeRecord) {
+	r.records = append(r.records, record)
+}
+
+// fakeAuditInventoryRepo 内存中的库存，只用于审计快照
+type fakeAuditInventoryRepo struct {
+	InventoryRepository
+	stocks map[stockKey]int
+}
+
+func (r *fakeAuditInventoryRepo) GetInventoriesByProducts(ctx context.Context, productIDs []int64, warehouseIDs []int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	for key, stock := range r.stocks {
+		inventories = append(inventories, &entity.Inventory{ProductID: key.productID, SkuID: key.skuID, WarehouseID: key.warehouseID, Stock: stock})
+	}
+	return inventories, nil
+}
+
+// fakeAuditTransferRepo 发货时从源仓扣减库存，err不为空时操作失败
+type fakeAuditTransferRepo struct {
+	TransferRepository
+	order       *entity.TransferOrder
+	inventories *fakeAuditInventoryRepo
+	err         error
+}
+
+func (r *fakeAuditTransferRepo) GetTransfer(ctx context.Context, transferSN string) (*entity.TransferOrder, error) {
+	if r.order == nil {
+		return nil, ErrRecordNotFound
+	}
+	return r.order, nil
+}
+
+func (r *fakeAuditTransferRepo) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	if r.err != nil {
+		return r.err
+	}
+	for _, item := range r.order.Items {
+		r.inventories.stocks[stockKey{item.ProductID, item.SkuID, r.order.FromWarehouseID}] -= item.Quantity
+	}
+	return nil
+}
+
+func (r *fakeAuditTransferRepo) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error {
+	return r.err
+}
+
+// fakeAuditStocktakeRepo 提交时按差异调整库存
+type fakeAuditStocktakeRepo struct {
+	StocktakeRepository
+	session     *entity.StocktakeSession
+	inventories *fakeAuditInventoryRepo
+}
+
+func (r *fakeAuditStocktakeRepo) GetSession(ctx context.Context, sessionSN string) (*entity.StocktakeSession, error) {
+	return r.session, nil
+}
+
+func (r *fakeAuditStocktakeRepo) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	for _, item := range r.session.Items {
+		r.inventories.stocks[stockKey{item.ProductID, item.SkuID, r.session.WarehouseID}] += item.Variance()
+	}
+	r.session.Status = entity.StocktakeCommitted
+	return r.session, nil
+}
+
+func TestAuditingTransferRecordsShipment(t *testing.T) {
+	inventories := &fakeAuditInventoryRepo{stocks: map[stockKey]int{{100, 0, 1}: 10, {200, 0, 1}: 5}}
+	recorder := &fakeRecorder{}
+	base := &fakeAuditTransferRepo{
+		order: &entity.TransferOrder{TransferSN: "TR1", FromWarehouseID: 1, ToWarehouseID: 2,
+			Items: []*entity.TransferItem{{ProductID: 100, Quantity: 3}, {ProductID: 200, Quantity: 1}}},
+		inventories: inventories,
+	}
+	repo := NewAuditingTransferRepository(base, inventories, recorder, zap.NewNop())
+
+	if err := repo.ShipTransfer(context.Background(), "TR1", "tester"); err != nil {
+		t.Fatalf("ShipTransfer() error = %v", err)
+	}
+	if len(recorder.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(recorder.records))
+	}
+	record := recorder.records[0]
+	if record.Operation != string(entity.OperationTransferOut) || record.OrderSn != "TR1" || record.Operator != "tester" ||
+		record.WarehouseID != 1 || record.Quantity != 3 || record.BeforeStock != 10 || record.AfterStock != 7 || !record.Success {
+		t.Errorf("record = %+v, want a successful transfer_out of 3 from 10 to 7", record)
+	}
+}
+
+func TestAuditingTransferRecordsFailure(t *testing.T) {
+	recorder := &fakeRecorder{}
+	base := &fakeAuditTransferRepo{err: ErrInvalidTransferStatus}
+	repo := NewAuditingTransferRepository(base, &fakeAuditInventoryRepo{}, recorder, zap.NewNop())
+
+	// 调拨单不存在时只记录调拨单号和失败原因
+	err := repo.CancelTransfer(context.Background(), "TR404", "tester", "no longer needed")
+	if !errors.Is(err, ErrInvalidTransferStatus) {
+		t.Fatalf("CancelTransfer() error = %v, want %v", err, ErrInvalidTransferStatus)
+	}
+	if len(recorder.records) != 1 || recorder.records[0].Success || recorder.records[0].OrderSn != "TR404" {
+		t.Errorf("records = %+v, want one failed record for TR404", recorder.records)
+	}
+}
+
+func TestAuditingStocktakeRecordsVariances(t *testing.T) {
+	inventories := &fakeAuditInventoryRepo{stocks: map[stockKey]int{{100, 0, 1}: 10, {200, 0, 1}: 10}}
+	counted := 7
+	recorder := &fakeRecorder{}
+	base := &fakeAuditStocktakeRepo{
+		session: &entity.StocktakeSession{SessionSN: "ST1", WarehouseID: 1, Status: entity.StocktakeOpen,
+			Items: []*entity.StocktakeItem{
+				{ProductID: 100, BookStock: 10, CountedStock: &counted},
+				{ProductID: 200, BookStock: 10},
+			}},
+		inventories: inventories,
+	}
+	repo := NewAuditingStocktakeRepository(base, inventories, recorder, zap.NewNop())
+
+	if _, err := repo.CommitSession(context.Background(), "ST1", "tester"); err != nil {
+		t.Fatalf("CommitSession() error = %v", err)
+	}
+	// 未盘点的商品没有差异，不记录
+	if len(recorder.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(recorder.records))
+	}
+	record := recorder.records[0]
+	if record.Operation != string(entity.OperationAdjust) || record.ProductID != 100 || record.Quantity != -3 ||
+		record.BeforeStock != 10 || record.AfterStock != 7 || record.OrderSn != "ST1" {
+		t.Errorf("record = %+v, want an adjustment of -3 from 10 to 7", record)
+	}
+}
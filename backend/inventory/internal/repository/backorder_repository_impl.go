@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+// SetBackorderLimit 设置库存记录的预售上限，为0时关闭预售。低于当前排队数量时已排队的预订不受影响，只是不再接受新的预订
+func (r *InventoryRepositoryImpl) SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error {
+	res := r.db.WithContext(ctx).Model(&entity.Inventory{}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ?", key.ProductID, key.SkuID, key.WarehouseID).
+		Updates(map[string]interface{}{
+			"backorder_limit": limit,
+			"version":         gorm.Expr("version + 1"),
+			"updated_at":      time.Now(),
+		})
+	if res.Error != nil {
+		r.logger.Error("Failed to set backorder limit",
+			zap.Int64("product_id", key.ProductID),
+			zap.Int64("sku_id", key.SkuID),
+			zap.Int("warehouse_id", key.WarehouseID),
+			zap.Int("limit", limit),
+			zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	r.logger.Info("Backorder limit updated",
+		zap.Int64("product_id", key.ProductID),
+		zap.Int64("sku_id", key.SkuID),
+		zap.Int("warehouse_id", key.WarehouseID),
+		zap.Int("limit", limit),
+		zap.String("operator", operator))
+
+	if err := r.cache.DeleteInventory(ctx, key.ProductID, key.SkuID, key.WarehouseID); err != nil {
+		r.logger.Warn("Failed to delete inventory cache",
+			zap.Int64("product_id", key.ProductID),
+			zap.Int64("sku_id", key.SkuID),
+			zap.Int("warehouse_id", key.WarehouseID),
+			zap.Error(err))
+	}
+
+	return nil
+}
+
+// ListBackorders 按排队顺序分页查询缺货预订
+func (r *InventoryRepositoryImpl) ListBackorders(ctx context.Context, filter *BackorderFilter, page, pageSize int) ([]*entity.InventoryBackorder, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entity.InventoryBackorder{})
+	if filter != nil {
+		if filter.OrderSN != "" {
+			query = query.Where("order_sn = ?", filter.OrderSN)
+		}
+		if filter.ProductID > 0 {
+			query = query.Where("goods = ?", filter.ProductID)
+		}
+		if filter.WarehouseID > 0 {
+			query = query.Where("warehouse_id = ?", filter.WarehouseID)
+		}
+		if filter.Status > 0 {
+			query = query.Where("status = ?", filter.Status)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.Error("Failed to count backorders", zap.Error(err))
+		return nil, 0, err
+	}
+
+	var backorders []*entity.InventoryBackorder
+	if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&backorders).Error; err != nil {
+		r.logger.Error("Failed to list backorders", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return backorders, total, nil
+}
+
+// ListBackorderedInventories 按ID顺序分页获取有排队预订的库存记录，afterID为上一页最后一条记录的ID
+func (r *InventoryRepositoryImpl) ListBackorderedInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	if err := r.db.WithContext(ctx).
+		Where("id > ? AND backorder_stocks > 0", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&inventories).Error; err != nil {
+		r.logger.Error("Failed to list backordered inventories", zap.Error(err))
+		return nil, err
+	}
+	return inventories, nil
+}
+
+// FulfillBackorders 将库存记录的可用库存按排队顺序分配给预订，转为对应订单的锁定明细，返回本次有到货的预订。
+// 每个预订在单独的事务中处理，与扣减和归还一样先锁定锁定记录再锁定库存记录；可用库存用完时停止
+func (r *InventoryRepositoryImpl) FulfillBackorders(ctx context.Context, key valueobject.StockKey) ([]*entity.InventoryBackorder, error) {
+	var queued []*entity.InventoryBackorder
+	if err := r.db.WithContext(ctx).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND status = ?", key.ProductID, key.SkuID, key.WarehouseID, entity.BackorderQueued).
+		Order("id ASC").
+		Find(&queued).Error; err != nil {
+		return nil, err
+	}
+
+	fulfilled := make([]*entity.InventoryBackorder, 0, len(queued))
+	for _, candidate := range queued {
+		backorder, exhausted, err := r.fulfillBackorder(ctx, candidate)
+		if err != nil {
+			r.logger.Error("Failed to fulfill backorder",
+				zap.Int64("backorder_id", candidate.ID),
+				zap.String("order_sn", candidate.OrderSN),
+				zap.Error(err))
+			return fulfilled, err
+		}
+		if backorder != nil {
+			fulfilled = append(fulfilled, backorder)
+			r.logger.Info("Backorder fulfilled",
+				zap.Int64("backorder_id", backorder.ID),
+				zap.String("order_sn", backorder.OrderSN),
+				zap.Int("fulfilled", backorder.Fulfilled),
+				zap.Int("remaining", backorder.Remaining()))
+		}
+		if exhausted {
+			break
+		}
+	}
+
+	if len(fulfilled) > 0 {
+		if err := r.cache.DeleteInventory(ctx, key.ProductID, key.SkuID, key.WarehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache",
+				zap.Int64("product_id", key.ProductID),
+				zap.Int64("sku_id", key.SkuID),
+				zap.Int("warehouse_id", key.WarehouseID),
+				zap.Error(err))
+		}
+	}
+
+	return fulfilled, nil
+}
+
+// fulfillBackorder 将可用库存分配给单个预订，返回有到货时更新后的预订；exhausted为true表示已没有可用库存。
+// 预订已被取消或订单锁定已过期时跳过，过期的订单由超时释放任务取消预订
+func (r *InventoryRepositoryImpl) fulfillBackorder(ctx context.Context, candidate *entity.InventoryBackorder) (*entity.InventoryBackorder, bool, error) {
+	var result *entity.InventoryBackorder
+	exhausted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var detail entity.StockSellDetail
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_sn = ?", candidate.OrderSN).
+			First(&detail).Error; err != nil {
+			return err
+		}
+		if detail.Status != entity.StockLocked || detail.IsExpired(now) {
+			return nil
+		}
+
+		var backorder entity.InventoryBackorder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", candidate.ID, entity.BackorderQueued).
+			First(&backorder).Error; err != nil {
+			return err
+		}
+
+		key := &entity.Inventory{ProductID: backorder.ProductID, SkuID: backorder.SkuID, WarehouseID: backorder.WarehouseID}
+		lots, err := loadLots(tx, key)
+		if err != nil {
+			return err
+		}
+		var inv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", backorder.ProductID, backorder.SkuID, backorder.WarehouseID).
+			First(&inv).Error; err != nil {
+			return err
+		}
+
+		// 排队数量正是为预订保留的，分配给预订时不扣除
+		queuedInv := inv
+		queuedInv.BackorderStock = 0
+		available := lockableStock(&queuedInv, nil, lots, now)
+		quantity := min(backorder.Remaining(), available)
+		if quantity == 0 {
+			exhausted = true
+			return nil
+		}
+		exhausted = quantity == available
+
+		// 锁定到货的数量，并从排队数量中扣除
+		lines, err := r.lockLots(tx, &valueobject.StockOperation{
+			ProductID:   backorder.ProductID,
+			SkuID:       backorder.SkuID,
+			WarehouseID: backorder.WarehouseID,
+			Quantity:    quantity,
+			OrderSN:     backorder.OrderSN,
+		}, lots, quantity, now)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.Inventory{}).
+			Where("id = ?", inv.ID).
+			Updates(map[string]interface{}{
+				"lock_stocks":      gorm.Expr("lock_stocks + ?", quantity),
+				"backorder_stocks": gorm.Expr("GREATEST(backorder_stocks - ?, 0)", quantity),
+				"version":          inv.Version + 1,
+				"updated_at":       now,
+			}).Error; err != nil {
+			return err
+		}
+
+		backorder.Fulfilled += quantity
+		backorderUpdates := map[string]interface{}{
+			"fulfilled":  backorder.Fulfilled,
+			"updated_at": now,
+		}
+		if backorder.Remaining() == 0 {
+			backorder.Status = entity.BackorderFulfilled
+			backorder.FulfilledAt = &now
+			backorderUpdates["status"] = backorder.Status
+			backorderUpdates["fulfilled_at"] = now
+		}
+		if err := tx.Model(&entity.InventoryBackorder{}).
+			Where("id = ?", backorder.ID).
+			Updates(backorderUpdates).Error; err != nil {
+			return err
+		}
+
+		// 到货的数量追加为订单的锁定明细，之后与普通锁定一样扣减或归还
+		detail.DetailItems = append(detail.DetailItems, lines...)
+		detail.Backordered = max(detail.Backordered-quantity, 0)
+		detail.RefreshStatus()
+		data, err := json.Marshal(detail.DetailItems)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.StockSellDetail{}).
+			Where("id = ?", detail.ID).
+			Updates(map[string]interface{}{
+				"detail":        string(data),
+				"backorder_num": detail.Backordered,
+				"status":        detail.Status,
+				"updated_at":    now,
+			}).Error; err != nil {
+			return err
+		}
+
+		histories := make([]*entity.InventoryHistory, 0, len(lines)+1)
+		for _, line := range lines {
+			histories = append(histories, &entity.InventoryHistory{
+				ProductID:   line.ProductID,
+				SkuID:       line.SkuID,
+				WarehouseID: line.WarehouseID,
+				Quantity:    line.Quantity,
+				Operation:   entity.OperationLock,
+				OrderSN:     backorder.OrderSN,
+				LotNo:       line.LotNo,
+				Remark:      "Backorder fulfilled",
+				CreatedAt:   now,
+			})
+		}
+		histories = append(histories, &entity.InventoryHistory{
+			ProductID:   backorder.ProductID,
+			SkuID:       backorder.SkuID,
+			WarehouseID: backorder.WarehouseID,
+			Quantity:    -quantity,
+			Operation:   entity.OperationBackorder,
+			OrderSN:     backorder.OrderSN,
+			Remark:      "Backorder fulfilled",
+			CreatedAt:   now,
+		})
+		if err := tx.Create(histories).Error; err != nil {
+			return err
+		}
+
+		result = &backorder
+		return appendOutboxEvent(tx, backorder.OrderSN, &entity.StockEvent{
+			EventType:  entity.EventBackorderFulfilled,
+			OrderSN:    backorder.OrderSN,
+			Items:      toStockEventItems(lines),
+			OccurredAt: now,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 预订已被取消或订单锁定记录不存在，跳过
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return result, exhausted, nil
+}
+
+// queueBackorder 在锁定事务中为缺货的数量创建排队预订，库存记录的预订数量已在锁定时增加
+func queueBackorder(tx *gorm.DB, orderSN string, item *valueobject.StockOperation, quantity int, now time.Time) (*entity.InventoryBackorder, error) {
+	backorder := &entity.InventoryBackorder{
+		OrderSN:     orderSN,
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: item.WarehouseID,
+		Quantity:    quantity,
+		Status:      entity.BackorderQueued,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Create(backorder).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&entity.InventoryHistory{
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: item.WarehouseID,
+		Quantity:    quantity,
+		Operation:   entity.OperationBackorder,
+		OrderSN:     orderSN,
+		Operator:    item.Operator,
+		Remark:      "Backorder queued",
+		CreatedAt:   now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return backorder, nil
+}
+
+// cancelBackorders 在归还事务中取消订单排队中的预订，释放库存记录的预订数量，返回被取消的预订
+func cancelBackorders(tx *gorm.DB, orderSN string, now time.Time) ([]*entity.InventoryBackorder, error) {
+	var backorders []*entity.InventoryBackorder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_sn = ? AND status = ?", orderSN, entity.BackorderQueued).
+		Order("id ASC").
+		Find(&backorders).Error; err != nil {
+		return nil, err
+	}
+
+	for _, backorder := range backorders {
+		remaining := backorder.Remaining()
+		if err := tx.Model(&entity.InventoryBackorder{}).
+			Where("id = ?", backorder.ID).
+			Updates(map[string]interface{}{
+				"status":     entity.BackorderCancelled,
+				"updated_at": now,
+			}).Error; err != nil {
+			return nil, err
+		}
+		backorder.Status = entity.BackorderCancelled
+
+		if err := tx.Model(&entity.Inventory{}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", backorder.ProductID, backorder.SkuID, backorder.WarehouseID).
+			Updates(map[string]interface{}{
+				"backorder_stocks": gorm.Expr("GREATEST(backorder_stocks - ?, 0)", remaining),
+				"version":          gorm.Expr("version + 1"),
+				"updated_at":       now,
+			}).Error; err != nil {
+			return nil, err
+		}
+
+		if err := tx.Create(&entity.InventoryHistory{
+			ProductID:   backorder.ProductID,
+			SkuID:       backorder.SkuID,
+			WarehouseID: backorder.WarehouseID,
+			Quantity:    -remaining,
+			Operation:   entity.OperationBackorder,
+			OrderSN:     orderSN,
+			Remark:      "Backorder cancelled",
+			CreatedAt:   now,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(backorders) == 0 {
+		return backorders, nil
+	}
+	return backorders, appendOutboxEvent(tx, orderSN, &entity.StockEvent{
+		EventType:  entity.EventBackorderCancelled,
+		OrderSN:    orderSN,
+		Items:      toBackorderEventItems(backorders),
+		OccurredAt: now,
+	})
+}
+
+// queuedBackorders 查询订单排队中的预订
+func queuedBackorders(db *gorm.DB, orderSN string) ([]*entity.InventoryBackorder, error) {
+	var backorders []*entity.InventoryBackorder
+	err := db.Where("order_sn = ? AND status = ?", orderSN, entity.BackorderQueued).
+		Order("id ASC").
+		Find(&backorders).Error
+	return backorders, err
+}
+
+// toBackorderedItems 将预订转换为锁定结果中的预订项，数量为尚未到货的数量
+func toBackorderedItems(backorders []*entity.InventoryBackorder) []*valueobject.StockOperation {
+	items := make([]*valueobject.StockOperation, 0, len(backorders))
+	for _, backorder := range backorders {
+		items = append(items, &valueobject.StockOperation{
+			ProductID:   backorder.ProductID,
+			SkuID:       backorder.SkuID,
+			WarehouseID: backorder.WarehouseID,
+			Quantity:    backorder.Remaining(),
+			OrderSN:     backorder.OrderSN,
+		})
+	}
+	return items
+}
+
+// toBackorderEventItems 将预订转换为事件明细，数量为尚未到货的数量
+func toBackorderEventItems(backorders []*entity.InventoryBackorder) []*entity.StockEventItem {
+	items := make([]*entity.StockEventItem, 0, len(backorders))
+	for _, backorder := range backorders {
+		items = append(items, &entity.StockEventItem{
+			ProductID:   backorder.ProductID,
+			SkuID:       backorder.SkuID,
+			WarehouseID: backorder.WarehouseID,
+			Quantity:    backorder.Remaining(),
+		})
+	}
+	return items
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+// errBundleUnavailable 套装有组件无法锁定，用于回滚套装的保存点
+var errBundleUnavailable = errors.New("bundle component unavailable")
+
+// GetBundles 查询商品中的套装定义，不是套装的商品不返回
+func (r *InventoryRepositoryImpl) GetBundles(ctx context.Context, productIDs []int64) ([]*entity.InventoryBundle, error) {
+	var bundles []*entity.InventoryBundle
+	if len(productIDs) == 0 {
+		return bundles, nil
+	}
+	if err := r.db.WithContext(ctx).Where("goods IN ?", productIDs).Find(&bundles).Error; err != nil {
+		r.logger.Error("Failed to get bundles",
+			zap.Int64s("product_ids", productIDs),
+			zap.Error(err))
+		return nil, err
+	}
+	return bundles, nil
+}
+
+// SaveBundle 创建或更新套装定义，已锁定的订单按锁定时的组件扣减和归还，不受修改影响
+func (r *InventoryRepositoryImpl) SaveBundle(ctx context.Context, bundle *entity.InventoryBundle) error {
+	now := time.Now()
+	bundle.CreatedAt = now
+	bundle.UpdatedAt = now
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "goods"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "detail", "operator", "updated_at"}),
+	}).Create(bundle).Error
+	if err != nil {
+		r.logger.Error("Failed to save bundle",
+			zap.Int64("bundle_id", bundle.ProductID),
+			zap.Error(err))
+		return err
+	}
+
+	r.logger.Info("Bundle saved",
+		zap.Int64("bundle_id", bundle.ProductID),
+		zap.Int("components", len(bundle.Components)),
+		zap.String("operator", bundle.Operator))
+	return nil
+}
+
+// DeleteBundle 删除套装定义，已锁定的订单仍可按套装扣减和归还
+func (r *InventoryRepositoryImpl) DeleteBundle(ctx context.Context, productID int64) error {
+	res := r.db.WithContext(ctx).Where("goods = ?", productID).Delete(&entity.InventoryBundle{})
+	if res.Error != nil {
+		r.logger.Error("Failed to delete bundle",
+			zap.Int64("bundle_id", productID),
+			zap.Error(res.Error))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// lockBundle 在保存点内依次锁定套装的组件，返回每个组件锁定的明细行。任一组件不足时回滚到保存点，
+// 已锁定的组件一并撤销，返回套装的失败项。套装组件不按可用数量部分锁定，也不排队预订
+func (r *InventoryRepositoryImpl) lockBundle(tx *gorm.DB, components []*valueobject.StockOperation, opts valueobject.LockOptions) ([][]*entity.StockDetail, *valueobject.LockFailItem, error) {
+	opts.AllowPartialQuantity = false
+	opts.AllowBackorder = false
+
+	var failItem *valueobject.LockFailItem
+	componentLines := make([][]*entity.StockDetail, 0, len(components))
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		for _, component := range components {
+			lines, _, componentFail, err := r.lockItem(tx, component, opts)
+			if err != nil {
+				return err
+			}
+			if componentFail != nil {
+				failItem = bundleFailItem(component, componentFail)
+				return errBundleUnavailable
+			}
+			componentLines = append(componentLines, lines)
+		}
+		return nil
+	})
+	if errors.Is(err, errBundleUnavailable) {
+		return nil, failItem, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return componentLines, nil, nil
+}
+
+// bundleGroup 返回items开头同一套装同一仓库的相邻组件项
+func bundleGroup(items []*valueobject.StockOperation) []*valueobject.StockOperation {
+	n := 1
+	for n < len(items) && items[n].BundleID == items[0].BundleID && items[n].WarehouseID == items[0].WarehouseID {
+		n++
+	}
+	return items[:n]
+}
+
+// containsBundle 判断锁定项中是否有套装组件
+func containsBundle(items []*valueobject.StockOperation) bool {
+	for _, item := range items {
+		if item.BundleID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleFailItem 将组件的失败项转换为套装的失败项，数量按套数计算，可用数量为该组件能组成的套数
+func bundleFailItem(component *valueobject.StockOperation, componentFail *valueobject.LockFailItem) *valueobject.LockFailItem {
+	unit := max(component.BundleUnit, 1)
+	return &valueobject.LockFailItem{
+		ProductID:   component.BundleID,
+		WarehouseID: component.WarehouseID,
+		Quantity:    component.Quantity / unit,
+		Available:   componentFail.Available / unit,
+		Code:        componentFail.Code,
+		Reason:      fmt.Sprintf("Bundle component %d: %s", component.ProductID, componentFail.Reason),
+	}
+}
+
+// hasBundleLines 判断订单中是否有作为该套装组件锁定的明细行
+func hasBundleLines(detail *entity.StockSellDetail, bundleID int64) bool {
+	for _, item := range detail.DetailItems {
+		if item.BundleID == bundleID {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateBundleLine 将按套数请求的扣减或归还分摊到套装组件的锁定明细行。仓库ID为0时按明细顺序逐个仓库分摊，
+// 每个仓库处理的套数不超过该仓库各组件剩余锁定数量能组成的套数
+func allocateBundleLine(detail *entity.StockSellDetail, line *entity.StockDetail, allocated map[*entity.StockDetail]int) error {
+	// 按仓库归集各组件的明细行，组件每套的数量以锁定时为准
+	type componentLines struct {
+		unit  int
+		items []*entity.StockDetail
+	}
+	warehouseIDs := make([]int, 0, 1)
+	components := make(map[int]map[stockKey]*componentLines)
+	for _, item := range detail.DetailItems {
+		if item.BundleID != line.ProductID || (line.WarehouseID != 0 && item.WarehouseID != line.WarehouseID) {
+			continue
+		}
+		byKey, ok := components[item.WarehouseID]
+		if !ok {
+			byKey = make(map[stockKey]*componentLines)
+			components[item.WarehouseID] = byKey
+			warehouseIDs = append(warehouseIDs, item.WarehouseID)
+		}
+		key := stockKey{item.ProductID, item.SkuID, item.WarehouseID}
+		if byKey[key] == nil {
+			byKey[key] = &componentLines{unit: max(item.BundleUnit, 1)}
+		}
+		byKey[key].items = append(byKey[key].items, item)
+	}
+
+	remaining := line.Quantity
+	for _, warehouseID := range warehouseIDs {
+		if remaining == 0 {
+			break
+		}
+
+		units := remaining
+		for _, component := range components[warehouseID] {
+			free := 0
+			for _, item := range component.items {
+				free += item.Remaining() - allocated[item]
+			}
+			units = min(units, free/component.unit)
+		}
+		if units <= 0 {
+			continue
+		}
+
+		for _, component := range components[warehouseID] {
+			need := units * component.unit
+			for _, item := range component.items {
+				if need == 0 {
+					break
+				}
+				quantity := min(item.Remaining()-allocated[item], need)
+				if quantity <= 0 {
+					continue
+				}
+				allocated[item] += quantity
+				need -= quantity
+			}
+		}
+		remaining -= units
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("%w: bundle %d warehouse %d", ErrExceedLockedQuantity, line.ProductID, line.WarehouseID)
+	}
+	return nil
+}
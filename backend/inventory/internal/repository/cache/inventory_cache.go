@@ -10,18 +10,19 @@ import (
 	"go.uber.org/zap"
 	
 	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
 )
 
 // InventoryCache 库存缓存接口
 type InventoryCache interface {
-	// 获取商品库存
-	GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error)
-	// 批量获取库存，返回找到的库存和缺失的ID
-	BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, []int64)
+	// 获取商品库存，skuID为0表示商品级库存
+	GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error)
+	// 批量获取库存，返回找到的库存和缺失的库存单元
+	BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, []valueobject.SkuKey)
 	// 设置库存缓存
 	SetInventory(ctx context.Context, inventory *entity.Inventory) error
 	// 删除库存缓存
-	DeleteInventory(ctx context.Context, productID int64, warehouseID int) error
+	DeleteInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) error
 }
 
 const (
@@ -52,14 +53,17 @@ func NewRedisInventoryCache(client *redis.Client, logger *zap.Logger, ttlSeconds
 	}
 }
 
-// 构建库存缓存键
-func buildInventoryKey(productID int64, warehouseID int) string {
-	return fmt.Sprintf("%s%d:%d", inventoryKeyPrefix, productID, warehouseID)
+// 构建库存缓存键，商品级库存沿用不含SKU的键，升级前写入的缓存仍然有效
+func buildInventoryKey(productID int64, skuID int64, warehouseID int) string {
+	if skuID == 0 {
+		return fmt.Sprintf("%s%d:%d", inventoryKeyPrefix, productID, warehouseID)
+	}
+	return fmt.Sprintf("%s%d:%d:%d", inventoryKeyPrefix, productID, warehouseID, skuID)
 }
 
 // GetInventory 从Redis获取库存
-func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error) {
-	key := buildInventoryKey(productID, warehouseID)
+func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error) {
+	key := buildInventoryKey(productID, skuID, warehouseID)
 	data, err := c.client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
@@ -68,6 +72,7 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 		}
 		c.logger.Warn("Failed to get inventory from Redis",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID),
 			zap.Error(err))
 		return nil, err
@@ -77,6 +82,7 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 	if err := json.Unmarshal(data, &inventory); err != nil {
 		c.logger.Error("Failed to unmarshal inventory data",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID),
 			zap.Error(err))
 		return nil, err
@@ -86,15 +92,15 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 }
 
 // BatchGetInventory 批量获取库存
-func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, []int64) {
-	if len(productIDs) == 0 {
-		return []*entity.Inventory{}, []int64{}
+func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, skuKeys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, []valueobject.SkuKey) {
+	if len(skuKeys) == 0 {
+		return []*entity.Inventory{}, []valueobject.SkuKey{}
 	}
 	
 	// 批量构建缓存键
-	keys := make([]string, 0, len(productIDs))
-	for _, productID := range productIDs {
-		keys = append(keys, buildInventoryKey(productID, warehouseID))
+	keys := make([]string, 0, len(skuKeys))
+	for _, skuKey := range skuKeys {
+		keys = append(keys, buildInventoryKey(skuKey.ProductID, skuKey.SkuID, warehouseID))
 	}
 	
 	// 批量获取缓存数据
@@ -111,29 +117,30 @@ func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, productIDs
 	}
 	
 	// 处理结果
-	inventories := make([]*entity.Inventory, 0, len(productIDs))
-	missingIDs := make([]int64, 0)
+	inventories := make([]*entity.Inventory, 0, len(skuKeys))
+	missingKeys := make([]valueobject.SkuKey, 0)
 	
 	for i, cmd := range cmds {
 		data, err := cmd.Bytes()
 		if err != nil {
-			missingIDs = append(missingIDs, productIDs[i])
+			missingKeys = append(missingKeys, skuKeys[i])
 			continue
 		}
 		
 		var inventory entity.Inventory
 		if err := json.Unmarshal(data, &inventory); err != nil {
 			c.logger.Error("Failed to unmarshal inventory data",
-				zap.Int64("product_id", productIDs[i]),
+				zap.Int64("product_id", skuKeys[i].ProductID),
+				zap.Int64("sku_id", skuKeys[i].SkuID),
 				zap.Error(err))
-			missingIDs = append(missingIDs, productIDs[i])
+			missingKeys = append(missingKeys, skuKeys[i])
 			continue
 		}
 		
 		inventories = append(inventories, &inventory)
 	}
 	
-	return inventories, missingIDs
+	return inventories, missingKeys
 }
 
 // SetInventory 设置库存缓存
@@ -146,16 +153,18 @@ func (c *RedisInventoryCache) SetInventory(ctx context.Context, inventory *entit
 	if err != nil {
 		c.logger.Error("Failed to marshal inventory data",
 			zap.Int64("product_id", inventory.ProductID),
+			zap.Int64("sku_id", inventory.SkuID),
 			zap.Int("warehouse_id", inventory.WarehouseID),
 			zap.Error(err))
 		return err
 	}
 	
-	key := buildInventoryKey(inventory.ProductID, inventory.WarehouseID)
+	key := buildInventoryKey(inventory.ProductID, inventory.SkuID, inventory.WarehouseID)
 	err = c.client.Set(ctx, key, data, c.cacheTTL).Err()
 	if err != nil {
 		c.logger.Error("Failed to set inventory cache",
 			zap.Int64("product_id", inventory.ProductID),
+			zap.Int64("sku_id", inventory.SkuID),
 			zap.Int("warehouse_id", inventory.WarehouseID),
 			zap.Error(err))
 		return err
@@ -165,12 +174,13 @@ func (c *RedisInventoryCache) SetInventory(ctx context.Context, inventory *entit
 }
 
 // DeleteInventory 删除库存缓存
-func (c *RedisInventoryCache) DeleteInventory(ctx context.Context, productID int64, warehouseID int) error {
-	key := buildInventoryKey(productID, warehouseID)
+func (c *RedisInventoryCache) DeleteInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) error {
+	key := buildInventoryKey(productID, skuID, warehouseID)
 	err := c.client.Del(ctx, key).Err()
 	if err != nil {
 		c.logger.Warn("Failed to delete inventory cache",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID),
 			zap.Error(err))
 		return err
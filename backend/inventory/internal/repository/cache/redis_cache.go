@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 	
 	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
 )
 
 const (
@@ -21,10 +22,10 @@ const (
 
 // InventoryCache 库存缓存接口
 type InventoryCache interface {
-	GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error)
+	GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error)
 	SetInventory(ctx context.Context, inventory *entity.Inventory) error
-	BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, []int64) // 返回结果和缓存未命中的ID
-	DeleteInventory(ctx context.Context, productID int64, warehouseID int) error
+	BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, []valueobject.SkuKey) // 返回结果和缓存未命中的库存单元
+	DeleteInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) error
 }
 
 // RedisInventoryCache Redis实现的库存缓存
@@ -42,13 +43,16 @@ func NewRedisInventoryCache(client *redis.Client, logger *zap.Logger) InventoryC
 }
 
 // getCacheKey 生成缓存键
-func (c *RedisInventoryCache) getCacheKey(productID int64, warehouseID int) string {
-	return fmt.Sprintf("%s%d:%d", inventoryCacheKeyPrefix, productID, warehouseID)
+func (c *RedisInventoryCache) getCacheKey(productID int64, skuID int64, warehouseID int) string {
+	if skuID == 0 {
+		return fmt.Sprintf("%s%d:%d", inventoryCacheKeyPrefix, productID, warehouseID)
+	}
+	return fmt.Sprintf("%s%d:%d:%d", inventoryCacheKeyPrefix, productID, warehouseID, skuID)
 }
 
 // GetInventory 从缓存获取库存
-func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error) {
-	key := c.getCacheKey(productID, warehouseID)
+func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error) {
+	key := c.getCacheKey(productID, skuID, warehouseID)
 	data, err := c.client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
@@ -57,6 +61,7 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 		c.logger.Error("Failed to get inventory from redis", 
 			zap.Error(err), 
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID),
 			zap.String("key", key))
 		return nil, err
@@ -67,6 +72,7 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 		c.logger.Error("Failed to unmarshal inventory from redis", 
 			zap.Error(err), 
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID))
 		return nil, err
 	}
@@ -76,7 +82,7 @@ func (c *RedisInventoryCache) GetInventory(ctx context.Context, productID int64,
 
 // SetInventory 缓存库存信息
 func (c *RedisInventoryCache) SetInventory(ctx context.Context, inventory *entity.Inventory) error {
-	key := c.getCacheKey(inventory.ProductID, inventory.WarehouseID)
+	key := c.getCacheKey(inventory.ProductID, inventory.SkuID, inventory.WarehouseID)
 	data, err := json.Marshal(inventory)
 	if err != nil {
 		c.logger.Error("Failed to marshal inventory for redis", 
@@ -99,18 +105,18 @@ func (c *RedisInventoryCache) SetInventory(ctx context.Context, inventory *entit
 }
 
 // BatchGetInventory 批量获取库存信息
-func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, []int64) {
+func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, []valueobject.SkuKey) {
 	var inventories []*entity.Inventory
-	var missingIDs []int64
+	var missingKeys []valueobject.SkuKey
 	
 	// 创建管道批量操作
 	pipe := c.client.Pipeline()
-	commands := make(map[int64]*redis.StringCmd)
+	commands := make(map[valueobject.SkuKey]*redis.StringCmd)
 	
 	// 构建批量查询
-	for _, productID := range productIDs {
-		key := c.getCacheKey(productID, warehouseID)
-		commands[productID] = pipe.Get(ctx, key)
+	for _, skuKey := range keys {
+		key := c.getCacheKey(skuKey.ProductID, skuKey.SkuID, warehouseID)
+		commands[skuKey] = pipe.Get(ctx, key)
 	}
 	
 	// 执行管道
@@ -118,15 +124,15 @@ func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, productIDs
 	if err != nil && err != redis.Nil {
 		c.logger.Error("Failed to execute redis pipeline for batch get inventory", 
 			zap.Error(err))
-		// 如果Redis失败，所有ID都需要从数据库查询
-		return []*entity.Inventory{}, productIDs
+		// 如果Redis失败，所有库存单元都需要从数据库查询
+		return []*entity.Inventory{}, keys
 	}
 	
 	// 处理结果
-	for productID, cmd := range commands {
+	for skuKey, cmd := range commands {
 		data, err := cmd.Bytes()
 		if err != nil {
-			missingIDs = append(missingIDs, productID)
+			missingKeys = append(missingKeys, skuKey)
 			continue
 		}
 		
@@ -134,25 +140,27 @@ func (c *RedisInventoryCache) BatchGetInventory(ctx context.Context, productIDs
 		if err := json.Unmarshal(data, &inventory); err != nil {
 			c.logger.Error("Failed to unmarshal inventory from redis", 
 				zap.Error(err), 
-				zap.Int64("product_id", productID),
+				zap.Int64("product_id", skuKey.ProductID),
+				zap.Int64("sku_id", skuKey.SkuID),
 				zap.Int("warehouse_id", warehouseID))
-			missingIDs = append(missingIDs, productID)
+			missingKeys = append(missingKeys, skuKey)
 			continue
 		}
 		
 		inventories = append(inventories, &inventory)
 	}
 	
-	return inventories, missingIDs
+	return inventories, missingKeys
 }
 
 // DeleteInventory 删除库存缓存
-func (c *RedisInventoryCache) DeleteInventory(ctx context.Context, productID int64, warehouseID int) error {
-	key := c.getCacheKey(productID, warehouseID)
+func (c *RedisInventoryCache) DeleteInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) error {
+	key := c.getCacheKey(productID, skuID, warehouseID)
 	if err := c.client.Del(ctx, key).Err(); err != nil {
 		c.logger.Error("Failed to delete inventory from redis", 
 			zap.Error(err), 
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID),
 			zap.String("key", key))
 		return err
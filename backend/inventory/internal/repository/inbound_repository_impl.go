@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+var (
+	// ErrInvalidInboundStatus 入库单状态不允许当前操作
+	ErrInvalidInboundStatus = errors.New("invalid inbound status")
+	// ErrInboundItemNotFound 收货商品不在入库单中
+	ErrInboundItemNotFound = errors.New("inbound item not found")
+	// ErrReceiptConflict 收货单号已被其他入库单使用
+	ErrReceiptConflict = errors.New("receipt sn belongs to another inbound order")
+)
+
+// InboundRepositoryImpl 采购入库单仓储实现
+type InboundRepositoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewInboundRepository 创建采购入库单仓储
+func NewInboundRepository(db *gorm.DB, logger *zap.Logger) InboundRepository {
+	return &InboundRepositoryImpl{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateInbound 创建入库单
+func (r *InboundRepositoryImpl) CreateInbound(ctx context.Context, order *entity.InboundOrder) error {
+	now := time.Now()
+	order.Status = entity.InboundCreated
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	if err := r.db.WithContext(ctx).Create(order).Error; err != nil {
+		r.logger.Error("Failed to create inbound",
+			zap.Error(err),
+			zap.String("inbound_sn", order.InboundSN))
+		return err
+	}
+
+	return nil
+}
+
+// RecordReceipt 登记收货，累加入库单的已收数量并创建待入账的收货单。
+// 收货单号已存在时直接返回已有的收货单，便于调用方重试入账
+func (r *InboundRepositoryImpl) RecordReceipt(ctx context.Context, receipt *entity.InboundReceipt) (*entity.InboundReceipt, error) {
+	var recorded *entity.InboundReceipt
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing entity.InboundReceipt
+		err := tx.Where("receipt_sn = ?", receipt.ReceiptSN).First(&existing).Error
+		if err == nil {
+			if existing.InboundSN != receipt.InboundSN {
+				return ErrReceiptConflict
+			}
+			recorded = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// 锁定入库单，避免并发收货互相覆盖已收数量
+		var order entity.InboundOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("inbound_sn = ?", receipt.InboundSN).
+			First(&order).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if !order.CanReceive() {
+			return ErrInvalidInboundStatus
+		}
+
+		for _, line := range receipt.Items {
+			item := order.FindItem(line.ProductID, line.SkuID)
+			if item == nil {
+				return ErrInboundItemNotFound
+			}
+			item.Received += line.Quantity
+		}
+
+		status := entity.InboundPartial
+		if order.IsFullyReceived() {
+			status = entity.InboundReceived
+		}
+		if err := order.BeforeSave(tx); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&entity.InboundOrder{}).
+			Where("id = ?", order.ID).
+			Updates(map[string]interface{}{
+				"detail":     order.Detail,
+				"status":     status,
+				"updated_at": now,
+			}).Error; err != nil {
+			return err
+		}
+
+		receipt.WarehouseID = order.WarehouseID
+		receipt.Posted = false
+		receipt.CreatedAt = now
+		receipt.UpdatedAt = now
+		if err := tx.Create(receipt).Error; err != nil {
+			return err
+		}
+
+		recorded = receipt
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to record inbound receipt",
+			zap.Error(err),
+			zap.String("inbound_sn", receipt.InboundSN),
+			zap.String("receipt_sn", receipt.ReceiptSN))
+		return nil, err
+	}
+
+	return recorded, nil
+}
+
+// MarkReceiptItemPosted 标记收货明细已入账，全部明细入账后收货单完成
+func (r *InboundRepositoryImpl) MarkReceiptItemPosted(ctx context.Context, receiptSN string, productID int64, skuID int64, lotNo string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var receipt entity.InboundReceipt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("receipt_sn = ?", receiptSN).
+			First(&receipt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+
+		posted := true
+		for _, item := range receipt.Items {
+			if item.ProductID == productID && item.SkuID == skuID && item.LotNo == lotNo {
+				item.Posted = true
+			}
+			posted = posted && item.Posted
+		}
+		if err := receipt.BeforeSave(tx); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"detail":     receipt.Detail,
+			"posted":     posted,
+			"updated_at": now,
+		}
+		if posted {
+			updates["post_time"] = now
+		}
+		return tx.Model(&entity.InboundReceipt{}).Where("id = ?", receipt.ID).Updates(updates).Error
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to mark receipt item posted",
+			zap.Error(err),
+			zap.String("receipt_sn", receiptSN),
+			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
+			zap.String("lot_no", lotNo))
+		return err
+	}
+
+	return nil
+}
+
+// HasStockIn 判断收货明细是否已经写入过入库流水，用于入账中断后重试时避免重复增加库存
+func (r *InboundRepositoryImpl) HasStockIn(ctx context.Context, receiptSN string, productID int64, skuID int64, warehouseID int, lotNo string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.InventoryHistory{}).
+		Where("order_sn = ? AND goods = ? AND sku_id = ? AND warehouse_id = ? AND lot_no = ? AND operation_type = ?",
+			receiptSN, productID, skuID, warehouseID, lotNo, entity.OperationIncrease).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// CloseInbound 关闭入库单，未收齐的数量不再收货
+func (r *InboundRepositoryImpl) CloseInbound(ctx context.Context, inboundSN string, operator string, reason string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     entity.InboundClosed,
+		"close_time": now,
+		"updated_at": now,
+	}
+	if reason != "" {
+		updates["remark"] = reason
+	}
+
+	res := r.db.WithContext(ctx).Model(&entity.InboundOrder{}).
+		Where("inbound_sn = ? AND status IN ?", inboundSN, []entity.InboundStatus{entity.InboundCreated, entity.InboundPartial}).
+		Updates(updates)
+	if res.Error != nil {
+		r.logger.Error("Failed to close inbound",
+			zap.Error(res.Error),
+			zap.String("inbound_sn", inboundSN),
+			zap.String("operator", operator))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.GetInbound(ctx, inboundSN); err != nil {
+			return err
+		}
+		return ErrInvalidInboundStatus
+	}
+
+	return nil
+}
+
+// GetInbound 获取入库单
+func (r *InboundRepositoryImpl) GetInbound(ctx context.Context, inboundSN string) (*entity.InboundOrder, error) {
+	var order entity.InboundOrder
+	err := r.db.WithContext(ctx).Where("inbound_sn = ?", inboundSN).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		r.logger.Error("Failed to get inbound",
+			zap.Error(err),
+			zap.String("inbound_sn", inboundSN))
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// ListReceipts 获取入库单的收货记录，按收货时间排序
+func (r *InboundRepositoryImpl) ListReceipts(ctx context.Context, inboundSN string) ([]*entity.InboundReceipt, error) {
+	var receipts []*entity.InboundReceipt
+	err := r.db.WithContext(ctx).
+		Where("inbound_sn = ?", inboundSN).
+		Order("id").
+		Find(&receipts).Error
+	if err != nil {
+		r.logger.Error("Failed to list inbound receipts",
+			zap.Error(err),
+			zap.String("inbound_sn", inboundSN))
+		return nil, err
+	}
+
+	return receipts, nil
+}
@@ -0,0 +1,598 @@
+//go:build integration
+
+// 依赖MySQL和Redis的集成测试与锁定性能基准，INVENTORY_TEST_CONFIG指定配置文件，未设置时跳过：
+//
+//	INVENTORY_TEST_CONFIG=configs/config.test.yaml go test -tags integration ./internal/repository/
+//	INVENTORY_TEST_CONFIG=configs/config.test.yaml go test -tags integration -run '^$' -bench LockStock -benchtime 10000x ./internal/repository/
+//
+// 测试会自动迁移数据表，并清空配置中的Redis库，请使用专用的测试库。
+// 每个测试使用新的商品ID，可以重复运行。
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"shop/backend/inventory/configs"
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository/cache"
+)
+
+const testWarehouseID = 1
+
+var (
+	testEnvOnce sync.Once
+	testDB      *gorm.DB
+	testRedis   *redis.Client
+	testEnvErr  error
+
+	// 每次运行从当前时间开始分配商品ID，订单号带上运行时间，避免与之前运行留下的数据冲突
+	testRunID      = time.Now().Unix()
+	testProductSeq = testRunID % 1000000 * 1000
+	testOrderSeq   int64
+)
+
+// setupTestEnv 连接测试库，同一次运行只迁移和清空一次
+func setupTestEnv(tb testing.TB) (*gorm.DB, *redis.Client) {
+	tb.Helper()
+	configFile := os.Getenv("INVENTORY_TEST_CONFIG")
+	if configFile == "" {
+		tb.Skip("INVENTORY_TEST_CONFIG not set")
+	}
+
+	testEnvOnce.Do(func() {
+		// go test在包目录下运行，相对路径按inventory目录解析
+		if !filepath.IsAbs(configFile) {
+			configFile = filepath.Join("..", "..", configFile)
+		}
+		config, err := configs.LoadConfig(configFile)
+		if err != nil {
+			testEnvErr = err
+			return
+		}
+
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
+			config.Database.User, config.Database.Password, config.Database.Host,
+			config.Database.Port, config.Database.DBName, config.Database.Charset)
+		testDB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			testEnvErr = err
+			return
+		}
+		if err = testDB.AutoMigrate(
+			&entity.Inventory{},
+			&entity.StockSellDetail{},
+			&entity.InventoryHistory{},
+			&entity.InventoryLot{},
+			&entity.InventoryBackorder{},
+			&entity.OutboxEvent{},
+		); err != nil {
+			testEnvErr = err
+			return
+		}
+
+		testRedis = redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", config.Redis.Host, config.Redis.Port),
+			Password: config.Redis.Password,
+			DB:       config.Redis.DB,
+			PoolSize: 200,
+		})
+		testEnvErr = testRedis.FlushDB(context.Background()).Err()
+	})
+	if testEnvErr != nil {
+		tb.Fatalf("Failed to set up test environment: %v", testEnvErr)
+	}
+	return testDB, testRedis
+}
+
+// newTestRepos 创建MySQL仓储和在其上启用快速锁定的Redis仓储
+func newTestRepos(tb testing.TB) (InventoryRepository, *RedisLockRepository) {
+	db, client := setupTestEnv(tb)
+	log := zap.NewNop()
+	dbRepo := NewInventoryRepository(db, cache.NewRedisInventoryCache(client, log, 60), log)
+	return dbRepo, NewRedisLockRepository(dbRepo, NewOutboxRepository(db, log), client, log)
+}
+
+// newTestProduct 分配本次运行中未使用过的商品ID
+func newTestProduct() int64 {
+	return atomic.AddInt64(&testProductSeq, 1)
+}
+
+// testOrderSN 生成本次运行中唯一的订单号，不超过订单号字段的50个字符
+func testOrderSN(suffix string) string {
+	return fmt.Sprintf("TEST-%d-%d-%s", testRunID, atomic.AddInt64(&testOrderSeq, 1), suffix)
+}
+
+// mustSetStock 设置商品的库存数量
+func mustSetStock(tb testing.TB, repo InventoryRepository, productID int64, stock int) {
+	tb.Helper()
+	if err := repo.SetInventory(context.Background(), &entity.Inventory{
+		ProductID:   productID,
+		WarehouseID: testWarehouseID,
+		Stock:       stock,
+	}); err != nil {
+		tb.Fatalf("SetInventory error = %v", err)
+	}
+}
+
+// mustGetInventory 读取商品的库存记录
+func mustGetInventory(tb testing.TB, repo InventoryRepository, productID int64) *entity.Inventory {
+	tb.Helper()
+	inv, err := repo.GetInventory(context.Background(), productID, 0, testWarehouseID)
+	if err != nil {
+		tb.Fatalf("GetInventory error = %v", err)
+	}
+	return inv
+}
+
+// lockOne 锁定单个商品
+func lockOne(repo InventoryRepository, orderSN string, productID int64, quantity int, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	return repo.LockStock(context.Background(), orderSN, []*valueobject.StockOperation{{
+		ProductID:   productID,
+		WarehouseID: testWarehouseID,
+		Quantity:    quantity,
+	}}, nil, opts)
+}
+
+// redisAvailable 读取Redis中的可用库存
+func redisAvailable(tb testing.TB, client *redis.Client, productID int64) int {
+	tb.Helper()
+	v, err := client.Get(context.Background(), buildAvailableKey(productID, 0, testWarehouseID)).Int()
+	if err != nil {
+		tb.Fatalf("Get available stock error = %v", err)
+	}
+	return v
+}
+
+func TestRedisLockScriptAllOrNothing(t *testing.T) {
+	dbRepo, redisRepo := newTestRepos(t)
+	ctx := context.Background()
+	p1, p2 := newTestProduct(), newTestProduct()
+	mustSetStock(t, dbRepo, p1, 5)
+	mustSetStock(t, dbRepo, p2, 1)
+
+	// 商品2不足时整单不锁定，商品1的可用库存不变
+	orderSN := testOrderSN("short")
+	result, err := redisRepo.LockStock(ctx, orderSN, []*valueobject.StockOperation{
+		{ProductID: p1, WarehouseID: testWarehouseID, Quantity: 2},
+		{ProductID: p2, WarehouseID: testWarehouseID, Quantity: 2},
+	}, nil, valueobject.LockOptions{})
+	if err != nil {
+		t.Fatalf("LockStock error = %v", err)
+	}
+	if result.Success || len(result.FailItems) != 1 || result.FailItems[0].ProductID != p2 || result.FailItems[0].Available != 1 {
+		t.Fatalf("LockStock result = %+v, want product %d short with 1 available", result, p2)
+	}
+	if got := redisAvailable(t, redisRepo.client, p1); got != 5 {
+		t.Errorf("available of product 1 = %d, want 5", got)
+	}
+
+	// 同一商品的多行合并校验，合计超过可用库存时不能分别通过
+	result, err = redisRepo.LockStock(ctx, testOrderSN("dup-lines"), []*valueobject.StockOperation{
+		{ProductID: p1, WarehouseID: testWarehouseID, Quantity: 3},
+		{ProductID: p1, WarehouseID: testWarehouseID, Quantity: 3},
+	}, nil, valueobject.LockOptions{})
+	if err != nil || result.Success {
+		t.Fatalf("LockStock of 6 from 5 = %+v, %v, want failure", result, err)
+	}
+
+	// 成功锁定后重复提交同一订单不会再次扣减
+	orderSN = testOrderSN("ok")
+	for i := 0; i < 2; i++ {
+		result, err = lockOne(redisRepo, orderSN, p1, 2, valueobject.LockOptions{})
+		if err != nil || !result.Success {
+			t.Fatalf("LockStock attempt %d = %+v, %v", i, result, err)
+		}
+	}
+	if got := redisAvailable(t, redisRepo.client, p1); got != 3 {
+		t.Errorf("available after lock = %d, want 3", got)
+	}
+
+	// 写入MySQL后锁定数量一致，未落库数量清零
+	if err := redisRepo.FlushPendingLock(ctx, orderSN); err != nil {
+		t.Fatalf("FlushPendingLock error = %v", err)
+	}
+	if inv := mustGetInventory(t, dbRepo, p1); inv.LockStock != 2 {
+		t.Errorf("MySQL lock_stocks = %d, want 2", inv.LockStock)
+	}
+	pending, err := redisRepo.client.HGet(ctx, pendingLockHash, buildAvailableKey(p1, 0, testWarehouseID)).Result()
+	if err != redis.Nil {
+		t.Errorf("pending lock after flush = %q, %v, want none", pending, err)
+	}
+	if got := redisAvailable(t, redisRepo.client, p1); got != 3 {
+		t.Errorf("available after flush = %d, want 3", got)
+	}
+}
+
+func TestRedisPartialLockScript(t *testing.T) {
+	dbRepo, redisRepo := newTestRepos(t)
+	ctx := context.Background()
+	p1, p2, p3 := newTestProduct(), newTestProduct(), newTestProduct()
+	mustSetStock(t, dbRepo, p1, 5)
+	mustSetStock(t, dbRepo, p2, 1)
+	mustSetStock(t, dbRepo, p3, 0)
+	items := []*valueobject.StockOperation{
+		{ProductID: p1, WarehouseID: testWarehouseID, Quantity: 2},
+		{ProductID: p2, WarehouseID: testWarehouseID, Quantity: 3},
+		{ProductID: p3, WarehouseID: testWarehouseID, Quantity: 1},
+	}
+
+	// 只锁定能满足的商品
+	orderSN := testOrderSN("skip")
+	result, err := redisRepo.LockStock(ctx, orderSN, items, nil, valueobject.LockOptions{AllowPartial: true})
+	if err != nil || !result.Success || !result.Partial {
+		t.Fatalf("partial LockStock = %+v, %v", result, err)
+	}
+	if len(result.LockedItems) != 1 || result.LockedItems[0].ProductID != p1 || len(result.FailItems) != 2 {
+		t.Errorf("partial LockStock locked %+v, failed %+v", result.LockedItems, result.FailItems)
+	}
+	if err := redisRepo.FlushPendingLock(ctx, orderSN); err != nil {
+		t.Fatalf("FlushPendingLock error = %v", err)
+	}
+
+	// 按可用数量锁定不足的商品
+	orderSN = testOrderSN("quantity")
+	result, err = redisRepo.LockStock(ctx, orderSN, items, nil, valueobject.LockOptions{AllowPartial: true, AllowPartialQuantity: true})
+	if err != nil || !result.Success {
+		t.Fatalf("partial quantity LockStock = %+v, %v", result, err)
+	}
+	locked := make(map[int64]int)
+	for _, item := range result.LockedItems {
+		locked[item.ProductID] += item.Quantity
+	}
+	if locked[p1] != 2 || locked[p2] != 1 || locked[p3] != 0 {
+		t.Errorf("locked quantities = %v, want %d:2 %d:1", locked, p1, p2)
+	}
+	if err := redisRepo.FlushPendingLock(ctx, orderSN); err != nil {
+		t.Fatalf("FlushPendingLock error = %v", err)
+	}
+	for productID, want := range map[int64]int{p1: 4, p2: 1, p3: 0} {
+		if inv := mustGetInventory(t, dbRepo, productID); inv.LockStock != want {
+			t.Errorf("product %d lock_stocks = %d, want %d", productID, inv.LockStock, want)
+		}
+	}
+
+	// 没有任何商品能锁定时不登记订单
+	orderSN = testOrderSN("none")
+	result, err = redisRepo.LockStock(ctx, orderSN, items[1:], nil, valueobject.LockOptions{AllowPartial: true, AllowPartialQuantity: true})
+	if err != nil || result.Success {
+		t.Fatalf("LockStock with nothing available = %+v, %v", result, err)
+	}
+	if n, _ := redisRepo.client.Exists(ctx, pendingOrderKeyPrefix+orderSN).Result(); n != 0 {
+		t.Error("order registered although nothing was locked")
+	}
+}
+
+func TestLockStockAllocatesLotsFEFO(t *testing.T) {
+	dbRepo, _ := newTestRepos(t)
+	ctx := context.Background()
+	productID := newTestProduct()
+	now := time.Now()
+	expired := now.Add(-24 * time.Hour)
+	soon := now.Add(5 * 24 * time.Hour)
+	later := now.Add(10 * 24 * time.Hour)
+
+	for _, lot := range []struct {
+		info     valueobject.LotInfo
+		quantity int
+	}{
+		{valueobject.LotInfo{LotNo: "LATER", ExpiryDate: &later}, 2},
+		{valueobject.LotInfo{LotNo: "EXPIRED", ExpiryDate: &expired}, 5},
+		{valueobject.LotInfo{LotNo: "SOON", ExpiryDate: &soon}, 2},
+		{valueobject.LotInfo{LotNo: "NEVER"}, 2},
+	} {
+		info := lot.info
+		if err := dbRepo.IncreaseStock(ctx, productID, 0, testWarehouseID, lot.quantity, "", "test", &info); err != nil {
+			t.Fatalf("IncreaseStock %s error = %v", info.LotNo, err)
+		}
+	}
+
+	// 跳过过期批次，先到期的批次先出，不过期的批次最后
+	orderSN := testOrderSN("fefo")
+	result, err := lockOne(dbRepo, orderSN, productID, 5, valueobject.LockOptions{})
+	if err != nil || !result.Success {
+		t.Fatalf("LockStock = %+v, %v", result, err)
+	}
+	detail, err := dbRepo.GetStockSellDetail(ctx, orderSN)
+	if err != nil {
+		t.Fatalf("GetStockSellDetail error = %v", err)
+	}
+	got := make(map[string]int)
+	var order []string
+	for _, line := range detail.DetailItems {
+		got[line.LotNo] += line.Quantity
+		order = append(order, line.LotNo)
+	}
+	if got["SOON"] != 2 || got["LATER"] != 2 || got["NEVER"] != 1 || got["EXPIRED"] != 0 {
+		t.Errorf("lock lines = %v, want SOON:2 LATER:2 NEVER:1", got)
+	}
+	if len(order) != 3 || order[0] != "SOON" || order[1] != "LATER" || order[2] != "NEVER" {
+		t.Errorf("lock line order = %v, want [SOON LATER NEVER]", order)
+	}
+
+	// 只剩1件未过期的库存
+	result, err = lockOne(dbRepo, testOrderSN("short"), productID, 2, valueobject.LockOptions{})
+	if err != nil || result.Success {
+		t.Fatalf("LockStock beyond unexpired stock = %+v, %v, want failure", result, err)
+	}
+}
+
+func TestSettleStockPartially(t *testing.T) {
+	dbRepo, _ := newTestRepos(t)
+	ctx := context.Background()
+	productID := newTestProduct()
+	mustSetStock(t, dbRepo, productID, 10)
+
+	orderSN := testOrderSN("settle")
+	result, err := lockOne(dbRepo, orderSN, productID, 4, valueobject.LockOptions{})
+	if err != nil || !result.Success {
+		t.Fatalf("LockStock = %+v, %v", result, err)
+	}
+
+	// 先发货1件，订单仍为锁定状态
+	line := []*entity.StockDetail{{ProductID: productID, WarehouseID: testWarehouseID, Quantity: 1}}
+	if err := dbRepo.ReduceStock(ctx, orderSN, line); err != nil {
+		t.Fatalf("ReduceStock error = %v", err)
+	}
+	inv := mustGetInventory(t, dbRepo, productID)
+	if inv.Stock != 9 || inv.LockStock != 3 {
+		t.Errorf("after partial reduce stocks=%d lock_stocks=%d, want 9 and 3", inv.Stock, inv.LockStock)
+	}
+	detail, err := dbRepo.GetStockSellDetail(ctx, orderSN)
+	if err != nil || detail.Status != entity.StockLocked {
+		t.Fatalf("detail after partial reduce = %+v, %v, want locked", detail, err)
+	}
+
+	// 超出剩余锁定数量的处理被拒绝，不改变库存
+	line[0].Quantity = 4
+	if err := dbRepo.ReduceStock(ctx, orderSN, line); err == nil {
+		t.Error("ReduceStock beyond remaining lock succeeded")
+	}
+
+	// 取消剩余数量后订单完结
+	if err := dbRepo.UnlockStock(ctx, orderSN, nil); err != nil {
+		t.Fatalf("UnlockStock error = %v", err)
+	}
+	inv = mustGetInventory(t, dbRepo, productID)
+	if inv.Stock != 9 || inv.LockStock != 0 {
+		t.Errorf("after settle stocks=%d lock_stocks=%d, want 9 and 0", inv.Stock, inv.LockStock)
+	}
+	detail, err = dbRepo.GetStockSellDetail(ctx, orderSN)
+	if err != nil || detail.Status != entity.StockSettled {
+		t.Fatalf("detail after settle = %+v, %v, want settled", detail, err)
+	}
+	if len(detail.DetailItems) != 1 || detail.DetailItems[0].Reduced != 1 || detail.DetailItems[0].Returned != 3 {
+		t.Errorf("detail lines = %+v, want reduced 1 returned 3", detail.DetailItems)
+	}
+
+	// 已完结的订单不能再处理
+	if err := dbRepo.UnlockStock(ctx, orderSN, nil); err == nil {
+		t.Error("UnlockStock of settled order succeeded")
+	}
+}
+
+func TestConcurrentIncreaseStock(t *testing.T) {
+	dbRepo, _ := newTestRepos(t)
+	ctx := context.Background()
+	productID := newTestProduct()
+	mustSetStock(t, dbRepo, productID, 0)
+
+	// 与锁定并发执行时，每次入库都应成功，锁定是否成功取决于当时的库存
+	const workers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- dbRepo.IncreaseStock(ctx, productID, 0, testWarehouseID, 1, "", "test", nil)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = lockOne(dbRepo, testOrderSN("race"), productID, 1, valueobject.LockOptions{})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("IncreaseStock error = %v", err)
+		}
+	}
+
+	if inv := mustGetInventory(t, dbRepo, productID); inv.Stock != workers {
+		t.Errorf("stocks = %d, want %d", inv.Stock, workers)
+	}
+}
+
+func TestFlushPendingLockPublishesFailure(t *testing.T) {
+	dbRepo, redisRepo := newTestRepos(t)
+	ctx := context.Background()
+	productID := newTestProduct()
+	mustSetStock(t, dbRepo, productID, 5)
+
+	orderSN := testOrderSN("lost")
+	if result, err := lockOne(redisRepo, orderSN, productID, 3, valueobject.LockOptions{}); err != nil || !result.Success {
+		t.Fatalf("LockStock = %+v, %v", result, err)
+	}
+
+	// 绕过Redis直接减少MySQL库存，写入时库存不足
+	mustSetStock(t, dbRepo, productID, 1)
+	if err := redisRepo.FlushPendingLock(ctx, orderSN); err != nil {
+		t.Fatalf("FlushPendingLock error = %v", err)
+	}
+
+	var events []*entity.OutboxEvent
+	if err := testDB.Where("aggregate_id = ?", orderSN).Find(&events).Error; err != nil {
+		t.Fatalf("Find outbox events error = %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != entity.EventStockLockFailed {
+		t.Fatalf("outbox events = %+v, want one %s event", events, entity.EventStockLockFailed)
+	}
+	if _, err := dbRepo.GetStockSellDetail(ctx, orderSN); err == nil {
+		t.Error("sell detail written for a failed lock")
+	}
+	if got := redisAvailable(t, redisRepo.client, productID); got != 5 {
+		t.Errorf("available after failed flush = %d, want 5", got)
+	}
+	if exists, _ := redisRepo.client.Exists(ctx, pendingOrderKeyPrefix+orderSN).Result(); exists != 0 {
+		t.Error("pending lock not acknowledged after publishing the failure")
+	}
+}
+
+func TestBackordersFulfilledInQueueOrder(t *testing.T) {
+	dbRepo, _ := newTestRepos(t)
+	ctx := context.Background()
+	productID := newTestProduct()
+	key := valueobject.StockKey{ProductID: productID, WarehouseID: testWarehouseID}
+	mustSetStock(t, dbRepo, productID, 1)
+	if err := dbRepo.SetBackorderLimit(ctx, key, 10, "test"); err != nil {
+		t.Fatalf("SetBackorderLimit error = %v", err)
+	}
+
+	// 第一单锁定1件、排队2件，第二单排队2件，第三单排队1件
+	orders := []string{testOrderSN("1"), testOrderSN("2"), testOrderSN("3")}
+	for i, quantity := range []int{3, 2, 1} {
+		result, err := lockOne(dbRepo, orders[i], productID, quantity, valueobject.LockOptions{AllowBackorder: true})
+		if err != nil || !result.Success {
+			t.Fatalf("LockStock order %d = %+v, %v", i+1, result, err)
+		}
+	}
+	inv := mustGetInventory(t, dbRepo, productID)
+	if inv.LockStock != 1 || inv.BackorderStock != 5 {
+		t.Fatalf("lock_stocks=%d backorder_stocks=%d, want 1 and 5", inv.LockStock, inv.BackorderStock)
+	}
+
+	// 到货3件，先满足第一单，剩余的1件给第二单，第三单继续排队
+	if err := dbRepo.IncreaseStock(ctx, productID, 0, testWarehouseID, 3, "", "test", nil); err != nil {
+		t.Fatalf("IncreaseStock error = %v", err)
+	}
+	backorders, _, err := dbRepo.ListBackorders(ctx, &BackorderFilter{ProductID: productID}, 1, 10)
+	if err != nil {
+		t.Fatalf("ListBackorders error = %v", err)
+	}
+	fulfilled := make(map[string]int)
+	status := make(map[string]entity.BackorderStatus)
+	for _, b := range backorders {
+		fulfilled[b.OrderSN] += b.Fulfilled
+		status[b.OrderSN] = b.Status
+	}
+	if fulfilled[orders[0]] != 2 || status[orders[0]] != entity.BackorderFulfilled {
+		t.Errorf("order 1 fulfilled %d status %d, want 2 fulfilled", fulfilled[orders[0]], status[orders[0]])
+	}
+	if fulfilled[orders[1]] != 1 || status[orders[1]] != entity.BackorderQueued {
+		t.Errorf("order 2 fulfilled %d status %d, want 1 queued", fulfilled[orders[1]], status[orders[1]])
+	}
+	if fulfilled[orders[2]] != 0 || status[orders[2]] != entity.BackorderQueued {
+		t.Errorf("order 3 fulfilled %d status %d, want 0 queued", fulfilled[orders[2]], status[orders[2]])
+	}
+
+	inv = mustGetInventory(t, dbRepo, productID)
+	if inv.Stock != 4 || inv.LockStock != 4 || inv.BackorderStock != 2 {
+		t.Errorf("stocks=%d lock_stocks=%d backorder_stocks=%d, want 4, 4 and 2", inv.Stock, inv.LockStock, inv.BackorderStock)
+	}
+	detail, err := dbRepo.GetStockSellDetail(ctx, orders[0])
+	if err != nil || detail.Backordered != 0 {
+		t.Errorf("order 1 detail = %+v, %v, want nothing backordered", detail, err)
+	}
+
+	// 排队中的数量不能被新的锁定占用
+	result, err := lockOne(dbRepo, testOrderSN("4"), productID, 1, valueobject.LockOptions{})
+	if err != nil || result.Success {
+		t.Errorf("LockStock while queue is waiting = %+v, %v, want failure", result, err)
+	}
+}
+
+func TestBundleLocksAllComponentsOrNone(t *testing.T) {
+	dbRepo, _ := newTestRepos(t)
+	ctx := context.Background()
+	bundleID, partA, partB, single := newTestProduct(), newTestProduct(), newTestProduct(), newTestProduct()
+	mustSetStock(t, dbRepo, partA, 4)
+	mustSetStock(t, dbRepo, partB, 1)
+	mustSetStock(t, dbRepo, single, 5)
+
+	// 每套包含2件A和1件B，锁定2套时B不足，整套不锁定，同一订单的其他商品照常锁定
+	bundle := func(sets int) []*valueobject.StockOperation {
+		return []*valueobject.StockOperation{
+			{ProductID: partA, WarehouseID: testWarehouseID, Quantity: 2 * sets, BundleID: bundleID, BundleUnit: 2},
+			{ProductID: partB, WarehouseID: testWarehouseID, Quantity: sets, BundleID: bundleID, BundleUnit: 1},
+		}
+	}
+	items := append(bundle(2), &valueobject.StockOperation{ProductID: single, WarehouseID: testWarehouseID, Quantity: 1})
+	result, err := dbRepo.LockStock(ctx, testOrderSN("1"), items, nil, valueobject.LockOptions{AllowPartial: true})
+	if err != nil || !result.Success || len(result.FailItems) != 1 {
+		t.Fatalf("LockStock = %+v, %v, want the bundle to fail alone", result, err)
+	}
+	if a, b := mustGetInventory(t, dbRepo, partA), mustGetInventory(t, dbRepo, partB); a.LockStock != 0 || b.LockStock != 0 {
+		t.Errorf("component lock_stocks = %d and %d, want nothing locked", a.LockStock, b.LockStock)
+	}
+	if inv := mustGetInventory(t, dbRepo, single); inv.LockStock != 1 {
+		t.Errorf("single lock_stocks = %d, want 1", inv.LockStock)
+	}
+
+	result, err = dbRepo.LockStock(ctx, testOrderSN("2"), bundle(1), nil, valueobject.LockOptions{})
+	if err != nil || !result.Success {
+		t.Fatalf("LockStock one set = %+v, %v", result, err)
+	}
+	if a, b := mustGetInventory(t, dbRepo, partA), mustGetInventory(t, dbRepo, partB); a.LockStock != 2 || b.LockStock != 1 {
+		t.Errorf("component lock_stocks = %d and %d, want 2 and 1", a.LockStock, b.LockStock)
+	}
+}
+
+// benchmarkLockStock 并发锁定同一商品，每次锁定1件，结束后释放全部锁定
+func benchmarkLockStock(b *testing.B, repo InventoryRepository, redisRepo *RedisLockRepository) {
+	ctx := context.Background()
+	productID := newTestProduct()
+	// 保证所有请求都能锁定成功，只比较锁定开销
+	mustSetStock(b, redisRepo, productID, b.N)
+	prefix := testOrderSN("")
+
+	var seq int64
+	var failed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			orderSN := fmt.Sprintf("%s%d", prefix, atomic.AddInt64(&seq, 1))
+			result, err := lockOne(repo, orderSN, productID, 1, valueobject.LockOptions{})
+			if err != nil || !result.Success {
+				atomic.AddInt64(&failed, 1)
+			}
+		}
+	})
+	b.StopTimer()
+
+	if failed > 0 {
+		b.Errorf("%d of %d locks failed", failed, b.N)
+	}
+	// Redis模式释放前先写入MySQL
+	for i := int64(1); i <= seq; i++ {
+		_ = repo.UnlockStock(ctx, fmt.Sprintf("%s%d", prefix, i), nil)
+	}
+}
+
+// BenchmarkLockStockMySQL MySQL乐观锁模式下的锁定开销
+func BenchmarkLockStockMySQL(b *testing.B) {
+	dbRepo, redisRepo := newTestRepos(b)
+	benchmarkLockStock(b, dbRepo, redisRepo)
+}
+
+// BenchmarkLockStockRedis Redis Lua快速锁定模式下的锁定开销，写入MySQL不计入
+func BenchmarkLockStockRedis(b *testing.B) {
+	_, redisRepo := newTestRepos(b)
+	benchmarkLockStock(b, redisRepo, redisRepo)
+}
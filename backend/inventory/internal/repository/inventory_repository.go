@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 	
 	"shop/backend/inventory/internal/domain/entity"
 	"shop/backend/inventory/internal/domain/valueobject"
@@ -9,29 +10,69 @@ import (
 
 // InventoryRepository 库存仓储接口
 type InventoryRepository interface {
-	// 库存基本操作
-	GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error)
-	BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, error)
+	// 库存基本操作，skuID为0表示不区分规格的商品级库存
+	GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error)
+	BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, error)
+	GetInventoriesByProducts(ctx context.Context, productIDs []int64, warehouseIDs []int) ([]*entity.Inventory, error)
+	ListInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error)
+	ListLowStock(ctx context.Context, warehouseID int, page, pageSize int) ([]*entity.Inventory, int64, error)
 	SetInventory(ctx context.Context, inventory *entity.Inventory) error
+	// SetInventories 在同一事务内批量设置库存数量和预警阈值，并记录调整历史
+	SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error
 	
 	// 库存锁定和扣减
-	LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation) (*valueobject.LockResult, error)
-	UnlockStock(ctx context.Context, orderSN string) error
-	ReduceStock(ctx context.Context, orderSN string) error
+	LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error)
+	// lines为空时处理订单剩余的全部锁定，否则只处理指定商品的数量，仓库ID为0时按锁定明细顺序分摊
+	UnlockStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error
+	ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error
 	
 	// 库存调整
-	IncreaseStock(ctx context.Context, productID int64, warehouseID int, quantity int, remark string) error
-	DecreaseStock(ctx context.Context, productID int64, warehouseID int, quantity int, remark string) error
-	AdjustStock(ctx context.Context, productID int64, warehouseID int, newStock int, operator string, remark string) error
+	// orderSN为入库关联的单据号，写入库存历史；lot不为空时入库到指定批次
+	IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error
+	DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error
+	AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error
+	// 将商品级库存拆分到SKU，用于商品启用规格后迁移已有库存
+	SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error
+	
+	// 库存批次，过期批次的未锁定数量不可售
+	ListExpiringLots(ctx context.Context, warehouseID int, before time.Time, includeExpired bool, page, pageSize int) ([]*entity.InventoryLot, int64, error)
+	ExpireLots(ctx context.Context, now time.Time, limit int) ([]*entity.InventoryLot, error)
+	// WriteOffExpiredLot 报废已过期的批次，核销批次中未锁定的数量，返回报废后的批次和核销的数量
+	WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error)
+	
+	// 渠道分配和安全库存，只改变各渠道的可售数量，不改变库存数量
+	ListChannelAllocations(ctx context.Context, productIDs []int64, warehouseIDs []int, channel string) ([]*entity.InventoryChannelAllocation, error)
+	SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error)
+	SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error
+	
+	// 套装定义，套装没有库存记录，锁定时按组件锁定
+	GetBundles(ctx context.Context, productIDs []int64) ([]*entity.InventoryBundle, error)
+	SaveBundle(ctx context.Context, bundle *entity.InventoryBundle) error
+	DeleteBundle(ctx context.Context, productID int64) error
+	
+	// 缺货预订，锁定时可用库存不足的数量排队，入库后按排队顺序转为锁定
+	SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error
+	ListBackorders(ctx context.Context, filter *BackorderFilter, page, pageSize int) ([]*entity.InventoryBackorder, int64, error)
+	// 排队数量从可用库存中扣除，为预订保留；入库后立即分配，其余增加可用库存的操作由后台任务按排队顺序分配
+	ListBackorderedInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error)
+	FulfillBackorders(ctx context.Context, key valueobject.StockKey) ([]*entity.InventoryBackorder, error)
 	
 	// 库存锁定记录操作
 	GetStockSellDetail(ctx context.Context, orderSN string) (*entity.StockSellDetail, error)
 	UpdateStockSellDetailStatus(ctx context.Context, orderSN string, status entity.StockStatus) error
 	CreateStockSellDetail(ctx context.Context, detail *entity.StockSellDetail) error
+	// ListExpiredLocks 按ID顺序分页获取已过期的锁定记录，afterID为上一页最后一条记录的ID
+	ListExpiredLocks(ctx context.Context, before time.Time, afterID int64, limit int) ([]*entity.StockSellDetail, error)
 	
 	// 历史记录
 	RecordInventoryHistory(ctx context.Context, history *entity.InventoryHistory) error
 	GetInventoryHistoryByProductID(ctx context.Context, productID int64, page, pageSize int) ([]*entity.InventoryHistory, int64, error)
+	
+	// 流水核对，库存数量以库存变更历史为准，锁定数量以未完结的锁定记录和调拨预留为准
+	SumLedgerStocks(ctx context.Context, keys []valueobject.StockKey) (map[valueobject.StockKey]int, error)
+	SumOpenLocks(ctx context.Context) (map[valueobject.StockKey]int, error)
+	// ReconcileLedger 锁定库存记录后重新核对，repair为true时修复差异，没有差异时返回nil
+	ReconcileLedger(ctx context.Context, key valueobject.StockKey, repair bool, operator string) (*valueobject.LedgerDrift, error)
 }
 
 // WarehouseRepository 仓库仓储接口
@@ -39,10 +80,102 @@ type WarehouseRepository interface {
 	// 仓库基本操作
 	GetWarehouse(ctx context.Context, id int) (*entity.Warehouse, error)
 	GetWarehouseByName(ctx context.Context, name string) (*entity.Warehouse, error)
-	ListWarehouses(ctx context.Context, page, pageSize int) ([]*entity.Warehouse, int64, error)
+	ListWarehouses(ctx context.Context, filter *WarehouseFilter, page, pageSize int) ([]*entity.Warehouse, int64, error)
 	CreateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error
 	UpdateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error
+	// DeleteWarehouse 仓库仍有库存、锁定、在途调拨、未收齐的入库单或排队中的缺货预订时返回ErrWarehouseNotEmpty
 	DeleteWarehouse(ctx context.Context, id int) error
+	ListActiveWarehouses(ctx context.Context) ([]*entity.Warehouse, error)
 	
 	// 更多仓库相关操作...
 }
+
+// TransferRepository 调拨单仓储接口
+type TransferRepository interface {
+	// 调拨单的每一步都在同一事务内完成库存变更、历史记录和状态流转
+	CreateTransfer(ctx context.Context, order *entity.TransferOrder) error
+	ShipTransfer(ctx context.Context, transferSN string, operator string) error
+	ReceiveTransfer(ctx context.Context, transferSN string, operator string) error
+	CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error
+	GetTransfer(ctx context.Context, transferSN string) (*entity.TransferOrder, error)
+}
+
+// InboundRepository 采购入库单仓储接口
+type InboundRepository interface {
+	CreateInbound(ctx context.Context, order *entity.InboundOrder) error
+	// RecordReceipt 登记收货并累加已收数量，收货单号已存在时返回已有的收货单
+	RecordReceipt(ctx context.Context, receipt *entity.InboundReceipt) (*entity.InboundReceipt, error)
+	MarkReceiptItemPosted(ctx context.Context, receiptSN string, productID int64, skuID int64, lotNo string) error
+	// HasStockIn 判断收货明细是否已写入入库流水
+	HasStockIn(ctx context.Context, receiptSN string, productID int64, skuID int64, warehouseID int, lotNo string) (bool, error)
+	CloseInbound(ctx context.Context, inboundSN string, operator string, reason string) error
+	GetInbound(ctx context.Context, inboundSN string) (*entity.InboundOrder, error)
+	ListReceipts(ctx context.Context, inboundSN string) ([]*entity.InboundReceipt, error)
+}
+
+// StocktakeRepository 盘点单仓储接口
+type StocktakeRepository interface {
+	// CreateSession 创建盘点单，productIDs为空时盘点仓库内所有商品，商品的每个SKU分别盘点
+	CreateSession(ctx context.Context, session *entity.StocktakeSession, productIDs []int64) error
+	// SubmitCounts 录入实盘数量，同时记录录入时的账面库存
+	SubmitCounts(ctx context.Context, sessionSN string, counts map[valueobject.SkuKey]int, counter string) error
+	// CommitSession 在同一事务内按差异调整库存、记录历史并关闭盘点单
+	CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error)
+	CancelSession(ctx context.Context, sessionSN string, operator string) error
+	GetSession(ctx context.Context, sessionSN string) (*entity.StocktakeSession, error)
+}
+
+// OutboxRepository 事务发件箱仓储接口
+type OutboxRepository interface {
+	// Append 在独立事务中写入事件，用于不伴随库存变更的事件
+	Append(ctx context.Context, aggregateID string, event *entity.StockEvent) error
+	// ListPending 按写入顺序分页获取待发布的事件，afterID为上一页最后一条记录的ID
+	ListPending(ctx context.Context, afterID int64, limit int) ([]*entity.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id int64) error
+	// MarkFailed 记录发布失败，dead为true时不再重试
+	MarkFailed(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time, dead bool) error
+	// PurgePublished 清理指定时间之前已发布的事件
+	PurgePublished(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// InventoryChangeFilter 库存审计记录查询条件，零值字段不参与过滤
+type InventoryChangeFilter struct {
+	ProductID   int64
+	SkuID       int64
+	WarehouseID int
+	OrderSN     string
+	Operation   string
+	FailedOnly  bool      // 只查询失败的操作
+	StartTime   time.Time // 包含
+	EndTime     time.Time // 不包含
+}
+
+// WarehouseFilter 仓库查询条件，零值字段不参与过滤
+type WarehouseFilter struct {
+	Keyword      string                     // 匹配名称、地址或联系人
+	Status       *int8                      // 为nil时不限状态
+	RegionCode   string                     // 位于该地区或配送覆盖该地区
+	Capabilities entity.WarehouseCapability // 需同时具备的作业能力
+}
+
+// BackorderFilter 缺货预订查询条件，零值字段不参与过滤
+type BackorderFilter struct {
+	OrderSN     string
+	ProductID   int64
+	WarehouseID int
+	Status      entity.BackorderStatus
+}
+
+// AuditRepository 库存审计日志仓储接口
+type AuditRepository interface {
+	RecordInventoryChanges(ctx context.Context, records []*entity.InventoryChangeRecord) error
+	// ListInventoryChanges 按时间倒序分页查询审计记录
+	ListInventoryChanges(ctx context.Context, filter *InventoryChangeFilter, page, pageSize int) ([]*entity.InventoryChangeRecord, int64, error)
+	// AggregateInventoryChanges 按商品和操作类型汇总审计记录
+	AggregateInventoryChanges(ctx context.Context, filter *InventoryChangeFilter) ([]*entity.InventoryActivitySummary, error)
+}
+
+// AuditRecorder 接收库存审计记录，实现方负责异步写入，不能阻塞库存操作
+type AuditRecorder interface {
+	Record(record *entity.InventoryChangeRecord)
+}
@@ -2,12 +2,15 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 	
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	
 	"shop/backend/inventory/internal/domain/entity"
 	"shop/backend/inventory/internal/domain/valueobject"
@@ -23,6 +26,18 @@ var (
 	ErrStockNotLocked = errors.New("stock not locked")
 	// ErrRecordNotFound 记录不存在
 	ErrRecordNotFound = errors.New("record not found")
+	// ErrConcurrentUpdate 乐观锁版本冲突，库存已被其他请求修改
+	ErrConcurrentUpdate = errors.New("concurrent update conflict")
+	// ErrExceedLockedQuantity 扣减或归还的数量超过订单剩余的锁定数量
+	ErrExceedLockedQuantity = errors.New("quantity exceeds locked quantity")
+	// ErrSplitQuantityMismatch 拆分到SKU的数量之和与商品级库存不一致
+	ErrSplitQuantityMismatch = errors.New("split quantity mismatch")
+	// ErrStockBelowLocked 设置的库存数量低于已锁定的数量
+	ErrStockBelowLocked = errors.New("stock below locked quantity")
+	// ErrLotNotExpired 批次尚未标记过期，不能报废
+	ErrLotNotExpired = errors.New("lot not expired")
+	// ErrAllocationBelowLocked 设置的渠道分配数量低于渠道已锁定的数量
+	ErrAllocationBelowLocked = errors.New("allocation below locked quantity")
 )
 
 // InventoryRepositoryImpl 库存仓储实现
@@ -41,23 +56,24 @@ func NewInventoryRepository(db *gorm.DB, cache cache.InventoryCache, logger *zap
 	}
 }
 
-// GetInventory 获取商品库存
-func (r *InventoryRepositoryImpl) GetInventory(ctx context.Context, productID int64, warehouseID int) (*entity.Inventory, error) {
+// GetInventory 获取商品库存，skuID为0时获取商品级库存
+func (r *InventoryRepositoryImpl) GetInventory(ctx context.Context, productID int64, skuID int64, warehouseID int) (*entity.Inventory, error) {
 	// 先尝试从缓存获取
-	inventory, err := r.cache.GetInventory(ctx, productID, warehouseID)
+	inventory, err := r.cache.GetInventory(ctx, productID, skuID, warehouseID)
 	if err == nil {
 		return inventory, nil
 	}
 	
 	// 缓存未命中，从数据库查询
 	inventory = &entity.Inventory{}
-	err = r.db.WithContext(ctx).Where("goods = ? AND warehouse_id = ?", productID, warehouseID).First(inventory).Error
+	err = r.db.WithContext(ctx).Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).First(inventory).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrRecordNotFound
 		}
 		r.logger.Error("Failed to get inventory from database", 
 			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 		return nil, err
@@ -67,6 +83,7 @@ func (r *InventoryRepositoryImpl) GetInventory(ctx context.Context, productID in
 	if err := r.cache.SetInventory(ctx, inventory); err != nil {
 		r.logger.Warn("Failed to set inventory cache", 
 			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 	}
@@ -74,26 +91,30 @@ func (r *InventoryRepositoryImpl) GetInventory(ctx context.Context, productID in
 	return inventory, nil
 }
 
-// BatchGetInventory 批量获取商品库存
-func (r *InventoryRepositoryImpl) BatchGetInventory(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, error) {
-	if len(productIDs) == 0 {
+// BatchGetInventory 批量获取商品或SKU库存
+func (r *InventoryRepositoryImpl) BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey, warehouseID int) ([]*entity.Inventory, error) {
+	if len(keys) == 0 {
 		return []*entity.Inventory{}, nil
 	}
 	
 	// 尝试从缓存批量获取
-	inventories, missingIDs := r.cache.BatchGetInventory(ctx, productIDs, warehouseID)
+	inventories, missingKeys := r.cache.BatchGetInventory(ctx, keys, warehouseID)
 	
-	// 如果所有ID都在缓存中找到，则直接返回
-	if len(missingIDs) == 0 {
+	// 如果所有记录都在缓存中找到，则直接返回
+	if len(missingKeys) == 0 {
 		return inventories, nil
 	}
 	
 	// 查询缓存未命中的记录
+	tuples := make([][]interface{}, 0, len(missingKeys))
+	for _, key := range missingKeys {
+		tuples = append(tuples, []interface{}{key.ProductID, key.SkuID})
+	}
 	var dbInventories []*entity.Inventory
-	err := r.db.WithContext(ctx).Where("goods IN ? AND warehouse_id = ?", missingIDs, warehouseID).Find(&dbInventories).Error
+	err := r.db.WithContext(ctx).Where("warehouse_id = ? AND (goods, sku_id) IN ?", warehouseID, tuples).Find(&dbInventories).Error
 	if err != nil {
 		r.logger.Error("Failed to batch get inventory from database", 
-			zap.Any("product_ids", missingIDs), 
+			zap.Any("keys", missingKeys), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 		return inventories, err
@@ -104,6 +125,7 @@ func (r *InventoryRepositoryImpl) BatchGetInventory(ctx context.Context, product
 		if err := r.cache.SetInventory(ctx, inv); err != nil {
 			r.logger.Warn("Failed to set inventory cache", 
 				zap.Int64("product_id", inv.ProductID), 
+				zap.Int64("sku_id", inv.SkuID), 
 				zap.Int("warehouse_id", inv.WarehouseID), 
 				zap.Error(err))
 		}
@@ -113,13 +135,86 @@ func (r *InventoryRepositoryImpl) BatchGetInventory(ctx context.Context, product
 	return inventories, nil
 }
 
+// GetInventoriesByProducts 获取商品在指定仓库中的库存记录，包含商品的所有SKU，直接查询数据库以保证分配时数据最新
+func (r *InventoryRepositoryImpl) GetInventoriesByProducts(ctx context.Context, productIDs []int64, warehouseIDs []int) ([]*entity.Inventory, error) {
+	if len(productIDs) == 0 || len(warehouseIDs) == 0 {
+		return []*entity.Inventory{}, nil
+	}
+	
+	var inventories []*entity.Inventory
+	err := r.db.WithContext(ctx).
+		Where("goods IN ? AND warehouse_id IN ?", productIDs, warehouseIDs).
+		Find(&inventories).Error
+	if err != nil {
+		r.logger.Error("Failed to get inventories by products", 
+			zap.Any("product_ids", productIDs), 
+			zap.Ints("warehouse_ids", warehouseIDs), 
+			zap.Error(err))
+		return nil, err
+	}
+	
+	return inventories, nil
+}
+
+// ListInventories 按ID顺序分页遍历库存记录，afterID为上一页最后一条记录的ID
+func (r *InventoryRepositoryImpl) ListInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	err := r.db.WithContext(ctx).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&inventories).Error
+	if err != nil {
+		r.logger.Error("Failed to list inventories", 
+			zap.Int64("after_id", afterID), 
+			zap.Error(err))
+		return nil, err
+	}
+	
+	return inventories, nil
+}
+
+// ListLowStock 分页查询库存低于预警阈值的记录，warehouseID为0时查询所有仓库，缺口越大越靠前
+func (r *InventoryRepositoryImpl) ListLowStock(ctx context.Context, warehouseID int, page, pageSize int) ([]*entity.Inventory, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entity.Inventory{}).Where("stocks <= alert_threshold")
+	if warehouseID > 0 {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.Error("Failed to count low stock inventories", 
+			zap.Int("warehouse_id", warehouseID), 
+			zap.Error(err))
+		return nil, 0, err
+	}
+	
+	var inventories []*entity.Inventory
+	err := query.
+		Order("stocks - alert_threshold ASC").
+		Order("id ASC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&inventories).Error
+	if err != nil {
+		r.logger.Error("Failed to list low stock inventories", 
+			zap.Int("warehouse_id", warehouseID), 
+			zap.Error(err))
+		return nil, 0, err
+	}
+	
+	return inventories, total, nil
+}
+
 // SetInventory 设置商品库存
 func (r *InventoryRepositoryImpl) SetInventory(ctx context.Context, inventory *entity.Inventory) error {
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var existing entity.Inventory
 		
 		// 检查记录是否存在
-		err := tx.Where("goods = ? AND warehouse_id = ?", inventory.ProductID, inventory.WarehouseID).First(&existing).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", inventory.ProductID, inventory.SkuID, inventory.WarehouseID).
+			First(&existing).Error
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				// 不存在则创建
@@ -132,10 +227,22 @@ func (r *InventoryRepositoryImpl) SetInventory(ctx context.Context, inventory *e
 				return err
 			}
 		} else {
-			// 存在则更新
+			// 存在则更新，减少的数量按先到期先出从批次中扣减
+			if inventory.Stock < existing.LockStock {
+				return fmt.Errorf("%w: goods %d sku %d warehouse %d locked %d",
+					ErrStockBelowLocked, inventory.ProductID, inventory.SkuID, inventory.WarehouseID, existing.LockStock)
+			}
+			expired := 0
+			if inventory.Stock < existing.Stock {
+				if expired, err = drawDownLots(tx, &existing, existing.Stock-inventory.Stock, true, time.Now()); err != nil {
+					return err
+				}
+			}
+			
 			updates := map[string]interface{}{
 				"stocks":           inventory.Stock,
 				"lock_stocks":      inventory.LockStock,
+				"expired_stocks":   gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
 				"alert_threshold":  inventory.AlertThreshold,
 				"version":          existing.Version + 1,
 				"updated_at":       time.Now(),
@@ -154,15 +261,17 @@ func (r *InventoryRepositoryImpl) SetInventory(ctx context.Context, inventory *e
 	if err != nil {
 		r.logger.Error("Failed to set inventory", 
 			zap.Int64("product_id", inventory.ProductID), 
+			zap.Int64("sku_id", inventory.SkuID), 
 			zap.Int("warehouse_id", inventory.WarehouseID), 
 			zap.Error(err))
 		return err
 	}
 	
 	// 更新缓存
-	if err := r.cache.DeleteInventory(ctx, inventory.ProductID, inventory.WarehouseID); err != nil {
+	if err := r.cache.DeleteInventory(ctx, inventory.ProductID, inventory.SkuID, inventory.WarehouseID); err != nil {
 		r.logger.Warn("Failed to delete inventory cache", 
 			zap.Int64("product_id", inventory.ProductID), 
+			zap.Int64("sku_id", inventory.SkuID), 
 			zap.Int("warehouse_id", inventory.WarehouseID), 
 			zap.Error(err))
 	}
@@ -170,8 +279,107 @@ func (r *InventoryRepositoryImpl) SetInventory(ctx context.Context, inventory *e
 	return nil
 }
 
-// LockStock 锁定库存
-func (r *InventoryRepositoryImpl) LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation) (*valueobject.LockResult, error) {
+// SetInventories 在同一事务内批量设置库存数量和预警阈值，库存数量变化的记录写入调整历史和库存事件。
+// 新的库存数量不能低于已锁定的数量，任一记录失败时整批回滚
+func (r *InventoryRepositoryImpl) SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, inventory := range inventories {
+			var existing entity.Inventory
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("goods = ? AND sku_id = ? AND warehouse_id = ?", inventory.ProductID, inventory.SkuID, inventory.WarehouseID).
+				First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			
+			delta := inventory.Stock
+			if err != nil {
+				// 不存在则创建
+				inventory.LockStock = 0
+				inventory.CreatedAt = now
+				inventory.UpdatedAt = now
+				if err := tx.Create(inventory).Error; err != nil {
+					return err
+				}
+			} else {
+				if inventory.Stock < existing.LockStock {
+					return fmt.Errorf("%w: goods %d sku %d warehouse %d locked %d",
+						ErrStockBelowLocked, inventory.ProductID, inventory.SkuID, inventory.WarehouseID, existing.LockStock)
+				}
+				if inventory.Stock == existing.Stock && inventory.AlertThreshold == existing.AlertThreshold {
+					continue
+				}
+				
+				// 减少的数量按先到期先出从批次中扣减
+				expired := 0
+				if inventory.Stock < existing.Stock {
+					if expired, err = drawDownLots(tx, &existing, existing.Stock-inventory.Stock, true, now); err != nil {
+						return err
+					}
+				}
+				
+				if err := tx.Model(&entity.Inventory{}).
+					Where("id = ?", existing.ID).
+					Updates(map[string]interface{}{
+						"stocks":          inventory.Stock,
+						"expired_stocks":  gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
+						"alert_threshold": inventory.AlertThreshold,
+						"version":         gorm.Expr("version + 1"),
+						"updated_at":      now,
+					}).Error; err != nil {
+					return err
+				}
+				delta = inventory.Stock - existing.Stock
+			}
+			
+			// 只修改预警阈值时不记录历史
+			if delta == 0 {
+				continue
+			}
+			
+			if err := tx.Create(&entity.InventoryHistory{
+				ProductID:   inventory.ProductID,
+				SkuID:       inventory.SkuID,
+				WarehouseID: inventory.WarehouseID,
+				Quantity:    delta,
+				Operation:   entity.OperationAdjust,
+				Operator:    operator,
+				Remark:      remark,
+				CreatedAt:   now,
+			}).Error; err != nil {
+				return err
+			}
+			if err := appendAdjustedEvent(tx, inventory.ProductID, inventory.SkuID, inventory.WarehouseID, delta, inventory.Stock, operator, remark); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	
+	if err != nil {
+		r.logger.Error("Failed to set inventories", 
+			zap.Int("count", len(inventories)), 
+			zap.Error(err))
+		return err
+	}
+	
+	// 更新缓存
+	for _, inventory := range inventories {
+		if err := r.cache.DeleteInventory(ctx, inventory.ProductID, inventory.SkuID, inventory.WarehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache", 
+				zap.Int64("product_id", inventory.ProductID), 
+				zap.Int64("sku_id", inventory.SkuID), 
+				zap.Int("warehouse_id", inventory.WarehouseID), 
+				zap.Error(err))
+		}
+	}
+	
+	return nil
+}
+
+// LockStock 锁定库存，expireTime为空表示锁定不过期。默认整单锁定，opts.AllowPartial为true时只提交能锁定的商品
+func (r *InventoryRepositoryImpl) LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
 	if len(items) == 0 {
 		return &valueobject.LockResult{
 			Success: true,
@@ -183,10 +391,44 @@ func (r *InventoryRepositoryImpl) LockStock(ctx context.Context, orderSN string,
 	existingDetail, err := r.GetStockSellDetail(ctx, orderSN)
 	if err == nil && existingDetail != nil {
 		// 已经处理过的请求，返回之前的结果
-		return &valueobject.LockResult{
-			Success: true,
-			Message: "Stock already locked for this order",
-		}, nil
+		// 同一商品仓库的多个批次合并为一项，套装组件与单独购买的同一商品分开
+		type lockedKey struct {
+			stockKey
+			bundleID int64
+		}
+		lockedItems := make([]*valueobject.StockOperation, 0, len(existingDetail.DetailItems))
+		merged := make(map[lockedKey]*valueobject.StockOperation, len(existingDetail.DetailItems))
+		for _, item := range existingDetail.DetailItems {
+			key := lockedKey{stockKey{item.ProductID, item.SkuID, item.WarehouseID}, item.BundleID}
+			if locked, ok := merged[key]; ok {
+				locked.Quantity += item.Quantity
+				continue
+			}
+			locked := &valueobject.StockOperation{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				Quantity:    item.Quantity,
+				OrderSN:     orderSN,
+				BundleID:    item.BundleID,
+				BundleUnit:  item.BundleUnit,
+			}
+			merged[key] = locked
+			lockedItems = append(lockedItems, locked)
+		}
+		result := &valueobject.LockResult{
+			Success:     true,
+			Message:     "Stock already locked for this order",
+			LockedItems: lockedItems,
+		}
+		if existingDetail.Backordered > 0 {
+			backorders, err := queuedBackorders(r.db.WithContext(ctx), orderSN)
+			if err != nil {
+				return nil, err
+			}
+			result.Backordered = toBackorderedItems(backorders)
+		}
+		return result, nil
 	}
 	
 	// 开启事务处理
@@ -199,107 +441,171 @@ func (r *InventoryRepositoryImpl) LockStock(ctx context.Context, orderSN string,
 		// 处理每个商品的库存锁定
 		detailItems := make([]*entity.StockDetail, 0, len(items))
 		
-		for _, item := range items {
-			// 使用乐观锁更新库存
-			var inv entity.Inventory
-			
-			// 获取当前库存
-			if err := tx.Where("goods = ? AND warehouse_id = ?", item.ProductID, item.WarehouseID).First(&inv).Error; err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					// 库存不存在，添加到失败项
-					result.FailItems = append(result.FailItems, &valueobject.LockFailItem{
-						ProductID: item.ProductID,
-						Quantity:  item.Quantity,
-						Available: 0,
-						Reason:    "Inventory not found",
-					})
-					continue
-				}
-				return err
-			}
-			
-			// 检查库存是否足够
-			if inv.Stock - inv.LockStock < item.Quantity {
-				// 库存不足，添加到失败项
-				result.FailItems = append(result.FailItems, &valueobject.LockFailItem{
-					ProductID: item.ProductID,
-					Quantity:  item.Quantity,
-					Available: inv.Stock - inv.LockStock,
-					Reason:    "Insufficient stock",
-				})
-				continue
-			}
-			
-			// 更新锁定库存
-			if err := tx.Model(&entity.Inventory{}).
-				Where("id = ? AND version = ? AND stocks - lock_stocks >= ?", inv.ID, inv.Version, item.Quantity).
-				Updates(map[string]interface{}{
-					"lock_stocks": gorm.Expr("lock_stocks + ?", item.Quantity),
-					"version":     inv.Version + 1,
-					"updated_at":  time.Now(),
-				}).Error; err != nil {
-				return err
+		lockedItems := make([]*valueobject.StockOperation, 0, len(items))
+		backorders := make([]*entity.InventoryBackorder, 0)
+		now := time.Now()
+		
+		// 记录商品实际锁定的明细行
+		addLines := func(item *valueobject.StockOperation, lines []*entity.StockDetail) error {
+			lockedItem := *item
+			lockedItem.Quantity = 0
+			for _, line := range lines {
+				lockedItem.Quantity += line.Quantity
 			}
+			lockedItems = append(lockedItems, &lockedItem)
 			
 			// 添加到详情列表
-			detailItems = append(detailItems, &entity.StockDetail{
-				ProductID:   item.ProductID,
-				Quantity:    item.Quantity,
-				WarehouseID: item.WarehouseID,
-			})
+			detailItems = append(detailItems, lines...)
 			
 			// 记录库存历史
-			history := &entity.InventoryHistory{
-				ProductID:   item.ProductID,
-				WarehouseID: item.WarehouseID,
-				Quantity:    item.Quantity,
-				Operation:   entity.OperationLock,
-				OrderSN:     orderSN,
-				Operator:    item.Operator,
-				Remark:      item.Remark,
-				CreatedAt:   time.Now(),
-			}
-			
-			if err := tx.Create(history).Error; err != nil {
-				r.logger.Error("Failed to record inventory history", 
-					zap.Error(err),
-					zap.String("order_sn", orderSN),
-					zap.Int64("product_id", item.ProductID))
-				// 不中断主流程
+			for _, line := range lines {
+				history := &entity.InventoryHistory{
+					ProductID:   item.ProductID,
+					SkuID:       item.SkuID,
+					WarehouseID: item.WarehouseID,
+					Quantity:    line.Quantity,
+					Operation:   entity.OperationLock,
+					OrderSN:     orderSN,
+					LotNo:       line.LotNo,
+					Operator:    item.Operator,
+					Remark:      item.Remark,
+					CreatedAt:   time.Now(),
+				}
+				
+				if err := tx.Create(history).Error; err != nil {
+					return err
+				}
 			}
 			
 			// 更新缓存
-			if err := r.cache.DeleteInventory(ctx, item.ProductID, item.WarehouseID); err != nil {
+			if err := r.cache.DeleteInventory(ctx, item.ProductID, item.SkuID, item.WarehouseID); err != nil {
 				r.logger.Warn("Failed to delete inventory cache", 
 					zap.Int64("product_id", item.ProductID), 
+					zap.Int64("sku_id", item.SkuID), 
 					zap.Int("warehouse_id", item.WarehouseID), 
 					zap.Error(err))
 			}
+			return nil
 		}
 		
-		// 如果有失败项且要求全部成功，则回滚事务
-		if len(result.FailItems) > 0 {
+		for i := 0; i < len(items); {
+			item := items[i]
+			
+			// 套装的全部组件在保存点内锁定，任一组件不足时整套不锁定
+			if item.BundleID != 0 {
+				components := bundleGroup(items[i:])
+				i += len(components)
+				componentLines, failItem, err := r.lockBundle(tx, components, opts)
+				if err != nil {
+					return err
+				}
+				if failItem != nil {
+					result.FailItems = append(result.FailItems, failItem)
+					continue
+				}
+				for j, component := range components {
+					if err := addLines(component, componentLines[j]); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			i++
+			
+			// 使用乐观锁更新库存，按批次管理的库存按先到期先出拆分为多行
+			lines, backordered, failItem, err := r.lockItem(tx, item, opts)
+			if err != nil {
+				return err
+			}
+			if failItem != nil {
+				result.FailItems = append(result.FailItems, failItem)
+			}
+			
+			// 不足的数量排队预订，到货后转为锁定明细
+			if backordered > 0 {
+				backorder, err := queueBackorder(tx, orderSN, item, backordered, now)
+				if err != nil {
+					return err
+				}
+				backorders = append(backorders, backorder)
+				if len(lines) == 0 {
+					if err := r.cache.DeleteInventory(ctx, item.ProductID, item.SkuID, item.WarehouseID); err != nil {
+						r.logger.Warn("Failed to delete inventory cache", 
+							zap.Int64("product_id", item.ProductID), 
+							zap.Int64("sku_id", item.SkuID), 
+							zap.Int("warehouse_id", item.WarehouseID), 
+							zap.Error(err))
+					}
+				}
+			}
+			if len(lines) > 0 {
+				if err := addLines(item, lines); err != nil {
+					return err
+				}
+			}
+		}
+		
+		// 如果有失败项且要求全部成功，或部分锁定时没有任何商品锁定或预订成功，则回滚事务
+		if len(result.FailItems) > 0 && (!opts.AllowPartial || (len(detailItems) == 0 && len(backorders) == 0)) {
 			result.Success = false
 			result.Message = fmt.Sprintf("%d items failed to lock", len(result.FailItems))
 			return ErrInsufficientStock
 		}
 		
-		// 创建库存锁定记录
-		now := time.Now()
+		// 创建库存锁定记录，全部排队预订的订单同样创建，到货后追加锁定明细
 		sellDetail := &entity.StockSellDetail{
 			OrderSN:     orderSN,
 			Status:      entity.StockLocked,
 			DetailItems: detailItems,
 			LockTime:    &now,
+			ExpireTime:  expireTime,
 			CreatedAt:   now,
 			UpdatedAt:   now,
 		}
+		for _, backorder := range backorders {
+			sellDetail.Backordered += backorder.Quantity
+		}
+		if sellDetail.Backordered > 0 {
+			// 预订的到货时间不确定，有排队预订的订单不随超时释放，由订单取消时归还
+			sellDetail.ExpireTime = nil
+		}
 		
 		if err := tx.Create(sellDetail).Error; err != nil {
 			return err
 		}
 		
+		// 发布库存锁定事件
+		if len(detailItems) > 0 {
+			if err := appendOutboxEvent(tx, orderSN, &entity.StockEvent{
+				EventType:  entity.EventStockLocked,
+				OrderSN:    orderSN,
+				Items:      toStockEventItems(detailItems),
+				OccurredAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(backorders) > 0 {
+			if err := appendOutboxEvent(tx, orderSN, &entity.StockEvent{
+				EventType:  entity.EventBackorderQueued,
+				OrderSN:    orderSN,
+				Items:      toBackorderEventItems(backorders),
+				OccurredAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+		
 		result.Message = "Stock locked successfully"
+		if len(backorders) > 0 {
+			result.Message = fmt.Sprintf("Stock locked, %d items backordered", len(backorders))
+		}
+		if len(result.FailItems) > 0 {
+			result.Partial = true
+			result.Message = fmt.Sprintf("Stock partially locked, %d items not fully locked", len(result.FailItems))
+		}
+		result.LockedItems = lockedItems
+		result.Backordered = toBackorderedItems(backorders)
 		return nil
 	})
 	
@@ -316,232 +622,735 @@ func (r *InventoryRepositoryImpl) LockStock(ctx context.Context, orderSN string,
 	return result, nil
 }
 
-// UnlockStock 解锁库存
-func (r *InventoryRepositoryImpl) UnlockStock(ctx context.Context, orderSN string) error {
-	// 获取库存锁定详情
-	detail, err := r.GetStockSellDetail(ctx, orderSN)
-	if err != nil {
-		return err
-	}
-	
-	// 检查状态是否为已锁定
-	if detail.Status != entity.StockLocked {
-		r.logger.Warn("Cannot unlock stock with invalid status",
-			zap.String("order_sn", orderSN),
-			zap.Any("current_status", detail.Status))
-		return ErrStockNotLocked
-	}
-	
-	// 开启事务
-	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 解锁每个商品的库存
-		for _, item := range detail.DetailItems {
-			// 更新库存记录
-			if err := tx.Model(&entity.Inventory{}).
-				Where("goods = ? AND warehouse_id = ?", item.ProductID, item.WarehouseID).
-				Updates(map[string]interface{}{
-					"lock_stocks": gorm.Expr("lock_stocks - ?", item.Quantity),
-					"version":     gorm.Expr("version + 1"),
-					"updated_at":  time.Now(),
-				}).Error; err != nil {
-				return err
+// 乐观锁冲突时的最大重试次数
+const maxLockRetries = 3
+
+// lockItem 使用乐观锁锁定单个商品的库存，版本冲突时重新读取后重试。
+// 返回实际锁定的明细行和排队预订的数量，未锁满时同时返回失败项；允许按可用数量锁定时库存不足的商品按可用数量锁定。
+// 按批次管理的库存按先到期先出选择批次，每个批次一行，过期批次不参与锁定。
+// 指定渠道时先使用渠道分配中未锁定的数量，不足的部分使用共享可用库存。
+// 允许预订且库存记录开启了预售时，可用数量全部锁定，不足的部分在预售上限内排队预订
+func (r *InventoryRepositoryImpl) lockItem(tx *gorm.DB, item *valueobject.StockOperation, opts valueobject.LockOptions) ([]*entity.StockDetail, int, *valueobject.LockFailItem, error) {
+	partialQuantity := opts.AllowPartial && opts.AllowPartialQuantity
+	for attempt := 0; attempt < maxLockRetries; attempt++ {
+		// 获取当前库存，重试时使用当前读，否则事务内的快照读仍会读到旧版本
+		query := tx
+		if attempt > 0 {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var inv entity.Inventory
+		if err := query.Where("goods = ? AND sku_id = ? AND warehouse_id = ?", item.ProductID, item.SkuID, item.WarehouseID).First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// 库存不存在，添加到失败项
+				return nil, 0, &valueobject.LockFailItem{
+					ProductID:   item.ProductID,
+					SkuID:       item.SkuID,
+					WarehouseID: item.WarehouseID,
+					Quantity:    item.Quantity,
+					Available:   0,
+					Code:        valueobject.LockFailInventoryNotFound,
+					Reason:      "Inventory not found",
+				}, nil
 			}
-			
-			// 记录库存历史
-			history := &entity.InventoryHistory{
-				ProductID:   item.ProductID,
-				WarehouseID: item.WarehouseID,
-				Quantity:    -item.Quantity, // 负数表示解锁
-				Operation:   entity.OperationUnlock,
-				OrderSN:     orderSN,
-				Remark:      "Order cancelled or timeout",
-				CreatedAt:   time.Now(),
+			return nil, 0, nil, err
+		}
+		
+		// 读取批次并计算可用数量，尚未标记过期但已到期的批次同样不可用
+		now := time.Now()
+		lots, err := loadLots(tx, &inv)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		allocation, err := loadChannelAllocation(tx, &inv, opts.Channel)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		available := lockableStock(&inv, allocation, lots, now)
+		
+		// 检查库存是否足够，允许预订时不足的部分排队预订，允许按可用数量锁定时锁定全部可用库存
+		quantity := item.Quantity
+		backorder := 0
+		var failItem *valueobject.LockFailItem
+		if available < item.Quantity {
+			shortage := item.Quantity - available
+			if opts.AllowBackorder && shortage <= inv.BackorderAvailable() {
+				quantity, backorder = available, shortage
+			} else {
+				failItem = lockShortageItem(item, &inv, available, opts.AllowBackorder)
+				if !partialQuantity || available == 0 {
+					return nil, 0, failItem, nil
+				}
+				quantity = available
 			}
-			
-			if err := tx.Create(history).Error; err != nil {
-				r.logger.Error("Failed to record inventory history", 
-					zap.Error(err),
-					zap.String("order_sn", orderSN),
-					zap.Int64("product_id", item.ProductID))
-				// 不中断主流程
+		}
+		
+		// 渠道分配中未锁定的数量先锁定，这部分从预留数量转为锁定数量
+		fromAllocation := 0
+		if allocation != nil {
+			fromAllocation = min(quantity, allocation.Remaining())
+		}
+		
+		// 更新锁定库存，排队预订的数量计入预订数量
+		updates := map[string]interface{}{
+			"lock_stocks":     gorm.Expr("lock_stocks + ?", quantity),
+			"reserved_stocks": gorm.Expr("GREATEST(reserved_stocks - ?, 0)", fromAllocation),
+			"version":         inv.Version + 1,
+			"updated_at":      now,
+		}
+		if backorder > 0 {
+			updates["backorder_stocks"] = gorm.Expr("backorder_stocks + ?", backorder)
+		}
+		res := tx.Model(&entity.Inventory{}).
+			Where("id = ? AND version = ? AND stocks - lock_stocks - expired_stocks - safety_stocks - backorder_stocks >= ?", inv.ID, inv.Version, quantity).
+			Updates(updates)
+		if res.Error != nil {
+			return nil, 0, nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			if fromAllocation > 0 {
+				if err := tx.Model(&entity.InventoryChannelAllocation{}).
+					Where("id = ?", allocation.ID).
+					Updates(map[string]interface{}{
+						"lock_stocks": gorm.Expr("lock_stocks + ?", fromAllocation),
+						"updated_at":  now,
+					}).Error; err != nil {
+					return nil, 0, nil, err
+				}
 			}
-			
-			// 更新缓存
-			if err := r.cache.DeleteInventory(ctx, item.ProductID, item.WarehouseID); err != nil {
-				r.logger.Warn("Failed to delete inventory cache", 
-					zap.Int64("product_id", item.ProductID), 
-					zap.Int("warehouse_id", item.WarehouseID), 
-					zap.Error(err))
+			if quantity == 0 {
+				return nil, backorder, failItem, nil
+			}
+			lines, err := r.lockLots(tx, item, lots, quantity, now)
+			if err != nil {
+				return nil, 0, nil, err
 			}
+			assignChannel(lines, opts.Channel, fromAllocation)
+			return lines, backorder, failItem, nil
 		}
 		
-		// 更新库存锁定记录状态
-		return r.UpdateStockSellDetailStatus(ctx, orderSN, entity.StockReturned)
-	})
-	
-	if err != nil {
-		r.logger.Error("Failed to unlock stock", 
-			zap.Error(err),
-			zap.String("order_sn", orderSN))
-		return err
+		// 版本号已被其他请求修改，重新读取后重试
+		r.logger.Debug("Optimistic lock conflict, retrying",
+			zap.Int64("product_id", item.ProductID),
+			zap.Int("warehouse_id", item.WarehouseID),
+			zap.Int("attempt", attempt+1))
 	}
 	
-	return nil
+	return nil, 0, &valueobject.LockFailItem{
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: item.WarehouseID,
+		Quantity:    item.Quantity,
+		Code:        valueobject.LockFailConcurrentUpdate,
+		Reason:      "Concurrent update conflict, please retry",
+	}, nil
 }
 
-// ReduceStock 扣减库存（确认扣减）
-func (r *InventoryRepositoryImpl) ReduceStock(ctx context.Context, orderSN string) error {
-	// 获取库存锁定详情
-	detail, err := r.GetStockSellDetail(ctx, orderSN)
-	if err != nil {
-		return err
+// lockShortageItem 可用库存不足时的失败项，开启了预售的库存记录说明还可以预订的数量
+func lockShortageItem(item *valueobject.StockOperation, inv *entity.Inventory, available int, allowBackorder bool) *valueobject.LockFailItem {
+	failItem := &valueobject.LockFailItem{
+		ProductID:     item.ProductID,
+		SkuID:         item.SkuID,
+		WarehouseID:   item.WarehouseID,
+		Quantity:      item.Quantity,
+		Available:     available,
+		Backorderable: inv.BackorderAvailable(),
+		Code:          valueobject.LockFailInsufficientStock,
+		Reason:        "Insufficient stock",
+	}
+	if allowBackorder && inv.BackorderLimit > 0 {
+		failItem.Code = valueobject.LockFailBackorderLimit
+		failItem.Reason = fmt.Sprintf("Insufficient stock, only %d more can be backordered", failItem.Backorderable)
+	}
+	return failItem
+}
+
+// loadLots 加行锁读取库存记录下仍有库存的批次，按先到期先出排序
+func loadLots(tx *gorm.DB, inv *entity.Inventory) ([]*entity.InventoryLot, error) {
+	var lots []*entity.InventoryLot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND stocks > 0", inv.ProductID, inv.SkuID, inv.WarehouseID).
+		Find(&lots).Error; err != nil {
+		return nil, err
+	}
+	entity.SortLotsFEFO(lots)
+	return lots, nil
+}
+
+// lockableStock 计算可锁定数量：未过期批次的可用数量加上未区分批次的可用数量，且不超过库存记录对该渠道的可用数量
+func lockableStock(inv *entity.Inventory, allocation *entity.InventoryChannelAllocation, lots []*entity.InventoryLot, now time.Time) int {
+	if len(lots) == 0 {
+		return inv.ChannelAvailableStock(allocation)
 	}
 	
-	// 检查状态是否为已锁定
-	if detail.Status != entity.StockLocked {
-		r.logger.Warn("Cannot reduce stock with invalid status",
-			zap.String("order_sn", orderSN),
-			zap.Any("current_status", detail.Status))
-		return ErrStockNotLocked
+	available := untrackedAvailable(inv, lots)
+	for _, lot := range lots {
+		available += lot.AvailableStock(now)
+	}
+	return min(available, inv.ChannelAvailableStock(allocation))
+}
+
+// loadChannelAllocation 加行锁读取库存记录分配给渠道的数量，未指定渠道或渠道没有分配时返回nil
+func loadChannelAllocation(tx *gorm.DB, inv *entity.Inventory, channel string) (*entity.InventoryChannelAllocation, error) {
+	if channel == "" {
+		return nil, nil
 	}
 	
-	// 开启事务
-	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 扣减每个商品的库存
-		for _, item := range detail.DetailItems {
-			// 更新库存记录
-			if err := tx.Model(&entity.Inventory{}).
-				Where("goods = ? AND warehouse_id = ?", item.ProductID, item.WarehouseID).
-				Updates(map[string]interface{}{
-					"stocks":      gorm.Expr("stocks - ?", item.Quantity),
-					"lock_stocks": gorm.Expr("lock_stocks - ?", item.Quantity),
-					"version":     gorm.Expr("version + 1"),
-					"updated_at":  time.Now(),
-				}).Error; err != nil {
-				return err
-			}
-			
-			// 记录库存历史
-			history := &entity.InventoryHistory{
-				ProductID:   item.ProductID,
-				WarehouseID: item.WarehouseID,
-				Quantity:    -item.Quantity, // 负数表示扣减
-				Operation:   entity.OperationDecrease,
+	var allocation entity.InventoryChannelAllocation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND channel = ?", inv.ProductID, inv.SkuID, inv.WarehouseID, channel).
+		First(&allocation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &allocation, nil
+}
+
+// assignChannel 记录锁定明细行的渠道，并将使用渠道分配的数量依次记到各行
+func assignChannel(lines []*entity.StockDetail, channel string, fromAllocation int) {
+	if channel == "" {
+		return
+	}
+	for _, line := range lines {
+		line.Channel = channel
+		take := min(line.Quantity, fromAllocation)
+		line.ChannelQuantity = take
+		fromAllocation -= take
+	}
+}
+
+// untrackedAvailable 未区分批次的可用数量，即库存记录中不属于任何批次的部分
+func untrackedAvailable(inv *entity.Inventory, lots []*entity.InventoryLot) int {
+	stock, locked := inv.Stock, inv.LockStock
+	for _, lot := range lots {
+		stock -= lot.Stock
+		locked -= lot.LockStock
+	}
+	return max(stock-max(locked, 0), 0)
+}
+
+// drawDownLots 不经过锁定直接减少库存数量时，按先到期先出扣减批次中未锁定的数量，批次不足的部分从未区分批次的库存中扣减。
+// includeExpired为false时先跳过已过期的批次，未区分批次的库存也不足时再扣减过期批次，保证批次数量之和不超过库存数量。
+// 返回从过期批次扣减的数量，调用方需同时从库存记录的过期数量中减去
+func drawDownLots(tx *gorm.DB, inv *entity.Inventory, quantity int, includeExpired bool, now time.Time) (int, error) {
+	lots, err := loadLots(tx, inv)
+	if err != nil {
+		return 0, err
+	}
+	
+	untracked := inv.Stock
+	for _, lot := range lots {
+		untracked -= lot.Stock
+	}
+	
+	need, expired := quantity, 0
+	drawLot := func(lot *entity.InventoryLot) error {
+		take := min(lot.Stock-lot.LockStock, need)
+		if take <= 0 {
+			return nil
+		}
+		if err := tx.Model(&entity.InventoryLot{}).
+			Where("id = ?", lot.ID).
+			Updates(map[string]interface{}{
+				"stocks":     gorm.Expr("stocks - ?", take),
+				"updated_at": now,
+			}).Error; err != nil {
+			return err
+		}
+		lot.Stock -= take
+		need -= take
+		if lot.Expired {
+			expired += take
+		}
+		return nil
+	}
+	
+	for _, lot := range lots {
+		if need == 0 {
+			break
+		}
+		if lot.Expired && !includeExpired {
+			continue
+		}
+		if err := drawLot(lot); err != nil {
+			return expired, err
+		}
+	}
+	need -= min(max(untracked, 0), need)
+	for _, lot := range lots {
+		if need == 0 {
+			break
+		}
+		if lot.Expired {
+			if err := drawLot(lot); err != nil {
+				return expired, err
+			}
+		}
+	}
+	
+	if need > 0 {
+		return expired, fmt.Errorf("%w: goods %d sku %d warehouse %d lots short by %d",
+			ErrInsufficientStock, inv.ProductID, inv.SkuID, inv.WarehouseID, need)
+	}
+	return expired, nil
+}
+
+// lockLots 按先到期先出将锁定数量分配到批次并更新批次锁定数量，批次不足的部分记为未区分批次的一行
+func (r *InventoryRepositoryImpl) lockLots(tx *gorm.DB, item *valueobject.StockOperation, lots []*entity.InventoryLot, quantity int, now time.Time) ([]*entity.StockDetail, error) {
+	lines := make([]*entity.StockDetail, 0, 1)
+	need := quantity
+	for _, lot := range lots {
+		if need == 0 {
+			break
+		}
+		take := min(lot.AvailableStock(now), need)
+		if take == 0 {
+			continue
+		}
+		
+		if err := tx.Model(&entity.InventoryLot{}).
+			Where("id = ?", lot.ID).
+			Updates(map[string]interface{}{
+				"lock_stocks": gorm.Expr("lock_stocks + ?", take),
+				"updated_at":  now,
+			}).Error; err != nil {
+			return nil, err
+		}
+		lot.LockStock += take
+		need -= take
+		
+		lines = append(lines, &entity.StockDetail{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			Quantity:    take,
+			WarehouseID: item.WarehouseID,
+			LotNo:       lot.LotNo,
+			ExpiryDate:  lot.ExpiryDate,
+			BundleID:    item.BundleID,
+			BundleUnit:  item.BundleUnit,
+		})
+	}
+	
+	if need > 0 {
+		lines = append(lines, &entity.StockDetail{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			Quantity:    need,
+			WarehouseID: item.WarehouseID,
+			BundleID:    item.BundleID,
+			BundleUnit:  item.BundleUnit,
+		})
+	}
+	return lines, nil
+}
+
+// UnlockStock 解锁库存，lines为空时归还订单剩余的全部锁定
+func (r *InventoryRepositoryImpl) UnlockStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	err := r.settleStock(ctx, orderSN, lines, false)
+	if err != nil {
+		r.logger.Error("Failed to unlock stock", 
+			zap.Error(err),
+			zap.String("order_sn", orderSN))
+		return err
+	}
+	
+	return nil
+}
+
+// ReduceStock 扣减库存（确认扣减），lines为空时扣减订单剩余的全部锁定
+func (r *InventoryRepositoryImpl) ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	err := r.settleStock(ctx, orderSN, lines, true)
+	if err != nil {
+		r.logger.Error("Failed to reduce stock", 
+			zap.Error(err),
+			zap.String("order_sn", orderSN))
+		return err
+	}
+	
+	return nil
+}
+
+// settleStock 在同一事务内扣减或归还订单的锁定库存，并累加每行的已处理数量。
+// 锁定记录在事务内加行锁读取，并发的部分发货和部分取消不会重复处理同一数量
+func (r *InventoryRepositoryImpl) settleStock(ctx context.Context, orderSN string, lines []*entity.StockDetail, reduce bool) error {
+	operation, remark, eventType := entity.OperationUnlock, "Order cancelled or timeout", entity.EventStockReturned
+	if reduce {
+		operation, remark, eventType = entity.OperationDecrease, "Order confirmed", entity.EventStockReduced
+	}
+	
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var detail entity.StockSellDetail
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_sn = ?", orderSN).
+			First(&detail).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		
+		// 检查状态是否为已锁定，部分处理后仍有锁定数量的订单保持锁定状态
+		if detail.Status != entity.StockLocked {
+			r.logger.Warn("Cannot settle stock with invalid status",
+				zap.String("order_sn", orderSN),
+				zap.Any("current_status", detail.Status))
+			return ErrStockNotLocked
+		}
+		
+		settled, err := allocateSettleLines(&detail, lines)
+		if err != nil {
+			return err
+		}
+		
+		now := time.Now()
+		eventItems := make([]*entity.StockDetail, 0, len(settled))
+		for _, line := range settled {
+			item := line.item
+			updates := map[string]interface{}{
+				"lock_stocks": gorm.Expr("lock_stocks - ?", line.quantity),
+				"version":     gorm.Expr("version + 1"),
+				"updated_at":  now,
+			}
+			
+			// 使用渠道分配的部分先处理，归还时回到渠道分配而不是共享可用库存
+			if channelQuantity := min(line.quantity, item.ChannelRemaining()); channelQuantity > 0 {
+				restored, err := settleChannel(tx, item, channelQuantity, reduce, now)
+				if err != nil {
+					return err
+				}
+				if restored {
+					updates["reserved_stocks"] = gorm.Expr("reserved_stocks + ?", channelQuantity)
+				}
+			}
+			if reduce {
+				updates["stocks"] = gorm.Expr("stocks - ?", line.quantity)
+				item.Reduced += line.quantity
+			} else {
+				item.Returned += line.quantity
+			}
+			
+			// 同步批次数量，归还到已过期批次的数量不再可售
+			if item.LotNo != "" {
+				expired, err := settleLot(tx, item, line.quantity, reduce, now)
+				if err != nil {
+					return err
+				}
+				if expired && !reduce {
+					updates["expired_stocks"] = gorm.Expr("expired_stocks + ?", line.quantity)
+				}
+			}
+			
+			// 更新库存记录
+			if err := tx.Model(&entity.Inventory{}).
+				Where("goods = ? AND sku_id = ? AND warehouse_id = ?", item.ProductID, item.SkuID, item.WarehouseID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+			
+			// 记录库存历史
+			history := &entity.InventoryHistory{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				Quantity:    -line.quantity, // 负数表示扣减或解锁
+				Operation:   operation,
 				OrderSN:     orderSN,
-				Remark:      "Order confirmed",
-				CreatedAt:   time.Now(),
+				LotNo:       item.LotNo,
+				Remark:      remark,
+				CreatedAt:   now,
 			}
 			
 			if err := tx.Create(history).Error; err != nil {
-				r.logger.Error("Failed to record inventory history", 
-					zap.Error(err),
-					zap.String("order_sn", orderSN),
-					zap.Int64("product_id", item.ProductID))
-				// 不中断主流程
+				return err
 			}
 			
 			// 更新缓存
-			if err := r.cache.DeleteInventory(ctx, item.ProductID, item.WarehouseID); err != nil {
+			if err := r.cache.DeleteInventory(ctx, item.ProductID, item.SkuID, item.WarehouseID); err != nil {
 				r.logger.Warn("Failed to delete inventory cache", 
 					zap.Int64("product_id", item.ProductID), 
+					zap.Int64("sku_id", item.SkuID), 
 					zap.Int("warehouse_id", item.WarehouseID), 
 					zap.Error(err))
 			}
+			
+			eventItems = append(eventItems, &entity.StockDetail{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				LotNo:       item.LotNo,
+				Quantity:    line.quantity,
+			})
 		}
 		
-		// 更新确认时间
-		now := time.Now()
+		// 整单归还时取消排队中的预订，释放占用的预售数量
+		if !reduce && len(lines) == 0 && detail.Backordered > 0 {
+			cancelled, err := cancelBackorders(tx, orderSN, now)
+			if err != nil {
+				return err
+			}
+			detail.Backordered = 0
+			for _, backorder := range cancelled {
+				if err := r.cache.DeleteInventory(ctx, backorder.ProductID, backorder.SkuID, backorder.WarehouseID); err != nil {
+					r.logger.Warn("Failed to delete inventory cache", 
+						zap.Int64("product_id", backorder.ProductID), 
+						zap.Int64("sku_id", backorder.SkuID), 
+						zap.Int("warehouse_id", backorder.WarehouseID), 
+						zap.Error(err))
+				}
+			}
+		}
+		
+		// 更新每行的处理数量和整单状态
+		detail.RefreshStatus()
+		data, err := json.Marshal(detail.DetailItems)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"detail":        string(data),
+			"backorder_num": detail.Backordered,
+			"status":        detail.Status,
+			"updated_at":    now,
+		}
+		if reduce {
+			if detail.ConfirmTime == nil {
+				updates["confirm_time"] = now
+			}
+			// 订单已确认，剩余的锁定数量不再随超时释放
+			updates["expire_time"] = nil
+		}
 		if err := tx.Model(&entity.StockSellDetail{}).
-			Where("order_sn = ?", orderSN).
-			Updates(map[string]interface{}{
-				"status":       entity.StockReduced,
-				"confirm_time": now,
-				"updated_at":   now,
-			}).Error; err != nil {
+			Where("id = ?", detail.ID).
+			Updates(updates).Error; err != nil {
 			return err
 		}
 		
-		return nil
+		// 发布库存扣减或归还事件，事件中只包含本次处理的数量
+		return appendOutboxEvent(tx, orderSN, &entity.StockEvent{
+			EventType:  eventType,
+			OrderSN:    orderSN,
+			Items:      toStockEventItems(eventItems),
+			Remark:     remark,
+			OccurredAt: now,
+		})
 	})
-	
+}
+
+// settleLot 扣减或归还批次的锁定数量，返回批次是否已过期。批次记录已被删除时视为未区分批次的库存
+func settleLot(tx *gorm.DB, item *entity.StockDetail, quantity int, reduce bool, now time.Time) (bool, error) {
+	var lot entity.InventoryLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND lot_no = ?", item.ProductID, item.SkuID, item.WarehouseID, item.LotNo).
+		First(&lot).Error
 	if err != nil {
-		r.logger.Error("Failed to reduce stock", 
-			zap.Error(err),
-			zap.String("order_sn", orderSN))
-		return err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
 	}
 	
-	return nil
+	updates := map[string]interface{}{
+		"lock_stocks": gorm.Expr("GREATEST(lock_stocks - ?, 0)", quantity),
+		"updated_at":  now,
+	}
+	if reduce {
+		updates["stocks"] = gorm.Expr("GREATEST(stocks - ?, 0)", quantity)
+	}
+	if err := tx.Model(&entity.InventoryLot{}).Where("id = ?", lot.ID).Updates(updates).Error; err != nil {
+		return false, err
+	}
+	return lot.Expired, nil
+}
+
+// settleChannel 扣减或归还渠道分配中的锁定数量。扣减后分配数量相应减少；归还后回到分配中，
+// 返回true表示归还的数量重新计入预留数量。渠道分配已不存在时归还的数量回到共享可用库存
+func settleChannel(tx *gorm.DB, item *entity.StockDetail, quantity int, reduce bool, now time.Time) (bool, error) {
+	updates := map[string]interface{}{
+		"lock_stocks": gorm.Expr("GREATEST(lock_stocks - ?, 0)", quantity),
+		"updated_at":  now,
+	}
+	if reduce {
+		updates["allocated"] = gorm.Expr("GREATEST(allocated - ?, 0)", quantity)
+	}
+	res := tx.Model(&entity.InventoryChannelAllocation{}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND channel = ?", item.ProductID, item.SkuID, item.WarehouseID, item.Channel).
+		Updates(updates)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return !reduce && res.RowsAffected > 0, nil
+}
+
+// settleLine 一次扣减或归还中某个锁定明细行的处理数量
+type settleLine struct {
+	item     *entity.StockDetail
+	quantity int
+}
+
+// allocateSettleLines 将请求的商品数量分配到锁定明细行，商品和SKU需与明细一致。lines为空时处理每行剩余的全部锁定，
+// 仓库ID为0时按明细顺序在该SKU的各仓库间分摊，任一商品超过剩余锁定数量时返回错误。
+// 商品为订单中的套装时数量为套数，分摊到套装的各组件；单独购买的商品不会处理套装组件的锁定
+func allocateSettleLines(detail *entity.StockSellDetail, lines []*entity.StockDetail) ([]settleLine, error) {
+	settled := make([]settleLine, 0, len(detail.DetailItems))
+	if len(lines) == 0 {
+		for _, item := range detail.DetailItems {
+			if remaining := item.Remaining(); remaining > 0 {
+				settled = append(settled, settleLine{item: item, quantity: remaining})
+			}
+		}
+		return settled, nil
+	}
+	
+	allocated := make(map[*entity.StockDetail]int, len(detail.DetailItems))
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: invalid quantity %d for product %d", ErrExceedLockedQuantity, line.Quantity, line.ProductID)
+		}
+		
+		if line.SkuID == 0 && hasBundleLines(detail, line.ProductID) {
+			if err := allocateBundleLine(detail, line, allocated); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		
+		need := line.Quantity
+		for _, item := range detail.DetailItems {
+			if need == 0 {
+				break
+			}
+			if item.BundleID != 0 || item.ProductID != line.ProductID || item.SkuID != line.SkuID ||
+				(line.WarehouseID != 0 && item.WarehouseID != line.WarehouseID) {
+				continue
+			}
+			available := item.Remaining() - allocated[item]
+			if available <= 0 {
+				continue
+			}
+			quantity := min(available, need)
+			allocated[item] += quantity
+			need -= quantity
+		}
+		if need > 0 {
+			return nil, fmt.Errorf("%w: product %d sku %d warehouse %d", ErrExceedLockedQuantity, line.ProductID, line.SkuID, line.WarehouseID)
+		}
+	}
+	
+	for _, item := range detail.DetailItems {
+		if quantity := allocated[item]; quantity > 0 {
+			settled = append(settled, settleLine{item: item, quantity: quantity})
+		}
+	}
+	return settled, nil
 }
 
-// IncreaseStock 增加库存
-func (r *InventoryRepositoryImpl) IncreaseStock(ctx context.Context, productID int64, warehouseID int, quantity int, remark string) error {
+// IncreaseStock 增加库存，orderSN为入库关联的单据号，如采购收货单号；lot不为空时同时增加对应批次的数量
+func (r *InventoryRepositoryImpl) IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error {
+	lotNo := ""
+	if lot != nil {
+		lotNo = lot.LotNo
+	}
+	
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 更新库存
+		// 加行锁读取库存，与锁定、扣减等并发操作排队执行，避免版本冲突导致入库失败
 		var inv entity.Inventory
-		err := tx.Where("goods = ? AND warehouse_id = ?", productID, warehouseID).First(&inv).Error
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				// 创建新的库存记录
-				now := time.Now()
-				inv = entity.Inventory{
-					ProductID:      productID,
-					WarehouseID:    warehouseID,
-					Stock:          quantity,
-					Version:        0,
-					LockStock:      0,
-					AlertThreshold: 10, // 默认预警阈值
-					CreatedAt:      now,
-					UpdatedAt:      now,
-				}
-				return tx.Create(&inv).Error
-			}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+			First(&inv).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 			return err
 		}
 		
-		// 增加库存
-		if err := tx.Model(&entity.Inventory{}).
-			Where("id = ? AND version = ?", inv.ID, inv.Version).
-			Updates(map[string]interface{}{
+		// 增加批次数量，入库到已过期的批次时数量直接计入过期数量
+		lotExpired := false
+		if lotNo != "" {
+			if lotExpired, err = addLotStock(tx, productID, skuID, warehouseID, lot, quantity); err != nil {
+				return err
+			}
+		}
+		
+		if inv.ID == 0 {
+			// 创建新的库存记录
+			now := time.Now()
+			inv = entity.Inventory{
+				ProductID:      productID,
+				SkuID:          skuID,
+				WarehouseID:    warehouseID,
+				Stock:          quantity,
+				Version:        0,
+				LockStock:      0,
+				AlertThreshold: 10, // 默认预警阈值
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if err := tx.Create(&inv).Error; err != nil {
+				return err
+			}
+		} else {
+			// 增加库存
+			updates := map[string]interface{}{
 				"stocks":     gorm.Expr("stocks + ?", quantity),
 				"version":    gorm.Expr("version + 1"),
 				"updated_at": time.Now(),
-			}).Error; err != nil {
-			return err
+			}
+			if lotExpired {
+				updates["expired_stocks"] = gorm.Expr("expired_stocks + ?", quantity)
+			}
+			if err := tx.Model(&entity.Inventory{}).
+				Where("id = ?", inv.ID).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+			inv.Stock += quantity
 		}
 		
 		// 记录库存历史
 		history := &entity.InventoryHistory{
 			ProductID:   productID,
+			SkuID:       skuID,
 			WarehouseID: warehouseID,
 			Quantity:    quantity,
 			Operation:   entity.OperationIncrease,
+			OrderSN:     orderSN,
+			LotNo:       lotNo,
 			Remark:      remark,
 			CreatedAt:   time.Now(),
 		}
 		
 		if err := tx.Create(history).Error; err != nil {
-			r.logger.Error("Failed to record inventory history", 
-				zap.Error(err),
-				zap.Int64("product_id", productID))
-			// 不中断主流程
+			return err
 		}
 		
-		return nil
+		return appendAdjustedEvent(tx, productID, skuID, warehouseID, quantity, inv.Stock, "", remark)
 	})
 	
 	if err != nil {
 		r.logger.Error("Failed to increase stock", 
 			zap.Error(err),
 			zap.Int64("product_id", productID),
-			zap.Int("warehouse_id", warehouseID))
+			zap.Int64("sku_id", skuID),
+			zap.Int("warehouse_id", warehouseID),
+			zap.String("order_sn", orderSN),
+			zap.String("lot_no", lotNo))
 		return err
 	}
 	
 	// 更新缓存
-	if err := r.cache.DeleteInventory(ctx, productID, warehouseID); err != nil {
+	if err := r.cache.DeleteInventory(ctx, productID, skuID, warehouseID); err != nil {
 		r.logger.Warn("Failed to delete inventory cache", 
 			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
+			zap.Int("warehouse_id", warehouseID), 
+			zap.Error(err))
+	}
+	
+	// 到货的数量按排队顺序分配给缺货预订，分配失败不影响入库，排队数量仍为预订保留，由缺货预订分配任务重试
+	if _, err := r.FulfillBackorders(ctx, valueobject.StockKey{ProductID: productID, SkuID: skuID, WarehouseID: warehouseID}); err != nil {
+		r.logger.Warn("Failed to fulfill backorders", 
+			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 	}
@@ -549,34 +1358,86 @@ func (r *InventoryRepositoryImpl) IncreaseStock(ctx context.Context, productID i
 	return nil
 }
 
+// addLotStock 增加批次数量，批次不存在时创建，返回批次是否已过期
+func addLotStock(tx *gorm.DB, productID int64, skuID int64, warehouseID int, lot *valueobject.LotInfo, quantity int) (bool, error) {
+	now := time.Now()
+	var existing entity.InventoryLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND lot_no = ?", productID, skuID, warehouseID, lot.LotNo).
+		First(&existing).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		return false, tx.Create(&entity.InventoryLot{
+			ProductID:   productID,
+			SkuID:       skuID,
+			WarehouseID: warehouseID,
+			LotNo:       lot.LotNo,
+			ExpiryDate:  lot.ExpiryDate,
+			Stock:       quantity,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}).Error
+	}
+	
+	updates := map[string]interface{}{
+		"stocks":     gorm.Expr("stocks + ?", quantity),
+		"updated_at": now,
+	}
+	// 批次首次入库未填写到期时间的，以本次入库的为准
+	if existing.ExpiryDate == nil && lot.ExpiryDate != nil {
+		updates["expiry_date"] = lot.ExpiryDate
+	}
+	if err := tx.Model(&entity.InventoryLot{}).Where("id = ?", existing.ID).Updates(updates).Error; err != nil {
+		return false, err
+	}
+	return existing.Expired, nil
+}
+
 // DecreaseStock 减少库存（非锁定方式直接减少）
-func (r *InventoryRepositoryImpl) DecreaseStock(ctx context.Context, productID int64, warehouseID int, quantity int, remark string) error {
+func (r *InventoryRepositoryImpl) DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error {
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// 查询库存
 		var inv entity.Inventory
-		if err := tx.Where("goods = ? AND warehouse_id = ?", productID, warehouseID).First(&inv).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+			First(&inv).Error; err != nil {
 			return err
 		}
 		
-		// 检查库存是否足够
-		if inv.Stock < quantity {
+		// 检查未锁定的库存是否足够，已锁定的数量需通过扣减锁定出库
+		if inv.Stock-inv.LockStock < quantity {
 			return ErrInsufficientStock
 		}
 		
-		// 减少库存
-		if err := tx.Model(&entity.Inventory{}).
-			Where("id = ? AND version = ? AND stocks >= ?", inv.ID, inv.Version, quantity).
-			Updates(map[string]interface{}{
-				"stocks":     gorm.Expr("stocks - ?", quantity),
-				"version":    gorm.Expr("version + 1"),
-				"updated_at": time.Now(),
-			}).Error; err != nil {
+		// 按先到期先出扣减批次，扣减的过期数量同时从过期数量中减去
+		now := time.Now()
+		expired, err := drawDownLots(tx, &inv, quantity, true, now)
+		if err != nil {
 			return err
 		}
 		
-		// 记录库存历史
-		history := &entity.InventoryHistory{
-			ProductID:   productID,
+		// 减少库存
+		res := tx.Model(&entity.Inventory{}).
+			Where("id = ? AND version = ? AND stocks - lock_stocks >= ?", inv.ID, inv.Version, quantity).
+			Updates(map[string]interface{}{
+				"stocks":         gorm.Expr("stocks - ?", quantity),
+				"expired_stocks": gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
+				"version":        gorm.Expr("version + 1"),
+				"updated_at":     now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrConcurrentUpdate
+		}
+		
+		// 记录库存历史
+		history := &entity.InventoryHistory{
+			ProductID:   productID,
+			SkuID:       skuID,
 			WarehouseID: warehouseID,
 			Quantity:    -quantity, // 负数表示减少
 			Operation:   entity.OperationDecrease,
@@ -585,27 +1446,26 @@ func (r *InventoryRepositoryImpl) DecreaseStock(ctx context.Context, productID i
 		}
 		
 		if err := tx.Create(history).Error; err != nil {
-			r.logger.Error("Failed to record inventory history", 
-				zap.Error(err),
-				zap.Int64("product_id", productID))
-			// 不中断主流程
+			return err
 		}
 		
-		return nil
+		return appendAdjustedEvent(tx, productID, skuID, warehouseID, -quantity, inv.Stock-quantity, "", remark)
 	})
 	
 	if err != nil {
 		r.logger.Error("Failed to decrease stock", 
 			zap.Error(err),
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID))
 		return err
 	}
 	
 	// 更新缓存
-	if err := r.cache.DeleteInventory(ctx, productID, warehouseID); err != nil {
+	if err := r.cache.DeleteInventory(ctx, productID, skuID, warehouseID); err != nil {
 		r.logger.Warn("Failed to delete inventory cache", 
 			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 	}
@@ -614,11 +1474,11 @@ func (r *InventoryRepositoryImpl) DecreaseStock(ctx context.Context, productID i
 }
 
 // AdjustStock 调整库存（库存盘点）
-func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int64, warehouseID int, newStock int, operator string, remark string) error {
+func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error {
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// 查询库存
 		var inv entity.Inventory
-		err := tx.Where("goods = ? AND warehouse_id = ?", productID, warehouseID).First(&inv).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).First(&inv).Error
 		
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -626,6 +1486,7 @@ func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int
 				now := time.Now()
 				inv = entity.Inventory{
 					ProductID:      productID,
+					SkuID:          skuID,
 					WarehouseID:    warehouseID,
 					Stock:          newStock,
 					Version:        0,
@@ -634,7 +1495,10 @@ func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int
 					CreatedAt:      now,
 					UpdatedAt:      now,
 				}
-				return tx.Create(&inv).Error
+				if err := tx.Create(&inv).Error; err != nil {
+					return err
+				}
+				return appendAdjustedEvent(tx, productID, skuID, warehouseID, newStock, newStock, operator, remark)
 			}
 			return err
 		}
@@ -642,20 +1506,41 @@ func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int
 		// 记录调整前的库存
 		oldStock := inv.Stock
 		
+		// 已锁定的数量需通过扣减或解锁处理，调整后的库存不能低于锁定数量
+		if newStock < inv.LockStock {
+			return fmt.Errorf("%w: goods %d sku %d warehouse %d locked %d",
+				ErrStockBelowLocked, productID, skuID, warehouseID, inv.LockStock)
+		}
+		
+		// 盘亏的数量按先到期先出从批次中扣减
+		now := time.Now()
+		expired := 0
+		if newStock < oldStock {
+			if expired, err = drawDownLots(tx, &inv, oldStock-newStock, true, now); err != nil {
+				return err
+			}
+		}
+		
 		// 调整库存
-		if err := tx.Model(&entity.Inventory{}).
-			Where("id = ? AND version = ?", inv.ID, inv.Version).
+		res := tx.Model(&entity.Inventory{}).
+			Where("id = ? AND version = ? AND lock_stocks <= ?", inv.ID, inv.Version, newStock).
 			Updates(map[string]interface{}{
-				"stocks":     newStock,
-				"version":    gorm.Expr("version + 1"),
-				"updated_at": time.Now(),
-			}).Error; err != nil {
-			return err
+				"stocks":         newStock,
+				"expired_stocks": gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
+				"version":        gorm.Expr("version + 1"),
+				"updated_at":     now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrConcurrentUpdate
 		}
 		
 		// 记录库存历史
 		history := &entity.InventoryHistory{
 			ProductID:   productID,
+			SkuID:       skuID,
 			WarehouseID: warehouseID,
 			Quantity:    newStock - oldStock, // 可能为正数或负数
 			Operation:   entity.OperationAdjust,
@@ -665,27 +1550,26 @@ func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int
 		}
 		
 		if err := tx.Create(history).Error; err != nil {
-			r.logger.Error("Failed to record inventory history", 
-				zap.Error(err),
-				zap.Int64("product_id", productID))
-			// 不中断主流程
+			return err
 		}
 		
-		return nil
+		return appendAdjustedEvent(tx, productID, skuID, warehouseID, newStock-oldStock, newStock, operator, remark)
 	})
 	
 	if err != nil {
 		r.logger.Error("Failed to adjust stock", 
 			zap.Error(err),
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("warehouse_id", warehouseID))
 		return err
 	}
 	
 	// 更新缓存
-	if err := r.cache.DeleteInventory(ctx, productID, warehouseID); err != nil {
+	if err := r.cache.DeleteInventory(ctx, productID, skuID, warehouseID); err != nil {
 		r.logger.Warn("Failed to delete inventory cache", 
 			zap.Int64("product_id", productID), 
+			zap.Int64("sku_id", skuID), 
 			zap.Int("warehouse_id", warehouseID), 
 			zap.Error(err))
 	}
@@ -693,6 +1577,214 @@ func (r *InventoryRepositoryImpl) AdjustStock(ctx context.Context, productID int
 	return nil
 }
 
+// SplitInventory 将商品在仓库中的商品级库存拆分到各SKU，已有SKU库存时累加。
+// 商品级库存不能有锁定数量，拆分数量之和需等于商品级库存。商品级批次按先到期先出依次转到各SKU，拆分后删除商品级库存和批次记录
+func (r *InventoryRepositoryImpl) SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error {
+	if len(skuStocks) == 0 {
+		return fmt.Errorf("%w: no sku specified", ErrSplitQuantityMismatch)
+	}
+	
+	total := 0
+	skuIDs := make([]int64, 0, len(skuStocks))
+	for skuID, quantity := range skuStocks {
+		if skuID <= 0 || quantity < 0 {
+			return fmt.Errorf("%w: invalid sku %d quantity %d", ErrSplitQuantityMismatch, skuID, quantity)
+		}
+		total += quantity
+		skuIDs = append(skuIDs, skuID)
+	}
+	sort.Slice(skuIDs, func(i, j int) bool { return skuIDs[i] < skuIDs[j] })
+	
+	remark := "Split goods-level stock into skus"
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var goodsInv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = 0 AND warehouse_id = ?", productID, warehouseID).
+			First(&goodsInv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		
+		// 有锁定数量时锁定明细仍指向商品级库存，需等锁定处理完成后再拆分
+		if goodsInv.LockStock > 0 {
+			return ErrStockLocked
+		}
+		if total != goodsInv.Stock {
+			return fmt.Errorf("%w: sku total %d, goods stock %d", ErrSplitQuantityMismatch, total, goodsInv.Stock)
+		}
+		
+		now := time.Now()
+		lots, err := loadLots(tx, &goodsInv)
+		if err != nil {
+			return err
+		}
+		for _, skuID := range skuIDs {
+			quantity := skuStocks[skuID]
+			
+			// 商品级批次按先到期先出依次转到各SKU，批次不足的部分为SKU未区分批次的库存
+			expired, err := moveLots(tx, lots, skuID, quantity, now)
+			if err != nil {
+				return err
+			}
+			
+			var inv entity.Inventory
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+				First(&inv).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				inv = entity.Inventory{
+					ProductID:      productID,
+					SkuID:          skuID,
+					WarehouseID:    warehouseID,
+					Stock:          quantity,
+					ExpiredStock:   expired,
+					AlertThreshold: goodsInv.AlertThreshold,
+					CreatedAt:      now,
+					UpdatedAt:      now,
+				}
+				if err := tx.Create(&inv).Error; err != nil {
+					return err
+				}
+			case err != nil:
+				return err
+			default:
+				if err := tx.Model(&entity.Inventory{}).
+					Where("id = ?", inv.ID).
+					Updates(map[string]interface{}{
+						"stocks":         gorm.Expr("stocks + ?", quantity),
+						"expired_stocks": gorm.Expr("expired_stocks + ?", expired),
+						"version":        gorm.Expr("version + 1"),
+						"updated_at":     now,
+					}).Error; err != nil {
+					return err
+				}
+				inv.Stock += quantity
+			}
+			
+			history := &entity.InventoryHistory{
+				ProductID:   productID,
+				SkuID:       skuID,
+				WarehouseID: warehouseID,
+				Quantity:    quantity,
+				Operation:   entity.OperationAdjust,
+				Operator:    operator,
+				Remark:      remark,
+				CreatedAt:   now,
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return err
+			}
+			if err := appendAdjustedEvent(tx, productID, skuID, warehouseID, quantity, inv.Stock, operator, remark); err != nil {
+				return err
+			}
+		}
+		
+		// 商品级库存和批次全部转移到SKU，删除原记录
+		if err := tx.Delete(&entity.Inventory{}, goodsInv.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("goods = ? AND sku_id = 0 AND warehouse_id = ?", productID, warehouseID).
+			Delete(&entity.InventoryLot{}).Error; err != nil {
+			return err
+		}
+		history := &entity.InventoryHistory{
+			ProductID:   productID,
+			WarehouseID: warehouseID,
+			Quantity:    -goodsInv.Stock,
+			Operation:   entity.OperationAdjust,
+			Operator:    operator,
+			Remark:      remark,
+			CreatedAt:   now,
+		}
+		if err := tx.Create(history).Error; err != nil {
+			return err
+		}
+		return appendAdjustedEvent(tx, productID, 0, warehouseID, -goodsInv.Stock, 0, operator, remark)
+	})
+	
+	if err != nil {
+		r.logger.Error("Failed to split inventory", 
+			zap.Error(err),
+			zap.Int64("product_id", productID),
+			zap.Int("warehouse_id", warehouseID))
+		return err
+	}
+	
+	// 更新缓存
+	keys := append([]int64{0}, skuIDs...)
+	for _, skuID := range keys {
+		if err := r.cache.DeleteInventory(ctx, productID, skuID, warehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache", 
+				zap.Int64("product_id", productID), 
+				zap.Int64("sku_id", skuID), 
+				zap.Int("warehouse_id", warehouseID), 
+				zap.Error(err))
+		}
+	}
+	
+	return nil
+}
+
+// moveLots 从商品级批次中按顺序取出quantity转到SKU的同批次，批次已取完时剩余部分不属于任何批次。
+// 返回转入后处于过期状态的数量，调用方需计入SKU库存记录的过期数量
+func moveLots(tx *gorm.DB, lots []*entity.InventoryLot, skuID int64, quantity int, now time.Time) (int, error) {
+	need, expired := quantity, 0
+	for _, lot := range lots {
+		if need == 0 {
+			break
+		}
+		take := min(lot.Stock, need)
+		if take == 0 {
+			continue
+		}
+		lot.Stock -= take
+		need -= take
+		
+		var existing entity.InventoryLot
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND lot_no = ?", lot.ProductID, skuID, lot.WarehouseID, lot.LotNo).
+			First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&entity.InventoryLot{
+				ProductID:   lot.ProductID,
+				SkuID:       skuID,
+				WarehouseID: lot.WarehouseID,
+				LotNo:       lot.LotNo,
+				ExpiryDate:  lot.ExpiryDate,
+				Stock:       take,
+				Expired:     lot.Expired,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}).Error; err != nil {
+				return expired, err
+			}
+			if lot.Expired {
+				expired += take
+			}
+		case err != nil:
+			return expired, err
+		default:
+			// SKU的同批次尚未标记过期时，转入的数量随批次标记过期时再计入过期数量
+			if err := tx.Model(&entity.InventoryLot{}).
+				Where("id = ?", existing.ID).
+				Updates(map[string]interface{}{
+					"stocks":     gorm.Expr("stocks + ?", take),
+					"updated_at": now,
+				}).Error; err != nil {
+				return expired, err
+			}
+			if existing.Expired {
+				expired += take
+			}
+		}
+	}
+	return expired, nil
+}
+
 // GetStockSellDetail 获取库存锁定记录
 func (r *InventoryRepositoryImpl) GetStockSellDetail(ctx context.Context, orderSN string) (*entity.StockSellDetail, error) {
 	var detail entity.StockSellDetail
@@ -758,6 +1850,26 @@ func (r *InventoryRepositoryImpl) CreateStockSellDetail(ctx context.Context, det
 	return nil
 }
 
+// ListExpiredLocks 按ID顺序分页获取已过期但仍处于锁定状态的锁定记录，只包含ID和订单号，afterID为上一页最后一条记录的ID
+func (r *InventoryRepositoryImpl) ListExpiredLocks(ctx context.Context, before time.Time, afterID int64, limit int) ([]*entity.StockSellDetail, error) {
+	var details []*entity.StockSellDetail
+	err := r.db.WithContext(ctx).Model(&entity.StockSellDetail{}).
+		Select("id", "order_sn").
+		Where("id > ? AND status = ? AND expire_time IS NOT NULL AND expire_time <= ?", afterID, entity.StockLocked, before).
+		Order("id ASC").
+		Limit(limit).
+		Find(&details).Error
+	if err != nil {
+		r.logger.Error("Failed to list expired stock locks", 
+			zap.Error(err),
+			zap.Time("before", before),
+			zap.Int64("after_id", afterID))
+		return nil, err
+	}
+	
+	return details, nil
+}
+
 // RecordInventoryHistory 记录库存变更历史
 func (r *InventoryRepositoryImpl) RecordInventoryHistory(ctx context.Context, history *entity.InventoryHistory) error {
 	if history.CreatedAt.IsZero() {
@@ -809,3 +1921,645 @@ func (r *InventoryRepositoryImpl) GetInventoryHistoryByProductID(ctx context.Con
 	
 	return histories, total, nil
 }
+
+// ListExpiringLots 查询到期时间早于before且仍有库存的批次，按到期时间排序。includeExpired为false时不包含已标记过期的批次
+func (r *InventoryRepositoryImpl) ListExpiringLots(ctx context.Context, warehouseID int, before time.Time, includeExpired bool, page, pageSize int) ([]*entity.InventoryLot, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entity.InventoryLot{}).
+		Where("expiry_date IS NOT NULL AND expiry_date <= ? AND stocks > 0", before)
+	if warehouseID > 0 {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	if !includeExpired {
+		query = query.Where("expired = ?", false)
+	}
+	
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.Error("Failed to count expiring lots", 
+			zap.Int("warehouse_id", warehouseID), 
+			zap.Error(err))
+		return nil, 0, err
+	}
+	
+	var lots []*entity.InventoryLot
+	err := query.
+		Order("expiry_date ASC").
+		Order("id ASC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&lots).Error
+	if err != nil {
+		r.logger.Error("Failed to list expiring lots", 
+			zap.Int("warehouse_id", warehouseID), 
+			zap.Error(err))
+		return nil, 0, err
+	}
+	
+	return lots, total, nil
+}
+
+// ExpireLots 将到期时间不晚于now的批次标记为过期，批次中未锁定的数量计入库存记录的过期数量，不再可售。
+// 每个批次在独立事务内处理，返回本次标记的批次
+func (r *InventoryRepositoryImpl) ExpireLots(ctx context.Context, now time.Time, limit int) ([]*entity.InventoryLot, error) {
+	var candidates []*entity.InventoryLot
+	if err := r.db.WithContext(ctx).
+		Where("expired = ? AND expiry_date IS NOT NULL AND expiry_date <= ?", false, now).
+		Order("expiry_date ASC").
+		Limit(limit).
+		Find(&candidates).Error; err != nil {
+		r.logger.Error("Failed to find expired lots", zap.Error(err))
+		return nil, err
+	}
+	
+	expired := make([]*entity.InventoryLot, 0, len(candidates))
+	for _, candidate := range candidates {
+		var lot entity.InventoryLot
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// 加锁后重新检查，避免与并发的标记重复计入过期数量
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND expired = ?", candidate.ID, false).
+				First(&lot).Error; err != nil {
+				return err
+			}
+			
+			if err := tx.Model(&entity.InventoryLot{}).
+				Where("id = ?", lot.ID).
+				Updates(map[string]interface{}{
+					"expired":    true,
+					"updated_at": now,
+				}).Error; err != nil {
+				return err
+			}
+			
+			unlocked := lot.Stock - lot.LockStock
+			if unlocked <= 0 {
+				return nil
+			}
+			
+			if err := tx.Model(&entity.Inventory{}).
+				Where("goods = ? AND sku_id = ? AND warehouse_id = ?", lot.ProductID, lot.SkuID, lot.WarehouseID).
+				Updates(map[string]interface{}{
+					"expired_stocks": gorm.Expr("expired_stocks + ?", unlocked),
+					"version":        gorm.Expr("version + 1"),
+					"updated_at":     now,
+				}).Error; err != nil {
+				return err
+			}
+			
+			return tx.Create(&entity.InventoryHistory{
+				ProductID:   lot.ProductID,
+				SkuID:       lot.SkuID,
+				WarehouseID: lot.WarehouseID,
+				Quantity:    unlocked,
+				Operation:   entity.OperationExpire,
+				LotNo:       lot.LotNo,
+				Remark:      "Lot expired",
+				CreatedAt:   now,
+			}).Error
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			r.logger.Error("Failed to expire lot", 
+				zap.Error(err),
+				zap.Int64("lot_id", candidate.ID),
+				zap.String("lot_no", candidate.LotNo))
+			return expired, err
+		}
+		
+		lot.Expired = true
+		expired = append(expired, &lot)
+		
+		if err := r.cache.DeleteInventory(ctx, lot.ProductID, lot.SkuID, lot.WarehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache", 
+				zap.Int64("product_id", lot.ProductID), 
+				zap.Int64("sku_id", lot.SkuID), 
+				zap.Int("warehouse_id", lot.WarehouseID), 
+				zap.Error(err))
+		}
+	}
+	
+	return expired, nil
+}
+
+// WriteOffExpiredLot 报废已过期的批次，批次中未锁定的数量从库存数量和过期数量中核销，并记录报废历史。
+// 批次中已锁定的数量仍由对应的订单扣减或归还，归还后可再次报废
+func (r *InventoryRepositoryImpl) WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error) {
+	var lot entity.InventoryLot
+	quantity := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 先锁库存记录再锁批次，与锁定时的加锁顺序一致
+		var inv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+			First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND lot_no = ?", productID, skuID, warehouseID, lotNo).
+			First(&lot).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if !lot.Expired {
+			return fmt.Errorf("%w: lot %s", ErrLotNotExpired, lotNo)
+		}
+		
+		quantity = lot.Stock - lot.LockStock
+		if quantity <= 0 {
+			return nil
+		}
+		
+		now := time.Now()
+		if err := tx.Model(&entity.InventoryLot{}).
+			Where("id = ?", lot.ID).
+			Updates(map[string]interface{}{
+				"stocks":     gorm.Expr("stocks - ?", quantity),
+				"updated_at": now,
+			}).Error; err != nil {
+			return err
+		}
+		lot.Stock -= quantity
+		
+		if err := tx.Model(&entity.Inventory{}).
+			Where("id = ?", inv.ID).
+			Updates(map[string]interface{}{
+				"stocks":         gorm.Expr("stocks - ?", quantity),
+				"expired_stocks": gorm.Expr("GREATEST(expired_stocks - ?, 0)", quantity),
+				"version":        gorm.Expr("version + 1"),
+				"updated_at":     now,
+			}).Error; err != nil {
+			return err
+		}
+		
+		if err := tx.Create(&entity.InventoryHistory{
+			ProductID:   productID,
+			SkuID:       skuID,
+			WarehouseID: warehouseID,
+			Quantity:    -quantity,
+			Operation:   entity.OperationWriteOff,
+			LotNo:       lotNo,
+			Operator:    operator,
+			Remark:      remark,
+			CreatedAt:   now,
+		}).Error; err != nil {
+			return err
+		}
+		return appendAdjustedEvent(tx, productID, skuID, warehouseID, -quantity, inv.Stock-quantity, operator, remark)
+	})
+	
+	if err != nil {
+		if !errors.Is(err, ErrRecordNotFound) && !errors.Is(err, ErrLotNotExpired) {
+			r.logger.Error("Failed to write off expired lot", 
+				zap.Error(err),
+				zap.Int64("product_id", productID),
+				zap.Int64("sku_id", skuID),
+				zap.Int("warehouse_id", warehouseID),
+				zap.String("lot_no", lotNo))
+		}
+		return nil, 0, err
+	}
+	
+	if quantity > 0 {
+		if err := r.cache.DeleteInventory(ctx, productID, skuID, warehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache", 
+				zap.Int64("product_id", productID), 
+				zap.Int64("sku_id", skuID), 
+				zap.Int("warehouse_id", warehouseID), 
+				zap.Error(err))
+		}
+	}
+	
+	return &lot, quantity, nil
+}
+
+
+// ledgerOperations 改变库存数量的操作类型，锁定、解锁、调拨预留和批次过期只改变锁定或可售数量
+var ledgerOperations = []entity.OperationType{
+	entity.OperationIncrease,
+	entity.OperationDecrease,
+	entity.OperationAdjust,
+	entity.OperationWriteOff,
+	entity.OperationTransferOut,
+	entity.OperationTransferIn,
+}
+
+// SumLedgerStocks 按库存变更历史累计指定库存记录的库存数量，没有历史的记录不出现在结果中
+func (r *InventoryRepositoryImpl) SumLedgerStocks(ctx context.Context, keys []valueobject.StockKey) (map[valueobject.StockKey]int, error) {
+	ledger, err := sumLedgerStocks(r.db.WithContext(ctx), keys)
+	if err != nil {
+		r.logger.Error("Failed to sum ledger stocks", 
+			zap.Int("keys", len(keys)), 
+			zap.Error(err))
+		return nil, err
+	}
+	
+	return ledger, nil
+}
+
+// sumLedgerStocks 汇总库存变更历史，事务内核对时使用同一个tx
+func sumLedgerStocks(db *gorm.DB, keys []valueobject.StockKey) (map[valueobject.StockKey]int, error) {
+	ledger := make(map[valueobject.StockKey]int, len(keys))
+	if len(keys) == 0 {
+		return ledger, nil
+	}
+	
+	tuples := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		tuples = append(tuples, []interface{}{key.ProductID, key.SkuID, key.WarehouseID})
+	}
+	
+	var rows []struct {
+		ProductID   int64 `gorm:"column:goods"`
+		SkuID       int64
+		WarehouseID int
+		Quantity    int
+	}
+	err := db.Model(&entity.InventoryHistory{}).
+		Select("goods, sku_id, warehouse_id, SUM(quantity) AS quantity").
+		Where("(goods, sku_id, warehouse_id) IN ? AND operation_type IN ?", tuples, ledgerOperations).
+		Group("goods, sku_id, warehouse_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, row := range rows {
+		ledger[valueobject.StockKey{ProductID: row.ProductID, SkuID: row.SkuID, WarehouseID: row.WarehouseID}] = row.Quantity
+	}
+	return ledger, nil
+}
+
+// SumOpenLocks 汇总所有未完结的订单锁定和调拨预留数量，部分处理的订单只计入剩余的锁定数量
+func (r *InventoryRepositoryImpl) SumOpenLocks(ctx context.Context) (map[valueobject.StockKey]int, error) {
+	const batchSize = 500
+	locks := make(map[valueobject.StockKey]int)
+	db := r.db.WithContext(ctx)
+	
+	var afterID int64
+	for {
+		var details []*entity.StockSellDetail
+		if err := db.Where("status = ? AND id > ?", entity.StockLocked, afterID).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&details).Error; err != nil {
+			r.logger.Error("Failed to list open stock sell details", 
+				zap.Int64("after_id", afterID), 
+				zap.Error(err))
+			return nil, err
+		}
+		addOpenLocks(locks, details, nil)
+		if len(details) < batchSize {
+			break
+		}
+		afterID = details[len(details)-1].ID
+	}
+	
+	var transfers []*entity.TransferOrder
+	if err := db.Where("status = ?", entity.TransferCreated).Find(&transfers).Error; err != nil {
+		r.logger.Error("Failed to list reserved transfers", zap.Error(err))
+		return nil, err
+	}
+	addOpenLocks(locks, nil, transfers)
+	
+	return locks, nil
+}
+
+// addOpenLocks 累加锁定记录的剩余锁定数量和未发货调拨单在源仓的预留数量
+func addOpenLocks(locks map[valueobject.StockKey]int, details []*entity.StockSellDetail, transfers []*entity.TransferOrder) {
+	for _, detail := range details {
+		for _, item := range detail.DetailItems {
+			if remaining := item.Remaining(); remaining > 0 {
+				locks[valueobject.StockKey{ProductID: item.ProductID, SkuID: item.SkuID, WarehouseID: item.WarehouseID}] += remaining
+			}
+		}
+	}
+	for _, order := range transfers {
+		for _, item := range order.Items {
+			locks[valueobject.StockKey{ProductID: item.ProductID, SkuID: item.SkuID, WarehouseID: order.FromWarehouseID}] += item.Quantity
+		}
+	}
+}
+
+// ReconcileLedger 锁定库存记录后重新核对流水和锁定数量。
+// 修复时库存数量保持不变，补记一条调整历史使流水与库存一致；锁定数量改为未完结锁定的实际数量
+func (r *InventoryRepositoryImpl) ReconcileLedger(ctx context.Context, key valueobject.StockKey, repair bool, operator string) (*valueobject.LedgerDrift, error) {
+	var drift *valueobject.LedgerDrift
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定库存记录，核对期间的锁定、扣减和调整等待核对完成
+		var inv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", key.ProductID, key.SkuID, key.WarehouseID).
+			First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		
+		ledger, err := sumLedgerStocks(tx, []valueobject.StockKey{key})
+		if err != nil {
+			return err
+		}
+		
+		// 锁定明细为JSON，先按商品和仓库粗筛，再按SKU精确汇总
+		var details []*entity.StockSellDetail
+		if err := tx.Where("status = ? AND JSON_CONTAINS(detail, JSON_OBJECT('goods_id', ?, 'warehouse_id', ?))",
+			entity.StockLocked, key.ProductID, key.WarehouseID).
+			Find(&details).Error; err != nil {
+			return err
+		}
+		var transfers []*entity.TransferOrder
+		if err := tx.Where("status = ? AND from_warehouse_id = ? AND JSON_CONTAINS(detail, JSON_OBJECT('goods_id', ?))",
+			entity.TransferCreated, key.WarehouseID, key.ProductID).
+			Find(&transfers).Error; err != nil {
+			return err
+		}
+		locks := make(map[valueobject.StockKey]int)
+		addOpenLocks(locks, details, transfers)
+		
+		d := &valueobject.LedgerDrift{
+			ProductID:     key.ProductID,
+			SkuID:         key.SkuID,
+			WarehouseID:   key.WarehouseID,
+			Stock:         inv.Stock,
+			LedgerStock:   ledger[key],
+			LockStock:     inv.LockStock,
+			OpenLockStock: locks[key],
+		}
+		if !d.HasDrift() {
+			return nil
+		}
+		drift = d
+		if !repair {
+			return nil
+		}
+		
+		now := time.Now()
+		if d.LockDrift() != 0 {
+			if err := tx.Model(&entity.Inventory{}).
+				Where("id = ?", inv.ID).
+				Updates(map[string]interface{}{
+					"lock_stocks": d.OpenLockStock,
+					"version":     gorm.Expr("version + 1"),
+					"updated_at":  now,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		
+		// 调整历史的数量为库存与流水的差额，锁定数量的修正记录在备注中
+		if err := tx.Create(&entity.InventoryHistory{
+			ProductID:   key.ProductID,
+			SkuID:       key.SkuID,
+			WarehouseID: key.WarehouseID,
+			Quantity:    d.StockDrift(),
+			Operation:   entity.OperationAdjust,
+			Operator:    operator,
+			Remark: fmt.Sprintf("Ledger reconciliation: stocks %d, ledger %d, lock_stocks %d -> %d",
+				d.Stock, d.LedgerStock, d.LockStock, d.OpenLockStock),
+			CreatedAt: now,
+		}).Error; err != nil {
+			return err
+		}
+		
+		d.Repaired = true
+		return nil
+	})
+	
+	if err != nil {
+		if !errors.Is(err, ErrRecordNotFound) {
+			r.logger.Error("Failed to reconcile ledger", 
+				zap.Error(err),
+				zap.Int64("product_id", key.ProductID),
+				zap.Int64("sku_id", key.SkuID),
+				zap.Int("warehouse_id", key.WarehouseID))
+		}
+		return nil, err
+	}
+	
+	if drift != nil && drift.Repaired {
+		if err := r.cache.DeleteInventory(ctx, key.ProductID, key.SkuID, key.WarehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache", 
+				zap.Int64("product_id", key.ProductID), 
+				zap.Int64("sku_id", key.SkuID), 
+				zap.Int("warehouse_id", key.WarehouseID), 
+				zap.Error(err))
+		}
+	}
+	
+	return drift, nil
+}
+
+// ListChannelAllocations 查询商品在指定仓库的渠道分配，warehouseIDs为空时不限仓库，channel为空时不限渠道
+func (r *InventoryRepositoryImpl) ListChannelAllocations(ctx context.Context, productIDs []int64, warehouseIDs []int, channel string) ([]*entity.InventoryChannelAllocation, error) {
+	var allocations []*entity.InventoryChannelAllocation
+	if len(productIDs) == 0 {
+		return allocations, nil
+	}
+	
+	query := r.db.WithContext(ctx).Where("goods IN ?", productIDs)
+	if len(warehouseIDs) > 0 {
+		query = query.Where("warehouse_id IN ?", warehouseIDs)
+	}
+	if channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if err := query.Order("goods, sku_id, warehouse_id, channel").Find(&allocations).Error; err != nil {
+		r.logger.Error("Failed to list channel allocations", 
+			zap.Int("products", len(productIDs)), 
+			zap.String("channel", channel), 
+			zap.Error(err))
+		return nil, err
+	}
+	
+	return allocations, nil
+}
+
+// SetChannelAllocation 设置库存记录分配给渠道的数量，allocated包含渠道已锁定的部分，不能低于已锁定的数量。
+// 增加的分配从共享可用库存中划出，共享可用库存不足时返回ErrInsufficientStock；分配为0且没有锁定时删除分配记录
+func (r *InventoryRepositoryImpl) SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error) {
+	now := time.Now()
+	var allocation *entity.InventoryChannelAllocation
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 与锁定和扣减保持相同的加锁顺序：先渠道分配，后库存记录
+		var existing entity.InventoryChannelAllocation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND channel = ?", key.ProductID, key.SkuID, key.WarehouseID, channel).
+			First(&existing).Error
+		found := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if !found {
+			existing = entity.InventoryChannelAllocation{
+				ProductID:   key.ProductID,
+				SkuID:       key.SkuID,
+				WarehouseID: key.WarehouseID,
+				Channel:     channel,
+				CreatedAt:   now,
+			}
+		}
+		
+		var inv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", key.ProductID, key.SkuID, key.WarehouseID).
+			First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		
+		if allocated < existing.LockStock {
+			return ErrAllocationBelowLocked
+		}
+		before := existing.Remaining()
+		existing.Allocated = allocated
+		delta := existing.Remaining() - before
+		if delta > inv.AvailableStock() {
+			return ErrInsufficientStock
+		}
+		
+		switch {
+		case found && allocated == 0 && existing.LockStock == 0:
+			if err := tx.Delete(&entity.InventoryChannelAllocation{}, existing.ID).Error; err != nil {
+				return err
+			}
+		case found:
+			if err := tx.Model(&entity.InventoryChannelAllocation{}).
+				Where("id = ?", existing.ID).
+				Updates(map[string]interface{}{
+					"allocated":  allocated,
+					"updated_at": now,
+				}).Error; err != nil {
+				return err
+			}
+		case allocated > 0:
+			existing.UpdatedAt = now
+			if err := tx.Create(&existing).Error; err != nil {
+				return err
+			}
+		}
+		existing.UpdatedAt = now
+		allocation = &existing
+		
+		// 预留数量按全部渠道分配重新汇总，顺带修正历史误差
+		var reserved int
+		if err := tx.Model(&entity.InventoryChannelAllocation{}).
+			Select("COALESCE(SUM(GREATEST(allocated - lock_stocks, 0)), 0)").
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", key.ProductID, key.SkuID, key.WarehouseID).
+			Scan(&reserved).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.Inventory{}).
+			Where("id = ?", inv.ID).
+			Updates(map[string]interface{}{
+				"reserved_stocks": reserved,
+				"version":         inv.Version + 1,
+				"updated_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+		
+		if delta == 0 {
+			return nil
+		}
+		return tx.Create(&entity.InventoryHistory{
+			ProductID:   key.ProductID,
+			SkuID:       key.SkuID,
+			WarehouseID: key.WarehouseID,
+			Quantity:    delta,
+			Operation:   entity.OperationReserve,
+			Operator:    operator,
+			Remark:      fmt.Sprintf("Channel %s allocation set to %d", channel, allocated),
+			CreatedAt:   now,
+		}).Error
+	})
+	if err != nil {
+		r.logger.Error("Failed to set channel allocation", 
+			zap.Int64("product_id", key.ProductID), 
+			zap.Int64("sku_id", key.SkuID), 
+			zap.Int("warehouse_id", key.WarehouseID), 
+			zap.String("channel", channel), 
+			zap.Int("allocated", allocated), 
+			zap.Error(err))
+		return nil, err
+	}
+	
+	if err := r.cache.DeleteInventory(ctx, key.ProductID, key.SkuID, key.WarehouseID); err != nil {
+		r.logger.Warn("Failed to delete inventory cache", 
+			zap.Int64("product_id", key.ProductID), 
+			zap.Int64("sku_id", key.SkuID), 
+			zap.Int("warehouse_id", key.WarehouseID), 
+			zap.Error(err))
+	}
+	
+	return allocation, nil
+}
+
+// SetSafetyStock 设置库存记录的安全库存，安全库存对所有渠道都不可售。
+// 安全库存可以高于当前可售数量，此时库存记录暂不可售
+func (r *InventoryRepositoryImpl) SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error {
+	now := time.Now()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var inv entity.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", key.ProductID, key.SkuID, key.WarehouseID).
+			First(&inv).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if inv.SafetyStock == safetyStock {
+			return nil
+		}
+		
+		if err := tx.Model(&entity.Inventory{}).
+			Where("id = ?", inv.ID).
+			Updates(map[string]interface{}{
+				"safety_stocks": safetyStock,
+				"version":       inv.Version + 1,
+				"updated_at":    now,
+			}).Error; err != nil {
+			return err
+		}
+		
+		return tx.Create(&entity.InventoryHistory{
+			ProductID:   key.ProductID,
+			SkuID:       key.SkuID,
+			WarehouseID: key.WarehouseID,
+			Quantity:    safetyStock - inv.SafetyStock,
+			Operation:   entity.OperationReserve,
+			Operator:    operator,
+			Remark:      fmt.Sprintf("Safety stock set to %d", safetyStock),
+			CreatedAt:   now,
+		}).Error
+	})
+	if err != nil {
+		r.logger.Error("Failed to set safety stock", 
+			zap.Int64("product_id", key.ProductID), 
+			zap.Int64("sku_id", key.SkuID), 
+			zap.Int("warehouse_id", key.WarehouseID), 
+			zap.Int("safety_stock", safetyStock), 
+			zap.Error(err))
+		return err
+	}
+	
+	if err := r.cache.DeleteInventory(ctx, key.ProductID, key.SkuID, key.WarehouseID); err != nil {
+		r.logger.Warn("Failed to delete inventory cache", 
+			zap.Int64("product_id", key.ProductID), 
+			zap.Int64("sku_id", key.SkuID), 
+			zap.Int("warehouse_id", key.WarehouseID), 
+			zap.Error(err))
+	}
+	
+	return nil
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// 错误信息最大长度，与表字段一致
+const maxOutboxErrorLength = 500
+
+// OutboxRepositoryImpl 事务发件箱仓储实现
+type OutboxRepositoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewOutboxRepository 创建事务发件箱仓储
+func NewOutboxRepository(db *gorm.DB, logger *zap.Logger) OutboxRepository {
+	return &OutboxRepositoryImpl{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Append 写入事件
+func (r *OutboxRepositoryImpl) Append(ctx context.Context, aggregateID string, event *entity.StockEvent) error {
+	if err := appendOutboxEvent(r.db.WithContext(ctx), aggregateID, event); err != nil {
+		r.logger.Error("Failed to append outbox event",
+			zap.String("aggregate_id", aggregateID),
+			zap.String("event_type", event.EventType),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ListPending 按写入顺序分页获取待发布的事件。未到重试时间的事件也会返回，
+// 以便发布方阻塞同一聚合的后续事件，保证顺序
+func (r *OutboxRepositoryImpl) ListPending(ctx context.Context, afterID int64, limit int) ([]*entity.OutboxEvent, error) {
+	var events []*entity.OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND id > ?", entity.OutboxPending, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		r.logger.Error("Failed to list pending outbox events", zap.Error(err))
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MarkPublished 标记事件已发布
+func (r *OutboxRepositoryImpl) MarkPublished(ctx context.Context, id int64) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).Model(&entity.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       entity.OutboxPublished,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"published_at": now,
+		}).Error
+}
+
+// MarkFailed 记录发布失败
+func (r *OutboxRepositoryImpl) MarkFailed(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time, dead bool) error {
+	if len(errMsg) > maxOutboxErrorLength {
+		errMsg = errMsg[:maxOutboxErrorLength]
+	}
+
+	status := entity.OutboxPending
+	if dead {
+		status = entity.OutboxDead
+	}
+
+	return r.db.WithContext(ctx).Model(&entity.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          status,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      errMsg,
+			"next_attempt_at": nextAttemptAt,
+		}).Error
+}
+
+// PurgePublished 清理已发布的事件
+func (r *OutboxRepositoryImpl) PurgePublished(ctx context.Context, before time.Time, limit int) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("status = ? AND published_at < ?", entity.OutboxPublished, before).
+		Limit(limit).
+		Delete(&entity.OutboxEvent{})
+	if res.Error != nil {
+		r.logger.Error("Failed to purge published outbox events", zap.Error(res.Error))
+		return 0, res.Error
+	}
+
+	return res.RowsAffected, nil
+}
+
+// appendOutboxEvent 在库存变更所在的事务中写入领域事件，写入失败时整个事务回滚
+func appendOutboxEvent(tx *gorm.DB, aggregateID string, event *entity.StockEvent) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	outboxEvent, err := entity.NewOutboxEvent(aggregateID, event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(outboxEvent).Error
+}
+
+// appendAdjustedEvent 写入库存调整事件，quantity为变动数量，stock为变动后的库存
+func appendAdjustedEvent(tx *gorm.DB, productID int64, skuID int64, warehouseID int, quantity int, stock int, operator string, remark string) error {
+	return appendOutboxEvent(tx, stockAggregateID(productID, skuID, warehouseID), &entity.StockEvent{
+		EventType: entity.EventStockAdjusted,
+		Items: []*entity.StockEventItem{{
+			ProductID:   productID,
+			SkuID:       skuID,
+			WarehouseID: warehouseID,
+			Quantity:    quantity,
+			Stock:       &stock,
+		}},
+		Operator: operator,
+		Remark:   remark,
+	})
+}
+
+// toStockEventItems 将锁定明细转换为事件明细
+func toStockEventItems(details []*entity.StockDetail) []*entity.StockEventItem {
+	items := make([]*entity.StockEventItem, 0, len(details))
+	for _, detail := range details {
+		items = append(items, &entity.StockEventItem{
+			ProductID:   detail.ProductID,
+			SkuID:       detail.SkuID,
+			WarehouseID: detail.WarehouseID,
+			LotNo:       detail.LotNo,
+			Quantity:    detail.Quantity,
+		})
+	}
+	return items
+}
+
+// stockAggregateID 构建商品仓库维度的聚合ID，SKU级库存追加SKU ID，商品级库存保持原格式
+func stockAggregateID(productID int64, skuID int64, warehouseID int) string {
+	if skuID == 0 {
+		return fmt.Sprintf("%d:%d", productID, warehouseID)
+	}
+	return fmt.Sprintf("%d:%d:%d", productID, warehouseID, skuID)
+}
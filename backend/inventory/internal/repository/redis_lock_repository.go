@@ -0,0 +1,1071 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+const (
+	// 可用库存键前缀，值为 stocks - lock_stocks - 未落库的锁定数量
+	availableKeyPrefix = "inventory:available:"
+	// 已预热的可用库存键集合，用于对账
+	availableKeySet = "inventory:available:keys"
+	// 已在Redis锁定但尚未写入MySQL的数量，field为可用库存键
+	pendingLockHash = "inventory:lock:pending"
+	// 待写入MySQL的锁定订单键前缀，值为锁定明细
+	pendingOrderKeyPrefix = "inventory:lock:order:"
+	// 异步写入队列
+	lockQueueKey = "inventory:lock:queue"
+	// 正在写入的队列，用于异常恢复
+	lockProcessingKey = "inventory:lock:processing"
+)
+
+// Lua脚本返回码
+const (
+	luaLockOK           = 0
+	luaLockDuplicate    = 1
+	luaLockNotWarmed    = 2
+	luaLockInsufficient = 3
+)
+
+// 原子检查并扣减可用库存，同时登记待写入的锁定订单
+// KEYS: orderKey, queueKey, pendingHash, availableKey...
+// ARGV: payload, orderSN, quantity...
+var lockScript = redis.NewScript(`
+local n = #KEYS - 3
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return {1}
+end
+for i = 1, n do
+	local v = redis.call("GET", KEYS[i + 3])
+	if not v then
+		return {2, i}
+	end
+	if tonumber(v) < tonumber(ARGV[i + 2]) then
+		return {3, i, tonumber(v)}
+	end
+end
+for i = 1, n do
+	redis.call("DECRBY", KEYS[i + 3], ARGV[i + 2])
+	redis.call("HINCRBY", KEYS[3], KEYS[i + 3], ARGV[i + 2])
+end
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("LPUSH", KEYS[2], ARGV[2])
+return {0}
+`)
+
+// 部分锁定：能满足的库存键全部锁定，allowPartialQuantity为1时库存不足的键按可用数量锁定。
+// 每个键实际锁定的数量追加到待写入记录中，没有任何键能锁定时不做修改
+// KEYS: orderKey, queueKey, pendingHash, availableKey...
+// ARGV: payload（不含结尾的"}"）, orderSN, allowPartialQuantity, quantity...
+// 返回: {code, locked1, available1, locked2, available2...}
+var partialLockScript = redis.NewScript(`
+local n = #KEYS - 3
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return {1}
+end
+for i = 1, n do
+	if redis.call("EXISTS", KEYS[i + 3]) == 0 then
+		return {2, i}
+	end
+end
+local reply = {0}
+local locked = {}
+local total = 0
+for i = 1, n do
+	local v = tonumber(redis.call("GET", KEYS[i + 3]))
+	local q = tonumber(ARGV[i + 3])
+	local l = 0
+	if v >= q then
+		l = q
+	elseif ARGV[3] == "1" and v > 0 then
+		l = v
+	end
+	locked[i] = l
+	total = total + l
+	reply[#reply + 1] = l
+	reply[#reply + 1] = v
+end
+if total == 0 then
+	reply[1] = 3
+	return reply
+end
+for i = 1, n do
+	if locked[i] > 0 then
+		redis.call("DECRBY", KEYS[i + 3], locked[i])
+		redis.call("HINCRBY", KEYS[3], KEYS[i + 3], locked[i])
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1] .. ',"locked":[' .. table.concat(locked, ",") .. ']}')
+redis.call("LPUSH", KEYS[2], ARGV[2])
+return reply
+`)
+
+// 写入MySQL后确认，移除待写入记录并扣减未落库数量；重复确认不会重复扣减
+// KEYS: orderKey, processingKey, pendingHash
+// ARGV: orderSN, field, quantity, field, quantity...
+var ackScript = redis.NewScript(`
+redis.call("LREM", KEYS[2], 0, ARGV[1])
+if redis.call("DEL", KEYS[1]) == 0 then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	local left = redis.call("HINCRBY", KEYS[3], ARGV[i], -tonumber(ARGV[i + 1]))
+	if left <= 0 then
+		redis.call("HDEL", KEYS[3], ARGV[i])
+	end
+end
+return 1
+`)
+
+// 以数据库可用库存减去未落库数量设置Redis可用库存。
+// 仅当未落库数量与读取数据库前一致时才写入，避免覆盖期间发生的锁定
+// KEYS: availableKey, pendingHash, availableKeySet
+// ARGV: dbAvailable, pendingSeen, onlyIfMissing
+var warmScript = redis.NewScript(`
+if ARGV[3] == "1" and redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local p = tonumber(redis.call("HGET", KEYS[2], KEYS[1]) or "0")
+if p ~= tonumber(ARGV[2]) then
+	return 0
+end
+local v = tonumber(ARGV[1]) - p
+if v < 0 then
+	v = 0
+end
+redis.call("SET", KEYS[1], v)
+redis.call("SADD", KEYS[3], KEYS[1])
+return 1
+`)
+
+// 仅在键存在时增加可用库存，未预热的键由下次预热从数据库计算
+var incrIfExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// pendingLock 已在Redis锁定、等待写入MySQL的订单
+type pendingLock struct {
+	OrderSN    string                        `json:"order_sn"`
+	Items      []*valueobject.StockOperation `json:"items"`
+	ExpireTime *time.Time                    `json:"expire_time,omitempty"`
+	Locked     []int                         `json:"locked,omitempty"` // 部分锁定时每个商品实际锁定的数量，与Items一一对应
+}
+
+// applyLocked 部分锁定时按实际锁定数量修正锁定明细，去掉未锁定的商品
+func (l *pendingLock) applyLocked() {
+	if l.Locked == nil {
+		return
+	}
+
+	items := make([]*valueobject.StockOperation, 0, len(l.Items))
+	for i, item := range l.Items {
+		if i >= len(l.Locked) || l.Locked[i] <= 0 {
+			continue
+		}
+		lockedItem := *item
+		lockedItem.Quantity = l.Locked[i]
+		items = append(items, &lockedItem)
+	}
+	l.Items = items
+	l.Locked = nil
+}
+
+// RedisLockRepository 基于Redis Lua脚本的高并发库存锁定实现。
+// 锁定时在Redis中原子扣减可用库存，随后异步写入MySQL；其余操作委托给底层仓储。
+// 无法写入MySQL的锁定通过事务发件箱发布锁定失败事件
+type RedisLockRepository struct {
+	InventoryRepository
+	outbox OutboxRepository
+	client *redis.Client
+	logger *zap.Logger
+}
+
+// NewRedisLockRepository 创建Redis快速锁定仓储
+func NewRedisLockRepository(base InventoryRepository, outbox OutboxRepository, client *redis.Client, logger *zap.Logger) *RedisLockRepository {
+	return &RedisLockRepository{
+		InventoryRepository: base,
+		outbox:              outbox,
+		client:              client,
+		logger:              logger,
+	}
+}
+
+// buildAvailableKey 构建可用库存键，SKU级库存追加SKU ID，商品级库存保持原格式
+func buildAvailableKey(productID int64, skuID int64, warehouseID int) string {
+	if skuID == 0 {
+		return fmt.Sprintf("%s%d:%d", availableKeyPrefix, productID, warehouseID)
+	}
+	return fmt.Sprintf("%s%d:%d:%d", availableKeyPrefix, productID, warehouseID, skuID)
+}
+
+// parseAvailableKey 解析可用库存键，返回商品ID、SKU ID和仓库ID
+func parseAvailableKey(key string) (int64, int64, int, error) {
+	parts := strings.Split(strings.TrimPrefix(key, availableKeyPrefix), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid available stock key: %s", key)
+	}
+	productID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	warehouseID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var skuID int64
+	if len(parts) == 3 {
+		if skuID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return productID, skuID, warehouseID, nil
+}
+
+// LockStock 在Redis中原子锁定库存，并登记异步写入MySQL
+func (r *RedisLockRepository) LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	if len(items) == 0 {
+		return &valueobject.LockResult{
+			Success: true,
+			Message: "No items to lock",
+		}, nil
+	}
+
+	// 已写入MySQL的订单直接返回之前的结果
+	if _, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN); err == nil {
+		return r.InventoryRepository.LockStock(ctx, orderSN, items, expireTime, opts)
+	}
+
+	// 渠道锁定需要读取渠道分配，缺货预订需要读取预售上限，套装需要全部组件一起锁定，
+	// 直接在MySQL中锁定，完成后使Redis可用库存失效
+	if opts.Channel != "" || opts.AllowBackorder || containsBundle(items) {
+		return r.lockDirect(ctx, orderSN, items, expireTime, opts)
+	}
+
+	if opts.AllowPartial {
+		return r.lockPartial(ctx, orderSN, items, expireTime, opts)
+	}
+
+	// 同一商品SKU仓库的数量合并后再校验，避免重复行分别校验通过
+	keys := []string{pendingOrderKeyPrefix + orderSN, lockQueueKey, pendingLockHash}
+	quantities := make(map[string]int)
+	keyItems := make(map[string]*valueobject.StockOperation)
+	for _, item := range items {
+		key := buildAvailableKey(item.ProductID, item.SkuID, item.WarehouseID)
+		if _, ok := quantities[key]; !ok {
+			keys = append(keys, key)
+			keyItems[key] = item
+		}
+		quantities[key] += item.Quantity
+	}
+
+	payload, err := json.Marshal(&pendingLock{
+		OrderSN:    orderSN,
+		Items:      items,
+		ExpireTime: expireTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{string(payload), orderSN}
+	for _, key := range keys[3:] {
+		args = append(args, quantities[key])
+	}
+
+	// 首次执行时可能有未预热的键，预热后重试一次
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, err := lockScript.Run(ctx, r.client, keys, args...).Int64Slice()
+		if err != nil {
+			r.logger.Error("Failed to run lock script",
+				zap.String("order_sn", orderSN),
+				zap.Error(err))
+			return nil, err
+		}
+
+		switch reply[0] {
+		case luaLockOK:
+			return &valueobject.LockResult{
+				Success:     true,
+				Message:     "Stock locked successfully",
+				LockedItems: items,
+			}, nil
+		case luaLockDuplicate:
+			return &valueobject.LockResult{
+				Success:     true,
+				Message:     "Stock already locked for this order",
+				LockedItems: items,
+			}, nil
+		case luaLockNotWarmed:
+			if err := r.warmKeys(ctx, keys[3:], true); err != nil {
+				return nil, err
+			}
+		case luaLockInsufficient:
+			key := keys[2+reply[1]]
+			item := keyItems[key]
+			return &valueobject.LockResult{
+				Success: false,
+				Message: "1 items failed to lock",
+				FailItems: []*valueobject.LockFailItem{{
+					ProductID:   item.ProductID,
+					SkuID:       item.SkuID,
+					WarehouseID: item.WarehouseID,
+					Quantity:    quantities[key],
+					Available:   int(reply[2]),
+					Code:        valueobject.LockFailInsufficientStock,
+					Reason:      "Insufficient stock",
+				}},
+			}, nil
+		}
+	}
+
+	// 预热后仍不存在说明数据库中没有库存记录
+	failItems := make([]*valueobject.LockFailItem, 0)
+	for _, key := range keys[3:] {
+		exists, err := r.client.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			item := keyItems[key]
+			failItems = append(failItems, &valueobject.LockFailItem{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				Quantity:    quantities[key],
+				Code:        valueobject.LockFailInventoryNotFound,
+				Reason:      "Inventory not found",
+			})
+		}
+	}
+
+	return &valueobject.LockResult{
+		Success:   false,
+		Message:   fmt.Sprintf("%d items failed to lock", len(failItems)),
+		FailItems: failItems,
+	}, nil
+}
+
+// lockDirect 直接在MySQL中锁定库存，先写入该订单尚未落库的锁定，避免重复锁定
+func (r *RedisLockRepository) lockDirect(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+		return nil, err
+	}
+
+	result, err := r.InventoryRepository.LockStock(ctx, orderSN, items, expireTime, opts)
+	if err != nil || result == nil {
+		return result, err
+	}
+	for _, item := range result.LockedItems {
+		r.invalidate(ctx, item.ProductID, item.SkuID, item.WarehouseID)
+	}
+	return result, nil
+}
+
+// lockPartial 在Redis中部分锁定库存，只登记实际锁定的商品
+func (r *RedisLockRepository) lockPartial(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	// 同一商品SKU仓库合并为一行，锁定数量按键返回
+	keys := []string{pendingOrderKeyPrefix + orderSN, lockQueueKey, pendingLockHash}
+	merged := make([]*valueobject.StockOperation, 0, len(items))
+	index := make(map[string]int)
+	for _, item := range items {
+		key := buildAvailableKey(item.ProductID, item.SkuID, item.WarehouseID)
+		if i, ok := index[key]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		mergedItem := *item
+		index[key] = len(merged)
+		merged = append(merged, &mergedItem)
+		keys = append(keys, key)
+	}
+
+	payload, err := json.Marshal(&pendingLock{
+		OrderSN:    orderSN,
+		Items:      merged,
+		ExpireTime: expireTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	partialQuantity := "0"
+	if opts.AllowPartialQuantity {
+		partialQuantity = "1"
+	}
+	args := []interface{}{strings.TrimSuffix(string(payload), "}"), orderSN, partialQuantity}
+	for _, item := range merged {
+		args = append(args, item.Quantity)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, err := partialLockScript.Run(ctx, r.client, keys, args...).Int64Slice()
+		if err != nil {
+			r.logger.Error("Failed to run partial lock script",
+				zap.String("order_sn", orderSN),
+				zap.Error(err))
+			return nil, err
+		}
+
+		switch reply[0] {
+		case luaLockDuplicate:
+			// 并发的重复请求已登记，写入MySQL后返回实际锁定的结果
+			if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+				return nil, err
+			}
+			return r.InventoryRepository.LockStock(ctx, orderSN, items, expireTime, opts)
+		case luaLockNotWarmed:
+			if err := r.warmKeys(ctx, keys[3:], true); err != nil {
+				return nil, err
+			}
+		case luaLockOK, luaLockInsufficient:
+			return partialLockResult(merged, reply[1:]), nil
+		}
+	}
+
+	// 预热后仍有不存在的键，说明数据库中没有库存记录，这些商品无法锁定，其余商品照常锁定
+	found := make([]*valueobject.StockOperation, 0, len(merged))
+	failItems := make([]*valueobject.LockFailItem, 0)
+	for i, key := range keys[3:] {
+		exists, err := r.client.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			failItems = append(failItems, &valueobject.LockFailItem{
+				ProductID:   merged[i].ProductID,
+				SkuID:       merged[i].SkuID,
+				WarehouseID: merged[i].WarehouseID,
+				Quantity:    merged[i].Quantity,
+				Code:        valueobject.LockFailInventoryNotFound,
+				Reason:      "Inventory not found",
+			})
+			continue
+		}
+		found = append(found, merged[i])
+	}
+	if len(found) == 0 {
+		return &valueobject.LockResult{
+			Success:   false,
+			Message:   fmt.Sprintf("%d items failed to lock", len(failItems)),
+			FailItems: failItems,
+		}, nil
+	}
+	if len(found) == len(merged) {
+		// 预热期间键被并发删除，由调用方重试
+		return nil, ErrConcurrentUpdate
+	}
+
+	result, err := r.lockPartial(ctx, orderSN, found, expireTime, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.FailItems = append(result.FailItems, failItems...)
+	if result.Success {
+		result.Partial = true
+	}
+	return result, nil
+}
+
+// partialLockResult 根据部分锁定脚本返回的每个键的锁定数量和可用库存构建锁定结果
+func partialLockResult(items []*valueobject.StockOperation, reply []int64) *valueobject.LockResult {
+	result := &valueobject.LockResult{}
+	for i, item := range items {
+		locked, available := int(reply[2*i]), int(reply[2*i+1])
+		if locked > 0 {
+			lockedItem := *item
+			lockedItem.Quantity = locked
+			result.LockedItems = append(result.LockedItems, &lockedItem)
+		}
+		if locked < item.Quantity {
+			result.FailItems = append(result.FailItems, &valueobject.LockFailItem{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				Quantity:    item.Quantity,
+				Available:   available,
+				Code:        valueobject.LockFailInsufficientStock,
+				Reason:      "Insufficient stock",
+			})
+		}
+	}
+
+	switch {
+	case len(result.LockedItems) == 0:
+		result.Message = fmt.Sprintf("%d items failed to lock", len(result.FailItems))
+	case len(result.FailItems) > 0:
+		result.Success = true
+		result.Partial = true
+		result.Message = fmt.Sprintf("Stock partially locked, %d items not fully locked", len(result.FailItems))
+	default:
+		result.Success = true
+		result.Message = "Stock locked successfully"
+	}
+	return result
+}
+
+// UnlockStock 解锁库存，并将本次归还的数量归还到Redis
+func (r *RedisLockRepository) UnlockStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+		return err
+	}
+
+	before, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+	if err != nil {
+		return err
+	}
+
+	if err := r.InventoryRepository.UnlockStock(ctx, orderSN, lines); err != nil {
+		return err
+	}
+
+	// 以归还前后每行的已归还数量之差作为本次归还的数量
+	after, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+	if err != nil || len(after.DetailItems) != len(before.DetailItems) {
+		r.logger.Warn("Failed to load returned quantities, redis stock will be corrected by reconciliation",
+			zap.String("order_sn", orderSN),
+			zap.Error(err))
+		return nil
+	}
+
+	for i, item := range after.DetailItems {
+		// 使用渠道分配的部分归还到渠道分配，不增加共享可用库存
+		returned := item.Returned - before.DetailItems[i].Returned
+		returned -= before.DetailItems[i].ChannelRemaining() - item.ChannelRemaining()
+		if returned <= 0 {
+			continue
+		}
+		// 有排队预订时归还的数量先为预订保留，不能直接增加可用库存，下次锁定时从数据库重新计算
+		inv, err := r.InventoryRepository.GetInventory(ctx, item.ProductID, item.SkuID, item.WarehouseID)
+		if err != nil || inv.BackorderStock > 0 {
+			r.invalidate(ctx, item.ProductID, item.SkuID, item.WarehouseID)
+			continue
+		}
+		key := buildAvailableKey(item.ProductID, item.SkuID, item.WarehouseID)
+		if err := incrIfExistsScript.Run(ctx, r.client, []string{key}, returned).Err(); err != nil {
+			// 归还失败只会使Redis可用库存偏少，由对账修正
+			r.logger.Warn("Failed to return available stock to redis",
+				zap.String("order_sn", orderSN),
+				zap.String("key", key),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// ReduceStock 确认扣减库存，可用库存不变，只需保证锁定已写入MySQL
+func (r *RedisLockRepository) ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+		return err
+	}
+	return r.InventoryRepository.ReduceStock(ctx, orderSN, lines)
+}
+
+// GetStockSellDetail 获取库存锁定记录，尚未写入MySQL的锁定会先同步写入
+func (r *RedisLockRepository) GetStockSellDetail(ctx context.Context, orderSN string) (*entity.StockSellDetail, error) {
+	if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+		return nil, err
+	}
+	return r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+}
+
+// SetInventory 设置库存后使Redis可用库存失效
+func (r *RedisLockRepository) SetInventory(ctx context.Context, inventory *entity.Inventory) error {
+	if err := r.InventoryRepository.SetInventory(ctx, inventory); err != nil {
+		return err
+	}
+	r.invalidate(ctx, inventory.ProductID, inventory.SkuID, inventory.WarehouseID)
+	return nil
+}
+
+// SetInventories 批量设置库存后使Redis可用库存失效
+func (r *RedisLockRepository) SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error {
+	if err := r.InventoryRepository.SetInventories(ctx, inventories, operator, remark); err != nil {
+		return err
+	}
+	for _, inventory := range inventories {
+		r.invalidate(ctx, inventory.ProductID, inventory.SkuID, inventory.WarehouseID)
+	}
+	return nil
+}
+
+// IncreaseStock 增加库存后使Redis可用库存失效
+func (r *RedisLockRepository) IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error {
+	if err := r.InventoryRepository.IncreaseStock(ctx, productID, skuID, warehouseID, quantity, orderSN, remark, lot); err != nil {
+		return err
+	}
+	r.invalidate(ctx, productID, skuID, warehouseID)
+	return nil
+}
+
+// DecreaseStock 减少库存后使Redis可用库存失效
+func (r *RedisLockRepository) DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error {
+	if err := r.InventoryRepository.DecreaseStock(ctx, productID, skuID, warehouseID, quantity, remark); err != nil {
+		return err
+	}
+	r.invalidate(ctx, productID, skuID, warehouseID)
+	return nil
+}
+
+// AdjustStock 调整库存后使Redis可用库存失效
+func (r *RedisLockRepository) AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error {
+	if err := r.InventoryRepository.AdjustStock(ctx, productID, skuID, warehouseID, newStock, operator, remark); err != nil {
+		return err
+	}
+	r.invalidate(ctx, productID, skuID, warehouseID)
+	return nil
+}
+
+// SplitInventory 拆分库存后使商品级和SKU级的Redis可用库存失效
+func (r *RedisLockRepository) SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error {
+	if err := r.InventoryRepository.SplitInventory(ctx, productID, warehouseID, skuStocks, operator); err != nil {
+		return err
+	}
+	r.invalidate(ctx, productID, 0, warehouseID)
+	for skuID := range skuStocks {
+		r.invalidate(ctx, productID, skuID, warehouseID)
+	}
+	return nil
+}
+
+// ExpireLots 标记过期批次后使对应的Redis可用库存失效
+func (r *RedisLockRepository) ExpireLots(ctx context.Context, now time.Time, limit int) ([]*entity.InventoryLot, error) {
+	lots, err := r.InventoryRepository.ExpireLots(ctx, now, limit)
+	for _, lot := range lots {
+		r.invalidate(ctx, lot.ProductID, lot.SkuID, lot.WarehouseID)
+	}
+	return lots, err
+}
+
+// WriteOffExpiredLot 报废过期批次后使对应的Redis可用库存失效
+func (r *RedisLockRepository) WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error) {
+	lot, quantity, err := r.InventoryRepository.WriteOffExpiredLot(ctx, productID, skuID, warehouseID, lotNo, operator, remark)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.invalidate(ctx, productID, skuID, warehouseID)
+	return lot, quantity, nil
+}
+
+// ReconcileLedger 修复锁定数量后使对应的Redis可用库存失效
+func (r *RedisLockRepository) ReconcileLedger(ctx context.Context, key valueobject.StockKey, repair bool, operator string) (*valueobject.LedgerDrift, error) {
+	drift, err := r.InventoryRepository.ReconcileLedger(ctx, key, repair, operator)
+	if err == nil && drift != nil && drift.Repaired && drift.LockDrift() != 0 {
+		r.invalidate(ctx, key.ProductID, key.SkuID, key.WarehouseID)
+	}
+	return drift, err
+}
+
+// SetChannelAllocation 调整渠道分配后使Redis可用库存失效
+func (r *RedisLockRepository) SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error) {
+	allocation, err := r.InventoryRepository.SetChannelAllocation(ctx, key, channel, allocated, operator)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, key.ProductID, key.SkuID, key.WarehouseID)
+	return allocation, nil
+}
+
+// SetSafetyStock 调整安全库存后使Redis可用库存失效
+func (r *RedisLockRepository) SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error {
+	if err := r.InventoryRepository.SetSafetyStock(ctx, key, safetyStock, operator); err != nil {
+		return err
+	}
+	r.invalidate(ctx, key.ProductID, key.SkuID, key.WarehouseID)
+	return nil
+}
+
+// invalidate 删除可用库存键。未落库的锁定数量单独记录，下次预热时会被扣除，所以删除是安全的
+func (r *RedisLockRepository) invalidate(ctx context.Context, productID int64, skuID int64, warehouseID int) {
+	key := buildAvailableKey(productID, skuID, warehouseID)
+	if err := r.client.Del(ctx, key).Err(); err != nil {
+		r.logger.Warn("Failed to invalidate available stock",
+			zap.String("key", key),
+			zap.Error(err))
+	}
+}
+
+// Warm 将所有库存记录的可用库存预热到Redis
+func (r *RedisLockRepository) Warm(ctx context.Context, batchSize int) error {
+	var afterID int64
+	for {
+		inventories, err := r.InventoryRepository.ListInventories(ctx, afterID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(inventories) == 0 {
+			return nil
+		}
+
+		keys := make([]string, 0, len(inventories))
+		for _, inv := range inventories {
+			keys = append(keys, buildAvailableKey(inv.ProductID, inv.SkuID, inv.WarehouseID))
+		}
+		if err := r.warmKeys(ctx, keys, true); err != nil {
+			return err
+		}
+
+		afterID = inventories[len(inventories)-1].ID
+	}
+}
+
+// Reconcile 以MySQL为准重新计算已预热的可用库存，修正Redis与数据库之间的偏差
+func (r *RedisLockRepository) Reconcile(ctx context.Context, batchSize int) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.client.SScan(ctx, availableKeySet, cursor, availableKeyPrefix+"*", int64(batchSize)).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := r.warmKeys(ctx, keys, false); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// warmKeys 从数据库计算并写入可用库存。先读取未落库数量再读数据库，
+// 期间若有锁定写入MySQL只会导致重复扣除，结果偏保守，不会超卖
+func (r *RedisLockRepository) warmKeys(ctx context.Context, keys []string, onlyIfMissing bool) error {
+	pending, err := r.client.HMGet(ctx, pendingLockHash, keys...).Result()
+	if err != nil {
+		return err
+	}
+
+	productIDs := make([]int64, 0, len(keys))
+	warehouseIDs := make([]int, 0, len(keys))
+	for _, key := range keys {
+		productID, _, warehouseID, err := parseAvailableKey(key)
+		if err != nil {
+			return err
+		}
+		productIDs = append(productIDs, productID)
+		warehouseIDs = append(warehouseIDs, warehouseID)
+	}
+
+	inventories, err := r.InventoryRepository.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		return err
+	}
+	available := make(map[string]int, len(inventories))
+	for _, inv := range inventories {
+		available[buildAvailableKey(inv.ProductID, inv.SkuID, inv.WarehouseID)] = inv.AvailableStock()
+	}
+
+	flag := "0"
+	if onlyIfMissing {
+		flag = "1"
+	}
+	for i, key := range keys {
+		dbAvailable, ok := available[key]
+		if !ok {
+			// 数据库中没有该库存记录
+			continue
+		}
+		pendingSeen := 0
+		if v, ok := pending[i].(string); ok {
+			pendingSeen, _ = strconv.Atoi(v)
+		}
+		if err := warmScript.Run(ctx, r.client, []string{key, pendingLockHash, availableKeySet},
+			dbAvailable, pendingSeen, flag).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FlushPendingLock 将尚未写入MySQL的锁定同步写入，没有待写入记录时直接返回
+func (r *RedisLockRepository) FlushPendingLock(ctx context.Context, orderSN string) error {
+	data, err := r.client.Get(ctx, pendingOrderKeyPrefix+orderSN).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
+
+	var lock pendingLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return err
+	}
+	lock.applyLocked()
+
+	// Redis中已确定锁定的数量，写入MySQL时整单锁定
+	result, err := r.InventoryRepository.LockStock(ctx, lock.OrderSN, lock.Items, lock.ExpireTime, valueobject.LockOptions{})
+	if err != nil {
+		// 并发写入时唯一索引冲突，以已存在的记录为准
+		if _, getErr := r.InventoryRepository.GetStockSellDetail(ctx, orderSN); getErr != nil {
+			return err
+		}
+	} else if !result.Success {
+		// MySQL库存与Redis不一致导致无法落库，先发布锁定失败事件通知订单方，
+		// 事件写入成功后再归还Redis中的锁定，写入失败时保留待写入记录等待重试
+		r.logger.Error("Failed to persist redis stock lock",
+			zap.String("order_sn", orderSN),
+			zap.Any("fail_items", result.FailItems))
+		if err := r.appendLockFailedEvent(ctx, &lock, result.FailItems); err != nil {
+			return err
+		}
+		for _, item := range lock.Items {
+			key := buildAvailableKey(item.ProductID, item.SkuID, item.WarehouseID)
+			if err := incrIfExistsScript.Run(ctx, r.client, []string{key}, item.Quantity).Err(); err != nil {
+				r.logger.Warn("Failed to return available stock to redis",
+					zap.String("key", key),
+					zap.Error(err))
+			}
+		}
+	}
+
+	return r.ack(ctx, &lock)
+}
+
+// appendLockFailedEvent 写入锁定失败事件，Remark中记录无法锁定的商品
+func (r *RedisLockRepository) appendLockFailedEvent(ctx context.Context, lock *pendingLock, failItems []*valueobject.LockFailItem) error {
+	items := make([]*entity.StockEventItem, 0, len(lock.Items))
+	for _, item := range lock.Items {
+		items = append(items, &entity.StockEventItem{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			WarehouseID: item.WarehouseID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	failed := make([]string, 0, len(failItems))
+	for _, item := range failItems {
+		failed = append(failed, fmt.Sprintf("goods %d sku %d available %d", item.ProductID, item.SkuID, item.Available))
+	}
+
+	return r.outbox.Append(ctx, lock.OrderSN, &entity.StockEvent{
+		EventType: entity.EventStockLockFailed,
+		OrderSN:   lock.OrderSN,
+		Items:     items,
+		Remark:    "Insufficient stock in MySQL: " + strings.Join(failed, "; "),
+	})
+}
+
+// flushPendingLocks 同步写入写入队列和处理队列中的全部订单。订单仍留在队列中，
+// 异步写入时发现已写入只会将其移出队列
+func (r *RedisLockRepository) flushPendingLocks(ctx context.Context) error {
+	for _, queue := range []string{lockProcessingKey, lockQueueKey} {
+		orderSNs, err := r.client.LRange(ctx, queue, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		for _, orderSN := range orderSNs {
+			if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pendingInWarehouse 统计仓库在Redis中已锁定但尚未写入MySQL的数量
+func (r *RedisLockRepository) pendingInWarehouse(ctx context.Context, warehouseID int) (int, error) {
+	pending, err := r.client.HGetAll(ctx, pendingLockHash).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for key, value := range pending {
+		_, _, keyWarehouseID, err := parseAvailableKey(key)
+		if err != nil || keyWarehouseID != warehouseID {
+			continue
+		}
+		quantity, _ := strconv.Atoi(value)
+		total += max(quantity, 0)
+	}
+	return total, nil
+}
+
+// ProcessNextPendingLock 从写入队列中取出一个订单写入MySQL，队列为空时等待timeout后返回false
+func (r *RedisLockRepository) ProcessNextPendingLock(ctx context.Context, timeout time.Duration) (bool, error) {
+	orderSN, err := r.client.BRPopLPush(ctx, lockQueueKey, lockProcessingKey, timeout).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := r.FlushPendingLock(ctx, orderSN); err != nil {
+		return true, err
+	}
+
+	// 订单已被其他请求写入时只需从处理队列中移除
+	return true, r.client.LRem(ctx, lockProcessingKey, 0, orderSN).Err()
+}
+
+// RequeueProcessing 将上次异常退出时未处理完的订单放回写入队列
+func (r *RedisLockRepository) RequeueProcessing(ctx context.Context) error {
+	for {
+		_, err := r.client.RPopLPush(ctx, lockProcessingKey, lockQueueKey).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ack 确认订单已写入MySQL
+func (r *RedisLockRepository) ack(ctx context.Context, lock *pendingLock) error {
+	args := []interface{}{lock.OrderSN}
+	for _, item := range lock.Items {
+		args = append(args, buildAvailableKey(item.ProductID, item.SkuID, item.WarehouseID), item.Quantity)
+	}
+
+	keys := []string{pendingOrderKeyPrefix + lock.OrderSN, lockProcessingKey, pendingLockHash}
+	return ackScript.Run(ctx, r.client, keys, args...).Err()
+}
+
+// RedisLockTransferRepository 调拨单的每一步改变源仓或目标仓的库存后使对应的Redis可用库存失效
+type RedisLockTransferRepository struct {
+	TransferRepository
+	fastLock *RedisLockRepository
+}
+
+// NewRedisLockTransferRepository 创建与Redis快速锁定配合的调拨单仓储
+func NewRedisLockTransferRepository(base TransferRepository, fastLock *RedisLockRepository) *RedisLockTransferRepository {
+	return &RedisLockTransferRepository{
+		TransferRepository: base,
+		fastLock:           fastLock,
+	}
+}
+
+// CreateTransfer 创建调拨单预留源仓库存后使源仓可用库存失效
+func (r *RedisLockTransferRepository) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	if err := r.TransferRepository.CreateTransfer(ctx, order); err != nil {
+		return err
+	}
+	r.invalidateTransfer(ctx, order)
+	return nil
+}
+
+// ShipTransfer 发货扣减源仓库存后使可用库存失效
+func (r *RedisLockTransferRepository) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	if err := r.TransferRepository.ShipTransfer(ctx, transferSN, operator); err != nil {
+		return err
+	}
+	r.invalidateTransferSN(ctx, transferSN)
+	return nil
+}
+
+// ReceiveTransfer 收货增加目标仓库存后使可用库存失效
+func (r *RedisLockTransferRepository) ReceiveTransfer(ctx context.Context, transferSN string, operator string) error {
+	if err := r.TransferRepository.ReceiveTransfer(ctx, transferSN, operator); err != nil {
+		return err
+	}
+	r.invalidateTransferSN(ctx, transferSN)
+	return nil
+}
+
+// CancelTransfer 取消调拨释放预留或退回源仓后使可用库存失效
+func (r *RedisLockTransferRepository) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error {
+	if err := r.TransferRepository.CancelTransfer(ctx, transferSN, operator, reason); err != nil {
+		return err
+	}
+	r.invalidateTransferSN(ctx, transferSN)
+	return nil
+}
+
+// invalidateTransferSN 加载调拨单并使其涉及的可用库存失效
+func (r *RedisLockTransferRepository) invalidateTransferSN(ctx context.Context, transferSN string) {
+	order, err := r.TransferRepository.GetTransfer(ctx, transferSN)
+	if err != nil {
+		r.fastLock.logger.Warn("Failed to load transfer, redis stock will be corrected by reconciliation",
+			zap.String("transfer_sn", transferSN),
+			zap.Error(err))
+		return
+	}
+	r.invalidateTransfer(ctx, order)
+}
+
+// invalidateTransfer 使调拨单在源仓和目标仓涉及的可用库存失效
+func (r *RedisLockTransferRepository) invalidateTransfer(ctx context.Context, order *entity.TransferOrder) {
+	for _, item := range order.Items {
+		r.fastLock.invalidate(ctx, item.ProductID, item.SkuID, order.FromWarehouseID)
+		r.fastLock.invalidate(ctx, item.ProductID, item.SkuID, order.ToWarehouseID)
+	}
+}
+
+// RedisLockStocktakeRepository 盘点单提交调整库存后使盘点范围内的Redis可用库存失效
+type RedisLockStocktakeRepository struct {
+	StocktakeRepository
+	fastLock *RedisLockRepository
+}
+
+// NewRedisLockStocktakeRepository 创建与Redis快速锁定配合的盘点单仓储
+func NewRedisLockStocktakeRepository(base StocktakeRepository, fastLock *RedisLockRepository) *RedisLockStocktakeRepository {
+	return &RedisLockStocktakeRepository{
+		StocktakeRepository: base,
+		fastLock:            fastLock,
+	}
+}
+
+// CommitSession 提交盘点单后使盘点范围内的可用库存失效
+func (r *RedisLockStocktakeRepository) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	session, err := r.StocktakeRepository.CommitSession(ctx, sessionSN, operator)
+	if err != nil {
+		return session, err
+	}
+
+	for _, item := range session.Items {
+		r.fastLock.invalidate(ctx, item.ProductID, item.SkuID, session.WarehouseID)
+	}
+	return session, nil
+}
+
+// RedisLockWarehouseRepository 删除仓库前将Redis中尚未写入MySQL的锁定写入，避免只存在于Redis的锁定随仓库一起丢失
+type RedisLockWarehouseRepository struct {
+	WarehouseRepository
+	fastLock *RedisLockRepository
+}
+
+// NewRedisLockWarehouseRepository 创建与Redis快速锁定配合的仓库仓储
+func NewRedisLockWarehouseRepository(base WarehouseRepository, fastLock *RedisLockRepository) *RedisLockWarehouseRepository {
+	return &RedisLockWarehouseRepository{
+		WarehouseRepository: base,
+		fastLock:            fastLock,
+	}
+}
+
+// DeleteWarehouse 先写入待写入队列中的锁定，写入后仓库仍有待写入的锁定时拒绝删除，否则由底层仓储检查锁定数量
+func (r *RedisLockWarehouseRepository) DeleteWarehouse(ctx context.Context, id int) error {
+	if err := r.fastLock.flushPendingLocks(ctx); err != nil {
+		return err
+	}
+
+	pending, err := r.fastLock.pendingInWarehouse(ctx, id)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d locked in redis pending write", ErrWarehouseNotEmpty, pending)
+	}
+	return r.WarehouseRepository.DeleteWarehouse(ctx, id)
+}
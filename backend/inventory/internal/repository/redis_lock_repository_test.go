@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"testing"
+
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+func TestAvailableKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		productID   int64
+		skuID       int64
+		warehouseID int
+	}{
+		{1, 0, 1},
+		{1001, 2002, 3},
+	}
+	for _, tt := range tests {
+		key := buildAvailableKey(tt.productID, tt.skuID, tt.warehouseID)
+		productID, skuID, warehouseID, err := parseAvailableKey(key)
+		if err != nil {
+			t.Fatalf("parseAvailableKey(%q) error = %v", key, err)
+		}
+		if productID != tt.productID || skuID != tt.skuID || warehouseID != tt.warehouseID {
+			t.Errorf("parseAvailableKey(%q) = %d, %d, %d, want %d, %d, %d",
+				key, productID, skuID, warehouseID, tt.productID, tt.skuID, tt.warehouseID)
+		}
+	}
+
+	if _, _, _, err := parseAvailableKey("inventory:available:x"); err == nil {
+		t.Error("parseAvailableKey accepted a malformed key")
+	}
+}
+
+func TestPartialLockResult(t *testing.T) {
+	items := []*valueobject.StockOperation{
+		{ProductID: 1, WarehouseID: 1, Quantity: 3},
+		{ProductID: 2, WarehouseID: 1, Quantity: 2},
+		{ProductID: 3, WarehouseID: 1, Quantity: 4},
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		// 商品1全部锁定，商品2按可用数量锁定1件，商品3没有可用库存
+		result := partialLockResult(items, []int64{3, 10, 1, 1, 0, 0})
+		if !result.Success || !result.Partial {
+			t.Fatalf("Success = %t, Partial = %t, want both true", result.Success, result.Partial)
+		}
+		if len(result.LockedItems) != 2 ||
+			result.LockedItems[0].ProductID != 1 || result.LockedItems[0].Quantity != 3 ||
+			result.LockedItems[1].ProductID != 2 || result.LockedItems[1].Quantity != 1 {
+			t.Errorf("LockedItems = %+v", result.LockedItems)
+		}
+		if len(result.FailItems) != 2 ||
+			result.FailItems[0].ProductID != 2 || result.FailItems[0].Available != 1 ||
+			result.FailItems[1].ProductID != 3 || result.FailItems[1].Available != 0 {
+			t.Errorf("FailItems = %+v", result.FailItems)
+		}
+		// 锁定数量不能改到调用方传入的商品上
+		if items[1].Quantity != 2 {
+			t.Errorf("input item quantity changed to %d", items[1].Quantity)
+		}
+	})
+
+	t.Run("all locked", func(t *testing.T) {
+		result := partialLockResult(items, []int64{3, 3, 2, 5, 4, 4})
+		if !result.Success || result.Partial || len(result.FailItems) != 0 || len(result.LockedItems) != 3 {
+			t.Errorf("result = %+v", result)
+		}
+	})
+
+	t.Run("nothing locked", func(t *testing.T) {
+		result := partialLockResult(items, []int64{0, 0, 0, 1, 0, 0})
+		if result.Success || len(result.LockedItems) != 0 || len(result.FailItems) != 3 {
+			t.Errorf("result = %+v", result)
+		}
+	})
+}
@@ -0,0 +1,415 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository/cache"
+)
+
+var (
+	// ErrInvalidStocktakeStatus 盘点单状态不允许当前操作
+	ErrInvalidStocktakeStatus = errors.New("invalid stocktake status")
+	// ErrProductNotInStocktake 商品不在盘点范围内
+	ErrProductNotInStocktake = errors.New("product not in stocktake scope")
+	// ErrStocktakeConflict 盘点差异应用后库存低于锁定数量，说明盘点期间库存变化超出预期
+	ErrStocktakeConflict = errors.New("stocktake variance conflicts with current stock")
+)
+
+// StocktakeRepositoryImpl 盘点单仓储实现
+type StocktakeRepositoryImpl struct {
+	db     *gorm.DB
+	cache  cache.InventoryCache
+	logger *zap.Logger
+}
+
+// NewStocktakeRepository 创建盘点单仓储
+func NewStocktakeRepository(db *gorm.DB, cache cache.InventoryCache, logger *zap.Logger) StocktakeRepository {
+	return &StocktakeRepositoryImpl{
+		db:     db,
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+// CreateSession 创建盘点单并为范围内的每个库存记录生成盘点明细，商品按SKU分别盘点。
+// 账面库存先取创建时的库存，录入时再更新
+func (r *StocktakeRepositoryImpl) CreateSession(ctx context.Context, session *entity.StocktakeSession, productIDs []int64) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("warehouse_id = ?", session.WarehouseID)
+		if len(productIDs) > 0 {
+			query = query.Where("goods IN ?", productIDs)
+		}
+
+		var inventories []*entity.Inventory
+		if err := query.Order("goods, sku_id").Find(&inventories).Error; err != nil {
+			return err
+		}
+
+		// 指定了商品时以指定范围为准，仓库中没有记录的商品按商品级库存盘点，账面库存为0
+		keys := make([]valueobject.SkuKey, 0, len(inventories))
+		stocks := make(map[valueobject.SkuKey]int, len(inventories))
+		found := make(map[int64]bool, len(inventories))
+		for _, inv := range inventories {
+			key := valueobject.SkuKey{ProductID: inv.ProductID, SkuID: inv.SkuID}
+			keys = append(keys, key)
+			stocks[key] = inv.Stock
+			found[inv.ProductID] = true
+		}
+		if len(productIDs) == 0 {
+			session.FullCount = true
+		}
+		for _, productID := range productIDs {
+			if !found[productID] {
+				keys = append(keys, valueobject.SkuKey{ProductID: productID})
+				found[productID] = true
+			}
+		}
+
+		now := time.Now()
+		session.Status = entity.StocktakeOpen
+		session.CreatedAt = now
+		session.UpdatedAt = now
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		session.Items = make([]*entity.StocktakeItem, 0, len(keys))
+		for _, key := range keys {
+			session.Items = append(session.Items, &entity.StocktakeItem{
+				SessionID: session.ID,
+				ProductID: key.ProductID,
+				SkuID:     key.SkuID,
+				BookStock: stocks[key],
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+		if len(session.Items) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(session.Items, 500).Error
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to create stocktake session",
+			zap.Error(err),
+			zap.String("session_sn", session.SessionSN),
+			zap.Int("warehouse_id", session.WarehouseID))
+		return err
+	}
+
+	return nil
+}
+
+// SubmitCounts 按商品SKU录入实盘数量。账面库存取录入时的库存，提交时只应用差异，
+// 这样从录入到提交期间的销售、调拨不会被盘点结果覆盖
+func (r *StocktakeRepositoryImpl) SubmitCounts(ctx context.Context, sessionSN string, counts map[valueobject.SkuKey]int, counter string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定盘点单，防止与提交、取消并发执行
+		var session entity.StocktakeSession
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("session_sn = ?", sessionSN).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if !session.IsOpen() {
+			return ErrInvalidStocktakeStatus
+		}
+
+		productIDs := make([]int64, 0, len(counts))
+		for key := range counts {
+			productIDs = append(productIDs, key.ProductID)
+		}
+
+		var inventories []*entity.Inventory
+		if err := tx.Where("warehouse_id = ? AND goods IN ?", session.WarehouseID, productIDs).
+			Find(&inventories).Error; err != nil {
+			return err
+		}
+		stocks := make(map[valueobject.SkuKey]int, len(inventories))
+		for _, inv := range inventories {
+			stocks[valueobject.SkuKey{ProductID: inv.ProductID, SkuID: inv.SkuID}] = inv.Stock
+		}
+
+		now := time.Now()
+		for key, counted := range counts {
+			res := tx.Model(&entity.StocktakeItem{}).
+				Where("session_id = ? AND goods = ? AND sku_id = ?", session.ID, key.ProductID, key.SkuID).
+				Updates(map[string]interface{}{
+					"book_stock":    stocks[key],
+					"counted_stock": counted,
+					"count_time":    now,
+					"counter":       counter,
+					"updated_at":    now,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				continue
+			}
+
+			// 全仓盘点时允许录入盘点范围外的商品，例如系统中没有记录的商品；
+			// 按商品盘点时允许录入范围内商品的其他SKU
+			if !session.FullCount {
+				var inScope int64
+				if err := tx.Model(&entity.StocktakeItem{}).
+					Where("session_id = ? AND goods = ?", session.ID, key.ProductID).
+					Count(&inScope).Error; err != nil {
+					return err
+				}
+				if inScope == 0 {
+					return fmt.Errorf("%w: goods %d", ErrProductNotInStocktake, key.ProductID)
+				}
+			}
+			if err := tx.Create(&entity.StocktakeItem{
+				SessionID:    session.ID,
+				ProductID:    key.ProductID,
+				SkuID:        key.SkuID,
+				BookStock:    stocks[key],
+				CountedStock: &counted,
+				CountTime:    &now,
+				Counter:      counter,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to submit stocktake counts",
+			zap.Error(err),
+			zap.String("session_sn", sessionSN))
+		return err
+	}
+
+	return nil
+}
+
+// CommitSession 提交盘点单，按差异调整库存并以盘点单号记录调整历史
+func (r *StocktakeRepositoryImpl) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	var session entity.StocktakeSession
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("session_sn = ?", sessionSN).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		if !session.IsOpen() {
+			return ErrInvalidStocktakeStatus
+		}
+
+		if err := tx.Where("session_id = ?", session.ID).Order("goods, sku_id").Find(&session.Items).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, item := range session.Items {
+			variance := item.Variance()
+			if variance == 0 {
+				continue
+			}
+
+			if err := r.applyVariance(tx, session.WarehouseID, item.ProductID, item.SkuID, variance, now); err != nil {
+				return err
+			}
+
+			remark := "Stocktake " + session.SessionSN
+			if session.Remark != "" {
+				remark += ": " + session.Remark
+			}
+			if err := tx.Create(&entity.InventoryHistory{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: session.WarehouseID,
+				Quantity:    variance,
+				Operation:   entity.OperationAdjust,
+				Operator:    operator,
+				OrderSN:     session.SessionSN,
+				Remark:      remark,
+				CreatedAt:   now,
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := appendOutboxEvent(tx, stockAggregateID(item.ProductID, item.SkuID, session.WarehouseID), &entity.StockEvent{
+				EventType: entity.EventStockAdjusted,
+				OrderSN:   session.SessionSN,
+				Items: []*entity.StockEventItem{{
+					ProductID:   item.ProductID,
+					SkuID:       item.SkuID,
+					WarehouseID: session.WarehouseID,
+					Quantity:    variance,
+				}},
+				Operator:   operator,
+				Remark:     remark,
+				OccurredAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+
+		session.Status = entity.StocktakeCommitted
+		session.CommitTime = &now
+		session.UpdatedAt = now
+		return tx.Model(&entity.StocktakeSession{}).
+			Where("id = ?", session.ID).
+			Updates(map[string]interface{}{
+				"status":      entity.StocktakeCommitted,
+				"commit_time": now,
+				"updated_at":  now,
+			}).Error
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to commit stocktake session",
+			zap.Error(err),
+			zap.String("session_sn", sessionSN))
+		return nil, err
+	}
+
+	for _, item := range session.Items {
+		if item.Variance() == 0 {
+			continue
+		}
+		if err := r.cache.DeleteInventory(ctx, item.ProductID, item.SkuID, session.WarehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache",
+				zap.Int64("product_id", item.ProductID),
+				zap.Int64("sku_id", item.SkuID),
+				zap.Int("warehouse_id", session.WarehouseID),
+				zap.Error(err))
+		}
+	}
+
+	return &session, nil
+}
+
+// CancelSession 取消盘点单，不调整库存
+func (r *StocktakeRepositoryImpl) CancelSession(ctx context.Context, sessionSN string, operator string) error {
+	now := time.Now()
+	res := r.db.WithContext(ctx).Model(&entity.StocktakeSession{}).
+		Where("session_sn = ? AND status = ?", sessionSN, entity.StocktakeOpen).
+		Updates(map[string]interface{}{
+			"status":      entity.StocktakeCancelled,
+			"cancel_time": now,
+			"updated_at":  now,
+		})
+	if res.Error != nil {
+		r.logger.Error("Failed to cancel stocktake session",
+			zap.Error(res.Error),
+			zap.String("session_sn", sessionSN))
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.GetSession(ctx, sessionSN); err != nil {
+			return err
+		}
+		return ErrInvalidStocktakeStatus
+	}
+
+	return nil
+}
+
+// GetSession 获取盘点单及明细
+func (r *StocktakeRepositoryImpl) GetSession(ctx context.Context, sessionSN string) (*entity.StocktakeSession, error) {
+	var session entity.StocktakeSession
+	err := r.db.WithContext(ctx).Where("session_sn = ?", sessionSN).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		r.logger.Error("Failed to get stocktake session",
+			zap.Error(err),
+			zap.String("session_sn", sessionSN))
+		return nil, err
+	}
+
+	if err := r.db.WithContext(ctx).Where("session_id = ?", session.ID).Order("goods, sku_id").Find(&session.Items).Error; err != nil {
+		r.logger.Error("Failed to get stocktake items",
+			zap.Error(err),
+			zap.String("session_sn", sessionSN))
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// applyVariance 按盘点差异调整库存，库存记录不存在时以盘盈数量创建。
+// 盘亏后的库存不能低于锁定数量，否则未完结的订单锁定的库存将不存在
+func (r *StocktakeRepositoryImpl) applyVariance(tx *gorm.DB, warehouseID int, productID int64, skuID int64, variance int, now time.Time) error {
+	if variance < 0 {
+		return r.applyLoss(tx, warehouseID, productID, skuID, -variance, now)
+	}
+
+	res := tx.Model(&entity.Inventory{}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+		Updates(map[string]interface{}{
+			"stocks":     gorm.Expr("stocks + ?", variance),
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	return tx.Create(&entity.Inventory{
+		ProductID:      productID,
+		SkuID:          skuID,
+		WarehouseID:    warehouseID,
+		Stock:          variance,
+		AlertThreshold: 10, // 默认预警阈值
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}).Error
+}
+
+// applyLoss 按盘亏数量减少库存，盘亏数量按先到期先出从批次中扣减，扣减的过期数量同时从过期数量中减去
+func (r *StocktakeRepositoryImpl) applyLoss(tx *gorm.DB, warehouseID int, productID int64, skuID int64, loss int, now time.Time) error {
+	var inv entity.Inventory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+		First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: goods %d sku %d not found", ErrStocktakeConflict, productID, skuID)
+	}
+	if err != nil {
+		return err
+	}
+	if inv.Stock-loss < inv.LockStock {
+		return fmt.Errorf("%w: goods %d sku %d stock %d locked %d variance %d",
+			ErrStocktakeConflict, productID, skuID, inv.Stock, inv.LockStock, -loss)
+	}
+
+	expired, err := drawDownLots(tx, &inv, loss, true, now)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&entity.Inventory{}).
+		Where("id = ?", inv.ID).
+		Updates(map[string]interface{}{
+			"stocks":         gorm.Expr("stocks - ?", loss),
+			"expired_stocks": gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
+			"version":        gorm.Expr("version + 1"),
+			"updated_at":     now,
+		}).Error
+}
@@ -0,0 +1,404 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository/cache"
+)
+
+var (
+	// ErrInvalidTransferStatus 调拨单状态不允许当前操作
+	ErrInvalidTransferStatus = errors.New("invalid transfer status")
+)
+
+// TransferRepositoryImpl 调拨单仓储实现
+type TransferRepositoryImpl struct {
+	db     *gorm.DB
+	cache  cache.InventoryCache
+	logger *zap.Logger
+}
+
+// NewTransferRepository 创建调拨单仓储
+func NewTransferRepository(db *gorm.DB, cache cache.InventoryCache, logger *zap.Logger) TransferRepository {
+	return &TransferRepositoryImpl{
+		db:     db,
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+// CreateTransfer 创建调拨单并预留源仓库存
+func (r *TransferRepositoryImpl) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, item := range order.Items {
+			var inv entity.Inventory
+			if err := tx.Where("goods = ? AND sku_id = ? AND warehouse_id = ?", item.ProductID, item.SkuID, order.FromWarehouseID).First(&inv).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrInsufficientStock
+				}
+				return err
+			}
+
+			if !inv.IsAvailable(item.Quantity) {
+				return ErrInsufficientStock
+			}
+
+			res := tx.Model(&entity.Inventory{}).
+				Where("id = ? AND version = ? AND stocks - lock_stocks - expired_stocks - safety_stocks - reserved_stocks - backorder_stocks >= ?", inv.ID, inv.Version, item.Quantity).
+				Updates(map[string]interface{}{
+					"lock_stocks": gorm.Expr("lock_stocks + ?", item.Quantity),
+					"version":     inv.Version + 1,
+					"updated_at":  time.Now(),
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrInsufficientStock
+			}
+
+			if err := r.recordHistory(tx, order, item, order.FromWarehouseID, item.Quantity,
+				entity.OperationTransferReserve, order.Operator, order.Remark); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		order.Status = entity.TransferCreated
+		order.CreatedAt = now
+		order.UpdatedAt = now
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		// 预留源仓库存与订单锁定相同，发布库存锁定事件
+		return r.appendTransferEvent(tx, order, entity.EventStockLocked, order.FromWarehouseID, order.Operator, order.Remark, now)
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to create transfer",
+			zap.Error(err),
+			zap.String("transfer_sn", order.TransferSN))
+		return err
+	}
+
+	r.invalidateCache(ctx, order, order.FromWarehouseID)
+	return nil
+}
+
+// ShipTransfer 调拨发货，源仓扣减库存并释放预留，调拨单进入在途状态
+func (r *TransferRepositoryImpl) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	order, err := r.GetTransfer(ctx, transferSN)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := r.transitStatus(tx, transferSN, entity.TransferCreated, entity.TransferInTransit, map[string]interface{}{
+			"ship_time": now,
+		}); err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			var inv entity.Inventory
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("goods = ? AND sku_id = ? AND warehouse_id = ?", item.ProductID, item.SkuID, order.FromWarehouseID).
+				First(&inv).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrStockNotLocked
+				}
+				return err
+			}
+			if inv.LockStock < item.Quantity || inv.Stock < item.Quantity {
+				return ErrStockNotLocked
+			}
+
+			// 预留时只占用了可售库存，发货按先到期先出从未过期的批次中扣减
+			expired, err := drawDownLots(tx, &inv, item.Quantity, false, now)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&entity.Inventory{}).
+				Where("id = ?", inv.ID).
+				Updates(map[string]interface{}{
+					"stocks":         gorm.Expr("stocks - ?", item.Quantity),
+					"lock_stocks":    gorm.Expr("lock_stocks - ?", item.Quantity),
+					"expired_stocks": gorm.Expr("GREATEST(expired_stocks - ?, 0)", expired),
+					"version":        gorm.Expr("version + 1"),
+					"updated_at":     now,
+				}).Error; err != nil {
+				return err
+			}
+
+			if err := r.recordHistory(tx, order, item, order.FromWarehouseID, -item.Quantity,
+				entity.OperationTransferOut, operator, "Transfer shipped"); err != nil {
+				return err
+			}
+		}
+
+		// 发货扣减源仓的预留与订单确认扣减相同，发布库存扣减事件
+		return r.appendTransferEvent(tx, order, entity.EventStockReduced, order.FromWarehouseID, operator, "Transfer shipped", now)
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to ship transfer",
+			zap.Error(err),
+			zap.String("transfer_sn", transferSN))
+		return err
+	}
+
+	r.invalidateCache(ctx, order, order.FromWarehouseID)
+	return nil
+}
+
+// ReceiveTransfer 调拨收货，目标仓增加库存
+func (r *TransferRepositoryImpl) ReceiveTransfer(ctx context.Context, transferSN string, operator string) error {
+	order, err := r.GetTransfer(ctx, transferSN)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.transitStatus(tx, transferSN, entity.TransferInTransit, entity.TransferReceived, map[string]interface{}{
+			"receive_time": time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			stock, err := r.addStock(tx, item.ProductID, item.SkuID, order.ToWarehouseID, item.Quantity)
+			if err != nil {
+				return err
+			}
+
+			if err := r.recordHistory(tx, order, item, order.ToWarehouseID, item.Quantity,
+				entity.OperationTransferIn, operator, "Transfer received"); err != nil {
+				return err
+			}
+			if err := appendAdjustedEvent(tx, item.ProductID, item.SkuID, order.ToWarehouseID, item.Quantity, stock,
+				operator, "Transfer received "+transferSN); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to receive transfer",
+			zap.Error(err),
+			zap.String("transfer_sn", transferSN))
+		return err
+	}
+
+	r.invalidateCache(ctx, order, order.ToWarehouseID)
+	return nil
+}
+
+// CancelTransfer 取消调拨。未发货时释放源仓预留，在途时将库存退回源仓
+func (r *TransferRepositoryImpl) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error {
+	order, err := r.GetTransfer(ctx, transferSN)
+	if err != nil {
+		return err
+	}
+	if !order.CanCancel() {
+		return ErrInvalidTransferStatus
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.transitStatus(tx, transferSN, order.Status, entity.TransferCancelled, map[string]interface{}{
+			"cancel_time": time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			if order.Status == entity.TransferCreated {
+				// 释放源仓预留
+				res := tx.Model(&entity.Inventory{}).
+					Where("goods = ? AND sku_id = ? AND warehouse_id = ? AND lock_stocks >= ?", item.ProductID, item.SkuID, order.FromWarehouseID, item.Quantity).
+					Updates(map[string]interface{}{
+						"lock_stocks": gorm.Expr("lock_stocks - ?", item.Quantity),
+						"version":     gorm.Expr("version + 1"),
+						"updated_at":  time.Now(),
+					})
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected == 0 {
+					return ErrStockNotLocked
+				}
+
+				if err := r.recordHistory(tx, order, item, order.FromWarehouseID, -item.Quantity,
+					entity.OperationTransferCancel, operator, reason); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// 在途货物退回源仓
+			stock, err := r.addStock(tx, item.ProductID, item.SkuID, order.FromWarehouseID, item.Quantity)
+			if err != nil {
+				return err
+			}
+
+			if err := r.recordHistory(tx, order, item, order.FromWarehouseID, item.Quantity,
+				entity.OperationTransferIn, operator, reason); err != nil {
+				return err
+			}
+			if err := appendAdjustedEvent(tx, item.ProductID, item.SkuID, order.FromWarehouseID, item.Quantity, stock,
+				operator, "Transfer cancelled "+transferSN); err != nil {
+				return err
+			}
+		}
+
+		// 释放源仓预留与订单归还锁定相同，发布库存归还事件
+		if order.Status == entity.TransferCreated {
+			return r.appendTransferEvent(tx, order, entity.EventStockReturned, order.FromWarehouseID, operator, reason, time.Now())
+		}
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Error("Failed to cancel transfer",
+			zap.Error(err),
+			zap.String("transfer_sn", transferSN))
+		return err
+	}
+
+	r.invalidateCache(ctx, order, order.FromWarehouseID)
+	return nil
+}
+
+// GetTransfer 获取调拨单
+func (r *TransferRepositoryImpl) GetTransfer(ctx context.Context, transferSN string) (*entity.TransferOrder, error) {
+	var order entity.TransferOrder
+	err := r.db.WithContext(ctx).Where("transfer_sn = ?", transferSN).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		r.logger.Error("Failed to get transfer",
+			zap.Error(err),
+			zap.String("transfer_sn", transferSN))
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// transitStatus 以当前状态为条件更新调拨单状态，防止并发操作重复执行
+func (r *TransferRepositoryImpl) transitStatus(tx *gorm.DB, transferSN string, from, to entity.TransferStatus, extra map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"status":     to,
+		"updated_at": time.Now(),
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+
+	res := tx.Model(&entity.TransferOrder{}).
+		Where("transfer_sn = ? AND status = ?", transferSN, from).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidTransferStatus
+	}
+
+	return nil
+}
+
+// addStock 增加仓库库存，库存记录不存在时创建，返回增加后的库存
+func (r *TransferRepositoryImpl) addStock(tx *gorm.DB, productID int64, skuID int64, warehouseID int, quantity int) (int, error) {
+	res := tx.Model(&entity.Inventory{}).
+		Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+		Updates(map[string]interface{}{
+			"stocks":     gorm.Expr("stocks + ?", quantity),
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected > 0 {
+		var stock int
+		err := tx.Model(&entity.Inventory{}).
+			Where("goods = ? AND sku_id = ? AND warehouse_id = ?", productID, skuID, warehouseID).
+			Pluck("stocks", &stock).Error
+		return stock, err
+	}
+
+	now := time.Now()
+	return quantity, tx.Create(&entity.Inventory{
+		ProductID:      productID,
+		SkuID:          skuID,
+		WarehouseID:    warehouseID,
+		Stock:          quantity,
+		AlertThreshold: 10, // 默认预警阈值
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}).Error
+}
+
+// recordHistory 记录调拨库存历史，调拨流水与库存变更必须同时成功以保证账实一致
+func (r *TransferRepositoryImpl) recordHistory(tx *gorm.DB, order *entity.TransferOrder, item *entity.TransferItem,
+	warehouseID int, quantity int, operation entity.OperationType, operator string, remark string) error {
+	return tx.Create(&entity.InventoryHistory{
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: warehouseID,
+		Quantity:    quantity,
+		Operation:   operation,
+		Operator:    operator,
+		OrderSN:     order.TransferSN,
+		Remark:      remark,
+		CreatedAt:   time.Now(),
+	}).Error
+}
+
+// appendTransferEvent 以调拨单号为聚合ID写入调拨单全部商品在指定仓库的库存事件
+func (r *TransferRepositoryImpl) appendTransferEvent(tx *gorm.DB, order *entity.TransferOrder, eventType string,
+	warehouseID int, operator string, remark string, now time.Time) error {
+	items := make([]*entity.StockEventItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &entity.StockEventItem{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			WarehouseID: warehouseID,
+			Quantity:    item.Quantity,
+		})
+	}
+	return appendOutboxEvent(tx, order.TransferSN, &entity.StockEvent{
+		EventType:  eventType,
+		OrderSN:    order.TransferSN,
+		Items:      items,
+		Operator:   operator,
+		Remark:     remark,
+		OccurredAt: now,
+	})
+}
+
+// invalidateCache 删除调拨涉及商品的库存缓存
+func (r *TransferRepositoryImpl) invalidateCache(ctx context.Context, order *entity.TransferOrder, warehouseID int) {
+	for _, item := range order.Items {
+		if err := r.cache.DeleteInventory(ctx, item.ProductID, item.SkuID, warehouseID); err != nil {
+			r.logger.Warn("Failed to delete inventory cache",
+				zap.Int64("product_id", item.ProductID),
+				zap.Int64("sku_id", item.SkuID),
+				zap.Int("warehouse_id", warehouseID),
+				zap.Error(err))
+		}
+	}
+}
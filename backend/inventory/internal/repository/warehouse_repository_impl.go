@@ -3,14 +3,20 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 	
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	
 	"shop/backend/inventory/internal/domain/entity"
 )
 
+// ErrWarehouseNotEmpty 仓库仍有库存、锁定或在途调拨
+var ErrWarehouseNotEmpty = errors.New("warehouse still holds stock")
+
 // WarehouseRepositoryImpl 仓库仓储实现
 type WarehouseRepositoryImpl struct {
 	db     *gorm.DB
@@ -59,13 +65,15 @@ func (r *WarehouseRepositoryImpl) GetWarehouseByName(ctx context.Context, name s
 	return &warehouse, nil
 }
 
-// ListWarehouses 获取仓库列表
-func (r *WarehouseRepositoryImpl) ListWarehouses(ctx context.Context, page, pageSize int) ([]*entity.Warehouse, int64, error) {
+// ListWarehouses 按条件分页获取仓库列表
+func (r *WarehouseRepositoryImpl) ListWarehouses(ctx context.Context, filter *WarehouseFilter, page, pageSize int) ([]*entity.Warehouse, int64, error) {
 	var warehouses []*entity.Warehouse
 	var total int64
 	
+	query := r.applyFilter(r.db.WithContext(ctx).Model(&entity.Warehouse{}), filter)
+	
 	// 计算总数
-	err := r.db.WithContext(ctx).Model(&entity.Warehouse{}).Count(&total).Error
+	err := query.Count(&total).Error
 	if err != nil {
 		r.logger.Error("Failed to count warehouses", zap.Error(err))
 		return nil, 0, err
@@ -73,7 +81,7 @@ func (r *WarehouseRepositoryImpl) ListWarehouses(ctx context.Context, page, page
 	
 	// 分页查询
 	offset := (page - 1) * pageSize
-	err = r.db.WithContext(ctx).
+	err = query.
 		Order("id ASC").
 		Offset(offset).
 		Limit(pageSize).
@@ -86,6 +94,48 @@ func (r *WarehouseRepositoryImpl) ListWarehouses(ctx context.Context, page, page
 	return warehouses, total, nil
 }
 
+// applyFilter 将查询条件转换为SQL条件
+func (r *WarehouseRepositoryImpl) applyFilter(query *gorm.DB, filter *WarehouseFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+	
+	if filter.Keyword != "" {
+		keyword := "%" + escapeLike(filter.Keyword) + "%"
+		query = query.Where("name LIKE ? OR address LIKE ? OR contact LIKE ?", keyword, keyword, keyword)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.RegionCode != "" {
+		query = query.Where("region_code = ? OR FIND_IN_SET(?, served_regions) > 0", filter.RegionCode, filter.RegionCode)
+	}
+	if filter.Capabilities != 0 {
+		query = query.Where("capabilities & ? = ?", filter.Capabilities, filter.Capabilities)
+	}
+	return query
+}
+
+// escapeLike 转义LIKE中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ListActiveWarehouses 获取所有启用状态的仓库
+func (r *WarehouseRepositoryImpl) ListActiveWarehouses(ctx context.Context) ([]*entity.Warehouse, error) {
+	var warehouses []*entity.Warehouse
+	err := r.db.WithContext(ctx).
+		Where("status = ?", 1).
+		Order("id ASC").
+		Find(&warehouses).Error
+	if err != nil {
+		r.logger.Error("Failed to list active warehouses", zap.Error(err))
+		return nil, err
+	}
+	
+	return warehouses, nil
+}
+
 // CreateWarehouse 创建仓库
 func (r *WarehouseRepositoryImpl) CreateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error {
 	// 设置时间字段
@@ -112,12 +162,18 @@ func (r *WarehouseRepositoryImpl) UpdateWarehouse(ctx context.Context, warehouse
 	err := r.db.WithContext(ctx).Model(&entity.Warehouse{}).
 		Where("id = ?", warehouse.ID).
 		Updates(map[string]interface{}{
-			"name":       warehouse.Name,
-			"address":    warehouse.Address,
-			"contact":    warehouse.Contact,
-			"phone":      warehouse.Phone,
-			"status":     warehouse.Status,
-			"updated_at": warehouse.UpdatedAt,
+			"name":           warehouse.Name,
+			"address":        warehouse.Address,
+			"contact":        warehouse.Contact,
+			"phone":          warehouse.Phone,
+			"status":         warehouse.Status,
+			"region_code":    warehouse.RegionCode,
+			"latitude":       warehouse.Latitude,
+			"longitude":      warehouse.Longitude,
+			"served_regions": warehouse.ServedRegions,
+			"capacity":       warehouse.Capacity,
+			"capabilities":   warehouse.Capabilities,
+			"updated_at":     warehouse.UpdatedAt,
 		}).Error
 	if err != nil {
 		r.logger.Error("Failed to update warehouse", 
@@ -129,11 +185,73 @@ func (r *WarehouseRepositoryImpl) UpdateWarehouse(ctx context.Context, warehouse
 	return nil
 }
 
-// DeleteWarehouse 删除仓库
+// DeleteWarehouse 删除仓库，仓库仍有库存、锁定、在途调拨、未收齐的入库单或排队中的缺货预订时拒绝删除。
+// 锁定仓库记录后再检查，与同一仓库的其他删除或修改串行
 func (r *WarehouseRepositoryImpl) DeleteWarehouse(ctx context.Context, id int) error {
-	// 使用软删除
-	err := r.db.WithContext(ctx).Delete(&entity.Warehouse{}, id).Error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var warehouse entity.Warehouse
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).
+			First(&warehouse).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+		
+		var holding struct {
+			Stocks     int64
+			LockStocks int64
+		}
+		if err := tx.Model(&entity.Inventory{}).
+			Select("COALESCE(SUM(stocks), 0) AS stocks, COALESCE(SUM(lock_stocks), 0) AS lock_stocks").
+			Where("warehouse_id = ?", id).
+			Scan(&holding).Error; err != nil {
+			return err
+		}
+		if holding.Stocks > 0 || holding.LockStocks > 0 {
+			return fmt.Errorf("%w: stocks %d, locked %d", ErrWarehouseNotEmpty, holding.Stocks, holding.LockStocks)
+		}
+		
+		// 发往该仓库的在途调拨收货后会产生库存
+		var inTransit int64
+		if err := tx.Model(&entity.TransferOrder{}).
+			Where("to_warehouse_id = ? AND status = ?", id, entity.TransferInTransit).
+			Count(&inTransit).Error; err != nil {
+			return err
+		}
+		if inTransit > 0 {
+			return fmt.Errorf("%w: %d transfers in transit", ErrWarehouseNotEmpty, inTransit)
+		}
+		
+		// 未收齐的采购入库单收货后会产生库存
+		var openInbound int64
+		if err := tx.Model(&entity.InboundOrder{}).
+			Where("warehouse_id = ? AND status IN ?", id, []entity.InboundStatus{entity.InboundCreated, entity.InboundPartial}).
+			Count(&openInbound).Error; err != nil {
+			return err
+		}
+		if openInbound > 0 {
+			return fmt.Errorf("%w: %d open inbound orders", ErrWarehouseNotEmpty, openInbound)
+		}
+		
+		// 排队中的缺货预订到货后会转为该仓库的锁定
+		var queued int64
+		if err := tx.Model(&entity.InventoryBackorder{}).
+			Where("warehouse_id = ? AND status = ?", id, entity.BackorderQueued).
+			Count(&queued).Error; err != nil {
+			return err
+		}
+		if queued > 0 {
+			return fmt.Errorf("%w: %d backorders queued", ErrWarehouseNotEmpty, queued)
+		}
+		
+		return tx.Delete(&entity.Warehouse{}, id).Error
+	})
 	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) || errors.Is(err, ErrWarehouseNotEmpty) {
+			return err
+		}
 		r.logger.Error("Failed to delete warehouse", 
 			zap.Int("id", id), 
 			zap.Error(err))
@@ -0,0 +1,416 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/watch"
+)
+
+// 默认合并推送的间隔
+const defaultWatchFlushInterval = 200 * time.Millisecond
+
+// ChangeNotifier 收集库存数量或锁定数量发生变化的记录，按间隔合并后读取最新库存推送给订阅者。
+// 同一记录在一个间隔内的多次变更只推送一次，避免秒杀等高频锁定放大数据库读取
+type ChangeNotifier struct {
+	repo     InventoryRepository
+	hub      *watch.Hub
+	interval time.Duration
+	mu       sync.Mutex
+	pending  map[stockKey]bool
+	logger   *zap.Logger
+}
+
+// NewChangeNotifier 创建库存变更通知器，repo用于读取最新库存，应直接读取数据库
+func NewChangeNotifier(repo InventoryRepository, hub *watch.Hub, interval time.Duration, logger *zap.Logger) *ChangeNotifier {
+	if interval <= 0 {
+		interval = defaultWatchFlushInterval
+	}
+
+	return &ChangeNotifier{
+		repo:     repo,
+		hub:      hub,
+		interval: interval,
+		pending:  make(map[stockKey]bool),
+		logger:   logger,
+	}
+}
+
+// Run 按间隔推送收集到的变更，直到ctx被取消
+func (n *ChangeNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.flush(ctx)
+		}
+	}
+}
+
+// notify 登记发生变化的库存记录，没有订阅时直接忽略
+func (n *ChangeNotifier) notify(keys []stockKey) {
+	if len(keys) == 0 || !n.hub.HasSubscribers() {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		n.pending[key] = true
+	}
+}
+
+// flush 读取变更记录的最新库存并推送，读取失败时丢弃本批变更，订阅方可重新订阅获取最新库存
+func (n *ChangeNotifier) flush(ctx context.Context) {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[stockKey]bool)
+	n.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	productSet := make(map[int64]bool, len(pending))
+	warehouseSet := make(map[int]bool)
+	for key := range pending {
+		productSet[key.productID] = true
+		warehouseSet[key.warehouseID] = true
+	}
+	productIDs := make([]int64, 0, len(productSet))
+	for productID := range productSet {
+		productIDs = append(productIDs, productID)
+	}
+	warehouseIDs := make([]int, 0, len(warehouseSet))
+	for warehouseID := range warehouseSet {
+		warehouseIDs = append(warehouseIDs, warehouseID)
+	}
+
+	inventories, err := n.repo.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		n.logger.Warn("Failed to load inventories for watchers",
+			zap.Int("changes", len(pending)),
+			zap.Error(err))
+		return
+	}
+
+	// 按商品和仓库批量查询可能多查出其他SKU，只推送实际变动的记录
+	changed := make([]*entity.Inventory, 0, len(pending))
+	for _, inv := range inventories {
+		key := stockKey{inv.ProductID, inv.SkuID, inv.WarehouseID}
+		if pending[key] {
+			changed = append(changed, inv)
+			delete(pending, key)
+		}
+	}
+	// 剩余的记录已被删除，如商品级库存拆分到SKU，推送数量为0的记录
+	for key := range pending {
+		changed = append(changed, &entity.Inventory{
+			ProductID:   key.productID,
+			SkuID:       key.skuID,
+			WarehouseID: key.warehouseID,
+		})
+	}
+
+	n.hub.Publish(changed)
+}
+
+// WatchingRepository 在库存数量或锁定数量变化后通知订阅者，其余操作委托给底层仓储。
+// 启用Redis快速锁定时应位于快速锁定仓储之下，锁定写入MySQL后才通知
+type WatchingRepository struct {
+	InventoryRepository
+	notifier *ChangeNotifier
+}
+
+// NewWatchingRepository 创建带变更通知的库存仓储
+func NewWatchingRepository(base InventoryRepository, notifier *ChangeNotifier) *WatchingRepository {
+	return &WatchingRepository{
+		InventoryRepository: base,
+		notifier:            notifier,
+	}
+}
+
+// SetInventory 设置库存后通知
+func (r *WatchingRepository) SetInventory(ctx context.Context, inventory *entity.Inventory) error {
+	if err := r.InventoryRepository.SetInventory(ctx, inventory); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{inventory.ProductID, inventory.SkuID, inventory.WarehouseID}})
+	return nil
+}
+
+// SetInventories 批量设置库存后通知
+func (r *WatchingRepository) SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error {
+	if err := r.InventoryRepository.SetInventories(ctx, inventories, operator, remark); err != nil {
+		return err
+	}
+
+	keys := make([]stockKey, 0, len(inventories))
+	for _, inventory := range inventories {
+		keys = append(keys, stockKey{inventory.ProductID, inventory.SkuID, inventory.WarehouseID})
+	}
+	r.notifier.notify(keys)
+	return nil
+}
+
+// LockStock 锁定成功后通知实际锁定的记录
+func (r *WatchingRepository) LockStock(ctx context.Context, orderSN string, items []*valueobject.StockOperation, expireTime *time.Time, opts valueobject.LockOptions) (*valueobject.LockResult, error) {
+	result, err := r.InventoryRepository.LockStock(ctx, orderSN, items, expireTime, opts)
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	keys := make([]stockKey, 0, len(result.LockedItems))
+	for _, item := range result.LockedItems {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, item.WarehouseID})
+	}
+	r.notifier.notify(keys)
+	return result, nil
+}
+
+// UnlockStock 解锁后通知订单涉及的记录
+func (r *WatchingRepository) UnlockStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	if err := r.InventoryRepository.UnlockStock(ctx, orderSN, lines); err != nil {
+		return err
+	}
+	r.notifyOrder(ctx, orderSN)
+	return nil
+}
+
+// ReduceStock 扣减后通知订单涉及的记录
+func (r *WatchingRepository) ReduceStock(ctx context.Context, orderSN string, lines []*entity.StockDetail) error {
+	if err := r.InventoryRepository.ReduceStock(ctx, orderSN, lines); err != nil {
+		return err
+	}
+	r.notifyOrder(ctx, orderSN)
+	return nil
+}
+
+// IncreaseStock 增加库存后通知
+func (r *WatchingRepository) IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error {
+	if err := r.InventoryRepository.IncreaseStock(ctx, productID, skuID, warehouseID, quantity, orderSN, remark, lot); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{productID, skuID, warehouseID}})
+	return nil
+}
+
+// DecreaseStock 减少库存后通知
+func (r *WatchingRepository) DecreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, remark string) error {
+	if err := r.InventoryRepository.DecreaseStock(ctx, productID, skuID, warehouseID, quantity, remark); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{productID, skuID, warehouseID}})
+	return nil
+}
+
+// AdjustStock 调整库存后通知
+func (r *WatchingRepository) AdjustStock(ctx context.Context, productID int64, skuID int64, warehouseID int, newStock int, operator string, remark string) error {
+	if err := r.InventoryRepository.AdjustStock(ctx, productID, skuID, warehouseID, newStock, operator, remark); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{productID, skuID, warehouseID}})
+	return nil
+}
+
+// SplitInventory 拆分后通知商品级库存和各SKU库存
+func (r *WatchingRepository) SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error {
+	if err := r.InventoryRepository.SplitInventory(ctx, productID, warehouseID, skuStocks, operator); err != nil {
+		return err
+	}
+
+	keys := []stockKey{{productID, 0, warehouseID}}
+	for skuID := range skuStocks {
+		keys = append(keys, stockKey{productID, skuID, warehouseID})
+	}
+	r.notifier.notify(keys)
+	return nil
+}
+
+// WriteOffExpiredLot 报废过期批次后通知
+func (r *WatchingRepository) WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error) {
+	lot, quantity, err := r.InventoryRepository.WriteOffExpiredLot(ctx, productID, skuID, warehouseID, lotNo, operator, remark)
+	if err != nil {
+		return nil, 0, err
+	}
+	if quantity > 0 {
+		r.notifier.notify([]stockKey{{productID, skuID, warehouseID}})
+	}
+	return lot, quantity, nil
+}
+
+// ReconcileLedger 修复锁定数量后通知
+func (r *WatchingRepository) ReconcileLedger(ctx context.Context, key valueobject.StockKey, repair bool, operator string) (*valueobject.LedgerDrift, error) {
+	drift, err := r.InventoryRepository.ReconcileLedger(ctx, key, repair, operator)
+	if err == nil && drift != nil && drift.Repaired && drift.LockDrift() != 0 {
+		r.notifier.notify([]stockKey{{key.ProductID, key.SkuID, key.WarehouseID}})
+	}
+	return drift, err
+}
+
+// SetChannelAllocation 调整渠道分配后通知
+func (r *WatchingRepository) SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error) {
+	allocation, err := r.InventoryRepository.SetChannelAllocation(ctx, key, channel, allocated, operator)
+	if err != nil {
+		return nil, err
+	}
+	r.notifier.notify([]stockKey{{key.ProductID, key.SkuID, key.WarehouseID}})
+	return allocation, nil
+}
+
+// SetSafetyStock 调整安全库存后通知
+func (r *WatchingRepository) SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error {
+	if err := r.InventoryRepository.SetSafetyStock(ctx, key, safetyStock, operator); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{key.ProductID, key.SkuID, key.WarehouseID}})
+	return nil
+}
+
+// SetBackorderLimit 调整预售上限后通知
+func (r *WatchingRepository) SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error {
+	if err := r.InventoryRepository.SetBackorderLimit(ctx, key, limit, operator); err != nil {
+		return err
+	}
+	r.notifier.notify([]stockKey{{key.ProductID, key.SkuID, key.WarehouseID}})
+	return nil
+}
+
+// FulfillBackorders 预订到货转为锁定后通知
+func (r *WatchingRepository) FulfillBackorders(ctx context.Context, key valueobject.StockKey) ([]*entity.InventoryBackorder, error) {
+	fulfilled, err := r.InventoryRepository.FulfillBackorders(ctx, key)
+	if len(fulfilled) > 0 {
+		r.notifier.notify([]stockKey{{key.ProductID, key.SkuID, key.WarehouseID}})
+	}
+	return fulfilled, err
+}
+
+// notifyOrder 通知订单锁定明细涉及的记录，读取失败时不通知
+func (r *WatchingRepository) notifyOrder(ctx context.Context, orderSN string) {
+	if !r.notifier.hub.HasSubscribers() {
+		return
+	}
+
+	detail, err := r.InventoryRepository.GetStockSellDetail(ctx, orderSN)
+	if err != nil {
+		return
+	}
+	keys := make([]stockKey, 0, len(detail.DetailItems))
+	for _, item := range detail.DetailItems {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, item.WarehouseID})
+	}
+	r.notifier.notify(keys)
+}
+
+// WatchingTransferRepository 调拨单的每一步改变源仓或目标仓的库存后通知订阅者
+type WatchingTransferRepository struct {
+	TransferRepository
+	notifier *ChangeNotifier
+}
+
+// NewWatchingTransferRepository 创建带变更通知的调拨单仓储
+func NewWatchingTransferRepository(base TransferRepository, notifier *ChangeNotifier) *WatchingTransferRepository {
+	return &WatchingTransferRepository{
+		TransferRepository: base,
+		notifier:           notifier,
+	}
+}
+
+// CreateTransfer 创建调拨单预留源仓库存后通知
+func (r *WatchingTransferRepository) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	if err := r.TransferRepository.CreateTransfer(ctx, order); err != nil {
+		return err
+	}
+	r.notifier.notify(transferKeys(order, order.FromWarehouseID))
+	return nil
+}
+
+// ShipTransfer 发货扣减源仓库存后通知
+func (r *WatchingTransferRepository) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	if err := r.TransferRepository.ShipTransfer(ctx, transferSN, operator); err != nil {
+		return err
+	}
+	r.notifyTransfer(ctx, transferSN, false)
+	return nil
+}
+
+// ReceiveTransfer 收货增加目标仓库存后通知
+func (r *WatchingTransferRepository) ReceiveTransfer(ctx context.Context, transferSN string, operator string) error {
+	if err := r.TransferRepository.ReceiveTransfer(ctx, transferSN, operator); err != nil {
+		return err
+	}
+	r.notifyTransfer(ctx, transferSN, true)
+	return nil
+}
+
+// CancelTransfer 取消调拨释放预留或退回源仓后通知
+func (r *WatchingTransferRepository) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) error {
+	if err := r.TransferRepository.CancelTransfer(ctx, transferSN, operator, reason); err != nil {
+		return err
+	}
+	r.notifyTransfer(ctx, transferSN, false)
+	return nil
+}
+
+// notifyTransfer 通知调拨单在源仓或目标仓涉及的记录
+func (r *WatchingTransferRepository) notifyTransfer(ctx context.Context, transferSN string, toWarehouse bool) {
+	if !r.notifier.hub.HasSubscribers() {
+		return
+	}
+
+	order, err := r.TransferRepository.GetTransfer(ctx, transferSN)
+	if err != nil {
+		return
+	}
+	warehouseID := order.FromWarehouseID
+	if toWarehouse {
+		warehouseID = order.ToWarehouseID
+	}
+	r.notifier.notify(transferKeys(order, warehouseID))
+}
+
+func transferKeys(order *entity.TransferOrder, warehouseID int) []stockKey {
+	keys := make([]stockKey, 0, len(order.Items))
+	for _, item := range order.Items {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, warehouseID})
+	}
+	return keys
+}
+
+// WatchingStocktakeRepository 盘点单提交调整库存后通知订阅者
+type WatchingStocktakeRepository struct {
+	StocktakeRepository
+	notifier *ChangeNotifier
+}
+
+// NewWatchingStocktakeRepository 创建带变更通知的盘点单仓储
+func NewWatchingStocktakeRepository(base StocktakeRepository, notifier *ChangeNotifier) *WatchingStocktakeRepository {
+	return &WatchingStocktakeRepository{
+		StocktakeRepository: base,
+		notifier:            notifier,
+	}
+}
+
+// CommitSession 提交盘点单后通知盘点范围内的记录
+func (r *WatchingStocktakeRepository) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	session, err := r.StocktakeRepository.CommitSession(ctx, sessionSN, operator)
+	if err != nil {
+		return session, err
+	}
+
+	keys := make([]stockKey, 0, len(session.Items))
+	for _, item := range session.Items {
+		keys = append(keys, stockKey{item.ProductID, item.SkuID, session.WarehouseID})
+	}
+	r.notifier.notify(keys)
+	return session, nil
+}
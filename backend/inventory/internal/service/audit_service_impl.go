@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+const (
+	// 未指定时间范围时默认统计最近一天
+	defaultAuditWindow = 24 * time.Hour
+	// 汇总统计允许的最大时间范围
+	maxAuditWindow = 90 * 24 * time.Hour
+)
+
+// 定义错误
+var (
+	ErrAuditDisabled    = errors.New("inventory audit is disabled")
+	ErrInvalidTimeRange = errors.New("invalid time range")
+)
+
+// AuditServiceImpl 库存审计查询服务实现
+type AuditServiceImpl struct {
+	repo   repository.AuditRepository
+	logger *zap.Logger
+}
+
+// NewAuditService 创建库存审计查询服务，repo为nil表示未启用审计
+func NewAuditService(repo repository.AuditRepository, logger *zap.Logger) AuditService {
+	return &AuditServiceImpl{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListInventoryChanges 分页查询审计记录
+func (s *AuditServiceImpl) ListInventoryChanges(ctx context.Context, filter *repository.InventoryChangeFilter, page, pageSize int) ([]*entity.InventoryChangeRecord, int64, error) {
+	if s.repo == nil {
+		return nil, 0, ErrAuditDisabled
+	}
+	if page <= 0 || pageSize <= 0 {
+		return nil, 0, ErrInvalidArgument
+	}
+	if err := normalizeTimeRange(filter); err != nil {
+		return nil, 0, err
+	}
+
+	return s.repo.ListInventoryChanges(ctx, filter, page, pageSize)
+}
+
+// GetActivitySummary 按商品和操作类型汇总时间范围内的库存操作
+func (s *AuditServiceImpl) GetActivitySummary(ctx context.Context, filter *repository.InventoryChangeFilter) ([]*entity.InventoryActivitySummary, error) {
+	if s.repo == nil {
+		return nil, ErrAuditDisabled
+	}
+	if err := normalizeTimeRange(filter); err != nil {
+		return nil, err
+	}
+
+	return s.repo.AggregateInventoryChanges(ctx, filter)
+}
+
+// normalizeTimeRange 补全并校验查询的时间范围，未指定结束时间时为当前时间，未指定开始时间时为结束前一天
+func normalizeTimeRange(filter *repository.InventoryChangeFilter) error {
+	if filter == nil {
+		return ErrInvalidArgument
+	}
+
+	if filter.EndTime.IsZero() {
+		filter.EndTime = time.Now()
+	}
+	if filter.StartTime.IsZero() {
+		filter.StartTime = filter.EndTime.Add(-defaultAuditWindow)
+	}
+	if !filter.StartTime.Before(filter.EndTime) || filter.EndTime.Sub(filter.StartTime) > maxAuditWindow {
+		return ErrInvalidTimeRange
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// BackorderServiceImpl 缺货预订服务实现
+type BackorderServiceImpl struct {
+	repo   repository.InventoryRepository
+	logger *zap.Logger
+}
+
+// NewBackorderService 创建缺货预订服务实例
+func NewBackorderService(repo repository.InventoryRepository, logger *zap.Logger) BackorderService {
+	return &BackorderServiceImpl{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// SetBackorderLimit 设置库存记录的预售上限，上限为可用库存不足时最多可以排队预订的数量
+func (s *BackorderServiceImpl) SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error {
+	if key.ProductID <= 0 || key.SkuID < 0 || key.WarehouseID <= 0 || limit < 0 {
+		return ErrInvalidArgument
+	}
+
+	if err := s.repo.SetBackorderLimit(ctx, key, limit, operator); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrStockNotFound
+		}
+		return ErrOperationFailed
+	}
+	return nil
+}
+
+// ListBackorders 按排队顺序分页查询缺货预订
+func (s *BackorderServiceImpl) ListBackorders(ctx context.Context, filter *repository.BackorderFilter, page, pageSize int) ([]*entity.InventoryBackorder, int64, error) {
+	if filter != nil && (filter.ProductID < 0 || filter.WarehouseID < 0) {
+		return nil, 0, ErrInvalidArgument
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	backorders, total, err := s.repo.ListBackorders(ctx, filter, page, pageSize)
+	if err != nil {
+		s.logger.Error("Failed to list backorders", zap.Error(err))
+		return nil, 0, ErrOperationFailed
+	}
+	return backorders, total, nil
+}
+
+// FulfillQueued 按ID顺序遍历有排队预订的库存记录并分配可用库存。解锁、调拨收货、盘盈等操作增加的可用库存
+// 为排队的预订保留，由该方法转为锁定；单个库存记录分配失败时记录日志并继续，下一轮重试
+func (s *BackorderServiceImpl) FulfillQueued(ctx context.Context, batchSize int) (int, error) {
+	fulfilled := 0
+	var afterID int64
+	for {
+		inventories, err := s.repo.ListBackorderedInventories(ctx, afterID, batchSize)
+		if err != nil {
+			return fulfilled, ErrOperationFailed
+		}
+
+		for _, inv := range inventories {
+			if err := ctx.Err(); err != nil {
+				return fulfilled, err
+			}
+			afterID = inv.ID
+
+			key := valueobject.StockKey{ProductID: inv.ProductID, SkuID: inv.SkuID, WarehouseID: inv.WarehouseID}
+			backorders, err := s.repo.FulfillBackorders(ctx, key)
+			fulfilled += len(backorders)
+			if err != nil {
+				s.logger.Warn("Failed to fulfill queued backorders",
+					zap.Int64("product_id", inv.ProductID),
+					zap.Int64("sku_id", inv.SkuID),
+					zap.Int("warehouse_id", inv.WarehouseID),
+					zap.Error(err))
+			}
+		}
+
+		if len(inventories) < batchSize {
+			return fulfilled, nil
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeBackorderRepo 内存中有排队预订的库存记录，failing中的记录分配时失败
+type fakeBackorderRepo struct {
+	repository.InventoryRepository
+	inventories []*entity.Inventory
+	queued      map[valueobject.StockKey]int
+	failing     map[valueobject.StockKey]bool
+	attempted   []valueobject.StockKey
+}
+
+func (r *fakeBackorderRepo) ListBackorderedInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	for _, inv := range r.inventories {
+		if inv.ID > afterID && len(inventories) < limit {
+			inventories = append(inventories, inv)
+		}
+	}
+	return inventories, nil
+}
+
+func (r *fakeBackorderRepo) FulfillBackorders(ctx context.Context, key valueobject.StockKey) ([]*entity.InventoryBackorder, error) {
+	r.attempted = append(r.attempted, key)
+	if r.failing[key] {
+		return nil, errors.New("lock wait timeout")
+	}
+	backorders := make([]*entity.InventoryBackorder, r.queued[key])
+	for i := range backorders {
+		backorders[i] = &entity.InventoryBackorder{ProductID: key.ProductID, WarehouseID: key.WarehouseID}
+	}
+	return backorders, nil
+}
+
+func (r *fakeBackorderRepo) SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error {
+	return repository.ErrRecordNotFound
+}
+
+func TestFulfillQueuedContinuesAfterFailure(t *testing.T) {
+	key := func(productID int64) valueobject.StockKey {
+		return valueobject.StockKey{ProductID: productID, WarehouseID: 1}
+	}
+	repo := &fakeBackorderRepo{
+		inventories: []*entity.Inventory{
+			{ID: 1, ProductID: 100, WarehouseID: 1},
+			{ID: 2, ProductID: 200, WarehouseID: 1},
+			{ID: 3, ProductID: 300, WarehouseID: 1},
+		},
+		queued:  map[valueobject.StockKey]int{key(100): 2, key(300): 1},
+		failing: map[valueobject.StockKey]bool{key(200): true},
+	}
+	svc := NewBackorderService(repo, zap.NewNop())
+
+	// 商品200分配失败时记录日志并继续，下一批的商品300照常分配
+	fulfilled, err := svc.FulfillQueued(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("FulfillQueued() error = %v", err)
+	}
+	if fulfilled != 3 {
+		t.Errorf("fulfilled = %d, want 3", fulfilled)
+	}
+	if len(repo.attempted) != 3 {
+		t.Errorf("attempted = %v, want all three records", repo.attempted)
+	}
+}
+
+func TestSetBackorderLimitValidates(t *testing.T) {
+	svc := NewBackorderService(&fakeBackorderRepo{}, zap.NewNop())
+
+	err := svc.SetBackorderLimit(context.Background(), valueobject.StockKey{ProductID: 100}, 5, "tester")
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("SetBackorderLimit() without warehouse error = %v, want %v", err, ErrInvalidArgument)
+	}
+	err = svc.SetBackorderLimit(context.Background(), valueobject.StockKey{ProductID: 100, WarehouseID: 1}, 5, "tester")
+	if !errors.Is(err, ErrStockNotFound) {
+		t.Errorf("SetBackorderLimit() error = %v, want %v", err, ErrStockNotFound)
+	}
+}
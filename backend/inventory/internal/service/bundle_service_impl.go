@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 定义错误
+var (
+	ErrBundleNotFound = errors.New("bundle not found")
+	// ErrInvalidBundle 套装没有组件、组件数量不正确、组件重复或组件本身是套装
+	ErrInvalidBundle = errors.New("invalid bundle definition")
+	// ErrBundleHasInventory 套装商品已有库存记录，套装的库存只能由组件计算
+	ErrBundleHasInventory = errors.New("bundle goods already has inventory")
+)
+
+// BundleServiceImpl 套装服务实现
+type BundleServiceImpl struct {
+	repo          repository.InventoryRepository
+	warehouseRepo repository.WarehouseRepository
+	logger        *zap.Logger
+}
+
+// NewBundleService 创建套装服务实例
+func NewBundleService(repo repository.InventoryRepository, warehouseRepo repository.WarehouseRepository, logger *zap.Logger) BundleService {
+	return &BundleServiceImpl{
+		repo:          repo,
+		warehouseRepo: warehouseRepo,
+		logger:        logger,
+	}
+}
+
+// SaveBundle 校验并保存套装定义
+func (s *BundleServiceImpl) SaveBundle(ctx context.Context, bundle *entity.InventoryBundle) error {
+	if bundle == nil || bundle.ProductID <= 0 {
+		return ErrInvalidArgument
+	}
+	if len(bundle.Components) == 0 {
+		return ErrInvalidBundle
+	}
+
+	componentIDs := make([]int64, 0, len(bundle.Components))
+	seen := make(map[valueobject.SkuKey]bool, len(bundle.Components))
+	for _, component := range bundle.Components {
+		key := valueobject.SkuKey{ProductID: component.ProductID, SkuID: component.SkuID}
+		if component.ProductID <= 0 || component.SkuID < 0 || component.Quantity <= 0 ||
+			component.ProductID == bundle.ProductID || seen[key] {
+			return ErrInvalidBundle
+		}
+		seen[key] = true
+		componentIDs = append(componentIDs, component.ProductID)
+	}
+
+	// 组件不能是套装，避免套装嵌套
+	nested, err := s.repo.GetBundles(ctx, componentIDs)
+	if err != nil {
+		return ErrOperationFailed
+	}
+	if len(nested) > 0 {
+		return ErrInvalidBundle
+	}
+
+	// 套装商品在启用仓库中不能有自己的库存记录
+	warehouses, err := s.warehouseRepo.ListActiveWarehouses(ctx)
+	if err != nil {
+		return ErrOperationFailed
+	}
+	warehouseIDs := make([]int, 0, len(warehouses))
+	for _, warehouse := range warehouses {
+		warehouseIDs = append(warehouseIDs, warehouse.ID)
+	}
+	inventories, err := s.repo.GetInventoriesByProducts(ctx, []int64{bundle.ProductID}, warehouseIDs)
+	if err != nil {
+		return ErrOperationFailed
+	}
+	if len(inventories) > 0 {
+		return ErrBundleHasInventory
+	}
+
+	if err := s.repo.SaveBundle(ctx, bundle); err != nil {
+		return ErrOperationFailed
+	}
+	return nil
+}
+
+// GetBundle 获取套装定义
+func (s *BundleServiceImpl) GetBundle(ctx context.Context, productID int64) (*entity.InventoryBundle, error) {
+	if productID <= 0 {
+		return nil, ErrInvalidArgument
+	}
+
+	bundles, err := s.repo.GetBundles(ctx, []int64{productID})
+	if err != nil {
+		return nil, ErrOperationFailed
+	}
+	if len(bundles) == 0 {
+		return nil, ErrBundleNotFound
+	}
+	return bundles[0], nil
+}
+
+// DeleteBundle 删除套装定义
+func (s *BundleServiceImpl) DeleteBundle(ctx context.Context, productID int64) error {
+	if productID <= 0 {
+		return ErrInvalidArgument
+	}
+
+	if err := s.repo.DeleteBundle(ctx, productID); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrBundleNotFound
+		}
+		return ErrOperationFailed
+	}
+
+	s.logger.Info("Bundle deleted", zap.Int64("bundle_id", productID))
+	return nil
+}
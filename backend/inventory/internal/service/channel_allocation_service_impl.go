@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+var (
+	// ErrInvalidChannel 渠道标识不合法
+	ErrInvalidChannel = errors.New("invalid sales channel")
+	// ErrAllocationBelowLocked 渠道分配数量低于渠道已锁定的数量
+	ErrAllocationBelowLocked = errors.New("allocation is below the quantity already locked by the channel")
+)
+
+// channelPattern 渠道标识由小写字母、数字和下划线组成，最长32个字符
+var channelPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// validChannel 判断渠道标识是否合法
+func validChannel(channel string) bool {
+	return channelPattern.MatchString(channel)
+}
+
+// ChannelAllocationServiceImpl 渠道库存分配服务实现
+type ChannelAllocationServiceImpl struct {
+	repo   repository.InventoryRepository
+	logger *zap.Logger
+}
+
+// NewChannelAllocationService 创建渠道库存分配服务实例
+func NewChannelAllocationService(repo repository.InventoryRepository, logger *zap.Logger) ChannelAllocationService {
+	return &ChannelAllocationServiceImpl{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// SetChannelAllocation 设置库存记录分配给渠道的数量，增加的部分从共享可用库存中划出
+func (s *ChannelAllocationServiceImpl) SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error) {
+	if key.ProductID <= 0 || key.SkuID < 0 || key.WarehouseID <= 0 || allocated < 0 {
+		return nil, ErrInvalidArgument
+	}
+	if !validChannel(channel) {
+		return nil, ErrInvalidChannel
+	}
+
+	allocation, err := s.repo.SetChannelAllocation(ctx, key, channel, allocated, operator)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			return nil, ErrStockNotFound
+		case errors.Is(err, repository.ErrInsufficientStock):
+			return nil, ErrInsufficientStock
+		case errors.Is(err, repository.ErrAllocationBelowLocked):
+			return nil, ErrAllocationBelowLocked
+		}
+		return nil, ErrOperationFailed
+	}
+
+	s.logger.Info("Channel allocation updated",
+		zap.Int64("product_id", key.ProductID),
+		zap.Int64("sku_id", key.SkuID),
+		zap.Int("warehouse_id", key.WarehouseID),
+		zap.String("channel", channel),
+		zap.Int("allocated", allocated),
+		zap.String("operator", operator))
+	return allocation, nil
+}
+
+// ListChannelAllocations 查询商品的渠道分配，warehouseID为0时不限仓库，channel为空时不限渠道
+func (s *ChannelAllocationServiceImpl) ListChannelAllocations(ctx context.Context, productID int64, warehouseID int, channel string) ([]*entity.InventoryChannelAllocation, error) {
+	if productID <= 0 || warehouseID < 0 {
+		return nil, ErrInvalidArgument
+	}
+	if channel != "" && !validChannel(channel) {
+		return nil, ErrInvalidChannel
+	}
+
+	var warehouseIDs []int
+	if warehouseID > 0 {
+		warehouseIDs = []int{warehouseID}
+	}
+	allocations, err := s.repo.ListChannelAllocations(ctx, []int64{productID}, warehouseIDs, channel)
+	if err != nil {
+		return nil, ErrOperationFailed
+	}
+	return allocations, nil
+}
+
+// SetSafetyStock 设置库存记录的安全库存，安全库存对所有渠道都不可售
+func (s *ChannelAllocationServiceImpl) SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error {
+	if key.ProductID <= 0 || key.SkuID < 0 || key.WarehouseID <= 0 || safetyStock < 0 {
+		return ErrInvalidArgument
+	}
+
+	if err := s.repo.SetSafetyStock(ctx, key, safetyStock, operator); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrStockNotFound
+		}
+		return ErrOperationFailed
+	}
+
+	s.logger.Info("Safety stock updated",
+		zap.Int64("product_id", key.ProductID),
+		zap.Int64("sku_id", key.SkuID),
+		zap.Int("warehouse_id", key.WarehouseID),
+		zap.Int("safety_stock", safetyStock),
+		zap.String("operator", operator))
+	return nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 定义错误
+var (
+	ErrInboundNotFound      = errors.New("inbound order not found")
+	ErrInvalidInboundStatus = errors.New("invalid inbound status")
+	ErrInboundItemNotFound  = errors.New("item is not on the inbound order")
+	ErrReceiptConflict      = errors.New("receipt sn belongs to another inbound order")
+	ErrReceiptPostFailed    = errors.New("receipt recorded but not fully posted, retry with the same receipt sn")
+)
+
+// InboundServiceImpl 采购入库服务实现
+type InboundServiceImpl struct {
+	repo          repository.InboundRepository
+	inventoryRepo repository.InventoryRepository
+	warehouseRepo repository.WarehouseRepository
+	logger        *zap.Logger
+}
+
+// NewInboundService 创建采购入库服务实例
+func NewInboundService(
+	repo repository.InboundRepository,
+	inventoryRepo repository.InventoryRepository,
+	warehouseRepo repository.WarehouseRepository,
+	logger *zap.Logger,
+) InboundService {
+	return &InboundServiceImpl{
+		repo:          repo,
+		inventoryRepo: inventoryRepo,
+		warehouseRepo: warehouseRepo,
+		logger:        logger,
+	}
+}
+
+// CreateInbound 创建入库单，同一商品SKU只能出现一次
+func (s *InboundServiceImpl) CreateInbound(ctx context.Context, order *entity.InboundOrder) error {
+	if order == nil || len(order.Items) == 0 || order.WarehouseID <= 0 {
+		return ErrInvalidArgument
+	}
+	seen := make(map[valueobject.SkuKey]bool, len(order.Items))
+	for _, item := range order.Items {
+		if item.ProductID <= 0 || item.SkuID < 0 || item.Expected <= 0 {
+			return ErrInvalidArgument
+		}
+		key := valueobject.SkuKey{ProductID: item.ProductID, SkuID: item.SkuID}
+		if seen[key] {
+			return ErrInvalidArgument
+		}
+		seen[key] = true
+		item.Received = 0
+	}
+
+	warehouse, err := s.warehouseRepo.GetWarehouse(ctx, order.WarehouseID)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrWarehouseNotFound
+		}
+		return err
+	}
+	if !warehouse.IsActive() {
+		return ErrWarehouseInactive
+	}
+
+	if order.InboundSN == "" {
+		order.InboundSN = generateInboundSN()
+	}
+
+	if err := s.repo.CreateInbound(ctx, order); err != nil {
+		s.logger.Error("Failed to create inbound",
+			zap.String("inbound_sn", order.InboundSN),
+			zap.Int("warehouse_id", order.WarehouseID),
+			zap.Error(err))
+		return ErrOperationFailed
+	}
+
+	return nil
+}
+
+// ReceiveInbound 登记收货，允许部分收货和超收，收货数量逐行增加到入库单的仓库。
+// 登记与入账分两步完成，入账中断时收货单保留未入账的明细，使用同一收货单号重试即可补入
+func (s *InboundServiceImpl) ReceiveInbound(ctx context.Context, receipt *entity.InboundReceipt) (*entity.InboundOrder, error) {
+	if receipt == nil || receipt.InboundSN == "" || len(receipt.Items) == 0 {
+		return nil, ErrInvalidArgument
+	}
+
+	// 同一商品SKU同一批次的多行收货合并为一行
+	type receiptKey struct {
+		sku   valueobject.SkuKey
+		lotNo string
+	}
+	merged := make(map[receiptKey]*entity.ReceiptItem, len(receipt.Items))
+	items := make([]*entity.ReceiptItem, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		if item.ProductID <= 0 || item.SkuID < 0 || item.Quantity <= 0 {
+			return nil, ErrInvalidArgument
+		}
+		key := receiptKey{valueobject.SkuKey{ProductID: item.ProductID, SkuID: item.SkuID}, item.LotNo}
+		if line, ok := merged[key]; ok {
+			line.Quantity += item.Quantity
+			continue
+		}
+		line := &entity.ReceiptItem{
+			ProductID:  item.ProductID,
+			SkuID:      item.SkuID,
+			Quantity:   item.Quantity,
+			LotNo:      item.LotNo,
+			ExpiryDate: item.ExpiryDate,
+		}
+		merged[key] = line
+		items = append(items, line)
+	}
+	receipt.Items = items
+
+	if receipt.ReceiptSN == "" {
+		receipt.ReceiptSN = generateReceiptSN()
+	}
+
+	recorded, err := s.repo.RecordReceipt(ctx, receipt)
+	if err != nil {
+		return nil, s.translateError("receive", receipt.InboundSN, err)
+	}
+
+	if err := s.postReceipt(ctx, recorded); err != nil {
+		return nil, err
+	}
+
+	return s.GetInbound(ctx, receipt.InboundSN)
+}
+
+// postReceipt 将收货单中尚未入账的明细增加到库存，库存历史的单号为收货单号
+func (s *InboundServiceImpl) postReceipt(ctx context.Context, receipt *entity.InboundReceipt) error {
+	if receipt.Posted {
+		return nil
+	}
+
+	remark := fmt.Sprintf("Inbound %s received", receipt.InboundSN)
+	for _, item := range receipt.Items {
+		if item.Posted {
+			continue
+		}
+
+		// 上次入账可能在增加库存后、标记入账前中断
+		stocked, err := s.repo.HasStockIn(ctx, receipt.ReceiptSN, item.ProductID, item.SkuID, receipt.WarehouseID, item.LotNo)
+		if err != nil {
+			s.logger.Error("Failed to check receipt stock-in",
+				zap.String("receipt_sn", receipt.ReceiptSN),
+				zap.Int64("product_id", item.ProductID),
+				zap.Int64("sku_id", item.SkuID),
+				zap.Error(err))
+			return ErrReceiptPostFailed
+		}
+
+		if !stocked {
+			var lot *valueobject.LotInfo
+			if item.LotNo != "" {
+				lot = &valueobject.LotInfo{LotNo: item.LotNo, ExpiryDate: item.ExpiryDate}
+			}
+			if err := s.inventoryRepo.IncreaseStock(ctx, item.ProductID, item.SkuID, receipt.WarehouseID,
+				item.Quantity, receipt.ReceiptSN, remark, lot); err != nil {
+				s.logger.Error("Failed to post receipt item",
+					zap.String("receipt_sn", receipt.ReceiptSN),
+					zap.Int64("product_id", item.ProductID),
+					zap.Int64("sku_id", item.SkuID),
+					zap.Int("quantity", item.Quantity),
+					zap.Error(err))
+				return ErrReceiptPostFailed
+			}
+		}
+
+		if err := s.repo.MarkReceiptItemPosted(ctx, receipt.ReceiptSN, item.ProductID, item.SkuID, item.LotNo); err != nil {
+			return ErrReceiptPostFailed
+		}
+	}
+
+	return nil
+}
+
+// CloseInbound 关闭入库单
+func (s *InboundServiceImpl) CloseInbound(ctx context.Context, inboundSN string, operator string, reason string) (*entity.InboundOrder, error) {
+	if inboundSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	if err := s.repo.CloseInbound(ctx, inboundSN, operator, reason); err != nil {
+		return nil, s.translateError("close", inboundSN, err)
+	}
+
+	return s.GetInbound(ctx, inboundSN)
+}
+
+// GetInbound 获取入库单
+func (s *InboundServiceImpl) GetInbound(ctx context.Context, inboundSN string) (*entity.InboundOrder, error) {
+	if inboundSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	order, err := s.repo.GetInbound(ctx, inboundSN)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, ErrInboundNotFound
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ListReceipts 获取入库单的收货记录
+func (s *InboundServiceImpl) ListReceipts(ctx context.Context, inboundSN string) ([]*entity.InboundReceipt, error) {
+	if inboundSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	return s.repo.ListReceipts(ctx, inboundSN)
+}
+
+// translateError 将仓储层错误转换为服务层错误
+func (s *InboundServiceImpl) translateError(action string, inboundSN string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return ErrInboundNotFound
+	case errors.Is(err, repository.ErrInvalidInboundStatus):
+		return ErrInvalidInboundStatus
+	case errors.Is(err, repository.ErrInboundItemNotFound):
+		return ErrInboundItemNotFound
+	case errors.Is(err, repository.ErrReceiptConflict):
+		return ErrReceiptConflict
+	}
+
+	s.logger.Error("Failed to "+action+" inbound",
+		zap.String("inbound_sn", inboundSN),
+		zap.Error(err))
+	return ErrOperationFailed
+}
+
+// generateInboundSN 生成入库单号
+func generateInboundSN() string {
+	return fmt.Sprintf("IN%s%04d", time.Now().Format("20060102150405"), rand.Intn(10000))
+}
+
+// generateReceiptSN 生成收货单号
+func generateReceiptSN() string {
+	return fmt.Sprintf("RC%s%04d", time.Now().Format("20060102150405"), rand.Intn(10000))
+}
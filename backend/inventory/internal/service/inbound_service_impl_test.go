@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeInboundRepo 原样返回登记的收货单，stockedIn中的明细视为已写入入库流水
+type fakeInboundRepo struct {
+	repository.InboundRepository
+	recorded  *entity.InboundReceipt
+	stockedIn map[valueobject.SkuKey]bool
+	posted    []valueobject.SkuKey
+}
+
+func (r *fakeInboundRepo) RecordReceipt(ctx context.Context, receipt *entity.InboundReceipt) (*entity.InboundReceipt, error) {
+	receipt.WarehouseID = 1
+	r.recorded = receipt
+	return receipt, nil
+}
+
+func (r *fakeInboundRepo) HasStockIn(ctx context.Context, receiptSN string, productID int64, skuID int64, warehouseID int, lotNo string) (bool, error) {
+	return r.stockedIn[valueobject.SkuKey{ProductID: productID, SkuID: skuID}], nil
+}
+
+func (r *fakeInboundRepo) MarkReceiptItemPosted(ctx context.Context, receiptSN string, productID int64, skuID int64, lotNo string) error {
+	r.posted = append(r.posted, valueobject.SkuKey{ProductID: productID, SkuID: skuID})
+	return nil
+}
+
+func (r *fakeInboundRepo) GetInbound(ctx context.Context, inboundSN string) (*entity.InboundOrder, error) {
+	return &entity.InboundOrder{InboundSN: inboundSN}, nil
+}
+
+// fakeInboundInventoryRepo 记录增加的库存，err不为空时入账失败
+type fakeInboundInventoryRepo struct {
+	repository.InventoryRepository
+	increased map[valueobject.SkuKey]int
+	err       error
+}
+
+func (r *fakeInboundInventoryRepo) IncreaseStock(ctx context.Context, productID int64, skuID int64, warehouseID int, quantity int, orderSN string, remark string, lot *valueobject.LotInfo) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.increased[valueobject.SkuKey{ProductID: productID, SkuID: skuID}] += quantity
+	return nil
+}
+
+func TestReceiveInboundMergesLinesAndPosts(t *testing.T) {
+	repo := &fakeInboundRepo{}
+	inventories := &fakeInboundInventoryRepo{increased: make(map[valueobject.SkuKey]int)}
+	svc := NewInboundService(repo, inventories, &fakeTransferWarehouseRepo{}, zap.NewNop())
+
+	_, err := svc.ReceiveInbound(context.Background(), &entity.InboundReceipt{
+		InboundSN: "IN1",
+		Items: []*entity.ReceiptItem{
+			{ProductID: 100, Quantity: 2},
+			{ProductID: 100, Quantity: 3},
+			{ProductID: 200, SkuID: 7, Quantity: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ReceiveInbound() error = %v", err)
+	}
+	if len(repo.recorded.Items) != 2 || repo.recorded.ReceiptSN == "" {
+		t.Errorf("recorded receipt = %+v, want 2 merged lines and a generated receipt SN", repo.recorded)
+	}
+	if inventories.increased[valueobject.SkuKey{ProductID: 100}] != 5 ||
+		inventories.increased[valueobject.SkuKey{ProductID: 200, SkuID: 7}] != 1 {
+		t.Errorf("increased = %v, want 100:5 and 200/7:1", inventories.increased)
+	}
+	if len(repo.posted) != 2 {
+		t.Errorf("posted = %v, want both lines", repo.posted)
+	}
+}
+
+func TestReceiveInboundSkipsItemsAlreadyStocked(t *testing.T) {
+	// 上次入账在增加库存后中断，重试时只标记入账，不重复增加库存
+	repo := &fakeInboundRepo{stockedIn: map[valueobject.SkuKey]bool{{ProductID: 100}: true}}
+	inventories := &fakeInboundInventoryRepo{increased: make(map[valueobject.SkuKey]int)}
+	svc := NewInboundService(repo, inventories, &fakeTransferWarehouseRepo{}, zap.NewNop())
+
+	_, err := svc.ReceiveInbound(context.Background(), &entity.InboundReceipt{
+		InboundSN: "IN1",
+		ReceiptSN: "RC1",
+		Items:     []*entity.ReceiptItem{{ProductID: 100, Quantity: 2}, {ProductID: 200, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("ReceiveInbound() error = %v", err)
+	}
+	if _, ok := inventories.increased[valueobject.SkuKey{ProductID: 100}]; ok || inventories.increased[valueobject.SkuKey{ProductID: 200}] != 1 {
+		t.Errorf("increased = %v, want only product 200", inventories.increased)
+	}
+	if len(repo.posted) != 2 {
+		t.Errorf("posted = %v, want both lines", repo.posted)
+	}
+}
+
+func TestReceiveInboundReportsPostFailure(t *testing.T) {
+	repo := &fakeInboundRepo{}
+	inventories := &fakeInboundInventoryRepo{err: errors.New("lock wait timeout")}
+	svc := NewInboundService(repo, inventories, &fakeTransferWarehouseRepo{}, zap.NewNop())
+
+	_, err := svc.ReceiveInbound(context.Background(), &entity.InboundReceipt{
+		InboundSN: "IN1",
+		Items:     []*entity.ReceiptItem{{ProductID: 100, Quantity: 2}},
+	})
+	if !errors.Is(err, ErrReceiptPostFailed) {
+		t.Errorf("ReceiveInbound() error = %v, want %v", err, ErrReceiptPostFailed)
+	}
+	if len(repo.posted) != 0 {
+		t.Errorf("posted = %v, want nothing marked after a failed stock-in", repo.posted)
+	}
+}
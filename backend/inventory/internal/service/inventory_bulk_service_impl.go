@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+const (
+	// 单次导入的最大行数
+	maxImportRows = 50000
+	// 每个事务写入的记录数
+	importChunkSize = 200
+	// 读取当前库存时每批的商品数量
+	importLoadBatch = 500
+	// 导出时每批读取的记录数
+	exportBatchSize = 500
+	// 新建库存记录未指定预警阈值时的默认值，与表默认值一致
+	defaultAlertThreshold = 10
+	// 导入写入库存历史的备注
+	importRemark = "Inventory import"
+)
+
+// 导入文件的列，sku_id和alert_threshold可省略
+const (
+	columnGoodsID        = "goods_id"
+	columnWarehouseID    = "warehouse_id"
+	columnStock          = "stock"
+	columnAlertThreshold = "alert_threshold"
+	columnSkuID          = "sku_id"
+)
+
+// 导出文件的列顺序
+var exportColumns = []string{columnGoodsID, columnWarehouseID, columnStock, columnAlertThreshold, columnSkuID}
+
+// 定义错误
+var (
+	ErrImportFileInvalid = errors.New("invalid import file")
+	ErrImportIncomplete  = errors.New("import interrupted, re-import the same file to finish")
+)
+
+// importRow 校验通过的导入行
+type importRow struct {
+	line           int
+	key            valueobject.StockKey
+	stock          int
+	alertThreshold int
+	hasThreshold   bool
+}
+
+// InventoryBulkServiceImpl 库存批量导入导出服务实现
+type InventoryBulkServiceImpl struct {
+	repo          repository.InventoryRepository
+	warehouseRepo repository.WarehouseRepository
+	logger        *zap.Logger
+}
+
+// NewInventoryBulkService 创建库存批量导入导出服务实例
+func NewInventoryBulkService(
+	repo repository.InventoryRepository,
+	warehouseRepo repository.WarehouseRepository,
+	logger *zap.Logger,
+) InventoryBulkService {
+	return &InventoryBulkServiceImpl{
+		repo:          repo,
+		warehouseRepo: warehouseRepo,
+		logger:        logger,
+	}
+}
+
+// ImportInventory 从CSV导入库存。先校验全部行，存在错误或dryRun为true时只返回差异报告，不写入任何记录；
+// 否则按批写入库存数量或预警阈值有变化的记录。文件本身无法解析时返回ErrImportFileInvalid
+func (s *InventoryBulkServiceImpl) ImportInventory(ctx context.Context, r io.Reader, dryRun bool, operator string) (*valueobject.InventoryImportReport, error) {
+	if operator == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	report := &valueobject.InventoryImportReport{DryRun: dryRun}
+	rows, err := s.parseImport(r, report)
+	if err != nil {
+		return nil, err
+	}
+	report.TotalRows = len(rows) + len(report.Errors)
+
+	s.validateWarehouses(ctx, rows, report)
+
+	current, err := s.loadCurrent(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*entity.Inventory, 0, len(rows))
+	for _, row := range rows {
+		existing, ok := current[row.key]
+		if !ok {
+			threshold := defaultAlertThreshold
+			if row.hasThreshold {
+				threshold = row.alertThreshold
+			}
+			report.Created++
+			report.Diffs = append(report.Diffs, &valueobject.InventoryDiff{
+				ProductID:         row.key.ProductID,
+				SkuID:             row.key.SkuID,
+				WarehouseID:       row.key.WarehouseID,
+				NewStock:          row.stock,
+				NewAlertThreshold: threshold,
+				Created:           true,
+			})
+			changes = append(changes, &entity.Inventory{
+				ProductID:      row.key.ProductID,
+				SkuID:          row.key.SkuID,
+				WarehouseID:    row.key.WarehouseID,
+				Stock:          row.stock,
+				AlertThreshold: threshold,
+			})
+			continue
+		}
+
+		if row.stock < existing.LockStock {
+			report.Errors = append(report.Errors, &valueobject.InventoryImportError{
+				Line:    row.line,
+				Message: fmt.Sprintf("stock %d is below locked quantity %d", row.stock, existing.LockStock),
+			})
+			continue
+		}
+
+		threshold := existing.AlertThreshold
+		if row.hasThreshold {
+			threshold = row.alertThreshold
+		}
+		if row.stock == existing.Stock && threshold == existing.AlertThreshold {
+			report.Unchanged++
+			continue
+		}
+
+		report.Updated++
+		report.Diffs = append(report.Diffs, &valueobject.InventoryDiff{
+			ProductID:         row.key.ProductID,
+			SkuID:             row.key.SkuID,
+			WarehouseID:       row.key.WarehouseID,
+			OldStock:          existing.Stock,
+			NewStock:          row.stock,
+			OldAlertThreshold: existing.AlertThreshold,
+			NewAlertThreshold: threshold,
+		})
+		changes = append(changes, &entity.Inventory{
+			ProductID:      row.key.ProductID,
+			SkuID:          row.key.SkuID,
+			WarehouseID:    row.key.WarehouseID,
+			Stock:          row.stock,
+			AlertThreshold: threshold,
+		})
+	}
+
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	// 每批在同一事务内写入，中途失败时已写入的批次保留，重新导入同一文件时这些记录不再有差异
+	for start := 0; start < len(changes); start += importChunkSize {
+		end := start + importChunkSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+		if err := s.repo.SetInventories(ctx, changes[start:end], operator, importRemark); err != nil {
+			s.logger.Error("Failed to apply inventory import",
+				zap.Int("applied", report.Applied),
+				zap.Int("total", len(changes)),
+				zap.String("operator", operator),
+				zap.Error(err))
+			if errors.Is(err, repository.ErrStockBelowLocked) {
+				return report, fmt.Errorf("%w: %s", ErrImportIncomplete, err.Error())
+			}
+			return report, ErrImportIncomplete
+		}
+		report.Applied += end - start
+	}
+
+	s.logger.Info("Inventory imported",
+		zap.Int("total_rows", report.TotalRows),
+		zap.Int("created", report.Created),
+		zap.Int("updated", report.Updated),
+		zap.Int("unchanged", report.Unchanged),
+		zap.String("operator", operator))
+
+	return report, nil
+}
+
+// parseImport 解析表头和每一行，行级错误记录到报告中，表头错误或文件无法读取时返回错误
+func (s *InventoryBulkServiceImpl) parseImport(r io.Reader, report *valueobject.InventoryImportReport) ([]*importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: missing header", ErrImportFileInvalid)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrImportFileInvalid, err.Error())
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case columnGoodsID, columnWarehouseID, columnStock, columnAlertThreshold, columnSkuID:
+		default:
+			return nil, fmt.Errorf("%w: unknown column %q", ErrImportFileInvalid, name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrImportFileInvalid, name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{columnGoodsID, columnWarehouseID, columnStock} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrImportFileInvalid, name)
+		}
+	}
+
+	var rows []*importRow
+	seen := make(map[valueobject.StockKey]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("%w: %s", ErrImportFileInvalid, err.Error())
+			}
+			report.Errors = append(report.Errors, &valueobject.InventoryImportError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rows)+len(report.Errors) >= maxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrImportFileInvalid, maxImportRows)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		row, msg := parseImportRow(record, columns)
+		if msg != "" {
+			report.Errors = append(report.Errors, &valueobject.InventoryImportError{Line: line, Message: msg})
+			continue
+		}
+		if first, ok := seen[row.key]; ok {
+			report.Errors = append(report.Errors, &valueobject.InventoryImportError{
+				Line:    line,
+				Message: fmt.Sprintf("duplicate of line %d", first),
+			})
+			continue
+		}
+		row.line = line
+		seen[row.key] = line
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseImportRow 解析并校验一行，返回的错误信息为空表示校验通过
+func parseImportRow(record []string, columns map[string]int) (*importRow, string) {
+	field := func(name string) (string, bool) {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return "", false
+		}
+		value := strings.TrimSpace(record[i])
+		return value, value != ""
+	}
+
+	row := &importRow{}
+	value, _ := field(columnGoodsID)
+	productID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || productID <= 0 {
+		return nil, fmt.Sprintf("invalid goods_id %q", value)
+	}
+	row.key.ProductID = productID
+
+	if value, ok := field(columnSkuID); ok {
+		skuID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || skuID < 0 {
+			return nil, fmt.Sprintf("invalid sku_id %q", value)
+		}
+		row.key.SkuID = skuID
+	}
+
+	value, _ = field(columnWarehouseID)
+	warehouseID, err := strconv.Atoi(value)
+	if err != nil || warehouseID <= 0 {
+		return nil, fmt.Sprintf("invalid warehouse_id %q", value)
+	}
+	row.key.WarehouseID = warehouseID
+
+	value, _ = field(columnStock)
+	stock, err := strconv.Atoi(value)
+	if err != nil || stock < 0 {
+		return nil, fmt.Sprintf("invalid stock %q", value)
+	}
+	row.stock = stock
+
+	if value, ok := field(columnAlertThreshold); ok {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Sprintf("invalid alert_threshold %q", value)
+		}
+		row.alertThreshold = threshold
+		row.hasThreshold = true
+	}
+
+	return row, ""
+}
+
+// validateWarehouses 校验导入涉及的仓库存在且可用，引用无效仓库的行记为错误
+func (s *InventoryBulkServiceImpl) validateWarehouses(ctx context.Context, rows []*importRow, report *valueobject.InventoryImportReport) {
+	problems := make(map[int]string)
+	for _, row := range rows {
+		warehouseID := row.key.WarehouseID
+		msg, checked := problems[warehouseID]
+		if !checked {
+			warehouse, err := s.warehouseRepo.GetWarehouse(ctx, warehouseID)
+			switch {
+			case errors.Is(err, repository.ErrRecordNotFound):
+				msg = fmt.Sprintf("warehouse %d not found", warehouseID)
+			case err != nil:
+				msg = fmt.Sprintf("failed to load warehouse %d", warehouseID)
+			case !warehouse.IsActive():
+				msg = fmt.Sprintf("warehouse %d is inactive", warehouseID)
+			}
+			problems[warehouseID] = msg
+		}
+		if msg != "" {
+			report.Errors = append(report.Errors, &valueobject.InventoryImportError{Line: row.line, Message: msg})
+		}
+	}
+}
+
+// loadCurrent 按商品分批读取导入涉及的当前库存
+func (s *InventoryBulkServiceImpl) loadCurrent(ctx context.Context, rows []*importRow) (map[valueobject.StockKey]*entity.Inventory, error) {
+	productSet := make(map[int64]bool)
+	warehouseSet := make(map[int]bool)
+	var productIDs []int64
+	var warehouseIDs []int
+	for _, row := range rows {
+		if !productSet[row.key.ProductID] {
+			productSet[row.key.ProductID] = true
+			productIDs = append(productIDs, row.key.ProductID)
+		}
+		if !warehouseSet[row.key.WarehouseID] {
+			warehouseSet[row.key.WarehouseID] = true
+			warehouseIDs = append(warehouseIDs, row.key.WarehouseID)
+		}
+	}
+
+	current := make(map[valueobject.StockKey]*entity.Inventory, len(rows))
+	for start := 0; start < len(productIDs); start += importLoadBatch {
+		end := start + importLoadBatch
+		if end > len(productIDs) {
+			end = len(productIDs)
+		}
+		inventories, err := s.repo.GetInventoriesByProducts(ctx, productIDs[start:end], warehouseIDs)
+		if err != nil {
+			s.logger.Error("Failed to load inventories for import",
+				zap.Int("products", end-start),
+				zap.Error(err))
+			return nil, ErrOperationFailed
+		}
+		for _, inv := range inventories {
+			current[valueobject.StockKey{ProductID: inv.ProductID, SkuID: inv.SkuID, WarehouseID: inv.WarehouseID}] = inv
+		}
+	}
+
+	return current, nil
+}
+
+// ExportInventory 以CSV导出库存，列与导入文件一致，warehouseID为0时导出所有仓库
+func (s *InventoryBulkServiceImpl) ExportInventory(ctx context.Context, w io.Writer, warehouseID int) error {
+	if warehouseID < 0 {
+		return ErrInvalidArgument
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	var afterID int64
+	for {
+		inventories, err := s.repo.ListInventories(ctx, afterID, exportBatchSize)
+		if err != nil {
+			s.logger.Error("Failed to list inventories for export",
+				zap.Int64("after_id", afterID),
+				zap.Error(err))
+			return ErrOperationFailed
+		}
+		if len(inventories) == 0 {
+			break
+		}
+
+		for _, inv := range inventories {
+			if warehouseID > 0 && inv.WarehouseID != warehouseID {
+				continue
+			}
+			if err := writer.Write([]string{
+				strconv.FormatInt(inv.ProductID, 10),
+				strconv.Itoa(inv.WarehouseID),
+				strconv.Itoa(inv.Stock),
+				strconv.Itoa(inv.AlertThreshold),
+				strconv.FormatInt(inv.SkuID, 10),
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+
+		afterID = inventories[len(inventories)-1].ID
+		if len(inventories) < exportBatchSize {
+			break
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeBulkInventoryRepo 返回固定库存记录，记录每次批量写入的库存
+type fakeBulkInventoryRepo struct {
+	repository.InventoryRepository
+	inventories []*entity.Inventory
+	applied     [][]*entity.Inventory
+}
+
+func (r *fakeBulkInventoryRepo) GetInventoriesByProducts(ctx context.Context, productIDs []int64, warehouseIDs []int) ([]*entity.Inventory, error) {
+	return r.inventories, nil
+}
+
+func (r *fakeBulkInventoryRepo) ListInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	for _, inv := range r.inventories {
+		if inv.ID > afterID && len(inventories) < limit {
+			inventories = append(inventories, inv)
+		}
+	}
+	return inventories, nil
+}
+
+func (r *fakeBulkInventoryRepo) SetInventories(ctx context.Context, inventories []*entity.Inventory, operator string, remark string) error {
+	r.applied = append(r.applied, inventories)
+	return nil
+}
+
+func newTestBulkService(repo *fakeBulkInventoryRepo) InventoryBulkService {
+	warehouses := &fakeTransferWarehouseRepo{warehouses: map[int]*entity.Warehouse{
+		1: {ID: 1, Status: 1},
+		2: {ID: 2, Status: 0},
+	}}
+	return NewInventoryBulkService(repo, warehouses, zap.NewNop())
+}
+
+func TestImportInventoryAppliesDiffs(t *testing.T) {
+	repo := &fakeBulkInventoryRepo{inventories: []*entity.Inventory{
+		{ProductID: 100, WarehouseID: 1, Stock: 10, LockStock: 2, AlertThreshold: 5},
+		{ProductID: 200, WarehouseID: 1, Stock: 8, AlertThreshold: 5},
+	}}
+	file := "goods_id,warehouse_id,stock\n" +
+		"100,1,12\n" +
+		"200,1,8\n" +
+		"300,1,4\n"
+
+	report, err := newTestBulkService(repo).ImportInventory(context.Background(), strings.NewReader(file), false, "tester")
+	if err != nil {
+		t.Fatalf("ImportInventory() error = %v", err)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Unchanged != 1 || report.Applied != 2 {
+		t.Errorf("created/updated/unchanged/applied = %d/%d/%d/%d, want 1/1/1/2",
+			report.Created, report.Updated, report.Unchanged, report.Applied)
+	}
+	if len(repo.applied) != 1 || len(repo.applied[0]) != 2 {
+		t.Fatalf("applied = %v, want one batch of 2", repo.applied)
+	}
+	// 未指定预警阈值时，已有记录保留原阈值，新建记录使用默认值
+	for _, inv := range repo.applied[0] {
+		if inv.ProductID == 100 && (inv.Stock != 12 || inv.AlertThreshold != 5) {
+			t.Errorf("product 100 = %+v, want stock 12 and threshold 5", inv)
+		}
+		if inv.ProductID == 300 && (inv.Stock != 4 || inv.AlertThreshold != defaultAlertThreshold) {
+			t.Errorf("product 300 = %+v, want stock 4 and default threshold", inv)
+		}
+	}
+}
+
+func TestImportInventoryRejectsWholeFileOnErrors(t *testing.T) {
+	repo := &fakeBulkInventoryRepo{inventories: []*entity.Inventory{
+		{ProductID: 100, WarehouseID: 1, Stock: 10, LockStock: 6},
+	}}
+	file := "goods_id,warehouse_id,stock\n" +
+		"100,1,5\n" +
+		"abc,1,5\n" +
+		"200,2,5\n" +
+		"300,9,5\n" +
+		"400,1,5\n"
+
+	report, err := newTestBulkService(repo).ImportInventory(context.Background(), strings.NewReader(file), false, "tester")
+	if err != nil {
+		t.Fatalf("ImportInventory() error = %v", err)
+	}
+	// 低于锁定数量、商品ID无效、仓库停用和仓库不存在各一个错误，有错误时不写入任何记录
+	lines := make(map[int]bool)
+	for _, e := range report.Errors {
+		lines[e.Line] = true
+	}
+	if len(report.Errors) != 4 || !lines[2] || !lines[3] || !lines[4] || !lines[5] {
+		t.Errorf("errors = %+v, want lines 2-5", report.Errors)
+	}
+	if len(repo.applied) != 0 {
+		t.Errorf("applied = %v, want nothing written", repo.applied)
+	}
+}
+
+func TestImportInventoryRejectsMissingColumns(t *testing.T) {
+	repo := &fakeBulkInventoryRepo{}
+	_, err := newTestBulkService(repo).ImportInventory(context.Background(), strings.NewReader("goods_id,stock\n100,5\n"), false, "tester")
+	if !errors.Is(err, ErrImportFileInvalid) {
+		t.Errorf("ImportInventory() error = %v, want %v", err, ErrImportFileInvalid)
+	}
+}
+
+func TestExportInventoryRoundTrips(t *testing.T) {
+	repo := &fakeBulkInventoryRepo{inventories: []*entity.Inventory{
+		{ID: 1, ProductID: 100, SkuID: 7, WarehouseID: 1, Stock: 10, AlertThreshold: 5},
+	}}
+	svc := newTestBulkService(repo)
+
+	var buf bytes.Buffer
+	if err := svc.ExportInventory(context.Background(), &buf, 0); err != nil {
+		t.Fatalf("ExportInventory() error = %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("exported %q, want a header and one row", buf.String())
+	}
+
+	// 导出的文件原样导入时没有差异
+	report, err := svc.ImportInventory(context.Background(), &buf, true, "tester")
+	if err != nil {
+		t.Fatalf("ImportInventory() error = %v", err)
+	}
+	if report.Unchanged != 1 || len(report.Diffs) != 0 || len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want the exported row unchanged", report)
+	}
+}
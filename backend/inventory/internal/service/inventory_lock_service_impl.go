@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 	
 	"go.uber.org/zap"
@@ -19,41 +20,109 @@ var (
 	ErrConfirmFailed   = errors.New("confirm inventory deduction failed")
 	ErrLockNotFound    = errors.New("lock record not found")
 	ErrInvalidLockKey  = errors.New("invalid lock key")
+	ErrLockSettled     = errors.New("lock already settled")
+	ErrExceedLocked    = errors.New("quantity exceeds locked quantity")
 )
 
+// 默认库存锁定超时时间（秒）
+const defaultLockTimeoutSeconds = 30 * 60
+
 // InventoryLockServiceImpl 库存锁定服务实现
 type InventoryLockServiceImpl struct {
-	repo   repository.InventoryRepository
-	logger *zap.Logger
+	repo               repository.InventoryRepository
+	allocator          *StockAllocator
+	lockTimeoutSeconds int
+	logger             *zap.Logger
 }
 
-// NewInventoryLockService 创建库存锁定服务实例
-func NewInventoryLockService(repo repository.InventoryRepository, logger *zap.Logger) InventoryLockService {
+// NewInventoryLockService 创建库存锁定服务实例，lockTimeoutSeconds为请求未指定超时时间时使用的默认值
+func NewInventoryLockService(repo repository.InventoryRepository, allocator *StockAllocator, lockTimeoutSeconds int, logger *zap.Logger) InventoryLockService {
+	if lockTimeoutSeconds <= 0 {
+		lockTimeoutSeconds = defaultLockTimeoutSeconds
+	}
+	
 	return &InventoryLockServiceImpl{
-		repo:   repo,
-		logger: logger,
+		repo:               repo,
+		allocator:          allocator,
+		lockTimeoutSeconds: lockTimeoutSeconds,
+		logger:             logger,
 	}
 }
 
-// LockInventory 锁定库存
-func (s *InventoryLockServiceImpl) LockInventory(ctx context.Context, lockKey string, items []LockItem, timeoutSeconds int) (*LockResult, error) {
+// LockInventory 锁定库存。默认整单锁定，opts.AllowPartial为true时锁定能满足的商品，其余商品在FailItems中返回
+func (s *InventoryLockServiceImpl) LockInventory(ctx context.Context, lockKey string, items []LockItem, timeoutSeconds int, opts LockOptions) (*LockResult, error) {
 	if lockKey == "" || len(items) == 0 {
 		return nil, ErrInvalidArgument
 	}
+	if opts.Channel != "" && !validChannel(opts.Channel) {
+		return nil, ErrInvalidChannel
+	}
+	
+	// 按分配策略决定从哪些仓库锁定
+	allocations, allocFailItems, err := s.allocator.Allocate(ctx, items, opts.Strategy, opts.Address, opts.Channel, opts.AllowBackorder)
+	if err != nil {
+		s.logger.Error("Failed to allocate inventory",
+			zap.String("lock_key", lockKey),
+			zap.String("strategy", opts.Strategy),
+			zap.Error(err))
+		return nil, err
+	}
+	if len(allocFailItems) > 0 && opts.AllowPartial && opts.AllowPartialQuantity {
+		// 按可用数量锁定时，分配失败但仍有库存的商品按可用数量重新分配
+		retryItems := make([]LockItem, 0, len(allocFailItems))
+		for _, failItem := range allocFailItems {
+			if failItem.Available > 0 {
+				retryItems = append(retryItems, LockItem{
+					ProductID: failItem.ProductID,
+					SkuID:     failItem.SkuID,
+					Quantity:  failItem.Available,
+				})
+			}
+		}
+		if len(retryItems) > 0 {
+			retryAllocations, _, err := s.allocator.Allocate(ctx, retryItems, opts.Strategy, opts.Address, opts.Channel, false)
+			if err != nil {
+				return nil, err
+			}
+			allocations = append(allocations, retryAllocations...)
+		}
+	}
+	if len(allocFailItems) > 0 && (!opts.AllowPartial || len(allocations) == 0) {
+		return &LockResult{
+			Success:   false,
+			Message:   fmt.Sprintf("%d items failed to allocate", len(allocFailItems)),
+			FailItems: allocFailItems,
+			Lines:     buildLockLines(items, nil, nil),
+		}, nil
+	}
 	
 	// 转换为仓储层需要的格式
-	stockOps := make([]*valueobject.StockOperation, 0, len(items))
-	for _, item := range items {
+	stockOps := make([]*valueobject.StockOperation, 0, len(allocations))
+	for _, allocation := range allocations {
 		stockOps = append(stockOps, &valueobject.StockOperation{
-			ProductID:   item.ProductID,
-			WarehouseID: 1, // 默认仓库ID
-			Quantity:    item.Quantity,
+			ProductID:   allocation.ProductID,
+			SkuID:       allocation.SkuID,
+			WarehouseID: allocation.WarehouseID,
+			Quantity:    allocation.Quantity,
 			OrderSN:     lockKey,
+			BundleID:    allocation.BundleID,
+			BundleUnit:  allocation.BundleUnit,
 		})
 	}
 	
+	// 计算锁定过期时间
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = s.lockTimeoutSeconds
+	}
+	expireTime := time.Now().Add(time.Duration(timeoutSeconds) * time.Second)
+	
 	// 调用仓储层锁定库存
-	result, err := s.repo.LockStock(ctx, lockKey, stockOps)
+	result, err := s.repo.LockStock(ctx, lockKey, stockOps, &expireTime, valueobject.LockOptions{
+		AllowPartial:         opts.AllowPartial,
+		AllowPartialQuantity: opts.AllowPartialQuantity,
+		Channel:              opts.Channel,
+		AllowBackorder:       opts.AllowBackorder,
+	})
 	if err != nil {
 		s.logger.Error("Failed to lock inventory",
 			zap.String("lock_key", lockKey),
@@ -63,14 +132,7 @@ func (s *InventoryLockServiceImpl) LockInventory(ctx context.Context, lockKey st
 		// 将仓储层的失败项转换为服务层的失败项
 		failItems := make([]*LockFailItem, 0)
 		if result != nil && len(result.FailItems) > 0 {
-			for _, item := range result.FailItems {
-				failItems = append(failItems, &LockFailItem{
-					ProductID: item.ProductID,
-					Quantity:  item.Quantity,
-					Available: item.Available,
-					Reason:    item.Reason,
-				})
-			}
+			failItems = append(failItems, toLockFailItems(result.FailItems)...)
 		}
 		
 		return &LockResult{
@@ -88,61 +150,194 @@ func (s *InventoryLockServiceImpl) LockInventory(ctx context.Context, lockKey st
 		}, nil
 	}
 	
-	// 将仓储层的结果转换为服务层的结果
+	// 将仓储层的结果转换为服务层的结果，部分锁定时分配失败的商品同样未锁满
 	serviceResult := &LockResult{
 		Success: result.Success,
+		Partial: result.Success && (result.Partial || len(allocFailItems) > 0),
 		Message: result.Message,
+		Lines:   buildLockLines(items, result.LockedItems, result.Backordered),
 	}
 	
-	if len(result.FailItems) > 0 {
-		serviceResult.FailItems = make([]*LockFailItem, 0, len(result.FailItems))
-		for _, item := range result.FailItems {
-			serviceResult.FailItems = append(serviceResult.FailItems, &LockFailItem{
-				ProductID: item.ProductID,
-				Quantity:  item.Quantity,
-				Available: item.Available,
-				Reason:    item.Reason,
-			})
-		}
+	if len(result.LockedItems) > 0 {
+		serviceResult.Allocations = toAllocations(result.LockedItems)
+	}
+	if len(result.Backordered) > 0 {
+		serviceResult.Backorders = toAllocations(result.Backordered)
+	}
+	
+	if len(result.FailItems) > 0 || len(allocFailItems) > 0 {
+		serviceResult.FailItems = make([]*LockFailItem, 0, len(allocFailItems)+len(result.FailItems))
+		serviceResult.FailItems = append(serviceResult.FailItems, allocFailItems...)
+		serviceResult.FailItems = append(serviceResult.FailItems, toLockFailItems(result.FailItems)...)
 	}
 	
 	return serviceResult, nil
 }
 
-// UnlockInventory 解锁库存
-func (s *InventoryLockServiceImpl) UnlockInventory(ctx context.Context, lockKey string) error {
+// toLockFailItems 将仓储层的失败项转换为服务层的失败项
+func toLockFailItems(items []*valueobject.LockFailItem) []*LockFailItem {
+	failItems := make([]*LockFailItem, 0, len(items))
+	for _, item := range items {
+		failItems = append(failItems, &LockFailItem{
+			ProductID:     item.ProductID,
+			SkuID:         item.SkuID,
+			Quantity:      item.Quantity,
+			Available:     item.Available,
+			Backorderable: item.Backorderable,
+			Code:          item.Code,
+			Reason:        item.Reason,
+		})
+	}
+	return failItems
+}
+
+// toAllocations 将仓储层的锁定或预订商品转换为仓库分配
+func toAllocations(items []*valueobject.StockOperation) []*Allocation {
+	allocations := make([]*Allocation, 0, len(items))
+	for _, item := range items {
+		allocations = append(allocations, &Allocation{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			WarehouseID: item.WarehouseID,
+			Quantity:    item.Quantity,
+			BundleID:    item.BundleID,
+			BundleUnit:  item.BundleUnit,
+		})
+	}
+	return allocations
+}
+
+// buildLockLines 按请求中商品SKU出现的顺序汇总请求数量、实际锁定数量和排队预订数量，套装的锁定数量按套数计算
+func buildLockLines(items []LockItem, lockedItems []*valueobject.StockOperation, backordered []*valueobject.StockOperation) []*LockLine {
+	lines := make([]*LockLine, 0, len(items))
+	lineByKey := make(map[valueobject.SkuKey]*LockLine, len(items))
+	for _, item := range items {
+		line, ok := lineByKey[item.skuKey()]
+		if !ok {
+			line = &LockLine{ProductID: item.ProductID, SkuID: item.SkuID}
+			lineByKey[item.skuKey()] = line
+			lines = append(lines, line)
+		}
+		line.Requested += item.Quantity
+	}
+	
+	// 套装的组件整套锁定，每个组件锁定的套数相同，取各组件套数的最小值
+	bundleUnits := make(map[int64]map[valueobject.SkuKey]int)
+	for _, lockedItem := range lockedItems {
+		key := valueobject.SkuKey{ProductID: lockedItem.ProductID, SkuID: lockedItem.SkuID}
+		if lockedItem.BundleID != 0 {
+			if bundleUnits[lockedItem.BundleID] == nil {
+				bundleUnits[lockedItem.BundleID] = make(map[valueobject.SkuKey]int)
+			}
+			bundleUnits[lockedItem.BundleID][key] += lockedItem.Quantity / max(lockedItem.BundleUnit, 1)
+			continue
+		}
+		if line, ok := lineByKey[key]; ok {
+			line.Locked += lockedItem.Quantity
+		}
+	}
+	for bundleID, components := range bundleUnits {
+		line, ok := lineByKey[valueobject.SkuKey{ProductID: bundleID}]
+		if !ok {
+			continue
+		}
+		units := -1
+		for _, u := range components {
+			if units < 0 || u < units {
+				units = u
+			}
+		}
+		line.Locked += units
+	}
+	for _, item := range backordered {
+		key := valueobject.SkuKey{ProductID: item.ProductID, SkuID: item.SkuID}
+		if line, ok := lineByKey[key]; ok {
+			line.Backordered += item.Quantity
+		}
+	}
+	
+	return lines
+}
+
+// UnlockInventory 解锁库存，items为空时归还整单剩余的锁定，否则只归还指定商品的数量
+func (s *InventoryLockServiceImpl) UnlockInventory(ctx context.Context, lockKey string, items []LockItem) error {
 	if lockKey == "" {
 		return ErrInvalidLockKey
 	}
 	
-	err := s.repo.UnlockStock(ctx, lockKey)
+	lines, err := toSettleLines(items)
+	if err != nil {
+		return err
+	}
+	
+	err = s.repo.UnlockStock(ctx, lockKey, lines)
 	if err != nil {
 		s.logger.Error("Failed to unlock inventory",
 			zap.String("lock_key", lockKey),
 			zap.Error(err))
-		return ErrUnlockFailed
+		return settleError(err, ErrUnlockFailed)
 	}
 	
 	return nil
 }
 
-// ConfirmReduce 确认扣减库存
-func (s *InventoryLockServiceImpl) ConfirmReduce(ctx context.Context, lockKey string) error {
+// ConfirmReduce 确认扣减库存，items为空时扣减整单剩余的锁定，否则只扣减指定商品的数量
+func (s *InventoryLockServiceImpl) ConfirmReduce(ctx context.Context, lockKey string, items []LockItem) error {
 	if lockKey == "" {
 		return ErrInvalidLockKey
 	}
 	
-	err := s.repo.ReduceStock(ctx, lockKey)
+	lines, err := toSettleLines(items)
+	if err != nil {
+		return err
+	}
+	
+	err = s.repo.ReduceStock(ctx, lockKey, lines)
 	if err != nil {
 		s.logger.Error("Failed to confirm reduce stock",
 			zap.String("lock_key", lockKey),
 			zap.Error(err))
-		return ErrConfirmFailed
+		return settleError(err, ErrConfirmFailed)
 	}
 	
 	return nil
 }
 
+// toSettleLines 将部分扣减或归还的商品转换为锁定明细行
+func toSettleLines(items []LockItem) ([]*entity.StockDetail, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	
+	lines := make([]*entity.StockDetail, 0, len(items))
+	for _, item := range items {
+		if item.ProductID <= 0 || item.SkuID < 0 || item.Quantity <= 0 {
+			return nil, ErrInvalidArgument
+		}
+		lines = append(lines, &entity.StockDetail{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			Quantity:    item.Quantity,
+			WarehouseID: item.WarehouseID,
+		})
+	}
+	return lines, nil
+}
+
+// settleError 转换扣减或归还失败的错误，无法识别的错误返回fallback
+func settleError(err error, fallback error) error {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return ErrLockNotFound
+	case errors.Is(err, repository.ErrStockNotLocked):
+		return ErrLockSettled
+	case errors.Is(err, repository.ErrExceedLockedQuantity):
+		return ErrExceedLocked
+	default:
+		return fallback
+	}
+}
+
 // GetLockDetail 获取锁定记录详情
 func (s *InventoryLockServiceImpl) GetLockDetail(ctx context.Context, lockKey string) (*entity.StockSellDetail, error) {
 	if lockKey == "" {
@@ -164,11 +359,19 @@ func (s *InventoryLockServiceImpl) GetLockDetail(ctx context.Context, lockKey st
 }
 
 // GetExpiredLocks 获取过期未处理的锁定记录
-func (s *InventoryLockServiceImpl) GetExpiredLocks(ctx context.Context, before time.Time) ([]string, error) {
-	// 这里需要扩展仓储接口添加获取过期锁定记录的方法
-	// 简单实现，假设我们已经有这样的方法
-	// return s.repo.GetExpiredLocks(ctx, before)
+func (s *InventoryLockServiceImpl) GetExpiredLocks(ctx context.Context, before time.Time, afterID int64, limit int) ([]*entity.StockSellDetail, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	
+	details, err := s.repo.ListExpiredLocks(ctx, before, afterID, limit)
+	if err != nil {
+		s.logger.Error("Failed to get expired locks",
+			zap.Time("before", before),
+			zap.Int64("after_id", afterID),
+			zap.Error(err))
+		return nil, err
+	}
 	
-	s.logger.Warn("GetExpiredLocks method not implemented")
-	return []string{}, nil
+	return details, nil
 }
@@ -2,24 +2,31 @@ package service
 
 import (
 	"context"
+	"io"
 	"time"
 	
 	"shop/backend/inventory/internal/domain/entity"
 	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+	"shop/backend/inventory/internal/watch"
 )
 
 // InventoryService 库存服务接口
 type InventoryService interface {
-	// 基本库存查询
-	GetInventory(ctx context.Context, productID int64) (*entity.Inventory, error)
-	BatchGetInventory(ctx context.Context, productIDs []int64) ([]*entity.Inventory, error)
-	GetAvailableStock(ctx context.Context, productID int64) (int, error)
-	CheckStockAvailable(ctx context.Context, productID int64, quantity int) (bool, error)
+	// 基本库存查询，skuID为0时查询商品级库存
+	GetInventory(ctx context.Context, productID int64, skuID int64) (*entity.Inventory, error)
+	BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey) ([]*entity.Inventory, error)
+	GetAvailableStock(ctx context.Context, productID int64, skuID int64) (int, error)
+	CheckStockAvailable(ctx context.Context, productID int64, skuID int64, quantity int) (bool, error)
+	ListLowStock(ctx context.Context, warehouseID int, page, pageSize int) ([]*entity.Inventory, int64, error)
 	
 	// 库存操作
-	SetInventory(ctx context.Context, productID int64, stock int, operator string) error
-	AddStock(ctx context.Context, productID int64, quantity int, remark string) error
-	AdjustStock(ctx context.Context, productID int64, newStock int, operator string, remark string) error
+	SetInventory(ctx context.Context, productID int64, skuID int64, stock int, operator string) error
+	// referenceSN为入库关联的单据号，如供应商送货单号，可为空；lot不为空时入库到指定批次
+	AddStock(ctx context.Context, productID int64, skuID int64, quantity int, referenceSN string, remark string, lot *valueobject.LotInfo) error
+	AdjustStock(ctx context.Context, productID int64, skuID int64, newStock int, operator string, remark string) error
+	// 将商品级库存拆分到SKU，skuStocks为每个SKU分得的数量
+	SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error
 	
 	// 库存历史
 	GetInventoryHistory(ctx context.Context, productID int64, page, pageSize int) ([]*entity.InventoryHistory, int64, error)
@@ -28,32 +35,79 @@ type InventoryService interface {
 // InventoryLockService 库存锁定服务接口
 type InventoryLockService interface {
 	// 库存锁定相关
-	LockInventory(ctx context.Context, lockKey string, items []LockItem, timeoutSeconds int) (*LockResult, error)
-	UnlockInventory(ctx context.Context, lockKey string) error
-	ConfirmReduce(ctx context.Context, lockKey string) error
+	LockInventory(ctx context.Context, lockKey string, items []LockItem, timeoutSeconds int, opts LockOptions) (*LockResult, error)
+	UnlockInventory(ctx context.Context, lockKey string, items []LockItem) error
+	ConfirmReduce(ctx context.Context, lockKey string, items []LockItem) error
 	GetLockDetail(ctx context.Context, lockKey string) (*entity.StockSellDetail, error)
-	GetExpiredLocks(ctx context.Context, before time.Time) ([]string, error)
+	// GetExpiredLocks 按ID顺序分页获取过期的锁定记录，afterID为上一页最后一条记录的ID
+	GetExpiredLocks(ctx context.Context, before time.Time, afterID int64, limit int) ([]*entity.StockSellDetail, error)
 }
 
 // LockItem 锁定项目
 type LockItem struct {
-	ProductID int64
-	Quantity  int
+	ProductID   int64
+	SkuID       int64 // SKU ID，为0表示商品级库存
+	Quantity    int
+	WarehouseID int // 指定仓库ID，为0时由分配策略决定
 }
 
-// LockFailItem 锁定失败项
+// skuKey 返回锁定项的库存单元标识
+func (i LockItem) skuKey() valueobject.SkuKey {
+	return valueobject.SkuKey{ProductID: i.ProductID, SkuID: i.SkuID}
+}
+
+// LockOptions 锁定选项
+type LockOptions struct {
+	Strategy             string          // 仓库分配策略，为空时使用默认策略
+	Address              DeliveryAddress // 收货地址，用于就近分配
+	AllowPartial         bool            // 允许部分锁定，库存不足的商品跳过，其余商品照常锁定
+	AllowPartialQuantity bool            // 部分锁定时，库存不足的商品按可用数量锁定
+	Channel              string          // 销售渠道，先使用分配给该渠道的库存，为空时只使用共享可用库存
+	AllowBackorder       bool            // 可用库存不足时，开启预售的库存记录将不足的数量排队预订，到货后自动锁定
+}
+
+// DeliveryAddress 收货地址
+type DeliveryAddress struct {
+	Detail     string
+	Latitude   float64
+	Longitude  float64
+	RegionCode string // 地区编码，与仓库的所在地区和配送覆盖地区对应
+}
+
+// HasLocation 判断收货地址是否带有经纬度
+func (a DeliveryAddress) HasLocation() bool {
+	return a.Latitude != 0 || a.Longitude != 0
+}
+
+// LockFailItem 锁定失败项，Backorderable为还可以排队预订的数量
 type LockFailItem struct {
-	ProductID int64
-	Quantity  int
-	Available int
-	Reason    string
+	ProductID     int64
+	SkuID         int64
+	Quantity      int
+	Available     int
+	Backorderable int
+	Code          valueobject.LockFailCode
+	Reason        string
+}
+
+// LockLine 单个商品SKU的锁定结果
+type LockLine struct {
+	ProductID   int64
+	SkuID       int64
+	Requested   int // 请求数量
+	Locked      int // 实际锁定数量，多个仓库的分配合计
+	Backordered int // 排队预订的数量，到货后转为锁定
 }
 
 // LockResult 锁定结果
 type LockResult struct {
-	Success   bool
-	Message   string
-	FailItems []*LockFailItem
+	Success     bool
+	Partial     bool // 部分锁定成功，存在未锁定或未锁满的商品
+	Message     string
+	FailItems   []*LockFailItem
+	Allocations []*Allocation // 实际锁定的仓库分配
+	Backorders  []*Allocation // 排队预订的仓库分配
+	Lines       []*LockLine   // 按请求商品汇总的锁定数量和预订数量
 }
 
 // WarehouseService 仓库服务接口
@@ -61,8 +115,126 @@ type WarehouseService interface {
 	// 仓库管理
 	GetWarehouse(ctx context.Context, id int) (*entity.Warehouse, error)
 	GetWarehouseByName(ctx context.Context, name string) (*entity.Warehouse, error)
-	ListWarehouses(ctx context.Context, page, pageSize int) ([]*entity.Warehouse, int64, error)
+	// filter为nil时不过滤
+	ListWarehouses(ctx context.Context, filter *repository.WarehouseFilter, page, pageSize int) ([]*entity.Warehouse, int64, error)
 	CreateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error
 	UpdateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error
+	// DeleteWarehouse 仓库仍有库存、锁定、在途调拨、未收齐的入库单或排队中的缺货预订时返回ErrWarehouseNotEmpty
 	DeleteWarehouse(ctx context.Context, id int) error
 }
+
+// TransferService 仓库调拨服务接口
+type TransferService interface {
+	CreateTransfer(ctx context.Context, order *entity.TransferOrder) error
+	ShipTransfer(ctx context.Context, transferSN string, operator string) (*entity.TransferOrder, error)
+	ReceiveTransfer(ctx context.Context, transferSN string, operator string) (*entity.TransferOrder, error)
+	CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) (*entity.TransferOrder, error)
+	GetTransfer(ctx context.Context, transferSN string) (*entity.TransferOrder, error)
+}
+
+// InboundService 采购入库服务接口
+type InboundService interface {
+	CreateInbound(ctx context.Context, order *entity.InboundOrder) error
+	// ReceiveInbound 登记收货并将收货数量入账，使用同一收货单号重试时只补入尚未入账的明细
+	ReceiveInbound(ctx context.Context, receipt *entity.InboundReceipt) (*entity.InboundOrder, error)
+	CloseInbound(ctx context.Context, inboundSN string, operator string, reason string) (*entity.InboundOrder, error)
+	GetInbound(ctx context.Context, inboundSN string) (*entity.InboundOrder, error)
+	ListReceipts(ctx context.Context, inboundSN string) ([]*entity.InboundReceipt, error)
+}
+
+// LotService 库存批次服务接口
+type LotService interface {
+	// ListExpiringLots 查询within时长内到期的批次
+	ListExpiringLots(ctx context.Context, warehouseID int, within time.Duration, includeExpired bool, page, pageSize int) ([]*entity.InventoryLot, int64, error)
+	// ExpireLots 标记已到期的批次，返回本次标记的数量
+	ExpireLots(ctx context.Context, now time.Time, limit int) (int, error)
+	// WriteOffExpiredLot 报废已过期的批次，返回报废后的批次和核销的数量
+	WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error)
+}
+
+// InventoryWatchService 库存变更订阅服务接口
+type InventoryWatchService interface {
+	// Watch 订阅商品或仓库的库存变更，返回订阅和订阅商品的当前库存，调用方负责关闭订阅
+	Watch(ctx context.Context, productIDs []int64, warehouseID int) (*watch.Subscription, []*entity.Inventory, error)
+}
+
+// InventoryBulkService 库存批量导入导出服务接口，文件为CSV格式，列为goods_id、warehouse_id、stock、alert_threshold，可选sku_id
+type InventoryBulkService interface {
+	// ImportInventory 校验并导入库存，dryRun为true时只返回差异报告
+	ImportInventory(ctx context.Context, r io.Reader, dryRun bool, operator string) (*valueobject.InventoryImportReport, error)
+	// ExportInventory 导出库存，warehouseID为0时导出所有仓库
+	ExportInventory(ctx context.Context, w io.Writer, warehouseID int) error
+}
+
+// ChannelAllocationService 渠道库存分配服务接口，渠道分配和安全库存只改变各渠道的可售数量
+type ChannelAllocationService interface {
+	// SetChannelAllocation 设置库存记录分配给渠道的数量，allocated包含渠道已锁定的部分，为0时取消分配
+	SetChannelAllocation(ctx context.Context, key valueobject.StockKey, channel string, allocated int, operator string) (*entity.InventoryChannelAllocation, error)
+	// ListChannelAllocations 查询商品的渠道分配，warehouseID为0时不限仓库，channel为空时不限渠道
+	ListChannelAllocations(ctx context.Context, productID int64, warehouseID int, channel string) ([]*entity.InventoryChannelAllocation, error)
+	// SetSafetyStock 设置库存记录的安全库存
+	SetSafetyStock(ctx context.Context, key valueobject.StockKey, safetyStock int, operator string) error
+}
+
+// BackorderService 缺货预订服务接口，开启预售的库存记录在可用库存不足时接受排队预订，入库后按排队顺序自动锁定
+type BackorderService interface {
+	// SetBackorderLimit 设置库存记录的预售上限，为0时关闭预售
+	SetBackorderLimit(ctx context.Context, key valueobject.StockKey, limit int, operator string) error
+	// ListBackorders filter为nil时不过滤，按排队顺序返回
+	ListBackorders(ctx context.Context, filter *repository.BackorderFilter, page, pageSize int) ([]*entity.InventoryBackorder, int64, error)
+	// FulfillQueued 按排队顺序为所有有排队预订的库存记录分配可用库存，返回本次有到货的预订数量
+	FulfillQueued(ctx context.Context, batchSize int) (int, error)
+}
+
+// BundleService 套装服务接口，套装是由组件商品组成的虚拟商品，可售套数由组件库存计算，锁定时按组件锁定
+type BundleService interface {
+	// SaveBundle 创建或更新套装定义，组件不能是套装，套装商品本身不能有库存记录
+	SaveBundle(ctx context.Context, bundle *entity.InventoryBundle) error
+	GetBundle(ctx context.Context, productID int64) (*entity.InventoryBundle, error)
+	// DeleteBundle 删除套装定义，已锁定的订单仍按锁定时的组件扣减和归还
+	DeleteBundle(ctx context.Context, productID int64) error
+}
+
+// LedgerService 库存流水核对服务接口
+type LedgerService interface {
+	// Reconcile 核对所有库存记录的库存数量与变更历史、锁定数量与未完结锁定，repair为true时修复差异
+	Reconcile(ctx context.Context, repair bool, operator string, batchSize int) (*valueobject.LedgerReport, error)
+}
+
+// StocktakeService 仓库盘点服务接口
+type StocktakeService interface {
+	OpenStocktake(ctx context.Context, session *entity.StocktakeSession, productIDs []int64) error
+	SubmitCounts(ctx context.Context, sessionSN string, counts map[valueobject.SkuKey]int, counter string) error
+	PreviewStocktake(ctx context.Context, sessionSN string) (*StocktakePreview, error)
+	CommitStocktake(ctx context.Context, sessionSN string, operator string) (*StocktakePreview, error)
+	CancelStocktake(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error)
+}
+
+// StocktakeVariance 单个商品SKU的盘点差异
+type StocktakeVariance struct {
+	ProductID      int64
+	SkuID          int64
+	Counted        bool
+	BookStock      int  // 录入盘点时的账面库存
+	CountedStock   int  // 实盘数量
+	Variance       int  // 差异，正数为盘盈，负数为盘亏
+	CurrentStock   int  // 当前账面库存
+	ProjectedStock int  // 提交后的库存
+	LockedStock    int  // 当前锁定数量
+	Conflict       bool // 提交后的库存低于锁定数量，提交会失败
+}
+
+// StocktakePreview 盘点差异预览
+type StocktakePreview struct {
+	Session   *entity.StocktakeSession
+	Items     []*StocktakeVariance
+	TotalGain int // 盘盈总数
+	TotalLoss int // 盘亏总数
+	Uncounted int // 未盘点的商品数
+}
+
+// AuditService 库存审计查询服务接口
+type AuditService interface {
+	ListInventoryChanges(ctx context.Context, filter *repository.InventoryChangeFilter, page, pageSize int) ([]*entity.InventoryChangeRecord, int64, error)
+	GetActivitySummary(ctx context.Context, filter *repository.InventoryChangeFilter) ([]*entity.InventoryActivitySummary, error)
+}
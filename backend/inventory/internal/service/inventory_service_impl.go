@@ -3,11 +3,13 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 	
 	"go.uber.org/zap"
 	
 	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
 	"shop/backend/inventory/internal/repository"
 )
 
@@ -17,6 +19,8 @@ var (
 	ErrInsufficientStock  = errors.New("insufficient stock")
 	ErrStockNotFound      = errors.New("stock not found")
 	ErrOperationFailed    = errors.New("operation failed")
+	// ErrStockHasLocks 库存存在未处理的锁定，不能拆分，也不能将库存调整到锁定数量以下
+	ErrStockHasLocks      = errors.New("stock has locked quantity")
 )
 
 // InventoryServiceImpl 库存服务实现
@@ -33,18 +37,28 @@ func NewInventoryService(repo repository.InventoryRepository, logger *zap.Logger
 	}
 }
 
-// GetInventory 获取库存信息
-func (s *InventoryServiceImpl) GetInventory(ctx context.Context, productID int64) (*entity.Inventory, error) {
+// GetInventory 获取库存信息，skuID为0时获取商品级库存，商品为套装时返回按组件计算的可售套数
+func (s *InventoryServiceImpl) GetInventory(ctx context.Context, productID int64, skuID int64) (*entity.Inventory, error) {
 	// 默认使用仓库ID为1
 	const defaultWarehouseID = 1
 	
-	inventory, err := s.repo.GetInventory(ctx, productID, defaultWarehouseID)
+	inventory, err := s.repo.GetInventory(ctx, productID, skuID, defaultWarehouseID)
 	if err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
+			if skuID == 0 {
+				bundleInventories, err := s.bundleInventories(ctx, []int64{productID}, defaultWarehouseID)
+				if err != nil {
+					return nil, err
+				}
+				if len(bundleInventories) > 0 {
+					return bundleInventories[0], nil
+				}
+			}
 			return nil, ErrStockNotFound
 		}
 		s.logger.Error("Failed to get inventory",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Error(err))
 		return nil, err
 	}
@@ -53,28 +67,85 @@ func (s *InventoryServiceImpl) GetInventory(ctx context.Context, productID int64
 }
 
 // BatchGetInventory 批量获取库存信息
-func (s *InventoryServiceImpl) BatchGetInventory(ctx context.Context, productIDs []int64) ([]*entity.Inventory, error) {
+func (s *InventoryServiceImpl) BatchGetInventory(ctx context.Context, keys []valueobject.SkuKey) ([]*entity.Inventory, error) {
 	// 默认使用仓库ID为1
 	const defaultWarehouseID = 1
 	
-	if len(productIDs) == 0 {
+	if len(keys) == 0 {
 		return []*entity.Inventory{}, nil
 	}
 	
-	inventories, err := s.repo.BatchGetInventory(ctx, productIDs, defaultWarehouseID)
+	inventories, err := s.repo.BatchGetInventory(ctx, keys, defaultWarehouseID)
 	if err != nil {
 		s.logger.Error("Failed to batch get inventory",
-			zap.Any("product_ids", productIDs),
+			zap.Any("keys", keys),
 			zap.Error(err))
 		return nil, err
 	}
 	
+	// 没有库存记录的商品级查询可能是套装
+	found := make(map[valueobject.SkuKey]bool, len(inventories))
+	for _, inventory := range inventories {
+		found[valueobject.SkuKey{ProductID: inventory.ProductID, SkuID: inventory.SkuID}] = true
+	}
+	missing := make([]int64, 0)
+	for _, key := range keys {
+		if key.SkuID == 0 && !found[key] {
+			missing = append(missing, key.ProductID)
+		}
+	}
+	if len(missing) > 0 {
+		bundleInventories, err := s.bundleInventories(ctx, missing, defaultWarehouseID)
+		if err != nil {
+			return nil, err
+		}
+		inventories = append(inventories, bundleInventories...)
+	}
+	
+	return inventories, nil
+}
+
+// bundleInventories 根据仓库中组件的可用库存生成套装的库存信息，库存数量为可售套数，不是套装的商品不返回
+func (s *InventoryServiceImpl) bundleInventories(ctx context.Context, productIDs []int64, warehouseID int) ([]*entity.Inventory, error) {
+	bundles, err := s.repo.GetBundles(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundles) == 0 {
+		return nil, nil
+	}
+	
+	componentIDs := make([]int64, 0)
+	for _, bundle := range bundles {
+		for _, component := range bundle.Components {
+			componentIDs = append(componentIDs, component.ProductID)
+		}
+	}
+	components, err := s.repo.GetInventoriesByProducts(ctx, componentIDs, []int{warehouseID})
+	if err != nil {
+		s.logger.Error("Failed to get bundle components",
+			zap.Int64s("component_ids", componentIDs),
+			zap.Error(err))
+		return nil, err
+	}
+	
+	inventories := make([]*entity.Inventory, 0, len(bundles))
+	for _, bundle := range bundles {
+		inventories = append(inventories, &entity.Inventory{
+			ProductID:   bundle.ProductID,
+			WarehouseID: warehouseID,
+			Stock:       bundle.AvailableUnits(components),
+			Bundle:      true,
+			CreatedAt:   bundle.CreatedAt,
+			UpdatedAt:   bundle.UpdatedAt,
+		})
+	}
 	return inventories, nil
 }
 
 // GetAvailableStock 获取可用库存数量
-func (s *InventoryServiceImpl) GetAvailableStock(ctx context.Context, productID int64) (int, error) {
-	inventory, err := s.GetInventory(ctx, productID)
+func (s *InventoryServiceImpl) GetAvailableStock(ctx context.Context, productID int64, skuID int64) (int, error) {
+	inventory, err := s.GetInventory(ctx, productID, skuID)
 	if err != nil {
 		return 0, err
 	}
@@ -83,12 +154,12 @@ func (s *InventoryServiceImpl) GetAvailableStock(ctx context.Context, productID
 }
 
 // CheckStockAvailable 检查库存是否充足
-func (s *InventoryServiceImpl) CheckStockAvailable(ctx context.Context, productID int64, quantity int) (bool, error) {
+func (s *InventoryServiceImpl) CheckStockAvailable(ctx context.Context, productID int64, skuID int64, quantity int) (bool, error) {
 	if quantity <= 0 {
 		return false, ErrInvalidArgument
 	}
 	
-	inventory, err := s.GetInventory(ctx, productID)
+	inventory, err := s.GetInventory(ctx, productID, skuID)
 	if err != nil {
 		return false, err
 	}
@@ -96,22 +167,23 @@ func (s *InventoryServiceImpl) CheckStockAvailable(ctx context.Context, productI
 	return inventory.IsAvailable(quantity), nil
 }
 
-// SetInventory 设置商品库存
-func (s *InventoryServiceImpl) SetInventory(ctx context.Context, productID int64, stock int, operator string) error {
-	if productID <= 0 || stock < 0 {
+// SetInventory 设置商品库存，库存数量和调整历史在同一事务内写入
+func (s *InventoryServiceImpl) SetInventory(ctx context.Context, productID int64, skuID int64, stock int, operator string) error {
+	if productID <= 0 || skuID < 0 || stock < 0 {
 		return ErrInvalidArgument
 	}
 	
 	const defaultWarehouseID = 1
 	
-	// 先查询是否存在
-	inventory, err := s.repo.GetInventory(ctx, productID, defaultWarehouseID)
+	// 先查询是否存在，已存在时保留原有的预警阈值
+	inventory, err := s.repo.GetInventory(ctx, productID, skuID, defaultWarehouseID)
 	if err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
 			// 不存在则创建新记录
 			now := time.Now()
 			inventory = &entity.Inventory{
 				ProductID:   productID,
+				SkuID:       skuID,
 				Stock:       stock,
 				WarehouseID: defaultWarehouseID,
 				CreatedAt:   now,
@@ -124,34 +196,16 @@ func (s *InventoryServiceImpl) SetInventory(ctx context.Context, productID int64
 			return err
 		}
 	} else {
-		// 记录变更前的数量
-		oldStock := inventory.Stock
-		
 		// 存在则更新
 		inventory.Stock = stock
 		inventory.UpdatedAt = time.Now()
-		
-		// 记录历史
-		historyRecord := &entity.InventoryHistory{
-			ProductID:   productID,
-			WarehouseID: defaultWarehouseID,
-			Quantity:    stock - oldStock, // 正数表示增加，负数表示减少
-			Operation:   entity.OperationAdjust,
-			Operator:    operator,
-			Remark:      "手动设置库存",
-			CreatedAt:   time.Now(),
-		}
-		
-		if err := s.repo.RecordInventoryHistory(ctx, historyRecord); err != nil {
-			s.logger.Warn("Failed to record inventory history",
-				zap.Int64("product_id", productID),
-				zap.Error(err))
-			// 不影响主流程，继续执行
-		}
 	}
 	
-	// 保存或更新库存
-	if err := s.repo.SetInventory(ctx, inventory); err != nil {
+	// 保存或更新库存，库存数量变化时记录调整历史
+	if err := s.repo.SetInventories(ctx, []*entity.Inventory{inventory}, operator, "手动设置库存"); err != nil {
+		if errors.Is(err, repository.ErrStockBelowLocked) {
+			return ErrStockHasLocks
+		}
 		s.logger.Error("Failed to set inventory",
 			zap.Int64("product_id", productID),
 			zap.Int("stock", stock),
@@ -163,17 +217,18 @@ func (s *InventoryServiceImpl) SetInventory(ctx context.Context, productID int64
 }
 
 // AddStock 增加库存
-func (s *InventoryServiceImpl) AddStock(ctx context.Context, productID int64, quantity int, remark string) error {
-	if productID <= 0 || quantity <= 0 {
+func (s *InventoryServiceImpl) AddStock(ctx context.Context, productID int64, skuID int64, quantity int, referenceSN string, remark string, lot *valueobject.LotInfo) error {
+	if productID <= 0 || skuID < 0 || quantity <= 0 || (lot != nil && lot.LotNo == "") {
 		return ErrInvalidArgument
 	}
 	
 	const defaultWarehouseID = 1
 	
-	err := s.repo.IncreaseStock(ctx, productID, defaultWarehouseID, quantity, remark)
+	err := s.repo.IncreaseStock(ctx, productID, skuID, defaultWarehouseID, quantity, referenceSN, remark, lot)
 	if err != nil {
 		s.logger.Error("Failed to increase stock",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("quantity", quantity),
 			zap.Error(err))
 		return ErrOperationFailed
@@ -183,17 +238,21 @@ func (s *InventoryServiceImpl) AddStock(ctx context.Context, productID int64, qu
 }
 
 // AdjustStock 调整库存（库存盘点）
-func (s *InventoryServiceImpl) AdjustStock(ctx context.Context, productID int64, newStock int, operator string, remark string) error {
-	if productID <= 0 || newStock < 0 {
+func (s *InventoryServiceImpl) AdjustStock(ctx context.Context, productID int64, skuID int64, newStock int, operator string, remark string) error {
+	if productID <= 0 || skuID < 0 || newStock < 0 {
 		return ErrInvalidArgument
 	}
 	
 	const defaultWarehouseID = 1
 	
-	err := s.repo.AdjustStock(ctx, productID, defaultWarehouseID, newStock, operator, remark)
+	err := s.repo.AdjustStock(ctx, productID, skuID, defaultWarehouseID, newStock, operator, remark)
 	if err != nil {
+		if errors.Is(err, repository.ErrStockBelowLocked) {
+			return ErrStockHasLocks
+		}
 		s.logger.Error("Failed to adjust stock",
 			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
 			zap.Int("new_stock", newStock),
 			zap.Error(err))
 		return ErrOperationFailed
@@ -202,6 +261,40 @@ func (s *InventoryServiceImpl) AdjustStock(ctx context.Context, productID int64,
 	return nil
 }
 
+// SplitInventory 将商品在仓库中的商品级库存拆分到各SKU，用于商品启用规格后迁移已有库存
+func (s *InventoryServiceImpl) SplitInventory(ctx context.Context, productID int64, warehouseID int, skuStocks map[int64]int, operator string) error {
+	if productID <= 0 || warehouseID <= 0 || len(skuStocks) == 0 {
+		return ErrInvalidArgument
+	}
+	
+	err := s.repo.SplitInventory(ctx, productID, warehouseID, skuStocks, operator)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return ErrStockNotFound
+	case errors.Is(err, repository.ErrStockLocked):
+		return ErrStockHasLocks
+	case errors.Is(err, repository.ErrSplitQuantityMismatch):
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	default:
+		s.logger.Error("Failed to split inventory",
+			zap.Int64("product_id", productID),
+			zap.Int("warehouse_id", warehouseID),
+			zap.Error(err))
+		return ErrOperationFailed
+	}
+}
+
+// ListLowStock 查询低于预警阈值的库存，warehouseID为0时查询所有仓库
+func (s *InventoryServiceImpl) ListLowStock(ctx context.Context, warehouseID int, page, pageSize int) ([]*entity.Inventory, int64, error) {
+	if warehouseID < 0 || page <= 0 || pageSize <= 0 {
+		return nil, 0, ErrInvalidArgument
+	}
+	
+	return s.repo.ListLowStock(ctx, warehouseID, page, pageSize)
+}
+
 // GetInventoryHistory 获取库存历史记录
 func (s *InventoryServiceImpl) GetInventoryHistory(ctx context.Context, productID int64, page, pageSize int) ([]*entity.InventoryHistory, int64, error) {
 	if productID <= 0 || page <= 0 || pageSize <= 0 {
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 默认每批核对的库存记录数量
+const defaultLedgerBatchSize = 500
+
+// LedgerServiceImpl 库存流水核对服务实现
+type LedgerServiceImpl struct {
+	repo   repository.InventoryRepository
+	logger *zap.Logger
+}
+
+// NewLedgerService 创建库存流水核对服务实例
+func NewLedgerService(repo repository.InventoryRepository, logger *zap.Logger) LedgerService {
+	return &LedgerServiceImpl{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Reconcile 按ID顺序分批核对库存记录。先用快照数据筛出疑似差异，再逐条锁定库存记录重新核对，
+// 排除核对期间正常的锁定和扣减造成的误报
+func (s *LedgerServiceImpl) Reconcile(ctx context.Context, repair bool, operator string, batchSize int) (*valueobject.LedgerReport, error) {
+	if batchSize <= 0 {
+		batchSize = defaultLedgerBatchSize
+	}
+
+	openLocks, err := s.repo.SumOpenLocks(ctx)
+	if err != nil {
+		return nil, ErrOperationFailed
+	}
+
+	report := &valueobject.LedgerReport{}
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		inventories, err := s.repo.ListInventories(ctx, afterID, batchSize)
+		if err != nil {
+			return report, ErrOperationFailed
+		}
+		if len(inventories) == 0 {
+			break
+		}
+
+		keys := make([]valueobject.StockKey, 0, len(inventories))
+		for _, inv := range inventories {
+			keys = append(keys, valueobject.StockKey{ProductID: inv.ProductID, SkuID: inv.SkuID, WarehouseID: inv.WarehouseID})
+		}
+		ledger, err := s.repo.SumLedgerStocks(ctx, keys)
+		if err != nil {
+			return report, ErrOperationFailed
+		}
+
+		for i, inv := range inventories {
+			key := keys[i]
+			report.Checked++
+			if inv.Stock == ledger[key] && inv.LockStock == openLocks[key] {
+				continue
+			}
+
+			drift, err := s.repo.ReconcileLedger(ctx, key, repair, operator)
+			if err != nil {
+				if errors.Is(err, repository.ErrRecordNotFound) {
+					continue
+				}
+				return report, ErrOperationFailed
+			}
+			if drift == nil {
+				continue
+			}
+
+			s.logger.Warn("Inventory ledger drift",
+				zap.Int64("product_id", drift.ProductID),
+				zap.Int64("sku_id", drift.SkuID),
+				zap.Int("warehouse_id", drift.WarehouseID),
+				zap.Int("stock", drift.Stock),
+				zap.Int("ledger_stock", drift.LedgerStock),
+				zap.Int("lock_stock", drift.LockStock),
+				zap.Int("open_lock_stock", drift.OpenLockStock),
+				zap.Bool("repaired", drift.Repaired))
+			report.Drifts = append(report.Drifts, drift)
+		}
+
+		if len(inventories) < batchSize {
+			break
+		}
+		afterID = inventories[len(inventories)-1].ID
+	}
+
+	return report, nil
+}
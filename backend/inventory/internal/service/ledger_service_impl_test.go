@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeLedgerRepo 内存中的库存记录和流水，rechecked中的记录在锁定后重新核对时已无差异
+type fakeLedgerRepo struct {
+	repository.InventoryRepository
+	inventories []*entity.Inventory
+	ledger      map[valueobject.StockKey]int
+	openLocks   map[valueobject.StockKey]int
+	rechecked   map[valueobject.StockKey]bool
+	reconciled  []valueobject.StockKey
+}
+
+func (r *fakeLedgerRepo) ListInventories(ctx context.Context, afterID int64, limit int) ([]*entity.Inventory, error) {
+	var inventories []*entity.Inventory
+	for _, inv := range r.inventories {
+		if inv.ID > afterID && len(inventories) < limit {
+			inventories = append(inventories, inv)
+		}
+	}
+	return inventories, nil
+}
+
+func (r *fakeLedgerRepo) SumLedgerStocks(ctx context.Context, keys []valueobject.StockKey) (map[valueobject.StockKey]int, error) {
+	return r.ledger, nil
+}
+
+func (r *fakeLedgerRepo) SumOpenLocks(ctx context.Context) (map[valueobject.StockKey]int, error) {
+	return r.openLocks, nil
+}
+
+func (r *fakeLedgerRepo) ReconcileLedger(ctx context.Context, key valueobject.StockKey, repair bool, operator string) (*valueobject.LedgerDrift, error) {
+	r.reconciled = append(r.reconciled, key)
+	if r.rechecked[key] {
+		return nil, nil
+	}
+	for _, inv := range r.inventories {
+		if inv.ProductID == key.ProductID && inv.SkuID == key.SkuID && inv.WarehouseID == key.WarehouseID {
+			return &valueobject.LedgerDrift{
+				ProductID:     key.ProductID,
+				SkuID:         key.SkuID,
+				WarehouseID:   key.WarehouseID,
+				Stock:         inv.Stock,
+				LedgerStock:   r.ledger[key],
+				LockStock:     inv.LockStock,
+				OpenLockStock: r.openLocks[key],
+				Repaired:      repair,
+			}, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func TestReconcileRechecksOnlySuspectedDrift(t *testing.T) {
+	key := func(productID int64) valueobject.StockKey {
+		return valueobject.StockKey{ProductID: productID, WarehouseID: 1}
+	}
+	repo := &fakeLedgerRepo{
+		inventories: []*entity.Inventory{
+			{ID: 1, ProductID: 100, WarehouseID: 1, Stock: 10, LockStock: 2},
+			{ID: 2, ProductID: 200, WarehouseID: 1, Stock: 12},
+			{ID: 3, ProductID: 300, WarehouseID: 1, Stock: 5, LockStock: 3},
+			{ID: 4, ProductID: 400, WarehouseID: 1, Stock: 8, LockStock: 1},
+		},
+		// 商品200的库存多于流水，商品300的锁定数量多于实际锁定，
+		// 商品400的快照差异是核对期间的正常锁定造成的
+		ledger:    map[valueobject.StockKey]int{key(100): 10, key(200): 10, key(300): 5, key(400): 8},
+		openLocks: map[valueobject.StockKey]int{key(100): 2, key(300): 1},
+		rechecked: map[valueobject.StockKey]bool{key(400): true},
+	}
+	svc := NewLedgerService(repo, zap.NewNop())
+
+	report, err := svc.Reconcile(context.Background(), true, "tester", 3)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if report.Checked != 4 {
+		t.Errorf("Checked = %d, want 4 across two batches", report.Checked)
+	}
+	if len(repo.reconciled) != 3 {
+		t.Errorf("reconciled = %v, want only the three suspected records", repo.reconciled)
+	}
+	if len(report.Drifts) != 2 {
+		t.Fatalf("got %d drifts, want 2", len(report.Drifts))
+	}
+	if d := report.Drifts[0]; d.ProductID != 200 || d.StockDrift() != 2 || d.LockDrift() != 0 || !d.Repaired {
+		t.Errorf("drift = %+v, want product 200 with stock drift 2", d)
+	}
+	if d := report.Drifts[1]; d.ProductID != 300 || d.StockDrift() != 0 || d.LockDrift() != 2 {
+		t.Errorf("drift = %+v, want product 300 with lock drift 2", d)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// ErrLotNotExpired 批次尚未过期，不能报废
+var ErrLotNotExpired = errors.New("lot not expired")
+
+// LotServiceImpl 库存批次服务实现
+type LotServiceImpl struct {
+	repo   repository.InventoryRepository
+	logger *zap.Logger
+}
+
+// NewLotService 创建库存批次服务实例
+func NewLotService(repo repository.InventoryRepository, logger *zap.Logger) LotService {
+	return &LotServiceImpl{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListExpiringLots 查询within时长内到期且仍有库存的批次，includeExpired为true时包含已过期的批次
+func (s *LotServiceImpl) ListExpiringLots(ctx context.Context, warehouseID int, within time.Duration, includeExpired bool, page, pageSize int) ([]*entity.InventoryLot, int64, error) {
+	if warehouseID < 0 || within < 0 {
+		return nil, 0, ErrInvalidArgument
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	lots, total, err := s.repo.ListExpiringLots(ctx, warehouseID, time.Now().Add(within), includeExpired, page, pageSize)
+	if err != nil {
+		s.logger.Error("Failed to list expiring lots",
+			zap.Int("warehouse_id", warehouseID),
+			zap.Duration("within", within),
+			zap.Error(err))
+		return nil, 0, ErrOperationFailed
+	}
+
+	return lots, total, nil
+}
+
+// ExpireLots 标记已到期的批次，过期批次中未锁定的数量从可用库存中扣除
+func (s *LotServiceImpl) ExpireLots(ctx context.Context, now time.Time, limit int) (int, error) {
+	lots, err := s.repo.ExpireLots(ctx, now, limit)
+	for _, lot := range lots {
+		s.logger.Info("Inventory lot expired",
+			zap.Int64("product_id", lot.ProductID),
+			zap.Int64("sku_id", lot.SkuID),
+			zap.Int("warehouse_id", lot.WarehouseID),
+			zap.String("lot_no", lot.LotNo),
+			zap.Int("unlocked", lot.Stock-lot.LockStock))
+	}
+	return len(lots), err
+}
+
+// WriteOffExpiredLot 报废已过期的批次，批次中未锁定的数量从库存中核销，已锁定的数量仍由订单处理
+func (s *LotServiceImpl) WriteOffExpiredLot(ctx context.Context, productID int64, skuID int64, warehouseID int, lotNo string, operator string, remark string) (*entity.InventoryLot, int, error) {
+	if productID <= 0 || skuID < 0 || warehouseID <= 0 || lotNo == "" {
+		return nil, 0, ErrInvalidArgument
+	}
+	if remark == "" {
+		remark = "Expired lot written off"
+	}
+
+	lot, quantity, err := s.repo.WriteOffExpiredLot(ctx, productID, skuID, warehouseID, lotNo, operator, remark)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return nil, 0, ErrStockNotFound
+	case errors.Is(err, repository.ErrLotNotExpired):
+		return nil, 0, fmt.Errorf("%w: %s", ErrLotNotExpired, lotNo)
+	default:
+		s.logger.Error("Failed to write off expired lot",
+			zap.Int64("product_id", productID),
+			zap.Int64("sku_id", skuID),
+			zap.Int("warehouse_id", warehouseID),
+			zap.String("lot_no", lotNo),
+			zap.Error(err))
+		return nil, 0, ErrOperationFailed
+	}
+
+	s.logger.Info("Expired lot written off",
+		zap.Int64("product_id", productID),
+		zap.Int64("sku_id", skuID),
+		zap.Int("warehouse_id", warehouseID),
+		zap.String("lot_no", lotNo),
+		zap.Int("quantity", quantity),
+		zap.String("operator", operator))
+	return lot, quantity, nil
+}
@@ -0,0 +1,508 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 库存分配策略名称
+const (
+	AllocationDefault   = "default"    // 默认仓库
+	AllocationNearest   = "nearest"    // 距收货地址最近的仓库
+	AllocationMostStock = "most_stock" // 可用库存最多的仓库
+	AllocationSplit     = "split"      // 按可用库存拆分到多个仓库
+)
+
+// Allocation 库存分配结果，表示从某个仓库锁定的商品SKU数量。
+// 套装按组件分配，BundleID为所属套装的商品ID，BundleUnit为每套包含的组件数量
+type Allocation struct {
+	ProductID   int64
+	SkuID       int64
+	WarehouseID int
+	Quantity    int
+	BundleID    int64
+	BundleUnit  int
+}
+
+// WarehouseStock 候选仓库及其可用库存，Backorderable为还可以排队预订的数量
+type WarehouseStock struct {
+	Warehouse     *entity.Warehouse
+	Available     int
+	Backorderable int
+}
+
+// AllocationStrategy 库存分配策略接口
+type AllocationStrategy interface {
+	// Allocate 为单个商品SKU选择仓库，candidates为存有该SKU的可用仓库；无法满足时返回失败项
+	Allocate(item LockItem, candidates []*WarehouseStock, address DeliveryAddress) ([]*Allocation, *LockFailItem)
+}
+
+// StockAllocator 库存分配器，根据策略决定锁定哪些仓库的库存
+type StockAllocator struct {
+	inventoryRepo      repository.InventoryRepository
+	warehouseRepo      repository.WarehouseRepository
+	defaultWarehouseID int
+	defaultStrategy    string
+	strategies         map[string]AllocationStrategy
+	logger             *zap.Logger
+}
+
+// NewStockAllocator 创建库存分配器
+func NewStockAllocator(
+	inventoryRepo repository.InventoryRepository,
+	warehouseRepo repository.WarehouseRepository,
+	defaultWarehouseID int,
+	defaultStrategy string,
+	logger *zap.Logger,
+) *StockAllocator {
+	if defaultWarehouseID <= 0 {
+		defaultWarehouseID = 1
+	}
+
+	a := &StockAllocator{
+		inventoryRepo:      inventoryRepo,
+		warehouseRepo:      warehouseRepo,
+		defaultWarehouseID: defaultWarehouseID,
+		strategies: map[string]AllocationStrategy{
+			AllocationDefault:   &defaultWarehouseStrategy{warehouseID: defaultWarehouseID},
+			AllocationNearest:   &nearestWarehouseStrategy{},
+			AllocationMostStock: &mostStockStrategy{},
+			AllocationSplit:     &splitStrategy{},
+		},
+		logger: logger,
+	}
+
+	if _, ok := a.strategies[defaultStrategy]; !ok {
+		defaultStrategy = AllocationDefault
+	}
+	a.defaultStrategy = defaultStrategy
+
+	return a
+}
+
+// RegisterStrategy 注册自定义分配策略
+func (a *StockAllocator) RegisterStrategy(name string, strategy AllocationStrategy) {
+	a.strategies[name] = strategy
+}
+
+// Allocate 为锁定项分配仓库。指定了仓库的项目直接使用该仓库，其余项目按策略分配；
+// channel不为空时候选仓库的可用库存包含分配给该渠道的数量；allowBackorder为true时，策略无法满足的项目
+// 分配到可用库存加可预订数量足够的仓库，不足的部分在锁定时排队预订。
+// 套装按各组件能组成的套数选择仓库，分配结果展开为同一仓库的全部组件，套装不排队预订
+func (a *StockAllocator) Allocate(ctx context.Context, items []LockItem, strategyName string, address DeliveryAddress, channel string, allowBackorder bool) ([]*Allocation, []*LockFailItem, error) {
+	if _, ok := a.strategies[strategyName]; !ok {
+		strategyName = a.defaultStrategy
+	}
+	strategy := a.strategies[strategyName]
+
+	bundles, err := a.loadBundles(ctx, items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 默认仓库策略以及明确指定仓库的项目不需要查询候选仓库
+	allocations := make([]*Allocation, 0, len(items))
+	pending := make([]LockItem, 0, len(items))
+	for _, item := range items {
+		if item.WarehouseID > 0 {
+			allocations = append(allocations, &Allocation{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: item.WarehouseID,
+				Quantity:    item.Quantity,
+			})
+			continue
+		}
+		if strategyName == AllocationDefault {
+			allocations = append(allocations, &Allocation{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: a.defaultWarehouseID,
+				Quantity:    item.Quantity,
+			})
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	if len(pending) == 0 {
+		return expandBundles(allocations, bundles), nil, nil
+	}
+
+	candidates, err := a.loadCandidates(ctx, pending, channel, bundles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var failItems []*LockFailItem
+	for _, item := range pending {
+		itemAllocations, failItem := strategy.Allocate(item, candidates[item.skuKey()], address)
+		if failItem != nil && allowBackorder {
+			itemAllocations, failItem = allocateBackorder(item, candidates[item.skuKey()], failItem)
+		}
+		if failItem != nil {
+			failItems = append(failItems, failItem)
+			continue
+		}
+
+		// 扣减候选库存，避免同一请求中重复商品被超额分配，超出可用库存的部分扣减可预订数量
+		for _, allocation := range itemAllocations {
+			for _, candidate := range candidates[item.skuKey()] {
+				if candidate.Warehouse.ID == allocation.WarehouseID {
+					candidate.Available -= allocation.Quantity
+					if candidate.Available < 0 {
+						candidate.Backorderable += candidate.Available
+						candidate.Available = 0
+					}
+				}
+			}
+		}
+		allocations = append(allocations, itemAllocations...)
+	}
+
+	return expandBundles(allocations, bundles), failItems, nil
+}
+
+// loadBundles 加载锁定项中的套装定义，套装只有商品级，SKU不为0的项目不查询
+func (a *StockAllocator) loadBundles(ctx context.Context, items []LockItem) (map[int64]*entity.InventoryBundle, error) {
+	productIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		if item.SkuID == 0 {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+
+	bundles, err := a.inventoryRepo.GetBundles(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	bundleByID := make(map[int64]*entity.InventoryBundle, len(bundles))
+	for _, bundle := range bundles {
+		bundleByID[bundle.ProductID] = bundle
+	}
+	return bundleByID, nil
+}
+
+// expandBundles 将套装的分配展开为同一仓库中各组件的分配，同一套装的组件相邻，组件数量为套数乘以每套数量
+func expandBundles(allocations []*Allocation, bundles map[int64]*entity.InventoryBundle) []*Allocation {
+	if len(bundles) == 0 {
+		return allocations
+	}
+
+	expanded := make([]*Allocation, 0, len(allocations))
+	for _, allocation := range allocations {
+		bundle, ok := bundles[allocation.ProductID]
+		if !ok || allocation.SkuID != 0 {
+			expanded = append(expanded, allocation)
+			continue
+		}
+		for _, component := range bundle.Components {
+			expanded = append(expanded, &Allocation{
+				ProductID:   component.ProductID,
+				SkuID:       component.SkuID,
+				WarehouseID: allocation.WarehouseID,
+				Quantity:    allocation.Quantity * component.Quantity,
+				BundleID:    bundle.ProductID,
+				BundleUnit:  component.Quantity,
+			})
+		}
+	}
+	return expanded
+}
+
+// loadCandidates 加载商品SKU在各启用仓库中对该渠道的可用库存，套装的可用库存为组件能组成的套数
+func (a *StockAllocator) loadCandidates(ctx context.Context, items []LockItem, channel string, bundles map[int64]*entity.InventoryBundle) (map[valueobject.SkuKey][]*WarehouseStock, error) {
+	warehouses, err := a.warehouseRepo.ListActiveWarehouses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	warehouseIDs := make([]int, 0, len(warehouses))
+	warehouseByID := make(map[int]*entity.Warehouse, len(warehouses))
+	for _, warehouse := range warehouses {
+		warehouseIDs = append(warehouseIDs, warehouse.ID)
+		warehouseByID[warehouse.ID] = warehouse
+	}
+
+	productIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		if bundle, ok := bundles[item.ProductID]; ok && item.SkuID == 0 {
+			for _, component := range bundle.Components {
+				productIDs = append(productIDs, component.ProductID)
+			}
+			continue
+		}
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	inventories, err := a.inventoryRepo.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := make(map[valueobject.StockKey]*entity.InventoryChannelAllocation)
+	if channel != "" {
+		channelAllocations, err := a.inventoryRepo.ListChannelAllocations(ctx, productIDs, warehouseIDs, channel)
+		if err != nil {
+			return nil, err
+		}
+		for _, allocation := range channelAllocations {
+			allocations[valueobject.StockKey{
+				ProductID:   allocation.ProductID,
+				SkuID:       allocation.SkuID,
+				WarehouseID: allocation.WarehouseID,
+			}] = allocation
+		}
+	}
+
+	candidates := make(map[valueobject.SkuKey][]*WarehouseStock, len(items))
+	for _, inventory := range inventories {
+		key := valueobject.SkuKey{ProductID: inventory.ProductID, SkuID: inventory.SkuID}
+		allocation := allocations[valueobject.StockKey{
+			ProductID:   inventory.ProductID,
+			SkuID:       inventory.SkuID,
+			WarehouseID: inventory.WarehouseID,
+		}]
+		candidates[key] = append(candidates[key], &WarehouseStock{
+			Warehouse:     warehouseByID[inventory.WarehouseID],
+			Available:     inventory.ChannelAvailableStock(allocation),
+			Backorderable: inventory.BackorderAvailable(),
+		})
+	}
+
+	for _, item := range items {
+		if bundle, ok := bundles[item.ProductID]; ok && item.SkuID == 0 {
+			candidates[item.skuKey()] = bundleCandidates(bundle, candidates)
+		}
+	}
+
+	return candidates, nil
+}
+
+// bundleCandidates 根据组件的候选仓库计算套装的候选仓库，可用套数为各组件可用库存能组成套数的最小值，
+// 缺少任一组件的仓库不作为候选
+func bundleCandidates(bundle *entity.InventoryBundle, candidates map[valueobject.SkuKey][]*WarehouseStock) []*WarehouseStock {
+	var warehouses []*entity.Warehouse
+	units := make(map[int]int)
+	for i, component := range bundle.Components {
+		componentUnits := make(map[int]int)
+		for _, candidate := range candidates[valueobject.SkuKey{ProductID: component.ProductID, SkuID: component.SkuID}] {
+			componentUnits[candidate.Warehouse.ID] = max(candidate.Available, 0) / component.Quantity
+			if i == 0 {
+				warehouses = append(warehouses, candidate.Warehouse)
+			}
+		}
+		if i == 0 {
+			units = componentUnits
+			continue
+		}
+		for warehouseID, u := range units {
+			componentUnit, ok := componentUnits[warehouseID]
+			if !ok {
+				delete(units, warehouseID)
+				continue
+			}
+			units[warehouseID] = min(u, componentUnit)
+		}
+	}
+
+	stocks := make([]*WarehouseStock, 0, len(units))
+	for _, warehouse := range warehouses {
+		if u, ok := units[warehouse.ID]; ok {
+			stocks = append(stocks, &WarehouseStock{
+				Warehouse: warehouse,
+				Available: u,
+			})
+		}
+	}
+	return stocks
+}
+
+// defaultWarehouseStrategy 始终从默认仓库锁定
+type defaultWarehouseStrategy struct {
+	warehouseID int
+}
+
+// Allocate 分配到默认仓库，库存是否充足由锁定时判断
+func (s *defaultWarehouseStrategy) Allocate(item LockItem, candidates []*WarehouseStock, address DeliveryAddress) ([]*Allocation, *LockFailItem) {
+	return []*Allocation{{
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: s.warehouseID,
+		Quantity:    item.Quantity,
+	}}, nil
+}
+
+// nearestWarehouseStrategy 选择能整单满足且距收货地址最近的仓库
+type nearestWarehouseStrategy struct{}
+
+// Allocate 优先选择位于或配送覆盖收货地区的仓库，同组内按仓库与收货地址的距离由近到远选择，
+// 未设置经纬度的仓库排在最后；收货地址没有经纬度时无法比较距离，按可用库存从多到少选择
+func (s *nearestWarehouseStrategy) Allocate(item LockItem, candidates []*WarehouseStock, address DeliveryAddress) ([]*Allocation, *LockFailItem) {
+	sorted := append([]*WarehouseStock(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		si := sorted[i].Warehouse.Serves(address.RegionCode)
+		sj := sorted[j].Warehouse.Serves(address.RegionCode)
+		if si != sj {
+			return si
+		}
+		di := warehouseDistance(sorted[i].Warehouse, address)
+		dj := warehouseDistance(sorted[j].Warehouse, address)
+		if di != dj {
+			return di < dj
+		}
+		return sorted[i].Available > sorted[j].Available
+	})
+
+	return allocateSingleWarehouse(item, sorted)
+}
+
+// mostStockStrategy 选择可用库存最多的仓库
+type mostStockStrategy struct{}
+
+// Allocate 按可用库存从多到少选择仓库
+func (s *mostStockStrategy) Allocate(item LockItem, candidates []*WarehouseStock, address DeliveryAddress) ([]*Allocation, *LockFailItem) {
+	sorted := append([]*WarehouseStock(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Available > sorted[j].Available
+	})
+
+	return allocateSingleWarehouse(item, sorted)
+}
+
+// splitStrategy 单仓库存不足时拆分到多个仓库，优先使用库存多的仓库以减少拆单
+type splitStrategy struct{}
+
+// Allocate 按可用库存从多到少依次分配
+func (s *splitStrategy) Allocate(item LockItem, candidates []*WarehouseStock, address DeliveryAddress) ([]*Allocation, *LockFailItem) {
+	sorted := append([]*WarehouseStock(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Available > sorted[j].Available
+	})
+
+	allocations := make([]*Allocation, 0)
+	remaining := item.Quantity
+	totalAvailable := 0
+	for _, candidate := range sorted {
+		if candidate.Available <= 0 {
+			continue
+		}
+		totalAvailable += candidate.Available
+		if remaining == 0 {
+			continue
+		}
+
+		quantity := candidate.Available
+		if quantity > remaining {
+			quantity = remaining
+		}
+		allocations = append(allocations, &Allocation{
+			ProductID:   item.ProductID,
+			SkuID:       item.SkuID,
+			WarehouseID: candidate.Warehouse.ID,
+			Quantity:    quantity,
+		})
+		remaining -= quantity
+	}
+
+	if remaining > 0 {
+		return nil, &LockFailItem{
+			ProductID: item.ProductID,
+			SkuID:     item.SkuID,
+			Quantity:  item.Quantity,
+			Available: totalAvailable,
+			Code:      valueobject.LockFailInsufficientStock,
+			Reason:    "Insufficient stock across warehouses",
+		}
+	}
+
+	return allocations, nil
+}
+
+// allocateSingleWarehouse 按顺序选择第一个能整单满足的仓库
+func allocateSingleWarehouse(item LockItem, sorted []*WarehouseStock) ([]*Allocation, *LockFailItem) {
+	maxAvailable := 0
+	for _, candidate := range sorted {
+		if candidate.Available >= item.Quantity {
+			return []*Allocation{{
+				ProductID:   item.ProductID,
+				SkuID:       item.SkuID,
+				WarehouseID: candidate.Warehouse.ID,
+				Quantity:    item.Quantity,
+			}}, nil
+		}
+		if candidate.Available > maxAvailable {
+			maxAvailable = candidate.Available
+		}
+	}
+
+	return nil, &LockFailItem{
+		ProductID: item.ProductID,
+		SkuID:     item.SkuID,
+		Quantity:  item.Quantity,
+		Available: maxAvailable,
+		Code:      valueobject.LockFailInsufficientStock,
+		Reason:    "Insufficient stock in any single warehouse",
+	}
+}
+
+// allocateBackorder 可用库存不足时选择可用库存加可预订数量足够的仓库，优先使用可用库存多的仓库以减少预订数量。
+// 没有仓库能满足时返回带有最大可预订数量的失败项
+func allocateBackorder(item LockItem, candidates []*WarehouseStock, failItem *LockFailItem) ([]*Allocation, *LockFailItem) {
+	var best *WarehouseStock
+	maxBackorderable := 0
+	for _, candidate := range candidates {
+		maxBackorderable = max(maxBackorderable, candidate.Backorderable)
+		if candidate.Backorderable <= 0 || candidate.Available+candidate.Backorderable < item.Quantity {
+			continue
+		}
+		if best == nil || candidate.Available > best.Available {
+			best = candidate
+		}
+	}
+
+	if best == nil {
+		failItem.Backorderable = maxBackorderable
+		if maxBackorderable > 0 {
+			failItem.Code = valueobject.LockFailBackorderLimit
+		}
+		return nil, failItem
+	}
+	return []*Allocation{{
+		ProductID:   item.ProductID,
+		SkuID:       item.SkuID,
+		WarehouseID: best.Warehouse.ID,
+		Quantity:    item.Quantity,
+	}}, nil
+}
+
+// 地球平均半径（千米）
+const earthRadiusKm = 6371.0
+
+// warehouseDistance 计算仓库到收货地址的球面距离（千米），任一方没有经纬度时返回+Inf
+func warehouseDistance(warehouse *entity.Warehouse, address DeliveryAddress) float64 {
+	if !warehouse.HasLocation() || !address.HasLocation() {
+		return math.Inf(1)
+	}
+	return haversineKm(warehouse.Latitude, warehouse.Longitude, address.Latitude, address.Longitude)
+}
+
+// haversineKm 按半正矢公式计算两个经纬度之间的球面距离（千米）
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeAllocatorInventoryRepo 返回固定库存记录的库存仓储
+type fakeAllocatorInventoryRepo struct {
+	repository.InventoryRepository
+	inventories []*entity.Inventory
+	allocations []*entity.InventoryChannelAllocation
+	bundles     []*entity.InventoryBundle
+}
+
+func (r *fakeAllocatorInventoryRepo) GetInventoriesByProducts(ctx context.Context, productIDs []int64, warehouseIDs []int) ([]*entity.Inventory, error) {
+	return r.inventories, nil
+}
+
+func (r *fakeAllocatorInventoryRepo) GetBundles(ctx context.Context, productIDs []int64) ([]*entity.InventoryBundle, error) {
+	return r.bundles, nil
+}
+
+func (r *fakeAllocatorInventoryRepo) ListChannelAllocations(ctx context.Context, productIDs []int64, warehouseIDs []int, channel string) ([]*entity.InventoryChannelAllocation, error) {
+	var allocations []*entity.InventoryChannelAllocation
+	for _, allocation := range r.allocations {
+		if allocation.Channel == channel {
+			allocations = append(allocations, allocation)
+		}
+	}
+	return allocations, nil
+}
+
+// fakeAllocatorWarehouseRepo 返回固定仓库列表的仓库仓储
+type fakeAllocatorWarehouseRepo struct {
+	repository.WarehouseRepository
+	warehouses []*entity.Warehouse
+}
+
+func (r *fakeAllocatorWarehouseRepo) ListActiveWarehouses(ctx context.Context) ([]*entity.Warehouse, error) {
+	return r.warehouses, nil
+}
+
+// 上海、北京、广州三个仓库，广州仓未设置经纬度
+var allocatorTestWarehouses = []*entity.Warehouse{
+	{ID: 1, Name: "上海仓", Status: 1, Latitude: 31.2304, Longitude: 121.4737},
+	{ID: 2, Name: "北京仓", Status: 1, Latitude: 39.9042, Longitude: 116.4074},
+	{ID: 3, Name: "广州仓", Status: 1},
+}
+
+// 杭州收货地址
+var hangzhou = DeliveryAddress{Detail: "浙江省杭州市西湖区", Latitude: 30.2741, Longitude: 120.1551}
+
+func newTestAllocator(stocks map[int]int) *StockAllocator {
+	inventories := make([]*entity.Inventory, 0, len(stocks))
+	for warehouseID, stock := range stocks {
+		inventories = append(inventories, &entity.Inventory{ProductID: 100, WarehouseID: warehouseID, Stock: stock})
+	}
+	return NewStockAllocator(
+		&fakeAllocatorInventoryRepo{inventories: inventories},
+		&fakeAllocatorWarehouseRepo{warehouses: allocatorTestWarehouses},
+		1,
+		AllocationDefault,
+		zap.NewNop(),
+	)
+}
+
+func TestNearestStrategyPicksClosestWarehouseWithStock(t *testing.T) {
+	tests := []struct {
+		name    string
+		stocks  map[int]int
+		address DeliveryAddress
+		want    int
+	}{
+		{"closest has stock", map[int]int{1: 5, 2: 50, 3: 50}, hangzhou, 1},
+		{"closest short of stock", map[int]int{1: 2, 2: 5, 3: 50}, hangzhou, 2},
+		{"only unlocated warehouse has stock", map[int]int{1: 2, 2: 2, 3: 5}, hangzhou, 3},
+		// 收货地址没有经纬度时按可用库存选择
+		{"address without location", map[int]int{1: 5, 2: 8, 3: 6}, DeliveryAddress{Detail: "浙江省杭州市"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocator := newTestAllocator(tt.stocks)
+			allocations, failItems, err := allocator.Allocate(context.Background(),
+				[]LockItem{{ProductID: 100, Quantity: 3}}, AllocationNearest, tt.address, "", false)
+			if err != nil || len(failItems) != 0 {
+				t.Fatalf("Allocate() failItems = %v, err = %v", failItems, err)
+			}
+			if len(allocations) != 1 || allocations[0].WarehouseID != tt.want || allocations[0].Quantity != 3 {
+				t.Errorf("allocations = %+v, want 3 from warehouse %d", allocations[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestNearestStrategyPrefersWarehouseServingRegion(t *testing.T) {
+	// 广州仓配送覆盖杭州，虽然没有经纬度也优先于距离更近的上海仓
+	warehouses := []*entity.Warehouse{
+		{ID: 1, Name: "上海仓", Status: 1, RegionCode: "310100", Latitude: 31.2304, Longitude: 121.4737},
+		{ID: 3, Name: "广州仓", Status: 1, RegionCode: "440100", ServedRegions: "330100,350100"},
+	}
+	allocator := NewStockAllocator(
+		&fakeAllocatorInventoryRepo{inventories: []*entity.Inventory{
+			{ProductID: 100, WarehouseID: 1, Stock: 10},
+			{ProductID: 100, WarehouseID: 3, Stock: 4},
+		}},
+		&fakeAllocatorWarehouseRepo{warehouses: warehouses},
+		1,
+		AllocationDefault,
+		zap.NewNop(),
+	)
+	address := hangzhou
+	address.RegionCode = "330100"
+
+	allocations, _, err := allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 3}}, AllocationNearest, address, "", false)
+	if err != nil || len(allocations) != 1 || allocations[0].WarehouseID != 3 {
+		t.Errorf("allocations = %+v, err = %v, want warehouse 3", allocations, err)
+	}
+
+	// 覆盖地区的仓库库存不足时按距离选择其他仓库
+	allocations, _, err = allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 5}}, AllocationNearest, address, "", false)
+	if err != nil || len(allocations) != 1 || allocations[0].WarehouseID != 1 {
+		t.Errorf("allocations = %+v, err = %v, want warehouse 1", allocations, err)
+	}
+}
+
+func TestSplitStrategyAcrossWarehouses(t *testing.T) {
+	allocator := newTestAllocator(map[int]int{1: 4, 2: 3, 3: 1})
+
+	allocations, failItems, err := allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 6}}, AllocationSplit, hangzhou, "", false)
+	if err != nil || len(failItems) != 0 {
+		t.Fatalf("Allocate() failItems = %v, err = %v", failItems, err)
+	}
+	if len(allocations) != 2 ||
+		allocations[0].WarehouseID != 1 || allocations[0].Quantity != 4 ||
+		allocations[1].WarehouseID != 2 || allocations[1].Quantity != 2 {
+		t.Errorf("allocations = %+v %+v, want 4 from warehouse 1 and 2 from warehouse 2", allocations[0], allocations[1])
+	}
+
+	// 同一请求中重复的商品不能超额分配
+	_, failItems, err = allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 6}, {ProductID: 100, Quantity: 3}}, AllocationSplit, hangzhou, "", false)
+	if err != nil || len(failItems) != 1 || failItems[0].Available != 2 {
+		t.Errorf("failItems = %+v, err = %v, want one item with 2 available", failItems, err)
+	}
+}
+
+func TestChannelAllocationCountsOnlyForItsChannel(t *testing.T) {
+	// 上海仓10件中6件分配给App渠道且已锁定1件，北京仓8件全部共享
+	allocator := NewStockAllocator(
+		&fakeAllocatorInventoryRepo{
+			inventories: []*entity.Inventory{
+				{ProductID: 100, WarehouseID: 1, Stock: 10, LockStock: 1, ReservedStock: 5},
+				{ProductID: 100, WarehouseID: 2, Stock: 8},
+			},
+			allocations: []*entity.InventoryChannelAllocation{
+				{ProductID: 100, WarehouseID: 1, Channel: entity.ChannelApp, Allocated: 6, LockStock: 1},
+			},
+		},
+		&fakeAllocatorWarehouseRepo{warehouses: allocatorTestWarehouses},
+		1,
+		AllocationDefault,
+		zap.NewNop(),
+	)
+	items := []LockItem{{ProductID: 100, Quantity: 7}}
+
+	allocations, _, err := allocator.Allocate(context.Background(), items, AllocationNearest, hangzhou, entity.ChannelApp, false)
+	if err != nil || len(allocations) != 1 || allocations[0].WarehouseID != 1 {
+		t.Errorf("allocations = %+v, err = %v, want warehouse 1 for the app channel", allocations, err)
+	}
+
+	// 其他渠道只能使用上海仓的4件共享库存
+	allocations, _, err = allocator.Allocate(context.Background(), items, AllocationNearest, hangzhou, entity.ChannelWeb, false)
+	if err != nil || len(allocations) != 1 || allocations[0].WarehouseID != 2 {
+		t.Errorf("allocations = %+v, err = %v, want warehouse 2 for the web channel", allocations, err)
+	}
+}
+
+func TestBackorderAllocatesToWarehouseWithQueueRoom(t *testing.T) {
+	// 上海仓有2件、不开启预售，北京仓有1件、还可以预订5件
+	allocator := NewStockAllocator(
+		&fakeAllocatorInventoryRepo{inventories: []*entity.Inventory{
+			{ProductID: 100, WarehouseID: 1, Stock: 2},
+			{ProductID: 100, WarehouseID: 2, Stock: 1, BackorderLimit: 5},
+		}},
+		&fakeAllocatorWarehouseRepo{warehouses: allocatorTestWarehouses},
+		1,
+		AllocationDefault,
+		zap.NewNop(),
+	)
+	items := []LockItem{{ProductID: 100, Quantity: 4}}
+
+	_, failItems, err := allocator.Allocate(context.Background(), items, AllocationNearest, hangzhou, "", false)
+	if err != nil || len(failItems) != 1 {
+		t.Fatalf("failItems = %+v, err = %v, want one item without backorder", failItems, err)
+	}
+
+	allocations, failItems, err := allocator.Allocate(context.Background(), items, AllocationNearest, hangzhou, "", true)
+	if err != nil || len(failItems) != 0 {
+		t.Fatalf("Allocate() failItems = %+v, err = %v", failItems, err)
+	}
+	if len(allocations) != 1 || allocations[0].WarehouseID != 2 || allocations[0].Quantity != 4 {
+		t.Errorf("allocations = %+v, want all 4 from warehouse 2", allocations)
+	}
+
+	// 超出所有仓库可预订数量时返回最大可预订数量
+	_, failItems, err = allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 7}}, AllocationNearest, hangzhou, "", true)
+	if err != nil || len(failItems) != 1 || failItems[0].Backorderable != 5 {
+		t.Errorf("failItems = %+v, err = %v, want one item with 5 backorderable", failItems, err)
+	}
+}
+
+func TestBundleAllocatedToWarehouseWithAllComponents(t *testing.T) {
+	// 套装500每套2件商品100和1件商品200，上海仓只能组成1套，北京仓能组成3套
+	allocator := NewStockAllocator(
+		&fakeAllocatorInventoryRepo{
+			inventories: []*entity.Inventory{
+				{ProductID: 100, WarehouseID: 1, Stock: 10},
+				{ProductID: 200, WarehouseID: 1, Stock: 1},
+				{ProductID: 100, WarehouseID: 2, Stock: 6},
+				{ProductID: 200, WarehouseID: 2, Stock: 5},
+			},
+			bundles: []*entity.InventoryBundle{{ProductID: 500, Components: []*entity.BundleComponent{
+				{ProductID: 100, Quantity: 2},
+				{ProductID: 200, Quantity: 1},
+			}}},
+		},
+		&fakeAllocatorWarehouseRepo{warehouses: allocatorTestWarehouses},
+		1,
+		AllocationDefault,
+		zap.NewNop(),
+	)
+
+	allocations, failItems, err := allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 500, Quantity: 2}}, AllocationNearest, hangzhou, "", false)
+	if err != nil || len(failItems) != 0 {
+		t.Fatalf("Allocate() failItems = %+v, err = %v", failItems, err)
+	}
+	// 分配结果展开为北京仓的全部组件
+	if len(allocations) != 2 {
+		t.Fatalf("allocations = %+v, want two components", allocations)
+	}
+	for _, allocation := range allocations {
+		if allocation.WarehouseID != 2 || allocation.BundleID != 500 || allocation.Quantity != 2*allocation.BundleUnit {
+			t.Errorf("allocation = %+v, want 2 sets of bundle 500 from warehouse 2", allocation)
+		}
+	}
+}
+
+func TestExplicitWarehouseBypassesStrategy(t *testing.T) {
+	allocator := newTestAllocator(map[int]int{1: 10, 2: 10})
+
+	allocations, _, err := allocator.Allocate(context.Background(),
+		[]LockItem{{ProductID: 100, Quantity: 3, WarehouseID: 2}}, AllocationNearest, hangzhou, "", false)
+	if err != nil || len(allocations) != 1 || allocations[0].WarehouseID != 2 {
+		t.Errorf("allocations = %+v, err = %v, want warehouse 2", allocations, err)
+	}
+}
+
+func TestHaversineKm(t *testing.T) {
+	// 上海到北京约1068千米
+	got := haversineKm(31.2304, 121.4737, 39.9042, 116.4074)
+	if math.Abs(got-1068) > 5 {
+		t.Errorf("haversineKm(上海, 北京) = %.1f, want about 1068", got)
+	}
+	if got := haversineKm(31.2304, 121.4737, 31.2304, 121.4737); got != 0 {
+		t.Errorf("haversineKm(same point) = %f, want 0", got)
+	}
+}
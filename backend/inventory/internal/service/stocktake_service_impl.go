@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/alert"
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 定义错误
+var (
+	ErrStocktakeNotFound      = errors.New("stocktake session not found")
+	ErrInvalidStocktakeStatus = errors.New("invalid stocktake status")
+	ErrProductNotInStocktake  = errors.New("product not in stocktake scope")
+	ErrStocktakeConflict      = errors.New("stocktake variance conflicts with current stock")
+)
+
+// StocktakeServiceImpl 仓库盘点服务实现
+type StocktakeServiceImpl struct {
+	repo          repository.StocktakeRepository
+	inventoryRepo repository.InventoryRepository
+	warehouseRepo repository.WarehouseRepository
+	evaluator     *alert.Evaluator
+	logger        *zap.Logger
+}
+
+// NewStocktakeService 创建仓库盘点服务实例
+func NewStocktakeService(
+	repo repository.StocktakeRepository,
+	inventoryRepo repository.InventoryRepository,
+	warehouseRepo repository.WarehouseRepository,
+	evaluator *alert.Evaluator,
+	logger *zap.Logger,
+) StocktakeService {
+	return &StocktakeServiceImpl{
+		repo:          repo,
+		inventoryRepo: inventoryRepo,
+		warehouseRepo: warehouseRepo,
+		evaluator:     evaluator,
+		logger:        logger,
+	}
+}
+
+// OpenStocktake 创建盘点单，productIDs为空时盘点整个仓库
+func (s *StocktakeServiceImpl) OpenStocktake(ctx context.Context, session *entity.StocktakeSession, productIDs []int64) error {
+	if session == nil || session.WarehouseID <= 0 {
+		return ErrInvalidArgument
+	}
+	for _, productID := range productIDs {
+		if productID <= 0 {
+			return ErrInvalidArgument
+		}
+	}
+
+	warehouse, err := s.warehouseRepo.GetWarehouse(ctx, session.WarehouseID)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrWarehouseNotFound
+		}
+		return err
+	}
+	if !warehouse.IsActive() {
+		return ErrWarehouseInactive
+	}
+
+	if session.SessionSN == "" {
+		session.SessionSN = generateStocktakeSN()
+	}
+
+	if err := s.repo.CreateSession(ctx, session, productIDs); err != nil {
+		s.logger.Error("Failed to open stocktake",
+			zap.String("session_sn", session.SessionSN),
+			zap.Int("warehouse_id", session.WarehouseID),
+			zap.Error(err))
+		return ErrOperationFailed
+	}
+
+	return nil
+}
+
+// SubmitCounts 按商品SKU录入实盘数量，同一SKU重复录入时以最后一次为准
+func (s *StocktakeServiceImpl) SubmitCounts(ctx context.Context, sessionSN string, counts map[valueobject.SkuKey]int, counter string) error {
+	if sessionSN == "" || len(counts) == 0 {
+		return ErrInvalidArgument
+	}
+	for key, counted := range counts {
+		if key.ProductID <= 0 || key.SkuID < 0 || counted < 0 {
+			return ErrInvalidArgument
+		}
+	}
+
+	if err := s.repo.SubmitCounts(ctx, sessionSN, counts, counter); err != nil {
+		return s.translateError("submit counts for", sessionSN, err)
+	}
+
+	return nil
+}
+
+// PreviewStocktake 预览盘点差异及提交后的库存
+func (s *StocktakeServiceImpl) PreviewStocktake(ctx context.Context, sessionSN string) (*StocktakePreview, error) {
+	if sessionSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionSN)
+	if err != nil {
+		return nil, s.translateError("get", sessionSN, err)
+	}
+
+	return s.buildPreview(ctx, session)
+}
+
+// CommitStocktake 提交盘点单，所有差异在同一事务内生效
+func (s *StocktakeServiceImpl) CommitStocktake(ctx context.Context, sessionSN string, operator string) (*StocktakePreview, error) {
+	if sessionSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	session, err := s.repo.CommitSession(ctx, sessionSN, operator)
+	if err != nil {
+		return nil, s.translateError("commit", sessionSN, err)
+	}
+
+	s.logger.Info("Stocktake committed",
+		zap.String("session_sn", sessionSN),
+		zap.Int("warehouse_id", session.WarehouseID),
+		zap.String("operator", operator))
+
+	preview, err := s.buildPreview(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	s.evaluateAlerts(ctx, session)
+
+	return preview, nil
+}
+
+// CancelStocktake 取消盘点单
+func (s *StocktakeServiceImpl) CancelStocktake(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	if sessionSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	if err := s.repo.CancelSession(ctx, sessionSN, operator); err != nil {
+		return nil, s.translateError("cancel", sessionSN, err)
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionSN)
+	if err != nil {
+		return nil, s.translateError("get", sessionSN, err)
+	}
+	return session, nil
+}
+
+// buildPreview 结合当前库存计算盘点差异
+func (s *StocktakeServiceImpl) buildPreview(ctx context.Context, session *entity.StocktakeSession) (*StocktakePreview, error) {
+	productIDs := make([]int64, 0, len(session.Items))
+	for _, item := range session.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	current := make(map[valueobject.SkuKey]*entity.Inventory, len(productIDs))
+	if len(productIDs) > 0 {
+		inventories, err := s.inventoryRepo.GetInventoriesByProducts(ctx, productIDs, []int{session.WarehouseID})
+		if err != nil {
+			return nil, err
+		}
+		for _, inv := range inventories {
+			current[valueobject.SkuKey{ProductID: inv.ProductID, SkuID: inv.SkuID}] = inv
+		}
+	}
+
+	preview := &StocktakePreview{
+		Session: session,
+		Items:   make([]*StocktakeVariance, 0, len(session.Items)),
+	}
+	for _, item := range session.Items {
+		key := valueobject.SkuKey{ProductID: item.ProductID, SkuID: item.SkuID}
+		variance := &StocktakeVariance{
+			ProductID: item.ProductID,
+			SkuID:     item.SkuID,
+			Counted:   item.IsCounted(),
+			BookStock: item.BookStock,
+			Variance:  item.Variance(),
+		}
+		if inv := current[key]; inv != nil {
+			variance.CurrentStock = inv.Stock
+			variance.LockedStock = inv.LockStock
+		}
+		variance.ProjectedStock = variance.CurrentStock
+		if item.IsCounted() {
+			variance.CountedStock = *item.CountedStock
+		} else {
+			preview.Uncounted++
+		}
+
+		// 已提交的盘点单差异已计入当前库存
+		if session.IsOpen() {
+			variance.ProjectedStock += variance.Variance
+			variance.Conflict = variance.Variance < 0 && variance.ProjectedStock < variance.LockedStock
+		}
+
+		if variance.Variance > 0 {
+			preview.TotalGain += variance.Variance
+		} else {
+			preview.TotalLoss -= variance.Variance
+		}
+		preview.Items = append(preview.Items, variance)
+	}
+
+	return preview, nil
+}
+
+// evaluateAlerts 盘点提交后评估有差异商品的低库存预警
+func (s *StocktakeServiceImpl) evaluateAlerts(ctx context.Context, session *entity.StocktakeSession) {
+	if s.evaluator == nil {
+		return
+	}
+
+	productIDs := make([]int64, 0, len(session.Items))
+	changed := make(map[valueobject.SkuKey]bool, len(session.Items))
+	for _, item := range session.Items {
+		if item.Variance() != 0 {
+			productIDs = append(productIDs, item.ProductID)
+			changed[valueobject.SkuKey{ProductID: item.ProductID, SkuID: item.SkuID}] = true
+		}
+	}
+	if len(productIDs) == 0 {
+		return
+	}
+
+	inventories, err := s.inventoryRepo.GetInventoriesByProducts(ctx, productIDs, []int{session.WarehouseID})
+	if err != nil {
+		s.logger.Warn("Failed to load inventories for low stock alert",
+			zap.String("session_sn", session.SessionSN),
+			zap.Error(err))
+		return
+	}
+	for _, inv := range inventories {
+		if changed[valueobject.SkuKey{ProductID: inv.ProductID, SkuID: inv.SkuID}] {
+			s.evaluator.Evaluate(ctx, inv, string(entity.OperationAdjust))
+		}
+	}
+}
+
+// translateError 将仓储层错误转换为服务层错误
+func (s *StocktakeServiceImpl) translateError(action string, sessionSN string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return ErrStocktakeNotFound
+	case errors.Is(err, repository.ErrInvalidStocktakeStatus):
+		return ErrInvalidStocktakeStatus
+	case errors.Is(err, repository.ErrProductNotInStocktake):
+		return ErrProductNotInStocktake
+	case errors.Is(err, repository.ErrStocktakeConflict):
+		// 保留仓储层错误中冲突的商品和数量
+		return fmt.Errorf("%w%s", ErrStocktakeConflict, strings.TrimPrefix(err.Error(), repository.ErrStocktakeConflict.Error()))
+	}
+
+	s.logger.Error("Failed to "+action+" stocktake",
+		zap.String("session_sn", sessionSN),
+		zap.Error(err))
+	return ErrOperationFailed
+}
+
+// generateStocktakeSN 生成盘点单号
+func generateStocktakeSN() string {
+	return fmt.Sprintf("ST%s%04d", time.Now().Format("20060102150405"), rand.Intn(10000))
+}
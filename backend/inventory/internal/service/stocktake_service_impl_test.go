@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeStocktakeRepo 返回固定盘点单的仓储，操作返回预设的错误
+type fakeStocktakeRepo struct {
+	repository.StocktakeRepository
+	session *entity.StocktakeSession
+	err     error
+}
+
+func (r *fakeStocktakeRepo) GetSession(ctx context.Context, sessionSN string) (*entity.StocktakeSession, error) {
+	if r.session == nil {
+		return nil, repository.ErrRecordNotFound
+	}
+	return r.session, nil
+}
+
+func (r *fakeStocktakeRepo) CommitSession(ctx context.Context, sessionSN string, operator string) (*entity.StocktakeSession, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.session.Status = entity.StocktakeCommitted
+	return r.session, nil
+}
+
+func counted(n int) *int {
+	return &n
+}
+
+func newTestStocktakeService(repo *fakeStocktakeRepo, inventories []*entity.Inventory) StocktakeService {
+	return NewStocktakeService(
+		repo,
+		&fakeAllocatorInventoryRepo{inventories: inventories},
+		&fakeTransferWarehouseRepo{},
+		nil,
+		zap.NewNop(),
+	)
+}
+
+func TestPreviewStocktakeFlagsConflicts(t *testing.T) {
+	repo := &fakeStocktakeRepo{session: &entity.StocktakeSession{
+		SessionSN:   "ST1",
+		WarehouseID: 1,
+		Status:      entity.StocktakeOpen,
+		Items: []*entity.StocktakeItem{
+			{ProductID: 100, BookStock: 10, CountedStock: counted(12)},
+			{ProductID: 200, BookStock: 10, CountedStock: counted(4)},
+			{ProductID: 300, BookStock: 10},
+		},
+	}}
+	// 商品200锁定了5件，盘亏6件后库存低于锁定数量
+	inventories := []*entity.Inventory{
+		{ProductID: 100, WarehouseID: 1, Stock: 10},
+		{ProductID: 200, WarehouseID: 1, Stock: 10, LockStock: 5},
+		{ProductID: 300, WarehouseID: 1, Stock: 10},
+	}
+
+	preview, err := newTestStocktakeService(repo, inventories).PreviewStocktake(context.Background(), "ST1")
+	if err != nil {
+		t.Fatalf("PreviewStocktake() error = %v", err)
+	}
+	if preview.TotalGain != 2 || preview.TotalLoss != 6 || preview.Uncounted != 1 {
+		t.Errorf("gain/loss/uncounted = %d/%d/%d, want 2/6/1", preview.TotalGain, preview.TotalLoss, preview.Uncounted)
+	}
+
+	want := map[int64]struct {
+		projected int
+		conflict  bool
+	}{
+		100: {12, false},
+		200: {4, true},
+		300: {10, false},
+	}
+	for _, item := range preview.Items {
+		if w := want[item.ProductID]; item.ProjectedStock != w.projected || item.Conflict != w.conflict {
+			t.Errorf("product %d projected/conflict = %d/%v, want %d/%v",
+				item.ProductID, item.ProjectedStock, item.Conflict, w.projected, w.conflict)
+		}
+	}
+}
+
+func TestCommittedStocktakeDoesNotReapplyVariance(t *testing.T) {
+	repo := &fakeStocktakeRepo{session: &entity.StocktakeSession{
+		SessionSN:   "ST1",
+		WarehouseID: 1,
+		Status:      entity.StocktakeOpen,
+		Items:       []*entity.StocktakeItem{{ProductID: 100, BookStock: 10, CountedStock: counted(7)}},
+	}}
+	// 提交后当前库存已包含盘亏
+	inventories := []*entity.Inventory{{ProductID: 100, WarehouseID: 1, Stock: 7}}
+
+	preview, err := newTestStocktakeService(repo, inventories).CommitStocktake(context.Background(), "ST1", "tester")
+	if err != nil {
+		t.Fatalf("CommitStocktake() error = %v", err)
+	}
+	if item := preview.Items[0]; item.ProjectedStock != 7 || item.Conflict {
+		t.Errorf("projected/conflict = %d/%v, want 7/false", item.ProjectedStock, item.Conflict)
+	}
+}
+
+func TestStocktakeErrorTranslation(t *testing.T) {
+	conflict := fmt.Errorf("%w: goods 200 stock 10 locked 5 variance -6", repository.ErrStocktakeConflict)
+	tests := []struct {
+		repoErr error
+		want    error
+	}{
+		{repository.ErrRecordNotFound, ErrStocktakeNotFound},
+		{repository.ErrInvalidStocktakeStatus, ErrInvalidStocktakeStatus},
+		{conflict, ErrStocktakeConflict},
+		{errors.New("connection reset"), ErrOperationFailed},
+	}
+	for _, tt := range tests {
+		repo := &fakeStocktakeRepo{session: &entity.StocktakeSession{}, err: tt.repoErr}
+		_, err := newTestStocktakeService(repo, nil).CommitStocktake(context.Background(), "ST1", "tester")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("CommitStocktake() with %v = %v, want %v", tt.repoErr, err, tt.want)
+		}
+	}
+
+	// 冲突错误保留商品和数量
+	repo := &fakeStocktakeRepo{session: &entity.StocktakeSession{}, err: conflict}
+	_, err := newTestStocktakeService(repo, nil).CommitStocktake(context.Background(), "ST1", "tester")
+	if want := ErrStocktakeConflict.Error() + ": goods 200 stock 10 locked 5 variance -6"; err == nil || err.Error() != want {
+		t.Errorf("CommitStocktake() error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// 定义错误
+var (
+	ErrTransferNotFound      = errors.New("transfer not found")
+	ErrInvalidTransferStatus = errors.New("invalid transfer status")
+	ErrSameWarehouse         = errors.New("source and target warehouse are the same")
+	ErrWarehouseInactive     = errors.New("warehouse is inactive")
+)
+
+// TransferServiceImpl 仓库调拨服务实现
+type TransferServiceImpl struct {
+	repo          repository.TransferRepository
+	warehouseRepo repository.WarehouseRepository
+	logger        *zap.Logger
+}
+
+// NewTransferService 创建仓库调拨服务实例
+func NewTransferService(repo repository.TransferRepository, warehouseRepo repository.WarehouseRepository, logger *zap.Logger) TransferService {
+	return &TransferServiceImpl{
+		repo:          repo,
+		warehouseRepo: warehouseRepo,
+		logger:        logger,
+	}
+}
+
+// CreateTransfer 创建调拨单并预留源仓库存
+func (s *TransferServiceImpl) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	if order == nil || len(order.Items) == 0 || order.FromWarehouseID <= 0 || order.ToWarehouseID <= 0 {
+		return ErrInvalidArgument
+	}
+	if order.FromWarehouseID == order.ToWarehouseID {
+		return ErrSameWarehouse
+	}
+	for _, item := range order.Items {
+		if item.ProductID <= 0 || item.SkuID < 0 || item.Quantity <= 0 {
+			return ErrInvalidArgument
+		}
+	}
+
+	// 校验两端仓库均存在且可用
+	for _, warehouseID := range []int{order.FromWarehouseID, order.ToWarehouseID} {
+		warehouse, err := s.warehouseRepo.GetWarehouse(ctx, warehouseID)
+		if err != nil {
+			if errors.Is(err, repository.ErrRecordNotFound) {
+				return ErrWarehouseNotFound
+			}
+			return err
+		}
+		if !warehouse.IsActive() {
+			return ErrWarehouseInactive
+		}
+	}
+
+	if order.TransferSN == "" {
+		order.TransferSN = generateTransferSN()
+	}
+
+	if err := s.repo.CreateTransfer(ctx, order); err != nil {
+		if errors.Is(err, repository.ErrInsufficientStock) {
+			return ErrInsufficientStock
+		}
+		s.logger.Error("Failed to create transfer",
+			zap.String("transfer_sn", order.TransferSN),
+			zap.Int("from_warehouse_id", order.FromWarehouseID),
+			zap.Int("to_warehouse_id", order.ToWarehouseID),
+			zap.Error(err))
+		return ErrOperationFailed
+	}
+
+	return nil
+}
+
+// ShipTransfer 调拨发货
+func (s *TransferServiceImpl) ShipTransfer(ctx context.Context, transferSN string, operator string) (*entity.TransferOrder, error) {
+	if transferSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	if err := s.repo.ShipTransfer(ctx, transferSN, operator); err != nil {
+		return nil, s.translateError("ship", transferSN, err)
+	}
+
+	return s.GetTransfer(ctx, transferSN)
+}
+
+// ReceiveTransfer 调拨收货
+func (s *TransferServiceImpl) ReceiveTransfer(ctx context.Context, transferSN string, operator string) (*entity.TransferOrder, error) {
+	if transferSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	if err := s.repo.ReceiveTransfer(ctx, transferSN, operator); err != nil {
+		return nil, s.translateError("receive", transferSN, err)
+	}
+
+	return s.GetTransfer(ctx, transferSN)
+}
+
+// CancelTransfer 取消调拨
+func (s *TransferServiceImpl) CancelTransfer(ctx context.Context, transferSN string, operator string, reason string) (*entity.TransferOrder, error) {
+	if transferSN == "" {
+		return nil, ErrInvalidArgument
+	}
+	if reason == "" {
+		reason = "Transfer cancelled"
+	}
+
+	if err := s.repo.CancelTransfer(ctx, transferSN, operator, reason); err != nil {
+		return nil, s.translateError("cancel", transferSN, err)
+	}
+
+	return s.GetTransfer(ctx, transferSN)
+}
+
+// GetTransfer 获取调拨单
+func (s *TransferServiceImpl) GetTransfer(ctx context.Context, transferSN string) (*entity.TransferOrder, error) {
+	if transferSN == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	order, err := s.repo.GetTransfer(ctx, transferSN)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// translateError 将仓储层错误转换为服务层错误
+func (s *TransferServiceImpl) translateError(action string, transferSN string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return ErrTransferNotFound
+	case errors.Is(err, repository.ErrInvalidTransferStatus):
+		return ErrInvalidTransferStatus
+	}
+
+	s.logger.Error("Failed to "+action+" transfer",
+		zap.String("transfer_sn", transferSN),
+		zap.Error(err))
+	return ErrOperationFailed
+}
+
+// generateTransferSN 生成调拨单号
+func generateTransferSN() string {
+	return fmt.Sprintf("TR%s%04d", time.Now().Format("20060102150405"), rand.Intn(10000))
+}
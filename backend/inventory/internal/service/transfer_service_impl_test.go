@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeTransferRepo 记录创建的调拨单，操作返回预设的错误
+type fakeTransferRepo struct {
+	repository.TransferRepository
+	created *entity.TransferOrder
+	err     error
+}
+
+func (r *fakeTransferRepo) CreateTransfer(ctx context.Context, order *entity.TransferOrder) error {
+	r.created = order
+	return r.err
+}
+
+func (r *fakeTransferRepo) ShipTransfer(ctx context.Context, transferSN string, operator string) error {
+	return r.err
+}
+
+// fakeTransferWarehouseRepo 按ID返回仓库，不存在时返回ErrRecordNotFound
+type fakeTransferWarehouseRepo struct {
+	repository.WarehouseRepository
+	warehouses map[int]*entity.Warehouse
+}
+
+func (r *fakeTransferWarehouseRepo) GetWarehouse(ctx context.Context, id int) (*entity.Warehouse, error) {
+	if warehouse, ok := r.warehouses[id]; ok {
+		return warehouse, nil
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func newTestTransferService(repo *fakeTransferRepo) TransferService {
+	warehouses := &fakeTransferWarehouseRepo{warehouses: map[int]*entity.Warehouse{
+		1: {ID: 1, Status: 1},
+		2: {ID: 2, Status: 1},
+		3: {ID: 3, Status: 0},
+	}}
+	return NewTransferService(repo, warehouses, zap.NewNop())
+}
+
+func TestCreateTransferValidation(t *testing.T) {
+	items := []*entity.TransferItem{{ProductID: 100, Quantity: 2}}
+	tests := []struct {
+		name  string
+		order *entity.TransferOrder
+		err   error
+	}{
+		{"no items", &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 2}, ErrInvalidArgument},
+		{"same warehouse", &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 1, Items: items}, ErrSameWarehouse},
+		{"non-positive quantity", &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 2,
+			Items: []*entity.TransferItem{{ProductID: 100}}}, ErrInvalidArgument},
+		{"unknown warehouse", &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 9, Items: items}, ErrWarehouseNotFound},
+		{"inactive warehouse", &entity.TransferOrder{FromWarehouseID: 3, ToWarehouseID: 2, Items: items}, ErrWarehouseInactive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeTransferRepo{}
+			err := newTestTransferService(repo).CreateTransfer(context.Background(), tt.order)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("CreateTransfer() error = %v, want %v", err, tt.err)
+			}
+			if repo.created != nil {
+				t.Error("invalid transfer reached the repository")
+			}
+		})
+	}
+}
+
+func TestCreateTransferAssignsSN(t *testing.T) {
+	repo := &fakeTransferRepo{}
+	order := &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 2,
+		Items: []*entity.TransferItem{{ProductID: 100, Quantity: 2}}}
+
+	if err := newTestTransferService(repo).CreateTransfer(context.Background(), order); err != nil {
+		t.Fatalf("CreateTransfer() error = %v", err)
+	}
+	if repo.created != order || order.TransferSN == "" {
+		t.Errorf("created = %+v, want the order with a generated transfer SN", repo.created)
+	}
+}
+
+func TestTransferErrorTranslation(t *testing.T) {
+	tests := []struct {
+		repoErr error
+		want    error
+	}{
+		{repository.ErrInsufficientStock, ErrInsufficientStock},
+		{errors.New("connection reset"), ErrOperationFailed},
+	}
+	order := func() *entity.TransferOrder {
+		return &entity.TransferOrder{FromWarehouseID: 1, ToWarehouseID: 2,
+			Items: []*entity.TransferItem{{ProductID: 100, Quantity: 2}}}
+	}
+	for _, tt := range tests {
+		svc := newTestTransferService(&fakeTransferRepo{err: tt.repoErr})
+		if err := svc.CreateTransfer(context.Background(), order()); !errors.Is(err, tt.want) {
+			t.Errorf("CreateTransfer() with %v = %v, want %v", tt.repoErr, err, tt.want)
+		}
+	}
+
+	shipTests := []struct {
+		repoErr error
+		want    error
+	}{
+		{repository.ErrRecordNotFound, ErrTransferNotFound},
+		{repository.ErrInvalidTransferStatus, ErrInvalidTransferStatus},
+	}
+	for _, tt := range shipTests {
+		svc := newTestTransferService(&fakeTransferRepo{err: tt.repoErr})
+		if _, err := svc.ShipTransfer(context.Background(), "TR1", "tester"); !errors.Is(err, tt.want) {
+			t.Errorf("ShipTransfer() with %v = %v, want %v", tt.repoErr, err, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 	
 	"go.uber.org/zap"
@@ -18,6 +19,8 @@ var (
 	ErrWarehouseCreateFailed = errors.New("failed to create warehouse")
 	ErrWarehouseUpdateFailed = errors.New("failed to update warehouse")
 	ErrWarehouseDeleteFailed = errors.New("failed to delete warehouse")
+	// ErrWarehouseNotEmpty 仓库仍有库存、锁定或在途调拨，不能删除
+	ErrWarehouseNotEmpty     = errors.New("warehouse cannot be deleted")
 )
 
 // WarehouseServiceImpl 仓库管理服务实现
@@ -74,14 +77,14 @@ func (s *WarehouseServiceImpl) GetWarehouseByName(ctx context.Context, name stri
 	return warehouse, nil
 }
 
-// ListWarehouses 获取仓库列表
-func (s *WarehouseServiceImpl) ListWarehouses(ctx context.Context, page, pageSize int) ([]*entity.Warehouse, int64, error) {
+// ListWarehouses 按条件获取仓库列表
+func (s *WarehouseServiceImpl) ListWarehouses(ctx context.Context, filter *repository.WarehouseFilter, page, pageSize int) ([]*entity.Warehouse, int64, error) {
 	if page <= 0 || pageSize <= 0 {
 		return nil, 0, ErrInvalidArgument
 	}
 	
 	// 查询仓库列表
-	warehouses, total, err := s.repo.ListWarehouses(ctx, page, pageSize)
+	warehouses, total, err := s.repo.ListWarehouses(ctx, filter, page, pageSize)
 	if err != nil {
 		s.logger.Error("Failed to list warehouses",
 			zap.Int("page", page),
@@ -95,7 +98,7 @@ func (s *WarehouseServiceImpl) ListWarehouses(ctx context.Context, page, pageSiz
 
 // CreateWarehouse 创建仓库
 func (s *WarehouseServiceImpl) CreateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error {
-	if warehouse == nil || warehouse.Name == "" || warehouse.Address == "" {
+	if warehouse == nil || warehouse.Name == "" || warehouse.Address == "" || !validWarehouseProfile(warehouse) {
 		return ErrInvalidArgument
 	}
 	
@@ -133,7 +136,7 @@ func (s *WarehouseServiceImpl) CreateWarehouse(ctx context.Context, warehouse *e
 
 // UpdateWarehouse 更新仓库
 func (s *WarehouseServiceImpl) UpdateWarehouse(ctx context.Context, warehouse *entity.Warehouse) error {
-	if warehouse == nil || warehouse.ID <= 0 {
+	if warehouse == nil || warehouse.ID <= 0 || !validWarehouseProfile(warehouse) {
 		return ErrInvalidArgument
 	}
 	
@@ -197,8 +200,14 @@ func (s *WarehouseServiceImpl) DeleteWarehouse(ctx context.Context, id int) erro
 		return err
 	}
 	
-	// 删除仓库（软删除）
+	// 仍有库存、锁定或在途调拨时拒绝删除
 	if err := s.repo.DeleteWarehouse(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrWarehouseNotEmpty) {
+			return fmt.Errorf("%w: %v", ErrWarehouseNotEmpty, err)
+		}
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return ErrWarehouseNotFound
+		}
 		s.logger.Error("Failed to delete warehouse",
 			zap.Int("id", id),
 			zap.Error(err))
@@ -207,3 +216,14 @@ func (s *WarehouseServiceImpl) DeleteWarehouse(ctx context.Context, id int) erro
 	
 	return nil
 }
+
+// validWarehouseProfile 校验仓库的坐标、库容和作业能力
+func validWarehouseProfile(warehouse *entity.Warehouse) bool {
+	if warehouse.Latitude < -90 || warehouse.Latitude > 90 || warehouse.Longitude < -180 || warehouse.Longitude > 180 {
+		return false
+	}
+	if warehouse.Capacity < 0 {
+		return false
+	}
+	return warehouse.Capabilities >= 0 && warehouse.Capabilities <= entity.AllWarehouseCapabilities
+}
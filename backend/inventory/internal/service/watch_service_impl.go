@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+	"shop/backend/inventory/internal/watch"
+)
+
+// 单个订阅最多关注的商品数量
+const maxWatchProducts = 500
+
+// ErrWatchUnavailable 库存变更订阅不可用，服务正在停止
+var ErrWatchUnavailable = errors.New("inventory watch unavailable")
+
+// InventoryWatchServiceImpl 库存变更订阅服务实现
+type InventoryWatchServiceImpl struct {
+	repo          repository.InventoryRepository
+	warehouseRepo repository.WarehouseRepository
+	hub           *watch.Hub
+	logger        *zap.Logger
+}
+
+// NewInventoryWatchService 创建库存变更订阅服务实例
+func NewInventoryWatchService(
+	repo repository.InventoryRepository,
+	warehouseRepo repository.WarehouseRepository,
+	hub *watch.Hub,
+	logger *zap.Logger,
+) InventoryWatchService {
+	return &InventoryWatchServiceImpl{
+		repo:          repo,
+		warehouseRepo: warehouseRepo,
+		hub:           hub,
+		logger:        logger,
+	}
+}
+
+// Watch 订阅库存变更。productIDs和warehouseID至少指定一个，只指定仓库时不返回当前库存。
+// 先订阅再读取当前库存，读取期间发生的变更会在当前库存之后再次推送，不会遗漏
+func (s *InventoryWatchServiceImpl) Watch(ctx context.Context, productIDs []int64, warehouseID int) (*watch.Subscription, []*entity.Inventory, error) {
+	if (len(productIDs) == 0 && warehouseID <= 0) || len(productIDs) > maxWatchProducts || warehouseID < 0 {
+		return nil, nil, ErrInvalidArgument
+	}
+	for _, productID := range productIDs {
+		if productID <= 0 {
+			return nil, nil, ErrInvalidArgument
+		}
+	}
+
+	if warehouseID > 0 {
+		if _, err := s.warehouseRepo.GetWarehouse(ctx, warehouseID); err != nil {
+			if errors.Is(err, repository.ErrRecordNotFound) {
+				return nil, nil, ErrWarehouseNotFound
+			}
+			return nil, nil, ErrOperationFailed
+		}
+	}
+
+	sub, err := s.hub.Subscribe(watch.Filter{ProductIDs: productIDs, WarehouseID: warehouseID})
+	if err != nil {
+		return nil, nil, ErrWatchUnavailable
+	}
+
+	if len(productIDs) == 0 {
+		return sub, nil, nil
+	}
+
+	warehouseIDs := []int{warehouseID}
+	if warehouseID == 0 {
+		warehouses, err := s.warehouseRepo.ListActiveWarehouses(ctx)
+		if err != nil {
+			sub.Close()
+			return nil, nil, ErrOperationFailed
+		}
+		warehouseIDs = make([]int, 0, len(warehouses))
+		for _, warehouse := range warehouses {
+			warehouseIDs = append(warehouseIDs, warehouse.ID)
+		}
+	}
+
+	inventories, err := s.repo.GetInventoriesByProducts(ctx, productIDs, warehouseIDs)
+	if err != nil {
+		s.logger.Error("Failed to load inventories for watch",
+			zap.Int64s("product_ids", productIDs),
+			zap.Int("warehouse_id", warehouseID),
+			zap.Error(err))
+		sub.Close()
+		return nil, nil, ErrOperationFailed
+	}
+
+	return sub, inventories, nil
+}
@@ -0,0 +1,180 @@
+package watch
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// 默认每个订阅缓冲的变更数量
+const defaultBufferSize = 256
+
+// ErrHubClosed 订阅中心已关闭
+var ErrHubClosed = errors.New("watch hub closed")
+
+// Filter 订阅条件，ProductIDs为空时不限商品，WarehouseID为0时不限仓库
+type Filter struct {
+	ProductIDs  []int64
+	WarehouseID int
+}
+
+// Subscription 库存变更订阅。订阅方消费过慢导致缓冲区写满时订阅被终止，
+// Lagged返回true，订阅方应重新订阅以获取最新库存
+type Subscription struct {
+	hub         *Hub
+	id          uint64
+	products    map[int64]struct{}
+	warehouseID int
+	updates     chan *entity.Inventory
+	done        chan struct{}
+	closeOnce   sync.Once
+	lagged      atomic.Bool
+}
+
+// Updates 变更的库存记录，推送的记录为只读
+func (s *Subscription) Updates() <-chan *entity.Inventory {
+	return s.updates
+}
+
+// Done 订阅被终止时关闭
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Lagged 判断订阅是否因消费过慢被终止
+func (s *Subscription) Lagged() bool {
+	return s.lagged.Load()
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.hub.remove(s.id)
+	s.stop()
+}
+
+func (s *Subscription) stop() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// matches 判断库存记录是否符合订阅条件
+func (s *Subscription) matches(inv *entity.Inventory) bool {
+	if s.warehouseID > 0 && inv.WarehouseID != s.warehouseID {
+		return false
+	}
+	if len(s.products) == 0 {
+		return true
+	}
+	_, ok := s.products[inv.ProductID]
+	return ok
+}
+
+// Hub 进程内的库存变更订阅中心，将变更后的库存分发给符合条件的订阅。
+// 只能收到本进程内发生的变更，多副本部署时订阅方看到的是所连接副本处理的变更
+type Hub struct {
+	mu         sync.RWMutex
+	subs       map[uint64]*Subscription
+	nextID     uint64
+	bufferSize int
+	closed     bool
+	logger     *zap.Logger
+}
+
+// NewHub 创建订阅中心，bufferSize为每个订阅缓冲的变更数量
+func NewHub(bufferSize int, logger *zap.Logger) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+
+	return &Hub{
+		subs:       make(map[uint64]*Subscription),
+		bufferSize: bufferSize,
+		logger:     logger,
+	}
+}
+
+// Subscribe 按条件订阅库存变更，调用方负责关闭订阅
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	h.nextID++
+	sub := &Subscription{
+		hub:         h,
+		id:          h.nextID,
+		products:    make(map[int64]struct{}, len(filter.ProductIDs)),
+		warehouseID: filter.WarehouseID,
+		updates:     make(chan *entity.Inventory, h.bufferSize),
+		done:        make(chan struct{}),
+	}
+	for _, productID := range filter.ProductIDs {
+		sub.products[productID] = struct{}{}
+	}
+	h.subs[sub.id] = sub
+
+	return sub, nil
+}
+
+// HasSubscribers 判断是否有订阅，没有订阅时发布方可以跳过读取库存
+func (h *Hub) HasSubscribers() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs) > 0
+}
+
+// Publish 将变更后的库存分发给订阅，不会阻塞，缓冲区已满的订阅被终止
+func (h *Hub) Publish(inventories []*entity.Inventory) {
+	var lagging []*Subscription
+
+	h.mu.RLock()
+	for _, sub := range h.subs {
+	send:
+		for _, inv := range inventories {
+			if !sub.matches(inv) {
+				continue
+			}
+			select {
+			case sub.updates <- inv:
+			default:
+				lagging = append(lagging, sub)
+				break send
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range lagging {
+		h.logger.Warn("Inventory watcher lagged, subscription dropped",
+			zap.Uint64("subscription_id", sub.id),
+			zap.Int("buffer_size", h.bufferSize))
+		sub.lagged.Store(true)
+		sub.Close()
+	}
+}
+
+// Close 关闭订阅中心并终止所有订阅，服务停止前调用，使流式请求尽快结束
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for id, sub := range h.subs {
+		sub.stop()
+		delete(h.subs, id)
+	}
+}
+
+func (h *Hub) remove(id uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, id)
+}
@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+)
+
+// received 取出订阅中已缓冲的变更
+func received(sub *Subscription) []*entity.Inventory {
+	var inventories []*entity.Inventory
+	for {
+		select {
+		case inv := <-sub.Updates():
+			inventories = append(inventories, inv)
+		default:
+			return inventories
+		}
+	}
+}
+
+func TestHubDeliversMatchingChanges(t *testing.T) {
+	hub := NewHub(8, zap.NewNop())
+	byProduct, err := hub.Subscribe(Filter{ProductIDs: []int64{100}})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	byWarehouse, _ := hub.Subscribe(Filter{WarehouseID: 2})
+
+	hub.Publish([]*entity.Inventory{
+		{ProductID: 100, WarehouseID: 1},
+		{ProductID: 200, WarehouseID: 2},
+		{ProductID: 100, WarehouseID: 2},
+	})
+
+	if got := received(byProduct); len(got) != 2 {
+		t.Errorf("product subscription got %d changes, want 2", len(got))
+	}
+	if got := received(byWarehouse); len(got) != 2 || got[0].ProductID != 200 {
+		t.Errorf("warehouse subscription got %+v, want products 200 and 100 in warehouse 2", got)
+	}
+
+	byProduct.Close()
+	hub.Publish([]*entity.Inventory{{ProductID: 100, WarehouseID: 1}})
+	if got := received(byProduct); len(got) != 0 {
+		t.Errorf("closed subscription got %d changes, want 0", len(got))
+	}
+}
+
+func TestHubDropsLaggingSubscription(t *testing.T) {
+	hub := NewHub(1, zap.NewNop())
+	slow, _ := hub.Subscribe(Filter{})
+
+	hub.Publish([]*entity.Inventory{{ProductID: 100, WarehouseID: 1}, {ProductID: 200, WarehouseID: 1}})
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("lagging subscription not terminated")
+	}
+	if !slow.Lagged() {
+		t.Error("Lagged() = false, want true")
+	}
+	if hub.HasSubscribers() {
+		t.Error("lagging subscription still registered")
+	}
+}
+
+func TestClosedHubRejectsSubscriptions(t *testing.T) {
+	hub := NewHub(1, zap.NewNop())
+	sub, _ := hub.Subscribe(Filter{})
+
+	hub.Close()
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("subscription not terminated when hub closed")
+	}
+	if sub.Lagged() {
+		t.Error("Lagged() = true after hub closed, want false")
+	}
+	if _, err := hub.Subscribe(Filter{}); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("Subscribe() error = %v, want %v", err, ErrHubClosed)
+	}
+}
@@ -3,6 +3,8 @@ package grpc
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"time"
 	
 	"go.uber.org/zap"
@@ -13,6 +15,8 @@ import (
 	
 	pb "shop/backend/inventory/api/proto"
 	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/domain/valueobject"
+	"shop/backend/inventory/internal/repository"
 	"shop/backend/inventory/internal/service"
 )
 
@@ -22,6 +26,16 @@ type InventoryServer struct {
 	inventoryService    service.InventoryService
 	inventoryLockService service.InventoryLockService
 	warehouseService    service.WarehouseService
+	transferService     service.TransferService
+	inboundService      service.InboundService
+	lotService          service.LotService
+	stocktakeService    service.StocktakeService
+	auditService        service.AuditService
+	watchService        service.InventoryWatchService
+	bulkService         service.InventoryBulkService
+	channelService      service.ChannelAllocationService
+	backorderService    service.BackorderService
+	bundleService       service.BundleService
 	logger             *zap.Logger
 }
 
@@ -30,26 +44,50 @@ func NewInventoryServer(
 	inventoryService service.InventoryService,
 	inventoryLockService service.InventoryLockService,
 	warehouseService service.WarehouseService,
+	transferService service.TransferService,
+	inboundService service.InboundService,
+	lotService service.LotService,
+	stocktakeService service.StocktakeService,
+	auditService service.AuditService,
+	watchService service.InventoryWatchService,
+	bulkService service.InventoryBulkService,
+	channelService service.ChannelAllocationService,
+	backorderService service.BackorderService,
+	bundleService service.BundleService,
 	logger *zap.Logger,
 ) *InventoryServer {
 	return &InventoryServer{
 		inventoryService:    inventoryService,
 		inventoryLockService: inventoryLockService,
 		warehouseService:    warehouseService,
+		transferService:     transferService,
+		inboundService:      inboundService,
+		lotService:          lotService,
+		stocktakeService:    stocktakeService,
+		auditService:        auditService,
+		watchService:        watchService,
+		bulkService:         bulkService,
+		channelService:      channelService,
+		backorderService:    backorderService,
+		bundleService:       bundleService,
 		logger:             logger,
 	}
 }
 
 // SetInv 设置商品库存
 func (s *InventoryServer) SetInv(ctx context.Context, req *pb.GoodsInvInfo) (*emptypb.Empty, error) {
-	if req.GoodsId <= 0 || req.Stock < 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or stock")
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.Stock < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id or stock")
 	}
 	
-	err := s.inventoryService.SetInventory(ctx, req.GoodsId, int(req.Stock), req.Operator)
+	err := s.inventoryService.SetInventory(ctx, req.GoodsId, req.SkuId, int(req.Stock), req.Operator)
 	if err != nil {
+		if errors.Is(err, service.ErrStockHasLocks) {
+			return nil, status.Errorf(codes.FailedPrecondition, "stock cannot be set below locked quantity")
+		}
 		s.logger.Error("Failed to set inventory",
 			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
 			zap.Int32("stock", req.Stock),
 			zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to set inventory: %v", err)
@@ -64,23 +102,30 @@ func (s *InventoryServer) InvDetail(ctx context.Context, req *pb.GoodsInvInfo) (
 		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id")
 	}
 	
-	inventory, err := s.inventoryService.GetInventory(ctx, req.GoodsId)
+	inventory, err := s.inventoryService.GetInventory(ctx, req.GoodsId, req.SkuId)
 	if err != nil {
 		if errors.Is(err, service.ErrStockNotFound) {
 			return nil, status.Errorf(codes.NotFound, "inventory not found")
 		}
 		s.logger.Error("Failed to get inventory detail",
 			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
 			zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to get inventory: %v", err)
 	}
 	
 	return &pb.GoodsInvInfo{
 		GoodsId:       inventory.ProductID,
+		SkuId:         inventory.SkuID,
 		Stock:         int32(inventory.Stock),
 		LockStock:     int32(inventory.LockStock),
 		WarehouseId:   int32(inventory.WarehouseID),
 		AlertThreshold: int32(inventory.AlertThreshold),
+		SafetyStock:   int32(inventory.SafetyStock),
+		ReservedStock: int32(inventory.ReservedStock),
+		BackorderLimit: int32(inventory.BackorderLimit),
+		BackorderStock: int32(inventory.BackorderStock),
+		Bundle:        inventory.Bundle,
 	}, nil
 }
 
@@ -90,17 +135,17 @@ func (s *InventoryServer) BatchInvDetail(ctx context.Context, req *pb.BatchGoods
 		return &pb.BatchGoodsInvInfo{GoodsList: []*pb.GoodsInvInfo{}}, nil
 	}
 	
-	// 提取商品ID列表
-	var productIDs []int64
+	// 提取商品SKU列表
+	var keys []valueobject.SkuKey
 	for _, item := range req.GoodsList {
-		productIDs = append(productIDs, item.GoodsId)
+		keys = append(keys, valueobject.SkuKey{ProductID: item.GoodsId, SkuID: item.SkuId})
 	}
 	
 	// 批量查询库存
-	inventories, err := s.inventoryService.BatchGetInventory(ctx, productIDs)
+	inventories, err := s.inventoryService.BatchGetInventory(ctx, keys)
 	if err != nil {
 		s.logger.Error("Failed to batch get inventory",
-			zap.Any("product_ids", productIDs),
+			zap.Any("keys", keys),
 			zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to batch get inventory: %v", err)
 	}
@@ -113,10 +158,16 @@ func (s *InventoryServer) BatchInvDetail(ctx context.Context, req *pb.BatchGoods
 	for _, inventory := range inventories {
 		result.GoodsList = append(result.GoodsList, &pb.GoodsInvInfo{
 			GoodsId:       inventory.ProductID,
+			SkuId:         inventory.SkuID,
 			Stock:         int32(inventory.Stock),
 			LockStock:     int32(inventory.LockStock),
 			WarehouseId:   int32(inventory.WarehouseID),
 			AlertThreshold: int32(inventory.AlertThreshold),
+			SafetyStock:   int32(inventory.SafetyStock),
+			ReservedStock: int32(inventory.ReservedStock),
+			BackorderLimit: int32(inventory.BackorderLimit),
+			BackorderStock: int32(inventory.BackorderStock),
+			Bundle:        inventory.Bundle,
 		})
 	}
 	
@@ -125,14 +176,20 @@ func (s *InventoryServer) BatchInvDetail(ctx context.Context, req *pb.BatchGoods
 
 // AddStock 添加库存
 func (s *InventoryServer) AddStock(ctx context.Context, req *pb.AddStockInfo) (*emptypb.Empty, error) {
-	if req.GoodsId <= 0 || req.Quantity <= 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or quantity")
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.Quantity <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id or quantity")
+	}
+	
+	var lot *valueobject.LotInfo
+	if req.LotNo != "" {
+		lot = &valueobject.LotInfo{LotNo: req.LotNo, ExpiryDate: toTimePtr(req.ExpiryDate)}
 	}
 	
-	err := s.inventoryService.AddStock(ctx, req.GoodsId, int(req.Quantity), req.Remark)
+	err := s.inventoryService.AddStock(ctx, req.GoodsId, req.SkuId, int(req.Quantity), req.ReferenceSn, req.Remark, lot)
 	if err != nil {
 		s.logger.Error("Failed to add stock",
 			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
 			zap.Int32("quantity", req.Quantity),
 			zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to add stock: %v", err)
@@ -143,14 +200,18 @@ func (s *InventoryServer) AddStock(ctx context.Context, req *pb.AddStockInfo) (*
 
 // AdjustStock 调整库存
 func (s *InventoryServer) AdjustStock(ctx context.Context, req *pb.AdjustStockInfo) (*emptypb.Empty, error) {
-	if req.GoodsId <= 0 || req.Stock < 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or stock")
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.Stock < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id or stock")
 	}
 	
-	err := s.inventoryService.AdjustStock(ctx, req.GoodsId, int(req.Stock), req.Operator, req.Remark)
+	err := s.inventoryService.AdjustStock(ctx, req.GoodsId, req.SkuId, int(req.Stock), req.Operator, req.Remark)
 	if err != nil {
+		if errors.Is(err, service.ErrStockHasLocks) {
+			return nil, status.Errorf(codes.FailedPrecondition, "stock cannot be adjusted below locked quantity")
+		}
 		s.logger.Error("Failed to adjust stock",
 			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
 			zap.Int32("stock", req.Stock),
 			zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to adjust stock: %v", err)
@@ -159,6 +220,320 @@ func (s *InventoryServer) AdjustStock(ctx context.Context, req *pb.AdjustStockIn
 	return &emptypb.Empty{}, nil
 }
 
+// SplitInventory 将商品级库存拆分到SKU
+func (s *InventoryServer) SplitInventory(ctx context.Context, req *pb.SplitInventoryInfo) (*emptypb.Empty, error) {
+	if req.GoodsId <= 0 || req.WarehouseId <= 0 || len(req.SkuStocks) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, warehouse_id or sku_stocks")
+	}
+	
+	skuStocks := make(map[int64]int, len(req.SkuStocks))
+	for _, skuStock := range req.SkuStocks {
+		if skuStock.SkuId <= 0 || skuStock.Quantity < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid sku_id or quantity")
+		}
+		if _, ok := skuStocks[skuStock.SkuId]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "duplicate sku_id %d", skuStock.SkuId)
+		}
+		skuStocks[skuStock.SkuId] = int(skuStock.Quantity)
+	}
+	
+	err := s.inventoryService.SplitInventory(ctx, req.GoodsId, int(req.WarehouseId), skuStocks, req.Operator)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidArgument):
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		case errors.Is(err, service.ErrStockNotFound):
+			return nil, status.Errorf(codes.NotFound, "goods-level inventory not found")
+		case errors.Is(err, service.ErrStockHasLocks):
+			return nil, status.Errorf(codes.FailedPrecondition, "goods-level inventory has locked stock")
+		}
+		s.logger.Error("Failed to split inventory",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to split inventory: %v", err)
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// ListLowStock 查询低于预警阈值的库存
+func (s *InventoryServer) ListLowStock(ctx context.Context, req *pb.LowStockQuery) (*pb.LowStockResponse, error) {
+	if req.WarehouseId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid warehouse_id")
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+	
+	inventories, total, err := s.inventoryService.ListLowStock(ctx, int(req.WarehouseId), int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list low stock",
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to list low stock: %v", err)
+	}
+	
+	response := &pb.LowStockResponse{
+		Total: total,
+		Items: make([]*pb.LowStockItem, 0, len(inventories)),
+	}
+	
+	for _, inv := range inventories {
+		response.Items = append(response.Items, &pb.LowStockItem{
+			GoodsId:        inv.ProductID,
+			SkuId:          inv.SkuID,
+			WarehouseId:    int32(inv.WarehouseID),
+			Stock:          int32(inv.Stock),
+			LockStock:      int32(inv.LockStock),
+			Available:      int32(inv.AvailableStock()),
+			AlertThreshold: int32(inv.AlertThreshold),
+		})
+	}
+	
+	return response, nil
+}
+
+// ListExpiringLots 查询临期批次
+func (s *InventoryServer) ListExpiringLots(ctx context.Context, req *pb.ExpiringLotQuery) (*pb.ExpiringLotResponse, error) {
+	if req.WarehouseId < 0 || req.WithinDays < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid warehouse_id or within_days")
+	}
+	
+	within := time.Duration(req.WithinDays) * 24 * time.Hour
+	lots, total, err := s.lotService.ListExpiringLots(ctx, int(req.WarehouseId), within, req.IncludeExpired, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list expiring lots",
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Int32("within_days", req.WithinDays),
+			zap.Error(err))
+		if errors.Is(err, service.ErrInvalidArgument) {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to list expiring lots: %v", err)
+	}
+	
+	response := &pb.ExpiringLotResponse{
+		Total: total,
+		Lots:  make([]*pb.LotInfo, 0, len(lots)),
+	}
+	
+	for _, lot := range lots {
+		response.Lots = append(response.Lots, &pb.LotInfo{
+			GoodsId:     lot.ProductID,
+			SkuId:       lot.SkuID,
+			WarehouseId: int32(lot.WarehouseID),
+			LotNo:       lot.LotNo,
+			ExpiryDate:  toTimestamp(lot.ExpiryDate),
+			Stock:       int32(lot.Stock),
+			LockStock:   int32(lot.LockStock),
+			Expired:     lot.Expired,
+		})
+	}
+	
+	return response, nil
+}
+
+// WriteOffExpiredLot 报废过期批次，核销批次中未锁定的数量
+func (s *InventoryServer) WriteOffExpiredLot(ctx context.Context, req *pb.WriteOffLotRequest) (*pb.WriteOffLotResponse, error) {
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.WarehouseId <= 0 || req.LotNo == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id, warehouse_id or lot_no")
+	}
+	
+	lot, quantity, err := s.lotService.WriteOffExpiredLot(ctx, req.GoodsId, req.SkuId, int(req.WarehouseId), req.LotNo, req.Operator, req.Remark)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidArgument):
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		case errors.Is(err, service.ErrStockNotFound):
+			return nil, status.Errorf(codes.NotFound, "lot not found")
+		case errors.Is(err, service.ErrLotNotExpired):
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		s.logger.Error("Failed to write off expired lot",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.String("lot_no", req.LotNo),
+			zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "failed to write off lot: %v", err)
+	}
+	
+	return &pb.WriteOffLotResponse{
+		Quantity: int32(quantity),
+		Lot: &pb.LotInfo{
+			GoodsId:     lot.ProductID,
+			SkuId:       lot.SkuID,
+			WarehouseId: int32(lot.WarehouseID),
+			LotNo:       lot.LotNo,
+			ExpiryDate:  toTimestamp(lot.ExpiryDate),
+			Stock:       int32(lot.Stock),
+			LockStock:   int32(lot.LockStock),
+			Expired:     lot.Expired,
+		},
+	}, nil
+}
+
+// WatchInventory 订阅库存变更，先推送订阅商品的当前库存，之后每次库存或锁定数量变化时推送最新库存。
+// 客户端消费过慢时返回ResourceExhausted，服务停止时返回Unavailable，客户端应重新订阅
+func (s *InventoryServer) WatchInventory(req *pb.WatchInventoryRequest, stream pb.InventoryService_WatchInventoryServer) error {
+	if len(req.GoodsIds) == 0 && req.WarehouseId <= 0 {
+		return status.Errorf(codes.InvalidArgument, "goods_ids or warehouse_id is required")
+	}
+	
+	sub, snapshot, err := s.watchService.Watch(stream.Context(), req.GoodsIds, int(req.WarehouseId))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidArgument):
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		case errors.Is(err, service.ErrWarehouseNotFound):
+			return status.Errorf(codes.NotFound, "%v", err)
+		case errors.Is(err, service.ErrWatchUnavailable):
+			return status.Errorf(codes.Unavailable, "%v", err)
+		default:
+			return status.Errorf(codes.Internal, "failed to watch inventory: %v", err)
+		}
+	}
+	defer sub.Close()
+	
+	for _, inventory := range snapshot {
+		if err := stream.Send(toGoodsInvInfo(inventory)); err != nil {
+			return err
+		}
+	}
+	
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Done():
+			if sub.Lagged() {
+				return status.Errorf(codes.ResourceExhausted, "watcher lagged behind, resubscribe to resync")
+			}
+			return status.Errorf(codes.Unavailable, "%v", service.ErrWatchUnavailable)
+		case inventory := <-sub.Updates():
+			if err := stream.Send(toGoodsInvInfo(inventory)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ImportInventory 以客户端流接收CSV文件并导入库存，dry_run和operator以第一条消息为准。
+// 存在校验错误时不写入任何记录，错误和差异在响应中返回
+func (s *InventoryServer) ImportInventory(stream pb.InventoryService_ImportInventoryServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Errorf(codes.InvalidArgument, "empty import")
+	}
+	if err != nil {
+		return err
+	}
+	
+	operator := first.Operator
+	if operator == "" {
+		operator = valueobject.OperatorFromContext(stream.Context()).Name
+	}
+	if operator == "" {
+		return status.Errorf(codes.InvalidArgument, "operator is required")
+	}
+	
+	reader := &importChunkReader{stream: stream, buf: first.Chunk}
+	report, err := s.bulkService.ImportInventory(stream.Context(), reader, first.DryRun, operator)
+	if err != nil && report == nil {
+		switch {
+		case reader.err != nil:
+			return reader.err
+		case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrImportFileInvalid):
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		default:
+			return status.Errorf(codes.Internal, "failed to import inventory: %v", err)
+		}
+	}
+	if err != nil {
+		// 部分批次已写入，返回错误让客户端知道需要重新导入
+		s.logger.Warn("Inventory import incomplete",
+			zap.Int("applied", report.Applied),
+			zap.String("operator", operator),
+			zap.Error(err))
+		return status.Errorf(codes.Aborted, "%v (applied %d of %d)", err, report.Applied, report.Created+report.Updated)
+	}
+	
+	return stream.SendAndClose(toImportInventoryResponse(report))
+}
+
+// ExportInventory 以服务端流导出库存CSV文件
+func (s *InventoryServer) ExportInventory(req *pb.ExportInventoryRequest, stream pb.InventoryService_ExportInventoryServer) error {
+	if req.WarehouseId < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid warehouse_id")
+	}
+	
+	writer := &exportChunkWriter{stream: stream}
+	if err := s.bulkService.ExportInventory(stream.Context(), writer, int(req.WarehouseId)); err != nil {
+		if writer.err != nil {
+			return writer.err
+		}
+		s.logger.Error("Failed to export inventory",
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Error(err))
+		return status.Errorf(codes.Internal, "failed to export inventory: %v", err)
+	}
+	
+	return nil
+}
+
+// importChunkReader 将客户端流中的文件片段按顺序拼接为io.Reader
+type importChunkReader struct {
+	stream pb.InventoryService_ImportInventoryServer
+	buf    []byte
+	err    error // 接收流失败的错误，区别于文件内容错误
+}
+
+// Read 读取文件内容，当前片段读完后接收下一条消息
+func (r *importChunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		req, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.buf = req.Chunk
+	}
+	
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// exportChunkWriter 将写入的内容作为文件片段发送到服务端流
+type exportChunkWriter struct {
+	stream pb.InventoryService_ExportInventoryServer
+	err    error // 发送失败的错误，通常为客户端已断开
+}
+
+// Write 发送一个文件片段，写入的内容会被复制，调用方可以复用缓冲区
+func (w *exportChunkWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+	if err := w.stream.Send(&pb.InventoryCsvChunk{Chunk: chunk}); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
 // GetInventoryHistory 获取库存历史记录
 func (s *InventoryServer) GetInventoryHistory(ctx context.Context, req *pb.InventoryHistoryRequest) (*pb.InventoryHistoryResponse, error) {
 	if req.GoodsId <= 0 || req.Page <= 0 || req.PageSize <= 0 {
@@ -186,6 +561,7 @@ func (s *InventoryServer) GetInventoryHistory(ctx context.Context, req *pb.Inven
 		response.Items = append(response.Items, &pb.InventoryHistoryItem{
 			Id:         history.ID,
 			GoodsId:    history.ProductID,
+			SkuId:       history.SkuID,
 			WarehouseId: int32(history.WarehouseID),
 			Quantity:    int32(history.Quantity),
 			Operation:   string(history.Operation),
@@ -199,6 +575,271 @@ func (s *InventoryServer) GetInventoryHistory(ctx context.Context, req *pb.Inven
 	return response, nil
 }
 
+// SetChannelAllocation 设置库存记录分配给销售渠道的数量，增加的部分从共享可用库存中划出
+func (s *InventoryServer) SetChannelAllocation(ctx context.Context, req *pb.ChannelAllocationInfo) (*pb.ChannelAllocationInfo, error) {
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.WarehouseId <= 0 || req.Allocated < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id, warehouse_id or allocated")
+	}
+	
+	operator := req.Operator
+	if operator == "" {
+		operator = valueobject.OperatorFromContext(ctx).Name
+	}
+	
+	key := valueobject.StockKey{ProductID: req.GoodsId, SkuID: req.SkuId, WarehouseID: int(req.WarehouseId)}
+	allocation, err := s.channelService.SetChannelAllocation(ctx, key, req.Channel, int(req.Allocated), operator)
+	if err != nil {
+		s.logger.Error("Failed to set channel allocation",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.String("channel", req.Channel),
+			zap.Int32("allocated", req.Allocated),
+			zap.Error(err))
+		return nil, toChannelStatus(err, "failed to set channel allocation")
+	}
+	
+	return toChannelAllocationInfo(allocation), nil
+}
+
+// ListChannelAllocations 查询商品的渠道分配
+func (s *InventoryServer) ListChannelAllocations(ctx context.Context, req *pb.ChannelAllocationQuery) (*pb.ChannelAllocationResponse, error) {
+	if req.GoodsId <= 0 || req.WarehouseId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or warehouse_id")
+	}
+	
+	allocations, err := s.channelService.ListChannelAllocations(ctx, req.GoodsId, int(req.WarehouseId), req.Channel)
+	if err != nil {
+		s.logger.Error("Failed to list channel allocations",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.String("channel", req.Channel),
+			zap.Error(err))
+		return nil, toChannelStatus(err, "failed to list channel allocations")
+	}
+	
+	response := &pb.ChannelAllocationResponse{
+		Allocations: make([]*pb.ChannelAllocationInfo, 0, len(allocations)),
+	}
+	for _, allocation := range allocations {
+		response.Allocations = append(response.Allocations, toChannelAllocationInfo(allocation))
+	}
+	
+	return response, nil
+}
+
+// SetSafetyStock 设置库存记录的安全库存，安全库存对所有渠道都不可售
+func (s *InventoryServer) SetSafetyStock(ctx context.Context, req *pb.SafetyStockInfo) (*emptypb.Empty, error) {
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.WarehouseId <= 0 || req.SafetyStock < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id, warehouse_id or safety_stock")
+	}
+	
+	operator := req.Operator
+	if operator == "" {
+		operator = valueobject.OperatorFromContext(ctx).Name
+	}
+	
+	key := valueobject.StockKey{ProductID: req.GoodsId, SkuID: req.SkuId, WarehouseID: int(req.WarehouseId)}
+	if err := s.channelService.SetSafetyStock(ctx, key, int(req.SafetyStock), operator); err != nil {
+		s.logger.Error("Failed to set safety stock",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Int32("safety_stock", req.SafetyStock),
+			zap.Error(err))
+		return nil, toChannelStatus(err, "failed to set safety stock")
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// SetBackorderLimit 设置库存记录的预售上限，可用库存不足时最多可以排队预订该数量
+func (s *InventoryServer) SetBackorderLimit(ctx context.Context, req *pb.BackorderLimitInfo) (*emptypb.Empty, error) {
+	if req.GoodsId <= 0 || req.SkuId < 0 || req.WarehouseId <= 0 || req.BackorderLimit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id, sku_id, warehouse_id or backorder_limit")
+	}
+	
+	operator := req.Operator
+	if operator == "" {
+		operator = valueobject.OperatorFromContext(ctx).Name
+	}
+	
+	key := valueobject.StockKey{ProductID: req.GoodsId, SkuID: req.SkuId, WarehouseID: int(req.WarehouseId)}
+	if err := s.backorderService.SetBackorderLimit(ctx, key, int(req.BackorderLimit), operator); err != nil {
+		s.logger.Error("Failed to set backorder limit",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int64("sku_id", req.SkuId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Int32("backorder_limit", req.BackorderLimit),
+			zap.Error(err))
+		return nil, toChannelStatus(err, "failed to set backorder limit")
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// ListBackorders 按排队顺序分页查询缺货预订
+func (s *InventoryServer) ListBackorders(ctx context.Context, req *pb.BackorderQuery) (*pb.BackorderListResponse, error) {
+	if req.GoodsId < 0 || req.WarehouseId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or warehouse_id")
+	}
+	
+	filter := &repository.BackorderFilter{
+		OrderSN:     req.OrderSn,
+		ProductID:   req.GoodsId,
+		WarehouseID: int(req.WarehouseId),
+		Status:      entity.BackorderStatus(req.Status),
+	}
+	backorders, total, err := s.backorderService.ListBackorders(ctx, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list backorders",
+			zap.String("order_sn", req.OrderSn),
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Error(err))
+		return nil, toChannelStatus(err, "failed to list backorders")
+	}
+	
+	response := &pb.BackorderListResponse{
+		Total:      total,
+		Backorders: make([]*pb.BackorderInfo, 0, len(backorders)),
+	}
+	for _, backorder := range backorders {
+		response.Backorders = append(response.Backorders, &pb.BackorderInfo{
+			Id:          backorder.ID,
+			OrderSn:     backorder.OrderSN,
+			GoodsId:     backorder.ProductID,
+			SkuId:       backorder.SkuID,
+			WarehouseId: int32(backorder.WarehouseID),
+			Quantity:    int32(backorder.Quantity),
+			Fulfilled:   int32(backorder.Fulfilled),
+			Status:      pb.BackorderStatus(backorder.Status),
+			CreatedAt:   timestamppb.New(backorder.CreatedAt),
+			FulfilledAt: toTimestamp(backorder.FulfilledAt),
+		})
+	}
+	
+	return response, nil
+}
+
+// SaveBundle 创建或更新套装定义
+func (s *InventoryServer) SaveBundle(ctx context.Context, req *pb.BundleInfo) (*pb.BundleInfo, error) {
+	if req.GoodsId <= 0 || len(req.Components) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id or empty components")
+	}
+	
+	bundle := &entity.InventoryBundle{
+		ProductID:  req.GoodsId,
+		Name:       req.Name,
+		Operator:   req.Operator,
+		Components: make([]*entity.BundleComponent, 0, len(req.Components)),
+	}
+	for _, component := range req.Components {
+		bundle.Components = append(bundle.Components, &entity.BundleComponent{
+			ProductID: component.GoodsId,
+			SkuID:     component.SkuId,
+			Quantity:  int(component.Quantity),
+		})
+	}
+	
+	if err := s.bundleService.SaveBundle(ctx, bundle); err != nil {
+		s.logger.Error("Failed to save bundle",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Error(err))
+		return nil, toBundleStatus(err, "failed to save bundle")
+	}
+	
+	return toBundleInfo(bundle), nil
+}
+
+// GetBundle 获取套装定义
+func (s *InventoryServer) GetBundle(ctx context.Context, req *pb.BundleQuery) (*pb.BundleInfo, error) {
+	if req.GoodsId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id")
+	}
+	
+	bundle, err := s.bundleService.GetBundle(ctx, req.GoodsId)
+	if err != nil {
+		return nil, toBundleStatus(err, "failed to get bundle")
+	}
+	
+	return toBundleInfo(bundle), nil
+}
+
+// DeleteBundle 删除套装定义
+func (s *InventoryServer) DeleteBundle(ctx context.Context, req *pb.BundleQuery) (*emptypb.Empty, error) {
+	if req.GoodsId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid goods_id")
+	}
+	
+	if err := s.bundleService.DeleteBundle(ctx, req.GoodsId); err != nil {
+		s.logger.Error("Failed to delete bundle",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Error(err))
+		return nil, toBundleStatus(err, "failed to delete bundle")
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// toBundleStatus 将套装服务的错误转换为gRPC状态
+func toBundleStatus(err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrInvalidBundle):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrBundleNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrBundleHasInventory):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", message, err)
+}
+
+// toBundleInfo 将套装定义转换为proto格式
+func toBundleInfo(bundle *entity.InventoryBundle) *pb.BundleInfo {
+	info := &pb.BundleInfo{
+		GoodsId:    bundle.ProductID,
+		Name:       bundle.Name,
+		Operator:   bundle.Operator,
+		Components: make([]*pb.BundleComponent, 0, len(bundle.Components)),
+		UpdatedAt:  timestamppb.New(bundle.UpdatedAt),
+	}
+	for _, component := range bundle.Components {
+		info.Components = append(info.Components, &pb.BundleComponent{
+			GoodsId:  component.ProductID,
+			SkuId:    component.SkuID,
+			Quantity: int32(component.Quantity),
+		})
+	}
+	return info
+}
+
+// toChannelStatus 将渠道分配服务的错误转换为gRPC状态
+func toChannelStatus(err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrInvalidChannel):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrStockNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrInsufficientStock), errors.Is(err, service.ErrAllocationBelowLocked):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", message, err)
+}
+
+// toChannelAllocationInfo 将渠道分配转换为proto格式
+func toChannelAllocationInfo(allocation *entity.InventoryChannelAllocation) *pb.ChannelAllocationInfo {
+	return &pb.ChannelAllocationInfo{
+		GoodsId:     allocation.ProductID,
+		SkuId:       allocation.SkuID,
+		WarehouseId: int32(allocation.WarehouseID),
+		Channel:     allocation.Channel,
+		Allocated:   int32(allocation.Allocated),
+		LockStock:   int32(allocation.LockStock),
+		Remaining:   int32(allocation.Remaining()),
+	}
+}
+
 // Lock 锁定商品库存
 func (s *InventoryServer) Lock(ctx context.Context, req *pb.SellInfo) (*pb.LockResponse, error) {
 	if req.OrderSn == "" || len(req.GoodsList) == 0 {
@@ -206,23 +847,28 @@ func (s *InventoryServer) Lock(ctx context.Context, req *pb.SellInfo) (*pb.LockR
 	}
 	
 	// 转换请求为服务层需要的格式
-	lockItems := make([]service.LockItem, 0, len(req.GoodsList))
-	for _, item := range req.GoodsList {
-		lockItems = append(lockItems, service.LockItem{
-			ProductID: item.GoodsId,
-			Quantity:  int(item.Quantity),
-		})
-	}
+	lockItems := toLockItems(req.GoodsList)
 	
-	// 设置默认超时时间
-	timeoutSeconds := 30 * 60 // 默认30分钟
-	if req.TimeoutSeconds > 0 {
-		timeoutSeconds = int(req.TimeoutSeconds)
+	opts := service.LockOptions{
+		Strategy: toAllocationStrategy(req.Strategy),
+		Address: service.DeliveryAddress{
+			Detail:     req.GetAddress().GetDetail(),
+			Latitude:   req.GetAddress().GetLatitude(),
+			Longitude:  req.GetAddress().GetLongitude(),
+			RegionCode: req.GetAddress().GetRegionCode(),
+		},
+		AllowPartial:         req.AllowPartial,
+		AllowPartialQuantity: req.AllowPartialQuantity,
+		Channel:              req.Channel,
+		AllowBackorder:       req.AllowBackorder,
 	}
 	
-	// 调用锁定库存服务
-	result, err := s.inventoryLockService.LockInventory(ctx, req.OrderSn, lockItems, timeoutSeconds)
+	// 调用锁定库存服务，未指定超时时间时由服务层使用配置的默认值
+	result, err := s.inventoryLockService.LockInventory(ctx, req.OrderSn, lockItems, int(req.TimeoutSeconds), opts)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidChannel) {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
 		s.logger.Error("Failed to lock inventory",
 			zap.String("order_sn", req.OrderSn),
 			zap.Any("items", lockItems),
@@ -236,12 +882,7 @@ func (s *InventoryServer) Lock(ctx context.Context, req *pb.SellInfo) (*pb.LockR
 		
 		if result != nil && len(result.FailItems) > 0 {
 			for _, item := range result.FailItems {
-				response.FailItems = append(response.FailItems, &pb.LockFailItem{
-					GoodsId:   item.ProductID,
-					Quantity:  int32(item.Quantity),
-					Available: int32(item.Available),
-					Reason:    item.Reason,
-				})
+				response.FailItems = append(response.FailItems, toPbLockFailItem(item))
 			}
 		}
 		
@@ -254,17 +895,43 @@ func (s *InventoryServer) Lock(ctx context.Context, req *pb.SellInfo) (*pb.LockR
 		Message: "Lock inventory success",
 	}
 	
-	// 如果有失败项（部分成功）
+	// 如果有失败项（库存不足或分配失败），部分锁定成功时仍返回成功
 	if result != nil && len(result.FailItems) > 0 {
-		response.Success = false
-		response.Message = "Partially locked inventory"
+		response.Success = result.Success && result.Partial
+		response.Partial = response.Success
+		response.Message = result.Message
 		
 		for _, item := range result.FailItems {
-			response.FailItems = append(response.FailItems, &pb.LockFailItem{
-				GoodsId:   item.ProductID,
-				Quantity:  int32(item.Quantity),
-				Available: int32(item.Available),
-				Reason:    item.Reason,
+			response.FailItems = append(response.FailItems, toPbLockFailItem(item))
+		}
+	}
+	
+	// 返回实际锁定和排队预订的仓库分配及每个商品的锁定数量
+	if result != nil {
+		for _, allocation := range result.Allocations {
+			response.Allocations = append(response.Allocations, &pb.GoodsSellInfo{
+				GoodsId:     allocation.ProductID,
+				SkuId:       allocation.SkuID,
+				Quantity:    int32(allocation.Quantity),
+				WarehouseId: int32(allocation.WarehouseID),
+				BundleId:    allocation.BundleID,
+			})
+		}
+		for _, backorder := range result.Backorders {
+			response.Backorders = append(response.Backorders, &pb.GoodsSellInfo{
+				GoodsId:     backorder.ProductID,
+				SkuId:       backorder.SkuID,
+				Quantity:    int32(backorder.Quantity),
+				WarehouseId: int32(backorder.WarehouseID),
+			})
+		}
+		for _, line := range result.Lines {
+			response.Items = append(response.Items, &pb.LockedItem{
+				GoodsId:     line.ProductID,
+				SkuId:       line.SkuID,
+				Requested:   int32(line.Requested),
+				Locked:      int32(line.Locked),
+				Backordered: int32(line.Backordered),
 			})
 		}
 	}
@@ -272,44 +939,117 @@ func (s *InventoryServer) Lock(ctx context.Context, req *pb.SellInfo) (*pb.LockR
 	return response, nil
 }
 
-// Sell 确认销售并扣减库存
+// toPbLockFailItem 将锁定失败项转换为proto格式
+func toPbLockFailItem(item *service.LockFailItem) *pb.LockFailItem {
+	return &pb.LockFailItem{
+		GoodsId:       item.ProductID,
+		SkuId:         item.SkuID,
+		Quantity:      int32(item.Quantity),
+		Available:     int32(item.Available),
+		Reason:        item.Reason,
+		Code:          toLockFailCode(item.Code),
+		Backorderable: int32(item.Backorderable),
+	}
+}
+
+// toLockFailCode 将锁定失败原因转换为proto格式
+func toLockFailCode(code valueobject.LockFailCode) pb.LockFailCode {
+	switch code {
+	case valueobject.LockFailInsufficientStock:
+		return pb.LockFailCode_LOCK_FAIL_INSUFFICIENT_STOCK
+	case valueobject.LockFailInventoryNotFound:
+		return pb.LockFailCode_LOCK_FAIL_INVENTORY_NOT_FOUND
+	case valueobject.LockFailBackorderLimit:
+		return pb.LockFailCode_LOCK_FAIL_BACKORDER_LIMIT
+	case valueobject.LockFailConcurrentUpdate:
+		return pb.LockFailCode_LOCK_FAIL_CONCURRENT_UPDATE
+	default:
+		return pb.LockFailCode_LOCK_FAIL_UNSPECIFIED
+	}
+}
+
+// toAllocationStrategy 将proto分配策略转换为服务层策略名称
+func toAllocationStrategy(strategy pb.AllocationStrategy) string {
+	switch strategy {
+	case pb.AllocationStrategy_ALLOCATION_DEFAULT:
+		return service.AllocationDefault
+	case pb.AllocationStrategy_ALLOCATION_NEAREST:
+		return service.AllocationNearest
+	case pb.AllocationStrategy_ALLOCATION_MOST_STOCK:
+		return service.AllocationMostStock
+	case pb.AllocationStrategy_ALLOCATION_SPLIT:
+		return service.AllocationSplit
+	default:
+		return ""
+	}
+}
+
+// Sell 确认销售并扣减库存，goods_list为空时扣减整单锁定的数量，否则只扣减指定商品的数量，用于拆单发货
 func (s *InventoryServer) Sell(ctx context.Context, req *pb.SellInfo) (*emptypb.Empty, error) {
 	if req.OrderSn == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid order_sn")
 	}
 	
-	err := s.inventoryLockService.ConfirmReduce(ctx, req.OrderSn)
+	err := s.inventoryLockService.ConfirmReduce(ctx, req.OrderSn, toLockItems(req.GoodsList))
 	if err != nil {
 		s.logger.Error("Failed to confirm inventory reduction",
 			zap.String("order_sn", req.OrderSn),
 			zap.Error(err))
-		return nil, status.Errorf(codes.Internal, "failed to confirm inventory reduction: %v", err)
+		return nil, settleError(err, "failed to confirm inventory reduction")
 	}
 	
 	return &emptypb.Empty{}, nil
 }
 
-// Reback 归还库存
+// Reback 归还库存，goods_list为空时归还整单剩余的锁定，否则只归还指定商品的数量，用于部分取消
 func (s *InventoryServer) Reback(ctx context.Context, req *pb.SellInfo) (*emptypb.Empty, error) {
 	if req.OrderSn == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid order_sn")
 	}
 	
-	err := s.inventoryLockService.UnlockInventory(ctx, req.OrderSn)
+	err := s.inventoryLockService.UnlockInventory(ctx, req.OrderSn, toLockItems(req.GoodsList))
 	if err != nil {
 		s.logger.Error("Failed to unlock inventory",
 			zap.String("order_sn", req.OrderSn),
 			zap.Error(err))
-		return nil, status.Errorf(codes.Internal, "failed to unlock inventory: %v", err)
+		return nil, settleError(err, "failed to unlock inventory")
 	}
 	
 	return &emptypb.Empty{}, nil
 }
 
-// GetReservationStatus 查询库存预定状态
-func (s *InventoryServer) GetReservationStatus(ctx context.Context, req *pb.OrderSn) (*pb.ReservationStatus, error) {
-	if req.OrderSn == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid order_sn")
+// toLockItems 将proto商品列表转换为服务层锁定项目
+func toLockItems(goodsList []*pb.GoodsSellInfo) []service.LockItem {
+	items := make([]service.LockItem, 0, len(goodsList))
+	for _, item := range goodsList {
+		items = append(items, service.LockItem{
+			ProductID:   item.GoodsId,
+			SkuID:       item.SkuId,
+			Quantity:    int(item.Quantity),
+			WarehouseID: int(item.WarehouseId),
+		})
+	}
+	return items
+}
+
+// settleError 将扣减或归还的服务层错误转换为gRPC状态
+func settleError(err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrExceedLocked):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrLockNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrLockSettled):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", message, err)
+	}
+}
+
+// GetReservationStatus 查询库存预定状态
+func (s *InventoryServer) GetReservationStatus(ctx context.Context, req *pb.OrderSn) (*pb.ReservationStatus, error) {
+	if req.OrderSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid order_sn")
 	}
 	
 	detail, err := s.inventoryLockService.GetLockDetail(ctx, req.OrderSn)
@@ -323,25 +1063,30 @@ func (s *InventoryServer) GetReservationStatus(ctx context.Context, req *pb.Orde
 		return nil, status.Errorf(codes.Internal, "failed to get reservation status: %v", err)
 	}
 	
-	// 转换状态
-	pbStatus := pb.ReservationStatus_UNKNOWN
-	switch detail.Status {
-	case entity.StockLocked:
-		pbStatus = pb.ReservationStatus_LOCKED
-	case entity.StockReduced:
-		pbStatus = pb.ReservationStatus_REDUCED
-	case entity.StockReturned:
-		pbStatus = pb.ReservationStatus_RETURNED
-	}
-	
-	// 提取商品明细
+	// 提取商品明细及每行的处理状态
 	goodsList := make([]*pb.GoodsSellInfo, 0)
+	lines := make([]*pb.ReservationLine, 0, len(detail.DetailItems))
 	if len(detail.DetailItems) > 0 {
 		for _, item := range detail.DetailItems {
 			goodsList = append(goodsList, &pb.GoodsSellInfo{
 				GoodsId:     item.ProductID,
+				SkuId:       item.SkuID,
 				Quantity:    int32(item.Quantity),
 				WarehouseId: int32(item.WarehouseID),
+				BundleId:    item.BundleID,
+			})
+			lines = append(lines, &pb.ReservationLine{
+				GoodsId:     item.ProductID,
+				SkuId:       item.SkuID,
+				WarehouseId: int32(item.WarehouseID),
+				Quantity:    int32(item.Quantity),
+				Locked:      int32(item.Remaining()),
+				Reduced:     int32(item.Reduced),
+				Returned:    int32(item.Returned),
+				Status:      toReservationStatus(item.LineStatus()),
+				LotNo:       item.LotNo,
+				ExpiryDate:  toTimestamp(item.ExpiryDate),
+				BundleId:    item.BundleID,
 			})
 		}
 	}
@@ -356,13 +1101,31 @@ func (s *InventoryServer) GetReservationStatus(ctx context.Context, req *pb.Orde
 	}
 	
 	return &pb.ReservationStatus{
-		Status:      pbStatus,
+		Status:      toReservationStatus(detail.Status),
 		LockTime:    lockTime,
 		ConfirmTime: confirmTime,
 		GoodsList:   goodsList,
+		Lines:       lines,
+		Backordered: int32(detail.Backordered),
 	}, nil
 }
 
+// toReservationStatus 将锁定状态转换为proto预定状态
+func toReservationStatus(stockStatus entity.StockStatus) pb.ReservationStatus_Status {
+	switch stockStatus {
+	case entity.StockLocked:
+		return pb.ReservationStatus_LOCKED
+	case entity.StockReduced:
+		return pb.ReservationStatus_REDUCED
+	case entity.StockReturned:
+		return pb.ReservationStatus_RETURNED
+	case entity.StockSettled:
+		return pb.ReservationStatus_SETTLED
+	default:
+		return pb.ReservationStatus_UNKNOWN
+	}
+}
+
 // CreateWarehouse 创建仓库
 func (s *InventoryServer) CreateWarehouse(ctx context.Context, req *pb.WarehouseInfo) (*pb.WarehouseInfo, error) {
 	if req.Name == "" || req.Address == "" {
@@ -371,12 +1134,18 @@ func (s *InventoryServer) CreateWarehouse(ctx context.Context, req *pb.Warehouse
 	
 	// 转换为实体
 	warehouse := &entity.Warehouse{
-		Name:    req.Name,
-		Address: req.Address,
-		Contact: req.Contact,
-		Phone:   req.Phone,
-		Status:  int8(req.Status),
+		Name:         req.Name,
+		Address:      req.Address,
+		Contact:      req.Contact,
+		Phone:        req.Phone,
+		Status:       int8(req.Status),
+		RegionCode:   req.RegionCode,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Capacity:     int(req.Capacity),
+		Capabilities: toWarehouseCapabilities(req.Capabilities),
 	}
+	warehouse.SetServedRegions(req.ServedRegions)
 	
 	// 创建仓库
 	err := s.warehouseService.CreateWarehouse(ctx, warehouse)
@@ -384,6 +1153,9 @@ func (s *InventoryServer) CreateWarehouse(ctx context.Context, req *pb.Warehouse
 		if errors.Is(err, service.ErrWarehouseNameExists) {
 			return nil, status.Errorf(codes.AlreadyExists, "warehouse with this name already exists")
 		}
+		if errors.Is(err, service.ErrInvalidArgument) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid coordinates, capacity or capabilities")
+		}
 		s.logger.Error("Failed to create warehouse", 
 			zap.String("name", req.Name),
 			zap.Error(err))
@@ -391,16 +1163,7 @@ func (s *InventoryServer) CreateWarehouse(ctx context.Context, req *pb.Warehouse
 	}
 	
 	// 返回创建后的仓库信息
-	return &pb.WarehouseInfo{
-		Id:        int32(warehouse.ID),
-		Name:      warehouse.Name,
-		Address:   warehouse.Address,
-		Contact:   warehouse.Contact,
-		Phone:     warehouse.Phone,
-		Status:    int32(warehouse.Status),
-		CreatedAt: timestamppb.New(warehouse.CreatedAt),
-		UpdatedAt: timestamppb.New(warehouse.UpdatedAt),
-	}, nil
+	return toWarehouseInfo(warehouse), nil
 }
 
 // UpdateWarehouse 更新仓库
@@ -437,6 +1200,22 @@ func (s *InventoryServer) UpdateWarehouse(ctx context.Context, req *pb.Warehouse
 	if req.Status != 0 {
 		existingWarehouse.Status = int8(req.Status)
 	}
+	if req.RegionCode != "" {
+		existingWarehouse.RegionCode = req.RegionCode
+	}
+	if req.Latitude != 0 || req.Longitude != 0 {
+		existingWarehouse.Latitude = req.Latitude
+		existingWarehouse.Longitude = req.Longitude
+	}
+	if len(req.ServedRegions) > 0 {
+		existingWarehouse.SetServedRegions(req.ServedRegions)
+	}
+	if req.Capacity != 0 {
+		existingWarehouse.Capacity = int(req.Capacity)
+	}
+	if len(req.Capabilities) > 0 {
+		existingWarehouse.Capabilities = toWarehouseCapabilities(req.Capabilities)
+	}
 	
 	// 更新仓库
 	err = s.warehouseService.UpdateWarehouse(ctx, existingWarehouse)
@@ -444,6 +1223,9 @@ func (s *InventoryServer) UpdateWarehouse(ctx context.Context, req *pb.Warehouse
 		if errors.Is(err, service.ErrWarehouseNameExists) {
 			return nil, status.Errorf(codes.AlreadyExists, "warehouse with this name already exists")
 		}
+		if errors.Is(err, service.ErrInvalidArgument) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid coordinates, capacity or capabilities")
+		}
 		s.logger.Error("Failed to update warehouse", 
 			zap.Int32("id", req.Id),
 			zap.Error(err))
@@ -462,8 +1244,18 @@ func (s *InventoryServer) GetWarehouseList(ctx context.Context, req *pb.Warehous
 		req.PageSize = 10
 	}
 	
+	filter := &repository.WarehouseFilter{
+		Keyword:      strings.TrimSpace(req.Keyword),
+		RegionCode:   req.RegionCode,
+		Capabilities: toWarehouseCapabilities(req.Capabilities),
+	}
+	if req.Status != nil && *req.Status >= 0 {
+		warehouseStatus := int8(*req.Status)
+		filter.Status = &warehouseStatus
+	}
+	
 	// 获取仓库列表
-	warehouses, total, err := s.warehouseService.ListWarehouses(ctx, int(req.Page), int(req.PageSize))
+	warehouses, total, err := s.warehouseService.ListWarehouses(ctx, filter, int(req.Page), int(req.PageSize))
 	if err != nil {
 		s.logger.Error("Failed to get warehouse list", zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "failed to get warehouse list: %v", err)
@@ -476,16 +1268,7 @@ func (s *InventoryServer) GetWarehouseList(ctx context.Context, req *pb.Warehous
 	}
 	
 	for _, warehouse := range warehouses {
-		response.Warehouses = append(response.Warehouses, &pb.WarehouseInfo{
-			Id:        int32(warehouse.ID),
-			Name:      warehouse.Name,
-			Address:   warehouse.Address,
-			Contact:   warehouse.Contact,
-			Phone:     warehouse.Phone,
-			Status:    int32(warehouse.Status),
-			CreatedAt: timestamppb.New(warehouse.CreatedAt),
-			UpdatedAt: timestamppb.New(warehouse.UpdatedAt),
-		})
+		response.Warehouses = append(response.Warehouses, toWarehouseInfo(warehouse))
 	}
 	
 	return response, nil
@@ -508,16 +1291,7 @@ func (s *InventoryServer) GetWarehouseDetail(ctx context.Context, req *pb.Wareho
 		return nil, status.Errorf(codes.Internal, "failed to get warehouse detail: %v", err)
 	}
 	
-	return &pb.WarehouseInfo{
-		Id:        int32(warehouse.ID),
-		Name:      warehouse.Name,
-		Address:   warehouse.Address,
-		Contact:   warehouse.Contact,
-		Phone:     warehouse.Phone,
-		Status:    int32(warehouse.Status),
-		CreatedAt: timestamppb.New(warehouse.CreatedAt),
-		UpdatedAt: timestamppb.New(warehouse.UpdatedAt),
-	}, nil
+	return toWarehouseInfo(warehouse), nil
 }
 
 // DeleteWarehouse 删除仓库
@@ -531,6 +1305,9 @@ func (s *InventoryServer) DeleteWarehouse(ctx context.Context, req *pb.Warehouse
 		if errors.Is(err, service.ErrWarehouseNotFound) {
 			return nil, status.Errorf(codes.NotFound, "warehouse not found")
 		}
+		if errors.Is(err, service.ErrWarehouseNotEmpty) {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
 		s.logger.Error("Failed to delete warehouse", 
 			zap.Int32("id", req.Id),
 			zap.Error(err))
@@ -539,3 +1316,727 @@ func (s *InventoryServer) DeleteWarehouse(ctx context.Context, req *pb.Warehouse
 	
 	return &emptypb.Empty{}, nil
 }
+
+// warehouseCapabilities proto作业能力与实体作业能力的对应关系
+var warehouseCapabilities = map[pb.WarehouseCapability]entity.WarehouseCapability{
+	pb.WarehouseCapability_CAPABILITY_COLD_CHAIN:  entity.CapabilityColdChain,
+	pb.WarehouseCapability_CAPABILITY_HAZMAT:      entity.CapabilityHazmat,
+	pb.WarehouseCapability_CAPABILITY_BONDED:      entity.CapabilityBonded,
+	pb.WarehouseCapability_CAPABILITY_SELF_PICKUP: entity.CapabilitySelfPickup,
+}
+
+// toWarehouseCapabilities 将proto作业能力列表合并为按位组合的作业能力，忽略未知的值
+func toWarehouseCapabilities(capabilities []pb.WarehouseCapability) entity.WarehouseCapability {
+	var result entity.WarehouseCapability
+	for _, capability := range capabilities {
+		result |= warehouseCapabilities[capability]
+	}
+	return result
+}
+
+// toWarehouseInfo 将仓库转换为proto格式
+func toWarehouseInfo(warehouse *entity.Warehouse) *pb.WarehouseInfo {
+	info := &pb.WarehouseInfo{
+		Id:            int32(warehouse.ID),
+		Name:          warehouse.Name,
+		Address:       warehouse.Address,
+		Contact:       warehouse.Contact,
+		Phone:         warehouse.Phone,
+		Status:        int32(warehouse.Status),
+		CreatedAt:     timestamppb.New(warehouse.CreatedAt),
+		UpdatedAt:     timestamppb.New(warehouse.UpdatedAt),
+		RegionCode:    warehouse.RegionCode,
+		Latitude:      warehouse.Latitude,
+		Longitude:     warehouse.Longitude,
+		ServedRegions: warehouse.ServedRegionList(),
+		Capacity:      int32(warehouse.Capacity),
+	}
+	for _, capability := range []pb.WarehouseCapability{
+		pb.WarehouseCapability_CAPABILITY_COLD_CHAIN,
+		pb.WarehouseCapability_CAPABILITY_HAZMAT,
+		pb.WarehouseCapability_CAPABILITY_BONDED,
+		pb.WarehouseCapability_CAPABILITY_SELF_PICKUP,
+	} {
+		if warehouse.HasCapabilities(warehouseCapabilities[capability]) {
+			info.Capabilities = append(info.Capabilities, capability)
+		}
+	}
+	return info
+}
+
+// CreateTransfer 创建调拨单
+func (s *InventoryServer) CreateTransfer(ctx context.Context, req *pb.TransferInfo) (*pb.TransferInfo, error) {
+	if req.FromWarehouseId <= 0 || req.ToWarehouseId <= 0 || len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid warehouse id or empty items")
+	}
+	
+	// 转换为实体
+	order := &entity.TransferOrder{
+		TransferSN:      req.TransferSn,
+		FromWarehouseID: int(req.FromWarehouseId),
+		ToWarehouseID:   int(req.ToWarehouseId),
+		Operator:        req.Operator,
+		Remark:          req.Remark,
+		Items:           make([]*entity.TransferItem, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		order.Items = append(order.Items, &entity.TransferItem{
+			ProductID: item.GoodsId,
+			SkuID:     item.SkuId,
+			Quantity:  int(item.Quantity),
+		})
+	}
+	
+	if err := s.transferService.CreateTransfer(ctx, order); err != nil {
+		s.logger.Error("Failed to create transfer",
+			zap.Int32("from_warehouse_id", req.FromWarehouseId),
+			zap.Int32("to_warehouse_id", req.ToWarehouseId),
+			zap.Error(err))
+		return nil, transferError(err)
+	}
+	
+	return toTransferInfo(order), nil
+}
+
+// ShipTransfer 调拨发货
+func (s *InventoryServer) ShipTransfer(ctx context.Context, req *pb.TransferAction) (*pb.TransferInfo, error) {
+	if req.TransferSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transfer_sn")
+	}
+	
+	order, err := s.transferService.ShipTransfer(ctx, req.TransferSn, req.Operator)
+	if err != nil {
+		s.logger.Error("Failed to ship transfer",
+			zap.String("transfer_sn", req.TransferSn),
+			zap.Error(err))
+		return nil, transferError(err)
+	}
+	
+	return toTransferInfo(order), nil
+}
+
+// ReceiveTransfer 调拨收货
+func (s *InventoryServer) ReceiveTransfer(ctx context.Context, req *pb.TransferAction) (*pb.TransferInfo, error) {
+	if req.TransferSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transfer_sn")
+	}
+	
+	order, err := s.transferService.ReceiveTransfer(ctx, req.TransferSn, req.Operator)
+	if err != nil {
+		s.logger.Error("Failed to receive transfer",
+			zap.String("transfer_sn", req.TransferSn),
+			zap.Error(err))
+		return nil, transferError(err)
+	}
+	
+	return toTransferInfo(order), nil
+}
+
+// CancelTransfer 取消调拨
+func (s *InventoryServer) CancelTransfer(ctx context.Context, req *pb.TransferAction) (*pb.TransferInfo, error) {
+	if req.TransferSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transfer_sn")
+	}
+	
+	order, err := s.transferService.CancelTransfer(ctx, req.TransferSn, req.Operator, req.Remark)
+	if err != nil {
+		s.logger.Error("Failed to cancel transfer",
+			zap.String("transfer_sn", req.TransferSn),
+			zap.Error(err))
+		return nil, transferError(err)
+	}
+	
+	return toTransferInfo(order), nil
+}
+
+// transferError 将调拨服务错误转换为gRPC状态
+func transferError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrSameWarehouse):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrTransferNotFound), errors.Is(err, service.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrInvalidTransferStatus), errors.Is(err, service.ErrWarehouseInactive),
+		errors.Is(err, service.ErrInsufficientStock):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "transfer operation failed: %v", err)
+	}
+}
+
+// toTransferInfo 将调拨单实体转换为proto格式
+func toTransferInfo(order *entity.TransferOrder) *pb.TransferInfo {
+	info := &pb.TransferInfo{
+		Id:              order.ID,
+		TransferSn:      order.TransferSN,
+		FromWarehouseId: int32(order.FromWarehouseID),
+		ToWarehouseId:   int32(order.ToWarehouseID),
+		Status:          pb.TransferInfo_Status(order.Status),
+		Operator:        order.Operator,
+		Remark:          order.Remark,
+		CreatedAt:       timestamppb.New(order.CreatedAt),
+		Items:           make([]*pb.TransferItem, 0, len(order.Items)),
+	}
+	
+	for _, item := range order.Items {
+		info.Items = append(info.Items, &pb.TransferItem{
+			GoodsId:  item.ProductID,
+			SkuId:    item.SkuID,
+			Quantity: int32(item.Quantity),
+		})
+	}
+	
+	if order.ShipTime != nil {
+		info.ShipTime = timestamppb.New(*order.ShipTime)
+	}
+	if order.ReceiveTime != nil {
+		info.ReceiveTime = timestamppb.New(*order.ReceiveTime)
+	}
+	if order.CancelTime != nil {
+		info.CancelTime = timestamppb.New(*order.CancelTime)
+	}
+	
+	return info
+}
+
+// CreateInbound 创建采购入库单
+func (s *InventoryServer) CreateInbound(ctx context.Context, req *pb.InboundInfo) (*pb.InboundInfo, error) {
+	if req.WarehouseId <= 0 || len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid warehouse id or empty items")
+	}
+	
+	// 转换为实体
+	order := &entity.InboundOrder{
+		InboundSN:     req.InboundSn,
+		WarehouseID:   int(req.WarehouseId),
+		SupplierName:  req.SupplierName,
+		SupplierDocNo: req.SupplierDocNo,
+		Operator:      req.Operator,
+		Remark:        req.Remark,
+		Items:         make([]*entity.InboundItem, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		order.Items = append(order.Items, &entity.InboundItem{
+			ProductID: item.GoodsId,
+			SkuID:     item.SkuId,
+			Expected:  int(item.Expected),
+		})
+	}
+	
+	if err := s.inboundService.CreateInbound(ctx, order); err != nil {
+		s.logger.Error("Failed to create inbound",
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.String("supplier_doc_no", req.SupplierDocNo),
+			zap.Error(err))
+		return nil, inboundError(err)
+	}
+	
+	return toInboundInfo(order, nil), nil
+}
+
+// ReceiveInbound 入库单收货，收货数量入账后返回最新的入库单
+func (s *InventoryServer) ReceiveInbound(ctx context.Context, req *pb.InboundReceiptInfo) (*pb.InboundInfo, error) {
+	if req.InboundSn == "" || len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid inbound_sn or empty items")
+	}
+	
+	receipt := &entity.InboundReceipt{
+		ReceiptSN: req.ReceiptSn,
+		InboundSN: req.InboundSn,
+		Operator:  req.Operator,
+		Remark:    req.Remark,
+		Items:     make([]*entity.ReceiptItem, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		receipt.Items = append(receipt.Items, &entity.ReceiptItem{
+			ProductID:  item.GoodsId,
+			SkuID:      item.SkuId,
+			Quantity:   int(item.Quantity),
+			LotNo:      item.LotNo,
+			ExpiryDate: toTimePtr(item.ExpiryDate),
+		})
+	}
+	
+	order, err := s.inboundService.ReceiveInbound(ctx, receipt)
+	if err != nil {
+		s.logger.Error("Failed to receive inbound",
+			zap.String("inbound_sn", req.InboundSn),
+			zap.String("receipt_sn", receipt.ReceiptSN),
+			zap.Error(err))
+		return nil, inboundError(err)
+	}
+	
+	return s.inboundInfoWithReceipts(ctx, order)
+}
+
+// CloseInbound 关闭入库单
+func (s *InventoryServer) CloseInbound(ctx context.Context, req *pb.InboundAction) (*pb.InboundInfo, error) {
+	if req.InboundSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid inbound_sn")
+	}
+	
+	order, err := s.inboundService.CloseInbound(ctx, req.InboundSn, req.Operator, req.Remark)
+	if err != nil {
+		s.logger.Error("Failed to close inbound",
+			zap.String("inbound_sn", req.InboundSn),
+			zap.Error(err))
+		return nil, inboundError(err)
+	}
+	
+	return s.inboundInfoWithReceipts(ctx, order)
+}
+
+// GetInbound 获取入库单及收货记录
+func (s *InventoryServer) GetInbound(ctx context.Context, req *pb.InboundAction) (*pb.InboundInfo, error) {
+	if req.InboundSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid inbound_sn")
+	}
+	
+	order, err := s.inboundService.GetInbound(ctx, req.InboundSn)
+	if err != nil {
+		return nil, inboundError(err)
+	}
+	
+	return s.inboundInfoWithReceipts(ctx, order)
+}
+
+// inboundInfoWithReceipts 查询入库单的收货记录并转换为proto格式
+func (s *InventoryServer) inboundInfoWithReceipts(ctx context.Context, order *entity.InboundOrder) (*pb.InboundInfo, error) {
+	receipts, err := s.inboundService.ListReceipts(ctx, order.InboundSN)
+	if err != nil {
+		return nil, inboundError(err)
+	}
+	
+	return toInboundInfo(order, receipts), nil
+}
+
+// inboundError 将采购入库服务错误转换为gRPC状态
+func inboundError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrInboundItemNotFound):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrInboundNotFound), errors.Is(err, service.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrInvalidInboundStatus), errors.Is(err, service.ErrWarehouseInactive):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, service.ErrReceiptConflict):
+		return status.Errorf(codes.AlreadyExists, "%v", err)
+	case errors.Is(err, service.ErrReceiptPostFailed):
+		return status.Errorf(codes.Unavailable, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "inbound operation failed: %v", err)
+	}
+}
+
+// toInboundInfo 将入库单实体转换为proto格式
+func toInboundInfo(order *entity.InboundOrder, receipts []*entity.InboundReceipt) *pb.InboundInfo {
+	info := &pb.InboundInfo{
+		Id:            order.ID,
+		InboundSn:     order.InboundSN,
+		WarehouseId:   int32(order.WarehouseID),
+		SupplierName:  order.SupplierName,
+		SupplierDocNo: order.SupplierDocNo,
+		Status:        pb.InboundInfo_Status(order.Status),
+		Operator:      order.Operator,
+		Remark:        order.Remark,
+		CreatedAt:     timestamppb.New(order.CreatedAt),
+		Items:         make([]*pb.InboundItem, 0, len(order.Items)),
+		Receipts:      make([]*pb.InboundReceiptInfo, 0, len(receipts)),
+	}
+	
+	for _, item := range order.Items {
+		info.Items = append(info.Items, &pb.InboundItem{
+			GoodsId:      item.ProductID,
+			SkuId:        item.SkuID,
+			Expected:     int32(item.Expected),
+			Received:     int32(item.Received),
+			OverReceived: int32(item.OverReceived()),
+		})
+	}
+	if order.CloseTime != nil {
+		info.CloseTime = timestamppb.New(*order.CloseTime)
+	}
+	
+	for _, receipt := range receipts {
+		receiptInfo := &pb.InboundReceiptInfo{
+			ReceiptSn: receipt.ReceiptSN,
+			InboundSn: receipt.InboundSN,
+			Operator:  receipt.Operator,
+			Remark:    receipt.Remark,
+			Posted:    receipt.Posted,
+			CreatedAt: timestamppb.New(receipt.CreatedAt),
+			Items:     make([]*pb.InboundReceiptItem, 0, len(receipt.Items)),
+		}
+		for _, item := range receipt.Items {
+			receiptInfo.Items = append(receiptInfo.Items, &pb.InboundReceiptItem{
+				GoodsId:    item.ProductID,
+				SkuId:      item.SkuID,
+				Quantity:   int32(item.Quantity),
+				Posted:     item.Posted,
+				LotNo:      item.LotNo,
+				ExpiryDate: toTimestamp(item.ExpiryDate),
+			})
+		}
+		if receipt.PostTime != nil {
+			receiptInfo.PostTime = timestamppb.New(*receipt.PostTime)
+		}
+		info.Receipts = append(info.Receipts, receiptInfo)
+	}
+	
+	return info
+}
+
+// OpenStocktake 创建盘点单
+func (s *InventoryServer) OpenStocktake(ctx context.Context, req *pb.StocktakeInfo) (*pb.StocktakeInfo, error) {
+	if req.WarehouseId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid warehouse_id")
+	}
+	
+	session := &entity.StocktakeSession{
+		SessionSN:   req.SessionSn,
+		WarehouseID: int(req.WarehouseId),
+		Operator:    req.Operator,
+		Remark:      req.Remark,
+	}
+	
+	if err := s.stocktakeService.OpenStocktake(ctx, session, req.GoodsIds); err != nil {
+		s.logger.Error("Failed to open stocktake",
+			zap.Int32("warehouse_id", req.WarehouseId),
+			zap.Error(err))
+		return nil, stocktakeError(err)
+	}
+	
+	return toStocktakeInfo(session), nil
+}
+
+// SubmitStocktakeCounts 录入实盘数量
+func (s *InventoryServer) SubmitStocktakeCounts(ctx context.Context, req *pb.StocktakeCounts) (*emptypb.Empty, error) {
+	if req.SessionSn == "" || len(req.Counts) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid session_sn or empty counts")
+	}
+	
+	counts := make(map[valueobject.SkuKey]int, len(req.Counts))
+	for _, count := range req.Counts {
+		counts[valueobject.SkuKey{ProductID: count.GoodsId, SkuID: count.SkuId}] = int(count.Quantity)
+	}
+	
+	if err := s.stocktakeService.SubmitCounts(ctx, req.SessionSn, counts, req.Counter); err != nil {
+		s.logger.Error("Failed to submit stocktake counts",
+			zap.String("session_sn", req.SessionSn),
+			zap.Error(err))
+		return nil, stocktakeError(err)
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// PreviewStocktake 预览盘点差异
+func (s *InventoryServer) PreviewStocktake(ctx context.Context, req *pb.StocktakeAction) (*pb.StocktakePreview, error) {
+	if req.SessionSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid session_sn")
+	}
+	
+	preview, err := s.stocktakeService.PreviewStocktake(ctx, req.SessionSn)
+	if err != nil {
+		s.logger.Error("Failed to preview stocktake",
+			zap.String("session_sn", req.SessionSn),
+			zap.Error(err))
+		return nil, stocktakeError(err)
+	}
+	
+	return toStocktakePreview(preview), nil
+}
+
+// CommitStocktake 提交盘点单，应用所有差异
+func (s *InventoryServer) CommitStocktake(ctx context.Context, req *pb.StocktakeAction) (*pb.StocktakePreview, error) {
+	if req.SessionSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid session_sn")
+	}
+	
+	preview, err := s.stocktakeService.CommitStocktake(ctx, req.SessionSn, req.Operator)
+	if err != nil {
+		s.logger.Error("Failed to commit stocktake",
+			zap.String("session_sn", req.SessionSn),
+			zap.Error(err))
+		return nil, stocktakeError(err)
+	}
+	
+	return toStocktakePreview(preview), nil
+}
+
+// CancelStocktake 取消盘点单
+func (s *InventoryServer) CancelStocktake(ctx context.Context, req *pb.StocktakeAction) (*pb.StocktakeInfo, error) {
+	if req.SessionSn == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid session_sn")
+	}
+	
+	session, err := s.stocktakeService.CancelStocktake(ctx, req.SessionSn, req.Operator)
+	if err != nil {
+		s.logger.Error("Failed to cancel stocktake",
+			zap.String("session_sn", req.SessionSn),
+			zap.Error(err))
+		return nil, stocktakeError(err)
+	}
+	
+	return toStocktakeInfo(session), nil
+}
+
+// stocktakeError 将盘点服务错误转换为gRPC状态
+func stocktakeError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrProductNotInStocktake):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrStocktakeNotFound), errors.Is(err, service.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "%v", err)
+	case errors.Is(err, service.ErrInvalidStocktakeStatus), errors.Is(err, service.ErrWarehouseInactive):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, service.ErrStocktakeConflict):
+		return status.Errorf(codes.Aborted, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "stocktake operation failed: %v", err)
+	}
+}
+
+// toStocktakeInfo 将盘点单实体转换为proto格式
+func toStocktakeInfo(session *entity.StocktakeSession) *pb.StocktakeInfo {
+	info := &pb.StocktakeInfo{
+		Id:          session.ID,
+		SessionSn:   session.SessionSN,
+		WarehouseId: int32(session.WarehouseID),
+		Status:      pb.StocktakeInfo_Status(session.Status),
+		Operator:    session.Operator,
+		Remark:      session.Remark,
+		CreatedAt:   timestamppb.New(session.CreatedAt),
+	}
+	
+	// 全仓盘点不返回商品范围，明细按商品排序，同一商品的多个SKU只返回一次
+	if !session.FullCount {
+		info.GoodsIds = make([]int64, 0, len(session.Items))
+		for _, item := range session.Items {
+			if n := len(info.GoodsIds); n > 0 && info.GoodsIds[n-1] == item.ProductID {
+				continue
+			}
+			info.GoodsIds = append(info.GoodsIds, item.ProductID)
+		}
+	}
+	
+	if session.CommitTime != nil {
+		info.CommitTime = timestamppb.New(*session.CommitTime)
+	}
+	if session.CancelTime != nil {
+		info.CancelTime = timestamppb.New(*session.CancelTime)
+	}
+	
+	return info
+}
+
+// toStocktakePreview 将盘点差异预览转换为proto格式
+func toStocktakePreview(preview *service.StocktakePreview) *pb.StocktakePreview {
+	resp := &pb.StocktakePreview{
+		Session:   toStocktakeInfo(preview.Session),
+		Items:     make([]*pb.StocktakeVariance, 0, len(preview.Items)),
+		TotalGain: int32(preview.TotalGain),
+		TotalLoss: int32(preview.TotalLoss),
+		Uncounted: int32(preview.Uncounted),
+	}
+	
+	for _, item := range preview.Items {
+		resp.Items = append(resp.Items, &pb.StocktakeVariance{
+			GoodsId:        item.ProductID,
+			SkuId:          item.SkuID,
+			Counted:        item.Counted,
+			BookStock:      int32(item.BookStock),
+			CountedStock:   int32(item.CountedStock),
+			Variance:       int32(item.Variance),
+			CurrentStock:   int32(item.CurrentStock),
+			ProjectedStock: int32(item.ProjectedStock),
+			LockedStock:    int32(item.LockedStock),
+			Conflict:       item.Conflict,
+		})
+	}
+	
+	return resp
+}
+
+// ListInventoryChanges 查询库存审计记录
+func (s *InventoryServer) ListInventoryChanges(ctx context.Context, req *pb.InventoryChangeQuery) (*pb.InventoryChangeResponse, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 20
+	}
+	
+	filter := &repository.InventoryChangeFilter{
+		ProductID:   req.GoodsId,
+		SkuID:       req.SkuId,
+		WarehouseID: int(req.WarehouseId),
+		OrderSN:     req.OrderSn,
+		Operation:   req.Operation,
+		FailedOnly:  req.FailedOnly,
+		StartTime:   toTime(req.StartTime),
+		EndTime:     toTime(req.EndTime),
+	}
+	
+	records, total, err := s.auditService.ListInventoryChanges(ctx, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		s.logger.Error("Failed to list inventory changes",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.String("order_sn", req.OrderSn),
+			zap.Error(err))
+		return nil, auditError(err)
+	}
+	
+	response := &pb.InventoryChangeResponse{
+		Total: total,
+		Items: make([]*pb.InventoryChangeRecord, 0, len(records)),
+	}
+	
+	for _, record := range records {
+		response.Items = append(response.Items, &pb.InventoryChangeRecord{
+			GoodsId:      record.ProductID,
+			SkuId:        record.SkuID,
+			WarehouseId:  record.WarehouseID,
+			OrderSn:      record.OrderSn,
+			Operation:    record.Operation,
+			Quantity:     record.Quantity,
+			BeforeStock:  record.BeforeStock,
+			AfterStock:   record.AfterStock,
+			BeforeLocked: record.BeforeLocked,
+			AfterLocked:  record.AfterLocked,
+			Operator:     record.Operator,
+			OperatorId:   record.OperatorID,
+			Reason:       record.Reason,
+			Success:      record.Success,
+			ErrorMessage: record.ErrorMessage,
+			Timestamp:    timestamppb.New(record.Timestamp),
+		})
+	}
+	
+	return response, nil
+}
+
+// GetInventoryActivitySummary 按商品和操作类型统计时间范围内的库存操作
+func (s *InventoryServer) GetInventoryActivitySummary(ctx context.Context, req *pb.ActivitySummaryQuery) (*pb.ActivitySummaryResponse, error) {
+	filter := &repository.InventoryChangeFilter{
+		ProductID:   req.GoodsId,
+		WarehouseID: int(req.WarehouseId),
+		Operation:   req.Operation,
+		StartTime:   toTime(req.StartTime),
+		EndTime:     toTime(req.EndTime),
+	}
+	
+	summaries, err := s.auditService.GetActivitySummary(ctx, filter)
+	if err != nil {
+		s.logger.Error("Failed to get inventory activity summary",
+			zap.Int64("goods_id", req.GoodsId),
+			zap.Error(err))
+		return nil, auditError(err)
+	}
+	
+	response := &pb.ActivitySummaryResponse{
+		Summaries: make([]*pb.ActivitySummary, 0, len(summaries)),
+	}
+	
+	for _, summary := range summaries {
+		response.Summaries = append(response.Summaries, &pb.ActivitySummary{
+			GoodsId:       summary.ProductID,
+			Operation:     summary.Operation,
+			Count:         int32(summary.Count),
+			FailedCount:   int32(summary.FailedCount),
+			TotalQuantity: int64(summary.TotalQuantity),
+			MaxQuantity:   int32(summary.MaxQuantity),
+			MinQuantity:   int32(summary.MinQuantity),
+			AvgQuantity:   summary.AvgQuantity,
+		})
+	}
+	
+	return response, nil
+}
+
+// auditError 将审计服务错误转换为gRPC状态
+func auditError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrInvalidTimeRange):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, service.ErrAuditDisabled):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	default:
+		return status.Errorf(codes.Internal, "audit query failed: %v", err)
+	}
+}
+
+// toTime 将proto时间转换为time.Time，未设置时返回零值
+func toTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// toTimePtr 将proto时间转换为可空的时间，未设置时返回nil
+func toTimePtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// toTimestamp 将可空的时间转换为proto时间
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// toGoodsInvInfo 将库存记录转换为proto格式
+func toGoodsInvInfo(inventory *entity.Inventory) *pb.GoodsInvInfo {
+	return &pb.GoodsInvInfo{
+		GoodsId:        inventory.ProductID,
+		SkuId:          inventory.SkuID,
+		Stock:          int32(inventory.Stock),
+		LockStock:      int32(inventory.LockStock),
+		WarehouseId:    int32(inventory.WarehouseID),
+		AlertThreshold: int32(inventory.AlertThreshold),
+		SafetyStock:    int32(inventory.SafetyStock),
+		ReservedStock:  int32(inventory.ReservedStock),
+		BackorderLimit: int32(inventory.BackorderLimit),
+		BackorderStock: int32(inventory.BackorderStock),
+		Bundle:         inventory.Bundle,
+	}
+}
+
+// toImportInventoryResponse 将导入报告转换为proto格式
+func toImportInventoryResponse(report *valueobject.InventoryImportReport) *pb.ImportInventoryResponse {
+	resp := &pb.ImportInventoryResponse{
+		TotalRows: int32(report.TotalRows),
+		Created:   int32(report.Created),
+		Updated:   int32(report.Updated),
+		Unchanged: int32(report.Unchanged),
+		Applied:   int32(report.Applied),
+		DryRun:    report.DryRun,
+		Errors:    make([]*pb.ImportRowError, 0, len(report.Errors)),
+		Diffs:     make([]*pb.InventoryDiff, 0, len(report.Diffs)),
+	}
+	for _, e := range report.Errors {
+		resp.Errors = append(resp.Errors, &pb.ImportRowError{
+			Line:    int32(e.Line),
+			Message: e.Message,
+		})
+	}
+	for _, d := range report.Diffs {
+		resp.Diffs = append(resp.Diffs, &pb.InventoryDiff{
+			GoodsId:           d.ProductID,
+			SkuId:             d.SkuID,
+			WarehouseId:       int32(d.WarehouseID),
+			OldStock:          int32(d.OldStock),
+			NewStock:          int32(d.NewStock),
+			OldAlertThreshold: int32(d.OldAlertThreshold),
+			NewAlertThreshold: int32(d.NewAlertThreshold),
+			Created:           d.Created,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,67 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"shop/backend/inventory/internal/domain/valueobject"
+)
+
+// 网关透传操作人信息使用的元数据键
+const (
+	OperatorIDMetadataKey   = "x-operator-id"
+	OperatorNameMetadataKey = "x-operator-name"
+)
+
+// OperatorInterceptor 从请求元数据中读取操作人并写入上下文，供审计日志记录
+func OperatorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withMetadataOperator(ctx), req)
+	}
+}
+
+// OperatorStreamInterceptor 流式请求的操作人拦截器，与OperatorInterceptor读取相同的元数据
+func OperatorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := withMetadataOperator(ss.Context())
+		if ctx == ss.Context() {
+			return handler(srv, ss)
+		}
+		return handler(srv, &operatorServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// operatorServerStream 替换上下文的服务端流
+type operatorServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 返回带操作人的上下文
+func (s *operatorServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// withMetadataOperator 读取元数据中的操作人写入上下文，没有操作人时返回原上下文
+func withMetadataOperator(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	var operator valueobject.Operator
+	if values := md.Get(OperatorIDMetadataKey); len(values) > 0 {
+		operator.ID, _ = strconv.ParseInt(values[0], 10, 64)
+	}
+	if values := md.Get(OperatorNameMetadataKey); len(values) > 0 {
+		operator.Name = values[0]
+	}
+	if operator.ID == 0 && operator.Name == "" {
+		return ctx
+	}
+
+	return valueobject.WithOperator(ctx, operator)
+}
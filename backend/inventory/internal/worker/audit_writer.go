@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+const (
+	// 默认审计记录缓冲区大小
+	defaultAuditBufferSize = 10000
+	// 默认每批写入的审计记录数量
+	defaultAuditBatchSize = 500
+	// 默认写入间隔
+	defaultAuditFlushInterval = time.Second
+	// 单批写入超时时间
+	auditWriteTimeout = 10 * time.Second
+)
+
+// AuditWriter 异步批量写入库存审计记录。缓冲区满时丢弃新记录，保证库存操作不被审计存储拖慢
+type AuditWriter struct {
+	repo          repository.AuditRepository
+	records       chan *entity.InventoryChangeRecord
+	batchSize     int
+	flushInterval time.Duration
+	logger        *zap.Logger
+}
+
+// NewAuditWriter 创建审计记录写入任务
+func NewAuditWriter(
+	repo repository.AuditRepository,
+	bufferSize int,
+	batchSize int,
+	flushInterval time.Duration,
+	logger *zap.Logger,
+) *AuditWriter {
+	if bufferSize <= 0 {
+		bufferSize = defaultAuditBufferSize
+	}
+	if batchSize <= 0 {
+		batchSize = defaultAuditBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultAuditFlushInterval
+	}
+
+	return &AuditWriter{
+		repo:          repo,
+		records:       make(chan *entity.InventoryChangeRecord, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        logger,
+	}
+}
+
+// Record 将审计记录放入缓冲区，不阻塞调用方
+func (w *AuditWriter) Record(record *entity.InventoryChangeRecord) {
+	select {
+	case w.records <- record:
+	default:
+		w.logger.Warn("Audit buffer is full, dropping inventory change record",
+			zap.Int64("product_id", record.ProductID),
+			zap.String("order_sn", record.OrderSn),
+			zap.String("operation", record.Operation),
+			zap.Bool("success", record.Success))
+	}
+}
+
+// Run 启动写入任务，直到ctx被取消。退出前写入缓冲区中剩余的记录
+func (w *AuditWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*entity.InventoryChangeRecord, 0, w.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			w.drain(batch)
+			return
+		case record := <-w.records:
+			batch = append(batch, record)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// drain 写入缓冲区中剩余的记录
+func (w *AuditWriter) drain(batch []*entity.InventoryChangeRecord) {
+	for {
+		select {
+		case record := <-w.records:
+			batch = append(batch, record)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		default:
+			if len(batch) > 0 {
+				w.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+// flush 写入一批记录，写入失败时记录日志后丢弃
+func (w *AuditWriter) flush(batch []*entity.InventoryChangeRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+
+	if err := w.repo.RecordInventoryChanges(ctx, batch); err != nil {
+		w.logger.Error("Failed to write inventory change records",
+			zap.Int("count", len(batch)),
+			zap.Error(err))
+	}
+}
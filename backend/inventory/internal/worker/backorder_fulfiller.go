@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/service"
+)
+
+const (
+	// 默认缺货预订分配间隔
+	defaultBackorderFulfillInterval = time.Minute
+	// 默认每批处理的库存记录数量
+	defaultBackorderFulfillBatchSize = 200
+)
+
+// BackorderFulfiller 缺货预订分配任务，定期将为排队预订保留的可用库存按排队顺序转为锁定。
+// 入库时会立即分配，解锁、调拨收货、盘盈以及入库时分配失败的数量由该任务分配
+type BackorderFulfiller struct {
+	backorderService service.BackorderService
+	elector          LeaderElector
+	interval         time.Duration
+	batchSize        int
+	logger           *zap.Logger
+}
+
+// NewBackorderFulfiller 创建缺货预订分配任务
+func NewBackorderFulfiller(
+	backorderService service.BackorderService,
+	elector LeaderElector,
+	interval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *BackorderFulfiller {
+	if interval <= 0 {
+		interval = defaultBackorderFulfillInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBackorderFulfillBatchSize
+	}
+
+	return &BackorderFulfiller{
+		backorderService: backorderService,
+		elector:          elector,
+		interval:         interval,
+		batchSize:        batchSize,
+		logger:           logger,
+	}
+}
+
+// Run 启动分配任务，直到ctx被取消
+func (f *BackorderFulfiller) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		// 退出时主动释放主节点身份，便于其他副本尽快接管
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := f.elector.Release(releaseCtx); err != nil {
+			f.logger.Warn("Failed to release backorder fulfiller leadership", zap.Error(err))
+		}
+	}()
+
+	f.fulfill(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.fulfill(ctx)
+		}
+	}
+}
+
+// fulfill 执行一轮分配
+func (f *BackorderFulfiller) fulfill(ctx context.Context) {
+	isLeader, err := f.elector.TryAcquire(ctx)
+	if err != nil {
+		f.logger.Warn("Failed to acquire backorder fulfiller leadership", zap.Error(err))
+		return
+	}
+	if !isLeader {
+		return
+	}
+
+	fulfilled, err := f.backorderService.FulfillQueued(ctx, f.batchSize)
+	if err != nil && ctx.Err() == nil {
+		f.logger.Error("Failed to fulfill queued backorders", zap.Error(err))
+	}
+	if fulfilled > 0 {
+		f.logger.Info("Queued backorders fulfilled", zap.Int("backorders", fulfilled))
+	}
+}
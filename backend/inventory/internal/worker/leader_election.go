@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// LeaderElector 主节点选举接口，多副本部署时保证后台任务只在一个实例上执行
+type LeaderElector interface {
+	// TryAcquire 尝试获取或续约主节点身份，返回当前实例是否为主节点
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release 主动释放主节点身份
+	Release(ctx context.Context) error
+}
+
+// 仅当租约仍属于当前实例时续约
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// 仅当租约仍属于当前实例时删除
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLeaderElector 基于Redis租约的主节点选举实现
+type RedisLeaderElector struct {
+	client     *redis.Client
+	key        string
+	instanceID string
+	ttl        time.Duration
+}
+
+// NewRedisLeaderElector 创建Redis主节点选举器
+func NewRedisLeaderElector(client *redis.Client, key, instanceID string, ttl time.Duration) LeaderElector {
+	return &RedisLeaderElector{
+		client:     client,
+		key:        key,
+		instanceID: instanceID,
+		ttl:        ttl,
+	}
+}
+
+// TryAcquire 尝试获取或续约租约
+func (e *RedisLeaderElector) TryAcquire(ctx context.Context) (bool, error) {
+	acquired, err := e.client.SetNX(ctx, e.key, e.instanceID, e.ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	if acquired {
+		return true, nil
+	}
+
+	// 租约已存在，若属于当前实例则续约
+	renewed, err := renewLeaseScript.Run(ctx, e.client, []string{e.key}, e.instanceID, e.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return renewed == 1, nil
+}
+
+// Release 释放租约
+func (e *RedisLeaderElector) Release(ctx context.Context) error {
+	return releaseLeaseScript.Run(ctx, e.client, []string{e.key}, e.instanceID).Err()
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/service"
+)
+
+const (
+	// 默认流水核对间隔
+	defaultLedgerReconcileInterval = 24 * time.Hour
+	// 修复差异时记录在库存历史中的操作人
+	ledgerReconcileOperator = "ledger-reconciler"
+)
+
+// LedgerReconciler 库存流水核对任务，定期核对库存记录与变更历史、锁定记录是否一致。
+// 历史记录写入失败不影响库存变更，长期运行后流水与库存可能出现偏差
+type LedgerReconciler struct {
+	ledgerService service.LedgerService
+	elector       LeaderElector
+	interval      time.Duration
+	batchSize     int
+	repair        bool
+	logger        *zap.Logger
+}
+
+// NewLedgerReconciler 创建流水核对任务，repair为false时只报告差异
+func NewLedgerReconciler(
+	ledgerService service.LedgerService,
+	elector LeaderElector,
+	interval time.Duration,
+	batchSize int,
+	repair bool,
+	logger *zap.Logger,
+) *LedgerReconciler {
+	if interval <= 0 {
+		interval = defaultLedgerReconcileInterval
+	}
+
+	return &LedgerReconciler{
+		ledgerService: ledgerService,
+		elector:       elector,
+		interval:      interval,
+		batchSize:     batchSize,
+		repair:        repair,
+		logger:        logger,
+	}
+}
+
+// Run 启动核对任务，直到ctx被取消
+func (c *LedgerReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		// 退出时主动释放主节点身份，便于其他副本尽快接管
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.elector.Release(releaseCtx); err != nil {
+			c.logger.Warn("Failed to release ledger reconciler leadership", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile 执行一轮核对
+func (c *LedgerReconciler) reconcile(ctx context.Context) {
+	isLeader, err := c.elector.TryAcquire(ctx)
+	if err != nil {
+		c.logger.Warn("Failed to acquire ledger reconciler leadership", zap.Error(err))
+		return
+	}
+	if !isLeader {
+		return
+	}
+
+	start := time.Now()
+	report, err := c.ledgerService.Reconcile(ctx, c.repair, ledgerReconcileOperator, c.batchSize)
+	if err != nil {
+		c.logger.Error("Failed to reconcile inventory ledger", zap.Error(err))
+		return
+	}
+
+	c.logger.Info("Inventory ledger reconciled",
+		zap.Int("checked", report.Checked),
+		zap.Int("drifted", len(report.Drifts)),
+		zap.Bool("repair", c.repair),
+		zap.Duration("elapsed", time.Since(start)))
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/service"
+)
+
+const (
+	// 默认扫描间隔
+	defaultReapInterval = 30 * time.Second
+	// 默认每批处理的订单数量
+	defaultReapBatchSize = 100
+)
+
+// LockReaper 过期库存锁定释放任务，定期扫描超时未确认的锁定记录并归还库存
+type LockReaper struct {
+	lockService service.InventoryLockService
+	elector     LeaderElector
+	interval    time.Duration
+	batchSize   int
+	logger      *zap.Logger
+}
+
+// NewLockReaper 创建过期库存锁定释放任务
+func NewLockReaper(
+	lockService service.InventoryLockService,
+	elector LeaderElector,
+	interval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *LockReaper {
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultReapBatchSize
+	}
+
+	return &LockReaper{
+		lockService: lockService,
+		elector:     elector,
+		interval:    interval,
+		batchSize:   batchSize,
+		logger:      logger,
+	}
+}
+
+// Run 启动释放任务，直到ctx被取消
+func (r *LockReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		// 退出时主动释放主节点身份，便于其他副本尽快接管
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.elector.Release(releaseCtx); err != nil {
+			r.logger.Warn("Failed to release lock reaper leadership", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+// reap 执行一轮释放，按ID顺序分批处理本轮开始时已过期的记录。释放失败的记录留到下一轮重试，
+// 游标越过这些记录，不会阻塞后续的过期记录
+func (r *LockReaper) reap(ctx context.Context) {
+	before := time.Now()
+	var afterID int64
+
+	for ctx.Err() == nil {
+		// 每批处理前续约，单轮处理时间超过租约时长时避免其他副本同时执行
+		isLeader, err := r.elector.TryAcquire(ctx)
+		if err != nil {
+			r.logger.Warn("Failed to acquire lock reaper leadership", zap.Error(err))
+			return
+		}
+		if !isLeader {
+			return
+		}
+
+		locks, err := r.lockService.GetExpiredLocks(ctx, before, afterID, r.batchSize)
+		if err != nil {
+			r.logger.Error("Failed to get expired locks", zap.Error(err))
+			return
+		}
+
+		released := 0
+		for _, lock := range locks {
+			afterID = lock.ID
+			if err := r.lockService.UnlockInventory(ctx, lock.OrderSN, nil); err != nil {
+				// 订单可能已被并发确认或归还，跳过即可
+				r.logger.Warn("Failed to release expired lock",
+					zap.String("order_sn", lock.OrderSN),
+					zap.Error(err))
+				continue
+			}
+			released++
+		}
+
+		if len(locks) > 0 {
+			r.logger.Info("Released expired inventory locks",
+				zap.Int("expired", len(locks)),
+				zap.Int("released", released))
+		}
+
+		if len(locks) < r.batchSize {
+			return
+		}
+	}
+}
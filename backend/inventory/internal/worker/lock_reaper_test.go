@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/service"
+)
+
+// fakeElector 按顺序返回是否为主节点，用完后保持最后一个结果
+type fakeElector struct {
+	results  []bool
+	acquired int
+}
+
+func (e *fakeElector) TryAcquire(ctx context.Context) (bool, error) {
+	result := e.results[min(e.acquired, len(e.results)-1)]
+	e.acquired++
+	return result, nil
+}
+
+func (e *fakeElector) Release(ctx context.Context) error {
+	return nil
+}
+
+// fakeLockService 内存中的过期锁定记录，failing中的订单释放失败且保持过期
+type fakeLockService struct {
+	service.InventoryLockService
+	expired  []*entity.StockSellDetail
+	failing  map[string]bool
+	released []string
+	pages    []int64
+}
+
+func (s *fakeLockService) GetExpiredLocks(ctx context.Context, before time.Time, afterID int64, limit int) ([]*entity.StockSellDetail, error) {
+	s.pages = append(s.pages, afterID)
+	var locks []*entity.StockSellDetail
+	for _, lock := range s.expired {
+		if lock.ID > afterID && len(locks) < limit {
+			locks = append(locks, lock)
+		}
+	}
+	return locks, nil
+}
+
+func (s *fakeLockService) UnlockInventory(ctx context.Context, orderSN string, items []service.LockItem) error {
+	if s.failing[orderSN] {
+		return errors.New("unlock failed")
+	}
+	s.released = append(s.released, orderSN)
+	return nil
+}
+
+func newExpiredLocks(orderSNs ...string) []*entity.StockSellDetail {
+	locks := make([]*entity.StockSellDetail, 0, len(orderSNs))
+	for i, orderSN := range orderSNs {
+		locks = append(locks, &entity.StockSellDetail{ID: int64(i + 1), OrderSN: orderSN})
+	}
+	return locks
+}
+
+func TestLockReaperSkipsFailedLocks(t *testing.T) {
+	// 第一批全部释放失败，游标越过失败的记录继续处理后面的批次
+	lockService := &fakeLockService{
+		expired: newExpiredLocks("a", "b", "c", "d", "e"),
+		failing: map[string]bool{"a": true, "b": true},
+	}
+	elector := &fakeElector{results: []bool{true}}
+	reaper := NewLockReaper(lockService, elector, time.Minute, 2, zap.NewNop())
+
+	reaper.reap(context.Background())
+
+	if want := []string{"c", "d", "e"}; !slices.Equal(lockService.released, want) {
+		t.Errorf("released = %v, want %v", lockService.released, want)
+	}
+	if want := []int64{0, 2, 4}; !slices.Equal(lockService.pages, want) {
+		t.Errorf("pages after IDs = %v, want %v", lockService.pages, want)
+	}
+	if elector.acquired != 3 {
+		t.Errorf("lease renewed %d times, want once per batch (3)", elector.acquired)
+	}
+}
+
+func TestLockReaperStopsWhenLeadershipLost(t *testing.T) {
+	lockService := &fakeLockService{expired: newExpiredLocks("a", "b", "c", "d", "e")}
+	elector := &fakeElector{results: []bool{true, false}}
+	reaper := NewLockReaper(lockService, elector, time.Minute, 2, zap.NewNop())
+
+	reaper.reap(context.Background())
+
+	if want := []string{"a", "b"}; !slices.Equal(lockService.released, want) {
+		t.Errorf("released = %v, want %v", lockService.released, want)
+	}
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/repository"
+)
+
+const (
+	// 默认写入MySQL的并发数
+	defaultSyncWorkers = 4
+	// 默认对账间隔
+	defaultReconcileInterval = 5 * time.Minute
+	// 默认预热与对账的批大小
+	defaultWarmBatchSize = 500
+	// 队列为空时的等待时间
+	syncPollTimeout = time.Second
+)
+
+// LockSyncer Redis快速锁定的后台任务：将Redis中的锁定异步写入MySQL，并定期以MySQL为准对账
+type LockSyncer struct {
+	repo              *repository.RedisLockRepository
+	elector           LeaderElector
+	workers           int
+	reconcileInterval time.Duration
+	batchSize         int
+	logger            *zap.Logger
+}
+
+// NewLockSyncer 创建快速锁定后台任务
+func NewLockSyncer(
+	repo *repository.RedisLockRepository,
+	elector LeaderElector,
+	workers int,
+	reconcileInterval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *LockSyncer {
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+	if reconcileInterval <= 0 {
+		reconcileInterval = defaultReconcileInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultWarmBatchSize
+	}
+
+	return &LockSyncer{
+		repo:              repo,
+		elector:           elector,
+		workers:           workers,
+		reconcileInterval: reconcileInterval,
+		batchSize:         batchSize,
+		logger:            logger,
+	}
+}
+
+// Warm 预热可用库存，并将上次异常退出时未写入的订单放回队列。写入是幂等的，多副本同时执行不会重复锁定
+func (s *LockSyncer) Warm(ctx context.Context) error {
+	if err := s.repo.RequeueProcessing(ctx); err != nil {
+		return err
+	}
+	return s.repo.Warm(ctx, s.batchSize)
+}
+
+// Run 启动写入与对账任务，直到ctx被取消
+func (s *LockSyncer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.sync(ctx)
+		}()
+	}
+
+	s.reconcileLoop(ctx)
+	wg.Wait()
+}
+
+// sync 持续从写入队列中取出订单写入MySQL
+func (s *LockSyncer) sync(ctx context.Context) {
+	for ctx.Err() == nil {
+		if _, err := s.repo.ProcessNextPendingLock(ctx, syncPollTimeout); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Failed to sync stock lock to database", zap.Error(err))
+			// 避免Redis或MySQL不可用时空转
+			select {
+			case <-ctx.Done():
+			case <-time.After(syncPollTimeout):
+			}
+		}
+	}
+}
+
+// reconcileLoop 定期对账，只有主节点执行
+func (s *LockSyncer) reconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.reconcileInterval)
+	defer ticker.Stop()
+
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.elector.Release(releaseCtx); err != nil {
+			s.logger.Warn("Failed to release lock reconcile leadership", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			isLeader, err := s.elector.TryAcquire(ctx)
+			if err != nil {
+				s.logger.Warn("Failed to acquire lock reconcile leadership", zap.Error(err))
+				continue
+			}
+			if !isLeader {
+				continue
+			}
+
+			start := time.Now()
+			if err := s.repo.Reconcile(ctx, s.batchSize); err != nil {
+				s.logger.Error("Failed to reconcile available stock", zap.Error(err))
+				continue
+			}
+			s.logger.Info("Reconciled available stock with database",
+				zap.Duration("elapsed", time.Since(start)))
+		}
+	}
+}
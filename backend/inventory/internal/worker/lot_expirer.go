@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/service"
+)
+
+const (
+	// 默认批次过期扫描间隔
+	defaultLotExpiryInterval = 5 * time.Minute
+	// 默认每批处理的批次数量
+	defaultLotExpiryBatchSize = 200
+)
+
+// LotExpirer 批次过期任务，定期标记已到期的批次，使其未锁定的数量不再计入可用库存。
+// 锁定时已到期的批次会被跳过，该任务负责让库存查询和预警同样反映过期数量
+type LotExpirer struct {
+	lotService service.LotService
+	elector    LeaderElector
+	interval   time.Duration
+	batchSize  int
+	logger     *zap.Logger
+}
+
+// NewLotExpirer 创建批次过期任务
+func NewLotExpirer(
+	lotService service.LotService,
+	elector LeaderElector,
+	interval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *LotExpirer {
+	if interval <= 0 {
+		interval = defaultLotExpiryInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultLotExpiryBatchSize
+	}
+
+	return &LotExpirer{
+		lotService: lotService,
+		elector:    elector,
+		interval:   interval,
+		batchSize:  batchSize,
+		logger:     logger,
+	}
+}
+
+// Run 启动过期任务，直到ctx被取消
+func (e *LotExpirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		// 退出时主动释放主节点身份，便于其他副本尽快接管
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := e.elector.Release(releaseCtx); err != nil {
+			e.logger.Warn("Failed to release lot expirer leadership", zap.Error(err))
+		}
+	}()
+
+	// 启动时立即执行一轮，避免停机期间到期的批次在下一个间隔前仍显示为可用
+	e.expire(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.expire(ctx)
+		}
+	}
+}
+
+// expire 执行一轮标记，按批处理直到没有到期的批次
+func (e *LotExpirer) expire(ctx context.Context) {
+	isLeader, err := e.elector.TryAcquire(ctx)
+	if err != nil {
+		e.logger.Warn("Failed to acquire lot expirer leadership", zap.Error(err))
+		return
+	}
+	if !isLeader {
+		return
+	}
+
+	for ctx.Err() == nil {
+		expired, err := e.lotService.ExpireLots(ctx, time.Now(), e.batchSize)
+		if err != nil {
+			e.logger.Error("Failed to expire inventory lots", zap.Error(err))
+			return
+		}
+		if expired < e.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/broker"
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+const (
+	// 默认轮询间隔
+	defaultRelayInterval = time.Second
+	// 默认每批发布的事件数量
+	defaultRelayBatchSize = 200
+	// 默认最大发布次数
+	defaultRelayMaxAttempts = 10
+	// 默认已发布事件保留时长
+	defaultRelayRetention = 7 * 24 * time.Hour
+	// 重试退避上限
+	maxRelayBackoff = 10 * time.Minute
+	// 清理已发布事件的间隔
+	relayPurgeInterval = time.Hour
+)
+
+// OutboxRelay 发件箱事件发布任务，只有主节点发布，保证同一聚合的事件按写入顺序送达
+type OutboxRelay struct {
+	repo        repository.OutboxRepository
+	broker      broker.Broker
+	elector     LeaderElector
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	retention   time.Duration
+	lastPurge   time.Time
+	logger      *zap.Logger
+}
+
+// NewOutboxRelay 创建发件箱事件发布任务
+func NewOutboxRelay(
+	repo repository.OutboxRepository,
+	broker broker.Broker,
+	elector LeaderElector,
+	interval time.Duration,
+	batchSize int,
+	maxAttempts int,
+	retention time.Duration,
+	logger *zap.Logger,
+) *OutboxRelay {
+	if interval <= 0 {
+		interval = defaultRelayInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultRelayBatchSize
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRelayMaxAttempts
+	}
+	if retention <= 0 {
+		retention = defaultRelayRetention
+	}
+
+	return &OutboxRelay{
+		repo:        repo,
+		broker:      broker,
+		elector:     elector,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		logger:      logger,
+	}
+}
+
+// Run 启动发布任务，直到ctx被取消
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.elector.Release(releaseCtx); err != nil {
+			r.logger.Warn("Failed to release outbox relay leadership", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			isLeader, err := r.elector.TryAcquire(ctx)
+			if err != nil {
+				r.logger.Warn("Failed to acquire outbox relay leadership", zap.Error(err))
+				continue
+			}
+			if !isLeader {
+				continue
+			}
+
+			r.relay(ctx)
+			r.purge(ctx)
+		}
+	}
+}
+
+// relay 发布一轮待发布事件。某个聚合的事件发布失败或尚未到重试时间时，
+// 本轮跳过该聚合的后续事件，避免乱序
+func (r *OutboxRelay) relay(ctx context.Context) {
+	blocked := make(map[string]bool)
+	var afterID int64
+	for ctx.Err() == nil {
+		events, err := r.repo.ListPending(ctx, afterID, r.batchSize)
+		if err != nil {
+			r.logger.Error("Failed to list pending outbox events", zap.Error(err))
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+
+		now := time.Now()
+		for _, event := range events {
+			if blocked[event.AggregateID] {
+				continue
+			}
+			if event.NextAttemptAt.After(now) {
+				blocked[event.AggregateID] = true
+				continue
+			}
+			if !r.publish(ctx, event) {
+				blocked[event.AggregateID] = true
+			}
+		}
+
+		if len(events) < r.batchSize {
+			return
+		}
+		afterID = events[len(events)-1].ID
+	}
+}
+
+// publish 发布单个事件，返回是否发布成功
+func (r *OutboxRelay) publish(ctx context.Context, event *entity.OutboxEvent) bool {
+	err := r.broker.Publish(ctx, &broker.Message{
+		ID:          event.ID,
+		Type:        event.EventType,
+		AggregateID: event.AggregateID,
+		Payload:     []byte(event.Payload),
+		OccurredAt:  event.CreatedAt,
+	})
+	if err == nil {
+		if err := r.repo.MarkPublished(ctx, event.ID); err != nil {
+			// 标记失败会导致重复发布，订阅方需按事件ID去重
+			r.logger.Error("Failed to mark outbox event published",
+				zap.Int64("event_id", event.ID),
+				zap.Error(err))
+		}
+		return true
+	}
+
+	attempts := event.Attempts + 1
+	dead := attempts >= r.maxAttempts
+	if dead {
+		r.logger.Error("Outbox event exceeded max attempts",
+			zap.Int64("event_id", event.ID),
+			zap.String("event_type", event.EventType),
+			zap.String("aggregate_id", event.AggregateID),
+			zap.Error(err))
+	} else {
+		r.logger.Warn("Failed to publish outbox event",
+			zap.Int64("event_id", event.ID),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+	}
+
+	if markErr := r.repo.MarkFailed(ctx, event.ID, err.Error(), time.Now().Add(relayBackoff(attempts)), dead); markErr != nil {
+		r.logger.Error("Failed to mark outbox event failed",
+			zap.Int64("event_id", event.ID),
+			zap.Error(markErr))
+	}
+	return false
+}
+
+// purge 定期清理过期的已发布事件
+func (r *OutboxRelay) purge(ctx context.Context) {
+	if time.Since(r.lastPurge) < relayPurgeInterval {
+		return
+	}
+	r.lastPurge = time.Now()
+
+	before := time.Now().Add(-r.retention)
+	for ctx.Err() == nil {
+		deleted, err := r.repo.PurgePublished(ctx, before, r.batchSize)
+		if err != nil || deleted < int64(r.batchSize) {
+			return
+		}
+	}
+}
+
+// relayBackoff 按发布次数指数退避
+func relayBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < maxRelayBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRelayBackoff {
+		backoff = maxRelayBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/inventory/internal/broker"
+	"shop/backend/inventory/internal/domain/entity"
+	"shop/backend/inventory/internal/repository"
+)
+
+// fakeOutboxRepo 内存中的发件箱，记录发布结果
+type fakeOutboxRepo struct {
+	repository.OutboxRepository
+	events    []*entity.OutboxEvent
+	published []int64
+	failed    map[int64]bool
+}
+
+func (r *fakeOutboxRepo) ListPending(ctx context.Context, afterID int64, limit int) ([]*entity.OutboxEvent, error) {
+	var events []*entity.OutboxEvent
+	for _, event := range r.events {
+		if event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeOutboxRepo) MarkPublished(ctx context.Context, id int64) error {
+	r.published = append(r.published, id)
+	return nil
+}
+
+func (r *fakeOutboxRepo) MarkFailed(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time, dead bool) error {
+	r.failed[id] = dead
+	return nil
+}
+
+// fakeBroker 发布failing中的事件时失败
+type fakeBroker struct {
+	failing map[int64]bool
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, msg *broker.Message) error {
+	if b.failing[msg.ID] {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func (b *fakeBroker) Close() error {
+	return nil
+}
+
+func TestOutboxRelayBlocksAggregateAfterFailure(t *testing.T) {
+	repo := &fakeOutboxRepo{
+		events: []*entity.OutboxEvent{
+			{ID: 1, AggregateID: "A"},
+			{ID: 2, AggregateID: "B"},
+			{ID: 3, AggregateID: "A"},
+			{ID: 4, AggregateID: "C", NextAttemptAt: time.Now().Add(time.Hour)},
+			{ID: 5, AggregateID: "C"},
+			{ID: 6, AggregateID: "B"},
+		},
+		failed: make(map[int64]bool),
+	}
+	relay := NewOutboxRelay(repo, &fakeBroker{failing: map[int64]bool{1: true}},
+		&fakeElector{results: []bool{true}}, time.Second, 2, 3, 0, zap.NewNop())
+
+	relay.relay(context.Background())
+
+	// A的第一条失败、C的第一条未到重试时间，同一聚合的后续事件都不发布
+	if want := []int64{2, 6}; !slices.Equal(repo.published, want) {
+		t.Errorf("published = %v, want %v", repo.published, want)
+	}
+	if dead, ok := repo.failed[1]; !ok || dead {
+		t.Errorf("event 1 failed = %v, dead = %v, want retry", ok, dead)
+	}
+}
+
+func TestOutboxRelayGivesUpAfterMaxAttempts(t *testing.T) {
+	repo := &fakeOutboxRepo{
+		events: []*entity.OutboxEvent{{ID: 1, AggregateID: "A", Attempts: 2}},
+		failed: make(map[int64]bool),
+	}
+	relay := NewOutboxRelay(repo, &fakeBroker{failing: map[int64]bool{1: true}},
+		&fakeElector{results: []bool{true}}, time.Second, 10, 3, 0, zap.NewNop())
+
+	relay.relay(context.Background())
+
+	if !repo.failed[1] {
+		t.Error("event not marked dead after reaching max attempts")
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{20, maxRelayBackoff},
+	}
+	for _, tt := range tests {
+		if got := relayBackoff(tt.attempts); got != tt.want {
+			t.Errorf("relayBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -8,16 +8,22 @@ DROP TABLE IF EXISTS `inventory`;
 CREATE TABLE `inventory` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
   `stocks` int(11) NOT NULL DEFAULT 0 COMMENT '库存数量',
   `version` int(11) NOT NULL DEFAULT 0 COMMENT '乐观锁版本号',
   `warehouse_id` int(11) NOT NULL DEFAULT 1 COMMENT '仓库ID',
   `lock_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '锁定库存数量',
+  `expired_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '已过期批次中未锁定的数量，不可售',
+  `safety_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '安全库存，所有渠道都不可售',
+  `reserved_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '渠道分配中尚未锁定的数量之和，只有对应渠道可售',
+  `backorder_limit` int(11) NOT NULL DEFAULT 0 COMMENT '预售上限，可用库存不足时最多排队预订的数量，为0表示不允许预订',
+  `backorder_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '排队中尚未到货的预订数量',
   `alert_threshold` int(11) DEFAULT 10 COMMENT '预警阈值',
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   `deleted_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  UNIQUE KEY `idx_goods_warehouse` (`goods`, `warehouse_id`)
+  UNIQUE KEY `idx_goods_sku_warehouse` (`goods`, `sku_id`, `warehouse_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存表';
 
 -- 创建库存记录表
@@ -25,17 +31,20 @@ DROP TABLE IF EXISTS `stock_sell_detail`;
 CREATE TABLE `stock_sell_detail` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `order_sn` varchar(50) NOT NULL COMMENT '订单号',
-  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:锁定，2:已扣减，3:已归还',
-  `detail` json DEFAULT NULL COMMENT '库存扣减明细，结构为[{goods_id:1, num:2, warehouse_id:1}]',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:锁定，2:已扣减，3:已归还，4:部分扣减部分归还',
+  `detail` json DEFAULT NULL COMMENT '库存扣减明细，结构为[{goods_id:1, sku_id:0, num:2, warehouse_id:1, lot_no:L001, reduced:0, returned:0, channel:app, channel_num:2, bundle_id:100, bundle_unit:1}]',
   `lock_time` datetime(3) DEFAULT NULL COMMENT '锁定时间',
   `confirm_time` datetime(3) DEFAULT NULL COMMENT '确认时间',
+  `expire_time` datetime(3) DEFAULT NULL COMMENT '锁定过期时间，为空表示不过期',
+  `backorder_num` int(11) NOT NULL DEFAULT 0 COMMENT '排队中尚未到货的预订数量，到货后转为锁定明细',
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   `deleted_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   UNIQUE KEY `idx_order_sn` (`order_sn`),
   KEY `idx_status` (`status`),
-  KEY `idx_lock_time` (`lock_time`)
+  KEY `idx_lock_time` (`lock_time`),
+  KEY `idx_expire_time` (`expire_time`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存操作明细表';
 
 -- 创建仓库表
@@ -47,11 +56,18 @@ CREATE TABLE `warehouse` (
   `contact` varchar(50) DEFAULT NULL COMMENT '联系人',
   `phone` varchar(20) DEFAULT NULL COMMENT '联系电话',
   `status` tinyint(1) DEFAULT 1 COMMENT '状态：1-正常，0-禁用',
+  `region_code` varchar(20) DEFAULT NULL COMMENT '所在地区编码',
+  `latitude` decimal(10,6) DEFAULT NULL COMMENT '纬度',
+  `longitude` decimal(10,6) DEFAULT NULL COMMENT '经度',
+  `served_regions` varchar(1000) DEFAULT NULL COMMENT '配送覆盖的地区编码，逗号分隔',
+  `capacity` int(11) NOT NULL DEFAULT 0 COMMENT '库容，最多存放的库存数量，0表示不限',
+  `capabilities` int(11) NOT NULL DEFAULT 0 COMMENT '作业能力，按位组合：1-冷链，2-危险品，4-保税，8-自提',
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   `deleted_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_status` (`status`)
+  KEY `idx_status` (`status`),
+  KEY `idx_region_code` (`region_code`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='仓库表';
 
 -- 创建库存变更历史表
@@ -59,18 +75,205 @@ DROP TABLE IF EXISTS `inventory_history`;
 CREATE TABLE `inventory_history` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
   `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
   `quantity` int(11) NOT NULL COMMENT '变更数量（正数增加，负数减少）',
-  `operation_type` varchar(20) NOT NULL COMMENT '操作类型：lock, unlock, decrease, increase, adjust',
+  `operation_type` varchar(20) NOT NULL COMMENT '操作类型：lock, unlock, decrease, increase, adjust, transfer_reserve, transfer_cancel, transfer_out, transfer_in, expire, write_off, reserve, backorder',
   `operator` varchar(50) DEFAULT NULL COMMENT '操作人',
   `order_sn` varchar(50) DEFAULT NULL COMMENT '相关订单号',
+  `lot_no` varchar(50) DEFAULT NULL COMMENT '批次号',
   `remark` varchar(255) DEFAULT NULL COMMENT '备注',
   `created_at` datetime(3) DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `idx_goods` (`goods`),
-  KEY `idx_order_sn` (`order_sn`)
+  KEY `idx_order_sn` (`order_sn`),
+  KEY `idx_lot_no` (`lot_no`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存变更历史表';
 
+-- 创建库存批次表
+DROP TABLE IF EXISTS `inventory_lot`;
+CREATE TABLE `inventory_lot` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `lot_no` varchar(50) NOT NULL COMMENT '批次号',
+  `expiry_date` datetime(3) DEFAULT NULL COMMENT '到期时间，为空表示不过期',
+  `stocks` int(11) NOT NULL DEFAULT 0 COMMENT '批次库存数量',
+  `lock_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '批次锁定数量',
+  `expired` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否已过期，过期后未锁定的数量计入库存记录的过期数量',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_lot` (`goods`, `sku_id`, `warehouse_id`, `lot_no`),
+  KEY `idx_expiry_date` (`expiry_date`),
+  KEY `idx_expired` (`expired`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存批次表';
+
+-- 创建渠道库存分配表
+DROP TABLE IF EXISTS `inventory_channel_allocation`;
+CREATE TABLE `inventory_channel_allocation` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `channel` varchar(32) NOT NULL COMMENT '销售渠道',
+  `allocated` int(11) NOT NULL DEFAULT 0 COMMENT '分配数量，含已锁定的部分，扣减后相应减少',
+  `lock_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '从分配中锁定的数量',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_channel_allocation` (`goods`, `sku_id`, `warehouse_id`, `channel`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='渠道库存分配表';
+
+-- 创建缺货预订表
+DROP TABLE IF EXISTS `inventory_backorder`;
+CREATE TABLE `inventory_backorder` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `order_sn` varchar(50) NOT NULL COMMENT '订单号',
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `quantity` int(11) NOT NULL COMMENT '预订数量',
+  `fulfilled` int(11) NOT NULL DEFAULT 0 COMMENT '已到货并转为锁定的数量',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:排队中，2:已到货，3:已取消',
+  `fulfilled_at` datetime(3) DEFAULT NULL COMMENT '全部到货时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_inventory_backorder_order_sn` (`order_sn`),
+  KEY `idx_backorder_queue` (`goods`, `sku_id`, `warehouse_id`, `status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='缺货预订表';
+
+-- 创建套装定义表
+DROP TABLE IF EXISTS `inventory_bundle`;
+CREATE TABLE `inventory_bundle` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '套装商品ID',
+  `name` varchar(100) DEFAULT NULL COMMENT '套装名称',
+  `detail` json DEFAULT NULL COMMENT '组件明细，结构为[{goods_id:1, sku_id:0, num:2}]',
+  `operator` varchar(50) DEFAULT NULL COMMENT '最后修改人',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_inventory_bundle_goods` (`goods`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='套装定义表';
+
+-- 创建仓库调拨单表
+DROP TABLE IF EXISTS `transfer_order`;
+CREATE TABLE `transfer_order` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `transfer_sn` varchar(50) NOT NULL COMMENT '调拨单号',
+  `from_warehouse_id` int(11) NOT NULL COMMENT '调出仓库ID',
+  `to_warehouse_id` int(11) NOT NULL COMMENT '调入仓库ID',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:已创建，2:在途，3:已收货，4:已取消',
+  `detail` json DEFAULT NULL COMMENT '调拨明细，结构为[{goods_id:1, sku_id:0, num:2}]',
+  `operator` varchar(50) DEFAULT NULL COMMENT '创建人',
+  `remark` varchar(255) DEFAULT NULL COMMENT '备注',
+  `ship_time` datetime(3) DEFAULT NULL COMMENT '发货时间',
+  `receive_time` datetime(3) DEFAULT NULL COMMENT '收货时间',
+  `cancel_time` datetime(3) DEFAULT NULL COMMENT '取消时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_transfer_sn` (`transfer_sn`),
+  KEY `idx_from_warehouse_id` (`from_warehouse_id`),
+  KEY `idx_to_warehouse_id` (`to_warehouse_id`),
+  KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='仓库调拨单表';
+
+DROP TABLE IF EXISTS `inbound_order`;
+CREATE TABLE `inbound_order` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `inbound_sn` varchar(50) NOT NULL COMMENT '入库单号',
+  `warehouse_id` int(11) NOT NULL COMMENT '收货仓库ID',
+  `supplier_name` varchar(100) DEFAULT NULL COMMENT '供应商名称',
+  `supplier_doc_no` varchar(50) DEFAULT NULL COMMENT '供应商单据号，如采购订单号、送货单号',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:已创建，2:部分收货，3:已收齐，4:已关闭',
+  `detail` json DEFAULT NULL COMMENT '入库明细，结构为[{goods_id:1, sku_id:0, expected:10, received:0}]',
+  `operator` varchar(50) DEFAULT NULL COMMENT '创建人',
+  `remark` varchar(255) DEFAULT NULL COMMENT '备注',
+  `close_time` datetime(3) DEFAULT NULL COMMENT '关闭时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_inbound_sn` (`inbound_sn`),
+  KEY `idx_warehouse_id` (`warehouse_id`),
+  KEY `idx_supplier_doc_no` (`supplier_doc_no`),
+  KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='采购入库单表';
+
+DROP TABLE IF EXISTS `inbound_receipt`;
+CREATE TABLE `inbound_receipt` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `receipt_sn` varchar(50) NOT NULL COMMENT '收货单号',
+  `inbound_sn` varchar(50) NOT NULL COMMENT '入库单号',
+  `warehouse_id` int(11) NOT NULL COMMENT '收货仓库ID',
+  `detail` json DEFAULT NULL COMMENT '收货明细，结构为[{goods_id:1, sku_id:0, num:2, lot_no:L001, posted:false}]',
+  `posted` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否已全部入账',
+  `operator` varchar(50) DEFAULT NULL COMMENT '收货人',
+  `remark` varchar(255) DEFAULT NULL COMMENT '备注',
+  `post_time` datetime(3) DEFAULT NULL COMMENT '入账完成时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_receipt_sn` (`receipt_sn`),
+  KEY `idx_inbound_sn` (`inbound_sn`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='采购收货单表';
+
+DROP TABLE IF EXISTS `stocktake_session`;
+CREATE TABLE `stocktake_session` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `session_sn` varchar(50) NOT NULL COMMENT '盘点单号',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:盘点中，2:已提交，3:已取消',
+  `full_count` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否全仓盘点，全仓盘点允许录入盘点范围外的商品',
+  `operator` varchar(50) DEFAULT NULL COMMENT '创建人',
+  `remark` varchar(255) DEFAULT NULL COMMENT '备注',
+  `commit_time` datetime(3) DEFAULT NULL COMMENT '提交时间',
+  `cancel_time` datetime(3) DEFAULT NULL COMMENT '取消时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_session_sn` (`session_sn`),
+  KEY `idx_warehouse_id` (`warehouse_id`),
+  KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='仓库盘点单表';
+
+DROP TABLE IF EXISTS `stocktake_item`;
+CREATE TABLE `stocktake_item` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `session_id` bigint(20) NOT NULL COMMENT '盘点单ID',
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `book_stock` int(11) NOT NULL DEFAULT 0 COMMENT '录入盘点时的账面库存',
+  `counted_stock` int(11) DEFAULT NULL COMMENT '实盘数量，为空表示未盘点',
+  `count_time` datetime(3) DEFAULT NULL COMMENT '录入时间',
+  `counter` varchar(50) DEFAULT NULL COMMENT '盘点人',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_session_goods_sku` (`session_id`, `goods`, `sku_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='仓库盘点明细表';
+
+DROP TABLE IF EXISTS `inventory_outbox`;
+CREATE TABLE `inventory_outbox` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `event_type` varchar(50) NOT NULL COMMENT '事件类型',
+  `aggregate_id` varchar(64) NOT NULL COMMENT '聚合ID，订单号或商品:仓库',
+  `payload` json NOT NULL COMMENT '事件内容',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:待发布，2:已发布，3:发布失败',
+  `attempts` int(11) NOT NULL DEFAULT 0 COMMENT '发布次数',
+  `last_error` varchar(500) DEFAULT NULL COMMENT '最近一次发布错误',
+  `next_attempt_at` datetime(3) DEFAULT NULL COMMENT '下次发布时间',
+  `published_at` datetime(3) DEFAULT NULL COMMENT '发布时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_inventory_outbox_aggregate_id` (`aggregate_id`),
+  KEY `idx_inventory_outbox_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存领域事件发件箱表';
+
 -- 初始化默认仓库
 INSERT INTO `warehouse` (`name`, `address`, `contact`, `phone`, `status`, `created_at`, `updated_at`)
 VALUES ('默认仓库', '默认地址', '系统管理员', '10000000000', 1, NOW(), NOW());
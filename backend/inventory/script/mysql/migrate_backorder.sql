@@ -0,0 +1,36 @@
+-- 缺货预订的迁移脚本
+-- 已有的库存记录预售上限为0，不接受缺货预订，锁定行为与迁移前一致；
+-- 已有锁定记录的backorder_num为0，扣减和归还按原有明细处理，无需迁移。
+
+SET NAMES utf8mb4;
+
+-- 库存表
+ALTER TABLE `inventory`
+  ADD COLUMN `backorder_limit` int(11) NOT NULL DEFAULT 0 COMMENT '预售上限，可用库存不足时最多排队预订的数量，为0表示不允许预订' AFTER `reserved_stocks`,
+  ADD COLUMN `backorder_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '排队中尚未到货的预订数量' AFTER `backorder_limit`;
+
+-- 库存操作明细表
+ALTER TABLE `stock_sell_detail`
+  ADD COLUMN `backorder_num` int(11) NOT NULL DEFAULT 0 COMMENT '排队中尚未到货的预订数量，到货后转为锁定明细' AFTER `expire_time`;
+
+-- 库存变更历史表
+ALTER TABLE `inventory_history`
+  MODIFY COLUMN `operation_type` varchar(20) NOT NULL COMMENT '操作类型：lock, unlock, decrease, increase, adjust, transfer_reserve, transfer_cancel, transfer_out, transfer_in, expire, write_off, reserve, backorder';
+
+-- 缺货预订表
+CREATE TABLE IF NOT EXISTS `inventory_backorder` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `order_sn` varchar(50) NOT NULL COMMENT '订单号',
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `quantity` int(11) NOT NULL COMMENT '预订数量',
+  `fulfilled` int(11) NOT NULL DEFAULT 0 COMMENT '已到货并转为锁定的数量',
+  `status` int(11) NOT NULL DEFAULT 1 COMMENT '状态：1:排队中，2:已到货，3:已取消',
+  `fulfilled_at` datetime(3) DEFAULT NULL COMMENT '全部到货时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_inventory_backorder_order_sn` (`order_sn`),
+  KEY `idx_backorder_queue` (`goods`, `sku_id`, `warehouse_id`, `status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='缺货预订表';
@@ -0,0 +1,18 @@
+-- 套装的迁移脚本
+-- 套装没有库存记录，只需新增套装定义表；组件的锁定明细在stock_sell_detail.detail的JSON中记录bundle_id和bundle_unit，
+-- 已有锁定记录没有这两个字段，扣减和归还按原有明细处理，无需迁移。
+
+SET NAMES utf8mb4;
+
+-- 套装定义表
+CREATE TABLE IF NOT EXISTS `inventory_bundle` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '套装商品ID',
+  `name` varchar(100) DEFAULT NULL COMMENT '套装名称',
+  `detail` json DEFAULT NULL COMMENT '组件明细，结构为[{goods_id:1, sku_id:0, num:2}]',
+  `operator` varchar(50) DEFAULT NULL COMMENT '最后修改人',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_inventory_bundle_goods` (`goods`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='套装定义表';
@@ -0,0 +1,30 @@
+-- 安全库存和渠道库存分配的迁移脚本
+-- 已有的库存记录安全库存为0、没有渠道分配，可售数量与迁移前一致。
+-- 渠道分配中未锁定的数量之和计入库存表的reserved_stocks，只有对应渠道可以锁定；
+-- 已有锁定记录的明细缺少channel和channel_num，按共享可用库存处理，无需迁移。
+
+SET NAMES utf8mb4;
+
+-- 库存表
+ALTER TABLE `inventory`
+  ADD COLUMN `safety_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '安全库存，所有渠道都不可售' AFTER `expired_stocks`,
+  ADD COLUMN `reserved_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '渠道分配中尚未锁定的数量之和，只有对应渠道可售' AFTER `safety_stocks`;
+
+-- 库存变更历史表
+ALTER TABLE `inventory_history`
+  MODIFY COLUMN `operation_type` varchar(20) NOT NULL COMMENT '操作类型：lock, unlock, decrease, increase, adjust, transfer_reserve, transfer_cancel, transfer_out, transfer_in, expire, write_off, reserve';
+
+-- 渠道库存分配表
+CREATE TABLE IF NOT EXISTS `inventory_channel_allocation` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `channel` varchar(32) NOT NULL COMMENT '销售渠道',
+  `allocated` int(11) NOT NULL DEFAULT 0 COMMENT '分配数量，含已锁定的部分，扣减后相应减少',
+  `lock_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '从分配中锁定的数量',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_channel_allocation` (`goods`, `sku_id`, `warehouse_id`, `channel`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='渠道库存分配表';
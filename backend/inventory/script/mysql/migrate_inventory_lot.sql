@@ -0,0 +1,38 @@
+-- 库存批次和到期日管理的迁移脚本
+-- 已有的库存全部视为未区分批次的库存，锁定时在批次库存之后分配。
+-- 入库时指定批次号即可开始按批次管理，锁定时按先到期先出选择批次，
+-- 过期批次由定时任务标记，未锁定的数量计入库存表的expired_stocks，不再可售，
+-- 报废过期批次后从库存中核销。
+
+SET NAMES utf8mb4;
+
+-- 库存表
+ALTER TABLE `inventory`
+  ADD COLUMN `expired_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '已过期批次中未锁定的数量，不可售' AFTER `lock_stocks`;
+
+-- 库存变更历史表
+ALTER TABLE `inventory_history`
+  MODIFY COLUMN `operation_type` varchar(20) NOT NULL COMMENT '操作类型：lock, unlock, decrease, increase, adjust, transfer_reserve, transfer_cancel, transfer_out, transfer_in, expire, write_off',
+  ADD COLUMN `lot_no` varchar(50) DEFAULT NULL COMMENT '批次号' AFTER `order_sn`,
+  ADD KEY `idx_lot_no` (`lot_no`);
+
+-- 库存批次表
+CREATE TABLE IF NOT EXISTS `inventory_lot` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `goods` bigint(20) NOT NULL COMMENT '商品ID',
+  `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存',
+  `warehouse_id` int(11) NOT NULL COMMENT '仓库ID',
+  `lot_no` varchar(50) NOT NULL COMMENT '批次号',
+  `expiry_date` datetime(3) DEFAULT NULL COMMENT '到期时间，为空表示不过期',
+  `stocks` int(11) NOT NULL DEFAULT 0 COMMENT '批次库存数量',
+  `lock_stocks` int(11) NOT NULL DEFAULT 0 COMMENT '批次锁定数量',
+  `expired` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否已过期，过期后未锁定的数量计入库存记录的过期数量',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_lot` (`goods`, `sku_id`, `warehouse_id`, `lot_no`),
+  KEY `idx_expiry_date` (`expiry_date`),
+  KEY `idx_expired` (`expired`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='库存批次表';
+
+-- 库存锁定记录和收货单的明细为JSON，缺少lot_no的明细按未区分批次的库存处理，无需迁移
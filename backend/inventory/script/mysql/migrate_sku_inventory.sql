@@ -0,0 +1,24 @@
+-- 库存按SKU管理的迁移脚本
+-- 已有的库存记录保留为商品级库存（sku_id = 0），行为与迁移前一致。
+-- 商品启用规格后，通过SplitInventory接口将商品级库存拆分到各SKU，
+-- 拆分要求商品级库存没有锁定数量，拆分数量之和等于商品级库存。
+
+SET NAMES utf8mb4;
+
+-- 库存表
+ALTER TABLE `inventory`
+  ADD COLUMN `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存' AFTER `goods`,
+  DROP INDEX `idx_goods_warehouse`,
+  ADD UNIQUE KEY `idx_goods_sku_warehouse` (`goods`, `sku_id`, `warehouse_id`);
+
+-- 库存变更历史表
+ALTER TABLE `inventory_history`
+  ADD COLUMN `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存' AFTER `goods`;
+
+-- 仓库盘点明细表
+ALTER TABLE `stocktake_item`
+  ADD COLUMN `sku_id` bigint(20) NOT NULL DEFAULT 0 COMMENT 'SKU ID，为0表示商品级库存' AFTER `goods`,
+  DROP INDEX `idx_session_goods`,
+  ADD UNIQUE KEY `idx_session_goods_sku` (`session_id`, `goods`, `sku_id`);
+
+-- 库存锁定记录和调拨单的明细为JSON，缺少sku_id的明细按商品级库存处理，无需迁移
@@ -0,0 +1,9 @@
+-- 仓库经纬度的迁移脚本
+-- 已有仓库的经纬度为空，就近分配时排在已设置经纬度的仓库之后，
+-- 需通过UpdateWarehouse接口补充后才能参与按距离分配。
+
+SET NAMES utf8mb4;
+
+ALTER TABLE `warehouse`
+  ADD COLUMN `latitude` decimal(10,6) DEFAULT NULL COMMENT '纬度' AFTER `status`,
+  ADD COLUMN `longitude` decimal(10,6) DEFAULT NULL COMMENT '经度' AFTER `latitude`;
@@ -0,0 +1,12 @@
+-- 仓库地区、库容和作业能力的迁移脚本
+-- 已有仓库的新字段为空，库容为0表示不限，作业能力为0表示不具备特殊能力，
+-- 需通过UpdateWarehouse接口补充后才能按地区和作业能力筛选到。
+
+SET NAMES utf8mb4;
+
+ALTER TABLE `warehouse`
+  ADD COLUMN `region_code` varchar(20) DEFAULT NULL COMMENT '所在地区编码' AFTER `status`,
+  ADD COLUMN `served_regions` varchar(1000) DEFAULT NULL COMMENT '配送覆盖的地区编码，逗号分隔' AFTER `longitude`,
+  ADD COLUMN `capacity` int(11) NOT NULL DEFAULT 0 COMMENT '库容，最多存放的库存数量，0表示不限' AFTER `served_regions`,
+  ADD COLUMN `capabilities` int(11) NOT NULL DEFAULT 0 COMMENT '作业能力，按位组合：1-冷链，2-危险品，4-保税，8-自提' AFTER `capacity`,
+  ADD KEY `idx_region_code` (`region_code`);
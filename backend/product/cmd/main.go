@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/go-redis/redis/v8"
@@ -29,6 +30,7 @@ import (
 	"shop/backend/product/internal/repository/cache"
 	"shop/backend/product/internal/service"
 	"shop/backend/product/internal/web/grpc"
+	"shop/backend/product/internal/worker"
 )
 
 func main() {
@@ -80,11 +82,31 @@ func main() {
 	}
 	
 	// 7. 初始化服务层
-	productService := service.NewProductService(productRepo, categoryRepo, brandRepo, searchRepo)
+	productService := service.NewProductService(productRepo, categoryRepo, brandRepo)
 	categoryService := service.NewCategoryService(categoryRepo)
 	brandService := service.NewBrandService(brandRepo)
 	bannerService := service.NewBannerService(bannerRepo)
 	searchService := service.NewSearchService(searchRepo, productRepo)
+	priceService := service.NewPriceService(productRepo)
+	
+	// 启动搜索索引同步任务和定时调价任务
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	searchIndexer := worker.NewSearchIndexer(
+		searchService,
+		time.Duration(cfg.SearchIndex.Interval)*time.Second,
+		cfg.SearchIndex.BatchSize,
+		zap.L(),
+	)
+	go searchIndexer.Run(workerCtx)
+	priceScheduler := worker.NewPriceScheduler(
+		priceService,
+		time.Duration(cfg.PriceSchedule.Interval)*time.Second,
+		cfg.PriceSchedule.BatchSize,
+		zap.L(),
+	)
+	go priceScheduler.Run(workerCtx)
+	
 		// 8. 创建gRPC服务器
 	grpcServer := grpc.NewServer(
 		productService,
@@ -92,6 +114,7 @@ func main() {
 		brandService,
 		bannerService,
 		searchService,
+		priceService,
 	)
 	
 	// 设置健康检查状态
@@ -142,6 +165,9 @@ func main() {
 	
 	sugar.Info("Shutting down product service...")
 	
+	// 停止后台任务
+	cancelWorkers()
+	
 	// 注销服务
 	if err := consulClient.Agent().ServiceDeregister(serviceID); err != nil {
 		sugar.Errorw("Failed to deregister service", "error", err)
@@ -47,6 +47,18 @@ type Config struct {
 		URLPrefix string `yaml:"urlPrefix"`
 	} `yaml:"oss"`
 	
+	// 搜索索引同步任务配置
+	SearchIndex struct {
+		Interval  int `yaml:"interval"`  // 扫描间隔（秒）
+		BatchSize int `yaml:"batchSize"` // 每批处理的同步任务数量
+	} `yaml:"searchIndex"`
+	
+	// 定时调价任务配置
+	PriceSchedule struct {
+		Interval  int `yaml:"interval"`  // 扫描间隔（秒）
+		BatchSize int `yaml:"batchSize"` // 每批处理的调价数量
+	} `yaml:"priceSchedule"`
+	
 	LogLevel string `yaml:"logLevel"`
 	LogFile  string `yaml:"logFile"`
 }
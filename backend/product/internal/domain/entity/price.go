@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"time"
+
+	"shop/backend/product/internal/domain/valueobject"
+)
+
+// 价格变更来源
+const (
+	PriceSourceManual   = "manual"   // 后台手动修改
+	PriceSourceSchedule = "schedule" // 定时调价生效
+	PriceSourceRevert   = "revert"   // 定时调价到期恢复
+)
+
+// 定时调价状态
+const (
+	PriceScheduleStatusPending  = "pending"  // 等待生效
+	PriceScheduleStatusActive   = "active"   // 已生效，等待到期恢复
+	PriceScheduleStatusFinished = "finished" // 已结束
+)
+
+// PriceHistory 价格变更记录，SkuID为0时为商品本店价格的变更
+type PriceHistory struct {
+	ID         int64             `json:"id"`
+	ProductID  int64             `json:"product_id" gorm:"column:goods"`
+	SkuID      int64             `json:"sku_id" gorm:"column:sku"`
+	OldPrice   valueobject.Money `json:"old_price"`
+	NewPrice   valueobject.Money `json:"new_price"`
+	Source     string            `json:"source"`
+	ScheduleID int64             `json:"schedule_id"`
+	Operator   string            `json:"operator"`
+	Reason     string            `json:"reason"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PriceHistory) TableName() string {
+	return "goods_price_history"
+}
+
+// PriceSchedule 定时调价，在StartTime将价格改为Price；EndTime不为空时到期恢复为生效前的价格，为空时调价长期有效
+type PriceSchedule struct {
+	ID            int64             `json:"id"`
+	ProductID     int64             `json:"product_id" gorm:"column:goods"`
+	SkuID         int64             `json:"sku_id" gorm:"column:sku"`
+	Price         valueobject.Money `json:"price"`
+	OriginalPrice valueobject.Money `json:"original_price"` // 生效前的价格，到期时按此恢复
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       *time.Time        `json:"end_time,omitempty"`
+	Status        string            `json:"status"`
+	Operator      string            `json:"operator"`
+	Reason        string            `json:"reason"`
+	AppliedAt     *time.Time        `json:"applied_at,omitempty"`
+	FinishedAt    *time.Time        `json:"finished_at,omitempty"`
+	Attempts      int               `json:"attempts"`                  // 连续失败次数
+	LastError     string            `json:"last_error"`                // 最近一次失败原因
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"` // 失败后的重试时间，之前定时任务不再处理
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PriceSchedule) TableName() string {
+	return "goods_price_schedule"
+}
+
+// Overlaps 判断两个调价是否作用于同一商品或SKU且时间段有重叠，EndTime为空视为一直有效
+func (s *PriceSchedule) Overlaps(other *PriceSchedule) bool {
+	if s.ProductID != other.ProductID || s.SkuID != other.SkuID {
+		return false
+	}
+	if s.EndTime != nil && !s.EndTime.After(other.StartTime) {
+		return false
+	}
+	if other.EndTime != nil && !other.EndTime.After(s.StartTime) {
+		return false
+	}
+	return true
+}
+
+// Expired 判断调价时段是否已经结束
+func (s *PriceSchedule) Expired(now time.Time) bool {
+	return s.EndTime != nil && !s.EndTime.After(now)
+}
@@ -2,6 +2,8 @@ package entity
 
 import (
 	"time"
+	
+	"shop/backend/product/internal/domain/valueobject"
 )
 
 // Product 商品实体
@@ -18,8 +20,8 @@ type Product struct {
 	ClickNum        int       `json:"click_num"`
 	SoldNum         int       `json:"sold_num"`
 	FavNum          int       `json:"fav_num"`
-	MarketPrice     float64   `json:"market_price"`
-	ShopPrice       float64   `json:"shop_price"`
+	MarketPrice     valueobject.Money `json:"market_price"`
+	ShopPrice       valueobject.Money `json:"shop_price"`
 	GoodsBrief      string    `json:"goods_brief"`
 	GoodsDesc       string    `json:"goods_desc"`
 	GoodsFrontImage string    `json:"goods_front_image"`
@@ -34,18 +36,20 @@ type Product struct {
 	Images   []string  `json:"images,omitempty"`
 	
 	// SKU相关
-	SkuList []*ProductSKU `json:"sku_list,omitempty"`
+	SkuList []*ProductSKU       `json:"sku_list,omitempty"`
+	Specs   []*ProductSpec      `json:"specs,omitempty"`
+	Attrs   []*ProductAttribute `json:"attrs,omitempty"`
 }
 
 // ProductSKU 商品SKU实体
 type ProductSKU struct {
 	ID             int64     `json:"id"`
-	ProductID      int64     `json:"product_id"`
+	ProductID      int64     `json:"product_id" gorm:"column:goods"`
 	SkuName        string    `json:"sku_name"`
 	SkuCode        string    `json:"sku_code"`
 	BarCode        string    `json:"bar_code"`
-	Price          float64   `json:"price"`
-	PromotionPrice float64   `json:"promotion_price"`
+	Price          valueobject.Money `json:"price"`
+	PromotionPrice valueobject.Money `json:"promotion_price"`
 	Points         int       `json:"points"`
 	Stocks         int       `json:"stocks"`
 	Image          string    `json:"image"`
@@ -55,13 +59,18 @@ type ProductSKU struct {
 	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
 	
 	// 规格值，如 {"颜色": "红色", "尺寸": "XL"}
-	SpecValues map[string]string `json:"spec_values,omitempty"`
+	SpecValues map[string]string `json:"spec_values,omitempty" gorm:"serializer:json"`
+}
+
+// TableName 指定表名
+func (ProductSKU) TableName() string {
+	return "goods_sku"
 }
 
 // ProductAttribute 商品属性实体
 type ProductAttribute struct {
 	ID         int64     `json:"id"`
-	ProductID  int64     `json:"product_id"`
+	ProductID  int64     `json:"product_id" gorm:"column:goods"`
 	AttrName   string    `json:"attr_name"`
 	AttrValue  string    `json:"attr_value"`
 	AttrSort   int       `json:"attr_sort"`
@@ -69,10 +78,15 @@ type ProductAttribute struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// TableName 指定表名
+func (ProductAttribute) TableName() string {
+	return "goods_attribute"
+}
+
 // ProductImage 商品图片实体
 type ProductImage struct {
 	ID        int64     `json:"id"`
-	ProductID int64     `json:"product_id"`
+	ProductID int64     `json:"product_id" gorm:"column:goods"`
 	ImageURL  string    `json:"image_url"`
 	IsMain    bool      `json:"is_main"`
 	Sort      int       `json:"sort"`
@@ -80,16 +94,44 @@ type ProductImage struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// TableName 指定表名
+func (ProductImage) TableName() string {
+	return "goods_image"
+}
+
 // ProductSpec 商品规格定义实体
 type ProductSpec struct {
 	ID         int64     `json:"id"`
-	ProductID  int64     `json:"product_id"`
-	SpecName   string    `json:"spec_name"`       // 规格名，如：颜色、尺寸
-	SpecValues []string  `json:"spec_values"`     // 规格值列表，如：["红色", "蓝色", "绿色"]
+	ProductID  int64     `json:"product_id" gorm:"column:goods"`
+	SpecName   string    `json:"spec_name"`                          // 规格名，如：颜色、尺寸
+	SpecValues []string  `json:"spec_values" gorm:"serializer:json"` // 规格值列表，如：["红色", "蓝色", "绿色"]
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// TableName 指定表名
+func (ProductSpec) TableName() string {
+	return "goods_spec"
+}
+
+// MatchSpecValues 判断SKU的规格值是否与给定的规格组合完全一致
+func (s *ProductSKU) MatchSpecValues(values map[string]string) bool {
+	if len(s.SpecValues) != len(values) {
+		return false
+	}
+	for name, value := range values {
+		if v, ok := s.SpecValues[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDeleted 判断SKU是否已软删除
+func (s *ProductSKU) IsDeleted() bool {
+	return s.DeletedAt != nil
+}
+
 // IncreaseClickNum 增加商品点击数
 func (p *Product) IncreaseClickNum() {
 	p.ClickNum++
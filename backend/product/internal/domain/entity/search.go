@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// SearchIndexTask 搜索索引同步任务，每个商品最多一条。商品变更的事务中登记，
+// 后台任务按商品在数据库中的最新状态写入或删除索引，同一商品的多次变更合并为一次同步
+type SearchIndexTask struct {
+	ID            int64      `json:"id"`
+	ProductID     int64      `json:"product_id" gorm:"column:goods"`
+	Version       int64      `json:"version"`  // 登记次数，同步期间商品再次变更时递增，同步完成时版本不一致则保留任务
+	Attempts      int        `json:"attempts"` // 连续失败次数
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"` // 处理中的租约到期时间，到期前其他实例不会处理
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SearchIndexTask) TableName() string {
+	return "goods_search_task"
+}
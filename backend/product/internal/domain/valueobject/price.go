@@ -1,88 +1,279 @@
 package valueobject
 
-// Price 价格值对象
-type Price struct {
-	Value     float64
-	Currency  string
-	IsDefault bool
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CurrencyCNY 人民币，未指定币种时的默认币种
+const CurrencyCNY = "CNY"
+
+var (
+	ErrInvalidMoney     = errors.New("invalid money amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// currencyExponents 各币种最小货币单位对应的小数位数，未列出的币种按2位处理
+var currencyExponents = map[string]int{
+	"CNY": 2,
+	"USD": 2,
+	"EUR": 2,
+	"JPY": 0,
+}
+
+// RoundingMode 计算结果不足最小货币单位时的舍入方式
+type RoundingMode int
+
+const (
+	// RoundHalfUp 四舍五入，五入时远离零，折扣价的默认规则
+	RoundHalfUp RoundingMode = iota
+	// RoundDown 舍去不足最小货币单位的部分（向零取整）
+	RoundDown
+	// RoundUp 不足最小货币单位的部分按一个单位计（远离零取整）
+	RoundUp
+)
+
+// Money 金额值对象，以最小货币单位（如人民币的分）的整数保存金额，金额运算不经过浮点数，避免精度误差。
+// 数据库中以decimal保存，不保存币种，读取时币种为CNY
+type Money struct {
+	Amount   int64  `json:"amount"`   // 最小货币单位的数量
+	Currency string `json:"currency"` // ISO 4217货币代码
 }
 
-// NewPrice 创建价格值对象
-func NewPrice(value float64, currency string) *Price {
-	return &Price{
-		Value:     value,
-		Currency:  currency,
-		IsDefault: true,
+// NewMoney 创建金额值对象，amount为最小货币单位的数量，currency为空时使用CNY
+func NewMoney(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: normalizeCurrency(currency),
 	}
 }
 
-// NewCNYPrice 创建人民币价格值对象
-func NewCNYPrice(value float64) *Price {
-	return NewPrice(value, "CNY")
+// NewCNY 创建人民币金额，amount单位为分
+func NewCNY(amount int64) Money {
+	return NewMoney(amount, CurrencyCNY)
 }
 
-// Equals 判断两个价格是否相等
-func (p *Price) Equals(other *Price) bool {
-	if p == nil || other == nil {
-		return false
+// ParseMoney 解析十进制金额字符串，如"12.34"。小数位数超过币种精度时返回错误，不做舍入
+func ParseMoney(s string, currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	exp := currencyExponent(currency)
+
+	value := strings.TrimSpace(s)
+	negative := strings.HasPrefix(value, "-")
+	if negative || strings.HasPrefix(value, "+") {
+		value = value[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(value, ".")
+	for len(fracPart) > exp && strings.HasSuffix(fracPart, "0") {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+	if intPart == "" && fracPart == "" || len(fracPart) > exp {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	digits := intPart + fracPart + strings.Repeat("0", exp-len(fracPart))
+	if strings.TrimLeft(digits, "0123456789") != "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
 	}
-	
-	return p.Value == other.Value && p.Currency == other.Currency
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MoneyFromFloat 将浮点金额四舍五入到最小货币单位，仅用于读取以float保存的历史数据
+func MoneyFromFloat(value float64, currency string) Money {
+	currency = normalizeCurrency(currency)
+	scale := float64(pow10(currencyExponent(currency)))
+	return Money{Amount: int64(math.Round(value * scale)), Currency: currency}
+}
+
+// IsZero 判断金额是否为0
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsPositive 判断金额是否大于0
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
 }
 
-// LessThan 判断价格是否小于另一个价格
-func (p *Price) LessThan(other *Price) bool {
-	if p == nil || other == nil || p.Currency != other.Currency {
+// IsNegative 判断金额是否小于0
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// SameCurrency 判断两个金额的币种是否相同
+func (m Money) SameCurrency(other Money) bool {
+	return normalizeCurrency(m.Currency) == normalizeCurrency(other.Currency)
+}
+
+// Equals 判断两个金额的数量和币种是否都相等
+func (m Money) Equals(other Money) bool {
+	return m.Amount == other.Amount && m.SameCurrency(other)
+}
+
+// LessThan 判断金额是否小于另一个金额，币种不同时返回false
+func (m Money) LessThan(other Money) bool {
+	if !m.SameCurrency(other) {
 		return false
 	}
-	
-	return p.Value < other.Value
+	return m.Amount < other.Amount
+}
+
+// Add 金额加法，币种不同时返回错误
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: normalizeCurrency(m.Currency)}, nil
+}
+
+// Sub 金额减法，币种不同时返回错误
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: normalizeCurrency(m.Currency)}, nil
+}
+
+// Multiply 金额乘以数量，结果精确，不需要舍入
+func (m Money) Multiply(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: normalizeCurrency(m.Currency)}
+}
+
+// Discount 按减免比例计算折后金额，offBasisPoints为减免的万分比，如1500表示减免15%（八五折），
+// 超出[0, 10000]时按边界处理。不足最小货币单位的部分按mode舍入。
+// 多件商品应先计算单价的折后金额再乘以数量，保证订单金额与展示的商品价格一致
+func (m Money) Discount(offBasisPoints int64, mode RoundingMode) Money {
+	if offBasisPoints < 0 {
+		offBasisPoints = 0
+	}
+	if offBasisPoints > 10000 {
+		offBasisPoints = 10000
+	}
+	return Money{
+		Amount:   divRound(m.Amount*(10000-offBasisPoints), 10000, mode),
+		Currency: normalizeCurrency(m.Currency),
+	}
 }
 
-// Add 价格加法
-func (p *Price) Add(other *Price) *Price {
-	if p == nil || other == nil || p.Currency != other.Currency {
-		return p
+// String 按币种精度格式化为十进制字符串，如"12.34"，不包含币种
+func (m Money) String() string {
+	exp := currencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
 	}
-	
-	return &Price{
-		Value:     p.Value + other.Value,
-		Currency:  p.Currency,
-		IsDefault: p.IsDefault,
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
 	}
+	scale := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exp, amount%scale)
+}
+
+// Value 实现driver.Valuer，以十进制字符串写入decimal列
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
 }
 
-// Multiply 价格乘法
-func (p *Price) Multiply(quantity int) *Price {
-	if p == nil || quantity < 0 {
-		return p
+// Scan 实现sql.Scanner，读取decimal列；历史的float列读取时四舍五入到最小货币单位
+func (m *Money) Scan(src interface{}) error {
+	currency := normalizeCurrency(m.Currency)
+	switch v := src.(type) {
+	case nil:
+		*m = Money{Currency: currency}
+	case int64:
+		*m = Money{Amount: v * pow10(currencyExponent(currency)), Currency: currency}
+	case float64:
+		*m = MoneyFromFloat(v, currency)
+	case []byte:
+		return m.scanString(string(v), currency)
+	case string:
+		return m.scanString(v, currency)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidMoney, src)
 	}
-	
-	return &Price{
-		Value:     p.Value * float64(quantity),
-		Currency:  p.Currency,
-		IsDefault: p.IsDefault,
+	return nil
+}
+
+// scanString 解析数据库返回的十进制字符串，小数位数超过币种精度时按浮点数四舍五入
+func (m *Money) scanString(s string, currency string) error {
+	money, err := ParseMoney(s, currency)
+	if err != nil {
+		value, floatErr := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if floatErr != nil {
+			return err
+		}
+		money = MoneyFromFloat(value, currency)
 	}
+	*m = money
+	return nil
+}
+
+// GormDataType 数据库列类型
+func (Money) GormDataType() string {
+	return "decimal(10,2)"
 }
 
-// Discount 价格折扣
-func (p *Price) Discount(percentage float64) *Price {
-	if p == nil {
-		return p
+// divRound 整数除法，余数按mode舍入，d必须大于0
+func divRound(n, d int64, mode RoundingMode) int64 {
+	q, r := n/d, n%d
+	if r == 0 {
+		return q
+	}
+
+	var away bool
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		away = true
+	default:
+		if r < 0 {
+			r = -r
+		}
+		away = 2*r >= d
+	}
+	if !away {
+		return q
 	}
-	
-	if percentage < 0 {
-		percentage = 0
+	if n < 0 {
+		return q - 1
 	}
-	if percentage > 100 {
-		percentage = 100
+	return q + 1
+}
+
+// normalizeCurrency 统一币种代码为大写，为空时使用CNY
+func normalizeCurrency(currency string) string {
+	if currency == "" {
+		return CurrencyCNY
 	}
-	
-	discountFactor := (100 - percentage) / 100
-	
-	return &Price{
-		Value:     p.Value * discountFactor,
-		Currency:  p.Currency,
-		IsDefault: p.IsDefault,
+	return strings.ToUpper(currency)
+}
+
+// currencyExponent 返回币种的小数位数
+func currencyExponent(currency string) int {
+	if exp, ok := currencyExponents[normalizeCurrency(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// pow10 返回10的exp次方
+func pow10(exp int) int64 {
+	result := int64(1)
+	for i := 0; i < exp; i++ {
+		result *= 10
 	}
+	return result
 }
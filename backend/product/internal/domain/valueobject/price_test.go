@@ -0,0 +1,178 @@
+package valueobject
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"12.34", "", 1234, false},
+		{"12", "CNY", 1200, false},
+		{"12.3", "cny", 1230, false},
+		{".5", "", 50, false},
+		{"-0.01", "", -1, false},
+		{"+1.00", "", 100, false},
+		{" 7.10 ", "", 710, false},
+		{"1.2300", "", 123, false},
+		{"1000", "JPY", 1000, false},
+		{"1.5", "JPY", 0, true},
+		{"1.234", "", 0, true},
+		{"", "", 0, true},
+		{".", "", 0, true},
+		{"1e3", "", 0, true},
+		{"1.-2", "", 0, true},
+		{"99999999999999999999", "", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, tt.currency)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidMoney) {
+				t.Errorf("ParseMoney(%q, %q) error = %v, want ErrInvalidMoney", tt.in, tt.currency, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %q) error = %v", tt.in, tt.currency, err)
+			continue
+		}
+		if got.Amount != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %d, want %d", tt.in, tt.currency, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{NewCNY(1234), "12.34"},
+		{NewCNY(5), "0.05"},
+		{NewCNY(0), "0.00"},
+		{NewCNY(-1), "-0.01"},
+		{NewCNY(-1050), "-10.50"},
+		{NewMoney(1000, "JPY"), "1000"},
+		{Money{Amount: 199}, "1.99"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+		parsed, err := ParseMoney(tt.money.String(), tt.money.Currency)
+		if err != nil || parsed.Amount != tt.money.Amount {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.money.String(), parsed.Amount, err, tt.money.Amount)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		n, d int64
+		mode RoundingMode
+		want int64
+	}{
+		{10, 4, RoundHalfUp, 3},
+		{9, 4, RoundHalfUp, 2},
+		{-10, 4, RoundHalfUp, -3},
+		{-9, 4, RoundHalfUp, -2},
+		{10, 4, RoundDown, 2},
+		{-10, 4, RoundDown, -2},
+		{9, 4, RoundUp, 3},
+		{-9, 4, RoundUp, -3},
+		{8, 4, RoundUp, 2},
+		{0, 4, RoundUp, 0},
+	}
+	for _, tt := range tests {
+		if got := divRound(tt.n, tt.d, tt.mode); got != tt.want {
+			t.Errorf("divRound(%d, %d, %d) = %d, want %d", tt.n, tt.d, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDiscount(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		off    int64
+		mode   RoundingMode
+		want   int64
+	}{
+		// 9.99元打八五折为8.4915元
+		{"half up", 999, 1500, RoundHalfUp, 849},
+		{"down", 999, 1500, RoundDown, 849},
+		{"up", 999, 1500, RoundUp, 850},
+		// 0.05元打五折为0.025元
+		{"half up at half", 5, 5000, RoundHalfUp, 3},
+		{"down at half", 5, 5000, RoundDown, 2},
+		{"no discount", 999, 0, RoundHalfUp, 999},
+		{"free", 999, 10000, RoundHalfUp, 0},
+		{"negative off clamped", 999, -100, RoundHalfUp, 999},
+		{"over 100% clamped", 999, 12000, RoundHalfUp, 0},
+		{"negative amount", -5, 5000, RoundHalfUp, -3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewCNY(tt.amount).Discount(tt.off, tt.mode)
+			if got.Amount != tt.want || got.Currency != CurrencyCNY {
+				t.Errorf("Discount(%d, %d) = %+v, want %d CNY", tt.off, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	sum, err := NewCNY(110).Add(Money{Amount: 220})
+	if err != nil || !sum.Equals(NewCNY(330)) {
+		t.Errorf("Add = %+v, %v, want 3.30 CNY", sum, err)
+	}
+	if _, err := NewCNY(1).Add(NewMoney(1, "USD")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := NewCNY(1).Sub(NewMoney(1, "USD")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub across currencies error = %v, want ErrCurrencyMismatch", err)
+	}
+	if NewCNY(1).LessThan(NewMoney(2, "USD")) {
+		t.Error("LessThan compared amounts across currencies")
+	}
+	// 先计算单价的折后金额再乘以数量
+	if got := NewCNY(999).Discount(1500, RoundHalfUp).Multiply(3); got.Amount != 2547 {
+		t.Errorf("discounted unit price * 3 = %d, want 2547", got.Amount)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want int64
+	}{
+		{[]byte("12.34"), 1234},
+		{"0.10", 10},
+		{int64(3), 300},
+		{nil, 0},
+		// 历史float列的精度误差按四舍五入处理
+		{0.1 + 0.2, 30},
+		{19.999999, 2000},
+		{"8.4915", 849},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v) error = %v", tt.src, err)
+			continue
+		}
+		if m.Amount != tt.want || m.Currency != CurrencyCNY {
+			t.Errorf("Scan(%v) = %+v, want %d CNY", tt.src, m, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Scan(bool) error = %v, want ErrInvalidMoney", err)
+	}
+}
@@ -39,8 +39,9 @@ type ElasticSearchProductDoc struct {
 	ClickNum        int       `json:"click_num"`
 	SoldNum         int       `json:"sold_num"`
 	FavNum          int       `json:"fav_num"`
-	MarketPrice     float64   `json:"market_price"`
-	ShopPrice       float64   `json:"shop_price"`
+	MarketPrice     int64     `json:"market_price_amount"` // 最小货币单位，如分
+	ShopPrice       int64     `json:"shop_price_amount"`
+	Currency        string    `json:"currency"`
 	GoodsBrief      string    `json:"goods_brief"`
 	GoodsDesc       string    `json:"goods_desc"`
 	GoodsFrontImage string    `json:"goods_front_image"`
@@ -128,8 +129,9 @@ func NewElasticSearchRepository(
       "click_num": { "type": "integer" },
       "sold_num": { "type": "integer" },
       "fav_num": { "type": "integer" },
-      "market_price": { "type": "float" },
-      "shop_price": { "type": "float" },
+      "market_price_amount": { "type": "long" },
+      "shop_price_amount": { "type": "long" },
+      "currency": { "type": "keyword" },
       "goods_brief": { 
         "type": "text", 
         "analyzer": "ik_smart_pinyin",
@@ -192,8 +194,9 @@ func (r *ElasticSearchRepository) convertProductToDoc(ctx context.Context, produ
 		ClickNum:        product.ClickNum,
 		SoldNum:         product.SoldNum,
 		FavNum:          product.FavNum,
-		MarketPrice:     product.MarketPrice,
-		ShopPrice:       product.ShopPrice,
+		MarketPrice:     product.MarketPrice.Amount,
+		ShopPrice:       product.ShopPrice.Amount,
+		Currency:        product.ShopPrice.Currency,
 		GoodsBrief:      product.GoodsBrief,
 		GoodsDesc:       product.GoodsDesc,
 		GoodsFrontImage: product.GoodsFrontImage,
@@ -271,13 +274,13 @@ func (r *ElasticSearchRepository) SearchProducts(ctx context.Context, params Sea
 	}
 	
 	// 价格区间过滤
-	if params.PriceMin > 0 || params.PriceMax > 0 {
-		rangeQuery := elastic.NewRangeQuery("shop_price")
-		if params.PriceMin > 0 {
-			rangeQuery = rangeQuery.Gte(params.PriceMin)
+	if params.PriceMin.IsPositive() || params.PriceMax.IsPositive() {
+		rangeQuery := elastic.NewRangeQuery("shop_price_amount")
+		if params.PriceMin.IsPositive() {
+			rangeQuery = rangeQuery.Gte(params.PriceMin.Amount)
 		}
-		if params.PriceMax > 0 {
-			rangeQuery = rangeQuery.Lte(params.PriceMax)
+		if params.PriceMax.IsPositive() {
+			rangeQuery = rangeQuery.Lte(params.PriceMax.Amount)
 		}
 		query = query.Filter(rangeQuery)
 	}
@@ -311,17 +314,17 @@ func (r *ElasticSearchRepository) SearchProducts(ctx context.Context, params Sea
 			order = strings.ToLower(parts[1])
 		}
 		
-		// 允许排序的字段
-		allowedSortFields := map[string]bool{
-			"shop_price": true,
-			"sold_num":   true,
-			"click_num":  true,
-			"fav_num":    true,
-			"created_at": true,
+		// 允许排序的字段及对应的文档字段
+		allowedSortFields := map[string]string{
+			"shop_price": "shop_price_amount",
+			"sold_num":   "sold_num",
+			"click_num":  "click_num",
+			"fav_num":    "fav_num",
+			"created_at": "created_at",
 		}
 		
-		if allowedSortFields[field] {
-			sorter := elastic.NewFieldSort(field)
+		if docField, ok := allowedSortFields[field]; ok {
+			sorter := elastic.NewFieldSort(docField)
 			if order == "asc" {
 				sorter = sorter.Asc()
 			} else {
@@ -403,12 +406,7 @@ func (r *ElasticSearchRepository) IndexProduct(ctx context.Context, product *ent
 	
 	// 商品被删除的情况下，需要从索引中删除
 	if product.IsDeleted {
-		_, err = r.client.Delete().
-			Index(r.indexName).
-			Id(strconv.FormatInt(product.ID, 10)).
-			Refresh("true").
-			Do(ctx)
-		return err
+		return r.DeleteProductIndex(ctx, product.ID)
 	}
 	
 	// 更新或创建索引
@@ -472,13 +470,16 @@ func (r *ElasticSearchRepository) BatchIndexProducts(ctx context.Context, produc
 	return nil
 }
 
-// DeleteProductIndex 删除商品索引
+// DeleteProductIndex 删除商品索引，索引中没有该商品时视为成功
 func (r *ElasticSearchRepository) DeleteProductIndex(ctx context.Context, id int64) error {
 	_, err := r.client.Delete().
 		Index(r.indexName).
 		Id(strconv.FormatInt(id, 10)).
 		Refresh("true").
 		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
 		
 	return err
 }
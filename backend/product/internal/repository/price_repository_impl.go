@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/service"
+)
+
+// 调价失败原因的最大长度，与表字段长度一致
+const maxScheduleErrorLen = 500
+
+// SavePriceHistories 保存价格变更记录
+func (r *ProductRepositoryImpl) SavePriceHistories(ctx context.Context, histories []*entity.PriceHistory) error {
+	if len(histories) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&histories).Error
+}
+
+// ListPriceHistories 分页查询价格变更记录，按变更时间倒序
+func (r *ProductRepositoryImpl) ListPriceHistories(ctx context.Context, filter service.PriceHistoryFilter) ([]*entity.PriceHistory, int64, error) {
+	var histories []*entity.PriceHistory
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&entity.PriceHistory{}).Where("goods = ?", filter.ProductID)
+	if filter.SkuID > 0 {
+		query = query.Where("sku = ?", filter.SkuID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.PageSize
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(filter.PageSize).Find(&histories).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return histories, total, nil
+}
+
+// CreatePriceSchedule 创建定时调价
+func (r *ProductRepositoryImpl) CreatePriceSchedule(ctx context.Context, schedule *entity.PriceSchedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+// ListOpenPriceSchedules 查询商品或SKU等待生效和已生效的调价，事务中对查询到的记录加锁
+func (r *ProductRepositoryImpl) ListOpenPriceSchedules(ctx context.Context, productID, skuID int64) ([]*entity.PriceSchedule, error) {
+	var schedules []*entity.PriceSchedule
+	query := r.db.WithContext(ctx)
+	if r.inTransaction() {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	err := query.Where("goods = ? AND sku = ? AND status IN ?", productID, skuID,
+		[]string{entity.PriceScheduleStatusPending, entity.PriceScheduleStatusActive}).
+		Order("start_time").Find(&schedules).Error
+	return schedules, err
+}
+
+// ListDuePriceSchedules 查询需要生效或恢复的调价。按生效或恢复的时间排序，时间相同时先恢复，
+// 保证首尾相接的两次调价中后一次记录的原价格是前一次恢复后的价格
+func (r *ProductRepositoryImpl) ListDuePriceSchedules(ctx context.Context, now time.Time, limit int) ([]*entity.PriceSchedule, error) {
+	var schedules []*entity.PriceSchedule
+	err := r.db.WithContext(ctx).
+		Where("(status = ? AND start_time <= ?) OR (status = ? AND end_time <= ?)",
+			entity.PriceScheduleStatusPending, now, entity.PriceScheduleStatusActive, now).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "CASE WHEN status = ? THEN end_time ELSE start_time END, status = ?, id",
+			Vars: []interface{}{entity.PriceScheduleStatusActive, entity.PriceScheduleStatusPending},
+		}}).
+		Limit(limit).Find(&schedules).Error
+	return schedules, err
+}
+
+// UpdatePriceScheduleStatus 按状态条件更新调价，多个实例同时处理同一调价时只有一个能更新成功
+func (r *ProductRepositoryImpl) UpdatePriceScheduleStatus(ctx context.Context, schedule *entity.PriceSchedule, fromStatus string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.PriceSchedule{}).
+		Where("id = ? AND status = ?", schedule.ID, fromStatus).
+		Updates(map[string]interface{}{
+			"status":          schedule.Status,
+			"original_price":  schedule.OriginalPrice,
+			"applied_at":      schedule.AppliedAt,
+			"finished_at":     schedule.FinishedAt,
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": nil,
+			"updated_at":      schedule.UpdatedAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// RecordPriceScheduleFailure 调价仍为status时记录处理失败，到达nextAttemptAt之前定时任务不再处理该调价
+func (r *ProductRepositoryImpl) RecordPriceScheduleFailure(ctx context.Context, id int64, status string, errMsg string, nextAttemptAt time.Time) error {
+	if len(errMsg) > maxScheduleErrorLen {
+		errMsg = errMsg[:maxScheduleErrorLen]
+	}
+	return r.db.WithContext(ctx).Model(&entity.PriceSchedule{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      errMsg,
+			"next_attempt_at": nextAttemptAt,
+			"updated_at":      time.Now(),
+		}).Error
+}
@@ -15,6 +15,9 @@ import (
 type ProductRepositoryImpl struct {
 	db    *gorm.DB
 	cache cache.ProductCache
+	
+	// 事务中修改的商品ID，提交后再删除缓存，避免回滚后缓存中留下未提交的数据
+	dirty map[int64]bool
 }
 
 // NewProductRepository 创建商品仓储实例
@@ -25,16 +28,46 @@ func NewProductRepository(db *gorm.DB, cache cache.ProductCache) service.Product
 	}
 }
 
+// Transaction 在事务中执行fn，提交后删除事务中修改过的商品缓存
+func (r *ProductRepositoryImpl) Transaction(ctx context.Context, fn func(txRepo service.ProductRepository) error) error {
+	txRepo := &ProductRepositoryImpl{
+		cache: r.cache,
+		dirty: make(map[int64]bool),
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo.db = tx
+		return fn(txRepo)
+	})
+	if err != nil {
+		return err
+	}
+	
+	for id := range txRepo.dirty {
+		if err := r.cache.DeleteProduct(ctx, id); err != nil {
+			// 缓存删除失败只记录日志，不影响主流程
+			// log.Printf("Delete product cache failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// inTransaction 判断是否为事务中的仓储
+func (r *ProductRepositoryImpl) inTransaction() bool {
+	return r.dirty != nil
+}
+
 // GetProductByID 根据ID获取商品
 func (r *ProductRepositoryImpl) GetProductByID(ctx context.Context, id int64) (*entity.Product, error) {
-	// 尝试从缓存获取
-	product, err := r.cache.GetProduct(ctx, id)
-	if err == nil && product != nil {
-		return product, nil
+	// 尝试从缓存获取，事务中直接读取数据库
+	if !r.inTransaction() {
+		product, err := r.cache.GetProduct(ctx, id)
+		if err == nil && product != nil {
+			return product, nil
+		}
 	}
 	
 	// 缓存未命中，从数据库获取
-	product = &entity.Product{}
+	product := &entity.Product{}
 	result := r.db.WithContext(ctx).First(product, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -43,7 +76,10 @@ func (r *ProductRepositoryImpl) GetProductByID(ctx context.Context, id int64) (*
 		return nil, result.Error
 	}
 	
-	// 将商品放入缓存
+	// 将商品放入缓存，事务中的数据可能回滚，不写入缓存
+	if r.inTransaction() {
+		return product, nil
+	}
 	if err := r.cache.SetProduct(ctx, product); err != nil {
 		// 缓存失败只记录日志，不影响主流程
 		// log.Printf("Cache product failed: %v", err)
@@ -157,6 +193,12 @@ func (r *ProductRepositoryImpl) UpdateProduct(ctx context.Context, product *enti
 		return err
 	}
 	
+	// 事务中提交后再删除缓存
+	if r.inTransaction() {
+		r.dirty[product.ID] = true
+		return nil
+	}
+	
 	// 更新缓存
 	if err := r.cache.SetProduct(ctx, product); err != nil {
 		// 缓存失败只记录日志，不影响主流程
@@ -177,6 +219,12 @@ func (r *ProductRepositoryImpl) DeleteProduct(ctx context.Context, id int64) err
 		return err
 	}
 	
+	// 事务中提交后再删除缓存
+	if r.inTransaction() {
+		r.dirty[id] = true
+		return nil
+	}
+	
 	// 删除缓存
 	if err := r.cache.DeleteProduct(ctx, id); err != nil {
 		// 缓存删除失败只记录日志，不影响主流程
@@ -186,10 +234,10 @@ func (r *ProductRepositoryImpl) DeleteProduct(ctx context.Context, id int64) err
 	return nil
 }
 
-// GetSKUByID 根据ID获取SKU
+// GetSKUByID 根据ID获取SKU，已软删除的SKU返回nil
 func (r *ProductRepositoryImpl) GetSKUByID(ctx context.Context, id int64) (*entity.ProductSKU, error) {
 	var sku entity.ProductSKU
-	result := r.db.WithContext(ctx).First(&sku, id)
+	result := r.db.WithContext(ctx).Where("deleted_at IS NULL").First(&sku, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -200,10 +248,24 @@ func (r *ProductRepositoryImpl) GetSKUByID(ctx context.Context, id int64) (*enti
 	return &sku, nil
 }
 
-// GetSKUsByProductID 获取商品的SKU列表
+// GetSKUsByProductID 获取商品的SKU列表，不包含已软删除的SKU
 func (r *ProductRepositoryImpl) GetSKUsByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error) {
 	var skus []*entity.ProductSKU
-	err := r.db.WithContext(ctx).Where("goods = ?", productID).Find(&skus).Error
+	err := r.db.WithContext(ctx).Where("goods = ? AND deleted_at IS NULL", productID).Find(&skus).Error
+	return skus, err
+}
+
+// GetSKUsWithDeletedByProductID 获取商品的全部SKU，包含已软删除的SKU
+func (r *ProductRepositoryImpl) GetSKUsWithDeletedByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error) {
+	var skus []*entity.ProductSKU
+	err := r.db.WithContext(ctx).Where("goods = ?", productID).Order("id").Find(&skus).Error
+	return skus, err
+}
+
+// BatchGetSKUs 批量获取SKU，不包含已软删除的SKU
+func (r *ProductRepositoryImpl) BatchGetSKUs(ctx context.Context, ids []int64) ([]*entity.ProductSKU, error) {
+	var skus []*entity.ProductSKU
+	err := r.db.WithContext(ctx).Where("id IN ? AND deleted_at IS NULL", ids).Find(&skus).Error
 	return skus, err
 }
 
@@ -212,7 +274,7 @@ func (r *ProductRepositoryImpl) CreateSKU(ctx context.Context, sku *entity.Produ
 	return r.db.WithContext(ctx).Create(sku).Error
 }
 
-// UpdateSKU 更新SKU
+// UpdateSKU 更新SKU，保存全部字段，包括删除时间
 func (r *ProductRepositoryImpl) UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error {
 	return r.db.WithContext(ctx).Save(sku).Error
 }
@@ -222,6 +284,18 @@ func (r *ProductRepositoryImpl) DeleteSKU(ctx context.Context, id int64) error {
 	return r.db.WithContext(ctx).Delete(&entity.ProductSKU{}, id).Error
 }
 
+// SoftDeleteSKUs 软删除SKU，保留记录供历史订单查询
+func (r *ProductRepositoryImpl) SoftDeleteSKUs(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	
+	return r.db.WithContext(ctx).Model(&entity.ProductSKU{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"deleted_at": gorm.Expr("NOW()"),
+		}).Error
+}
+
 // GetAttributesByProductID 获取商品属性
 func (r *ProductRepositoryImpl) GetAttributesByProductID(ctx context.Context, productID int64) ([]*entity.ProductAttribute, error) {
 	var attrs []*entity.ProductAttribute
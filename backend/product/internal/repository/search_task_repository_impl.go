@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shop/backend/product/internal/domain/entity"
+)
+
+// 失败原因的最大长度，与表字段长度一致
+const maxSearchTaskErrorLen = 500
+
+// EnqueueSearchTask 登记商品的索引同步任务，已有任务时递增版本并立即重新同步
+func (r *ProductRepositoryImpl) EnqueueSearchTask(ctx context.Context, productID int64, now time.Time) error {
+	task := &entity.SearchIndexTask{
+		ProductID:     productID,
+		Version:       1,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "goods"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":         gorm.Expr("version + 1"),
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": now,
+			"updated_at":      now,
+		}),
+	}).Create(task).Error
+}
+
+// ListDueSearchTasks 查询到达同步时间且未被其他实例处理的任务
+func (r *ProductRepositoryImpl) ListDueSearchTasks(ctx context.Context, now time.Time, limit int) ([]*entity.SearchIndexTask, error) {
+	var tasks []*entity.SearchIndexTask
+	err := r.db.WithContext(ctx).
+		Where("next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", now, now).
+		Order("next_attempt_at, id").
+		Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimSearchTask 占用任务直到until，多个实例同时处理同一任务时只有一个能占用成功
+func (r *ProductRepositoryImpl) ClaimSearchTask(ctx context.Context, task *entity.SearchIndexTask, now, until time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&entity.SearchIndexTask{}).
+		Where("id = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", task.ID, now, now).
+		Update("locked_until", until)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// CompleteSearchTask 同步成功后删除任务。处理期间商品再次变更时保留任务并释放占用，由下一轮按最新状态同步
+func (r *ProductRepositoryImpl) CompleteSearchTask(ctx context.Context, task *entity.SearchIndexTask) error {
+	res := r.db.WithContext(ctx).
+		Where("id = ? AND version = ?", task.ID, task.Version).
+		Delete(&entity.SearchIndexTask{})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return r.releaseSearchTask(ctx, task)
+}
+
+// FailSearchTask 记录同步失败并在nextAttemptAt重试。处理期间商品再次变更时只释放占用，立即按最新状态重新同步
+func (r *ProductRepositoryImpl) FailSearchTask(ctx context.Context, task *entity.SearchIndexTask, errMsg string, nextAttemptAt time.Time) error {
+	if len(errMsg) > maxSearchTaskErrorLen {
+		errMsg = errMsg[:maxSearchTaskErrorLen]
+	}
+	res := r.db.WithContext(ctx).Model(&entity.SearchIndexTask{}).
+		Where("id = ? AND version = ?", task.ID, task.Version).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      errMsg,
+			"next_attempt_at": nextAttemptAt,
+			"locked_until":    nil,
+			"updated_at":      time.Now(),
+		})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return r.releaseSearchTask(ctx, task)
+}
+
+// releaseSearchTask 释放任务的占用
+func (r *ProductRepositoryImpl) releaseSearchTask(ctx context.Context, task *entity.SearchIndexTask) error {
+	return r.db.WithContext(ctx).Model(&entity.SearchIndexTask{}).
+		Where("id = ?", task.ID).
+		Update("locked_until", nil).Error
+}
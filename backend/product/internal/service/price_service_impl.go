@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
+)
+
+var (
+	ErrInvalidPriceSchedule  = errors.New("invalid price schedule")
+	ErrPriceScheduleConflict = errors.New("price schedule overlaps an existing schedule")
+)
+
+// 价格变更记录默认和最大的分页大小
+const (
+	defaultPriceHistoryPageSize = 20
+	maxPriceHistoryPageSize     = 100
+)
+
+// 定时调价失败后重试的基础间隔和最大间隔
+const (
+	priceScheduleRetryInterval    = 30 * time.Second
+	priceScheduleMaxRetryInterval = time.Hour
+)
+
+// PriceServiceImpl 价格服务实现
+type PriceServiceImpl struct {
+	productRepo ProductRepository
+}
+
+// NewPriceService 创建价格服务实例
+func NewPriceService(productRepo ProductRepository) PriceService {
+	return &PriceServiceImpl{
+		productRepo: productRepo,
+	}
+}
+
+// GetPriceHistory 分页查询商品或SKU的价格变更记录
+func (s *PriceServiceImpl) GetPriceHistory(ctx context.Context, filter PriceHistoryFilter) ([]*entity.PriceHistory, int64, error) {
+	if filter.ProductID <= 0 {
+		return nil, 0, ErrInvalidParameter
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = defaultPriceHistoryPageSize
+	}
+	if filter.PageSize > maxPriceHistoryPageSize {
+		filter.PageSize = maxPriceHistoryPageSize
+	}
+	return s.productRepo.ListPriceHistories(ctx, filter)
+}
+
+// SchedulePriceChange 创建定时调价。同一商品或SKU的调价时间段不能重叠，开始时间已过的调价在定时任务下一次执行时生效
+func (s *PriceServiceImpl) SchedulePriceChange(ctx context.Context, schedule *entity.PriceSchedule) (*entity.PriceSchedule, error) {
+	now := time.Now()
+	if schedule.ProductID <= 0 || !schedule.Price.IsPositive() || schedule.StartTime.IsZero() {
+		return nil, ErrInvalidPriceSchedule
+	}
+	if !isStoredCurrency(schedule.Price) {
+		return nil, ErrUnsupportedCurrency
+	}
+	if schedule.EndTime != nil && (!schedule.EndTime.After(schedule.StartTime) || !schedule.EndTime.After(now)) {
+		return nil, ErrInvalidPriceSchedule
+	}
+
+	schedule.ID = 0
+	schedule.OriginalPrice = valueobject.Money{}
+	schedule.Status = entity.PriceScheduleStatusPending
+	schedule.AppliedAt = nil
+	schedule.FinishedAt = nil
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	err := s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		target, err := loadPriceTarget(ctx, txRepo, schedule.ProductID, schedule.SkuID)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			if schedule.SkuID > 0 {
+				return ErrSKUNotFound
+			}
+			return ErrProductNotFound
+		}
+		if !schedule.Price.SameCurrency(target.price()) {
+			return ErrInvalidPriceSchedule
+		}
+
+		// 检查与已有调价的时间段是否重叠
+		existing, err := txRepo.ListOpenPriceSchedules(ctx, schedule.ProductID, schedule.SkuID)
+		if err != nil {
+			return err
+		}
+		for _, other := range existing {
+			if schedule.Overlaps(other) {
+				return ErrPriceScheduleConflict
+			}
+		}
+
+		return txRepo.CreatePriceSchedule(ctx, schedule)
+	})
+	if err != nil {
+		schedule.ID = 0
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// ApplyDuePriceSchedules 生效到达开始时间的调价，恢复到达结束时间的调价。
+// 单个调价失败时记录失败原因并按递增的间隔推迟重试，继续处理其余调价，只在ctx取消时提前返回
+func (s *PriceServiceImpl) ApplyDuePriceSchedules(ctx context.Context, now time.Time, limit int) (int, error) {
+	schedules, err := s.productRepo.ListDuePriceSchedules(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, schedule := range schedules {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		status := schedule.Status
+		if status == entity.PriceScheduleStatusActive {
+			err = s.revertSchedule(ctx, schedule, now)
+		} else {
+			err = s.applySchedule(ctx, schedule, now)
+		}
+		if err == nil {
+			continue
+		}
+
+		attempts := schedule.Attempts + 1
+		zap.L().Error("Failed to process price schedule",
+			zap.Int64("schedule_id", schedule.ID),
+			zap.Int64("product_id", schedule.ProductID),
+			zap.Int64("sku_id", schedule.SkuID),
+			zap.String("status", status),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+		nextAttemptAt := now.Add(retryDelay(attempts, priceScheduleRetryInterval, priceScheduleMaxRetryInterval))
+		if err := s.productRepo.RecordPriceScheduleFailure(ctx, schedule.ID, status, err.Error(), nextAttemptAt); err != nil {
+			zap.L().Error("Failed to record price schedule failure",
+				zap.Int64("schedule_id", schedule.ID),
+				zap.Error(err))
+		}
+	}
+	return len(schedules), nil
+}
+
+// applySchedule 生效调价并记录生效前的价格。调价时段在生效前已经结束，或商品、SKU已删除时直接结束调价
+func (s *PriceServiceImpl) applySchedule(ctx context.Context, schedule *entity.PriceSchedule, now time.Time) error {
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		target, err := loadPriceTarget(ctx, txRepo, schedule.ProductID, schedule.SkuID)
+		if err != nil {
+			return err
+		}
+
+		schedule.UpdatedAt = now
+		if target == nil || schedule.Expired(now) {
+			schedule.Status = entity.PriceScheduleStatusFinished
+			schedule.FinishedAt = &now
+			_, err := txRepo.UpdatePriceScheduleStatus(ctx, schedule, entity.PriceScheduleStatusPending)
+			return err
+		}
+
+		schedule.OriginalPrice = target.price()
+		schedule.AppliedAt = &now
+		schedule.Status = entity.PriceScheduleStatusActive
+		if schedule.EndTime == nil {
+			// 长期调价生效后即结束，不再恢复
+			schedule.Status = entity.PriceScheduleStatusFinished
+			schedule.FinishedAt = &now
+		}
+		ok, err := txRepo.UpdatePriceScheduleStatus(ctx, schedule, entity.PriceScheduleStatusPending)
+		if err != nil || !ok {
+			return err
+		}
+
+		if err := target.setPrice(ctx, txRepo, schedule.Price, now); err != nil {
+			return err
+		}
+		if err := txRepo.SavePriceHistories(ctx, []*entity.PriceHistory{
+			scheduleHistory(schedule, entity.PriceSourceSchedule, schedule.OriginalPrice, schedule.Price, now),
+		}); err != nil {
+			return err
+		}
+		return txRepo.EnqueueSearchTask(ctx, schedule.ProductID, now)
+	})
+}
+
+// revertSchedule 到期恢复调价前的价格。调价期间价格被手动修改过时保留修改后的价格，只结束调价
+func (s *PriceServiceImpl) revertSchedule(ctx context.Context, schedule *entity.PriceSchedule, now time.Time) error {
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		target, err := loadPriceTarget(ctx, txRepo, schedule.ProductID, schedule.SkuID)
+		if err != nil {
+			return err
+		}
+
+		schedule.Status = entity.PriceScheduleStatusFinished
+		schedule.FinishedAt = &now
+		schedule.UpdatedAt = now
+		ok, err := txRepo.UpdatePriceScheduleStatus(ctx, schedule, entity.PriceScheduleStatusActive)
+		if err != nil || !ok || target == nil {
+			return err
+		}
+
+		current := target.price()
+		if !current.Equals(schedule.Price) {
+			zap.L().Info("Price changed during schedule, skip revert",
+				zap.Int64("schedule_id", schedule.ID),
+				zap.Int64("product_id", schedule.ProductID),
+				zap.Int64("sku_id", schedule.SkuID),
+				zap.Stringer("price", current))
+			return nil
+		}
+
+		if err := target.setPrice(ctx, txRepo, schedule.OriginalPrice, now); err != nil {
+			return err
+		}
+		if err := txRepo.SavePriceHistories(ctx, []*entity.PriceHistory{
+			scheduleHistory(schedule, entity.PriceSourceRevert, current, schedule.OriginalPrice, now),
+		}); err != nil {
+			return err
+		}
+		return txRepo.EnqueueSearchTask(ctx, schedule.ProductID, now)
+	})
+}
+
+// priceTarget 调价对象，sku为空时调整商品的本店价格
+type priceTarget struct {
+	product *entity.Product
+	sku     *entity.ProductSKU
+}
+
+// loadPriceTarget 加载调价对象，商品或SKU不存在、已删除或SKU不属于该商品时返回nil
+func loadPriceTarget(ctx context.Context, repo ProductRepository, productID, skuID int64) (*priceTarget, error) {
+	product, err := repo.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || product.IsDeleted {
+		return nil, nil
+	}
+	if skuID == 0 {
+		return &priceTarget{product: product}, nil
+	}
+
+	sku, err := repo.GetSKUByID(ctx, skuID)
+	if err != nil {
+		return nil, err
+	}
+	if sku == nil || sku.ProductID != productID || sku.IsDeleted() {
+		return nil, nil
+	}
+	return &priceTarget{product: product, sku: sku}, nil
+}
+
+// price 返回当前价格
+func (t *priceTarget) price() valueobject.Money {
+	if t.sku != nil {
+		return t.sku.Price
+	}
+	return t.product.ShopPrice
+}
+
+// setPrice 修改价格，不记录价格变更历史
+func (t *priceTarget) setPrice(ctx context.Context, repo ProductRepository, price valueobject.Money, now time.Time) error {
+	if t.sku != nil {
+		t.sku.Price = price
+		t.sku.UpdatedAt = now
+		return repo.UpdateSKU(ctx, t.sku)
+	}
+	t.product.ShopPrice = price
+	t.product.UpdatedAt = now
+	return repo.UpdateProduct(ctx, t.product)
+}
+
+// history 生成手动修改价格的变更记录
+func (c PriceChange) history(productID, skuID int64, oldPrice, newPrice valueobject.Money, now time.Time) *entity.PriceHistory {
+	return &entity.PriceHistory{
+		ProductID: productID,
+		SkuID:     skuID,
+		OldPrice:  oldPrice,
+		NewPrice:  newPrice,
+		Source:    entity.PriceSourceManual,
+		Operator:  c.Operator,
+		Reason:    c.Reason,
+		CreatedAt: now,
+	}
+}
+
+// scheduleHistory 生成定时调价生效或恢复的变更记录
+func scheduleHistory(schedule *entity.PriceSchedule, source string, oldPrice, newPrice valueobject.Money, now time.Time) *entity.PriceHistory {
+	return &entity.PriceHistory{
+		ProductID:  schedule.ProductID,
+		SkuID:      schedule.SkuID,
+		OldPrice:   oldPrice,
+		NewPrice:   newPrice,
+		Source:     source,
+		ScheduleID: schedule.ID,
+		Operator:   schedule.Operator,
+		Reason:     schedule.Reason,
+		CreatedAt:  now,
+	}
+}
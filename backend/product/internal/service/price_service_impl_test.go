@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
+)
+
+// fakePriceRepo 内存中的商品和调价，broken中的商品读取失败
+type fakePriceRepo struct {
+	ProductRepository
+	products  map[int64]*entity.Product
+	broken    map[int64]bool
+	schedules []*entity.PriceSchedule
+	histories []*entity.PriceHistory
+	enqueued  []int64
+	failures  map[int64]time.Time
+}
+
+func (r *fakePriceRepo) Transaction(ctx context.Context, fn func(txRepo ProductRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakePriceRepo) GetProductByID(ctx context.Context, id int64) (*entity.Product, error) {
+	if r.broken[id] {
+		return nil, errors.New("lock wait timeout")
+	}
+	return r.products[id], nil
+}
+
+func (r *fakePriceRepo) UpdateProduct(ctx context.Context, product *entity.Product) error {
+	r.products[product.ID] = product
+	return nil
+}
+
+func (r *fakePriceRepo) ListDuePriceSchedules(ctx context.Context, now time.Time, limit int) ([]*entity.PriceSchedule, error) {
+	return r.schedules, nil
+}
+
+func (r *fakePriceRepo) UpdatePriceScheduleStatus(ctx context.Context, schedule *entity.PriceSchedule, fromStatus string) (bool, error) {
+	return true, nil
+}
+
+func (r *fakePriceRepo) RecordPriceScheduleFailure(ctx context.Context, id int64, status string, errMsg string, nextAttemptAt time.Time) error {
+	r.failures[id] = nextAttemptAt
+	return nil
+}
+
+func (r *fakePriceRepo) SavePriceHistories(ctx context.Context, histories []*entity.PriceHistory) error {
+	r.histories = append(r.histories, histories...)
+	return nil
+}
+
+func (r *fakePriceRepo) EnqueueSearchTask(ctx context.Context, productID int64, now time.Time) error {
+	r.enqueued = append(r.enqueued, productID)
+	return nil
+}
+
+func TestApplyDuePriceSchedulesContinuesAfterFailure(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := now.Add(time.Hour)
+	repo := &fakePriceRepo{
+		products: map[int64]*entity.Product{
+			1: {ID: 1, ShopPrice: valueobject.NewCNY(10000)},
+			2: {ID: 2, ShopPrice: valueobject.NewCNY(5000)},
+		},
+		broken: map[int64]bool{2: true},
+		schedules: []*entity.PriceSchedule{
+			{ID: 10, ProductID: 2, Price: valueobject.NewCNY(4000), StartTime: now, Status: entity.PriceScheduleStatusPending, Attempts: 1},
+			{ID: 11, ProductID: 1, Price: valueobject.NewCNY(8000), StartTime: now, EndTime: &end, Status: entity.PriceScheduleStatusPending},
+		},
+		failures: map[int64]time.Time{},
+	}
+	svc := NewPriceService(repo)
+
+	n, err := svc.ApplyDuePriceSchedules(context.Background(), now, 10)
+	if err != nil {
+		t.Fatalf("ApplyDuePriceSchedules() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("processed = %d, want 2", n)
+	}
+	// 调价10第二次失败，4倍基础间隔后重试
+	if next, ok := repo.failures[10]; !ok || !next.Equal(now.Add(4*priceScheduleRetryInterval)) {
+		t.Errorf("retry of schedule 10 at %v, want %v", next, now.Add(4*priceScheduleRetryInterval))
+	}
+	// 调价11照常生效，记录原价格并登记索引同步
+	if !repo.products[1].ShopPrice.Equals(valueobject.NewCNY(8000)) || !repo.schedules[1].OriginalPrice.Equals(valueobject.NewCNY(10000)) {
+		t.Errorf("product 1 price = %v, original = %v, want 80 and 100", repo.products[1].ShopPrice, repo.schedules[1].OriginalPrice)
+	}
+	if repo.schedules[1].Status != entity.PriceScheduleStatusActive {
+		t.Errorf("schedule 11 status = %s, want %s", repo.schedules[1].Status, entity.PriceScheduleStatusActive)
+	}
+	if len(repo.histories) != 1 || repo.histories[0].Source != entity.PriceSourceSchedule {
+		t.Errorf("histories = %v, want one schedule history", repo.histories)
+	}
+	if len(repo.enqueued) != 1 || repo.enqueued[0] != 1 {
+		t.Errorf("enqueued = %v, want [1]", repo.enqueued)
+	}
+}
+
+func TestRevertKeepsManuallyChangedPrice(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakePriceRepo{
+		products: map[int64]*entity.Product{1: {ID: 1, ShopPrice: valueobject.NewCNY(9000)}},
+		schedules: []*entity.PriceSchedule{
+			{ID: 11, ProductID: 1, Price: valueobject.NewCNY(8000), OriginalPrice: valueobject.NewCNY(10000), EndTime: &now, Status: entity.PriceScheduleStatusActive},
+		},
+		failures: map[int64]time.Time{},
+	}
+	svc := NewPriceService(repo)
+
+	if _, err := svc.ApplyDuePriceSchedules(context.Background(), now, 10); err != nil {
+		t.Fatalf("ApplyDuePriceSchedules() error = %v", err)
+	}
+	// 调价期间价格被手动改为90，到期时只结束调价
+	if !repo.products[1].ShopPrice.Equals(valueobject.NewCNY(9000)) || len(repo.histories) != 0 {
+		t.Errorf("price = %v, histories = %v, want 90 and no history", repo.products[1].ShopPrice, repo.histories)
+	}
+	if repo.schedules[0].Status != entity.PriceScheduleStatusFinished {
+		t.Errorf("status = %s, want %s", repo.schedules[0].Status, entity.PriceScheduleStatusFinished)
+	}
+}
+
+func TestSchedulePriceChangeRejectsForeignCurrency(t *testing.T) {
+	svc := NewPriceService(&fakePriceRepo{})
+
+	_, err := svc.SchedulePriceChange(context.Background(), &entity.PriceSchedule{
+		ProductID: 1,
+		Price:     valueobject.NewMoney(1000, "USD"),
+		StartTime: time.Now(),
+	})
+	if !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("SchedulePriceChange() error = %v, want %v", err, ErrUnsupportedCurrency)
+	}
+}
@@ -2,12 +2,17 @@ package service
 
 import (
 	"context"
+	"time"
 	
 	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
 )
 
 // ProductRepository 商品仓储接口
 type ProductRepository interface {
+	// Transaction 在同一数据库事务中执行fn，fn通过txRepo完成的写操作在fn返回nil时一起提交，返回错误时全部回滚
+	Transaction(ctx context.Context, fn func(txRepo ProductRepository) error) error
+	
 	// 商品相关
 	GetProductByID(ctx context.Context, id int64) (*entity.Product, error)
 	GetProductBySN(ctx context.Context, goodsSN string) (*entity.Product, error)
@@ -18,11 +23,17 @@ type ProductRepository interface {
 	DeleteProduct(ctx context.Context, id int64) error
 	
 	// SKU相关
+	// 以下三个查询不包含已软删除的SKU
 	GetSKUByID(ctx context.Context, id int64) (*entity.ProductSKU, error)
 	GetSKUsByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error)
+	BatchGetSKUs(ctx context.Context, ids []int64) ([]*entity.ProductSKU, error)
+	// 包含已软删除的SKU，用于生成SKU时恢复规格组合相同的SKU
+	GetSKUsWithDeletedByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error)
 	CreateSKU(ctx context.Context, sku *entity.ProductSKU) error
+	// UpdateSKU 保存SKU的全部字段，DeletedAt为nil时会恢复已软删除的SKU
 	UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error
 	DeleteSKU(ctx context.Context, id int64) error
+	SoftDeleteSKUs(ctx context.Context, ids []int64) error
 	
 	// 属性相关
 	GetAttributesByProductID(ctx context.Context, productID int64) ([]*entity.ProductAttribute, error)
@@ -38,6 +49,27 @@ type ProductRepository interface {
 	GetSpecsByProductID(ctx context.Context, productID int64) ([]*entity.ProductSpec, error)
 	SaveSpecs(ctx context.Context, specs []*entity.ProductSpec) error
 	DeleteSpecByProductID(ctx context.Context, productID int64) error
+	
+	// 搜索索引同步任务，在修改商品的事务中登记，提交后由后台任务按商品的最新状态同步
+	EnqueueSearchTask(ctx context.Context, productID int64, now time.Time) error
+	ListDueSearchTasks(ctx context.Context, now time.Time, limit int) ([]*entity.SearchIndexTask, error)
+	// 占用任务直到until，返回false表示已被其他实例占用
+	ClaimSearchTask(ctx context.Context, task *entity.SearchIndexTask, now, until time.Time) (bool, error)
+	CompleteSearchTask(ctx context.Context, task *entity.SearchIndexTask) error
+	FailSearchTask(ctx context.Context, task *entity.SearchIndexTask, errMsg string, nextAttemptAt time.Time) error
+	
+	// 价格相关
+	SavePriceHistories(ctx context.Context, histories []*entity.PriceHistory) error
+	ListPriceHistories(ctx context.Context, filter PriceHistoryFilter) ([]*entity.PriceHistory, int64, error)
+	CreatePriceSchedule(ctx context.Context, schedule *entity.PriceSchedule) error
+	// 查询商品或SKU等待生效和已生效的调价，事务中加锁，避免并发创建时间段重叠的调价
+	ListOpenPriceSchedules(ctx context.Context, productID, skuID int64) ([]*entity.PriceSchedule, error)
+	// 查询到达开始时间的待生效调价和到达结束时间的已生效调价，按处理时间排序，同一时间先恢复再生效
+	ListDuePriceSchedules(ctx context.Context, now time.Time, limit int) ([]*entity.PriceSchedule, error)
+	// 仅当调价仍为fromStatus时更新状态，返回false表示已被其他实例处理
+	UpdatePriceScheduleStatus(ctx context.Context, schedule *entity.PriceSchedule, fromStatus string) (bool, error)
+	// 记录调价处理失败，到达nextAttemptAt之前不再查询到该调价
+	RecordPriceScheduleFailure(ctx context.Context, id int64, status string, errMsg string, nextAttemptAt time.Time) error
 }
 
 // ProductFilter 商品过滤条件
@@ -49,13 +81,21 @@ type ProductFilter struct {
 	IsNew      *bool
 	IsHot      *bool
 	ShipFree   *bool
-	PriceMin   *float64
-	PriceMax   *float64
+	PriceMin   *valueobject.Money
+	PriceMax   *valueobject.Money
 	OrderBy    string
 	Page       int
 	PageSize   int
 }
 
+// PriceHistoryFilter 价格变更记录过滤条件，SkuID为0时查询商品及其全部SKU的记录
+type PriceHistoryFilter struct {
+	ProductID int64
+	SkuID     int64
+	Page      int
+	PageSize  int
+}
+
 // CategoryRepository 分类仓储接口
 type CategoryRepository interface {
 	GetCategoryByID(ctx context.Context, id int64) (*entity.Category, error)
@@ -112,8 +152,8 @@ type SearchParams struct {
 	Keyword    string
 	CategoryID int64
 	BrandID    int64
-	PriceMin   float64
-	PriceMax   float64
+	PriceMin   valueobject.Money // 金额为0表示不限
+	PriceMax   valueobject.Money
 	OnSale     bool
 	IsNew      bool
 	IsHot      bool
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 	
 	"shop/backend/product/internal/domain/entity"
 )
@@ -14,13 +15,17 @@ type ProductService interface {
 	ListProducts(ctx context.Context, filter ProductFilter) ([]*entity.Product, int64, error)
 	BatchGetProducts(ctx context.Context, ids []int64) ([]*entity.Product, error)
 	CreateProduct(ctx context.Context, product *entity.Product, skus []*entity.ProductSKU, attrs []*entity.ProductAttribute, specs []*entity.ProductSpec, images []string) (*entity.Product, error)
-	UpdateProduct(ctx context.Context, product *entity.Product, skus []*entity.ProductSKU, attrs []*entity.ProductAttribute, specs []*entity.ProductSpec, images []string) error
+	// 本店价格或SKU价格有变化时按change记录价格变更历史
+	UpdateProduct(ctx context.Context, product *entity.Product, skus []*entity.ProductSKU, attrs []*entity.ProductAttribute, specs []*entity.ProductSpec, images []string, change PriceChange) error
 	DeleteProduct(ctx context.Context, id int64) error
 	
 	// 商品SKU相关接口
 	GetSKUByID(ctx context.Context, id int64) (*entity.ProductSKU, error)
 	GetSKUsByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error)
-	UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error
+	BatchGetSKUs(ctx context.Context, ids []int64) ([]*entity.ProductSKU, error)
+	UpdateSKU(ctx context.Context, sku *entity.ProductSKU, change PriceChange) error
+	// 按规格的笛卡尔积生成SKU，specs不为空时先替换商品的规格定义
+	GenerateSKUs(ctx context.Context, productID int64, specs []*entity.ProductSpec) ([]*entity.ProductSKU, error)
 	
 	// 商品状态变更接口
 	SetOnSale(ctx context.Context, id int64, onSale bool) error
@@ -28,6 +33,23 @@ type ProductService interface {
 	UpdateSoldCount(ctx context.Context, id int64, count int) error
 }
 
+// PriceChange 手动修改价格的操作人和原因，记录到价格变更历史
+type PriceChange struct {
+	Operator string
+	Reason   string
+}
+
+// PriceService 价格服务接口
+type PriceService interface {
+	// 价格变更历史，按变更时间倒序
+	GetPriceHistory(ctx context.Context, filter PriceHistoryFilter) ([]*entity.PriceHistory, int64, error)
+	
+	// 定时调价，到达开始时间后生效，设置了结束时间的到期后恢复原价
+	SchedulePriceChange(ctx context.Context, schedule *entity.PriceSchedule) (*entity.PriceSchedule, error)
+	// 处理到期的定时调价，返回本批处理的数量，由定时任务调用
+	ApplyDuePriceSchedules(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
 // CategoryService 分类服务接口
 type CategoryService interface {
 	// 分类管理相关接口
@@ -75,4 +97,6 @@ type SearchService interface {
 	BatchIndexProducts(ctx context.Context, products []*entity.Product) error
 	DeleteProductIndex(ctx context.Context, id int64) error
 	SyncProductIndex(ctx context.Context) error
+	// 按商品的最新状态处理到期的索引同步任务，返回本批处理的数量，由定时任务调用
+	SyncPendingIndexes(ctx context.Context, now time.Time, limit int) (int, error)
 }
@@ -3,9 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 	
 	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
 )
 
 var (
@@ -13,14 +16,20 @@ var (
 	ErrInvalidProduct  = errors.New("invalid product data")
 	ErrDuplicateSKU    = errors.New("duplicate SKU code")
 	ErrSKUNotFound     = errors.New("SKU not found")
+	ErrInvalidSpec     = errors.New("invalid product spec")
+	ErrTooManySKUs     = errors.New("too many SKU combinations")
+	// 数据库中的金额不保存币种，读取时按人民币处理，其他币种的金额写入后会被当作人民币读出
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
 )
 
+// 单个商品最多生成的SKU数量
+const maxSKUCombinations = 1000
+
 // ProductServiceImpl 商品服务实现
 type ProductServiceImpl struct {
 	productRepo ProductRepository
 	categoryRepo CategoryRepository
 	brandRepo    BrandRepository
-	searchRepo   SearchRepository
 }
 
 // NewProductService 创建商品服务实例
@@ -28,13 +37,11 @@ func NewProductService(
 	productRepo ProductRepository,
 	categoryRepo CategoryRepository,
 	brandRepo BrandRepository,
-	searchRepo SearchRepository,
 ) ProductService {
 	return &ProductServiceImpl{
 		productRepo:  productRepo,
 		categoryRepo: categoryRepo,
 		brandRepo:    brandRepo,
-		searchRepo:   searchRepo,
 	}
 }
 
@@ -71,6 +78,16 @@ func (s *ProductServiceImpl) GetProductByID(ctx context.Context, id int64) (*ent
 		product.SkuList = skus
 	}
 	
+	// 获取商品规格和属性
+	specs, err := s.productRepo.GetSpecsByProductID(ctx, id)
+	if err == nil {
+		product.Specs = specs
+	}
+	attrs, err := s.productRepo.GetAttributesByProductID(ctx, id)
+	if err == nil {
+		product.Attrs = attrs
+	}
+	
 	// 增加点击次数
 	go s.incrementClickCount(context.Background(), id)
 	
@@ -79,16 +96,7 @@ func (s *ProductServiceImpl) GetProductByID(ctx context.Context, id int64) (*ent
 
 // incrementClickCount 异步增加点击次数
 func (s *ProductServiceImpl) incrementClickCount(ctx context.Context, id int64) {
-	product, err := s.productRepo.GetProductByID(ctx, id)
-	if err != nil || product == nil {
-		return
-	}
-	
-	product.IncreaseClickNum()
-	s.productRepo.UpdateProduct(ctx, product)
-	
-	// 更新搜索索引
-	s.searchRepo.IndexProduct(ctx, product)
+	s.RecordClick(ctx, id)
 }
 
 // GetProductBySN 根据商品编号获取商品
@@ -107,6 +115,12 @@ func (s *ProductServiceImpl) GetProductBySN(ctx context.Context, goodsSN string)
 
 // ListProducts 获取商品列表
 func (s *ProductServiceImpl) ListProducts(ctx context.Context, filter ProductFilter) ([]*entity.Product, int64, error) {
+	for _, price := range []*valueobject.Money{filter.PriceMin, filter.PriceMax} {
+		if price != nil && !isStoredCurrency(*price) {
+			return nil, 0, ErrUnsupportedCurrency
+		}
+	}
+	
 	return s.productRepo.ListProducts(ctx, filter)
 }
 
@@ -115,7 +129,7 @@ func (s *ProductServiceImpl) BatchGetProducts(ctx context.Context, ids []int64)
 	return s.productRepo.BatchGetProducts(ctx, ids)
 }
 
-// CreateProduct 创建商品
+// CreateProduct 创建商品，商品及其SKU、属性、规格、图片和索引同步任务在同一事务中写入
 func (s *ProductServiceImpl) CreateProduct(
 	ctx context.Context,
 	product *entity.Product,
@@ -125,9 +139,12 @@ func (s *ProductServiceImpl) CreateProduct(
 	images []string,
 ) (*entity.Product, error) {
 	// 基本参数验证
-	if product.Name == "" || product.CategoryID <= 0 || product.BrandsID <= 0 {
+	if product.Name == "" || product.CategoryID <= 0 || product.BrandsID <= 0 || product.ShopPrice.IsNegative() {
 		return nil, ErrInvalidProduct
 	}
+	if err := checkProductCurrency(product, skus); err != nil {
+		return nil, err
+	}
 	
 	// 检查分类是否存在
 	category, err := s.categoryRepo.GetCategoryByID(ctx, product.CategoryID)
@@ -146,68 +163,62 @@ func (s *ProductServiceImpl) CreateProduct(
 	product.CreatedAt = now
 	product.UpdatedAt = now
 	
-	// 保存商品基本信息
-	if err := s.productRepo.CreateProduct(ctx, product); err != nil {
-		return nil, err
-	}
-	
-	// 保存SKU信息
-	if len(skus) > 0 {
+	err = s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		// 保存商品基本信息
+		if err := txRepo.CreateProduct(ctx, product); err != nil {
+			return err
+		}
+		
+		// 保存SKU信息
 		for _, sku := range skus {
 			sku.ProductID = product.ID
 			sku.CreatedAt = now
 			sku.UpdatedAt = now
-			if err := s.productRepo.CreateSKU(ctx, sku); err != nil {
-				return nil, err
+			if err := txRepo.CreateSKU(ctx, sku); err != nil {
+				return err
 			}
 		}
-	}
-	
-	// 保存属性信息
-	if len(attrs) > 0 {
-		for i := range attrs {
-			attrs[i].ProductID = product.ID
-		}
-		if err := s.productRepo.SaveAttributes(ctx, attrs); err != nil {
-			return nil, err
-		}
-	}
-	
-	// 保存规格信息
-	if len(specs) > 0 {
-		for i := range specs {
-			specs[i].ProductID = product.ID
-		}
-		if err := s.productRepo.SaveSpecs(ctx, specs); err != nil {
-			return nil, err
+		
+		// 保存属性信息
+		if len(attrs) > 0 {
+			for i := range attrs {
+				attrs[i].ProductID = product.ID
+			}
+			if err := txRepo.SaveAttributes(ctx, attrs); err != nil {
+				return err
+			}
 		}
-	}
-	
-	// 保存图片信息
-	if len(images) > 0 {
-		productImages := make([]*entity.ProductImage, len(images))
-		for i, image := range images {
-			productImages[i] = &entity.ProductImage{
-				ProductID: product.ID,
-				ImageURL:  image,
-				IsMain:    i == 0,
-				Sort:      i,
-				CreatedAt: now,
-				UpdatedAt: now,
+		
+		// 保存规格信息
+		if len(specs) > 0 {
+			for i := range specs {
+				specs[i].ProductID = product.ID
+			}
+			if err := txRepo.SaveSpecs(ctx, specs); err != nil {
+				return err
 			}
 		}
-		if err := s.productRepo.SaveImages(ctx, productImages); err != nil {
-			return nil, err
+		
+		// 保存图片信息
+		if len(images) > 0 {
+			if err := txRepo.SaveImages(ctx, newProductImages(product.ID, images, now)); err != nil {
+				return err
+			}
 		}
+		
+		// 登记搜索索引同步
+		return txRepo.EnqueueSearchTask(ctx, product.ID, now)
+	})
+	if err != nil {
+		// 回滚后清除自增ID，避免调用方误用
+		product.ID = 0
+		return nil, err
 	}
 	
-	// 同步到搜索引擎
-	go s.searchRepo.IndexProduct(context.Background(), product)
-	
 	return product, nil
 }
 
-// UpdateProduct 更新商品
+// UpdateProduct 更新商品，skus、attrs、specs和images为空时不修改对应内容，所有修改和价格变更记录在同一事务中完成
 func (s *ProductServiceImpl) UpdateProduct(
 	ctx context.Context,
 	product *entity.Product,
@@ -215,32 +226,49 @@ func (s *ProductServiceImpl) UpdateProduct(
 	attrs []*entity.ProductAttribute,
 	specs []*entity.ProductSpec,
 	images []string,
+	change PriceChange,
 ) error {
-	// 检查商品是否存在
-	existingProduct, err := s.productRepo.GetProductByID(ctx, product.ID)
-	if err != nil {
-		return err
-	}
-	
-	if existingProduct == nil {
-		return ErrProductNotFound
-	}
-	
-	// 更新时间
-	product.UpdatedAt = time.Now()
-	product.CreatedAt = existingProduct.CreatedAt
-	
-	// 保存商品基本信息
-	if err := s.productRepo.UpdateProduct(ctx, product); err != nil {
+	if err := checkProductCurrency(product, skus); err != nil {
 		return err
 	}
 	
-	// 更新SKU信息
-	if len(skus) > 0 {
-		// 删除旧SKU
-		oldSkus, err := s.productRepo.GetSKUsByProductID(ctx, product.ID)
-		if err == nil {
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		// 检查商品是否存在
+		existingProduct, err := txRepo.GetProductByID(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+		
+		if existingProduct == nil {
+			return ErrProductNotFound
+		}
+		
+		// 更新时间
+		now := time.Now()
+		product.UpdatedAt = now
+		product.CreatedAt = existingProduct.CreatedAt
+		
+		// 保存商品基本信息
+		if err := txRepo.UpdateProduct(ctx, product); err != nil {
+			return err
+		}
+		histories := make([]*entity.PriceHistory, 0)
+		if !existingProduct.ShopPrice.Equals(product.ShopPrice) {
+			histories = append(histories, change.history(product.ID, 0, existingProduct.ShopPrice, product.ShopPrice, now))
+		}
+		
+		// 更新SKU信息
+		if len(skus) > 0 {
+			// 软删除不再保留的旧SKU，历史订单仍可查询
+			oldSkus, err := txRepo.GetSKUsByProductID(ctx, product.ID)
+			if err != nil {
+				return err
+			}
+			removedIDs := make([]int64, 0)
+			oldSkuByID := make(map[int64]*entity.ProductSKU, len(oldSkus))
 			for _, oldSku := range oldSkus {
+				oldSkuByID[oldSku.ID] = oldSku
+				
 				// 检查是否保留
 				found := false
 				for _, newSku := range skus {
@@ -250,101 +278,169 @@ func (s *ProductServiceImpl) UpdateProduct(
 					}
 				}
 				if !found {
-					s.productRepo.DeleteSKU(ctx, oldSku.ID)
+					removedIDs = append(removedIDs, oldSku.ID)
 				}
 			}
-		}
-		
-		// 添加或更新SKU
-		now := time.Now()
-		for _, sku := range skus {
-			sku.ProductID = product.ID
-			sku.UpdatedAt = now
+			if err := txRepo.SoftDeleteSKUs(ctx, removedIDs); err != nil {
+				return err
+			}
 			
-			if sku.ID > 0 {
-				// 更新现有SKU
-				s.productRepo.UpdateSKU(ctx, sku)
-			} else {
-				// 添加新SKU
-				sku.CreatedAt = now
-				s.productRepo.CreateSKU(ctx, sku)
+			// 添加或更新SKU
+			for _, sku := range skus {
+				sku.ProductID = product.ID
+				sku.UpdatedAt = now
+				
+				if sku.ID > 0 {
+					// 更新现有SKU，已删除或属于其他商品的SKU不能更新
+					oldSku, ok := oldSkuByID[sku.ID]
+					if !ok {
+						return ErrSKUNotFound
+					}
+					sku.CreatedAt = oldSku.CreatedAt
+					sku.DeletedAt = nil
+					if err := txRepo.UpdateSKU(ctx, sku); err != nil {
+						return err
+					}
+					if !oldSku.Price.Equals(sku.Price) {
+						histories = append(histories, change.history(product.ID, sku.ID, oldSku.Price, sku.Price, now))
+					}
+				} else {
+					// 添加新SKU
+					sku.CreatedAt = now
+					if err := txRepo.CreateSKU(ctx, sku); err != nil {
+						return err
+					}
+				}
 			}
 		}
-	}
-	
-	// 更新属性
-	if len(attrs) > 0 {
-		s.productRepo.DeleteAttributeByProductID(ctx, product.ID)
-		for i := range attrs {
-			attrs[i].ProductID = product.ID
+		
+		// 更新属性
+		if len(attrs) > 0 {
+			if err := txRepo.DeleteAttributeByProductID(ctx, product.ID); err != nil {
+				return err
+			}
+			for i := range attrs {
+				attrs[i].ProductID = product.ID
+			}
+			if err := txRepo.SaveAttributes(ctx, attrs); err != nil {
+				return err
+			}
 		}
-		s.productRepo.SaveAttributes(ctx, attrs)
-	}
-	
-	// 更新规格
-	if len(specs) > 0 {
-		s.productRepo.DeleteSpecByProductID(ctx, product.ID)
-		for i := range specs {
-			specs[i].ProductID = product.ID
+		
+		// 更新规格
+		if len(specs) > 0 {
+			if err := txRepo.DeleteSpecByProductID(ctx, product.ID); err != nil {
+				return err
+			}
+			for i := range specs {
+				specs[i].ProductID = product.ID
+			}
+			if err := txRepo.SaveSpecs(ctx, specs); err != nil {
+				return err
+			}
 		}
-		s.productRepo.SaveSpecs(ctx, specs)
-	}
-	
-	// 更新图片
-	if len(images) > 0 {
-		s.productRepo.DeleteImageByProductID(ctx, product.ID)
-		now := time.Now()
-		productImages := make([]*entity.ProductImage, len(images))
-		for i, image := range images {
-			productImages[i] = &entity.ProductImage{
-				ProductID: product.ID,
-				ImageURL:  image,
-				IsMain:    i == 0,
-				Sort:      i,
-				CreatedAt: now,
-				UpdatedAt: now,
+		
+		// 更新图片
+		if len(images) > 0 {
+			if err := txRepo.DeleteImageByProductID(ctx, product.ID); err != nil {
+				return err
+			}
+			if err := txRepo.SaveImages(ctx, newProductImages(product.ID, images, now)); err != nil {
+				return err
 			}
 		}
-		if err := s.productRepo.SaveImages(ctx, productImages); err != nil {
+		
+		// 记录价格变更
+		if err := txRepo.SavePriceHistories(ctx, histories); err != nil {
 			return err
 		}
-	}
-	
-	// 同步到搜索引擎
-	go s.searchRepo.IndexProduct(context.Background(), product)
-	
-	return nil
+		
+		// 登记搜索索引同步
+		return txRepo.EnqueueSearchTask(ctx, product.ID, now)
+	})
 }
 
-// DeleteProduct 删除商品
+// DeleteProduct 删除商品，商品及其SKU、属性、规格、图片在同一事务中删除，并登记索引同步
 func (s *ProductServiceImpl) DeleteProduct(ctx context.Context, id int64) error {
-	// 检查商品是否存在
-	product, err := s.productRepo.GetProductByID(ctx, id)
-	if err != nil {
-		return err
-	}
-	
-	if product == nil {
-		return ErrProductNotFound
-	}
-	
-	// 删除商品
-	if err := s.productRepo.DeleteProduct(ctx, id); err != nil {
-		return err
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		// 检查商品是否存在
+		product, err := txRepo.GetProductByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		
+		if product == nil {
+			return ErrProductNotFound
+		}
+		
+		// 删除商品
+		if err := txRepo.DeleteProduct(ctx, id); err != nil {
+			return err
+		}
+		
+		// 软删除SKU，历史订单仍可查询
+		skus, err := txRepo.GetSKUsByProductID(ctx, id)
+		if err != nil {
+			return err
+		}
+		skuIDs := make([]int64, 0, len(skus))
+		for _, sku := range skus {
+			skuIDs = append(skuIDs, sku.ID)
+		}
+		if err := txRepo.SoftDeleteSKUs(ctx, skuIDs); err != nil {
+			return err
+		}
+		
+		// 删除关联的属性、规格、图片
+		if err := txRepo.DeleteAttributeByProductID(ctx, id); err != nil {
+			return err
+		}
+		if err := txRepo.DeleteSpecByProductID(ctx, id); err != nil {
+			return err
+		}
+		if err := txRepo.DeleteImageByProductID(ctx, id); err != nil {
+			return err
+		}
+		
+		// 登记搜索索引同步，同步时商品已删除，从索引中删除
+		return txRepo.EnqueueSearchTask(ctx, id, time.Now())
+	})
+}
+
+// isStoredCurrency 判断金额的币种是否为数据库中金额的币种
+func isStoredCurrency(price valueobject.Money) bool {
+	return price.SameCurrency(valueobject.NewCNY(0))
+}
+
+// checkProductCurrency 检查商品和SKU的价格都是人民币
+func checkProductCurrency(product *entity.Product, skus []*entity.ProductSKU) error {
+	if !isStoredCurrency(product.MarketPrice) || !isStoredCurrency(product.ShopPrice) {
+		return ErrUnsupportedCurrency
+	}
+	for _, sku := range skus {
+		if !isStoredCurrency(sku.Price) || !isStoredCurrency(sku.PromotionPrice) {
+			return ErrUnsupportedCurrency
+		}
 	}
-	
-	// 删除关联的SKU、属性、规格、图片等
-	// 这些可能在数据库层通过外键cascade删除，但仍然保留这些调用以确保数据完整性
-	s.productRepo.DeleteAttributeByProductID(ctx, id)
-	s.productRepo.DeleteSpecByProductID(ctx, id)
-	s.productRepo.DeleteImageByProductID(ctx, id)
-	
-	// 从搜索引擎删除
-	go s.searchRepo.DeleteProductIndex(context.Background(), id)
-	
 	return nil
 }
 
+// newProductImages 按顺序生成商品图片，第一张为主图
+func newProductImages(productID int64, images []string, now time.Time) []*entity.ProductImage {
+	productImages := make([]*entity.ProductImage, len(images))
+	for i, image := range images {
+		productImages[i] = &entity.ProductImage{
+			ProductID: productID,
+			ImageURL:  image,
+			IsMain:    i == 0,
+			Sort:      i,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+	return productImages
+}
+
 // GetSKUByID 根据ID获取SKU
 func (s *ProductServiceImpl) GetSKUByID(ctx context.Context, id int64) (*entity.ProductSKU, error) {
 	return s.productRepo.GetSKUByID(ctx, id)
@@ -355,73 +451,298 @@ func (s *ProductServiceImpl) GetSKUsByProductID(ctx context.Context, productID i
 	return s.productRepo.GetSKUsByProductID(ctx, productID)
 }
 
-// UpdateSKU 更新SKU信息
-func (s *ProductServiceImpl) UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error {
-	return s.productRepo.UpdateSKU(ctx, sku)
+// BatchGetSKUs 批量获取SKU
+func (s *ProductServiceImpl) BatchGetSKUs(ctx context.Context, ids []int64) ([]*entity.ProductSKU, error) {
+	if len(ids) == 0 {
+		return []*entity.ProductSKU{}, nil
+	}
+	
+	return s.productRepo.BatchGetSKUs(ctx, ids)
 }
 
-// SetOnSale 设置商品上下架状态
-func (s *ProductServiceImpl) SetOnSale(ctx context.Context, id int64, onSale bool) error {
-	product, err := s.productRepo.GetProductByID(ctx, id)
+// UpdateSKU 更新SKU信息，价格有变化时在同一事务中记录价格变更
+func (s *ProductServiceImpl) UpdateSKU(ctx context.Context, sku *entity.ProductSKU, change PriceChange) error {
+	if !isStoredCurrency(sku.Price) || !isStoredCurrency(sku.PromotionPrice) {
+		return ErrUnsupportedCurrency
+	}
+	
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		// 检查SKU是否存在
+		existingSKU, err := txRepo.GetSKUByID(ctx, sku.ID)
+		if err != nil {
+			return err
+		}
+		
+		if existingSKU == nil {
+			return ErrSKUNotFound
+		}
+		
+		now := time.Now()
+		sku.ProductID = existingSKU.ProductID
+		sku.CreatedAt = existingSKU.CreatedAt
+		sku.UpdatedAt = now
+		sku.DeletedAt = existingSKU.DeletedAt
+		
+		if err := txRepo.UpdateSKU(ctx, sku); err != nil {
+			return err
+		}
+		if existingSKU.Price.Equals(sku.Price) {
+			return nil
+		}
+		return txRepo.SavePriceHistories(ctx, []*entity.PriceHistory{
+			change.history(sku.ProductID, sku.ID, existingSKU.Price, sku.Price, now),
+		})
+	})
+}
+
+// GenerateSKUs 按规格生成全部SKU组合。规格组合仍然存在的SKU保留原有编码、价格和库存，
+// 已软删除但组合重新出现的SKU恢复使用，其余新组合创建SKU，不再存在的组合软删除
+func (s *ProductServiceImpl) GenerateSKUs(ctx context.Context, productID int64, specs []*entity.ProductSpec) ([]*entity.ProductSKU, error) {
+	// 检查商品是否存在
+	product, err := s.productRepo.GetProductByID(ctx, productID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	if product == nil {
-		return ErrProductNotFound
+		return nil, ErrProductNotFound
 	}
 	
-	product.SetOnSale(onSale)
-	if err := s.productRepo.UpdateProduct(ctx, product); err != nil {
-		return err
+	// 未指定规格时使用商品已保存的规格定义
+	replaceSpecs := len(specs) > 0
+	if !replaceSpecs {
+		specs, err = s.productRepo.GetSpecsByProductID(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := validateSpecs(specs); err != nil {
+		return nil, err
 	}
 	
-	// 更新搜索索引
-	go s.searchRepo.IndexProduct(context.Background(), product)
-	
-	return nil
-}
-
-// RecordClick 记录商品点击
-func (s *ProductServiceImpl) RecordClick(ctx context.Context, id int64) error {
-	product, err := s.productRepo.GetProductByID(ctx, id)
+	combinations, err := specCombinations(specs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	if product == nil {
-		return ErrProductNotFound
+	// 规格、SKU的新增、恢复和软删除在同一事务中完成
+	now := time.Now()
+	var result []*entity.ProductSKU
+	err = s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		// 替换规格定义
+		if replaceSpecs {
+			if err := txRepo.DeleteSpecByProductID(ctx, productID); err != nil {
+				return err
+			}
+			for _, spec := range specs {
+				spec.ProductID = productID
+				spec.CreatedAt = now
+				spec.UpdatedAt = now
+			}
+			if err := txRepo.SaveSpecs(ctx, specs); err != nil {
+				return err
+			}
+		}
+		
+		existingSkus, err := txRepo.GetSKUsWithDeletedByProductID(ctx, productID)
+		if err != nil {
+			return err
+		}
+		usedCodes := make(map[string]bool, len(existingSkus))
+		for _, sku := range existingSkus {
+			usedCodes[sku.SkuCode] = true
+		}
+		
+		// 按规格组合匹配已有SKU，优先使用未删除的SKU
+		matched := make(map[int64]bool, len(existingSkus))
+		result = make([]*entity.ProductSKU, 0, len(combinations))
+		for _, combination := range combinations {
+			var sku *entity.ProductSKU
+			for _, existing := range existingSkus {
+				if matched[existing.ID] || !existing.MatchSpecValues(combination.values) {
+					continue
+				}
+				if sku == nil || (sku.IsDeleted() && !existing.IsDeleted()) {
+					sku = existing
+				}
+			}
+			
+			switch {
+			case sku == nil:
+				// 新的规格组合
+				sku = &entity.ProductSKU{
+					ProductID:  productID,
+					SkuName:    strings.TrimSpace(product.Name + " " + strings.Join(combination.labels, " ")),
+					SkuCode:    nextSKUCode(product, combination.indexes, usedCodes),
+					Price:      product.ShopPrice,
+					SpecValues: combination.values,
+					CreatedAt:  now,
+					UpdatedAt:  now,
+				}
+				if err := txRepo.CreateSKU(ctx, sku); err != nil {
+					return err
+				}
+			case sku.IsDeleted():
+				// 组合重新出现，恢复已删除的SKU
+				sku.DeletedAt = nil
+				sku.UpdatedAt = now
+				if err := txRepo.UpdateSKU(ctx, sku); err != nil {
+					return err
+				}
+			}
+			matched[sku.ID] = true
+			result = append(result, sku)
+		}
+		
+		// 软删除不再存在的规格组合
+		orphanIDs := make([]int64, 0)
+		for _, sku := range existingSkus {
+			if !matched[sku.ID] && !sku.IsDeleted() {
+				orphanIDs = append(orphanIDs, sku.ID)
+			}
+		}
+		if err := txRepo.SoftDeleteSKUs(ctx, orphanIDs); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	
-	product.IncreaseClickNum()
-	if err := s.productRepo.UpdateProduct(ctx, product); err != nil {
-		return err
+	return result, nil
+}
+
+// specCombination 一个规格组合，indexes为各规格值在规格定义中的位置，labels为按规格顺序排列的规格值
+type specCombination struct {
+	values  map[string]string
+	labels  []string
+	indexes []int
+}
+
+// validateSpecs 校验规格定义，规格名和同一规格的规格值不能为空或重复
+func validateSpecs(specs []*entity.ProductSpec) error {
+	if len(specs) == 0 {
+		return ErrInvalidSpec
 	}
 	
-	// 更新搜索索引
-	go s.searchRepo.IndexProduct(context.Background(), product)
-	
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec.SpecName == "" || names[spec.SpecName] || len(spec.SpecValues) == 0 {
+			return ErrInvalidSpec
+		}
+		names[spec.SpecName] = true
+		
+		values := make(map[string]bool, len(spec.SpecValues))
+		for _, value := range spec.SpecValues {
+			if value == "" || values[value] {
+				return ErrInvalidSpec
+			}
+			values[value] = true
+		}
+	}
 	return nil
 }
 
-// UpdateSoldCount 更新销售数量
-func (s *ProductServiceImpl) UpdateSoldCount(ctx context.Context, id int64, count int) error {
-	product, err := s.productRepo.GetProductByID(ctx, id)
-	if err != nil {
-		return err
+// specCombinations 按规格定义的顺序生成规格值的笛卡尔积
+func specCombinations(specs []*entity.ProductSpec) ([]specCombination, error) {
+	total := 1
+	for _, spec := range specs {
+		total *= len(spec.SpecValues)
+		if total > maxSKUCombinations {
+			return nil, ErrTooManySKUs
+		}
 	}
 	
-	if product == nil {
-		return ErrProductNotFound
+	combinations := make([]specCombination, 0, total)
+	indexes := make([]int, len(specs))
+	for {
+		combination := specCombination{
+			values:  make(map[string]string, len(specs)),
+			labels:  make([]string, len(specs)),
+			indexes: append([]int(nil), indexes...),
+		}
+		for i, spec := range specs {
+			value := spec.SpecValues[indexes[i]]
+			combination.values[spec.SpecName] = value
+			combination.labels[i] = value
+		}
+		combinations = append(combinations, combination)
+		
+		// 从最后一个规格开始进位
+		i := len(specs) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(specs[i].SpecValues) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return combinations, nil
+		}
 	}
-	
-	product.IncreaseSoldNum(count)
-	if err := s.productRepo.UpdateProduct(ctx, product); err != nil {
-		return err
+}
+
+// nextSKUCode 生成SKU编码，格式为商品编号加各规格值的序号，如 G1001-0102；与已有编码重复时追加序号
+func nextSKUCode(product *entity.Product, indexes []int, usedCodes map[string]bool) string {
+	prefix := product.GoodsSN
+	if prefix == "" {
+		prefix = fmt.Sprintf("%d", product.ID)
 	}
 	
-	// 更新搜索索引
-	go s.searchRepo.IndexProduct(context.Background(), product)
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString("-")
+	for _, index := range indexes {
+		fmt.Fprintf(&b, "%02d", index+1)
+	}
 	
-	return nil
+	code := b.String()
+	for n := 2; usedCodes[code]; n++ {
+		code = fmt.Sprintf("%s-%d", b.String(), n)
+	}
+	usedCodes[code] = true
+	return code
+}
+
+// SetOnSale 设置商品上下架状态
+func (s *ProductServiceImpl) SetOnSale(ctx context.Context, id int64, onSale bool) error {
+	return s.updateProduct(ctx, id, func(product *entity.Product) {
+		product.SetOnSale(onSale)
+	})
+}
+
+// RecordClick 记录商品点击
+func (s *ProductServiceImpl) RecordClick(ctx context.Context, id int64) error {
+	return s.updateProduct(ctx, id, func(product *entity.Product) {
+		product.IncreaseClickNum()
+	})
+}
+
+// UpdateSoldCount 更新销售数量
+func (s *ProductServiceImpl) UpdateSoldCount(ctx context.Context, id int64, count int) error {
+	return s.updateProduct(ctx, id, func(product *entity.Product) {
+		product.IncreaseSoldNum(count)
+	})
+}
+
+// updateProduct 在事务中修改商品并登记搜索索引同步
+func (s *ProductServiceImpl) updateProduct(ctx context.Context, id int64, fn func(product *entity.Product)) error {
+	return s.productRepo.Transaction(ctx, func(txRepo ProductRepository) error {
+		product, err := txRepo.GetProductByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		
+		if product == nil {
+			return ErrProductNotFound
+		}
+		
+		fn(product)
+		if err := txRepo.UpdateProduct(ctx, product); err != nil {
+			return err
+		}
+		return txRepo.EnqueueSearchTask(ctx, id, product.UpdatedAt)
+	})
 }
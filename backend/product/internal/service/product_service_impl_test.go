@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
+)
+
+// fakeSKURepo 内存中的SKU，记录更新后的SKU
+type fakeSKURepo struct {
+	ProductRepository
+	skus    map[int64]*entity.ProductSKU
+	updated *entity.ProductSKU
+}
+
+func (r *fakeSKURepo) Transaction(ctx context.Context, fn func(txRepo ProductRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeSKURepo) GetSKUByID(ctx context.Context, id int64) (*entity.ProductSKU, error) {
+	return r.skus[id], nil
+}
+
+func (r *fakeSKURepo) UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error {
+	r.updated = sku
+	return nil
+}
+
+func TestUpdateSKUKeepsOwningProduct(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeSKURepo{skus: map[int64]*entity.ProductSKU{
+		7: {ID: 7, ProductID: 100, CreatedAt: created},
+	}}
+	svc := NewProductService(repo, nil, nil)
+
+	// 请求中的所属商品被忽略
+	if err := svc.UpdateSKU(context.Background(), &entity.ProductSKU{ID: 7, ProductID: 200, SkuName: "红色 XL"}, PriceChange{}); err != nil {
+		t.Fatalf("UpdateSKU() error = %v", err)
+	}
+	if repo.updated.ProductID != 100 || !repo.updated.CreatedAt.Equal(created) || repo.updated.SkuName != "红色 XL" {
+		t.Errorf("updated = %+v, want product 100 and the original creation time", repo.updated)
+	}
+
+	err := svc.UpdateSKU(context.Background(), &entity.ProductSKU{ID: 8}, PriceChange{})
+	if !errors.Is(err, ErrSKUNotFound) {
+		t.Errorf("UpdateSKU() error = %v, want %v", err, ErrSKUNotFound)
+	}
+}
+
+func TestUpdateSKURejectsForeignCurrency(t *testing.T) {
+	repo := &fakeSKURepo{skus: map[int64]*entity.ProductSKU{7: {ID: 7, ProductID: 100}}}
+	svc := NewProductService(repo, nil, nil)
+
+	// 数据库中的金额不保存币种，其他币种的价格不能写入
+	err := svc.UpdateSKU(context.Background(), &entity.ProductSKU{ID: 7, Price: valueobject.NewMoney(1000, "USD")}, PriceChange{})
+	if !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("UpdateSKU() error = %v, want %v", err, ErrUnsupportedCurrency)
+	}
+	if repo.updated != nil {
+		t.Errorf("updated = %+v, want no update", repo.updated)
+	}
+}
+
+func TestBatchGetSKUsWithoutIDs(t *testing.T) {
+	svc := NewProductService(&fakeSKURepo{}, nil, nil)
+
+	skus, err := svc.BatchGetSKUs(context.Background(), nil)
+	if err != nil || skus == nil || len(skus) != 0 {
+		t.Errorf("BatchGetSKUs() = %v, %v, want an empty list", skus, err)
+	}
+}
+
+// fakeGenerateRepo 内存中的商品、规格和SKU，包含已软删除的SKU
+type fakeGenerateRepo struct {
+	ProductRepository
+	product *entity.Product
+	specs   []*entity.ProductSpec
+	skus    []*entity.ProductSKU
+	nextID  int64
+}
+
+func (r *fakeGenerateRepo) Transaction(ctx context.Context, fn func(txRepo ProductRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeGenerateRepo) GetProductByID(ctx context.Context, id int64) (*entity.Product, error) {
+	return r.product, nil
+}
+
+func (r *fakeGenerateRepo) GetSpecsByProductID(ctx context.Context, productID int64) ([]*entity.ProductSpec, error) {
+	return r.specs, nil
+}
+
+func (r *fakeGenerateRepo) GetSKUsWithDeletedByProductID(ctx context.Context, productID int64) ([]*entity.ProductSKU, error) {
+	return append([]*entity.ProductSKU(nil), r.skus...), nil
+}
+
+func (r *fakeGenerateRepo) CreateSKU(ctx context.Context, sku *entity.ProductSKU) error {
+	r.nextID++
+	sku.ID = r.nextID
+	r.skus = append(r.skus, sku)
+	return nil
+}
+
+func (r *fakeGenerateRepo) UpdateSKU(ctx context.Context, sku *entity.ProductSKU) error {
+	return nil
+}
+
+func (r *fakeGenerateRepo) SoftDeleteSKUs(ctx context.Context, ids []int64) error {
+	now := time.Now()
+	for _, sku := range r.skus {
+		for _, id := range ids {
+			if sku.ID == id {
+				sku.DeletedAt = &now
+			}
+		}
+	}
+	return nil
+}
+
+func TestGenerateSKUsReusesMatchingCombinations(t *testing.T) {
+	deleted := time.Now()
+	repo := &fakeGenerateRepo{
+		product: &entity.Product{ID: 100, Name: "T恤", GoodsSN: "G100", ShopPrice: valueobject.NewCNY(9900)},
+		specs: []*entity.ProductSpec{
+			{SpecName: "颜色", SpecValues: []string{"红色", "蓝色"}},
+			{SpecName: "尺寸", SpecValues: []string{"M", "L"}},
+		},
+		skus: []*entity.ProductSKU{
+			{ID: 1, SkuCode: "G100-0101", Price: valueobject.NewCNY(8900), SpecValues: map[string]string{"颜色": "红色", "尺寸": "M"}},
+			{ID: 2, SkuCode: "G100-0202", SpecValues: map[string]string{"颜色": "蓝色", "尺寸": "L"}, DeletedAt: &deleted},
+			{ID: 3, SkuCode: "G100-0301", SpecValues: map[string]string{"颜色": "绿色", "尺寸": "M"}},
+		},
+		nextID: 3,
+	}
+	svc := NewProductService(repo, nil, nil)
+
+	skus, err := svc.GenerateSKUs(context.Background(), 100, nil)
+	if err != nil {
+		t.Fatalf("GenerateSKUs() error = %v", err)
+	}
+	if len(skus) != 4 {
+		t.Fatalf("got %d SKUs, want 4", len(skus))
+	}
+	// 按规格顺序生成：红M、红L、蓝M、蓝L
+	if skus[0].ID != 1 || !skus[0].Price.Equals(valueobject.NewCNY(8900)) {
+		t.Errorf("red M = %+v, want the existing SKU with its price", skus[0])
+	}
+	if skus[1].ID != 4 || skus[1].SkuCode != "G100-0102" || !skus[1].Price.Equals(valueobject.NewCNY(9900)) || skus[1].SkuName != "T恤 红色 L" {
+		t.Errorf("red L = %+v, want a new SKU at the shop price", skus[1])
+	}
+	if skus[3].ID != 2 || skus[3].IsDeleted() {
+		t.Errorf("blue L = %+v, want the deleted SKU restored", skus[3])
+	}
+	// 不再存在的绿色组合被软删除
+	if !repo.skus[2].IsDeleted() {
+		t.Errorf("green M = %+v, want soft deleted", repo.skus[2])
+	}
+}
+
+func TestSpecCombinationsRejectsTooMany(t *testing.T) {
+	values := make([]string, 40)
+	for i := range values {
+		values[i] = string(rune('a' + i))
+	}
+	specs := []*entity.ProductSpec{
+		{SpecName: "A", SpecValues: values},
+		{SpecName: "B", SpecValues: values},
+	}
+	if _, err := specCombinations(specs); !errors.Is(err, ErrTooManySKUs) {
+		t.Errorf("specCombinations() error = %v, want %v", err, ErrTooManySKUs)
+	}
+	if err := validateSpecs([]*entity.ProductSpec{{SpecName: "颜色", SpecValues: []string{"红色", "红色"}}}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("validateSpecs() error = %v, want %v", err, ErrInvalidSpec)
+	}
+}
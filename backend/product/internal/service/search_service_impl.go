@@ -4,6 +4,8 @@ import (
 	"context"
 	"time"
 	
+	"go.uber.org/zap"
+	
 	"shop/backend/product/internal/domain/entity"
 )
 
@@ -11,6 +13,14 @@ var (
 	ErrSearchFailed = "search operation failed"
 )
 
+// 索引同步任务的占用时长、单次操作的超时时间，以及失败后重试的基础间隔和最大间隔
+const (
+	searchTaskLease        = time.Minute
+	searchTimeout          = 5 * time.Second
+	searchRetryInterval    = 5 * time.Second
+	searchMaxRetryInterval = 10 * time.Minute
+)
+
 // SearchServiceImpl 搜索服务实现
 type SearchServiceImpl struct {
 	searchRepo SearchRepository
@@ -35,6 +45,10 @@ func (s *SearchServiceImpl) SearchProducts(ctx context.Context, params *SearchPa
 		go s.recordHotKeyword(context.Background(), params.Keyword)
 	}
 	
+	if !isStoredCurrency(params.PriceMin) || !isStoredCurrency(params.PriceMax) {
+		return nil, ErrUnsupportedCurrency
+	}
+	
 	// 设置默认值
 	if params.Page <= 0 {
 		params.Page = 1
@@ -84,3 +98,71 @@ func (s *SearchServiceImpl) SyncProductIndex(ctx context.Context) error {
 	
 	return err
 }
+
+// SyncPendingIndexes 处理到期的索引同步任务。每个任务按商品在数据库中的最新状态写入或删除索引，
+// 同一商品同时只有一个实例处理，保证索引不会被旧的状态覆盖；失败的任务按递增的间隔重试
+func (s *SearchServiceImpl) SyncPendingIndexes(ctx context.Context, now time.Time, limit int) (int, error) {
+	tasks, err := s.productRepo.ListDueSearchTasks(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	
+	for i, task := range tasks {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		ok, err := s.productRepo.ClaimSearchTask(ctx, task, now, now.Add(searchTaskLease))
+		if err != nil {
+			return i, err
+		}
+		if !ok {
+			continue
+		}
+		
+		if err := s.syncProductIndex(ctx, task.ProductID); err != nil {
+			attempts := task.Attempts + 1
+			zap.L().Warn("Search index sync failed",
+				zap.Int64("product_id", task.ProductID),
+				zap.Int("attempts", attempts),
+				zap.Error(err))
+			nextAttemptAt := now.Add(retryDelay(attempts, searchRetryInterval, searchMaxRetryInterval))
+			err = s.productRepo.FailSearchTask(ctx, task, err.Error(), nextAttemptAt)
+			if err != nil {
+				return i, err
+			}
+			continue
+		}
+		if err := s.productRepo.CompleteSearchTask(ctx, task); err != nil {
+			return i, err
+		}
+	}
+	return len(tasks), nil
+}
+
+// syncProductIndex 读取数据库中商品的最新状态写入索引，商品不存在或已删除时删除索引
+func (s *SearchServiceImpl) syncProductIndex(ctx context.Context, productID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+	
+	// 不经过缓存，避免用缓存中的旧数据覆盖索引
+	products, err := s.productRepo.BatchGetProducts(ctx, []int64{productID})
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return s.searchRepo.DeleteProductIndex(ctx, productID)
+	}
+	return s.searchRepo.IndexProduct(ctx, products[0])
+}
+
+// retryDelay 返回第attempts次失败后的重试间隔，按失败次数的平方递增，不超过max
+func retryDelay(attempts int, base, max time.Duration) time.Duration {
+	if attempts > 100 {
+		return max
+	}
+	delay := time.Duration(attempts*attempts) * base
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shop/backend/product/internal/domain/entity"
+)
+
+// fakeSearchTaskRepo 内存中的商品和索引同步任务，claimed中的商品已被其他实例占用
+type fakeSearchTaskRepo struct {
+	ProductRepository
+	products  map[int64]*entity.Product
+	tasks     []*entity.SearchIndexTask
+	claimed   map[int64]bool
+	completed []int64
+	failed    map[int64]time.Time
+}
+
+func (r *fakeSearchTaskRepo) ListDueSearchTasks(ctx context.Context, now time.Time, limit int) ([]*entity.SearchIndexTask, error) {
+	return r.tasks, nil
+}
+
+func (r *fakeSearchTaskRepo) ClaimSearchTask(ctx context.Context, task *entity.SearchIndexTask, now, until time.Time) (bool, error) {
+	return !r.claimed[task.ProductID], nil
+}
+
+func (r *fakeSearchTaskRepo) CompleteSearchTask(ctx context.Context, task *entity.SearchIndexTask) error {
+	r.completed = append(r.completed, task.ProductID)
+	return nil
+}
+
+func (r *fakeSearchTaskRepo) FailSearchTask(ctx context.Context, task *entity.SearchIndexTask, errMsg string, nextAttemptAt time.Time) error {
+	r.failed[task.ProductID] = nextAttemptAt
+	return nil
+}
+
+func (r *fakeSearchTaskRepo) BatchGetProducts(ctx context.Context, ids []int64) ([]*entity.Product, error) {
+	var products []*entity.Product
+	for _, id := range ids {
+		if product, ok := r.products[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// fakeSearchRepo 记录写入和删除的索引，failing中的商品写入失败
+type fakeSearchRepo struct {
+	SearchRepository
+	indexed []int64
+	deleted []int64
+	failing map[int64]bool
+}
+
+func (r *fakeSearchRepo) IndexProduct(ctx context.Context, product *entity.Product) error {
+	if r.failing[product.ID] {
+		return errors.New("elasticsearch unavailable")
+	}
+	r.indexed = append(r.indexed, product.ID)
+	return nil
+}
+
+func (r *fakeSearchRepo) DeleteProductIndex(ctx context.Context, id int64) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func TestSyncPendingIndexesUsesLatestProductState(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeSearchTaskRepo{
+		products: map[int64]*entity.Product{
+			1: {ID: 1, Name: "T恤"},
+			3: {ID: 3, Name: "卫衣"},
+			4: {ID: 4, Name: "外套"},
+		},
+		tasks: []*entity.SearchIndexTask{
+			{ProductID: 1},
+			{ProductID: 2},
+			{ProductID: 3, Attempts: 1},
+			{ProductID: 4},
+		},
+		claimed: map[int64]bool{4: true},
+		failed:  map[int64]time.Time{},
+	}
+	searchRepo := &fakeSearchRepo{failing: map[int64]bool{3: true}}
+	svc := NewSearchService(searchRepo, repo)
+
+	n, err := svc.SyncPendingIndexes(context.Background(), now, 10)
+	if err != nil {
+		t.Fatalf("SyncPendingIndexes() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("processed = %d, want 4", n)
+	}
+	// 商品1写入索引，已删除的商品2从索引中删除，被占用的商品4跳过
+	if len(searchRepo.indexed) != 1 || searchRepo.indexed[0] != 1 {
+		t.Errorf("indexed = %v, want [1]", searchRepo.indexed)
+	}
+	if len(searchRepo.deleted) != 1 || searchRepo.deleted[0] != 2 {
+		t.Errorf("deleted = %v, want [2]", searchRepo.deleted)
+	}
+	if len(repo.completed) != 2 {
+		t.Errorf("completed = %v, want [1 2]", repo.completed)
+	}
+	// 商品3第二次失败，4倍基础间隔后重试
+	if next, ok := repo.failed[3]; !ok || !next.Equal(now.Add(4*searchRetryInterval)) {
+		t.Errorf("retry of product 3 at %v, want %v", next, now.Add(4*searchRetryInterval))
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	if got := retryDelay(1, searchRetryInterval, searchMaxRetryInterval); got != searchRetryInterval {
+		t.Errorf("retryDelay(1) = %v, want %v", got, searchRetryInterval)
+	}
+	if got := retryDelay(1000, searchRetryInterval, searchMaxRetryInterval); got != searchMaxRetryInterval {
+		t.Errorf("retryDelay(1000) = %v, want %v", got, searchMaxRetryInterval)
+	}
+}
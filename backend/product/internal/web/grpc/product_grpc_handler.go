@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -10,6 +11,7 @@ import (
 	
 	"shop/backend/product/api/proto"
 	"shop/backend/product/internal/domain/entity"
+	"shop/backend/product/internal/domain/valueobject"
 	"shop/backend/product/internal/service"
 )
 
@@ -21,6 +23,7 @@ type ProductHandler struct {
 	brandService    service.BrandService
 	bannerService   service.BannerService
 	searchService   service.SearchService
+	priceService    service.PriceService
 }
 
 // NewProductHandler 创建商品服务gRPC处理器
@@ -30,6 +33,7 @@ func NewProductHandler(
 	brandService service.BrandService,
 	bannerService service.BannerService,
 	searchService service.SearchService,
+	priceService service.PriceService,
 ) *ProductHandler {
 	return &ProductHandler{
 		productService:  productService,
@@ -37,6 +41,7 @@ func NewProductHandler(
 		brandService:    brandService,
 		bannerService:   bannerService,
 		searchService:   searchService,
+		priceService:    priceService,
 	}
 }
 
@@ -46,8 +51,8 @@ func (h *ProductHandler) GoodsList(ctx context.Context, req *proto.GoodsFilterRe
 	filter := service.ProductFilter{
 		Page:       int(req.Page),
 		PageSize:   int(req.PageSize),
-		PriceMin:   floatPtr(float64(req.PriceMin)),
-		PriceMax:   floatPtr(float64(req.PriceMax)),
+		PriceMin:   moneyFilter(req.PriceMin),
+		PriceMax:   moneyFilter(req.PriceMax),
 		CategoryID: req.CategoryId,
 		BrandID:    req.BrandId,
 		IsHot:      boolPtr(req.IsHot),
@@ -63,6 +68,9 @@ func (h *ProductHandler) GoodsList(ctx context.Context, req *proto.GoodsFilterRe
 	// 获取商品列表
 	products, total, err := h.productService.ListProducts(ctx, filter)
 	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		}
 		return nil, status.Errorf(codes.Internal, "获取商品列表失败: %v", err)
 	}
 	
@@ -122,8 +130,8 @@ func (h *ProductHandler) CreateGoods(ctx context.Context, req *proto.CreateGoods
 		GoodsSN:         req.GoodsSn,
 		CategoryID:      req.CategoryId,
 		BrandsID:        req.BrandId,
-		MarketPrice:     req.MarketPrice,
-		ShopPrice:       req.ShopPrice,
+		MarketPrice:     convertProtoToMoney(req.MarketPrice),
+		ShopPrice:       convertProtoToMoney(req.ShopPrice),
 		GoodsBrief:      req.GoodsBrief,
 		GoodsDesc:       req.GoodsDesc,
 		ShipFree:        req.ShipFree,
@@ -134,12 +142,19 @@ func (h *ProductHandler) CreateGoods(ctx context.Context, req *proto.CreateGoods
 	}
 	
 	// 创建商品
-	createdProduct, err := h.productService.CreateProduct(ctx, product, nil, nil, nil, req.Images)
+	skus, attrs, specs := convertProtoToSKUs(req.Skus), convertProtoToAttributes(req.Attrs), convertProtoToSpecs(req.Specs)
+	createdProduct, err := h.productService.CreateProduct(ctx, product, skus, attrs, specs, req.Images)
 	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		}
 		return nil, status.Errorf(codes.Internal, "创建商品失败: %v", err)
 	}
 	
 	// 转换为响应格式
+	createdProduct.SkuList = skus
+	createdProduct.Specs = specs
+	createdProduct.Attrs = attrs
 	return convertProductToProto(createdProduct), nil
 }
 
@@ -160,8 +175,8 @@ func (h *ProductHandler) UpdateGoods(ctx context.Context, req *proto.CreateGoods
 	existingProduct.GoodsSN = req.GoodsSn
 	existingProduct.CategoryID = req.CategoryId
 	existingProduct.BrandsID = req.BrandId
-	existingProduct.MarketPrice = req.MarketPrice
-	existingProduct.ShopPrice = req.ShopPrice
+	existingProduct.MarketPrice = convertProtoToMoney(req.MarketPrice)
+	existingProduct.ShopPrice = convertProtoToMoney(req.ShopPrice)
 	existingProduct.GoodsBrief = req.GoodsBrief
 	existingProduct.GoodsDesc = req.GoodsDesc
 	existingProduct.ShipFree = req.ShipFree
@@ -171,7 +186,15 @@ func (h *ProductHandler) UpdateGoods(ctx context.Context, req *proto.CreateGoods
 	existingProduct.GoodsFrontImage = req.GoodsFrontImage
 	
 	// 更新商品
-	if err := h.productService.UpdateProduct(ctx, existingProduct, nil, nil, nil, req.Images); err != nil {
+	skus, attrs, specs := convertProtoToSKUs(req.Skus), convertProtoToAttributes(req.Attrs), convertProtoToSpecs(req.Specs)
+	change := service.PriceChange{Operator: req.Operator, Reason: req.PriceReason}
+	if err := h.productService.UpdateProduct(ctx, existingProduct, skus, attrs, specs, req.Images, change); err != nil {
+		switch {
+		case errors.Is(err, service.ErrSKUNotFound):
+			return nil, status.Errorf(codes.NotFound, "SKU不存在")
+		case errors.Is(err, service.ErrUnsupportedCurrency):
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		}
 		return nil, status.Errorf(codes.Internal, "更新商品失败: %v", err)
 	}
 	
@@ -188,6 +211,174 @@ func (h *ProductHandler) DeleteGoods(ctx context.Context, req *proto.DeleteGoods
 	return &emptypb.Empty{}, nil
 }
 
+// GetSku 获取SKU详情
+func (h *ProductHandler) GetSku(ctx context.Context, req *proto.SkuRequest) (*proto.SkuInfo, error) {
+	// 获取SKU详情
+	sku, err := h.productService.GetSKUByID(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "获取SKU详情失败: %v", err)
+	}
+	
+	if sku == nil {
+		return nil, status.Errorf(codes.NotFound, "SKU不存在")
+	}
+	
+	// 转换为响应格式
+	return convertSKUToProto(sku), nil
+}
+
+// BatchGetSkus 批量获取SKU信息
+func (h *ProductHandler) BatchGetSkus(ctx context.Context, req *proto.BatchSkuIdInfo) (*proto.SkuListResponse, error) {
+	// 批量获取SKU
+	skus, err := h.productService.BatchGetSKUs(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "批量获取SKU信息失败: %v", err)
+	}
+	
+	// 转换为响应格式
+	skuList := make([]*proto.SkuInfo, 0, len(skus))
+	for _, sku := range skus {
+		skuList = append(skuList, convertSKUToProto(sku))
+	}
+	
+	return &proto.SkuListResponse{
+		Total: int64(len(skuList)),
+		Skus:  skuList,
+	}, nil
+}
+
+// UpdateSku 更新SKU
+func (h *ProductHandler) UpdateSku(ctx context.Context, req *proto.SkuInfo) (*emptypb.Empty, error) {
+	// 检查SKU是否存在
+	existingSKU, err := h.productService.GetSKUByID(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "查询SKU失败: %v", err)
+	}
+	
+	if existingSKU == nil {
+		return nil, status.Errorf(codes.NotFound, "SKU不存在")
+	}
+	
+	// 更新SKU信息，所属商品不能修改
+	existingSKU.SkuName = req.SkuName
+	existingSKU.SkuCode = req.SkuCode
+	existingSKU.BarCode = req.BarCode
+	existingSKU.Price = convertProtoToMoney(req.Price)
+	existingSKU.PromotionPrice = convertProtoToMoney(req.PromotionPrice)
+	existingSKU.Points = int(req.Points)
+	existingSKU.Stocks = int(req.Stocks)
+	existingSKU.Image = req.Image
+	existingSKU.SpecValues = req.SpecValues
+	
+	// 更新SKU
+	change := service.PriceChange{Operator: req.Operator, Reason: req.PriceReason}
+	if err := h.productService.UpdateSKU(ctx, existingSKU, change); err != nil {
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		}
+		return nil, status.Errorf(codes.Internal, "更新SKU失败: %v", err)
+	}
+	
+	return &emptypb.Empty{}, nil
+}
+
+// GenerateSkus 按规格生成商品的全部SKU组合
+func (h *ProductHandler) GenerateSkus(ctx context.Context, req *proto.GenerateSkusRequest) (*proto.SkuListResponse, error) {
+	// 生成SKU
+	skus, err := h.productService.GenerateSKUs(ctx, req.GoodsId, convertProtoToSpecs(req.Specs))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProductNotFound):
+			return nil, status.Errorf(codes.NotFound, "商品不存在")
+		case errors.Is(err, service.ErrInvalidSpec), errors.Is(err, service.ErrTooManySKUs):
+			return nil, status.Errorf(codes.InvalidArgument, "生成SKU失败: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "生成SKU失败: %v", err)
+	}
+	
+	// 转换为响应格式
+	skuList := make([]*proto.SkuInfo, 0, len(skus))
+	for _, sku := range skus {
+		skuList = append(skuList, convertSKUToProto(sku))
+	}
+	
+	return &proto.SkuListResponse{
+		Total: int64(len(skuList)),
+		Skus:  skuList,
+	}, nil
+}
+
+// GetPriceHistory 查询商品或SKU的价格变更记录
+func (h *ProductHandler) GetPriceHistory(ctx context.Context, req *proto.PriceHistoryRequest) (*proto.PriceHistoryListResponse, error) {
+	// 构建过滤条件
+	filter := service.PriceHistoryFilter{
+		ProductID: req.GoodsId,
+		SkuID:     req.SkuId,
+		Page:      int(req.Page),
+		PageSize:  int(req.PageSize),
+	}
+	
+	// 查询价格变更记录
+	histories, total, err := h.priceService.GetPriceHistory(ctx, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidParameter) {
+			return nil, status.Errorf(codes.InvalidArgument, "商品ID不能为空")
+		}
+		return nil, status.Errorf(codes.Internal, "查询价格变更记录失败: %v", err)
+	}
+	
+	// 转换为响应格式
+	historyList := make([]*proto.PriceHistoryInfo, 0, len(histories))
+	for _, history := range histories {
+		historyList = append(historyList, convertPriceHistoryToProto(history))
+	}
+	
+	return &proto.PriceHistoryListResponse{
+		Total: total,
+		Data:  historyList,
+	}, nil
+}
+
+// SchedulePriceChange 创建定时调价
+func (h *ProductHandler) SchedulePriceChange(ctx context.Context, req *proto.PriceScheduleRequest) (*proto.PriceScheduleInfo, error) {
+	// 构建调价实体
+	schedule := &entity.PriceSchedule{
+		ProductID: req.GoodsId,
+		SkuID:     req.SkuId,
+		Price:     convertProtoToMoney(req.Price),
+		Operator:  req.Operator,
+		Reason:    req.Reason,
+	}
+	if req.StartTime != nil {
+		schedule.StartTime = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		endTime := req.EndTime.AsTime()
+		schedule.EndTime = &endTime
+	}
+	
+	// 创建调价
+	createdSchedule, err := h.priceService.SchedulePriceChange(ctx, schedule)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProductNotFound):
+			return nil, status.Errorf(codes.NotFound, "商品不存在")
+		case errors.Is(err, service.ErrSKUNotFound):
+			return nil, status.Errorf(codes.NotFound, "SKU不存在")
+		case errors.Is(err, service.ErrInvalidPriceSchedule):
+			return nil, status.Errorf(codes.InvalidArgument, "创建定时调价失败: %v", err)
+		case errors.Is(err, service.ErrUnsupportedCurrency):
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		case errors.Is(err, service.ErrPriceScheduleConflict):
+			return nil, status.Errorf(codes.FailedPrecondition, "创建定时调价失败: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "创建定时调价失败: %v", err)
+	}
+	
+	// 转换为响应格式
+	return convertPriceScheduleToProto(createdSchedule), nil
+}
+
 // GetAllCategorysList 获取所有分类
 func (h *ProductHandler) GetAllCategorysList(ctx context.Context, _ *emptypb.Empty) (*proto.CategoryListResponse, error) {
 	// 获取所有分类
@@ -464,8 +655,8 @@ func (h *ProductHandler) SearchGoods(ctx context.Context, req *proto.GoodsSearch
 		Keyword:   req.Keywords,
 		CategoryID: req.CategoryId,
 		BrandID:   req.BrandId,
-		PriceMin:  req.PriceMin,
-		PriceMax:  req.PriceMax,
+		PriceMin:  convertProtoToMoney(req.PriceMin),
+		PriceMax:  convertProtoToMoney(req.PriceMax),
 		IsNew:     req.IsNew,
 		IsHot:     req.IsHot,
 		Page:      int(req.Page),
@@ -476,6 +667,9 @@ func (h *ProductHandler) SearchGoods(ctx context.Context, req *proto.GoodsSearch
 	// 执行搜索
 	result, err := h.searchService.SearchProducts(ctx, searchParams)
 	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedCurrency) {
+			return nil, status.Errorf(codes.InvalidArgument, "只支持人民币金额")
+		}
 		return nil, status.Errorf(codes.Internal, "商品搜索失败: %v", err)
 	}
 	
@@ -501,8 +695,8 @@ func convertProductToProto(product *entity.Product) *proto.GoodsInfoResponse {
 		Id:              product.ID,
 		Name:            product.Name,
 		GoodsSn:         product.GoodsSN,
-		MarketPrice:     product.MarketPrice,
-		ShopPrice:       product.ShopPrice,
+		MarketPrice:     convertMoneyToProto(product.MarketPrice),
+		ShopPrice:       convertMoneyToProto(product.ShopPrice),
 		GoodsBrief:      product.GoodsBrief,
 		GoodsDesc:       product.GoodsDesc,
 		ShipFree:        product.ShipFree,
@@ -525,27 +719,167 @@ func convertProductToProto(product *entity.Product) *proto.GoodsInfoResponse {
 		goodsInfo.Brand = convertBrandToProto(product.Brand)
 	}
 	
-	// 商品库存
-	if len(product.SKUs) > 0 {
+	// 商品SKU及库存
+	if len(product.SkuList) > 0 {
 		var totalStock int32
-		for _, sku := range product.SKUs {
-			totalStock += int32(sku.Stock)
+		skus := make([]*proto.SkuInfo, 0, len(product.SkuList))
+		for _, sku := range product.SkuList {
+			totalStock += int32(sku.Stocks)
+			skus = append(skus, convertSKUToProto(sku))
 		}
 		goodsInfo.Stocks = totalStock
+		goodsInfo.Skus = skus
+	}
+	
+	// 商品规格
+	if len(product.Specs) > 0 {
+		specs := make([]*proto.SpecInfo, 0, len(product.Specs))
+		for _, spec := range product.Specs {
+			specs = append(specs, &proto.SpecInfo{
+				Id:         spec.ID,
+				SpecName:   spec.SpecName,
+				SpecValues: spec.SpecValues,
+			})
+		}
+		goodsInfo.Specs = specs
+	}
+	
+	// 商品属性
+	if len(product.Attrs) > 0 {
+		attrs := make([]*proto.AttributeInfo, 0, len(product.Attrs))
+		for _, attr := range product.Attrs {
+			attrs = append(attrs, &proto.AttributeInfo{
+				Id:        attr.ID,
+				AttrName:  attr.AttrName,
+				AttrValue: attr.AttrValue,
+				AttrSort:  int32(attr.AttrSort),
+			})
+		}
+		goodsInfo.Attrs = attrs
 	}
 	
 	// 商品图片
 	if len(product.Images) > 0 {
-		images := make([]string, 0, len(product.Images))
-		for _, img := range product.Images {
-			images = append(images, img.Url)
-		}
-		goodsInfo.Images = images
+		goodsInfo.Images = product.Images
 	}
 	
 	return goodsInfo
 }
 
+// 工具函数：转换SKU实体为proto响应
+func convertSKUToProto(sku *entity.ProductSKU) *proto.SkuInfo {
+	if sku == nil {
+		return nil
+	}
+	
+	return &proto.SkuInfo{
+		Id:             sku.ID,
+		GoodsId:        sku.ProductID,
+		SkuName:        sku.SkuName,
+		SkuCode:        sku.SkuCode,
+		BarCode:        sku.BarCode,
+		Price:          convertMoneyToProto(sku.Price),
+		PromotionPrice: convertMoneyToProto(sku.PromotionPrice),
+		Points:         int32(sku.Points),
+		Stocks:         int32(sku.Stocks),
+		Image:          sku.Image,
+		SpecValues:     sku.SpecValues,
+	}
+}
+
+// 工具函数：转换proto请求为SKU实体
+func convertProtoToSKUs(skus []*proto.SkuInfo) []*entity.ProductSKU {
+	if len(skus) == 0 {
+		return nil
+	}
+	
+	result := make([]*entity.ProductSKU, 0, len(skus))
+	for _, sku := range skus {
+		result = append(result, &entity.ProductSKU{
+			ID:             sku.Id,
+			SkuName:        sku.SkuName,
+			SkuCode:        sku.SkuCode,
+			BarCode:        sku.BarCode,
+			Price:          convertProtoToMoney(sku.Price),
+			PromotionPrice: convertProtoToMoney(sku.PromotionPrice),
+			Points:         int(sku.Points),
+			Stocks:         int(sku.Stocks),
+			Image:          sku.Image,
+			OriginalStock:  int(sku.Stocks),
+			SpecValues:     sku.SpecValues,
+		})
+	}
+	return result
+}
+
+// 工具函数：转换proto请求为规格实体
+func convertProtoToSpecs(specs []*proto.SpecInfo) []*entity.ProductSpec {
+	if len(specs) == 0 {
+		return nil
+	}
+	
+	result := make([]*entity.ProductSpec, 0, len(specs))
+	for _, spec := range specs {
+		result = append(result, &entity.ProductSpec{
+			SpecName:   spec.SpecName,
+			SpecValues: spec.SpecValues,
+		})
+	}
+	return result
+}
+
+// 工具函数：转换proto请求为属性实体
+func convertProtoToAttributes(attrs []*proto.AttributeInfo) []*entity.ProductAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	
+	result := make([]*entity.ProductAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		result = append(result, &entity.ProductAttribute{
+			AttrName:  attr.AttrName,
+			AttrValue: attr.AttrValue,
+			AttrSort:  int(attr.AttrSort),
+		})
+	}
+	return result
+}
+
+// 工具函数：转换价格变更记录为proto响应
+func convertPriceHistoryToProto(history *entity.PriceHistory) *proto.PriceHistoryInfo {
+	return &proto.PriceHistoryInfo{
+		Id:         history.ID,
+		GoodsId:    history.ProductID,
+		SkuId:      history.SkuID,
+		OldPrice:   convertMoneyToProto(history.OldPrice),
+		NewPrice:   convertMoneyToProto(history.NewPrice),
+		Source:     history.Source,
+		ScheduleId: history.ScheduleID,
+		Operator:   history.Operator,
+		Reason:     history.Reason,
+		CreatedAt:  timestamppb.New(history.CreatedAt),
+	}
+}
+
+// 工具函数：转换定时调价为proto响应
+func convertPriceScheduleToProto(schedule *entity.PriceSchedule) *proto.PriceScheduleInfo {
+	scheduleInfo := &proto.PriceScheduleInfo{
+		Id:            schedule.ID,
+		GoodsId:       schedule.ProductID,
+		SkuId:         schedule.SkuID,
+		Price:         convertMoneyToProto(schedule.Price),
+		OriginalPrice: convertMoneyToProto(schedule.OriginalPrice),
+		StartTime:     timestamppb.New(schedule.StartTime),
+		Status:        schedule.Status,
+		Operator:      schedule.Operator,
+		Reason:        schedule.Reason,
+	}
+	if schedule.EndTime != nil {
+		scheduleInfo.EndTime = timestamppb.New(*schedule.EndTime)
+	}
+	return scheduleInfo
+}
+
 // 工具函数：转换分类实体为proto响应
 func convertCategoryToProto(category *entity.Category) *proto.CategoryInfoResponse {
 	if category == nil {
@@ -574,9 +908,29 @@ func convertBrandToProto(brand *entity.Brand) *proto.BrandInfoResponse {
 	}
 }
 
-// 工具函数：创建float64指针
-func floatPtr(v float64) *float64 {
-	return &v
+// 工具函数：转换金额为proto响应
+func convertMoneyToProto(money valueobject.Money) *proto.Money {
+	return &proto.Money{
+		Amount:   money.Amount,
+		Currency: money.Currency,
+	}
+}
+
+// 工具函数：转换proto金额为金额值对象，为空时为0
+func convertProtoToMoney(money *proto.Money) valueobject.Money {
+	if money == nil {
+		return valueobject.NewCNY(0)
+	}
+	return valueobject.NewMoney(money.Amount, money.Currency)
+}
+
+// 工具函数：转换proto金额为过滤条件，为空或不大于0时不过滤
+func moneyFilter(money *proto.Money) *valueobject.Money {
+	if money == nil || money.Amount <= 0 {
+		return nil
+	}
+	value := convertProtoToMoney(money)
+	return &value
 }
 
 // 工具函数：创建bool指针
@@ -23,6 +23,7 @@ func NewServer(
 	brandService service.BrandService,
 	bannerService service.BannerService,
 	searchService service.SearchService,
+	priceService service.PriceService,
 	opts ...grpc.ServerOption,
 ) *Server {
 	// 创建gRPC服务器
@@ -39,6 +40,7 @@ func NewServer(
 		brandService,
 		bannerService,
 		searchService,
+		priceService,
 	)
 	
 	// 注册商品服务
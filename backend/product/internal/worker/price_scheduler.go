@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/product/internal/service"
+)
+
+const (
+	// 默认定时调价扫描间隔
+	defaultPriceScheduleInterval = 30 * time.Second
+	// 默认每批处理的调价数量
+	defaultPriceScheduleBatchSize = 100
+)
+
+// PriceScheduler 定时调价任务，定期生效到达开始时间的调价并恢复到期的调价。
+// 多个实例同时运行时通过调价状态的条件更新保证每个调价只被处理一次
+type PriceScheduler struct {
+	priceService service.PriceService
+	interval     time.Duration
+	batchSize    int
+	logger       *zap.Logger
+}
+
+// NewPriceScheduler 创建定时调价任务
+func NewPriceScheduler(
+	priceService service.PriceService,
+	interval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *PriceScheduler {
+	if interval <= 0 {
+		interval = defaultPriceScheduleInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultPriceScheduleBatchSize
+	}
+
+	return &PriceScheduler{
+		priceService: priceService,
+		interval:     interval,
+		batchSize:    batchSize,
+		logger:       logger,
+	}
+}
+
+// Run 启动定时调价任务，直到ctx被取消
+func (s *PriceScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	// 启动时立即执行一轮，处理停机期间到期的调价
+	s.apply(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.apply(ctx)
+		}
+	}
+}
+
+// apply 执行一轮调价，按批处理直到没有到期的调价
+func (s *PriceScheduler) apply(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := s.priceService.ApplyDuePriceSchedules(ctx, time.Now(), s.batchSize)
+		if err != nil {
+			s.logger.Error("Failed to apply price schedules", zap.Error(err))
+			return
+		}
+		if processed < s.batchSize {
+			return
+		}
+	}
+}
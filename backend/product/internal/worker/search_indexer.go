@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shop/backend/product/internal/service"
+)
+
+const (
+	// 默认索引同步扫描间隔
+	defaultSearchIndexInterval = time.Second
+	// 默认每批处理的同步任务数量
+	defaultSearchIndexBatchSize = 100
+)
+
+// SearchIndexer 搜索索引同步任务，定期按商品的最新状态处理商品变更时登记的同步任务。
+// 多个实例同时运行时通过任务的占用保证同一商品同时只被一个实例同步
+type SearchIndexer struct {
+	searchService service.SearchService
+	interval      time.Duration
+	batchSize     int
+	logger        *zap.Logger
+}
+
+// NewSearchIndexer 创建搜索索引同步任务
+func NewSearchIndexer(
+	searchService service.SearchService,
+	interval time.Duration,
+	batchSize int,
+	logger *zap.Logger,
+) *SearchIndexer {
+	if interval <= 0 {
+		interval = defaultSearchIndexInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultSearchIndexBatchSize
+	}
+
+	return &SearchIndexer{
+		searchService: searchService,
+		interval:      interval,
+		batchSize:     batchSize,
+		logger:        logger,
+	}
+}
+
+// Run 启动索引同步任务，直到ctx被取消
+func (s *SearchIndexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	// 启动时立即执行一轮，处理停机期间未同步的任务
+	s.sync(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sync(ctx)
+		}
+	}
+}
+
+// sync 执行一轮同步，按批处理直到没有到期的任务
+func (s *SearchIndexer) sync(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := s.searchService.SyncPendingIndexes(ctx, time.Now(), s.batchSize)
+		if err != nil {
+			s.logger.Error("Failed to sync search indexes", zap.Error(err))
+			return
+		}
+		if processed < s.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,5 @@
+-- 商品价格由float改为decimal，避免浮点精度导致订单金额与商品价格相差0.01
+-- MySQL转换时按四舍五入保留两位小数
+ALTER TABLE `goods`
+  MODIFY `market_price` decimal(10,2) DEFAULT 0 COMMENT '市场价',
+  MODIFY `shop_price` decimal(10,2) DEFAULT 0 COMMENT '本店价格';
@@ -0,0 +1,40 @@
+-- 商品价格变更记录表
+CREATE TABLE `goods_price_history` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `goods` int(11) NOT NULL COMMENT '商品ID',
+  `sku` int(11) NOT NULL DEFAULT 0 COMMENT 'SKU ID，0表示商品本店价格',
+  `old_price` decimal(10,2) NOT NULL COMMENT '变更前价格',
+  `new_price` decimal(10,2) NOT NULL COMMENT '变更后价格',
+  `source` varchar(20) NOT NULL COMMENT '变更来源：manual手动修改，schedule定时调价生效，revert定时调价到期恢复',
+  `schedule_id` int(11) NOT NULL DEFAULT 0 COMMENT '定时调价ID',
+  `operator` varchar(50) DEFAULT '' COMMENT '操作人',
+  `reason` varchar(255) DEFAULT '' COMMENT '变更原因',
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_goods_sku_created` (`goods`, `sku`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 定时调价表
+CREATE TABLE `goods_price_schedule` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `goods` int(11) NOT NULL COMMENT '商品ID',
+  `sku` int(11) NOT NULL DEFAULT 0 COMMENT 'SKU ID，0表示商品本店价格',
+  `price` decimal(10,2) NOT NULL COMMENT '调整后价格',
+  `original_price` decimal(10,2) DEFAULT 0 COMMENT '生效前价格，到期时按此恢复',
+  `start_time` datetime(3) NOT NULL COMMENT '生效时间',
+  `end_time` datetime(3) DEFAULT NULL COMMENT '恢复时间，为空表示长期有效',
+  `status` varchar(20) NOT NULL COMMENT '状态：pending等待生效，active已生效，finished已结束',
+  `operator` varchar(50) DEFAULT '' COMMENT '操作人',
+  `reason` varchar(255) DEFAULT '' COMMENT '调价原因',
+  `applied_at` datetime(3) DEFAULT NULL COMMENT '实际生效时间',
+  `finished_at` datetime(3) DEFAULT NULL COMMENT '实际结束时间',
+  `attempts` int(11) NOT NULL DEFAULT 0 COMMENT '连续失败次数',
+  `last_error` varchar(500) DEFAULT '' COMMENT '最近一次失败原因',
+  `next_attempt_at` datetime(3) DEFAULT NULL COMMENT '失败后的重试时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_goods_sku_status` (`goods`, `sku`, `status`),
+  INDEX `idx_status_start` (`status`, `start_time`),
+  INDEX `idx_status_end` (`status`, `end_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
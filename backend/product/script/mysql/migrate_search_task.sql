@@ -0,0 +1,15 @@
+-- 搜索索引同步任务表，每个商品最多一条，商品变更的事务中写入，后台任务按商品的最新状态同步到搜索引擎
+CREATE TABLE `goods_search_task` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `goods` int(11) NOT NULL COMMENT '商品ID',
+  `version` int(11) NOT NULL DEFAULT 1 COMMENT '登记次数，同步期间商品再次变更时递增',
+  `attempts` int(11) NOT NULL DEFAULT 0 COMMENT '连续失败次数',
+  `last_error` varchar(500) DEFAULT '' COMMENT '最近一次失败原因',
+  `next_attempt_at` datetime(3) NOT NULL COMMENT '下次同步时间',
+  `locked_until` datetime(3) DEFAULT NULL COMMENT '处理中的占用到期时间',
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_goods` (`goods`),
+  INDEX `idx_next_attempt` (`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;